@@ -426,7 +426,9 @@ func KnownControllers() []string {
 }
 
 // ControllersDisabledByDefault is the controller disabled default when starting cloud-controller managers.
-var ControllersDisabledByDefault = sets.NewString()
+// The gateway controller requires the Gateway API CRDs to be installed, and the private endpoint connection
+// controller updates the private endpoint connections, which is opted in by the cluster admin.
+var ControllersDisabledByDefault = sets.NewString("gateway", "private-endpoint-connection")
 
 // newControllerInitializers is a private map of named controller groups (you can start more than one in an init func)
 // paired to their initFunc.  This allows for structured downstream composition and subdivision.
@@ -437,6 +439,10 @@ func newControllerInitializers() map[string]initFunc {
 	controllers["service"] = startServiceController
 	controllers["route"] = startRouteController
 	controllers["node-ipam"] = startNodeIpamController
+	controllers["private-endpoint-connection"] = startPrivateEndpointConnectionController
+	controllers["gateway"] = startGatewayController
+	controllers["outbound"] = startOutboundController
+	controllers["instance-state"] = startInstanceStateController
 	return controllers
 }
 
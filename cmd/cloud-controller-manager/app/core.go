@@ -27,6 +27,7 @@ import (
 	"strings"
 
 	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	"k8s.io/client-go/dynamic"
 	cloudprovider "k8s.io/cloud-provider"
 	nodecontroller "k8s.io/cloud-provider/controllers/node"
 	nodelifecyclecontroller "k8s.io/cloud-provider/controllers/nodelifecycle"
@@ -38,9 +39,11 @@ import (
 
 	cloudcontrollerconfig "sigs.k8s.io/cloud-provider-azure/cmd/cloud-controller-manager/app/config"
 	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/gateway"
 	nodeipamcontroller "sigs.k8s.io/cloud-provider-azure/pkg/nodeipam"
 	nodeipamconfig "sigs.k8s.io/cloud-provider-azure/pkg/nodeipam/config"
 	"sigs.k8s.io/cloud-provider-azure/pkg/nodeipam/ipam"
+	"sigs.k8s.io/cloud-provider-azure/pkg/provider"
 )
 
 func startCloudNodeController(ctx context.Context, controllerContext genericcontrollermanager.ControllerContext, completedConfig *cloudcontrollerconfig.CompletedConfig, cloud cloudprovider.Interface, stopCh <-chan struct{}) (http.Handler, bool, error) {
@@ -143,6 +146,61 @@ func startRouteController(ctx context.Context, controllerContext genericcontroll
 	return nil, true, nil
 }
 
+func startPrivateEndpointConnectionController(ctx context.Context, controllerContext genericcontrollermanager.ControllerContext, completedConfig *cloudcontrollerconfig.CompletedConfig, cloud cloudprovider.Interface, stopCh <-chan struct{}) (http.Handler, bool, error) {
+	az, ok := cloud.(*provider.Cloud)
+	if !ok {
+		klog.Warningf("The cloud provider %T does not support private endpoint connections. Will not approve private endpoint connections.", cloud)
+		return nil, false, nil
+	}
+
+	go az.RunPrivateEndpointConnectionController(ctx, completedConfig.ComponentConfig.KubeCloudShared.ClusterName)
+
+	return nil, true, nil
+}
+
+func startOutboundController(ctx context.Context, controllerContext genericcontrollermanager.ControllerContext, completedConfig *cloudcontrollerconfig.CompletedConfig, cloud cloudprovider.Interface, stopCh <-chan struct{}) (http.Handler, bool, error) {
+	az, ok := cloud.(*provider.Cloud)
+	if !ok || az.OutboundConfig == nil {
+		klog.Infof("The outbound connectivity is not configured. Will not manage outbound rules or NAT gateways.")
+		return nil, false, nil
+	}
+
+	go az.RunOutboundController(ctx, completedConfig.ComponentConfig.KubeCloudShared.ClusterName)
+
+	return nil, true, nil
+}
+
+func startInstanceStateController(ctx context.Context, controllerContext genericcontrollermanager.ControllerContext, completedConfig *cloudcontrollerconfig.CompletedConfig, cloud cloudprovider.Interface, stopCh <-chan struct{}) (http.Handler, bool, error) {
+	az, ok := cloud.(*provider.Cloud)
+	if !ok || !az.IsInstanceStateEnabled() {
+		klog.Infof("The instance state is not enabled. Will not report the instance states or remediate failed instances.")
+		return nil, false, nil
+	}
+
+	go az.RunInstanceStateController(ctx)
+
+	return nil, true, nil
+}
+
+func startGatewayController(ctx context.Context, controllerContext genericcontrollermanager.ControllerContext, completedConfig *cloudcontrollerconfig.CompletedConfig, cloud cloudprovider.Interface, stopCh <-chan struct{}) (http.Handler, bool, error) {
+	balancer, ok := cloud.LoadBalancer()
+	if !ok {
+		klog.Warning("The cloud provider does not support load balancers. Will not start the gateway controller.")
+		return nil, false, nil
+	}
+
+	gatewayController := gateway.NewController(
+		completedConfig.ComponentConfig.KubeCloudShared.ClusterName,
+		balancer,
+		completedConfig.ClientBuilder.ClientOrDie("gateway-controller"),
+		dynamic.NewForConfigOrDie(completedConfig.ClientBuilder.ConfigOrDie("gateway-controller")),
+		completedConfig.SharedInformers,
+	)
+	go gatewayController.Run(ctx, int(completedConfig.ComponentConfig.ServiceController.ConcurrentServiceSyncs))
+
+	return nil, true, nil
+}
+
 func startNodeIpamController(ctx context.Context, controllerContext genericcontrollermanager.ControllerContext, completedConfig *cloudcontrollerconfig.CompletedConfig, cloud cloudprovider.Interface, stopCh <-chan struct{}) (http.Handler, bool, error) {
 	var serviceCIDR *net.IPNet
 	var secondaryServiceCIDR *net.IPNet
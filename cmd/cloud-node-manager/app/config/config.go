@@ -25,6 +25,8 @@ import (
 	"k8s.io/client-go/tools/record"
 	cloudprovider "k8s.io/cloud-provider"
 	componentbaseconfig "k8s.io/component-base/config"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/nodemanager"
 )
 
 // Config is the main context object for the cloud node manager.
@@ -78,6 +80,11 @@ type Config struct {
 	// Specifies if node information is retrieved via IMDS or ARM.
 	UseInstanceMetadata bool
 
+	// NodeMetadataSync configures the node labels and taints synced from the Azure metadata.
+	NodeMetadataSync nodemanager.NodeMetadataSync
+	// ScheduledEvents configures how the node reacts to the scheduled events of the VM.
+	ScheduledEvents nodemanager.ScheduledEventsConfig
+
 	// WindowsService should be set to true if cloud-node-manager is running as a service on Windows.
 	// Its corresponding flag only gets registered in Windows builds
 	WindowsService bool
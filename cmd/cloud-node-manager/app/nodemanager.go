@@ -137,7 +137,9 @@ func startControllers(ctx context.Context, c *cloudnodeconfig.Config, stopCh <-c
 		c.ClientBuilder.ClientOrDie("node-controller"),
 		nodeprovider.NewNodeProvider(ctx, c.UseInstanceMetadata, c.CloudConfigFilePath),
 		c.NodeStatusUpdateFrequency.Duration,
-		c.WaitForRoutes)
+		c.WaitForRoutes,
+		c.NodeMetadataSync,
+		c.ScheduledEvents)
 
 	go nodeController.Run(stopCh)
 
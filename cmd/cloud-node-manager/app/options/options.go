@@ -41,6 +41,7 @@ import (
 	"k8s.io/klog/v2"
 
 	cloudnodeconfig "sigs.k8s.io/cloud-provider-azure/cmd/cloud-node-manager/app/config"
+	"sigs.k8s.io/cloud-provider-azure/pkg/nodemanager"
 
 	// add the related feature gates
 	_ "k8s.io/controller-manager/pkg/features/register"
@@ -56,6 +57,9 @@ const (
 	CloudControllerManagerPort = 10263
 	// defaultNodeStatusUpdateFrequencyInMinute is the default frequency at which the manager updates nodes' status.
 	defaultNodeStatusUpdateFrequencyInMinute = 5
+	// defaultScheduledEventsPollIntervalInSecond is the default interval at which the manager polls the scheduled
+	// events, which may be noticed only 30 seconds in advance.
+	defaultScheduledEventsPollIntervalInSecond = 5
 )
 
 // CloudNodeManagerOptions is the main context object for the controller manager.
@@ -83,6 +87,25 @@ type CloudNodeManagerOptions struct {
 
 	UseInstanceMetadata bool
 
+	// NodeTagLabels maps the names of the VM or VMSS tags to the node labels synced from them.
+	NodeTagLabels map[string]string
+	// EnableNodeMetadataLabels indicates whether the priority, dedicated host, proximity placement group,
+	// accelerated networking and ephemeral OS disk of the VM are synced into the well-known node labels.
+	EnableNodeMetadataLabels bool
+	// NodeMetadataTaints maps the synced node labels to the taints in the format of "value:effect" of the nodes
+	// whose labels have the values.
+	NodeMetadataTaints map[string]string
+
+	// EnableScheduledEvents indicates whether the scheduled events of the VM are polled from IMDS to taint
+	// and cordon the node before it is evicted, rebooted, redeployed or terminated.
+	EnableScheduledEvents bool
+	// ScheduledEventsPollInterval is the interval to poll the scheduled events.
+	ScheduledEventsPollInterval metav1.Duration
+	// ScheduledEventsTaintEffect is the effect of the taint added to the node impacted by a scheduled event.
+	ScheduledEventsTaintEffect string
+	// AcknowledgeScheduledEvents indicates whether the scheduled event is acknowledged once the node is drained.
+	AcknowledgeScheduledEvents bool
+
 	// WindowsService should be set to true if cloud-node-manager is running as a service on Windows.
 	// Its corresponding flag only gets registered in Windows builds
 	WindowsService bool
@@ -97,6 +120,10 @@ func NewCloudNodeManagerOptions() (*CloudNodeManagerOptions, error) {
 		NodeStatusUpdateFrequency: metav1.Duration{
 			Duration: defaultNodeStatusUpdateFrequencyInMinute * time.Minute,
 		},
+		ScheduledEventsPollInterval: metav1.Duration{
+			Duration: defaultScheduledEventsPollIntervalInSecond * time.Second,
+		},
+		ScheduledEventsTaintEffect: string(v1.TaintEffectNoSchedule),
 	}
 
 	s.Authentication.RemoteKubeConfigFileOptional = true
@@ -131,6 +158,13 @@ func (o *CloudNodeManagerOptions) Flags() cliflag.NamedFlagSets {
 	fs.BoolVar(&o.WaitForRoutes, "wait-routes", false, "Whether the nodes should wait for routes created on Azure route table. It should be set to true when using kubenet plugin.")
 	fs.BoolVar(&o.UseInstanceMetadata, "use-instance-metadata", true, "Should use Instance Metadata Service for fetching node information; if false will use ARM instead.")
 	fs.StringVar(&o.CloudConfigFilePath, "cloud-config", o.CloudConfigFilePath, "The path to the cloud config file to be used when using ARM to fetch node information.")
+	fs.Var(cliflag.NewMapStringString(&o.NodeTagLabels), "node-tag-labels", "A set of tag=label pairs that sync the VM or VMSS tags into the node labels, e.g. 'team=example.com/team'.")
+	fs.BoolVar(&o.EnableNodeMetadataLabels, "enable-node-metadata-labels", false, "Whether the priority, dedicated host, proximity placement group, accelerated networking and ephemeral OS disk of the VM should be synced into the node labels.")
+	fs.Var(cliflag.NewMapStringString(&o.NodeMetadataTaints), "node-metadata-taints", "A set of label=value:effect pairs that taint the nodes whose synced node labels have the values, e.g. 'kubernetes.azure.com/scalesetpriority=spot:NoSchedule'.")
+	fs.BoolVar(&o.EnableScheduledEvents, "enable-scheduled-events", false, "Whether the scheduled events of the VM should be polled from the instance metadata service to taint and cordon the node before a Preempt, Reboot, Redeploy or Terminate event.")
+	fs.DurationVar(&o.ScheduledEventsPollInterval.Duration, "scheduled-events-poll-interval", o.ScheduledEventsPollInterval.Duration, "Specifies how often the scheduled events are polled.")
+	fs.StringVar(&o.ScheduledEventsTaintEffect, "scheduled-events-taint-effect", o.ScheduledEventsTaintEffect, "The effect of the taint added to the node impacted by a scheduled event, one of NoSchedule, PreferNoSchedule and NoExecute.")
+	fs.BoolVar(&o.AcknowledgeScheduledEvents, "acknowledge-scheduled-events", false, "Whether the scheduled event should be acknowledged once the node is drained, so that it starts without waiting for its deadline.")
 	return fss
 }
 
@@ -191,6 +225,34 @@ func (o *CloudNodeManagerOptions) ApplyTo(c *cloudnodeconfig.Config, userAgent s
 	c.UseInstanceMetadata = o.UseInstanceMetadata
 	c.CloudConfigFilePath = o.CloudConfigFilePath
 
+	c.NodeMetadataSync = nodemanager.NodeMetadataSync{
+		TagLabels:            o.NodeTagLabels,
+		EnableMetadataLabels: o.EnableNodeMetadataLabels,
+	}
+	for key, value := range o.NodeMetadataTaints {
+		taint, err := nodemanager.ParseNodeMetadataTaint(value)
+		if err != nil {
+			return fmt.Errorf("invalid --node-metadata-taints: %w", err)
+		}
+		if c.NodeMetadataSync.Taints == nil {
+			c.NodeMetadataSync.Taints = make(map[string]nodemanager.NodeMetadataTaint)
+		}
+		c.NodeMetadataSync.Taints[key] = taint
+	}
+	if err := c.NodeMetadataSync.Validate(); err != nil {
+		return err
+	}
+
+	c.ScheduledEvents = nodemanager.ScheduledEventsConfig{
+		Enabled:      o.EnableScheduledEvents,
+		PollInterval: o.ScheduledEventsPollInterval.Duration,
+		TaintEffect:  v1.TaintEffect(o.ScheduledEventsTaintEffect),
+		Acknowledge:  o.AcknowledgeScheduledEvents,
+	}
+	if err := c.ScheduledEvents.Validate(); err != nil {
+		return err
+	}
+
 	c.WindowsService = o.WindowsService
 
 	return nil
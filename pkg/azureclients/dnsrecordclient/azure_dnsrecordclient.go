@@ -0,0 +1,265 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dnsrecordclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/privatedns/mgmt/2018-09-01/privatedns"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/klog/v2"
+
+	azclients "sigs.k8s.io/cloud-provider-azure/pkg/azureclients"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/armclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+var _ Interface = &Client{}
+
+const privateDNSZoneResourceType = "/providers/microsoft.network/privatednszones/"
+
+// Client implements the record set client Interface.
+type Client struct {
+	// armClient sends the requests of the public DNS zones, and privateDNSArmClient sends the ones of the
+	// private DNS zones, since they are served by different API versions.
+	armClient           armclient.Interface
+	privateDNSArmClient armclient.Interface
+	subscriptionID      string
+
+	// Rate limiting configures.
+	rateLimiterReader flowcontrol.RateLimiter
+	rateLimiterWriter flowcontrol.RateLimiter
+
+	// ARM throttling configures.
+	RetryAfterReader time.Time
+	RetryAfterWriter time.Time
+}
+
+// New creates a new record set client with ratelimiting.
+func New(config *azclients.ClientConfig) *Client {
+	baseURI := config.ResourceManagerEndpoint
+	authorizer := config.Authorizer
+	armClient := armclient.New(authorizer, *config, baseURI, APIVersion)
+	privateDNSArmClient := armclient.New(authorizer, *config, baseURI, PrivateDNSAPIVersion)
+	rateLimiterReader, rateLimiterWriter := azclients.NewRateLimiter(config.RateLimitConfig)
+
+	if azclients.RateLimitEnabled(config.RateLimitConfig) {
+		klog.V(2).Infof("Azure DNSRecordSetsClient (read ops) using rate limit config: QPS=%g, bucket=%d",
+			config.RateLimitConfig.CloudProviderRateLimitQPS,
+			config.RateLimitConfig.CloudProviderRateLimitBucket)
+		klog.V(2).Infof("Azure DNSRecordSetsClient (write ops) using rate limit config: QPS=%g, bucket=%d",
+			config.RateLimitConfig.CloudProviderRateLimitQPSWrite,
+			config.RateLimitConfig.CloudProviderRateLimitBucketWrite)
+	}
+
+	client := &Client{
+		armClient:           armClient,
+		privateDNSArmClient: privateDNSArmClient,
+		rateLimiterReader:   rateLimiterReader,
+		rateLimiterWriter:   rateLimiterWriter,
+		subscriptionID:      config.SubscriptionID,
+	}
+
+	return client
+}
+
+// IsPrivateDNSZone returns true if the resource ID is a private DNS zone.
+func IsPrivateDNSZone(zoneID string) bool {
+	return strings.Contains(strings.ToLower(zoneID), privateDNSZoneResourceType)
+}
+
+// getRecordSetID returns the resource ID of the record set in the DNS zone.
+func getRecordSetID(zoneID string, recordType privatedns.RecordType, relativeRecordSetName string) string {
+	return fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(zoneID, "/"), recordType, relativeRecordSetName)
+}
+
+// getARMClient returns the ARM client of the zone and the resource group and the subscription for the metrics.
+func (c *Client) getARMClient(zoneID string) (armclient.Interface, string, string) {
+	resourceGroup, subscriptionID := "", c.subscriptionID
+	if resource, err := azure.ParseResourceID(zoneID); err == nil {
+		resourceGroup, subscriptionID = resource.ResourceGroup, resource.SubscriptionID
+	}
+	if IsPrivateDNSZone(zoneID) {
+		return c.privateDNSArmClient, resourceGroup, subscriptionID
+	}
+	return c.armClient, resourceGroup, subscriptionID
+}
+
+// Get gets a record set in the DNS zone.
+func (c *Client) Get(ctx context.Context, zoneID string, recordType privatedns.RecordType, relativeRecordSetName string) (privatedns.RecordSet, *retry.Error) {
+	armClient, resourceGroup, subscriptionID := c.getARMClient(zoneID)
+	mc := metrics.NewMetricContext("dns_record_sets", "get", resourceGroup, subscriptionID, "")
+
+	// Report errors if the client is rate limited.
+	if !c.rateLimiterReader.TryAccept() {
+		mc.RateLimitedCount()
+		return privatedns.RecordSet{}, retry.GetRateLimitError(false, "DNSRecordSetGet")
+	}
+
+	// Report errors if the client is throttled.
+	if c.RetryAfterReader.After(time.Now()) {
+		mc.ThrottledCount()
+		rerr := retry.GetThrottlingError("DNSRecordSetGet", "client throttled", c.RetryAfterReader)
+		return privatedns.RecordSet{}, rerr
+	}
+
+	result, rerr := c.getRecordSet(ctx, armClient, getRecordSetID(zoneID, recordType, relativeRecordSetName))
+	mc.Observe(rerr)
+	if rerr != nil {
+		if rerr.IsThrottled() {
+			// Update RetryAfterReader so that no more requests would be sent until RetryAfter expires.
+			c.RetryAfterReader = rerr.RetryAfter
+		}
+
+		return result, rerr
+	}
+
+	return result, nil
+}
+
+// getRecordSet gets a record set by its resource ID.
+func (c *Client) getRecordSet(ctx context.Context, armClient armclient.Interface, resourceID string) (privatedns.RecordSet, *retry.Error) {
+	result := privatedns.RecordSet{}
+
+	response, rerr := armClient.GetResource(ctx, resourceID)
+	defer armClient.CloseResponse(ctx, response)
+	if rerr != nil {
+		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "dnsrecordset.get.request", resourceID, rerr.Error())
+		return result, rerr
+	}
+
+	// The properties of the public record sets differ from the private ones only in case, e.g. "ARecords" and
+	// "aRecords", so both are unmarshalled into the private record set.
+	err := autorest.Respond(
+		response,
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&result))
+	if err != nil {
+		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "dnsrecordset.get.respond", resourceID, err)
+		return result, retry.GetError(response, err)
+	}
+
+	result.Response = autorest.Response{Response: response}
+	return result, nil
+}
+
+// CreateOrUpdate creates or updates a record set in the DNS zone.
+func (c *Client) CreateOrUpdate(ctx context.Context, zoneID string, recordType privatedns.RecordType, relativeRecordSetName string, parameters privatedns.RecordSet, etag string) *retry.Error {
+	armClient, resourceGroup, subscriptionID := c.getARMClient(zoneID)
+	mc := metrics.NewMetricContext("dns_record_sets", "create_or_update", resourceGroup, subscriptionID, "")
+
+	// Report errors if the client is rate limited.
+	if !c.rateLimiterWriter.TryAccept() {
+		mc.RateLimitedCount()
+		return retry.GetRateLimitError(true, "DNSRecordSetCreateOrUpdate")
+	}
+
+	// Report errors if the client is throttled.
+	if c.RetryAfterWriter.After(time.Now()) {
+		mc.ThrottledCount()
+		rerr := retry.GetThrottlingError("DNSRecordSetCreateOrUpdate", "client throttled", c.RetryAfterWriter)
+		return rerr
+	}
+
+	rerr := c.createOrUpdateRecordSet(ctx, armClient, getRecordSetID(zoneID, recordType, relativeRecordSetName), parameters, etag)
+	mc.Observe(rerr)
+	if rerr != nil {
+		if rerr.IsThrottled() {
+			// Update RetryAfterReader so that no more requests would be sent until RetryAfter expires.
+			c.RetryAfterWriter = rerr.RetryAfter
+		}
+
+		return rerr
+	}
+
+	return nil
+}
+
+// createOrUpdateRecordSet creates or updates a record set by its resource ID.
+func (c *Client) createOrUpdateRecordSet(ctx context.Context, armClient armclient.Interface, resourceID string, parameters privatedns.RecordSet, etag string) *retry.Error {
+	decorators := []autorest.PrepareDecorator{}
+	if etag != "" {
+		decorators = append(decorators, autorest.WithHeader("If-Match", autorest.String(etag)))
+	}
+
+	response, rerr := armClient.PutResource(ctx, resourceID, parameters, decorators...)
+	defer armClient.CloseResponse(ctx, response)
+	if rerr != nil {
+		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "dnsrecordset.put.request", resourceID, rerr.Error())
+		return rerr
+	}
+
+	if response != nil && response.StatusCode != http.StatusNoContent {
+		_, rerr = c.createOrUpdateResponder(response)
+		if rerr != nil {
+			klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "dnsrecordset.put.respond", resourceID, rerr.Error())
+			return rerr
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) createOrUpdateResponder(resp *http.Response) (*privatedns.RecordSet, *retry.Error) {
+	result := &privatedns.RecordSet{}
+	err := autorest.Respond(
+		resp,
+		azure.WithErrorUnlessStatusCode(http.StatusOK, http.StatusCreated),
+		autorest.ByUnmarshallingJSON(&result))
+	result.Response = autorest.Response{Response: resp}
+	return result, retry.GetError(resp, err)
+}
+
+// Delete deletes a record set in the DNS zone.
+func (c *Client) Delete(ctx context.Context, zoneID string, recordType privatedns.RecordType, relativeRecordSetName string) *retry.Error {
+	armClient, resourceGroup, subscriptionID := c.getARMClient(zoneID)
+	mc := metrics.NewMetricContext("dns_record_sets", "delete", resourceGroup, subscriptionID, "")
+
+	// Report errors if the client is rate limited.
+	if !c.rateLimiterWriter.TryAccept() {
+		mc.RateLimitedCount()
+		return retry.GetRateLimitError(true, "DNSRecordSetDelete")
+	}
+
+	// Report errors if the client is throttled.
+	if c.RetryAfterWriter.After(time.Now()) {
+		mc.ThrottledCount()
+		rerr := retry.GetThrottlingError("DNSRecordSetDelete", "client throttled", c.RetryAfterWriter)
+		return rerr
+	}
+
+	rerr := armClient.DeleteResource(ctx, getRecordSetID(zoneID, recordType, relativeRecordSetName))
+	mc.Observe(rerr)
+	if rerr != nil {
+		if rerr.IsThrottled() {
+			// Update RetryAfterReader so that no more requests would be sent until RetryAfter expires.
+			c.RetryAfterWriter = rerr.RetryAfter
+		}
+
+		return rerr
+	}
+
+	return nil
+}
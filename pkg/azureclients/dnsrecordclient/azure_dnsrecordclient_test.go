@@ -0,0 +1,235 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dnsrecordclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/privatedns/mgmt/2018-09-01/privatedns"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/utils/pointer"
+
+	azclients "sigs.k8s.io/cloud-provider-azure/pkg/azureclients"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/armclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/armclient/mockarmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const (
+	testPublicZoneID  = "/subscriptions/subscriptionID/resourceGroups/dns-rg/providers/Microsoft.Network/dnszones/contoso.com"
+	testPrivateZoneID = "/subscriptions/subscriptionID/resourceGroups/dns-rg/providers/Microsoft.Network/privateDnsZones/contoso.internal"
+)
+
+// 2065-01-24 05:20:00 +0000 UTC
+func getFutureTime() time.Time {
+	return time.Unix(3000000000, 0)
+}
+
+func TestNew(t *testing.T) {
+	config := &azclients.ClientConfig{
+		SubscriptionID:          "sub",
+		ResourceManagerEndpoint: "endpoint",
+		Location:                "eastus",
+		RateLimitConfig: &azclients.RateLimitConfig{
+			CloudProviderRateLimit:            true,
+			CloudProviderRateLimitQPS:         0.5,
+			CloudProviderRateLimitBucket:      1,
+			CloudProviderRateLimitQPSWrite:    0.5,
+			CloudProviderRateLimitBucketWrite: 1,
+		},
+		Backoff: &retry.Backoff{Steps: 1},
+	}
+
+	client := New(config)
+	assert.Equal(t, "sub", client.subscriptionID)
+	assert.NotEmpty(t, client.rateLimiterReader)
+	assert.NotEmpty(t, client.rateLimiterWriter)
+	assert.NotEqual(t, client.armClient, client.privateDNSArmClient)
+}
+
+func TestIsPrivateDNSZone(t *testing.T) {
+	assert.True(t, IsPrivateDNSZone(testPrivateZoneID))
+	assert.False(t, IsPrivateDNSZone(testPublicZoneID))
+}
+
+func TestGet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"properties":{"TTL":300,"ARecords":[{"ipv4Address":"1.2.3.4"}]}}`))),
+	}
+
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().GetResource(gomock.Any(), testPublicZoneID+"/A/www").Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	client := getTestDNSRecordClient(armClient, mockarmclient.NewMockInterface(ctrl))
+	result, rerr := client.Get(context.TODO(), testPublicZoneID, privatedns.A, "www")
+	assert.Nil(t, rerr)
+	assert.Equal(t, int64(300), pointer.Int64Deref(result.TTL, 0))
+	assert.Equal(t, "1.2.3.4", pointer.StringDeref((*result.ARecords)[0].Ipv4Address, ""))
+}
+
+func TestGetPrivateDNSZoneNotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	response := &http.Response{
+		StatusCode: http.StatusNotFound,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte("{}"))),
+	}
+	privateDNSArmClient := mockarmclient.NewMockInterface(ctrl)
+	privateDNSArmClient.EXPECT().GetResource(gomock.Any(), testPrivateZoneID+"/TXT/www").Return(response, nil).Times(1)
+	privateDNSArmClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	client := getTestDNSRecordClient(mockarmclient.NewMockInterface(ctrl), privateDNSArmClient)
+	expected := privatedns.RecordSet{Response: autorest.Response{}}
+	result, rerr := client.Get(context.TODO(), testPrivateZoneID, privatedns.TXT, "www")
+	assert.Equal(t, expected, result)
+	assert.NotNil(t, rerr)
+	assert.Equal(t, http.StatusNotFound, rerr.HTTPStatusCode)
+}
+
+func TestGetNeverRateLimiter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	getErr := &retry.Error{
+		RawError:  fmt.Errorf("azure cloud provider rate limited(%s) for operation %q", "read", "DNSRecordSetGet"),
+		Retriable: true,
+	}
+
+	client := getTestDNSRecordClientWithNeverRateLimiter(mockarmclient.NewMockInterface(ctrl))
+	result, rerr := client.Get(context.TODO(), testPublicZoneID, privatedns.A, "www")
+	assert.Equal(t, privatedns.RecordSet{}, result)
+	assert.Equal(t, getErr, rerr)
+}
+
+func TestCreateOrUpdate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	recordSet := privatedns.RecordSet{
+		RecordSetProperties: &privatedns.RecordSetProperties{
+			TTL:      pointer.Int64(300),
+			ARecords: &[]privatedns.ARecord{{Ipv4Address: pointer.String("1.2.3.4")}},
+		},
+	}
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(""))),
+	}
+	privateDNSArmClient := mockarmclient.NewMockInterface(ctrl)
+	privateDNSArmClient.EXPECT().PutResource(gomock.Any(), testPrivateZoneID+"/A/www", recordSet, gomock.Any()).Return(response, nil).Times(1)
+	privateDNSArmClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	client := getTestDNSRecordClient(mockarmclient.NewMockInterface(ctrl), privateDNSArmClient)
+	rerr := client.CreateOrUpdate(context.TODO(), testPrivateZoneID, privatedns.A, "www", recordSet, "etag")
+	assert.Nil(t, rerr)
+}
+
+func TestCreateOrUpdateRetryAfterReader(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	putErr := &retry.Error{
+		RawError:   fmt.Errorf("azure cloud provider throttled for operation %s with reason %q", "DNSRecordSetCreateOrUpdate", "client throttled"),
+		Retriable:  true,
+		RetryAfter: getFutureTime(),
+	}
+
+	client := getTestDNSRecordClientWithRetryAfterReader(mockarmclient.NewMockInterface(ctrl))
+	rerr := client.CreateOrUpdate(context.TODO(), testPublicZoneID, privatedns.A, "www", privatedns.RecordSet{}, "")
+	assert.Equal(t, putErr, rerr)
+}
+
+func TestDelete(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().DeleteResource(gomock.Any(), testPublicZoneID+"/AAAA/www").Return(nil).Times(1)
+
+	client := getTestDNSRecordClient(armClient, mockarmclient.NewMockInterface(ctrl))
+	rerr := client.Delete(context.TODO(), testPublicZoneID, privatedns.AAAA, "www")
+	assert.Nil(t, rerr)
+}
+
+func TestDeleteThrottle(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	throttleErr := &retry.Error{
+		HTTPStatusCode: http.StatusTooManyRequests,
+		RawError:       fmt.Errorf("error"),
+		Retriable:      true,
+		RetryAfter:     time.Unix(100, 0),
+	}
+
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	armClient.EXPECT().DeleteResource(gomock.Any(), testPublicZoneID+"/A/www").Return(throttleErr).Times(1)
+
+	client := getTestDNSRecordClient(armClient, mockarmclient.NewMockInterface(ctrl))
+	rerr := client.Delete(context.TODO(), testPublicZoneID, privatedns.A, "www")
+	assert.Equal(t, throttleErr, rerr)
+	assert.Equal(t, time.Unix(100, 0), client.RetryAfterWriter)
+}
+
+func getTestDNSRecordClient(armClient, privateDNSArmClient armclient.Interface) *Client {
+	rateLimiterReader, rateLimiterWriter := azclients.NewRateLimiter(&azclients.RateLimitConfig{})
+	return &Client{
+		armClient:           armClient,
+		privateDNSArmClient: privateDNSArmClient,
+		subscriptionID:      "subscriptionID",
+		rateLimiterReader:   rateLimiterReader,
+		rateLimiterWriter:   rateLimiterWriter,
+	}
+}
+
+func getTestDNSRecordClientWithNeverRateLimiter(armClient armclient.Interface) *Client {
+	return &Client{
+		armClient:           armClient,
+		privateDNSArmClient: armClient,
+		subscriptionID:      "subscriptionID",
+		rateLimiterReader:   flowcontrol.NewFakeNeverRateLimiter(),
+		rateLimiterWriter:   flowcontrol.NewFakeNeverRateLimiter(),
+	}
+}
+
+func getTestDNSRecordClientWithRetryAfterReader(armClient armclient.Interface) *Client {
+	return &Client{
+		armClient:           armClient,
+		privateDNSArmClient: armClient,
+		subscriptionID:      "subscriptionID",
+		rateLimiterReader:   flowcontrol.NewFakeAlwaysRateLimiter(),
+		rateLimiterWriter:   flowcontrol.NewFakeAlwaysRateLimiter(),
+		RetryAfterReader:    getFutureTime(),
+		RetryAfterWriter:    getFutureTime(),
+	}
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dnsrecordclient
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/services/privatedns/mgmt/2018-09-01/privatedns"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const (
+	// APIVersion is the API version for the public DNS zones.
+	APIVersion = "2018-05-01"
+	// PrivateDNSAPIVersion is the API version for the private DNS zones.
+	PrivateDNSAPIVersion = "2018-09-01"
+)
+
+// Interface is the client interface for the record sets of the public and private DNS zones. The record sets
+// are addressed by the resource ID of the zone, which can be in any resource group or subscription.
+// Don't forget to run "hack/update-mock-clients.sh" command to generate the mock client.
+type Interface interface {
+	// Get gets a record set in the DNS zone.
+	Get(ctx context.Context, zoneID string, recordType privatedns.RecordType, relativeRecordSetName string) (result privatedns.RecordSet, rerr *retry.Error)
+
+	// CreateOrUpdate creates or updates a record set in the DNS zone.
+	CreateOrUpdate(ctx context.Context, zoneID string, recordType privatedns.RecordType, relativeRecordSetName string, parameters privatedns.RecordSet, etag string) *retry.Error
+
+	// Delete deletes a record set in the DNS zone.
+	Delete(ctx context.Context, zoneID string, recordType privatedns.RecordType, relativeRecordSetName string) *retry.Error
+}
@@ -369,6 +369,78 @@ func (c *Client) deletePEConn(ctx context.Context, resourceGroupName string, pri
 	return c.armClient.DeleteResource(ctx, resourceID)
 }
 
+// UpdatePEConnection updates a private endpoint connection to the private link service by name.
+func (c *Client) UpdatePEConnection(ctx context.Context, resourceGroupName string, privateLinkServiceName string, privateEndpointConnectionName string, privateEndpointConnection network.PrivateEndpointConnection, etag string) *retry.Error {
+	mc := metrics.NewMetricContext("private_endpoint_connection", "update", resourceGroupName, c.subscriptionID, "")
+
+	// Report errors if the client is rate limited.
+	if !c.rateLimiterWriter.TryAccept() {
+		mc.RateLimitedCount()
+		return retry.GetRateLimitError(true, "PEConnUpdate")
+	}
+
+	// Report errors if the client is throttled.
+	if c.RetryAfterWriter.After(time.Now()) {
+		mc.ThrottledCount()
+		rerr := retry.GetThrottlingError("PEConnUpdate", "client throttled", c.RetryAfterWriter)
+		return rerr
+	}
+
+	rerr := c.updatePEConn(ctx, resourceGroupName, privateLinkServiceName, privateEndpointConnectionName, privateEndpointConnection, etag)
+	mc.Observe(rerr)
+	if rerr != nil {
+		if rerr.IsThrottled() {
+			// Update RetryAfterReader so that no more requests would be sent until RetryAfter expires.
+			c.RetryAfterWriter = rerr.RetryAfter
+		}
+
+		return rerr
+	}
+
+	return nil
+}
+
+// updatePEConn updates a private endpoint connection by name.
+func (c *Client) updatePEConn(ctx context.Context, resourceGroupName string, privateLinkServiceName string, privateEndpointConnectionName string, parameters network.PrivateEndpointConnection, etag string) *retry.Error {
+	resourceID := armclient.GetChildResourceID(
+		c.subscriptionID,
+		resourceGroupName,
+		PLSResourceType,
+		privateLinkServiceName,
+		PEConnResourceType,
+		privateEndpointConnectionName,
+	)
+	decorators := []autorest.PrepareDecorator{}
+	if etag != "" {
+		decorators = append(decorators, autorest.WithHeader("If-Match", autorest.String(etag)))
+	}
+
+	response, rerr := c.armClient.PutResource(ctx, resourceID, parameters, decorators...)
+	defer c.armClient.CloseResponse(ctx, response)
+	if rerr != nil {
+		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "privateendpointconnection.put.request", resourceID, rerr.Error())
+		return rerr
+	}
+
+	if response != nil && response.StatusCode != http.StatusNoContent {
+		rerr = c.updatePEConnResponder(response)
+		if rerr != nil {
+			klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "privateendpointconnection.put.respond", resourceID, rerr.Error())
+			return rerr
+		}
+	}
+	return nil
+}
+
+func (c *Client) updatePEConnResponder(resp *http.Response) *retry.Error {
+	result := &network.PrivateEndpointConnection{}
+	err := autorest.Respond(
+		resp,
+		azure.WithErrorUnlessStatusCode(http.StatusOK, http.StatusCreated),
+		autorest.ByUnmarshallingJSON(&result))
+	return retry.GetError(resp, err)
+}
+
 func (c *Client) listResponder(resp *http.Response) (result network.PrivateLinkServiceListResult, err error) {
 	err = autorest.Respond(
 		resp,
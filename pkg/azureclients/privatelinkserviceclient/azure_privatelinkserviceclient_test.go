@@ -342,6 +342,42 @@ func TestDeletePEConnection(t *testing.T) {
 	}
 }
 
+func TestUpdatePEConnection(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tests := []struct {
+		description  string
+		armClientErr *retry.Error
+		expectedErr  *retry.Error
+	}{
+		{
+			description:  "UpdatePEConnection should report the throttling error",
+			armClientErr: &retry.Error{HTTPStatusCode: http.StatusTooManyRequests},
+			expectedErr:  &retry.Error{HTTPStatusCode: http.StatusTooManyRequests},
+		},
+		{
+			description: "UpdatePEConnection should not report any error if there's no error from arm client",
+		},
+	}
+
+	peConn := getTestPrivateEndpointConnection("pls1", "peconn")
+
+	for _, test := range tests {
+		armClient := mockarmclient.NewMockInterface(ctrl)
+		response := &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(""))),
+		}
+		armClient.EXPECT().PutResource(gomock.Any(), pointer.StringDeref(peConn.ID, ""), peConn, gomock.Any()).Return(response, test.armClientErr)
+		armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any())
+
+		plsClient := getTestPrivateLinkServiceClient(armClient)
+		rerr := plsClient.UpdatePEConnection(context.TODO(), "rg", "pls1", "peconn", peConn, "")
+		assert.Equal(t, test.expectedErr, rerr, test.description)
+	}
+}
+
 func getTestPrivateLinkService(name string) network.PrivateLinkService {
 	return network.PrivateLinkService{
 		ID:       pointer.String(fmt.Sprintf("/subscriptions/subscriptionID/resourceGroups/rg/providers/%s/%s", PLSResourceType, name)),
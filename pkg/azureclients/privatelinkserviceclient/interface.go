@@ -51,4 +51,7 @@ type Interface interface {
 
 	// Delete deletes a private endpoint connection to the private link service by name
 	DeletePEConnection(ctx context.Context, resourceGroupName string, privateLinkServiceName string, privateEndpointConnectionName string) *retry.Error
+
+	// UpdatePEConnection updates a private endpoint connection to the private link service by name
+	UpdatePEConnection(ctx context.Context, resourceGroupName string, privateLinkServiceName string, privateEndpointConnectionName string, privateEndpointConnection network.PrivateEndpointConnection, etag string) *retry.Error
 }
@@ -124,3 +124,17 @@ func (mr *MockInterfaceMockRecorder) List(ctx, resourceGroupName interface{}) *g
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockInterface)(nil).List), ctx, resourceGroupName)
 }
+
+// UpdatePEConnection mocks base method.
+func (m *MockInterface) UpdatePEConnection(ctx context.Context, resourceGroupName, privateLinkServiceName, privateEndpointConnectionName string, privateEndpointConnection network.PrivateEndpointConnection, etag string) *retry.Error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePEConnection", ctx, resourceGroupName, privateLinkServiceName, privateEndpointConnectionName, privateEndpointConnection, etag)
+	ret0, _ := ret[0].(*retry.Error)
+	return ret0
+}
+
+// UpdatePEConnection indicates an expected call of UpdatePEConnection.
+func (mr *MockInterfaceMockRecorder) UpdatePEConnection(ctx, resourceGroupName, privateLinkServiceName, privateEndpointConnectionName, privateEndpointConnection, etag interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePEConnection", reflect.TypeOf((*MockInterface)(nil).UpdatePEConnection), ctx, resourceGroupName, privateLinkServiceName, privateEndpointConnectionName, privateEndpointConnection, etag)
+}
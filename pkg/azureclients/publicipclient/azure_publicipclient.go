@@ -292,7 +292,7 @@ func (c *Client) listPublicIPAddress(ctx context.Context, resourceGroupName stri
 }
 
 // CreateOrUpdate creates or updates a PublicIPAddress.
-func (c *Client) CreateOrUpdate(ctx context.Context, resourceGroupName string, publicIPAddressName string, parameters network.PublicIPAddress) *retry.Error {
+func (c *Client) CreateOrUpdate(ctx context.Context, resourceGroupName string, publicIPAddressName string, parameters network.PublicIPAddress, etag string) *retry.Error {
 	mc := metrics.NewMetricContext("public_ip_addresses", "create_or_update", resourceGroupName, c.subscriptionID, "")
 
 	// Report errors if the client is rate limited.
@@ -308,7 +308,7 @@ func (c *Client) CreateOrUpdate(ctx context.Context, resourceGroupName string, p
 		return rerr
 	}
 
-	rerr := c.createOrUpdatePublicIP(ctx, resourceGroupName, publicIPAddressName, parameters)
+	rerr := c.createOrUpdatePublicIP(ctx, resourceGroupName, publicIPAddressName, parameters, etag)
 	mc.Observe(rerr)
 	if rerr != nil {
 		if rerr.IsThrottled() {
@@ -323,7 +323,7 @@ func (c *Client) CreateOrUpdate(ctx context.Context, resourceGroupName string, p
 }
 
 // createOrUpdatePublicIP creates or updates a PublicIPAddress.
-func (c *Client) createOrUpdatePublicIP(ctx context.Context, resourceGroupName string, publicIPAddressName string, parameters network.PublicIPAddress) *retry.Error {
+func (c *Client) createOrUpdatePublicIP(ctx context.Context, resourceGroupName string, publicIPAddressName string, parameters network.PublicIPAddress, etag string) *retry.Error {
 	resourceID := armclient.GetResourceID(
 		c.subscriptionID,
 		resourceGroupName,
@@ -331,7 +331,12 @@ func (c *Client) createOrUpdatePublicIP(ctx context.Context, resourceGroupName s
 		publicIPAddressName,
 	)
 
-	response, rerr := c.armClient.PutResource(ctx, resourceID, parameters)
+	decorators := []autorest.PrepareDecorator{}
+	if etag != "" {
+		decorators = append(decorators, autorest.WithHeader("If-Match", autorest.String(etag)))
+	}
+
+	response, rerr := c.armClient.PutResource(ctx, resourceID, parameters, decorators...)
 	defer c.armClient.CloseResponse(ctx, response)
 	if rerr != nil {
 		klog.V(5).Infof("Received error in %s: resourceID: %s, error: %s", "publicip.put.request", resourceID, rerr.Error())
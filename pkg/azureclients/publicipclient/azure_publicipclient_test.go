@@ -620,7 +620,25 @@ func TestCreateOrUpdate(t *testing.T) {
 	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
 
 	pipClient := getTestPublicIPAddressClient(armClient)
-	rerr := pipClient.CreateOrUpdate(context.TODO(), "rg", "pip1", pip)
+	rerr := pipClient.CreateOrUpdate(context.TODO(), "rg", "pip1", pip, "")
+	assert.Nil(t, rerr)
+}
+
+func TestCreateOrUpdateWithETag(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pip := getTestPublicIPAddress("pip1")
+	armClient := mockarmclient.NewMockInterface(ctrl)
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(""))),
+	}
+	armClient.EXPECT().PutResource(gomock.Any(), pointer.StringDeref(pip.ID, ""), pip, gomock.Any()).Return(response, nil).Times(1)
+	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
+
+	pipClient := getTestPublicIPAddressClient(armClient)
+	rerr := pipClient.CreateOrUpdate(context.TODO(), "rg", "pip1", pip, "etag")
 	assert.Nil(t, rerr)
 }
 
@@ -637,7 +655,7 @@ func TestCreateOrUpdateWithCreateOrUpdateResponderError(t *testing.T) {
 	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
 
 	pipClient := getTestPublicIPAddressClient(armClient)
-	rerr := pipClient.CreateOrUpdate(context.TODO(), "rg", "pip1", pip)
+	rerr := pipClient.CreateOrUpdate(context.TODO(), "rg", "pip1", pip, "")
 	assert.NotNil(t, rerr)
 }
 
@@ -650,7 +668,7 @@ func TestCreateOrUpdateNeverRateLimiter(t *testing.T) {
 	armClient := mockarmclient.NewMockInterface(ctrl)
 	pipClient := getTestPublicIPAddressClientWithNeverRateLimiter(armClient)
 	pip := getTestPublicIPAddress("pip1")
-	rerr := pipClient.CreateOrUpdate(context.TODO(), "rg", "pip1", pip)
+	rerr := pipClient.CreateOrUpdate(context.TODO(), "rg", "pip1", pip, "")
 	assert.NotNil(t, rerr)
 	assert.Equal(t, pipCreateOrUpdateErr, rerr)
 }
@@ -664,7 +682,7 @@ func TestCreateOrUpdateRetryAfterReader(t *testing.T) {
 	pip := getTestPublicIPAddress("pip1")
 	armClient := mockarmclient.NewMockInterface(ctrl)
 	pipClient := getTestPublicIPAddressClientWithRetryAfterReader(armClient)
-	rerr := pipClient.CreateOrUpdate(context.TODO(), "rg", "pip1", pip)
+	rerr := pipClient.CreateOrUpdate(context.TODO(), "rg", "pip1", pip, "")
 	assert.NotNil(t, rerr)
 	assert.Equal(t, pipCreateOrUpdateErr, rerr)
 }
@@ -690,7 +708,7 @@ func TestCreateOrUpdateThrottle(t *testing.T) {
 	armClient.EXPECT().CloseResponse(gomock.Any(), gomock.Any()).Times(1)
 
 	pipClient := getTestPublicIPAddressClient(armClient)
-	rerr := pipClient.CreateOrUpdate(context.TODO(), "rg", "pip1", pip)
+	rerr := pipClient.CreateOrUpdate(context.TODO(), "rg", "pip1", pip, "")
 	assert.NotNil(t, rerr)
 	assert.Equal(t, throttleErr, rerr)
 }
@@ -55,7 +55,7 @@ type Interface interface {
 	ListAll(ctx context.Context) (result []network.PublicIPAddress, rerr *retry.Error)
 
 	// CreateOrUpdate creates or updates a PublicIPAddress.
-	CreateOrUpdate(ctx context.Context, resourceGroupName string, publicIPAddressName string, parameters network.PublicIPAddress) *retry.Error
+	CreateOrUpdate(ctx context.Context, resourceGroupName string, publicIPAddressName string, parameters network.PublicIPAddress, etag string) *retry.Error
 
 	// Delete deletes a PublicIPAddress by name.
 	Delete(ctx context.Context, resourceGroupName string, publicIPAddressName string) *retry.Error
@@ -76,4 +76,10 @@ type Interface interface {
 
 	// WaitForStartInstancesResult waits for the response of the start instances request
 	WaitForStartInstancesResult(ctx context.Context, future *azure.Future, resourceGroupName string) (*http.Response, error)
+
+	// ReimageInstancesAsync sends the reimage request to the ARM client and DOES NOT wait on the future
+	ReimageInstancesAsync(ctx context.Context, resourceGroupName string, vmScaleSetName string, vmInstanceIDs compute.VirtualMachineScaleSetVMInstanceRequiredIDs) (*azure.Future, *retry.Error)
+
+	// RedeployInstancesAsync sends the redeploy request to the ARM client and DOES NOT wait on the future
+	RedeployInstancesAsync(ctx context.Context, resourceGroupName string, vmScaleSetName string, vmInstanceIDs compute.VirtualMachineScaleSetVMInstanceRequiredIDs) (*azure.Future, *retry.Error)
 }
@@ -158,6 +158,36 @@ func (mr *MockInterfaceMockRecorder) List(ctx, resourceGroupName interface{}) *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockInterface)(nil).List), ctx, resourceGroupName)
 }
 
+// RedeployInstancesAsync mocks base method.
+func (m *MockInterface) RedeployInstancesAsync(ctx context.Context, resourceGroupName, vmScaleSetName string, vmInstanceIDs compute.VirtualMachineScaleSetVMInstanceRequiredIDs) (*azure.Future, *retry.Error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RedeployInstancesAsync", ctx, resourceGroupName, vmScaleSetName, vmInstanceIDs)
+	ret0, _ := ret[0].(*azure.Future)
+	ret1, _ := ret[1].(*retry.Error)
+	return ret0, ret1
+}
+
+// RedeployInstancesAsync indicates an expected call of RedeployInstancesAsync.
+func (mr *MockInterfaceMockRecorder) RedeployInstancesAsync(ctx, resourceGroupName, vmScaleSetName, vmInstanceIDs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RedeployInstancesAsync", reflect.TypeOf((*MockInterface)(nil).RedeployInstancesAsync), ctx, resourceGroupName, vmScaleSetName, vmInstanceIDs)
+}
+
+// ReimageInstancesAsync mocks base method.
+func (m *MockInterface) ReimageInstancesAsync(ctx context.Context, resourceGroupName, vmScaleSetName string, vmInstanceIDs compute.VirtualMachineScaleSetVMInstanceRequiredIDs) (*azure.Future, *retry.Error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReimageInstancesAsync", ctx, resourceGroupName, vmScaleSetName, vmInstanceIDs)
+	ret0, _ := ret[0].(*azure.Future)
+	ret1, _ := ret[1].(*retry.Error)
+	return ret0, ret1
+}
+
+// ReimageInstancesAsync indicates an expected call of ReimageInstancesAsync.
+func (mr *MockInterfaceMockRecorder) ReimageInstancesAsync(ctx, resourceGroupName, vmScaleSetName, vmInstanceIDs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReimageInstancesAsync", reflect.TypeOf((*MockInterface)(nil).ReimageInstancesAsync), ctx, resourceGroupName, vmScaleSetName, vmInstanceIDs)
+}
+
 // StartInstancesAsync mocks base method.
 func (m *MockInterface) StartInstancesAsync(ctx context.Context, resourceGroupName, vmScaleSetName string, vmInstanceIDs compute.VirtualMachineScaleSetVMInstanceRequiredIDs) (*azure.Future, *retry.Error) {
 	m.ctrl.T.Helper()
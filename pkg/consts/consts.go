@@ -30,6 +30,8 @@ const (
 	VMTypeStandard = "standard"
 	// VMTypeVmssFlex is the vmssflex vm type
 	VMTypeVmssFlex = "vmssflex"
+	// VMTypeMixed is the vm type of the clusters mixing VMSS Uniform, VMSS Flex and availability set nodes
+	VMTypeMixed = "mixed"
 
 	// ExternalResourceGroupLabel is the label representing the node is in a different
 	// resource group from other cloud provider components
@@ -38,6 +40,9 @@ const (
 	ManagedByAzureLabel = "kubernetes.azure.com/managed"
 	// NotManagedByAzureLabelValue is the label value representing the node is not managed by cloud provider azure
 	NotManagedByAzureLabelValue = "false"
+	// LabelVMSetType is the label key of the node pool type of the node with the mixed vm type, the value is
+	// one of vmss, vmssflex and standard
+	LabelVMSetType = "kubernetes.azure.com/vmset-type"
 
 	// LabelFailureDomainBetaZone refer to https://github.com/kubernetes/api/blob/8519c5ea46199d57724725d5b969c5e8e0533692/core/v1/well_known_labels.go#L22-L23
 	LabelFailureDomainBetaZone = "failure-domain.beta.kubernetes.io/zone"
@@ -45,6 +50,40 @@ const (
 	LabelFailureDomainBetaRegion = "failure-domain.beta.kubernetes.io/region"
 	// LabelPlatformSubFaultDomain is the label key of platformSubFaultDomain
 	LabelPlatformSubFaultDomain = "topology.kubernetes.azure.com/sub-fault-domain"
+	// LabelScaleSetPriority is the label key of the priority of the VM, e.g. spot
+	LabelScaleSetPriority = "kubernetes.azure.com/scalesetpriority"
+	// LabelHostGroup is the label key of the dedicated host group of the VM
+	LabelHostGroup = "kubernetes.azure.com/host-group"
+	// LabelDedicatedHost is the label key of the dedicated host of the VM
+	LabelDedicatedHost = "kubernetes.azure.com/dedicated-host"
+	// LabelProximityPlacementGroup is the label key of the proximity placement group of the VM
+	LabelProximityPlacementGroup = "kubernetes.azure.com/proximity-placement-group"
+	// LabelAcceleratedNetworking is the label key indicating whether accelerated networking is enabled on the primary NIC
+	LabelAcceleratedNetworking = "kubernetes.azure.com/accelerated-networking"
+	// LabelEphemeralOSDisk is the label key indicating whether the VM runs on an ephemeral OS disk
+	LabelEphemeralOSDisk = "kubernetes.azure.com/ephemeral-os-disk"
+
+	// ScheduledEventTaintKey is the taint key of the nodes impacted by a scheduled event, the value is the event type
+	ScheduledEventTaintKey = "kubernetes.azure.com/scheduled-event"
+	// ScheduledEventCordonedAnnotation marks the nodes cordoned by the cloud node manager for a scheduled event,
+	// which are uncordoned after the event
+	ScheduledEventCordonedAnnotation = "kubernetes.azure.com/scheduled-event-cordoned"
+	// NodeConditionScheduledEvent is the node condition type of the scheduled events
+	NodeConditionScheduledEvent = "AzureScheduledEvent"
+
+	// NodeConditionInstanceDegraded is the node condition type which is true if the VM is not running or failed
+	// to be provisioned, the reason is the instance state
+	NodeConditionInstanceDegraded = "AzureInstanceDegraded"
+	// InstanceStateRunning is the state of the running VM
+	InstanceStateRunning = "Running"
+	// InstanceStateStopped is the state of the stopped VM, which is still allocated
+	InstanceStateStopped = "Stopped"
+	// InstanceStateDeallocated is the state of the deallocated VM
+	InstanceStateDeallocated = "Deallocated"
+	// InstanceStateHibernated is the state of the hibernated VM
+	InstanceStateHibernated = "Hibernated"
+	// InstanceStateFailed is the state of the VM whose provisioning state is Failed, regardless of its power state
+	InstanceStateFailed = "Failed"
 
 	// ADFSIdentitySystem is the override value for tenantID on Azure Stack clouds.
 	ADFSIdentitySystem = "adfs"
@@ -251,6 +290,27 @@ const (
 	// Azure load balancer auto selection from the availability sets
 	ServiceAnnotationLoadBalancerAutoModeValue = "__auto__"
 
+	// ServiceAnnotationLoadBalancerProfiles is the annotation used on the service to pin it to the comma-separated
+	// load balancer profiles of the cluster. The service is placed on the one with the fewest rules. It is valid
+	// when the load balancer profiles are configured, in which case the mode annotation is ignored.
+	ServiceAnnotationLoadBalancerProfiles = "service.beta.kubernetes.io/azure-load-balancer-profiles"
+
+	// ServiceAnnotationLoadBalancerSkuMigrationState is set by the cloud provider to track the migration of the service
+	// from the basic load balancer to the standard one, so that it can be resumed after a restart.
+	ServiceAnnotationLoadBalancerSkuMigrationState = "service.beta.kubernetes.io/azure-load-balancer-sku-migration-state"
+	// ServiceAnnotationLoadBalancerSkuMigrationSnapshot is set by the cloud provider to record the frontend IP configuration
+	// and the load balancing rules of the service on the basic load balancer before they are removed.
+	ServiceAnnotationLoadBalancerSkuMigrationSnapshot = "service.beta.kubernetes.io/azure-load-balancer-sku-migration-snapshot"
+
+	// LoadBalancerSkuMigrationStateSnapshotted means the basic load balancer resources of the service are recorded.
+	LoadBalancerSkuMigrationStateSnapshotted = "Snapshotted"
+	// LoadBalancerSkuMigrationStateDetached means the service is removed from the basic load balancer.
+	LoadBalancerSkuMigrationStateDetached = "Detached"
+	// LoadBalancerSkuMigrationStatePublicIPUpgraded means the public IP of the service is upgraded to the standard SKU.
+	LoadBalancerSkuMigrationStatePublicIPUpgraded = "PublicIPUpgraded"
+	// LoadBalancerSkuMigrationStateCompleted means the service is reconciled on the standard load balancer.
+	LoadBalancerSkuMigrationStateCompleted = "Completed"
+
 	// ServiceAnnotationDNSLabelName is the annotation used on the service
 	// to specify the DNS label name for the service.
 	ServiceAnnotationDNSLabelName = "service.beta.kubernetes.io/azure-dns-label-name"
@@ -275,6 +335,44 @@ const (
 	// ServiceAnnotationIPTagsForPublicIP specifies the iptags used when dynamically creating a public ip
 	ServiceAnnotationIPTagsForPublicIP = "service.beta.kubernetes.io/azure-pip-ip-tags"
 
+	// ServiceAnnotationPIPZones specifies the comma separated availability zones of the public IP
+	// created for the service. An empty value creates a public IP without zones.
+	ServiceAnnotationPIPZones = "service.beta.kubernetes.io/azure-pip-zones"
+
+	// ServiceAnnotationPIPDdosProtectionPlanID specifies the resource ID of the DDoS protection plan attached to the public IP.
+	ServiceAnnotationPIPDdosProtectionPlanID = "service.beta.kubernetes.io/azure-pip-ddos-protection-plan-id"
+
+	// ServiceAnnotationPIPDdosProtectionMode specifies the DDoS protection mode of the public IP,
+	// which can be Enabled, Disabled or VirtualNetworkInherited.
+	ServiceAnnotationPIPDdosProtectionMode = "service.beta.kubernetes.io/azure-pip-ddos-protection-mode"
+
+	// ServiceAnnotationPIPRoutingPreference specifies the routing preference of the public IP,
+	// which can be Internet or MicrosoftNetwork. Changing it recreates the public IP.
+	ServiceAnnotationPIPRoutingPreference = "service.beta.kubernetes.io/azure-pip-routing-preference"
+
+	// ServiceAnnotationPIPTier specifies the tier of the public IP created for the service.
+	// Only Regional is supported, global public IPs are managed by the global load balancers.
+	ServiceAnnotationPIPTier = "service.beta.kubernetes.io/azure-pip-tier"
+
+	// ServiceAnnotationDNSZoneID is the resource ID of the Azure public or private DNS zone in which the A and AAAA
+	// records of the frontend IPs of the service are maintained.
+	ServiceAnnotationDNSZoneID = "service.beta.kubernetes.io/azure-dns-zone-id"
+
+	// ServiceAnnotationDNSRecordName is the relative name of the DNS records of the service in the DNS zone.
+	// Default to the name of the service.
+	ServiceAnnotationDNSRecordName = "service.beta.kubernetes.io/azure-dns-record-name"
+
+	// ServiceAnnotationDNSRecordTTL is the TTL in seconds of the DNS records of the service. Default to 300.
+	ServiceAnnotationDNSRecordTTL = "service.beta.kubernetes.io/azure-dns-record-ttl"
+
+	// ServiceAnnotationDNSOwnedRecord is set by the cloud provider to record the DNS records owned by the service,
+	// in the format of "<zone resource ID>/<record name>", so that they are deleted when the zone or the name changes.
+	ServiceAnnotationDNSOwnedRecord = "service.beta.kubernetes.io/azure-dns-owned-record"
+
+	// ServiceAnnotationPIPRetainOnDelete keeps the public IP when the service is deleted or stops using it.
+	// The service tags are removed so the IP can be reused by another service through azure-pip-name or loadBalancerIP.
+	ServiceAnnotationPIPRetainOnDelete = "service.beta.kubernetes.io/azure-pip-retain-on-delete"
+
 	// ServiceAnnotationAllowedServiceTag is the annotation used on the service
 	// to specify a list of allowed service tags separated by comma
 	// Refer https://docs.microsoft.com/en-us/azure/virtual-network/security-overview#service-tags for all supported service tags.
@@ -323,6 +421,71 @@ const (
 	// automatically on Azure LoadBalancer. Instead, they need to be configured manually (e.g. on Azure cross-region LoadBalancer by another operator).
 	ServiceAnnotationAdditionalPublicIPs = "service.beta.kubernetes.io/azure-additional-public-ips"
 
+	// ServiceAnnotationLoadBalancerDryRun runs the load balancer reconciliation of the service in plan mode.
+	// When set to `true`, the intended changes to the load balancer, security group, public IP and private link
+	// service are reported in a Kubernetes event instead of being written to Azure. If omitted, the default value is false.
+	ServiceAnnotationLoadBalancerDryRun = "service.beta.kubernetes.io/azure-load-balancer-dry-run"
+
+	// ServiceAnnotationLoadBalancerType determines the kind of Azure resource exposing the service.
+	// Set it to `appgw` to program an Application Gateway instead of the Azure load balancer. If omitted,
+	// the Azure load balancer is used.
+	ServiceAnnotationLoadBalancerType = "service.beta.kubernetes.io/azure-load-balancer-type"
+	// LoadBalancerTypeApplicationGateway is the value of ServiceAnnotationLoadBalancerType to use an Application Gateway.
+	LoadBalancerTypeApplicationGateway = "appgw"
+	// ServiceAnnotationApplicationGatewaySSLCertificateSecretID is the Key Vault secret ID of the certificate used to
+	// terminate TLS on the Application Gateway listeners of the service. If set, the listeners use HTTPS, otherwise HTTP.
+	ServiceAnnotationApplicationGatewaySSLCertificateSecretID = "service.beta.kubernetes.io/azure-application-gateway-ssl-certificate-secret-id"
+	// ServiceAnnotationApplicationGatewayFirewallPolicyID is the resource ID of the WAF policy associated with the
+	// Application Gateway listeners of the service.
+	ServiceAnnotationApplicationGatewayFirewallPolicyID = "service.beta.kubernetes.io/azure-application-gateway-waf-policy-id"
+
+	// ServiceAnnotationLoadBalancerZonalFrontends determines if the internal service gets one zonal frontend IP
+	// per availability zone of the region besides its zone-redundant frontend IP. The backend pool of each zonal
+	// frontend only contains the nodes in the same zone.
+	ServiceAnnotationLoadBalancerZonalFrontends = "service.beta.kubernetes.io/azure-load-balancer-zonal-frontends"
+
+	// ServiceAnnotationGlobalLoadBalancerName is the name of the cross-region (global tier) load balancer.
+	// If set, the public frontend of the service is registered into a backend pool of the global load balancer,
+	// which is created in the resource group `globalLoadBalancerResourceGroup` if it does not exist.
+	ServiceAnnotationGlobalLoadBalancerName = "service.beta.kubernetes.io/azure-global-load-balancer-name"
+	// ServiceAnnotationGlobalLoadBalancerBackendPoolName is the name of the backend pool of the global load balancer
+	// in which the frontend of the service is registered. The clusters exposing the same service should use the
+	// same backend pool. Default to "<namespace>-<name>" of the service.
+	ServiceAnnotationGlobalLoadBalancerBackendPoolName = "service.beta.kubernetes.io/azure-global-load-balancer-backend-pool-name"
+
+	// ServiceAnnotationGatewayLoadBalancerFrontendID is the resource ID of the frontend IP configuration of the gateway
+	// load balancer chained to the public frontend of the service, so that its traffic is inspected by the network
+	// virtual appliances behind the gateway load balancer. An empty value unchains the frontend even if
+	// `gatewayLoadBalancerFrontendID` is set in the cloud config.
+	ServiceAnnotationGatewayLoadBalancerFrontendID = "service.beta.kubernetes.io/azure-load-balancer-gateway-frontend-id"
+
+	// ServiceConditionLoadBalancerReady is the service condition type indicating whether the Azure load balancer
+	// of the service has been reconciled successfully.
+	ServiceConditionLoadBalancerReady = "AzureLoadBalancerReady"
+	// ServiceConditionPublicIPReady is the service condition type indicating whether the Azure public IP
+	// of the service has been reconciled successfully. It is only set for external services.
+	ServiceConditionPublicIPReady = "AzurePublicIPReady"
+	// ServiceConditionSecurityGroupReady is the service condition type indicating whether the security rules
+	// of the service have been reconciled successfully.
+	ServiceConditionSecurityGroupReady = "AzureNSGReady"
+	// ServiceConditionPrivateLinkServiceReady is the service condition type indicating whether the Azure private
+	// link service of the service has been reconciled successfully. It is only set for services requiring a private link service.
+	ServiceConditionPrivateLinkServiceReady = "AzurePLSReady"
+	// ServiceConditionApplicationGatewayReady is the service condition type indicating whether the Azure application
+	// gateway of the service has been reconciled successfully. It is only set for services using an application gateway.
+	ServiceConditionApplicationGatewayReady = "AzureApplicationGatewayReady"
+	// ServiceConditionGlobalLoadBalancerReady is the service condition type indicating whether the frontend of the
+	// service has been registered into the global load balancer. It is only set for services using a global load balancer.
+	ServiceConditionGlobalLoadBalancerReady = "AzureGlobalLoadBalancerReady"
+	// ServiceConditionDNSRecordReady is the service condition type indicating whether the DNS records of the
+	// service in the Azure DNS zone are reconciled.
+	ServiceConditionDNSRecordReady = "AzureDNSRecordReady"
+	// ServiceConditionReasonReconciled is the reason of a service condition whose resources have been reconciled.
+	ServiceConditionReasonReconciled = "Reconciled"
+	// ServiceConditionReasonReconcileFailed is the reason of a service condition whose resources failed to be
+	// reconciled without a known Azure error code.
+	ServiceConditionReasonReconcileFailed = "ReconcileFailed"
+
 	// ServiceTagKey is the service key applied for public IP tags.
 	ServiceTagKey       = "k8s-azure-service"
 	LegacyServiceTagKey = "service"
@@ -332,6 +495,25 @@ const (
 	// ServiceUsingDNSKey is the service name consuming the DNS label on the public IP
 	ServiceUsingDNSKey       = "k8s-azure-dns-label-service"
 	LegacyServiceUsingDNSKey = "kubernetes-dns-label-service"
+	// DNSOwnerRecordPrefix is the prefix of the TXT record recording the owner of the DNS records of a service.
+	DNSOwnerRecordPrefix = "k8s-azure-owner"
+	// DefaultDNSRecordTTL is the default TTL in seconds of the DNS records of a service.
+	DefaultDNSRecordTTL = 300
+
+	// OwnershipManifestTagKeyPrefix is the prefix of the tags recording the subresources created by the cloud
+	// provider in a load balancer or a security group. The manifest is split into "<prefix>0", "<prefix>1", ...
+	// since the length of a tag value is limited.
+	OwnershipManifestTagKeyPrefix = "k8s-azure-owned-"
+
+	// RetainedServiceTagKey is the name of the service which retained the public IP on deletion.
+	RetainedServiceTagKey = "k8s-azure-retained-service"
+
+	// IPTagTypeRoutingPreference is the IP tag type used to set the routing preference of the public IP.
+	IPTagTypeRoutingPreference = "RoutingPreference"
+	// RoutingPreferenceInternet routes the traffic through the ISP network.
+	RoutingPreferenceInternet = "Internet"
+	// RoutingPreferenceMicrosoftNetwork routes the traffic through the Microsoft global network.
+	RoutingPreferenceMicrosoftNetwork = "MicrosoftNetwork"
 
 	// DefaultLoadBalancerSourceRanges is the default value of the load balancer source ranges
 	DefaultLoadBalancerSourceRanges = "0.0.0.0/0"
@@ -343,6 +525,10 @@ const (
 	LoadBalancerMinimumPriority = 500
 	// LoadBalancerMaximumPriority is the maximum priority
 	LoadBalancerMaximumPriority = 4096
+	// SecurityGroupRuleLimit is the default maximum number of security rules in a security group
+	SecurityGroupRuleLimit = 1000
+	// ConsolidatedSecurityRulePrefix is the name prefix of the security rules consolidated across the services
+	ConsolidatedSecurityRulePrefix = "k8s-azure-consolidated-"
 
 	// FrontendIPConfigIDTemplate is the template of the frontend IP configuration
 	FrontendIPConfigIDTemplate = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers/%s/frontendIPConfigurations/%s"
@@ -350,9 +536,26 @@ const (
 	BackendPoolIDTemplate = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers/%s/backendAddressPools/%s"
 	// LoadBalancerProbeIDTemplate is the template of the load balancer probe
 	LoadBalancerProbeIDTemplate = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers/%s/probes/%s"
+	// PublicIPAddressIDTemplate is the template of the public IP address
+	PublicIPAddressIDTemplate = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/publicIPAddresses/%s"
+	// ApplicationGatewayIDTemplate is the template of the application gateway
+	ApplicationGatewayIDTemplate = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/applicationGateways/%s"
+	// ApplicationGatewayChildIDTemplate is the template of the child resources of the application gateway, e.g. listeners and probes
+	ApplicationGatewayChildIDTemplate = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/applicationGateways/%s/%s/%s"
+	// ApplicationSecurityGroupIDTemplate is the template of the application security group
+	ApplicationSecurityGroupIDTemplate = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/applicationSecurityGroups/%s"
+	// NatGatewayIDTemplate is the template of the NAT gateway
+	NatGatewayIDTemplate = "/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/natGateways/%s"
 
 	// InternalLoadBalancerNameSuffix is load balancer suffix
 	InternalLoadBalancerNameSuffix = "-internal"
+	// ApplicationSecurityGroupNameSuffix is the suffix of the application security group of the load balancer
+	ApplicationSecurityGroupNameSuffix = "-asg"
+	// OutboundResourceNameSuffix is the suffix of the outbound rule, and the prefix of the indexed outbound
+	// public IPs and frontend IP configurations, after the cluster name
+	OutboundResourceNameSuffix = "-outbound"
+	// NatGatewayNameSuffix is the suffix of the default NAT gateway name after the cluster name
+	NatGatewayNameSuffix = "-natgw"
 
 	// FrontendIPConfigNameMaxLength is the max length of the frontend IP configuration
 	FrontendIPConfigNameMaxLength = 80
@@ -414,6 +617,10 @@ const (
 	ImdsInstanceURI = "/metadata/instance"
 	// ImdsLoadBalancerURI is the imds load balancer uri
 	ImdsLoadBalancerURI = "/metadata/loadbalancer"
+	// ImdsScheduledEventsAPIVersion is the imds scheduled events api version
+	ImdsScheduledEventsAPIVersion = "2020-07-01"
+	// ImdsScheduledEventsURI is the imds scheduled events uri
+	ImdsScheduledEventsURI = "/metadata/scheduledevents"
 )
 
 // routes
@@ -472,6 +679,19 @@ const (
 	// `/healthz` would be configured by default.
 	HealthProbeParamsRequestPath  HealthProbeParams = "request-path"
 	HealthProbeDefaultRequestPath string            = "/"
+
+	// HealthProbeParamsShareWith determines the service port, by number or name, whose health probe is used by the
+	// load balancing rule of the port instead of a health probe of its own.
+	HealthProbeParamsShareWith HealthProbeParams = "share-with"
+
+	// HealthProbeParamsUseKubeProxy determines whether the port is probed by the health check of kube-proxy regardless
+	// of the protocol. The health check node port is probed for the local services, and the healthz port of kube-proxy
+	// for the cluster services.
+	HealthProbeParamsUseKubeProxy HealthProbeParams = "use-kube-proxy"
+	// KubeProxyHealthCheckPort is the default port of the healthz server of kube-proxy.
+	KubeProxyHealthCheckPort int32 = 10256
+	// KubeProxyHealthCheckRequestPath is the request path of the healthz server of kube-proxy.
+	KubeProxyHealthCheckRequestPath = "/healthz"
 )
 
 type HealthProbeParams string
@@ -487,6 +707,10 @@ const (
 	// ServiceAnnotationPLSIpConfigurationSubnet determines the subnet name to deploy the PLS resource.
 	ServiceAnnotationPLSIpConfigurationSubnet = "service.beta.kubernetes.io/azure-pls-ip-configuration-subnet"
 
+	// ServiceAnnotationPLSIpConfigurationSubnets determines a space separated list of subnet names to spread the PLS IP
+	// configurations across. It takes precedence over ServiceAnnotationPLSIpConfigurationSubnet.
+	ServiceAnnotationPLSIpConfigurationSubnets = "service.beta.kubernetes.io/azure-pls-ip-configuration-subnets"
+
 	// ServiceAnnotationPLSIpConfigurationIPAddressCount determines number of IPs to be associated with the PLS.
 	ServiceAnnotationPLSIpConfigurationIPAddressCount = "service.beta.kubernetes.io/azure-pls-ip-configuration-ip-address-count"
 
@@ -509,6 +733,35 @@ const (
 	// automatically approved, only works when visibility is set to "*".
 	ServiceAnnotationPLSAutoApproval = "service.beta.kubernetes.io/azure-pls-auto-approval"
 
+	// ServiceAnnotationPLSShared determines whether the service shares the PLS of its frontend IP configuration, which is
+	// created by another service with ServiceAnnotationPLSCreation. The services sharing a PLS must use distinct ports.
+	ServiceAnnotationPLSShared = "service.beta.kubernetes.io/azure-pls-shared"
+
+	// ServiceAnnotationPLSConnectionAllow determines a space separated list of Azure subscription IDs or regular expressions
+	// of private endpoint resource IDs. The pending private endpoint connections matching any of them are approved.
+	ServiceAnnotationPLSConnectionAllow = "service.beta.kubernetes.io/azure-pls-connection-allow"
+
+	// ServiceAnnotationPLSConnectionDeny determines a space separated list of Azure subscription IDs or regular expressions
+	// of private endpoint resource IDs. The pending private endpoint connections matching any of them are rejected.
+	// It takes precedence over ServiceAnnotationPLSConnectionAllow.
+	ServiceAnnotationPLSConnectionDeny = "service.beta.kubernetes.io/azure-pls-connection-deny"
+
+	// ServiceAnnotationPLSConnectionStates is set by the cloud provider to report the number of private endpoint connections
+	// of the PLS in each state, e.g. "Approved=2,Pending=1".
+	ServiceAnnotationPLSConnectionStates = "service.beta.kubernetes.io/azure-pls-connection-states"
+
+	// PrivateEndpointConnectionSyncPeriod is the period to approve or reject the pending private endpoint connections.
+	PrivateEndpointConnectionSyncPeriod = time.Minute
+
+	// PrivateEndpointConnectionStatusPending is the status of the private endpoint connections waiting for approval.
+	PrivateEndpointConnectionStatusPending = "Pending"
+	// PrivateEndpointConnectionStatusApproved is the status of the approved private endpoint connections.
+	PrivateEndpointConnectionStatusApproved = "Approved"
+	// PrivateEndpointConnectionStatusRejected is the status of the rejected private endpoint connections.
+	PrivateEndpointConnectionStatusRejected = "Rejected"
+	// PrivateEndpointConnectionStatusDisconnected is the status of the private endpoint connections whose private endpoints are deleted.
+	PrivateEndpointConnectionStatusDisconnected = "Disconnected"
+
 	// ID string used to create a not existing PLS placehold in plsCache to avoid redundant
 	PrivateLinkServiceNotExistID = "PrivateLinkServiceNotExistID"
 
@@ -525,3 +778,46 @@ const (
 const (
 	VMSSTagForBatchOperation = "aks-managed-coordination"
 )
+
+// Gateway API
+const (
+	// GatewayControllerName is the controllerName of the GatewayClasses implemented by the Azure load balancer.
+	GatewayControllerName = "cloud-provider-azure.sigs.k8s.io/azure-lb"
+	// GatewayFinalizer is added to the Gateways to clean up their load balancer frontends before they are deleted.
+	GatewayFinalizer = "cloud-provider-azure.sigs.k8s.io/gateway-cleanup"
+	// GatewayServiceNamePrefix is the name prefix of the load balancer services translated from the Gateways.
+	// The dot is not allowed in the names of the services, so the translated services never collide with the real ones.
+	GatewayServiceNamePrefix = "gateway."
+)
+
+// Outbound connectivity
+const (
+	// OutboundTypeLoadBalancer makes the cloud provider own an outbound rule on the primary standard load balancer.
+	OutboundTypeLoadBalancer = "loadBalancer"
+	// OutboundTypeNatGateway makes the cloud provider attach a NAT gateway to the node subnet.
+	OutboundTypeNatGateway = "natGateway"
+
+	// OutboundSyncPeriod is the period to reconcile the outbound connectivity with the node count.
+	OutboundSyncPeriod = time.Minute
+	// LoadBalancerOutboundPortsPerIP is the number of SNAT ports provided by each frontend IP of an outbound rule.
+	LoadBalancerOutboundPortsPerIP = 64000
+	// NatGatewayOutboundPortsPerIP is the number of SNAT ports provided by each public IP of a NAT gateway.
+	NatGatewayOutboundPortsPerIP = 64512
+	// MaxOutboundIPCount is the maximum number of managed outbound public IPs.
+	MaxOutboundIPCount = 16
+	// DefaultOutboundIdleTimeoutInMinutes is the default idle timeout of the outbound flows.
+	DefaultOutboundIdleTimeoutInMinutes = 4
+)
+
+// Failed instance remediation
+const (
+	// InstanceRemediationActionReimage reimages the VMSS instance stuck in the Failed provisioning state.
+	InstanceRemediationActionReimage = "reimage"
+	// InstanceRemediationActionRedeploy redeploys the VMSS instance stuck in the Failed provisioning state.
+	InstanceRemediationActionRedeploy = "redeploy"
+
+	// InstanceStateSyncPeriod is the period to compute the instance states of the nodes and remediate the failed instances.
+	InstanceStateSyncPeriod = time.Minute
+	// DefaultFailedInstanceRemediationDelayInSeconds is the default time an instance stays failed before it is remediated.
+	DefaultFailedInstanceRemediationDelayInSeconds = 600
+)
@@ -45,6 +45,31 @@ func IsK8sServiceDisableLoadBalancerFloatingIP(service *v1.Service) bool {
 	return expectAttributeInSvcAnnotationBeEqualTo(service.Annotations, ServiceAnnotationDisableLoadBalancerFloatingIP, TrueAnnotationValue)
 }
 
+// IsK8sServiceLoadBalancerDryRun return if the load balancer of the service should be reconciled in plan mode
+func IsK8sServiceLoadBalancerDryRun(service *v1.Service) bool {
+	return expectAttributeInSvcAnnotationBeEqualTo(service.Annotations, ServiceAnnotationLoadBalancerDryRun, TrueAnnotationValue)
+}
+
+// IsK8sServiceUsingApplicationGateway return if the service is exposed by an application gateway
+func IsK8sServiceUsingApplicationGateway(service *v1.Service) bool {
+	return expectAttributeInSvcAnnotationBeEqualTo(service.Annotations, ServiceAnnotationLoadBalancerType, LoadBalancerTypeApplicationGateway)
+}
+
+// IsGatewayService return if the service is translated from a Gateway, which doesn't exist in the API server
+func IsGatewayService(service *v1.Service) bool {
+	return strings.HasPrefix(service.Name, GatewayServiceNamePrefix)
+}
+
+// IsK8sServiceUsingZonalFrontends return if the service has one frontend IP per availability zone
+func IsK8sServiceUsingZonalFrontends(service *v1.Service) bool {
+	return expectAttributeInSvcAnnotationBeEqualTo(service.Annotations, ServiceAnnotationLoadBalancerZonalFrontends, TrueAnnotationValue)
+}
+
+// IsK8sServicePIPRetainedOnDelete return if the public IP of the service should be kept when it is released
+func IsK8sServicePIPRetainedOnDelete(service *v1.Service) bool {
+	return expectAttributeInSvcAnnotationBeEqualTo(service.Annotations, ServiceAnnotationPIPRetainOnDelete, TrueAnnotationValue)
+}
+
 // GetHealthProbeConfigOfPortFromK8sSvcAnnotation get health probe configuration for port
 func GetHealthProbeConfigOfPortFromK8sSvcAnnotation(annotations map[string]string, port int32, key HealthProbeParams, validators ...BusinessValidator) (*string, error) {
 	return GetAttributeValueInSvcAnnotation(annotations, BuildHealthProbeAnnotationKeyForPort(port, key), validators...)
@@ -55,6 +80,11 @@ func IsHealthProbeRuleOnK8sServicePortDisabled(annotations map[string]string, po
 	return expectAttributeInSvcAnnotationBeEqualTo(annotations, BuildAnnotationKeyForPort(port, PortAnnotationNoHealthProbeRule), TrueAnnotationValue), nil
 }
 
+// IsHealthProbeUsingKubeProxyOnK8sServicePort return if port is probed by the health check of kube-proxy
+func IsHealthProbeUsingKubeProxyOnK8sServicePort(annotations map[string]string, port int32) bool {
+	return expectAttributeInSvcAnnotationBeEqualTo(annotations, BuildHealthProbeAnnotationKeyForPort(port, HealthProbeParamsUseKubeProxy), TrueAnnotationValue)
+}
+
 // IsHealthProbeRuleOnK8sServicePortDisabled return if port is for health probe only
 func IsLBRuleOnK8sServicePortDisabled(annotations map[string]string, port int32) (bool, error) {
 	return expectAttributeInSvcAnnotationBeEqualTo(annotations, BuildAnnotationKeyForPort(port, PortAnnotationNoLBRule), TrueAnnotationValue), nil
@@ -0,0 +1,756 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// resyncPeriod is the resync period of the Gateway API informers. The parameters of the GatewayClasses are not
+// watched, so their changes are applied on the next resync.
+const resyncPeriod = 10 * time.Minute
+
+// Controller translates the Gateways of the GatewayClasses implemented by the Azure load balancer into load
+// balancer services, and reconciles them with the same frontend IP configurations, load balancing rules, probes and
+// security rules as the services of type LoadBalancer. The traffic of each listener is sent to the node port of
+// the backend service of its route.
+type Controller struct {
+	clusterName   string
+	balancer      cloudprovider.LoadBalancer
+	kubeClient    clientset.Interface
+	dynamicClient dynamic.Interface
+	recorder      record.EventRecorder
+
+	dynamicInformerFactory dynamicinformer.DynamicSharedInformerFactory
+	serviceLister          corelisters.ServiceLister
+	nodeLister             corelisters.NodeLister
+	gatewayClassLister     cache.GenericLister
+	gatewayLister          cache.GenericLister
+	tcpRouteLister         cache.GenericLister
+	udpRouteLister         cache.GenericLister
+	cacheSynced            []cache.InformerSynced
+
+	queue workqueue.RateLimitingInterface
+}
+
+// NewController creates a Gateway controller. The service and node informers are taken from informerFactory,
+// which is started by the caller.
+func NewController(
+	clusterName string,
+	balancer cloudprovider.LoadBalancer,
+	kubeClient clientset.Interface,
+	dynamicClient dynamic.Interface,
+	informerFactory informers.SharedInformerFactory,
+) *Controller {
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartLogging(klog.Infof)
+	if kubeClient != nil {
+		eventBroadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+	}
+
+	dynamicInformerFactory := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, resyncPeriod)
+	serviceInformer := informerFactory.Core().V1().Services()
+	nodeInformer := informerFactory.Core().V1().Nodes()
+	gatewayClassInformer := dynamicInformerFactory.ForResource(GatewayClassGVR)
+	gatewayInformer := dynamicInformerFactory.ForResource(GatewayGVR)
+	tcpRouteInformer := dynamicInformerFactory.ForResource(TCPRouteGVR)
+	udpRouteInformer := dynamicInformerFactory.ForResource(UDPRouteGVR)
+
+	c := &Controller{
+		clusterName:            clusterName,
+		balancer:               balancer,
+		kubeClient:             kubeClient,
+		dynamicClient:          dynamicClient,
+		recorder:               eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "gateway-controller"}),
+		dynamicInformerFactory: dynamicInformerFactory,
+		serviceLister:          serviceInformer.Lister(),
+		nodeLister:             nodeInformer.Lister(),
+		gatewayClassLister:     gatewayClassInformer.Lister(),
+		gatewayLister:          gatewayInformer.Lister(),
+		tcpRouteLister:         tcpRouteInformer.Lister(),
+		udpRouteLister:         udpRouteInformer.Lister(),
+		cacheSynced: []cache.InformerSynced{
+			serviceInformer.Informer().HasSynced,
+			nodeInformer.Informer().HasSynced,
+			gatewayClassInformer.Informer().HasSynced,
+			gatewayInformer.Informer().HasSynced,
+			tcpRouteInformer.Informer().HasSynced,
+			udpRouteInformer.Informer().HasSynced,
+		},
+		queue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "gateway"),
+	}
+
+	_, _ = gatewayClassInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.enqueueGatewaysOfClass(obj) },
+		UpdateFunc: func(_, newObj interface{}) { c.enqueueGatewaysOfClass(newObj) },
+		DeleteFunc: func(obj interface{}) { c.enqueueGatewaysOfClass(obj) },
+	})
+	_, _ = gatewayInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.enqueueGateway(obj) },
+		UpdateFunc: func(_, newObj interface{}) { c.enqueueGateway(newObj) },
+		DeleteFunc: func(obj interface{}) { c.enqueueGateway(obj) },
+	})
+	routeHandler := cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) { c.enqueueParentGateways(obj) },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			c.enqueueParentGateways(oldObj)
+			c.enqueueParentGateways(newObj)
+		},
+		DeleteFunc: func(obj interface{}) { c.enqueueParentGateways(obj) },
+	}
+	_, _ = tcpRouteInformer.Informer().AddEventHandler(routeHandler)
+	_, _ = udpRouteInformer.Informer().AddEventHandler(routeHandler)
+	_, _ = serviceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.enqueueGatewaysOfBackend(obj) },
+		UpdateFunc: func(_, newObj interface{}) { c.enqueueGatewaysOfBackend(newObj) },
+		DeleteFunc: func(obj interface{}) { c.enqueueGatewaysOfBackend(obj) },
+	})
+	_, _ = nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(interface{}) { c.enqueueAllGateways() },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNode, ok := oldObj.(*v1.Node)
+			if !ok {
+				return
+			}
+			newNode, ok := newObj.(*v1.Node)
+			if !ok {
+				return
+			}
+			if shouldSyncUpdatedNode(oldNode, newNode) {
+				c.enqueueAllGateways()
+			}
+		},
+		DeleteFunc: func(interface{}) { c.enqueueAllGateways() },
+	})
+
+	return c
+}
+
+// Run starts the Gateway API informers and the workers until the context is done.
+func (c *Controller) Run(ctx context.Context, workers int) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Infof("Starting gateway controller")
+	defer klog.Infof("Shutting down gateway controller")
+
+	c.dynamicInformerFactory.Start(ctx.Done())
+	if !cache.WaitForNamedCacheSync("gateway", ctx.Done(), c.cacheSynced...) {
+		return
+	}
+
+	for i := 0; i < workers; i++ {
+		go wait.UntilWithContext(ctx, c.worker, time.Second)
+	}
+	<-ctx.Done()
+}
+
+func (c *Controller) worker(ctx context.Context) {
+	for c.processNextItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextItem(ctx context.Context) bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	if err := c.syncGateway(ctx, key.(string)); err != nil {
+		klog.Errorf("Failed to sync gateway %s: %v", key, err)
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+func (c *Controller) enqueueGateway(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+func (c *Controller) enqueueAllGateways() {
+	objs, err := c.gatewayLister.List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	for _, obj := range objs {
+		c.enqueueGateway(obj)
+	}
+}
+
+func (c *Controller) enqueueGatewaysOfClass(obj interface{}) {
+	className, err := getObjectName(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	objs, err := c.gatewayLister.List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	for _, obj := range objs {
+		gw := &gateway{}
+		if err := fromUnstructured(obj, gw); err != nil {
+			utilruntime.HandleError(err)
+			continue
+		}
+		if gw.Spec.GatewayClassName == className {
+			c.queue.Add(gw.Namespace + "/" + gw.Name)
+		}
+	}
+}
+
+func (c *Controller) enqueueParentGateways(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	runtimeObj, ok := obj.(runtime.Object)
+	if !ok {
+		return
+	}
+	r := &route{}
+	if err := fromUnstructured(runtimeObj, r); err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	for _, ref := range r.Spec.ParentRefs {
+		if isGatewayReference(ref) {
+			c.queue.Add(pointer.StringDeref(ref.Namespace, r.Namespace) + "/" + ref.Name)
+		}
+	}
+}
+
+// enqueueGatewaysOfBackend enqueues the Gateways whose routes send the traffic to the service, since its node ports
+// are used by the load balancing rules.
+func (c *Controller) enqueueGatewaysOfBackend(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	service, ok := obj.(*v1.Service)
+	if !ok {
+		return
+	}
+	for _, lister := range []cache.GenericLister{c.tcpRouteLister, c.udpRouteLister} {
+		objs, err := lister.ByNamespace(service.Namespace).List(labels.Everything())
+		if err != nil {
+			utilruntime.HandleError(err)
+			continue
+		}
+		for _, obj := range objs {
+			r := &route{}
+			if err := fromUnstructured(obj, r); err != nil {
+				utilruntime.HandleError(err)
+				continue
+			}
+			if routeReferencesService(r, service.Name) {
+				c.enqueueParentGateways(obj)
+			}
+		}
+	}
+}
+
+func (c *Controller) syncGateway(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	obj, err := c.gatewayLister.ByNamespace(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		// The load balancer of the Gateway has been cleaned up before the finalizer was removed.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	gw := &gateway{}
+	if err := fromUnstructured(obj, gw); err != nil {
+		return err
+	}
+
+	class, params, paramsErr := c.getGatewayClass(ctx, gw.Spec.GatewayClassName)
+	if gw.DeletionTimestamp != nil || class == nil {
+		if !hasFinalizer(gw) {
+			return nil
+		}
+		if params == nil {
+			params = &gatewayClassParameters{}
+		}
+		klog.V(2).Infof("syncGateway(%s): deleting the load balancer", key)
+		if err := c.balancer.EnsureLoadBalancerDeleted(ctx, c.clusterName, buildService(gw, params, nil)); err != nil {
+			c.recorder.Eventf(obj, v1.EventTypeWarning, "DeleteLoadBalancerFailed", "Error deleting load balancer: %v", err)
+			return err
+		}
+		c.recorder.Event(obj, v1.EventTypeNormal, "DeletedLoadBalancer", "Deleted load balancer")
+		return c.setFinalizer(ctx, gw, false)
+	}
+
+	status := gatewayStatus{
+		Addresses:  gw.Status.Addresses,
+		Conditions: append([]metav1.Condition(nil), gw.Status.Conditions...),
+	}
+	if paramsErr != nil {
+		setCondition(&status.Conditions, gw.Generation, conditionAccepted, metav1.ConditionFalse, reasonInvalidParameters, paramsErr.Error())
+		setCondition(&status.Conditions, gw.Generation, conditionProgrammed, metav1.ConditionFalse, reasonInvalid, paramsErr.Error())
+		return c.updateGatewayStatus(ctx, gw, status)
+	}
+	setCondition(&status.Conditions, gw.Generation, conditionAccepted, metav1.ConditionTrue, reasonAccepted, "")
+
+	if !hasFinalizer(gw) {
+		if err := c.setFinalizer(ctx, gw, true); err != nil {
+			return err
+		}
+	}
+
+	ports, listenerStatuses := c.resolveListeners(gw)
+	service := buildService(gw, params, ports)
+	var syncErr error
+	if len(ports) == 0 {
+		// A service without ports is not valid, so the frontend is released until a route is resolved.
+		if syncErr = c.balancer.EnsureLoadBalancerDeleted(ctx, c.clusterName, service); syncErr == nil {
+			status.Addresses = nil
+			setCondition(&status.Conditions, gw.Generation, conditionProgrammed, metav1.ConditionFalse, reasonPending, "No listener has a resolved route")
+		}
+	} else {
+		nodes, err := c.listNodes()
+		if err != nil {
+			return err
+		}
+		var lbStatus *v1.LoadBalancerStatus
+		if lbStatus, syncErr = c.balancer.EnsureLoadBalancer(ctx, c.clusterName, service, nodes); syncErr == nil {
+			status.Addresses = getGatewayAddresses(lbStatus)
+			setCondition(&status.Conditions, gw.Generation, conditionProgrammed, metav1.ConditionTrue, reasonProgrammed, "")
+			c.recorder.Event(obj, v1.EventTypeNormal, "EnsuredLoadBalancer", "Ensured load balancer")
+		}
+	}
+	if syncErr != nil {
+		c.recorder.Eventf(obj, v1.EventTypeWarning, "SyncLoadBalancerFailed", "Error syncing load balancer: %v", syncErr)
+		setCondition(&status.Conditions, gw.Generation, conditionProgrammed, metav1.ConditionFalse, reasonInvalid, syncErr.Error())
+	}
+
+	programmed := meta.IsStatusConditionTrue(status.Conditions, conditionProgrammed)
+	for i := range listenerStatuses {
+		ls := &listenerStatuses[i]
+		if programmed && meta.IsStatusConditionTrue(ls.Conditions, conditionResolvedRefs) && ls.AttachedRoutes > 0 {
+			setCondition(&ls.Conditions, gw.Generation, conditionProgrammed, metav1.ConditionTrue, reasonProgrammed, "")
+		} else {
+			setCondition(&ls.Conditions, gw.Generation, conditionProgrammed, metav1.ConditionFalse, reasonPending, "")
+		}
+	}
+	status.Listeners = listenerStatuses
+
+	if err := c.updateGatewayStatus(ctx, gw, status); err != nil {
+		return err
+	}
+	return syncErr
+}
+
+// getGatewayClass returns the GatewayClass and its parameters if it is implemented by the controller, and accepts it.
+func (c *Controller) getGatewayClass(ctx context.Context, name string) (*gatewayClass, *gatewayClassParameters, error) {
+	obj, err := c.gatewayClassLister.Get(name)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			klog.Errorf("getGatewayClass(%s): %v", name, err)
+		}
+		return nil, nil, nil
+	}
+	class := &gatewayClass{}
+	if err := fromUnstructured(obj, class); err != nil {
+		return nil, nil, err
+	}
+	if class.Spec.ControllerName != consts.GatewayControllerName {
+		return nil, nil, nil
+	}
+
+	params, paramsErr := c.getGatewayClassParameters(ctx, class)
+	conditions := append([]metav1.Condition(nil), class.Status.Conditions...)
+	if paramsErr != nil {
+		setCondition(&conditions, class.Generation, conditionAccepted, metav1.ConditionFalse, reasonInvalidParameters, paramsErr.Error())
+	} else {
+		setCondition(&conditions, class.Generation, conditionAccepted, metav1.ConditionTrue, reasonAccepted, "")
+	}
+	if !reflect.DeepEqual(conditions, class.Status.Conditions) {
+		class.Status.Conditions = conditions
+		u, err := toUnstructured(class)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := c.dynamicClient.Resource(GatewayClassGVR).UpdateStatus(ctx, u, metav1.UpdateOptions{}); err != nil {
+			klog.Warningf("getGatewayClass(%s): failed to update the status: %v", name, err)
+		}
+	}
+	return class, params, paramsErr
+}
+
+// getGatewayClassParameters reads the parameters from the ConfigMap referenced by the GatewayClass.
+func (c *Controller) getGatewayClassParameters(ctx context.Context, class *gatewayClass) (*gatewayClassParameters, error) {
+	ref := class.Spec.ParametersRef
+	if ref == nil {
+		return &gatewayClassParameters{}, nil
+	}
+	if ref.Group != "" || ref.Kind != kindConfigMap || ref.Namespace == nil {
+		return nil, fmt.Errorf("parametersRef must reference a ConfigMap with its namespace")
+	}
+	configMap, err := c.kubeClient.CoreV1().ConfigMaps(*ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the parameters ConfigMap %s/%s: %w", *ref.Namespace, ref.Name, err)
+	}
+	return parseGatewayClassParameters(configMap.Data)
+}
+
+// resolveListeners returns the service ports of the listeners whose routes are resolved, and the statuses of
+// the listeners. Only the routes in the namespace of the Gateway are attached. An Azure load balancing rule
+// forwards the traffic to one backend port, so the first backend of the oldest route of each listener is used.
+func (c *Controller) resolveListeners(gw *gateway) ([]v1.ServicePort, []listenerStatus) {
+	routes := map[string][]*route{
+		kindTCPRoute: c.listRoutes(c.tcpRouteLister, gw.Namespace),
+		kindUDPRoute: c.listRoutes(c.udpRouteLister, gw.Namespace),
+	}
+	existingConditions := make(map[string][]metav1.Condition)
+	for _, ls := range gw.Status.Listeners {
+		existingConditions[ls.Name] = ls.Conditions
+	}
+
+	var ports []v1.ServicePort
+	statuses := make([]listenerStatus, 0, len(gw.Spec.Listeners))
+	for _, l := range gw.Spec.Listeners {
+		ls := listenerStatus{
+			Name:           l.Name,
+			SupportedKinds: []routeGroupKind{},
+			Conditions:     append([]metav1.Condition{}, existingConditions[l.Name]...),
+		}
+		kind := getRouteKind(l.Protocol)
+		if kind == "" {
+			message := fmt.Sprintf("Protocol %s is not supported, only TCP and UDP are supported", l.Protocol)
+			setCondition(&ls.Conditions, gw.Generation, conditionAccepted, metav1.ConditionFalse, reasonUnsupportedProtocol, message)
+			setCondition(&ls.Conditions, gw.Generation, conditionResolvedRefs, metav1.ConditionFalse, reasonInvalid, message)
+			statuses = append(statuses, ls)
+			continue
+		}
+		ls.SupportedKinds = []routeGroupKind{{Group: pointer.String(gatewayGroup), Kind: kind}}
+		setCondition(&ls.Conditions, gw.Generation, conditionAccepted, metav1.ConditionTrue, reasonAccepted, "")
+
+		var port *v1.ServicePort
+		for _, r := range routes[kind] {
+			if !routeAttachesToListener(r, gw, l) {
+				continue
+			}
+			ls.AttachedRoutes++
+			if port == nil {
+				port = c.resolveBackendPort(r, l)
+			}
+		}
+		if port == nil && ls.AttachedRoutes > 0 {
+			setCondition(&ls.Conditions, gw.Generation, conditionResolvedRefs, metav1.ConditionFalse, reasonBackendNotFound, "No backend service with a node port is found for the routes")
+		} else {
+			setCondition(&ls.Conditions, gw.Generation, conditionResolvedRefs, metav1.ConditionTrue, reasonResolvedRefs, "")
+		}
+		if port != nil {
+			ports = append(ports, *port)
+		}
+		statuses = append(statuses, ls)
+	}
+	return ports, statuses
+}
+
+// listRoutes returns the routes in the namespace sorted by creation time, so that the oldest route wins.
+func (c *Controller) listRoutes(lister cache.GenericLister, namespace string) []*route {
+	objs, err := lister.ByNamespace(namespace).List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleError(err)
+		return nil
+	}
+	routes := make([]*route, 0, len(objs))
+	for _, obj := range objs {
+		r := &route{}
+		if err := fromUnstructured(obj, r); err != nil {
+			utilruntime.HandleError(err)
+			continue
+		}
+		routes = append(routes, r)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if !routes[i].CreationTimestamp.Equal(&routes[j].CreationTimestamp) {
+			return routes[i].CreationTimestamp.Before(&routes[j].CreationTimestamp)
+		}
+		return routes[i].Name < routes[j].Name
+	})
+	return routes
+}
+
+// resolveBackendPort returns the service port of the listener which targets the node port of the first backend
+// service of the route in the same namespace.
+func (c *Controller) resolveBackendPort(r *route, l listener) *v1.ServicePort {
+	for _, rule := range r.Spec.Rules {
+		for _, ref := range rule.BackendRefs {
+			if pointer.StringDeref(ref.Group, "") != "" || pointer.StringDeref(ref.Kind, kindService) != kindService ||
+				pointer.StringDeref(ref.Namespace, r.Namespace) != r.Namespace || ref.Port == nil {
+				continue
+			}
+			service, err := c.serviceLister.Services(r.Namespace).Get(ref.Name)
+			if err != nil {
+				continue
+			}
+			for _, port := range service.Spec.Ports {
+				if port.Port == *ref.Port && string(port.Protocol) == l.Protocol && port.NodePort != 0 {
+					return &v1.ServicePort{
+						Name:     l.Name,
+						Protocol: port.Protocol,
+						Port:     l.Port,
+						NodePort: port.NodePort,
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// listNodes returns the ready nodes which are not excluded from the load balancers.
+func (c *Controller) listNodes() ([]*v1.Node, error) {
+	nodes, err := c.nodeLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	var result []*v1.Node
+	for _, node := range nodes {
+		if _, excluded := node.Labels[v1.LabelNodeExcludeBalancers]; excluded {
+			continue
+		}
+		if isNodeReady(node) {
+			result = append(result, node)
+		}
+	}
+	return result, nil
+}
+
+func isNodeReady(node *v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// shouldSyncUpdatedNode returns true if the update of the node may change the backend pools of the Gateways, i.e.
+// its readiness, labels, which select the load balancers and exclude the node from them, or provider ID changes.
+func shouldSyncUpdatedNode(oldNode, newNode *v1.Node) bool {
+	return isNodeReady(oldNode) != isNodeReady(newNode) ||
+		!reflect.DeepEqual(oldNode.Labels, newNode.Labels) ||
+		oldNode.Spec.ProviderID != newNode.Spec.ProviderID
+}
+
+func (c *Controller) updateGatewayStatus(ctx context.Context, gw *gateway, status gatewayStatus) error {
+	if reflect.DeepEqual(gw.Status, status) {
+		return nil
+	}
+	gw.Status = status
+	u, err := toUnstructured(gw)
+	if err != nil {
+		return err
+	}
+	_, err = c.dynamicClient.Resource(GatewayGVR).Namespace(gw.Namespace).UpdateStatus(ctx, u, metav1.UpdateOptions{})
+	return err
+}
+
+// setFinalizer adds or removes the finalizer of the Gateway.
+func (c *Controller) setFinalizer(ctx context.Context, gw *gateway, add bool) error {
+	finalizers := []string{}
+	for _, f := range gw.Finalizers {
+		if f != consts.GatewayFinalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	if add {
+		finalizers = append(finalizers, consts.GatewayFinalizer)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"finalizers":      finalizers,
+			"resourceVersion": gw.ResourceVersion,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	updated, err := c.dynamicClient.Resource(GatewayGVR).Namespace(gw.Namespace).Patch(ctx, gw.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+	gw.Finalizers = finalizers
+	gw.ResourceVersion = updated.GetResourceVersion()
+	return nil
+}
+
+// buildService translates the Gateway into a load balancer service. The service has the UID of the Gateway, so
+// its frontend IP configuration, rules and probes are distinguished from the ones of the other services. The
+// floating IP is disabled to send the traffic to the node ports of the backend services.
+func buildService(gw *gateway, params *gatewayClassParameters, ports []v1.ServicePort) *v1.Service {
+	annotations := params.annotations()
+	annotations[consts.ServiceAnnotationDisableLoadBalancerFloatingIP] = consts.TrueAnnotationValue
+	for _, address := range gw.Spec.Addresses {
+		if pointer.StringDeref(address.Type, addressTypeIPAddress) != addressTypeIPAddress {
+			continue
+		}
+		if ip := net.ParseIP(address.Value); ip != nil && ip.To4() != nil {
+			annotations[consts.ServiceAnnotationLoadBalancerIPDualStack[false]] = address.Value
+			break
+		}
+	}
+
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        consts.GatewayServiceNamePrefix + gw.Name,
+			Namespace:   gw.Namespace,
+			UID:         gw.UID,
+			Annotations: annotations,
+		},
+		Spec: v1.ServiceSpec{
+			Type:                  v1.ServiceTypeLoadBalancer,
+			Ports:                 ports,
+			ExternalTrafficPolicy: v1.ServiceExternalTrafficPolicyTypeCluster,
+		},
+	}
+	for _, address := range gw.Status.Addresses {
+		service.Status.LoadBalancer.Ingress = append(service.Status.LoadBalancer.Ingress, v1.LoadBalancerIngress{IP: address.Value})
+	}
+	return service
+}
+
+func getGatewayAddresses(status *v1.LoadBalancerStatus) []gatewayAddress {
+	if status == nil {
+		return nil
+	}
+	var addresses []gatewayAddress
+	for _, ingress := range status.Ingress {
+		if ingress.IP != "" {
+			addresses = append(addresses, gatewayAddress{Type: pointer.String(addressTypeIPAddress), Value: ingress.IP})
+		}
+	}
+	return addresses
+}
+
+func getRouteKind(protocol string) string {
+	switch protocol {
+	case protocolTCP:
+		return kindTCPRoute
+	case protocolUDP:
+		return kindUDPRoute
+	}
+	return ""
+}
+
+func isGatewayReference(ref parentReference) bool {
+	return pointer.StringDeref(ref.Group, gatewayGroup) == gatewayGroup && pointer.StringDeref(ref.Kind, kindGateway) == kindGateway
+}
+
+func routeAttachesToListener(r *route, gw *gateway, l listener) bool {
+	for _, ref := range r.Spec.ParentRefs {
+		if !isGatewayReference(ref) || ref.Name != gw.Name || pointer.StringDeref(ref.Namespace, r.Namespace) != gw.Namespace {
+			continue
+		}
+		if ref.SectionName != nil && *ref.SectionName != l.Name {
+			continue
+		}
+		if ref.Port != nil && *ref.Port != l.Port {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func routeReferencesService(r *route, serviceName string) bool {
+	for _, rule := range r.Spec.Rules {
+		for _, ref := range rule.BackendRefs {
+			if ref.Name == serviceName && pointer.StringDeref(ref.Kind, kindService) == kindService {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasFinalizer(gw *gateway) bool {
+	for _, f := range gw.Finalizers {
+		if f == consts.GatewayFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+func setCondition(conditions *[]metav1.Condition, generation int64, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+func getObjectName(obj interface{}) (string, error) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return "", err
+	}
+	return accessor.GetName(), nil
+}
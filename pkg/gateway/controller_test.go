@@ -0,0 +1,383 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+const testClusterName = "kubernetes"
+
+// fakeBalancer records the services reconciled by the controller.
+type fakeBalancer struct {
+	ensured []*v1.Service
+	deleted []*v1.Service
+	nodes   []*v1.Node
+	err     error
+}
+
+func (b *fakeBalancer) GetLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) (*v1.LoadBalancerStatus, bool, error) {
+	return nil, false, nil
+}
+
+func (b *fakeBalancer) GetLoadBalancerName(ctx context.Context, clusterName string, service *v1.Service) string {
+	return ""
+}
+
+func (b *fakeBalancer) EnsureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	b.ensured = append(b.ensured, service)
+	b.nodes = nodes
+	if b.err != nil {
+		return nil, b.err
+	}
+	return &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "10.0.0.1"}}}, nil
+}
+
+func (b *fakeBalancer) UpdateLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) error {
+	return nil
+}
+
+func (b *fakeBalancer) EnsureLoadBalancerDeleted(ctx context.Context, clusterName string, service *v1.Service) error {
+	b.deleted = append(b.deleted, service)
+	return b.err
+}
+
+func getTestGatewayClass(parametersRef *parametersReference) *gatewayClass {
+	return &gatewayClass{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "gateway.networking.k8s.io/v1beta1", Kind: "GatewayClass"},
+		ObjectMeta: metav1.ObjectMeta{Name: "azure-lb"},
+		Spec: gatewayClassSpec{
+			ControllerName: consts.GatewayControllerName,
+			ParametersRef:  parametersRef,
+		},
+	}
+}
+
+func getTestGateway(className string) *gateway {
+	return &gateway{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "gateway.networking.k8s.io/v1beta1", Kind: "Gateway"},
+		ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: "default", UID: "uid", Generation: 1},
+		Spec: gatewaySpec{
+			GatewayClassName: className,
+			Listeners: []listener{
+				{Name: "tcp", Port: 80, Protocol: protocolTCP},
+				{Name: "dns", Port: 53, Protocol: protocolUDP},
+				{Name: "http", Port: 8080, Protocol: "HTTP"},
+			},
+		},
+	}
+}
+
+func getTestRoute(kind, name string, port int32) *route {
+	return &route{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "gateway.networking.k8s.io/v1alpha2", Kind: kind},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: routeSpec{
+			ParentRefs: []parentReference{{Name: "gw"}},
+			Rules: []routeRule{{
+				BackendRefs: []backendReference{{Name: "backend", Port: pointer.Int32(port)}},
+			}},
+		},
+	}
+}
+
+func mustToUnstructured(t *testing.T, obj interface{}) *unstructured.Unstructured {
+	u, err := toUnstructured(obj)
+	assert.NoError(t, err)
+	return u
+}
+
+func newTestController(t *testing.T, balancer *fakeBalancer, class *gatewayClass, gw *gateway, routes ...*route) *Controller {
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "params", Namespace: "kube-system"},
+		Data:       map[string]string{parameterInternal: "true"},
+	}
+	backend := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "backend", Namespace: "default"},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Port: 8080, Protocol: v1.ProtocolTCP, NodePort: 30080}},
+		},
+	}
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node"},
+		Status: v1.NodeStatus{
+			Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}},
+		},
+	}
+	excludedNode := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "excluded", Labels: map[string]string{v1.LabelNodeExcludeBalancers: ""}},
+		Status:     node.Status,
+	}
+
+	kubeClient := fake.NewSimpleClientset(configMap)
+	informerFactory := informers.NewSharedInformerFactory(kubeClient, 0)
+	assert.NoError(t, informerFactory.Core().V1().Services().Informer().GetIndexer().Add(backend))
+	assert.NoError(t, informerFactory.Core().V1().Nodes().Informer().GetIndexer().Add(node))
+	assert.NoError(t, informerFactory.Core().V1().Nodes().Informer().GetIndexer().Add(excludedNode))
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		GatewayClassGVR: "GatewayClassList",
+		GatewayGVR:      "GatewayList",
+		TCPRouteGVR:     "TCPRouteList",
+		UDPRouteGVR:     "UDPRouteList",
+	})
+	c := NewController(testClusterName, balancer, kubeClient, dynamicClient, informerFactory)
+	c.recorder = record.NewFakeRecorder(10)
+
+	// The objects are added with their resources, which cannot be guessed from the kinds of the Gateways.
+	addObject := func(gvr schema.GroupVersionResource, namespace string, obj interface{}) {
+		u := mustToUnstructured(t, obj)
+		assert.NoError(t, dynamicClient.Tracker().Create(gvr, u, namespace))
+		assert.NoError(t, c.dynamicInformerFactory.ForResource(gvr).Informer().GetIndexer().Add(u))
+	}
+	addObject(GatewayClassGVR, "", class)
+	addObject(GatewayGVR, gw.Namespace, gw)
+	for _, r := range routes {
+		gvr := TCPRouteGVR
+		if r.Kind == kindUDPRoute {
+			gvr = UDPRouteGVR
+		}
+		addObject(gvr, r.Namespace, r)
+	}
+	return c
+}
+
+func getGatewayFromClient(t *testing.T, c *Controller) *gateway {
+	u, err := c.dynamicClient.Resource(GatewayGVR).Namespace("default").Get(context.TODO(), "gw", metav1.GetOptions{})
+	assert.NoError(t, err)
+	gw := &gateway{}
+	assert.NoError(t, fromUnstructured(u, gw))
+	return gw
+}
+
+func TestSyncGateway(t *testing.T) {
+	paramsRef := &parametersReference{Kind: kindConfigMap, Name: "params", Namespace: pointer.String("kube-system")}
+
+	t.Run("should reconcile the load balancer of the resolved listeners", func(t *testing.T) {
+		balancer := &fakeBalancer{}
+		c := newTestController(t, balancer, getTestGatewayClass(paramsRef), getTestGateway("azure-lb"),
+			getTestRoute(kindTCPRoute, "tcp", 8080), getTestRoute(kindUDPRoute, "udp", 53))
+
+		assert.NoError(t, c.syncGateway(context.TODO(), "default/gw"))
+
+		assert.Equal(t, 1, len(balancer.ensured))
+		service := balancer.ensured[0]
+		assert.Equal(t, "gateway.gw", service.Name)
+		assert.Equal(t, "uid", string(service.UID))
+		assert.Equal(t, []v1.ServicePort{{Name: "tcp", Protocol: v1.ProtocolTCP, Port: 80, NodePort: 30080}}, service.Spec.Ports)
+		assert.Equal(t, consts.TrueAnnotationValue, service.Annotations[consts.ServiceAnnotationLoadBalancerInternal])
+		assert.Equal(t, consts.TrueAnnotationValue, service.Annotations[consts.ServiceAnnotationDisableLoadBalancerFloatingIP])
+		assert.Equal(t, 1, len(balancer.nodes))
+
+		gw := getGatewayFromClient(t, c)
+		assert.Equal(t, []string{consts.GatewayFinalizer}, gw.Finalizers)
+		assert.Equal(t, []gatewayAddress{{Type: pointer.String(addressTypeIPAddress), Value: "10.0.0.1"}}, gw.Status.Addresses)
+		assert.True(t, meta.IsStatusConditionTrue(gw.Status.Conditions, conditionAccepted))
+		assert.True(t, meta.IsStatusConditionTrue(gw.Status.Conditions, conditionProgrammed))
+		assert.Equal(t, 3, len(gw.Status.Listeners))
+		assert.Equal(t, int32(1), gw.Status.Listeners[0].AttachedRoutes)
+		assert.True(t, meta.IsStatusConditionTrue(gw.Status.Listeners[0].Conditions, conditionProgrammed))
+		assert.Equal(t, int32(1), gw.Status.Listeners[1].AttachedRoutes)
+		assert.Equal(t, reasonBackendNotFound, meta.FindStatusCondition(gw.Status.Listeners[1].Conditions, conditionResolvedRefs).Reason)
+		assert.True(t, meta.IsStatusConditionFalse(gw.Status.Listeners[1].Conditions, conditionProgrammed))
+		assert.Equal(t, reasonUnsupportedProtocol, meta.FindStatusCondition(gw.Status.Listeners[2].Conditions, conditionAccepted).Reason)
+
+		u, err := c.dynamicClient.Resource(GatewayClassGVR).Get(context.TODO(), "azure-lb", metav1.GetOptions{})
+		assert.NoError(t, err)
+		class := &gatewayClass{}
+		assert.NoError(t, fromUnstructured(u, class))
+		assert.True(t, meta.IsStatusConditionTrue(class.Status.Conditions, conditionAccepted))
+	})
+
+	t.Run("should release the frontend if no route is resolved", func(t *testing.T) {
+		balancer := &fakeBalancer{}
+		c := newTestController(t, balancer, getTestGatewayClass(nil), getTestGateway("azure-lb"))
+
+		assert.NoError(t, c.syncGateway(context.TODO(), "default/gw"))
+
+		assert.Equal(t, 0, len(balancer.ensured))
+		assert.Equal(t, 1, len(balancer.deleted))
+		gw := getGatewayFromClient(t, c)
+		assert.Equal(t, reasonPending, meta.FindStatusCondition(gw.Status.Conditions, conditionProgrammed).Reason)
+	})
+
+	t.Run("should report the load balancer errors", func(t *testing.T) {
+		balancer := &fakeBalancer{err: fmt.Errorf("quota exceeded")}
+		c := newTestController(t, balancer, getTestGatewayClass(nil), getTestGateway("azure-lb"), getTestRoute(kindTCPRoute, "tcp", 8080))
+
+		assert.Error(t, c.syncGateway(context.TODO(), "default/gw"))
+
+		gw := getGatewayFromClient(t, c)
+		condition := meta.FindStatusCondition(gw.Status.Conditions, conditionProgrammed)
+		assert.Equal(t, metav1.ConditionFalse, condition.Status)
+		assert.Equal(t, "quota exceeded", condition.Message)
+		assert.True(t, meta.IsStatusConditionFalse(gw.Status.Listeners[0].Conditions, conditionProgrammed))
+	})
+
+	t.Run("should not accept Gateways with invalid parameters", func(t *testing.T) {
+		balancer := &fakeBalancer{}
+		invalidRef := &parametersReference{Kind: kindConfigMap, Name: "missing", Namespace: pointer.String("kube-system")}
+		c := newTestController(t, balancer, getTestGatewayClass(invalidRef), getTestGateway("azure-lb"), getTestRoute(kindTCPRoute, "tcp", 8080))
+
+		assert.NoError(t, c.syncGateway(context.TODO(), "default/gw"))
+
+		assert.Equal(t, 0, len(balancer.ensured))
+		gw := getGatewayFromClient(t, c)
+		assert.Equal(t, reasonInvalidParameters, meta.FindStatusCondition(gw.Status.Conditions, conditionAccepted).Reason)
+	})
+
+	t.Run("should ignore the Gateways of other classes", func(t *testing.T) {
+		balancer := &fakeBalancer{}
+		c := newTestController(t, balancer, getTestGatewayClass(nil), getTestGateway("other"), getTestRoute(kindTCPRoute, "tcp", 8080))
+
+		assert.NoError(t, c.syncGateway(context.TODO(), "default/gw"))
+
+		assert.Equal(t, 0, len(balancer.ensured))
+		assert.Equal(t, 0, len(balancer.deleted))
+		assert.Empty(t, getGatewayFromClient(t, c).Status.Conditions)
+	})
+
+	t.Run("should delete the load balancer and remove the finalizer of deleting Gateways", func(t *testing.T) {
+		balancer := &fakeBalancer{}
+		gw := getTestGateway("azure-lb")
+		gw.Finalizers = []string{"other", consts.GatewayFinalizer}
+		now := metav1.Now()
+		gw.DeletionTimestamp = &now
+		c := newTestController(t, balancer, getTestGatewayClass(paramsRef), gw, getTestRoute(kindTCPRoute, "tcp", 8080))
+
+		assert.NoError(t, c.syncGateway(context.TODO(), "default/gw"))
+
+		assert.Equal(t, 0, len(balancer.ensured))
+		assert.Equal(t, 1, len(balancer.deleted))
+		assert.Equal(t, consts.TrueAnnotationValue, balancer.deleted[0].Annotations[consts.ServiceAnnotationLoadBalancerInternal])
+		assert.Equal(t, []string{"other"}, getGatewayFromClient(t, c).Finalizers)
+	})
+}
+
+func TestRouteAttachesToListener(t *testing.T) {
+	gw := getTestGateway("azure-lb")
+	l := gw.Spec.Listeners[0]
+
+	testCases := []struct {
+		desc     string
+		ref      parentReference
+		expected bool
+	}{
+		{
+			desc:     "references to the Gateway should attach to all the listeners",
+			ref:      parentReference{Name: "gw"},
+			expected: true,
+		},
+		{
+			desc:     "references to the section should attach to the listener",
+			ref:      parentReference{Name: "gw", SectionName: pointer.String("tcp"), Port: pointer.Int32(80)},
+			expected: true,
+		},
+		{
+			desc: "references to other sections should not attach to the listener",
+			ref:  parentReference{Name: "gw", SectionName: pointer.String("dns")},
+		},
+		{
+			desc: "references to other ports should not attach to the listener",
+			ref:  parentReference{Name: "gw", Port: pointer.Int32(81)},
+		},
+		{
+			desc: "references to other namespaces should not attach to the listener",
+			ref:  parentReference{Name: "gw", Namespace: pointer.String("other")},
+		},
+		{
+			desc: "references to other kinds should not attach to the listener",
+			ref:  parentReference{Name: "gw", Kind: pointer.String("Service")},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			r := getTestRoute(kindTCPRoute, "tcp", 8080)
+			r.Spec.ParentRefs = []parentReference{test.ref}
+			assert.Equal(t, test.expected, routeAttachesToListener(r, gw, l))
+		})
+	}
+}
+
+func TestShouldSyncUpdatedNode(t *testing.T) {
+	getNode := func(ready v1.ConditionStatus, labels map[string]string, providerID string) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node", Labels: labels},
+			Spec:       v1.NodeSpec{ProviderID: providerID},
+			Status: v1.NodeStatus{
+				Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: ready}},
+			},
+		}
+	}
+	oldNode := getNode(v1.ConditionTrue, map[string]string{"pool": "a"}, "azure:///vm")
+
+	testCases := []struct {
+		desc     string
+		newNode  *v1.Node
+		expected bool
+	}{
+		{
+			desc:    "should not sync if only the status heartbeat changes",
+			newNode: getNode(v1.ConditionTrue, map[string]string{"pool": "a"}, "azure:///vm"),
+		},
+		{
+			desc:     "should sync if the node becomes not ready",
+			newNode:  getNode(v1.ConditionFalse, map[string]string{"pool": "a"}, "azure:///vm"),
+			expected: true,
+		},
+		{
+			desc:     "should sync if the node is excluded from the load balancers",
+			newNode:  getNode(v1.ConditionTrue, map[string]string{"pool": "a", v1.LabelNodeExcludeBalancers: "true"}, "azure:///vm"),
+			expected: true,
+		},
+		{
+			desc:     "should sync if the labels change",
+			newNode:  getNode(v1.ConditionTrue, map[string]string{"pool": "b"}, "azure:///vm"),
+			expected: true,
+		},
+		{
+			desc:     "should sync if the provider ID changes",
+			newNode:  getNode(v1.ConditionTrue, map[string]string{"pool": "a"}, "azure:///vm2"),
+			expected: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			assert.Equal(t, test.expected, shouldSyncUpdatedNode(oldNode, test.newNode))
+		})
+	}
+}
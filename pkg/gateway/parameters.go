@@ -0,0 +1,120 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// Keys of the ConfigMap referenced by the parametersRef of a GatewayClass.
+const (
+	parameterInternal             = "internal"
+	parameterInternalSubnet       = "internalSubnet"
+	parameterPIPPrefixID          = "pipPrefixID"
+	parameterIdleTimeoutInMinutes = "idleTimeoutInMinutes"
+	parameterResourceGroup        = "resourceGroup"
+)
+
+// gatewayClassParameters are the typed equivalents of the service annotations which apply to all the
+// Gateways of a GatewayClass.
+type gatewayClassParameters struct {
+	// Internal determines if the Gateways use the internal load balancer.
+	Internal bool
+	// InternalSubnet is the subnet of the internal frontend IPs.
+	InternalSubnet string
+	// PIPPrefixID is the ID of the public IP prefix to allocate the public IPs from.
+	PIPPrefixID string
+	// IdleTimeoutInMinutes is the TCP idle timeout of the load balancing rules.
+	IdleTimeoutInMinutes *int32
+	// ResourceGroup is the resource group of the public IPs.
+	ResourceGroup string
+}
+
+// parseGatewayClassParameters parses the data of the parameters ConfigMap. Unknown keys are refused, so that a
+// typo does not silently fall back to the default.
+func parseGatewayClassParameters(data map[string]string) (*gatewayClassParameters, error) {
+	params := &gatewayClassParameters{}
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := data[key]
+		switch key {
+		case parameterInternal:
+			internal, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q: %w", key, value, err)
+			}
+			params.Internal = internal
+		case parameterInternalSubnet:
+			params.InternalSubnet = value
+		case parameterPIPPrefixID:
+			params.PIPPrefixID = value
+		case parameterIdleTimeoutInMinutes:
+			timeout, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q: %w", key, value, err)
+			}
+			if timeout < 4 || timeout > 100 {
+				return nil, fmt.Errorf("invalid %s %q: must be between 4 and 100", key, value)
+			}
+			params.IdleTimeoutInMinutes = pointer.Int32(int32(timeout))
+		case parameterResourceGroup:
+			params.ResourceGroup = value
+		default:
+			return nil, fmt.Errorf("unknown parameter %q", key)
+		}
+	}
+
+	if params.InternalSubnet != "" && !params.Internal {
+		return nil, fmt.Errorf("%s requires %s to be true", parameterInternalSubnet, parameterInternal)
+	}
+	if params.PIPPrefixID != "" && params.Internal {
+		return nil, fmt.Errorf("%s cannot be used with internal Gateways", parameterPIPPrefixID)
+	}
+	return params, nil
+}
+
+// annotations returns the service annotations equivalent to the parameters.
+func (p *gatewayClassParameters) annotations() map[string]string {
+	annotations := make(map[string]string)
+	if p.Internal {
+		annotations[consts.ServiceAnnotationLoadBalancerInternal] = consts.TrueAnnotationValue
+	}
+	if p.InternalSubnet != "" {
+		annotations[consts.ServiceAnnotationLoadBalancerInternalSubnet] = p.InternalSubnet
+	}
+	if p.PIPPrefixID != "" {
+		annotations[consts.ServiceAnnotationPIPPrefixID] = p.PIPPrefixID
+	}
+	if p.IdleTimeoutInMinutes != nil {
+		annotations[consts.ServiceAnnotationLoadBalancerIdleTimeout] = strconv.Itoa(int(*p.IdleTimeoutInMinutes))
+	}
+	if p.ResourceGroup != "" {
+		annotations[consts.ServiceAnnotationLoadBalancerResourceGroup] = p.ResourceGroup
+	}
+	return annotations
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestParseGatewayClassParameters(t *testing.T) {
+	testCases := []struct {
+		desc                string
+		data                map[string]string
+		expectedErr         bool
+		expectedAnnotations map[string]string
+	}{
+		{
+			desc:                "empty parameters should not set any annotation",
+			expectedAnnotations: map[string]string{},
+		},
+		{
+			desc: "internal parameters should be translated to the internal load balancer annotations",
+			data: map[string]string{
+				parameterInternal:             "true",
+				parameterInternalSubnet:       "subnet",
+				parameterIdleTimeoutInMinutes: "10",
+			},
+			expectedAnnotations: map[string]string{
+				consts.ServiceAnnotationLoadBalancerInternal:       "true",
+				consts.ServiceAnnotationLoadBalancerInternalSubnet: "subnet",
+				consts.ServiceAnnotationLoadBalancerIdleTimeout:    "10",
+			},
+		},
+		{
+			desc: "public parameters should be translated to the public IP annotations",
+			data: map[string]string{
+				parameterPIPPrefixID:   "prefix",
+				parameterResourceGroup: "rg",
+				parameterInternal:      "false",
+			},
+			expectedAnnotations: map[string]string{
+				consts.ServiceAnnotationPIPPrefixID:               "prefix",
+				consts.ServiceAnnotationLoadBalancerResourceGroup: "rg",
+			},
+		},
+		{
+			desc:        "unknown parameters should be refused",
+			data:        map[string]string{"internalSubnets": "subnet"},
+			expectedErr: true,
+		},
+		{
+			desc:        "invalid booleans should be refused",
+			data:        map[string]string{parameterInternal: "yes"},
+			expectedErr: true,
+		},
+		{
+			desc:        "idle timeouts out of range should be refused",
+			data:        map[string]string{parameterIdleTimeoutInMinutes: "3"},
+			expectedErr: true,
+		},
+		{
+			desc:        "internal subnets should require internal Gateways",
+			data:        map[string]string{parameterInternalSubnet: "subnet"},
+			expectedErr: true,
+		},
+		{
+			desc: "public IP prefixes should not be used with internal Gateways",
+			data: map[string]string{
+				parameterInternal:    "true",
+				parameterPIPPrefixID: "prefix",
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			params, err := parseGatewayClassParameters(test.data)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedAnnotations, params.annotations())
+		})
+	}
+}
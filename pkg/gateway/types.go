@@ -0,0 +1,187 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// The Gateway API objects are accessed with the dynamic client, and only the fields used by the controller
+// are decoded into the types below.
+
+const gatewayGroup = "gateway.networking.k8s.io"
+
+var (
+	// GatewayClassGVR is the resource of the GatewayClasses.
+	GatewayClassGVR = schema.GroupVersionResource{Group: gatewayGroup, Version: "v1beta1", Resource: "gatewayclasses"}
+	// GatewayGVR is the resource of the Gateways.
+	GatewayGVR = schema.GroupVersionResource{Group: gatewayGroup, Version: "v1beta1", Resource: "gateways"}
+	// TCPRouteGVR is the resource of the TCPRoutes.
+	TCPRouteGVR = schema.GroupVersionResource{Group: gatewayGroup, Version: "v1alpha2", Resource: "tcproutes"}
+	// UDPRouteGVR is the resource of the UDPRoutes.
+	UDPRouteGVR = schema.GroupVersionResource{Group: gatewayGroup, Version: "v1alpha2", Resource: "udproutes"}
+)
+
+const (
+	kindGateway   = "Gateway"
+	kindService   = "Service"
+	kindConfigMap = "ConfigMap"
+	kindTCPRoute  = "TCPRoute"
+	kindUDPRoute  = "UDPRoute"
+
+	protocolTCP = "TCP"
+	protocolUDP = "UDP"
+
+	addressTypeIPAddress = "IPAddress"
+)
+
+// Condition types and reasons of the Gateway API.
+const (
+	conditionAccepted     = "Accepted"
+	conditionProgrammed   = "Programmed"
+	conditionResolvedRefs = "ResolvedRefs"
+
+	reasonAccepted            = "Accepted"
+	reasonProgrammed          = "Programmed"
+	reasonInvalid             = "Invalid"
+	reasonInvalidParameters   = "InvalidParameters"
+	reasonPending             = "Pending"
+	reasonResolvedRefs        = "ResolvedRefs"
+	reasonBackendNotFound     = "BackendNotFound"
+	reasonUnsupportedProtocol = "UnsupportedProtocol"
+)
+
+type gatewayClass struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   gatewayClassSpec   `json:"spec"`
+	Status gatewayClassStatus `json:"status,omitempty"`
+}
+
+type gatewayClassSpec struct {
+	ControllerName string               `json:"controllerName"`
+	ParametersRef  *parametersReference `json:"parametersRef,omitempty"`
+}
+
+type parametersReference struct {
+	Group     string  `json:"group"`
+	Kind      string  `json:"kind"`
+	Name      string  `json:"name"`
+	Namespace *string `json:"namespace,omitempty"`
+}
+
+type gatewayClassStatus struct {
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+type gateway struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   gatewaySpec   `json:"spec"`
+	Status gatewayStatus `json:"status,omitempty"`
+}
+
+type gatewaySpec struct {
+	GatewayClassName string           `json:"gatewayClassName"`
+	Listeners        []listener       `json:"listeners"`
+	Addresses        []gatewayAddress `json:"addresses,omitempty"`
+}
+
+type listener struct {
+	Name     string `json:"name"`
+	Port     int32  `json:"port"`
+	Protocol string `json:"protocol"`
+}
+
+type gatewayAddress struct {
+	Type  *string `json:"type,omitempty"`
+	Value string  `json:"value"`
+}
+
+type gatewayStatus struct {
+	Addresses  []gatewayAddress   `json:"addresses,omitempty"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	Listeners  []listenerStatus   `json:"listeners,omitempty"`
+}
+
+type listenerStatus struct {
+	Name           string             `json:"name"`
+	SupportedKinds []routeGroupKind   `json:"supportedKinds"`
+	AttachedRoutes int32              `json:"attachedRoutes"`
+	Conditions     []metav1.Condition `json:"conditions"`
+}
+
+type routeGroupKind struct {
+	Group *string `json:"group,omitempty"`
+	Kind  string  `json:"kind"`
+}
+
+// route is either a TCPRoute or an UDPRoute, which share the same spec.
+type route struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec routeSpec `json:"spec"`
+}
+
+type routeSpec struct {
+	ParentRefs []parentReference `json:"parentRefs,omitempty"`
+	Rules      []routeRule       `json:"rules"`
+}
+
+type parentReference struct {
+	Group       *string `json:"group,omitempty"`
+	Kind        *string `json:"kind,omitempty"`
+	Namespace   *string `json:"namespace,omitempty"`
+	Name        string  `json:"name"`
+	SectionName *string `json:"sectionName,omitempty"`
+	Port        *int32  `json:"port,omitempty"`
+}
+
+type routeRule struct {
+	BackendRefs []backendReference `json:"backendRefs,omitempty"`
+}
+
+type backendReference struct {
+	Group     *string `json:"group,omitempty"`
+	Kind      *string `json:"kind,omitempty"`
+	Name      string  `json:"name"`
+	Namespace *string `json:"namespace,omitempty"`
+	Port      *int32  `json:"port,omitempty"`
+}
+
+// fromUnstructured decodes the unstructured object returned by the listers into obj.
+func fromUnstructured(in runtime.Object, obj interface{}) error {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(in)
+	if err != nil {
+		return err
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(u, obj)
+}
+
+func toUnstructured(obj interface{}) (*unstructured.Unstructured, error) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: u}, nil
+}
@@ -36,8 +36,12 @@ var (
 		"source",          // Operation source(optional)
 	}
 
-	apiMetrics       = registerAPIMetrics(metricLabels...)
-	operationMetrics = registerOperationMetrics(metricLabels...)
+	apiMetrics           = registerAPIMetrics(metricLabels...)
+	operationMetrics     = registerOperationMetrics(metricLabels...)
+	securityGroupMetrics = registerSecurityGroupMetrics("resource_group", "security_group")
+	privateLinkMetrics   = registerPrivateLinkServiceMetrics("resource_group", "private_link_service", "status")
+	publicIPPoolMetrics  = registerPublicIPPoolMetrics("resource_group")
+	ownershipMetrics     = registerOwnershipMetrics("resource_type", "kind")
 )
 
 // apiCallMetrics is the metrics measuring the performance of a single API call
@@ -56,6 +60,29 @@ type operationCallMetrics struct {
 	operationFailureCount *metrics.CounterVec
 }
 
+// securityGroupRuleMetrics is the metrics measuring the usage of the security rules in the security groups.
+type securityGroupRuleMetrics struct {
+	rules     *metrics.GaugeVec
+	ruleLimit *metrics.GaugeVec
+}
+
+// privateLinkServiceMetrics is the metrics measuring the private endpoint connections of the private link services.
+type privateLinkServiceMetrics struct {
+	connections *metrics.GaugeVec
+}
+
+// publicIPPoolLeaseMetrics is the metrics measuring the public IPs leased from the public IP pool.
+type publicIPPoolLeaseMetrics struct {
+	addresses       *metrics.GaugeVec
+	exhaustionCount *metrics.CounterVec
+}
+
+// ownershipManifestMetrics is the metrics measuring the subresources not owned by the cloud provider.
+type ownershipManifestMetrics struct {
+	foreignSkippedCount *metrics.CounterVec
+	overflowCount       *metrics.CounterVec
+}
+
 // MetricContext indicates the context for Azure client metrics.
 type MetricContext struct {
 	start      time.Time
@@ -120,6 +147,40 @@ func (mc *MetricContext) CountFailedOperation() {
 	operationMetrics.operationFailureCount.WithLabelValues(mc.attributes...).Inc()
 }
 
+// ObserveSecurityGroupRules records the number of security rules in the security group and the limit of the rules.
+func ObserveSecurityGroupRules(resourceGroup, securityGroup string, rules, ruleLimit int) {
+	securityGroupMetrics.rules.WithLabelValues(strings.ToLower(resourceGroup), securityGroup).Set(float64(rules))
+	securityGroupMetrics.ruleLimit.WithLabelValues(strings.ToLower(resourceGroup), securityGroup).Set(float64(ruleLimit))
+}
+
+// ObservePrivateEndpointConnections records the number of private endpoint connections in each status of the private link service.
+func ObservePrivateEndpointConnections(resourceGroup, privateLinkService string, connections map[string]int) {
+	for status, count := range connections {
+		privateLinkMetrics.connections.WithLabelValues(strings.ToLower(resourceGroup), privateLinkService, status).Set(float64(count))
+	}
+}
+
+// ObservePublicIPPool records the number of leased and available public IPs in the public IP pool.
+func ObservePublicIPPool(resourceGroup string, leased, available int) {
+	publicIPPoolMetrics.addresses.WithLabelValues(strings.ToLower(resourceGroup), "leased").Set(float64(leased))
+	publicIPPoolMetrics.addresses.WithLabelValues(strings.ToLower(resourceGroup), "available").Set(float64(available))
+}
+
+// CountPublicIPPoolExhausted increases the number of times a service could not lease a public IP from the exhausted pool.
+func CountPublicIPPoolExhausted(resourceGroup string) {
+	publicIPPoolMetrics.exhaustionCount.WithLabelValues(strings.ToLower(resourceGroup)).Inc()
+}
+
+// CountForeignResourceSkipped increases the number of subresources skipped since they are not owned by the cloud provider.
+func CountForeignResourceSkipped(resourceType, kind string) {
+	ownershipMetrics.foreignSkippedCount.WithLabelValues(resourceType, kind).Inc()
+}
+
+// CountOwnershipManifestOverflow increases the number of ownership manifests not fitting in the tags of the resources.
+func CountOwnershipManifestOverflow(resourceType string) {
+	ownershipMetrics.overflowCount.WithLabelValues(resourceType).Inc()
+}
+
 // registerAPIMetrics registers the API metrics.
 func registerAPIMetrics(attributes ...string) *apiCallMetrics {
 	metrics := &apiCallMetrics{
@@ -199,3 +260,109 @@ func registerOperationMetrics(attributes ...string) *operationCallMetrics {
 
 	return metrics
 }
+
+// registerSecurityGroupMetrics registers the security group metrics.
+func registerSecurityGroupMetrics(attributes ...string) *securityGroupRuleMetrics {
+	metrics := &securityGroupRuleMetrics{
+		rules: metrics.NewGaugeVec(
+			&metrics.GaugeOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "security_group_rules",
+				Help:           "Number of security rules in an Azure network security group",
+				StabilityLevel: metrics.ALPHA,
+			},
+			attributes,
+		),
+		ruleLimit: metrics.NewGaugeVec(
+			&metrics.GaugeOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "security_group_rule_limit",
+				Help:           "Maximum number of security rules in an Azure network security group",
+				StabilityLevel: metrics.ALPHA,
+			},
+			attributes,
+		),
+	}
+
+	legacyregistry.MustRegister(metrics.rules)
+	legacyregistry.MustRegister(metrics.ruleLimit)
+
+	return metrics
+}
+
+// registerPrivateLinkServiceMetrics registers the private link service metrics.
+func registerPrivateLinkServiceMetrics(attributes ...string) *privateLinkServiceMetrics {
+	metrics := &privateLinkServiceMetrics{
+		connections: metrics.NewGaugeVec(
+			&metrics.GaugeOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "private_endpoint_connections",
+				Help:           "Number of private endpoint connections of an Azure private link service by status",
+				StabilityLevel: metrics.ALPHA,
+			},
+			attributes,
+		),
+	}
+
+	legacyregistry.MustRegister(metrics.connections)
+
+	return metrics
+}
+
+// registerPublicIPPoolMetrics registers the public IP pool metrics.
+func registerPublicIPPoolMetrics(attributes ...string) *publicIPPoolLeaseMetrics {
+	metrics := &publicIPPoolLeaseMetrics{
+		addresses: metrics.NewGaugeVec(
+			&metrics.GaugeOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "public_ip_pool_addresses",
+				Help:           "Number of public IPs in the public IP pool by status",
+				StabilityLevel: metrics.ALPHA,
+			},
+			append(attributes, "status"),
+		),
+		exhaustionCount: metrics.NewCounterVec(
+			&metrics.CounterOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "public_ip_pool_exhausted_count",
+				Help:           "Number of times a service could not lease a public IP from the exhausted public IP pool",
+				StabilityLevel: metrics.ALPHA,
+			},
+			attributes,
+		),
+	}
+
+	legacyregistry.MustRegister(metrics.addresses)
+	legacyregistry.MustRegister(metrics.exhaustionCount)
+
+	return metrics
+}
+
+// registerOwnershipMetrics registers the ownership manifest metrics.
+func registerOwnershipMetrics(attributes ...string) *ownershipManifestMetrics {
+	metrics := &ownershipManifestMetrics{
+		foreignSkippedCount: metrics.NewCounterVec(
+			&metrics.CounterOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "foreign_resources_skipped_count",
+				Help:           "Number of times a subresource not owned by the cloud provider was skipped in the reconciliation",
+				StabilityLevel: metrics.ALPHA,
+			},
+			attributes,
+		),
+		overflowCount: metrics.NewCounterVec(
+			&metrics.CounterOpts{
+				Namespace:      consts.AzureMetricsNamespace,
+				Name:           "ownership_manifest_overflow_count",
+				Help:           "Number of times an ownership manifest did not fit in the tags of the resource",
+				StabilityLevel: metrics.ALPHA,
+			},
+			attributes[:1],
+		),
+	}
+
+	legacyregistry.MustRegister(metrics.foreignSkippedCount)
+	legacyregistry.MustRegister(metrics.overflowCount)
+
+	return metrics
+}
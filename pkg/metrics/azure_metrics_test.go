@@ -24,6 +24,7 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/stretchr/testify/assert"
 
+	"k8s.io/component-base/metrics/testutil"
 	"k8s.io/klog/v2"
 )
 
@@ -112,3 +113,59 @@ func TestAzureMetricResultCode(t *testing.T) {
 		assert.Equal(t, tc.expectedResutCode, fakeLogger.infoBuffer.String())
 	}
 }
+
+func TestObserveSecurityGroupRules(t *testing.T) {
+	ObserveSecurityGroupRules("RG", "nsg", 10, 1000)
+	ObserveSecurityGroupRules("RG", "nsg", 12, 1000)
+
+	rules, err := testutil.GetGaugeMetricValue(securityGroupMetrics.rules.WithLabelValues("rg", "nsg"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(12), rules)
+	ruleLimit, err := testutil.GetGaugeMetricValue(securityGroupMetrics.ruleLimit.WithLabelValues("rg", "nsg"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1000), ruleLimit)
+}
+
+func TestObservePrivateEndpointConnections(t *testing.T) {
+	ObservePrivateEndpointConnections("RG", "pls", map[string]int{"Approved": 2, "Pending": 1})
+	ObservePrivateEndpointConnections("RG", "pls", map[string]int{"Approved": 3, "Pending": 0})
+
+	approved, err := testutil.GetGaugeMetricValue(privateLinkMetrics.connections.WithLabelValues("rg", "pls", "Approved"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(3), approved)
+	pending, err := testutil.GetGaugeMetricValue(privateLinkMetrics.connections.WithLabelValues("rg", "pls", "Pending"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(0), pending)
+}
+
+func TestObservePublicIPPool(t *testing.T) {
+	ObservePublicIPPool("RG", 2, 1)
+	CountPublicIPPoolExhausted("RG")
+
+	leased, err := testutil.GetGaugeMetricValue(publicIPPoolMetrics.addresses.WithLabelValues("rg", "leased"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2), leased)
+	available, err := testutil.GetGaugeMetricValue(publicIPPoolMetrics.addresses.WithLabelValues("rg", "available"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), available)
+	exhausted, err := testutil.GetCounterMetricValue(publicIPPoolMetrics.exhaustionCount.WithLabelValues("rg"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), exhausted)
+}
+
+func TestCountForeignResourceSkipped(t *testing.T) {
+	CountForeignResourceSkipped("load_balancer", "rule")
+	CountForeignResourceSkipped("load_balancer", "rule")
+
+	skipped, err := testutil.GetCounterMetricValue(ownershipMetrics.foreignSkippedCount.WithLabelValues("load_balancer", "rule"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2), skipped)
+}
+
+func TestCountOwnershipManifestOverflow(t *testing.T) {
+	CountOwnershipManifestOverflow("security_group")
+
+	overflows, err := testutil.GetCounterMetricValue(ownershipMetrics.overflowCount.WithLabelValues("security_group"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), overflows)
+}
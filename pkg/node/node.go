@@ -25,6 +25,7 @@ import (
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
 
+	"sigs.k8s.io/cloud-provider-azure/pkg/nodemanager/metadata"
 	azureprovider "sigs.k8s.io/cloud-provider-azure/pkg/provider"
 )
 
@@ -83,3 +84,18 @@ func (np *IMDSNodeProvider) GetZone(ctx context.Context, name types.NodeName) (c
 func (np *IMDSNodeProvider) GetPlatformSubFaultDomain() (string, error) {
 	return np.azure.GetPlatformSubFaultDomain()
 }
+
+// GetNodeMetadata returns the Azure metadata of the specified instance synced into the node labels and taints.
+func (np *IMDSNodeProvider) GetNodeMetadata(ctx context.Context, name types.NodeName) (*metadata.NodeMetadata, error) {
+	return np.azure.GetNodeMetadata(ctx, name)
+}
+
+// GetScheduledEvents returns the scheduled events of the instance the program is running in from IMDS.
+func (np *IMDSNodeProvider) GetScheduledEvents() ([]metadata.ScheduledEvent, error) {
+	return np.azure.GetScheduledEvents()
+}
+
+// AcknowledgeScheduledEvent approves the scheduled event, so that it starts immediately.
+func (np *IMDSNodeProvider) AcknowledgeScheduledEvent(eventID string) error {
+	return np.azure.AcknowledgeScheduledEvent(eventID)
+}
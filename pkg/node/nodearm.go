@@ -26,6 +26,7 @@ import (
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
 
+	"sigs.k8s.io/cloud-provider-azure/pkg/nodemanager/metadata"
 	azureprovider "sigs.k8s.io/cloud-provider-azure/pkg/provider"
 )
 
@@ -102,3 +103,18 @@ func (np *ARMNodeProvider) GetZone(ctx context.Context, name types.NodeName) (cl
 func (np *ARMNodeProvider) GetPlatformSubFaultDomain() (string, error) {
 	return "", nil
 }
+
+// GetNodeMetadata returns the Azure metadata of the specified instance synced into the node labels and taints.
+func (np *ARMNodeProvider) GetNodeMetadata(ctx context.Context, name types.NodeName) (*metadata.NodeMetadata, error) {
+	return np.azure.GetNodeMetadata(ctx, name)
+}
+
+// GetScheduledEvents returns the scheduled events of the instance the program is running in from IMDS.
+func (np *ARMNodeProvider) GetScheduledEvents() ([]metadata.ScheduledEvent, error) {
+	return np.azure.GetScheduledEvents()
+}
+
+// AcknowledgeScheduledEvent approves the scheduled event, so that it starts immediately.
+func (np *ARMNodeProvider) AcknowledgeScheduledEvent(eventID string) error {
+	return np.azure.AcknowledgeScheduledEvent(eventID)
+}
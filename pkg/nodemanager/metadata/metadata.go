@@ -0,0 +1,59 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metadata defines the Azure metadata of the nodes synced by the cloud node manager.
+package metadata
+
+// NodeMetadata is the Azure metadata of a node, which can be synced into the node labels and taints.
+type NodeMetadata struct {
+	// Tags are the tags of the VM, merged with the tags of the VMSS.
+	Tags map[string]string
+	// Priority is the priority of the VM, i.e. Regular, Low or Spot.
+	Priority string
+	// HostGroup is the name of the dedicated host group of the VM.
+	HostGroup string
+	// DedicatedHost is the name of the dedicated host of the VM.
+	DedicatedHost string
+	// ProximityPlacementGroup is the name of the proximity placement group of the VM.
+	ProximityPlacementGroup string
+	// AcceleratedNetworking indicates whether accelerated networking is enabled on the primary NIC, nil if unknown.
+	AcceleratedNetworking *bool
+	// EphemeralOSDisk indicates whether the VM runs on an ephemeral OS disk, nil if unknown.
+	EphemeralOSDisk *bool
+}
+
+// ScheduledEvents is the document of the scheduled events returned by IMDS.
+type ScheduledEvents struct {
+	DocumentIncarnation int              `json:"DocumentIncarnation"`
+	Events              []ScheduledEvent `json:"Events"`
+}
+
+// ScheduledEvent is an upcoming maintenance event of the VMs, e.g. the eviction of a Spot VM.
+type ScheduledEvent struct {
+	EventID   string `json:"EventId"`
+	EventType string `json:"EventType"`
+	// ResourceType is always "VirtualMachine".
+	ResourceType string `json:"ResourceType"`
+	// Resources are the names of the VMs impacted by the event.
+	Resources []string `json:"Resources"`
+	// EventStatus is either Scheduled or Started.
+	EventStatus string `json:"EventStatus"`
+	// NotBefore is the time in RFC 1123 after which the event may start, empty once the event is started.
+	NotBefore         string `json:"NotBefore"`
+	Description       string `json:"Description"`
+	EventSource       string `json:"EventSource"`
+	DurationInSeconds int    `json:"DurationInSeconds"`
+}
@@ -24,6 +24,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 	types "k8s.io/apimachinery/pkg/types"
 	cloudprovider "k8s.io/cloud-provider"
+	metadata "sigs.k8s.io/cloud-provider-azure/pkg/nodemanager/metadata"
 )
 
 // NodeProvider is a mock of NodeProvider interface.
@@ -49,6 +50,35 @@ func (m *NodeProvider) EXPECT() *NodeProviderMockRecorder {
 	return m.recorder
 }
 
+// AcknowledgeScheduledEvent mocks base method.
+func (m *NodeProvider) AcknowledgeScheduledEvent(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AcknowledgeScheduledEvent", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AcknowledgeScheduledEvent indicates an expected call of AcknowledgeScheduledEvent.
+func (mr *NodeProviderMockRecorder) AcknowledgeScheduledEvent(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcknowledgeScheduledEvent", reflect.TypeOf((*NodeProvider)(nil).AcknowledgeScheduledEvent), arg0)
+}
+
+// GetNodeMetadata mocks base method.
+func (m *NodeProvider) GetNodeMetadata(arg0 context.Context, arg1 types.NodeName) (*metadata.NodeMetadata, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetNodeMetadata", arg0, arg1)
+	ret0, _ := ret[0].(*metadata.NodeMetadata)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetNodeMetadata indicates an expected call of GetNodeMetadata.
+func (mr *NodeProviderMockRecorder) GetNodeMetadata(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNodeMetadata", reflect.TypeOf((*NodeProvider)(nil).GetNodeMetadata), arg0, arg1)
+}
+
 // GetPlatformSubFaultDomain mocks base method.
 func (m *NodeProvider) GetPlatformSubFaultDomain() (string, error) {
 	m.ctrl.T.Helper()
@@ -64,6 +94,21 @@ func (mr *NodeProviderMockRecorder) GetPlatformSubFaultDomain() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPlatformSubFaultDomain", reflect.TypeOf((*NodeProvider)(nil).GetPlatformSubFaultDomain))
 }
 
+// GetScheduledEvents mocks base method.
+func (m *NodeProvider) GetScheduledEvents() ([]metadata.ScheduledEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetScheduledEvents")
+	ret0, _ := ret[0].([]metadata.ScheduledEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetScheduledEvents indicates an expected call of GetScheduledEvents.
+func (mr *NodeProviderMockRecorder) GetScheduledEvents() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetScheduledEvents", reflect.TypeOf((*NodeProvider)(nil).GetScheduledEvents))
+}
+
 // GetZone mocks base method.
 func (m *NodeProvider) GetZone(arg0 context.Context, arg1 types.NodeName) (cloudprovider.Zone, error) {
 	m.ctrl.T.Helper()
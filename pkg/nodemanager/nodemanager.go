@@ -46,6 +46,7 @@ import (
 	"k8s.io/klog/v2"
 
 	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/nodemanager/metadata"
 )
 
 // NodeProvider defines the interfaces for node provider.
@@ -60,6 +61,12 @@ type NodeProvider interface {
 	GetZone(ctx context.Context, name types.NodeName) (cloudprovider.Zone, error)
 	// GetPlatformSubFaultDomain returns the PlatformSubFaultDomain from IMDS if set.
 	GetPlatformSubFaultDomain() (string, error)
+	// GetNodeMetadata returns the Azure metadata of the specified instance synced into the node labels and taints.
+	GetNodeMetadata(ctx context.Context, name types.NodeName) (*metadata.NodeMetadata, error)
+	// GetScheduledEvents returns the scheduled events of the instance the program is running in.
+	GetScheduledEvents() ([]metadata.ScheduledEvent, error)
+	// AcknowledgeScheduledEvent approves the scheduled event, so that it starts immediately.
+	AcknowledgeScheduledEvent(eventID string) error
 }
 
 // labelReconcileInfo lists Node labels to reconcile, and how to reconcile them.
@@ -95,6 +102,11 @@ type CloudNodeController struct {
 	nodeInformer  coreinformers.NodeInformer
 	kubeClient    clientset.Interface
 	recorder      record.EventRecorder
+	metadataSync  NodeMetadataSync
+
+	scheduledEvents ScheduledEventsConfig
+	// acknowledgedEventID is the last scheduled event acknowledged.
+	acknowledgedEventID string
 
 	nodeStatusUpdateFrequency time.Duration
 }
@@ -106,7 +118,9 @@ func NewCloudNodeController(
 	kubeClient clientset.Interface,
 	nodeProvider NodeProvider,
 	nodeStatusUpdateFrequency time.Duration,
-	waitForRoutes bool) *CloudNodeController {
+	waitForRoutes bool,
+	metadataSync NodeMetadataSync,
+	scheduledEvents ScheduledEventsConfig) *CloudNodeController {
 
 	eventBroadcaster := record.NewBroadcaster()
 	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "cloud-node-controller"})
@@ -125,6 +139,8 @@ func NewCloudNodeController(
 		recorder:                  recorder,
 		nodeProvider:              nodeProvider,
 		waitForRoutes:             waitForRoutes,
+		metadataSync:              metadataSync,
+		scheduledEvents:           scheduledEvents,
 		nodeStatusUpdateFrequency: nodeStatusUpdateFrequency,
 	}
 
@@ -148,6 +164,11 @@ func (cnc *CloudNodeController) Run(stopCh <-chan struct{}) {
 	// of O(num_nodes) per cycle. These functions are justified here because these events fire
 	// very infrequently. DO NOT MODIFY this to perform frequent operations.
 
+	// Start a loop to poll the scheduled events of the node, which may only be noticed 30 seconds in advance
+	if cnc.scheduledEvents.Enabled {
+		go wait.Until(func() { cnc.syncScheduledEvents(context.TODO()) }, cnc.scheduledEvents.PollInterval, stopCh)
+	}
+
 	// Start a loop to periodically update the node addresses obtained from the cloud
 	wait.Until(func() { cnc.UpdateNodeStatus(context.TODO()) }, cnc.nodeStatusUpdateFrequency, stopCh)
 }
@@ -174,6 +195,11 @@ func (cnc *CloudNodeController) UpdateNodeStatus(ctx context.Context) {
 	if err != nil {
 		klog.Errorf("Error reconciling node labels for node %q, err: %v", node.Name, err)
 	}
+
+	err = cnc.reconcileNodeMetadata(ctx, node)
+	if err != nil {
+		klog.Errorf("Error reconciling node metadata for node %q, err: %v", node.Name, err)
+	}
 }
 
 // reconcileNodeLabels reconciles node labels transitioning from beta to GA
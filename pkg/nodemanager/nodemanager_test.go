@@ -190,7 +190,9 @@ func TestNodeInitialized(t *testing.T) {
 		fnh,
 		mockNP,
 		time.Second,
-		false)
+		false,
+		NodeMetadataSync{},
+		ScheduledEventsConfig{})
 
 	cloudNodeController.AddCloudNode(ctx, fnh.Existing[0])
 
@@ -268,7 +270,9 @@ func TestUpdateCloudNode(t *testing.T) {
 		fnh,
 		mockNP,
 		time.Second,
-		true)
+		true,
+		NodeMetadataSync{},
+		ScheduledEventsConfig{})
 	eventBroadcaster.StartLogging(klog.Infof)
 
 	cloudNodeController.UpdateCloudNode(ctx, fnh.Existing[0], fnh.Existing[0])
@@ -319,7 +323,9 @@ func TestNodeIgnored(t *testing.T) {
 		fnh,
 		mockNP,
 		time.Second,
-		false)
+		false,
+		NodeMetadataSync{},
+		ScheduledEventsConfig{})
 	eventBroadcaster.StartLogging(klog.Infof)
 
 	cloudNodeController.AddCloudNode(context.TODO(), fnh.Existing[0])
@@ -491,7 +497,9 @@ func TestAddCloudNode(t *testing.T) {
 		fnh,
 		mockNP,
 		time.Second,
-		false)
+		false,
+		NodeMetadataSync{},
+		ScheduledEventsConfig{})
 	factory.Start(ctx.Done())
 	cache.WaitForCacheSync(ctx.Done(), nodeInformer.Informer().HasSynced)
 
@@ -550,7 +558,9 @@ func TestUpdateNodeAddresses(t *testing.T) {
 		fnh,
 		mockNP,
 		time.Second,
-		false)
+		false,
+		NodeMetadataSync{},
+		ScheduledEventsConfig{})
 	factory.Start(ctx.Done())
 	cache.WaitForCacheSync(ctx.Done(), nodeInformer.Informer().HasSynced)
 
@@ -651,7 +661,9 @@ func TestNodeProvidedIPAddresses(t *testing.T) {
 		fnh,
 		mockNP,
 		time.Second,
-		false)
+		false,
+		NodeMetadataSync{},
+		ScheduledEventsConfig{})
 	eventBroadcaster.StartLogging(klog.Infof)
 
 	cloudNodeController.AddCloudNode(context.TODO(), fnh.Existing[0])
@@ -0,0 +1,259 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodemanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/nodemanager/metadata"
+)
+
+// NodeMetadataSync configures how the Azure metadata of the node is synced into the node labels and taints.
+type NodeMetadataSync struct {
+	// TagLabels maps the names of the VM or VMSS tags to the node label keys.
+	TagLabels map[string]string
+	// EnableMetadataLabels enables the well-known labels of the priority, dedicated host, proximity
+	// placement group, accelerated networking and ephemeral OS disk of the VM.
+	EnableMetadataLabels bool
+	// Taints maps the synced label keys to the taints of the nodes whose labels have the values of the taints.
+	Taints map[string]NodeMetadataTaint
+}
+
+// NodeMetadataTaint is the taint of the nodes with a synced label. The taint has the key of the label.
+type NodeMetadataTaint struct {
+	// Value is the value of the label of the tainted nodes, and the value of the taint.
+	Value string
+	// Effect is the effect of the taint.
+	Effect v1.TaintEffect
+}
+
+// ParseNodeMetadataTaint parses the taint in the format of "value:effect".
+func ParseNodeMetadataTaint(s string) (NodeMetadataTaint, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return NodeMetadataTaint{}, fmt.Errorf("invalid taint %q: the format should be value:effect", s)
+	}
+	return NodeMetadataTaint{Value: parts[0], Effect: v1.TaintEffect(parts[1])}, nil
+}
+
+var metadataLabelKeys = []string{
+	consts.LabelScaleSetPriority,
+	consts.LabelHostGroup,
+	consts.LabelDedicatedHost,
+	consts.LabelProximityPlacementGroup,
+	consts.LabelAcceleratedNetworking,
+	consts.LabelEphemeralOSDisk,
+}
+
+// Enabled returns true if any label is synced from the Azure metadata.
+func (s *NodeMetadataSync) Enabled() bool {
+	return len(s.TagLabels) > 0 || s.EnableMetadataLabels
+}
+
+// Validate checks the label keys and the taint effects.
+func (s *NodeMetadataSync) Validate() error {
+	managedKeys := s.managedLabelKeys()
+	for _, key := range managedKeys {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid node label key %q: %s", key, strings.Join(errs, "; "))
+		}
+	}
+	for key, taint := range s.Taints {
+		if !stringInSlice(key, managedKeys) {
+			return fmt.Errorf("the taint %q should be one of the synced node labels", key)
+		}
+		if taint.Value == "" {
+			return fmt.Errorf("the value of the taint %q should not be empty", key)
+		}
+		if errs := validation.IsValidLabelValue(taint.Value); len(errs) > 0 {
+			return fmt.Errorf("invalid value %q of the taint %q: %s", taint.Value, key, strings.Join(errs, "; "))
+		}
+		switch taint.Effect {
+		case v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute:
+		default:
+			return fmt.Errorf("invalid effect %q of the taint %q", taint.Effect, key)
+		}
+	}
+	return nil
+}
+
+// managedLabelKeys returns the keys of the labels synced from the Azure metadata. These labels are
+// removed from the node if the metadata is gone.
+func (s *NodeMetadataSync) managedLabelKeys() []string {
+	var keys []string
+	for _, key := range s.TagLabels {
+		keys = append(keys, key)
+	}
+	if s.EnableMetadataLabels {
+		keys = append(keys, metadataLabelKeys...)
+	}
+	return keys
+}
+
+// getLabels returns the node labels of the Azure metadata. The values which are not valid label
+// values are skipped.
+func (s *NodeMetadataSync) getLabels(nodeMetadata *metadata.NodeMetadata) map[string]string {
+	labels := make(map[string]string)
+	setLabel := func(key, value string) {
+		if value == "" {
+			return
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			klog.Warningf("getLabels: skipping the node label %s=%s: %s", key, value, strings.Join(errs, "; "))
+			return
+		}
+		labels[key] = value
+	}
+
+	for tagName, key := range s.TagLabels {
+		for name, value := range nodeMetadata.Tags {
+			if strings.EqualFold(name, tagName) {
+				setLabel(key, value)
+				break
+			}
+		}
+	}
+	if s.EnableMetadataLabels {
+		setLabel(consts.LabelScaleSetPriority, strings.ToLower(nodeMetadata.Priority))
+		setLabel(consts.LabelHostGroup, nodeMetadata.HostGroup)
+		setLabel(consts.LabelDedicatedHost, nodeMetadata.DedicatedHost)
+		setLabel(consts.LabelProximityPlacementGroup, nodeMetadata.ProximityPlacementGroup)
+		if nodeMetadata.AcceleratedNetworking != nil {
+			setLabel(consts.LabelAcceleratedNetworking, strconv.FormatBool(*nodeMetadata.AcceleratedNetworking))
+		}
+		if nodeMetadata.EphemeralOSDisk != nil {
+			setLabel(consts.LabelEphemeralOSDisk, strconv.FormatBool(*nodeMetadata.EphemeralOSDisk))
+		}
+	}
+	return labels
+}
+
+// reconcileNodeMetadata syncs the Azure metadata of the node into the node labels and taints. Only the
+// configured labels and taints are changed.
+func (cnc *CloudNodeController) reconcileNodeMetadata(ctx context.Context, node *v1.Node) error {
+	if !cnc.metadataSync.Enabled() {
+		return nil
+	}
+
+	nodeMetadata, err := cnc.nodeProvider.GetNodeMetadata(ctx, types.NodeName(node.Name))
+	if err != nil {
+		return fmt.Errorf("GetNodeMetadata: Error fetching by NodeName %s: %w", node.Name, err)
+	}
+	labels := cnc.metadataSync.getLabels(nodeMetadata)
+
+	modify := func(n *v1.Node) {
+		if n.Labels == nil {
+			n.Labels = map[string]string{}
+		}
+		for _, key := range cnc.metadataSync.managedLabelKeys() {
+			if value, found := labels[key]; found {
+				n.Labels[key] = value
+			} else {
+				delete(n.Labels, key)
+			}
+		}
+
+		var taints []v1.Taint
+		for _, taint := range n.Spec.Taints {
+			if _, found := cnc.metadataSync.Taints[taint.Key]; !found {
+				taints = append(taints, taint)
+			}
+		}
+		for key, taint := range cnc.metadataSync.Taints {
+			if value, found := labels[key]; found && value == taint.Value {
+				taints = append(taints, v1.Taint{Key: key, Value: value, Effect: taint.Effect})
+			}
+		}
+		n.Spec.Taints = taints
+	}
+
+	newNode := node.DeepCopy()
+	modify(newNode)
+	if equalStringMaps(node.Labels, newNode.Labels) && equalTaints(node.Spec.Taints, newNode.Spec.Taints) {
+		return nil
+	}
+
+	return cnc.patchNode(ctx, node, modify)
+}
+
+func preparePatchBytesforNode(oldNode, newNode *v1.Node) ([]byte, error) {
+	oldData, err := json.Marshal(oldNode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to Marshal oldData for node %q: %w", oldNode.Name, err)
+	}
+	newData, err := json.Marshal(newNode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to Marshal newData for node %q: %w", oldNode.Name, err)
+	}
+	patchBytes, err := strategicpatch.CreateTwoWayMergePatch(oldData, newData, v1.Node{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to CreateTwoWayMergePatch for node %q: %w", oldNode.Name, err)
+	}
+	return patchBytes, nil
+}
+
+func equalStringMaps(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if value, found := b[k]; !found || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// equalTaints compares the taints regardless of their order.
+func equalTaints(a, b []v1.Taint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		var found bool
+		for j := range b {
+			if a[i].MatchTaint(&b[j]) && a[i].Value == b[j].Value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func stringInSlice(s string, list []string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
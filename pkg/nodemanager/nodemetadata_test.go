@@ -0,0 +1,194 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodemanager
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/nodemanager/metadata"
+	mocknodeprovider "sigs.k8s.io/cloud-provider-azure/pkg/nodemanager/mock"
+)
+
+func TestNodeMetadataSyncValidate(t *testing.T) {
+	for _, tc := range []struct {
+		desc        string
+		sync        NodeMetadataSync
+		expectedErr bool
+	}{
+		{
+			desc: "valid labels and taints",
+			sync: NodeMetadataSync{
+				TagLabels:            map[string]string{"team": "example.com/team"},
+				EnableMetadataLabels: true,
+				Taints:               map[string]NodeMetadataTaint{consts.LabelScaleSetPriority: {Value: "spot", Effect: v1.TaintEffectNoSchedule}},
+			},
+		},
+		{
+			desc:        "invalid label key",
+			sync:        NodeMetadataSync{TagLabels: map[string]string{"team": "example.com/team/name"}},
+			expectedErr: true,
+		},
+		{
+			desc: "taint of a label not synced",
+			sync: NodeMetadataSync{
+				TagLabels: map[string]string{"team": "example.com/team"},
+				Taints:    map[string]NodeMetadataTaint{consts.LabelScaleSetPriority: {Value: "spot", Effect: v1.TaintEffectNoSchedule}},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "taint without value",
+			sync: NodeMetadataSync{
+				EnableMetadataLabels: true,
+				Taints:               map[string]NodeMetadataTaint{consts.LabelScaleSetPriority: {Effect: v1.TaintEffectNoSchedule}},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "invalid taint effect",
+			sync: NodeMetadataSync{
+				EnableMetadataLabels: true,
+				Taints:               map[string]NodeMetadataTaint{consts.LabelScaleSetPriority: {Value: "spot", Effect: "Evict"}},
+			},
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.expectedErr, tc.sync.Validate() != nil)
+		})
+	}
+}
+
+func TestParseNodeMetadataTaint(t *testing.T) {
+	taint, err := ParseNodeMetadataTaint("spot:NoSchedule")
+	assert.NoError(t, err)
+	assert.Equal(t, NodeMetadataTaint{Value: "spot", Effect: v1.TaintEffectNoSchedule}, taint)
+
+	_, err = ParseNodeMetadataTaint("NoSchedule")
+	assert.Error(t, err)
+}
+
+func TestReconcileNodeMetadata(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.TODO()
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node0",
+			Labels: map[string]string{
+				"example.com/team":                  "old",
+				consts.LabelProximityPlacementGroup: "ppg",
+				"foo":                               "bar",
+			},
+		},
+		Spec: v1.NodeSpec{
+			Taints: []v1.Taint{{Key: "foo", Value: "bar", Effect: v1.TaintEffectNoSchedule}},
+		},
+	}
+	client := fake.NewSimpleClientset(node)
+	mockNP := mocknodeprovider.NewMockNodeProvider(ctrl)
+	mockNP.EXPECT().GetNodeMetadata(ctx, types.NodeName("node0")).Return(&metadata.NodeMetadata{
+		Tags:            map[string]string{"Team": "infra", "env": "invalid value"},
+		Priority:        "Spot",
+		DedicatedHost:   "host",
+		HostGroup:       "hostgroup",
+		EphemeralOSDisk: pointer.Bool(true),
+	}, nil).Times(2)
+
+	cnc := &CloudNodeController{
+		kubeClient:   client,
+		nodeProvider: mockNP,
+		metadataSync: NodeMetadataSync{
+			TagLabels:            map[string]string{"team": "example.com/team", "env": "example.com/env"},
+			EnableMetadataLabels: true,
+			Taints:               map[string]NodeMetadataTaint{consts.LabelScaleSetPriority: {Value: "spot", Effect: v1.TaintEffectNoSchedule}},
+		},
+	}
+	assert.NoError(t, cnc.reconcileNodeMetadata(ctx, node))
+
+	updatedNode, err := client.CoreV1().Nodes().Get(ctx, "node0", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"example.com/team":           "infra",
+		consts.LabelScaleSetPriority: "spot",
+		consts.LabelHostGroup:        "hostgroup",
+		consts.LabelDedicatedHost:    "host",
+		consts.LabelEphemeralOSDisk:  "true",
+		"foo":                        "bar",
+	}, updatedNode.Labels)
+	assert.ElementsMatch(t, []v1.Taint{
+		{Key: "foo", Value: "bar", Effect: v1.TaintEffectNoSchedule},
+		{Key: consts.LabelScaleSetPriority, Value: "spot", Effect: v1.TaintEffectNoSchedule},
+	}, updatedNode.Spec.Taints)
+
+	// The node is not patched again if nothing is changed.
+	client.ClearActions()
+	assert.NoError(t, cnc.reconcileNodeMetadata(ctx, updatedNode))
+	assert.Empty(t, client.Actions())
+}
+
+func TestReconcileNodeMetadataTaintValue(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.TODO()
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node0"},
+		Spec: v1.NodeSpec{
+			Taints: []v1.Taint{{Key: consts.LabelScaleSetPriority, Value: "spot", Effect: v1.TaintEffectNoSchedule}},
+		},
+	}
+	client := fake.NewSimpleClientset(node)
+	mockNP := mocknodeprovider.NewMockNodeProvider(ctrl)
+	mockNP.EXPECT().GetNodeMetadata(ctx, types.NodeName("node0")).Return(&metadata.NodeMetadata{Priority: "Regular"}, nil)
+
+	cnc := &CloudNodeController{
+		kubeClient:   client,
+		nodeProvider: mockNP,
+		metadataSync: NodeMetadataSync{
+			EnableMetadataLabels: true,
+			Taints:               map[string]NodeMetadataTaint{consts.LabelScaleSetPriority: {Value: "spot", Effect: v1.TaintEffectNoSchedule}},
+		},
+	}
+	assert.NoError(t, cnc.reconcileNodeMetadata(ctx, node))
+
+	// The regular node is labeled but not tainted.
+	updatedNode, err := client.CoreV1().Nodes().Get(ctx, "node0", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{consts.LabelScaleSetPriority: "regular"}, updatedNode.Labels)
+	assert.Empty(t, updatedNode.Spec.Taints)
+}
+
+func TestReconcileNodeMetadataDisabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cnc := &CloudNodeController{nodeProvider: mocknodeprovider.NewMockNodeProvider(ctrl)}
+	assert.NoError(t, cnc.reconcileNodeMetadata(context.TODO(), &v1.Node{}))
+}
@@ -0,0 +1,311 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodemanager
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	clientretry "k8s.io/client-go/util/retry"
+	nodeutil "k8s.io/component-helpers/node/util"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/nodemanager/metadata"
+)
+
+const (
+	scheduledEventStatusScheduled = "Scheduled"
+
+	// mirrorPodAnnotation is the annotation of the static pods created by kubelet.
+	mirrorPodAnnotation = "kubernetes.io/config.mirror"
+)
+
+// disruptiveScheduledEventTypes are the scheduled events which stop the VM. The Freeze events only pause
+// the VM for a few seconds, so they are ignored.
+var disruptiveScheduledEventTypes = []string{"Preempt", "Reboot", "Redeploy", "Terminate"}
+
+// ScheduledEventsConfig configures how the node reacts to the scheduled events of the VM, e.g. the eviction
+// of a Spot VM.
+type ScheduledEventsConfig struct {
+	// Enabled indicates whether the scheduled events are polled from IMDS.
+	Enabled bool
+	// PollInterval is the interval to poll the scheduled events.
+	PollInterval time.Duration
+	// TaintEffect is the effect of the taint added to the node impacted by a scheduled event.
+	TaintEffect v1.TaintEffect
+	// Acknowledge indicates whether the scheduled event is approved once the node is drained, so that
+	// the event starts without waiting for its deadline.
+	Acknowledge bool
+}
+
+// Validate checks the poll interval and the taint effect.
+func (c *ScheduledEventsConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.PollInterval <= 0 {
+		return fmt.Errorf("invalid poll interval %s of the scheduled events", c.PollInterval)
+	}
+	switch c.TaintEffect {
+	case v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute:
+	default:
+		return fmt.Errorf("invalid effect %q of the scheduled event taint", c.TaintEffect)
+	}
+	return nil
+}
+
+// syncScheduledEvents polls the scheduled events of the node and reconciles the node with them.
+func (cnc *CloudNodeController) syncScheduledEvents(ctx context.Context) {
+	node, err := cnc.nodeInformer.Lister().Get(cnc.nodeName)
+	if err != nil {
+		// If node not found, just ignore it.
+		if apierrors.IsNotFound(err) {
+			return
+		}
+
+		klog.Errorf("Error getting node %q from informer, err: %v", cnc.nodeName, err)
+		return
+	}
+
+	if err := cnc.reconcileScheduledEvents(ctx, node); err != nil {
+		klog.Errorf("Error reconciling scheduled events for node %q, err: %v", node.Name, err)
+	}
+}
+
+// reconcileScheduledEvents taints, cordons the node and sets the node condition if a disruptive event is
+// scheduled on the node, and reverts them after the event.
+func (cnc *CloudNodeController) reconcileScheduledEvents(ctx context.Context, node *v1.Node) error {
+	events, err := cnc.nodeProvider.GetScheduledEvents()
+	if err != nil {
+		return fmt.Errorf("GetScheduledEvents: %w", err)
+	}
+
+	event := getDisruptiveScheduledEvent(events)
+	if event == nil {
+		return cnc.revertScheduledEvent(ctx, node)
+	}
+
+	if err := cnc.applyScheduledEvent(ctx, node, event); err != nil {
+		return err
+	}
+	if !cnc.scheduledEvents.Acknowledge || event.EventStatus != scheduledEventStatusScheduled || cnc.acknowledgedEventID == event.EventID {
+		return nil
+	}
+
+	drained, err := cnc.isNodeDrained(ctx, node.Name)
+	if err != nil {
+		return err
+	}
+	if !drained {
+		klog.V(4).Infof("reconcileScheduledEvents: waiting for node %s to be drained before acknowledging event %s", node.Name, event.EventID)
+		return nil
+	}
+	klog.V(2).Infof("reconcileScheduledEvents: acknowledging %s event %s of the drained node %s", event.EventType, event.EventID, node.Name)
+	if err := cnc.nodeProvider.AcknowledgeScheduledEvent(event.EventID); err != nil {
+		return fmt.Errorf("AcknowledgeScheduledEvent(%s): %w", event.EventID, err)
+	}
+	cnc.acknowledgedEventID = event.EventID
+	return nil
+}
+
+// getDisruptiveScheduledEvent returns the disruptive event which starts first.
+func getDisruptiveScheduledEvent(events []metadata.ScheduledEvent) *metadata.ScheduledEvent {
+	var result *metadata.ScheduledEvent
+	var resultNotBefore time.Time
+	for i := range events {
+		if !stringInSlice(events[i].EventType, disruptiveScheduledEventTypes) {
+			continue
+		}
+		notBefore := getScheduledEventNotBefore(&events[i])
+		if result == nil || notBefore.Before(resultNotBefore) {
+			result = &events[i]
+			resultNotBefore = notBefore
+		}
+	}
+	return result
+}
+
+// getScheduledEventNotBefore returns the time after which the event may start, or the zero time if the
+// event is started.
+func getScheduledEventNotBefore(event *metadata.ScheduledEvent) time.Time {
+	notBefore, err := time.Parse(time.RFC1123, event.NotBefore)
+	if err != nil {
+		return time.Time{}
+	}
+	return notBefore
+}
+
+func (cnc *CloudNodeController) applyScheduledEvent(ctx context.Context, node *v1.Node, event *metadata.ScheduledEvent) error {
+	taint := v1.Taint{Key: consts.ScheduledEventTaintKey, Value: event.EventType, Effect: cnc.scheduledEvents.TaintEffect}
+	err := cnc.patchNode(ctx, node, func(n *v1.Node) {
+		var found bool
+		for i := range n.Spec.Taints {
+			if n.Spec.Taints[i].Key == consts.ScheduledEventTaintKey {
+				n.Spec.Taints[i] = taint
+				found = true
+			}
+		}
+		if !found {
+			n.Spec.Taints = append(n.Spec.Taints, taint)
+		}
+		if !n.Spec.Unschedulable {
+			n.Spec.Unschedulable = true
+			if n.Annotations == nil {
+				n.Annotations = map[string]string{}
+			}
+			n.Annotations[consts.ScheduledEventCordonedAnnotation] = "true"
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("The %s event %s is %s", event.EventType, event.EventID, strings.ToLower(event.EventStatus))
+	if event.NotBefore != "" {
+		message = fmt.Sprintf("%s to start not before %s", message, event.NotBefore)
+	}
+	if event.Description != "" {
+		message = fmt.Sprintf("%s: %s", message, event.Description)
+	}
+	return cnc.setScheduledEventCondition(node, v1.ConditionTrue, event.EventType, message)
+}
+
+func (cnc *CloudNodeController) revertScheduledEvent(ctx context.Context, node *v1.Node) error {
+	err := cnc.patchNode(ctx, node, func(n *v1.Node) {
+		var taints []v1.Taint
+		for _, t := range n.Spec.Taints {
+			if t.Key != consts.ScheduledEventTaintKey {
+				taints = append(taints, t)
+			}
+		}
+		n.Spec.Taints = taints
+		if _, found := n.Annotations[consts.ScheduledEventCordonedAnnotation]; found {
+			n.Spec.Unschedulable = false
+			delete(n.Annotations, consts.ScheduledEventCordonedAnnotation)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	_, condition := nodeutil.GetNodeCondition(&node.Status, consts.NodeConditionScheduledEvent)
+	if condition == nil || condition.Status == v1.ConditionFalse {
+		return nil
+	}
+	return cnc.setScheduledEventCondition(node, v1.ConditionFalse, "NoScheduledEvent", "No disruptive event is scheduled")
+}
+
+// setScheduledEventCondition sets the scheduled event condition of the node if it is changed.
+func (cnc *CloudNodeController) setScheduledEventCondition(node *v1.Node, status v1.ConditionStatus, reason, message string) error {
+	currentTime := metav1.Now()
+	newCondition := v1.NodeCondition{
+		Type:               consts.NodeConditionScheduledEvent,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		LastHeartbeatTime:  currentTime,
+		LastTransitionTime: currentTime,
+	}
+	_, condition := nodeutil.GetNodeCondition(&node.Status, consts.NodeConditionScheduledEvent)
+	if condition != nil {
+		if condition.Status == status && condition.Reason == reason && condition.Message == message {
+			return nil
+		}
+		if condition.Status == status {
+			newCondition.LastTransitionTime = condition.LastTransitionTime
+		}
+	}
+
+	klog.V(2).Infof("setScheduledEventCondition: setting condition %s=%s of node %s: %s", consts.NodeConditionScheduledEvent, status, node.Name, message)
+	if err := nodeutil.SetNodeCondition(cnc.kubeClient, types.NodeName(node.Name), newCondition); err != nil {
+		return fmt.Errorf("failed to set the scheduled event condition of node %s: %w", node.Name, err)
+	}
+	return nil
+}
+
+// isNodeDrained returns true if only the DaemonSet pods and the static pods are running on the node.
+func (cnc *CloudNodeController) isNodeDrained(ctx context.Context, nodeName string) (bool, error) {
+	pods, err := cnc.kubeClient.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to list the pods on node %s: %w", nodeName, err)
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		if _, found := pod.Annotations[mirrorPodAnnotation]; found {
+			continue
+		}
+		if controllerRef := metav1.GetControllerOf(pod); controllerRef != nil && controllerRef.Kind == "DaemonSet" {
+			continue
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// patchNode modifies the latest node read from the API server and patches its labels, annotations and spec
+// if they are changed. The taints are replaced as a whole by the patch, so it carries the resourceVersion
+// of the node as a precondition and is retried on conflicts to not drop the taints changed by others.
+// Nothing is read if the modifier doesn't change the cached node.
+func (cnc *CloudNodeController) patchNode(ctx context.Context, node *v1.Node, modify nodeModifier) error {
+	cachedNode := node.DeepCopy()
+	modify(cachedNode)
+	if equality.Semantic.DeepEqual(node, cachedNode) {
+		return nil
+	}
+
+	err := clientretry.RetryOnConflict(UpdateNodeSpecBackoff, func() error {
+		curNode, err := cnc.kubeClient.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		newNode := curNode.DeepCopy()
+		modify(newNode)
+		if equality.Semantic.DeepEqual(curNode, newNode) {
+			return nil
+		}
+
+		// Clearing the resourceVersion of the old node adds the current one to the patch.
+		oldNode := curNode.DeepCopy()
+		oldNode.ResourceVersion = ""
+		patchBytes, err := preparePatchBytesforNode(oldNode, newNode)
+		if err != nil {
+			return err
+		}
+
+		klog.V(2).Infof("patchNode: patching node %s with %s", node.Name, string(patchBytes))
+		_, err = cnc.kubeClient.CoreV1().Nodes().Patch(ctx, node.Name, types.StrategicMergePatchType, patchBytes, metav1.PatchOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to patch node %s: %w", node.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodemanager
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	nodeutil "k8s.io/component-helpers/node/util"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/nodemanager/metadata"
+	mocknodeprovider "sigs.k8s.io/cloud-provider-azure/pkg/nodemanager/mock"
+)
+
+func TestScheduledEventsConfigValidate(t *testing.T) {
+	for _, tc := range []struct {
+		desc        string
+		config      ScheduledEventsConfig
+		expectedErr bool
+	}{
+		{
+			desc: "disabled",
+		},
+		{
+			desc:   "valid config",
+			config: ScheduledEventsConfig{Enabled: true, PollInterval: time.Second, TaintEffect: v1.TaintEffectNoExecute},
+		},
+		{
+			desc:        "invalid poll interval",
+			config:      ScheduledEventsConfig{Enabled: true, TaintEffect: v1.TaintEffectNoSchedule},
+			expectedErr: true,
+		},
+		{
+			desc:        "invalid taint effect",
+			config:      ScheduledEventsConfig{Enabled: true, PollInterval: time.Second, TaintEffect: "Evict"},
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			assert.Equal(t, tc.expectedErr, tc.config.Validate() != nil)
+		})
+	}
+}
+
+func TestGetDisruptiveScheduledEvent(t *testing.T) {
+	events := []metadata.ScheduledEvent{
+		{EventID: "freeze", EventType: "Freeze", NotBefore: "Mon, 19 Sep 2022 18:00:00 GMT"},
+		{EventID: "reboot", EventType: "Reboot", NotBefore: "Mon, 19 Sep 2022 18:30:00 GMT"},
+		{EventID: "preempt", EventType: "Preempt", NotBefore: "Mon, 19 Sep 2022 18:10:00 GMT"},
+	}
+	assert.Equal(t, "preempt", getDisruptiveScheduledEvent(events).EventID)
+	assert.Nil(t, getDisruptiveScheduledEvent(events[:1]))
+
+	// The started event has no NotBefore time.
+	events = append(events, metadata.ScheduledEvent{EventID: "redeploy", EventType: "Redeploy", EventStatus: "Started"})
+	assert.Equal(t, "redeploy", getDisruptiveScheduledEvent(events).EventID)
+}
+
+func TestReconcileScheduledEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.TODO()
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node0"},
+		Spec: v1.NodeSpec{
+			Taints: []v1.Taint{{Key: "foo", Value: "bar", Effect: v1.TaintEffectNoSchedule}},
+		},
+	}
+	workload := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "workload", Namespace: "default"},
+		Spec:       v1.PodSpec{NodeName: "node0"},
+		Status:     v1.PodStatus{Phase: v1.PodRunning},
+	}
+	daemon := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "daemon",
+			Namespace:       "kube-system",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "DaemonSet", Name: "ds", Controller: pointer.Bool(true)}},
+		},
+		Spec:   v1.PodSpec{NodeName: "node0"},
+		Status: v1.PodStatus{Phase: v1.PodRunning},
+	}
+	client := fake.NewSimpleClientset(node, workload, daemon)
+	mockNP := mocknodeprovider.NewMockNodeProvider(ctrl)
+	cnc := &CloudNodeController{
+		kubeClient:   client,
+		nodeProvider: mockNP,
+		scheduledEvents: ScheduledEventsConfig{
+			Enabled:      true,
+			PollInterval: time.Second,
+			TaintEffect:  v1.TaintEffectNoExecute,
+			Acknowledge:  true,
+		},
+	}
+	event := metadata.ScheduledEvent{
+		EventID:     "event1",
+		EventType:   "Preempt",
+		EventStatus: "Scheduled",
+		NotBefore:   "Mon, 19 Sep 2022 18:29:47 GMT",
+	}
+	getNode := func() *v1.Node {
+		updatedNode, err := client.CoreV1().Nodes().Get(ctx, "node0", metav1.GetOptions{})
+		assert.NoError(t, err)
+		return updatedNode
+	}
+
+	// The node is tainted and cordoned, but the event is not acknowledged before the node is drained.
+	mockNP.EXPECT().GetScheduledEvents().Return([]metadata.ScheduledEvent{event}, nil)
+	assert.NoError(t, cnc.reconcileScheduledEvents(ctx, node))
+	updatedNode := getNode()
+	assert.True(t, updatedNode.Spec.Unschedulable)
+	assert.Equal(t, "true", updatedNode.Annotations[consts.ScheduledEventCordonedAnnotation])
+	assert.ElementsMatch(t, []v1.Taint{
+		{Key: "foo", Value: "bar", Effect: v1.TaintEffectNoSchedule},
+		{Key: consts.ScheduledEventTaintKey, Value: "Preempt", Effect: v1.TaintEffectNoExecute},
+	}, updatedNode.Spec.Taints)
+	_, condition := nodeutil.GetNodeCondition(&updatedNode.Status, consts.NodeConditionScheduledEvent)
+	assert.NotNil(t, condition)
+	assert.Equal(t, v1.ConditionTrue, condition.Status)
+	assert.Equal(t, "Preempt", condition.Reason)
+	assert.Contains(t, condition.Message, event.NotBefore)
+
+	// The event is acknowledged once after the node is drained.
+	assert.NoError(t, client.CoreV1().Pods("default").Delete(ctx, "workload", metav1.DeleteOptions{}))
+	mockNP.EXPECT().GetScheduledEvents().Return([]metadata.ScheduledEvent{event}, nil).Times(2)
+	mockNP.EXPECT().AcknowledgeScheduledEvent("event1").Return(nil)
+	assert.NoError(t, cnc.reconcileScheduledEvents(ctx, updatedNode))
+	assert.NoError(t, cnc.reconcileScheduledEvents(ctx, updatedNode))
+
+	// The taint, cordon and condition are reverted after the event.
+	mockNP.EXPECT().GetScheduledEvents().Return(nil, nil)
+	assert.NoError(t, cnc.reconcileScheduledEvents(ctx, getNode()))
+	updatedNode = getNode()
+	assert.False(t, updatedNode.Spec.Unschedulable)
+	assert.NotContains(t, updatedNode.Annotations, consts.ScheduledEventCordonedAnnotation)
+	assert.Equal(t, []v1.Taint{{Key: "foo", Value: "bar", Effect: v1.TaintEffectNoSchedule}}, updatedNode.Spec.Taints)
+	_, condition = nodeutil.GetNodeCondition(&updatedNode.Status, consts.NodeConditionScheduledEvent)
+	assert.NotNil(t, condition)
+	assert.Equal(t, v1.ConditionFalse, condition.Status)
+
+	// Nothing is changed if no event is scheduled.
+	client.ClearActions()
+	mockNP.EXPECT().GetScheduledEvents().Return(nil, nil)
+	assert.NoError(t, cnc.reconcileScheduledEvents(ctx, updatedNode))
+	assert.Empty(t, client.Actions())
+}
+
+func TestReconcileScheduledEventsKeepsManualCordon(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.TODO()
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node0"},
+		Spec:       v1.NodeSpec{Unschedulable: true},
+	}
+	client := fake.NewSimpleClientset(node)
+	mockNP := mocknodeprovider.NewMockNodeProvider(ctrl)
+	cnc := &CloudNodeController{
+		kubeClient:      client,
+		nodeProvider:    mockNP,
+		scheduledEvents: ScheduledEventsConfig{Enabled: true, PollInterval: time.Second, TaintEffect: v1.TaintEffectNoSchedule},
+	}
+
+	mockNP.EXPECT().GetScheduledEvents().Return([]metadata.ScheduledEvent{{EventID: "event1", EventType: "Reboot", EventStatus: "Scheduled"}}, nil)
+	assert.NoError(t, cnc.reconcileScheduledEvents(ctx, node))
+	mockNP.EXPECT().GetScheduledEvents().Return(nil, nil)
+	updatedNode, err := client.CoreV1().Nodes().Get(ctx, "node0", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.NotContains(t, updatedNode.Annotations, consts.ScheduledEventCordonedAnnotation)
+	assert.NoError(t, cnc.reconcileScheduledEvents(ctx, updatedNode))
+
+	updatedNode, err = client.CoreV1().Nodes().Get(ctx, "node0", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.True(t, updatedNode.Spec.Unschedulable)
+	assert.Empty(t, updatedNode.Spec.Taints)
+}
+
+func TestPatchNodeRetriesOnConflict(t *testing.T) {
+	ctx := context.TODO()
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node0", ResourceVersion: "1"}}
+	client := fake.NewSimpleClientset(node)
+	var patches []string
+	client.PrependReactor("patch", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patches = append(patches, string(action.(k8stesting.PatchAction).GetPatch()))
+		if len(patches) > 1 {
+			return false, nil, nil
+		}
+
+		// The node is tainted by others after it is read.
+		taintedNode := node.DeepCopy()
+		taintedNode.ResourceVersion = "2"
+		taintedNode.Spec.Taints = []v1.Taint{{Key: "foo", Value: "bar", Effect: v1.TaintEffectNoSchedule}}
+		if err := client.Tracker().Update(v1.SchemeGroupVersion.WithResource("nodes"), taintedNode, ""); err != nil {
+			return true, nil, err
+		}
+		return true, nil, apierrors.NewConflict(v1.Resource("nodes"), "node0", errors.New("the object has been modified"))
+	})
+
+	cnc := &CloudNodeController{kubeClient: client}
+	taint := v1.Taint{Key: consts.ScheduledEventTaintKey, Value: "Reboot", Effect: v1.TaintEffectNoExecute}
+	assert.NoError(t, cnc.patchNode(ctx, node, func(n *v1.Node) {
+		n.Spec.Taints = append(n.Spec.Taints, taint)
+	}))
+
+	// The patch is retried against the latest node, so the taint added by others is kept.
+	assert.Len(t, patches, 2)
+	assert.Contains(t, patches[0], `"resourceVersion":"1"`)
+	assert.Contains(t, patches[1], `"resourceVersion":"2"`)
+	updatedNode, err := client.CoreV1().Nodes().Get(ctx, "node0", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []v1.Taint{{Key: "foo", Value: "bar", Effect: v1.TaintEffectNoSchedule}, taint}, updatedNode.Spec.Taints)
+
+	// Nothing is read or patched if the cached node is not changed.
+	client.ClearActions()
+	assert.NoError(t, cnc.patchNode(ctx, updatedNode, func(n *v1.Node) {}))
+	assert.Empty(t, client.Actions())
+}
@@ -35,6 +35,8 @@ import (
 	"github.com/Azure/go-autorest/autorest/azure"
 
 	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/informers"
@@ -42,6 +44,7 @@ import (
 	"k8s.io/client-go/kubernetes/scheme"
 	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
 	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/flowcontrol"
@@ -49,13 +52,17 @@ import (
 	"k8s.io/klog/v2"
 
 	azclients "sigs.k8s.io/cloud-provider-azure/pkg/azureclients"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/applicationgatewayclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/applicationsecuritygroupclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/blobclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/containerserviceclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/deploymentclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/diskclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/dnsrecordclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/fileclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/interfaceclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/natgatewayclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/privatednsclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/privatednszonegroupclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/privateendpointclient"
@@ -140,7 +147,7 @@ type Config struct {
 	// the cloudprovider will try to add all nodes to a single backend pool which is forbidden.
 	// In other words, if you use multiple agent pools (availability sets), you MUST set this field.
 	PrimaryAvailabilitySetName string `json:"primaryAvailabilitySetName,omitempty" yaml:"primaryAvailabilitySetName,omitempty"`
-	// The type of azure nodes. Candidate values are: vmss and standard.
+	// The type of azure nodes. Candidate values are: vmss, vmssflex, standard and mixed.
 	// If not set, it will be default to standard.
 	VMType string `json:"vmType,omitempty" yaml:"vmType,omitempty"`
 	// The name of the scale set that should be used as the load balancer backend.
@@ -200,6 +207,12 @@ type Config struct {
 	// NodePoolsWithoutDedicatedSLB stores the VMAS/VMSS names that share the primary standard load balancer instead
 	// of having a dedicated one. This is useful only when EnableMultipleStandardLoadBalancers is set to true.
 	NodePoolsWithoutDedicatedSLB string `json:"nodePoolsWithoutDedicatedSLB,omitempty" yaml:"nodePoolsWithoutDedicatedSLB,omitempty"`
+	// LoadBalancerProfiles replaces the standard load balancer per VMAS or VMSS by named load balancers that select
+	// their nodes and services by labels. This is useful only when EnableMultipleStandardLoadBalancers is set to true.
+	LoadBalancerProfiles []LoadBalancerProfile `json:"loadBalancerProfiles,omitempty" yaml:"loadBalancerProfiles,omitempty"`
+	// EnableLoadBalancerSkuMigration migrates the services from the basic load balancers to the standard ones one
+	// by one, upgrading their public IPs and keeping their IP addresses. This is useful only when LoadBalancerSku is standard.
+	EnableLoadBalancerSkuMigration bool `json:"enableLoadBalancerSkuMigration,omitempty" yaml:"enableLoadBalancerSkuMigration,omitempty"`
 
 	// Backoff exponent
 	CloudProviderBackoffExponent float64 `json:"cloudProviderBackoffExponent,omitempty" yaml:"cloudProviderBackoffExponent,omitempty"`
@@ -258,13 +271,148 @@ type Config struct {
 	// are `nodeIPConfiguration`, `nodeIP` and `podIP`.
 	// `nodeIPConfiguration`: vm network interfaces will be attached to the inbound backend pool of the load balancer (default);
 	// `nodeIP`: vm private IPs will be attached to the inbound backend pool of the load balancer;
-	// `podIP`: pod IPs will be attached to the inbound backend pool of the load balancer (not supported yet).
+	// `podIP`: the ready pod IPs of each service will be attached to a backend pool dedicated to the service. It
+	// requires the standard load balancer and pod IPs routable in the virtual network.
 	LoadBalancerBackendPoolConfigurationType string `json:"loadBalancerBackendPoolConfigurationType,omitempty" yaml:"loadBalancerBackendPoolConfigurationType,omitempty"`
 	// PutVMSSVMBatchSize defines how many requests the client send concurrently when putting the VMSS VMs.
 	// If it is smaller than or equal to zero, the request will be sent one by one in sequence (default).
 	PutVMSSVMBatchSize int `json:"putVMSSVMBatchSize" yaml:"putVMSSVMBatchSize"`
 	// PrivateLinkServiceResourceGroup determines the specific resource group of the private link services user want to use
 	PrivateLinkServiceResourceGroup string `json:"privateLinkServiceResourceGroup,omitempty" yaml:"privateLinkServiceResourceGroup,omitempty"`
+	// LoadBalancerDryRun enables the plan mode for all load balancer services. In plan mode, the changes
+	// to the load balancers, security groups, public IPs and private link services are computed and
+	// reported in the service events instead of being applied.
+	LoadBalancerDryRun bool `json:"loadBalancerDryRun,omitempty" yaml:"loadBalancerDryRun,omitempty"`
+	// EnableSecurityRuleConsolidation packs the security rules of all the load balancer services in the cluster
+	// into shared rules. The rules with the same access, protocol, source and destination ports are merged into
+	// one rule with the destination IPs of all the services. The services with shared security rules or disabled
+	// floating IP keep their own rules.
+	EnableSecurityRuleConsolidation bool `json:"enableSecurityRuleConsolidation,omitempty" yaml:"enableSecurityRuleConsolidation,omitempty"`
+	// SecurityGroupRuleLimit is the maximum number of security rules in the security group. The changes exceeding
+	// the limit are refused before updating the security group. Default to 1000, which is the limit of Azure.
+	SecurityGroupRuleLimit int `json:"securityGroupRuleLimit,omitempty" yaml:"securityGroupRuleLimit,omitempty"`
+	// UseApplicationSecurityGroups makes the security rules of the load balancer services with floating IP disabled
+	// allow the traffic to an application security group of the load balancer instead of the backend node IPs. The
+	// cloud provider creates the application security group "<lbName>-asg" in the security group resource group and
+	// keeps the nodes in the backend pool of the load balancer as its members. The rules to the frontend IPs and the
+	// services with shared security rules are not affected.
+	UseApplicationSecurityGroups bool `json:"useApplicationSecurityGroups,omitempty" yaml:"useApplicationSecurityGroups,omitempty"`
+
+	// ApplicationGatewayName is the name of the application gateway shared by the services annotated with
+	// `service.beta.kubernetes.io/azure-load-balancer-type: appgw`. Default to "<clusterName>-appgw".
+	ApplicationGatewayName string `json:"applicationGatewayName,omitempty" yaml:"applicationGatewayName,omitempty"`
+	// ApplicationGatewayResourceGroup is the resource group of the application gateway. Default to the cluster resource group.
+	ApplicationGatewayResourceGroup string `json:"applicationGatewayResourceGroup,omitempty" yaml:"applicationGatewayResourceGroup,omitempty"`
+	// ApplicationGatewaySubnetName is the dedicated subnet in the cluster virtual network where the application gateway
+	// is created. It is only needed if the application gateway does not exist.
+	ApplicationGatewaySubnetName string `json:"applicationGatewaySubnetName,omitempty" yaml:"applicationGatewaySubnetName,omitempty"`
+	// ApplicationGatewaySku is the SKU of the created application gateway, Standard_v2 or WAF_v2. Default to Standard_v2.
+	ApplicationGatewaySku string `json:"applicationGatewaySku,omitempty" yaml:"applicationGatewaySku,omitempty"`
+	// ApplicationGatewayCapacity is the instance count of the created application gateway. Default to 2.
+	ApplicationGatewayCapacity int32 `json:"applicationGatewayCapacity,omitempty" yaml:"applicationGatewayCapacity,omitempty"`
+	// ApplicationGatewayFirewallPolicyID is the resource ID of the WAF policy associated with the created application gateway.
+	ApplicationGatewayFirewallPolicyID string `json:"applicationGatewayFirewallPolicyID,omitempty" yaml:"applicationGatewayFirewallPolicyID,omitempty"`
+	// ApplicationGatewayIdentityID is the resource ID of the user assigned identity of the created application gateway.
+	// The identity is used to read the TLS certificates of the services from Key Vault.
+	ApplicationGatewayIdentityID string `json:"applicationGatewayIdentityID,omitempty" yaml:"applicationGatewayIdentityID,omitempty"`
+
+	// GlobalLoadBalancerResourceGroup is the resource group of the cross-region load balancers and their public IPs.
+	// Default to the cluster resource group.
+	GlobalLoadBalancerResourceGroup string `json:"globalLoadBalancerResourceGroup,omitempty" yaml:"globalLoadBalancerResourceGroup,omitempty"`
+	// GlobalLoadBalancerLocation is the home region of the created cross-region load balancers. Default to the cluster location.
+	GlobalLoadBalancerLocation string `json:"globalLoadBalancerLocation,omitempty" yaml:"globalLoadBalancerLocation,omitempty"`
+
+	// EnableOwnershipManifest records the rules, probes, frontend IP configurations and tags created by the cloud
+	// provider in the tags of the load balancers and security groups, and only the recorded ones are updated or
+	// deleted. The subresources following the naming convention of the cloud provider are adopted when the
+	// manifest is created.
+	EnableOwnershipManifest bool `json:"enableOwnershipManifest,omitempty" yaml:"enableOwnershipManifest,omitempty"`
+
+	// GatewayLoadBalancerFrontendID is the resource ID of the gateway load balancer frontend IP configuration chained
+	// to the frontends of the external services without the annotation `service.beta.kubernetes.io/azure-load-balancer-gateway-frontend-id`.
+	GatewayLoadBalancerFrontendID string `json:"gatewayLoadBalancerFrontendID,omitempty" yaml:"gatewayLoadBalancerFrontendID,omitempty"`
+
+	// OutboundConfig makes the cloud controller manager own the outbound connectivity of the nodes.
+	// Only supported with the standard load balancer.
+	OutboundConfig *OutboundConfig `json:"outboundConfig,omitempty" yaml:"outboundConfig,omitempty"`
+
+	// PublicIPPool is a pool of pre-created public IPs leased to the external services which do not request
+	// a specific public IP, instead of creating a new public IP for each of them.
+	PublicIPPool *PublicIPPool `json:"publicIPPool,omitempty" yaml:"publicIPPool,omitempty"`
+
+	// EnableInstanceInventory answers the InstancesV2 calls from an inventory of the VMs indexed by provider ID,
+	// which is built from the list calls of the VMSS, VMSS VMs and VMs in the node resource groups instead of
+	// the lookups of each node. The provider IDs missing in the inventory fall back to the lookups of the node.
+	EnableInstanceInventory bool `json:"enableInstanceInventory,omitempty" yaml:"enableInstanceInventory,omitempty"`
+	// InstanceInventoryCacheTTLInSeconds sets the cache TTL for the instance inventory. Default to 600 seconds.
+	InstanceInventoryCacheTTLInSeconds int `json:"instanceInventoryCacheTTLInSeconds,omitempty" yaml:"instanceInventoryCacheTTLInSeconds,omitempty"`
+
+	// EnableInstanceState computes the states of the VMs of the nodes from the instance inventory or the VMSet,
+	// reports them as the node condition AzureInstanceDegraded and excludes the nodes whose VMs are stopped,
+	// deallocated, hibernated or failed from the load balancer backend pools until they recover.
+	EnableInstanceState bool `json:"enableInstanceState,omitempty" yaml:"enableInstanceState,omitempty"`
+	// FailedInstanceRemediation reimages or redeploys the VMSS instances which have been in the Failed
+	// provisioning state for a while. It enables the instance state.
+	FailedInstanceRemediation *FailedInstanceRemediation `json:"failedInstanceRemediation,omitempty" yaml:"failedInstanceRemediation,omitempty"`
+}
+
+// FailedInstanceRemediation configures how the VMSS instances stuck in the Failed provisioning state are remediated.
+type FailedInstanceRemediation struct {
+	// Action is `reimage` or `redeploy`.
+	Action string `json:"action,omitempty" yaml:"action,omitempty"`
+	// DelayInSeconds is how long the instance stays failed before it is remediated, and also the minimum interval
+	// between the remediations of the same instance. Default to 600 seconds.
+	DelayInSeconds int `json:"delayInSeconds,omitempty" yaml:"delayInSeconds,omitempty"`
+}
+
+// PublicIPPool selects the pre-created public IPs in the pool by resource group and tags.
+type PublicIPPool struct {
+	// ResourceGroup is the resource group of the public IPs in the pool, which is used as the public IP resource
+	// group of the services leasing from the pool. Default to the resource group of the public IPs of the service.
+	ResourceGroup string `json:"resourceGroup,omitempty" yaml:"resourceGroup,omitempty"`
+	// Tags selects the public IPs having all the tags. If it is not set, all the public IPs in ResourceGroup are
+	// in the pool, so it is required when ResourceGroup is not set or is the cluster resource group.
+	Tags map[string]string `json:"tags,omitempty" yaml:"tags,omitempty"`
+}
+
+// OutboundConfig configures the outbound connectivity managed by the cloud controller manager. The outbound
+// public IPs and the SNAT ports are recomputed as the nodes scale.
+type OutboundConfig struct {
+	// Type is `loadBalancer` to own an outbound rule on the primary standard load balancer, or `natGateway`
+	// to attach a NAT gateway to the node subnet.
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+	// AllocatedOutboundPorts is the number of SNAT ports allocated to each node, a multiple of 8. If it is 0, the
+	// ports of the outbound IPs are divided among the nodes. It is only used to compute the outbound IP count for
+	// the NAT gateway, which allocates the ports on demand.
+	AllocatedOutboundPorts int32 `json:"allocatedOutboundPorts,omitempty" yaml:"allocatedOutboundPorts,omitempty"`
+	// OutboundIPCount is the number of managed outbound public IPs, up to 16. If it is 0, the count is computed
+	// from AllocatedOutboundPorts and the node count, or defaults to 1.
+	OutboundIPCount int32 `json:"outboundIPCount,omitempty" yaml:"outboundIPCount,omitempty"`
+	// IdleTimeoutInMinutes is the idle timeout of the outbound flows, between 4 and 120. Default to 4.
+	IdleTimeoutInMinutes int32 `json:"idleTimeoutInMinutes,omitempty" yaml:"idleTimeoutInMinutes,omitempty"`
+	// NatGatewayName is the name of the NAT gateway in the cluster resource group. Default to "<clusterName>-natgw".
+	NatGatewayName string `json:"natGatewayName,omitempty" yaml:"natGatewayName,omitempty"`
+}
+
+// LoadBalancerProfile describes one of the multiple standard load balancers.
+type LoadBalancerProfile struct {
+	// Name is the name of the external load balancer, the internal one is named "<name>-internal". The profile
+	// named after the cluster, or loadBalancerName if set, describes the primary load balancer.
+	Name string `json:"name" yaml:"name"`
+	// NodeSelector selects the nodes in the backend pool. All the nodes are selected if it is not set.
+	NodeSelector *metav1.LabelSelector `json:"nodeSelector,omitempty" yaml:"nodeSelector,omitempty"`
+	// ServiceNamespaceSelector selects the namespaces of the services that can be placed on the load balancer.
+	// All the namespaces are selected if it is not set.
+	ServiceNamespaceSelector *metav1.LabelSelector `json:"serviceNamespaceSelector,omitempty" yaml:"serviceNamespaceSelector,omitempty"`
+	// ServiceLabelSelector selects the services that can be placed on the load balancer. All the services are
+	// selected if it is not set.
+	ServiceLabelSelector *metav1.LabelSelector `json:"serviceLabelSelector,omitempty" yaml:"serviceLabelSelector,omitempty"`
+	// AllowServicePlacement determines whether the services without the profile annotation can be placed on the
+	// load balancer. If set to false, only the services pinned to the profile are. Default to true.
+	AllowServicePlacement *bool `json:"allowServicePlacement,omitempty" yaml:"allowServicePlacement,omitempty"`
+	// MaximumLoadBalancerRuleCount is the maximum number of rules of the load balancer before the services are
+	// placed on another one. Default to maximumLoadBalancerRuleCount.
+	MaximumLoadBalancerRuleCount int `json:"maximumLoadBalancerRuleCount,omitempty" yaml:"maximumLoadBalancerRuleCount,omitempty"`
 }
 
 type InitSecretConfig struct {
@@ -316,6 +464,10 @@ type Cloud struct {
 	privatednszonegroupclient       privatednszonegroupclient.Interface
 	virtualNetworkLinksClient       virtualnetworklinksclient.Interface
 	PrivateLinkServiceClient        privatelinkserviceclient.Interface
+	ApplicationGatewayClient        applicationgatewayclient.Interface
+	ApplicationSecurityGroupsClient applicationsecuritygroupclient.Interface
+	NatGatewaysClient               natgatewayclient.Interface
+	DNSRecordSetsClient             dnsrecordclient.Interface
 	containerServiceClient          containerserviceclient.Interface
 	deploymentClient                deploymentclient.Interface
 
@@ -328,7 +480,9 @@ type Cloud struct {
 	ipv6DualStackEnabled bool
 	// isSHaredLoadBalancerSynced indicates if the reconcileSharedLoadBalancer has been run
 	isSharedLoadBalancerSynced bool
-	// Lock for access to node caches, includes nodeZones, nodeResourceGroups, and unmanagedNodes.
+	// isLoadBalancerSkuMigrated indicates if there is no basic load balancer left to be migrated
+	isLoadBalancerSkuMigrated bool
+	// Lock for access to node caches, includes nodeZones, nodeResourceGroups, unmanagedNodes and instanceStates.
 	nodeCachesLock sync.RWMutex
 	// nodeNames holds current nodes for tracking added nodes in VM caches.
 	nodeNames sets.String
@@ -342,6 +496,8 @@ type Cloud struct {
 	// excludeLoadBalancerNodes holds a list of nodes that should be excluded from LoadBalancer.
 	excludeLoadBalancerNodes sets.String
 	nodePrivateIPs           map[string]sets.String
+	// instanceStates holds the instance states of the nodes computed by the instance state controller.
+	instanceStates map[string]instanceState
 	// nodeInformerSynced is for determining if the informer has synced.
 	nodeInformerSynced cache.InformerSynced
 
@@ -369,11 +525,29 @@ type Cloud struct {
 	pipCache *azcache.TimedCache
 	// use LB frontEndIpConfiguration ID as the key and search for PLS attached to the frontEnd
 	plsCache *azcache.TimedCache
+	// vmManagementTypes is only set with the mixed vmType.
+	vmManagementTypes *vmManagementTypeRegistry
+	// instanceInventory is only set if EnableInstanceInventory is true.
+	instanceInventory *instanceInventory
 
 	// Add service lister to always get latest service
 	serviceLister corelisters.ServiceLister
+	// endpointSliceLister is only set with the podIP backend pool type.
+	endpointSliceLister discoverylisters.EndpointSliceLister
+	// nodeLister and namespaceLister are only set with the load balancer profiles, and nodeLister is also set
+	// with the instance state.
+	nodeLister      corelisters.NodeLister
+	namespaceLister corelisters.NamespaceLister
+	// remediatedInstances records when the failed instances are remediated by the instance state controller.
+	remediatedInstances map[string]time.Time
 	// node-sync-loop routine and service-reconcile routine should not update LoadBalancer at the same time
 	serviceReconcileLock sync.Mutex
+	// lastSuccessfulServiceReconcile stores the last time each service condition became ready.
+	// key: [namespace/serviceName/conditionType], value: metav1.Time
+	lastSuccessfulServiceReconcile sync.Map
+	// lbPlans collects the planned changes of the services being reconciled in plan mode.
+	// key: [namespace/serviceName], value: *loadBalancerPlan
+	lbPlans sync.Map
 
 	*ManagedDiskController
 	*controllerCommon
@@ -510,6 +684,14 @@ func (az *Cloud) InitializeCloudFromConfig(ctx context.Context, config *Config,
 		config.PrivateLinkServiceResourceGroup = config.ResourceGroup
 	}
 
+	if config.ApplicationGatewayResourceGroup == "" {
+		config.ApplicationGatewayResourceGroup = config.ResourceGroup
+	}
+
+	if config.GlobalLoadBalancerResourceGroup == "" {
+		config.GlobalLoadBalancerResourceGroup = config.ResourceGroup
+	}
+
 	if config.VMType == "" {
 		// default to standard vmType if not set.
 		config.VMType = consts.VMTypeStandard
@@ -523,6 +705,11 @@ func (az *Cloud) InitializeCloudFromConfig(ctx context.Context, config *Config,
 		return fmt.Errorf("disableAvailabilitySetNodes %v is only supported when vmType is 'vmss'", config.DisableAvailabilitySetNodes)
 	}
 
+	if strings.EqualFold(config.VMType, consts.VMTypeMixed) {
+		// All the node pool types are supported with the mixed vmType.
+		config.EnableVmssFlexNodes = true
+	}
+
 	if config.CloudConfigType == "" {
 		// The default cloud config type is cloudConfigTypeMerge.
 		config.CloudConfigType = cloudConfigTypeMerge
@@ -536,9 +723,7 @@ func (az *Cloud) InitializeCloudFromConfig(ctx context.Context, config *Config,
 		}
 	}
 
-	if config.LoadBalancerBackendPoolConfigurationType == "" ||
-		// TODO(nilo19): support pod IP mode in the future
-		strings.EqualFold(config.LoadBalancerBackendPoolConfigurationType, consts.LoadBalancerBackendPoolConfigurationTypePODIP) {
+	if config.LoadBalancerBackendPoolConfigurationType == "" {
 		config.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypeNodeIPConfiguration
 	} else {
 		supportedLoadBalancerBackendPoolConfigurationTypes := sets.NewString(
@@ -548,6 +733,10 @@ func (az *Cloud) InitializeCloudFromConfig(ctx context.Context, config *Config,
 		if !supportedLoadBalancerBackendPoolConfigurationTypes.Has(strings.ToLower(config.LoadBalancerBackendPoolConfigurationType)) {
 			return fmt.Errorf("loadBalancerBackendPoolConfigurationType %s is not supported, supported values are %v", config.LoadBalancerBackendPoolConfigurationType, supportedLoadBalancerBackendPoolConfigurationTypes.List())
 		}
+		if strings.EqualFold(config.LoadBalancerBackendPoolConfigurationType, consts.LoadBalancerBackendPoolConfigurationTypePODIP) &&
+			!strings.EqualFold(config.LoadBalancerSku, consts.LoadBalancerSkuStandard) {
+			return fmt.Errorf("loadBalancerBackendPoolConfigurationType %s is only supported with the standard load balancer", consts.LoadBalancerBackendPoolConfigurationTypePODIP)
+		}
 	}
 
 	env, err := ratelimitconfig.ParseAzureEnvironment(config.Cloud, config.ResourceManagerEndpoint, config.IdentitySystem)
@@ -586,6 +775,12 @@ func (az *Cloud) InitializeCloudFromConfig(ctx context.Context, config *Config,
 		return err
 	}
 
+	if config.FailedInstanceRemediation != nil {
+		if err := validateFailedInstanceRemediation(config.FailedInstanceRemediation); err != nil {
+			return err
+		}
+	}
+
 	az.Config = *config
 	az.Environment = *env
 	az.ResourceRequestBackoff = resourceRequestBackoff
@@ -615,6 +810,13 @@ func (az *Cloud) InitializeCloudFromConfig(ctx context.Context, config *Config,
 		if err != nil {
 			return err
 		}
+	} else if strings.EqualFold(consts.VMTypeMixed, az.Config.VMType) {
+		// The scale set dispatches the nodes to the VMSet of their types, which are recorded by the node informer.
+		az.vmManagementTypes = newVMManagementTypeRegistry()
+		az.VMSet, err = newScaleSet(ctx, az)
+		if err != nil {
+			return err
+		}
 	} else if strings.EqualFold(consts.VMTypeVmssFlex, az.Config.VMType) {
 		az.VMSet, err = newFlexScaleSet(ctx, az)
 		if err != nil {
@@ -631,6 +833,8 @@ func (az *Cloud) InitializeCloudFromConfig(ctx context.Context, config *Config,
 		az.LoadBalancerBackendPool = newBackendPoolTypeNodeIPConfig(az)
 	} else if az.isLBBackendPoolTypeNodeIP() {
 		az.LoadBalancerBackendPool = newBackendPoolTypeNodeIP(az)
+	} else if az.isLBBackendPoolTypePodIP() {
+		az.LoadBalancerBackendPool = newBackendPoolTypePodIP(az)
 	}
 
 	err = az.initCaches()
@@ -673,6 +877,17 @@ func (az *Cloud) isLBBackendPoolTypeNodeIP() bool {
 	return strings.EqualFold(az.LoadBalancerBackendPoolConfigurationType, consts.LoadBalancerBackendPoolConfigurationTypeNodeIP)
 }
 
+func (az *Cloud) isLBBackendPoolTypePodIP() bool {
+	return strings.EqualFold(az.LoadBalancerBackendPoolConfigurationType, consts.LoadBalancerBackendPoolConfigurationTypePODIP)
+}
+
+func (az *Cloud) getSecurityGroupRuleLimit() int {
+	if az.SecurityGroupRuleLimit <= 0 {
+		return consts.SecurityGroupRuleLimit
+	}
+	return az.SecurityGroupRuleLimit
+}
+
 func (az *Cloud) getPutVMSSVMBatchSize() int {
 	return az.PutVMSSVMBatchSize
 }
@@ -708,6 +923,10 @@ func (az *Cloud) initCaches() (err error) {
 		return err
 	}
 
+	if az.EnableInstanceInventory {
+		az.instanceInventory = newInstanceInventory(time.Duration(az.InstanceInventoryCacheTTLInSeconds)*time.Second, az.listInstanceInventory)
+	}
+
 	return nil
 }
 
@@ -718,6 +937,26 @@ func (az *Cloud) setLBDefaults(config *Config) error {
 			config.ExcludeMasterFromStandardLB = &defaultExcludeMasterFromStandardLB
 		}
 
+		if config.OutboundConfig != nil {
+			if err := validateOutboundConfig(config.OutboundConfig); err != nil {
+				return err
+			}
+			// The load balancing rules cannot SNAT the traffic of the backend pool used by an outbound rule.
+			if strings.EqualFold(config.OutboundConfig.Type, consts.OutboundTypeLoadBalancer) {
+				if config.DisableOutboundSNAT != nil && !*config.DisableOutboundSNAT {
+					return fmt.Errorf("disableOutboundSNAT cannot be false when outboundConfig.type is %s", consts.OutboundTypeLoadBalancer)
+				}
+				disableOutboundSNAT := true
+				config.DisableOutboundSNAT = &disableOutboundSNAT
+			}
+		}
+
+		if len(config.LoadBalancerProfiles) > 0 {
+			if err := validateLoadBalancerProfiles(config); err != nil {
+				return err
+			}
+		}
+
 		// Enable outbound SNAT by default.
 		if config.DisableOutboundSNAT == nil {
 			config.DisableOutboundSNAT = &defaultDisableOutboundSNAT
@@ -726,6 +965,21 @@ func (az *Cloud) setLBDefaults(config *Config) error {
 		if config.DisableOutboundSNAT != nil && *config.DisableOutboundSNAT {
 			return fmt.Errorf("disableOutboundSNAT should only set when loadBalancerSku is standard")
 		}
+		if config.OutboundConfig != nil {
+			return fmt.Errorf("outboundConfig should only set when loadBalancerSku is standard")
+		}
+		if len(config.LoadBalancerProfiles) > 0 {
+			return fmt.Errorf("loadBalancerProfiles should only set when loadBalancerSku is standard")
+		}
+		if config.EnableLoadBalancerSkuMigration {
+			return fmt.Errorf("enableLoadBalancerSkuMigration should only set when loadBalancerSku is standard")
+		}
+	}
+
+	if config.PublicIPPool != nil {
+		if err := validatePublicIPPool(config); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -819,6 +1073,10 @@ func (az *Cloud) configAzureClients(
 	privateDNSZoenGroupConfig := azClientConfig.WithRateLimiter(az.Config.PrivateDNSZoneGroupRateLimit)
 	privateEndpointConfig := azClientConfig.WithRateLimiter(az.Config.PrivateEndpointRateLimit)
 	privateLinkServiceConfig := azClientConfig.WithRateLimiter(az.Config.PrivateLinkServiceRateLimit)
+	applicationGatewayConfig := azClientConfig.WithRateLimiter(az.Config.ApplicationGatewayRateLimit)
+	applicationSecurityGroupConfig := azClientConfig.WithRateLimiter(az.Config.ApplicationSecurityGroupRateLimit)
+	natGatewayConfig := azClientConfig.WithRateLimiter(az.Config.NatGatewayRateLimit)
+	dnsRecordSetConfig := azClientConfig.WithRateLimiter(az.Config.DNSRecordSetRateLimit)
 	virtualNetworkConfig := azClientConfig.WithRateLimiter(az.Config.VirtualNetworkRateLimit)
 	// TODO(ZeroMagic): add azurefileRateLimit
 	fileClientConfig := azClientConfig.WithRateLimiter(nil)
@@ -844,6 +1102,9 @@ func (az *Cloud) configAzureClients(
 		loadBalancerClientConfig.Authorizer = networkResourceServicePrincipalTokenAuthorizer
 		securityGroupClientConfig.Authorizer = networkResourceServicePrincipalTokenAuthorizer
 		publicIPClientConfig.Authorizer = networkResourceServicePrincipalTokenAuthorizer
+		applicationGatewayConfig.Authorizer = networkResourceServicePrincipalTokenAuthorizer
+		applicationSecurityGroupConfig.Authorizer = networkResourceServicePrincipalTokenAuthorizer
+		natGatewayConfig.Authorizer = networkResourceServicePrincipalTokenAuthorizer
 	}
 
 	if az.UsesNetworkResourceInDifferentSubscription() {
@@ -853,6 +1114,9 @@ func (az *Cloud) configAzureClients(
 		loadBalancerClientConfig.SubscriptionID = az.Config.NetworkResourceSubscriptionID
 		securityGroupClientConfig.SubscriptionID = az.Config.NetworkResourceSubscriptionID
 		publicIPClientConfig.SubscriptionID = az.Config.NetworkResourceSubscriptionID
+		applicationGatewayConfig.SubscriptionID = az.Config.NetworkResourceSubscriptionID
+		applicationSecurityGroupConfig.SubscriptionID = az.Config.NetworkResourceSubscriptionID
+		natGatewayConfig.SubscriptionID = az.Config.NetworkResourceSubscriptionID
 	}
 
 	// Initialize all azure clients based on client config
@@ -878,6 +1142,10 @@ func (az *Cloud) configAzureClients(
 	az.privatednszonegroupclient = privatednszonegroupclient.New(privateDNSZoenGroupConfig)
 	az.virtualNetworkLinksClient = virtualnetworklinksclient.New(virtualNetworkConfig)
 	az.PrivateLinkServiceClient = privatelinkserviceclient.New(privateLinkServiceConfig)
+	az.ApplicationGatewayClient = applicationgatewayclient.New(applicationGatewayConfig)
+	az.ApplicationSecurityGroupsClient = applicationsecuritygroupclient.New(applicationSecurityGroupConfig)
+	az.NatGatewaysClient = natgatewayclient.New(natGatewayConfig)
+	az.DNSRecordSetsClient = dnsrecordclient.New(dnsRecordSetConfig)
 	az.containerServiceClient = containerserviceclient.New(containerServiceConfig)
 	az.deploymentClient = deploymentclient.New(deploymentConfig)
 
@@ -1060,6 +1328,43 @@ func (az *Cloud) SetInformers(informerFactory informers.SharedInformerFactory) {
 	az.nodeInformerSynced = nodeInformer.HasSynced
 
 	az.serviceLister = informerFactory.Core().V1().Services().Lister()
+	if az.useLoadBalancerProfiles() {
+		az.nodeLister = informerFactory.Core().V1().Nodes().Lister()
+		az.namespaceLister = informerFactory.Core().V1().Namespaces().Lister()
+	}
+	if az.IsInstanceStateEnabled() {
+		az.nodeLister = informerFactory.Core().V1().Nodes().Lister()
+	}
+
+	if podIPBackendPool, ok := az.LoadBalancerBackendPool.(*backendPoolTypePodIP); ok {
+		endpointSliceInformer := informerFactory.Discovery().V1().EndpointSlices()
+		_, _ = endpointSliceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				podIPBackendPool.enqueueEndpointSlice(obj.(*discoveryv1.EndpointSlice))
+			},
+			UpdateFunc: func(prev, obj interface{}) {
+				podIPBackendPool.enqueueEndpointSlice(obj.(*discoveryv1.EndpointSlice))
+			},
+			DeleteFunc: func(obj interface{}) {
+				endpointSlice, isEndpointSlice := obj.(*discoveryv1.EndpointSlice)
+				if !isEndpointSlice {
+					deletedState, ok := obj.(cache.DeletedFinalStateUnknown)
+					if !ok {
+						klog.Errorf("Received unexpected object: %v", obj)
+						return
+					}
+					endpointSlice, ok = deletedState.Obj.(*discoveryv1.EndpointSlice)
+					if !ok {
+						klog.Errorf("DeletedFinalStateUnknown contained non-EndpointSlice object: %v", deletedState.Obj)
+						return
+					}
+				}
+				podIPBackendPool.enqueueEndpointSlice(endpointSlice)
+			},
+		})
+		az.endpointSliceLister = endpointSliceInformer.Lister()
+		go wait.Until(podIPBackendPool.runWorker, time.Second, wait.NeverStop)
+	}
 }
 
 // updateNodeCaches updates local cache for node's zones and external resource groups.
@@ -1100,6 +1405,7 @@ func (az *Cloud) updateNodeCaches(prevNode, newNode *v1.Node) {
 		// if the node is being deleted from the cluster, exclude it from load balancers
 		if newNode == nil {
 			az.excludeLoadBalancerNodes.Insert(prevNode.ObjectMeta.Name)
+			delete(az.instanceStates, prevNode.ObjectMeta.Name)
 		}
 
 		// Remove from nodePrivateIPs cache.
@@ -1107,6 +1413,13 @@ func (az *Cloud) updateNodeCaches(prevNode, newNode *v1.Node) {
 			klog.V(4).Infof("removing IP address %s of the node %s", address, prevNode.Name)
 			az.nodePrivateIPs[prevNode.Name].Delete(address)
 		}
+
+		// Invalidate the instance of the deleted node or the node whose provider ID is changed.
+		az.invalidateInstanceInventory(prevNode, newNode)
+	}
+
+	if az.vmManagementTypes != nil {
+		az.vmManagementTypes.update(prevNode, newNode)
 	}
 
 	if newNode != nil {
@@ -1128,7 +1441,6 @@ func (az *Cloud) updateNodeCaches(prevNode, newNode *v1.Node) {
 			az.nodeResourceGroups[newNode.ObjectMeta.Name] = strings.ToLower(newRG)
 		}
 
-		_, hasExcludeBalancerLabel := newNode.ObjectMeta.Labels[v1.LabelNodeExcludeBalancers]
 		managed, ok := newNode.ObjectMeta.Labels[consts.ManagedByAzureLabel]
 		isNodeManagedByCloudProvider := !ok || !strings.EqualFold(managed, consts.NotManagedByAzureLabelValue)
 
@@ -1138,26 +1450,7 @@ func (az *Cloud) updateNodeCaches(prevNode, newNode *v1.Node) {
 		}
 
 		// Update excludeLoadBalancerNodes cache
-		switch {
-		case !isNodeManagedByCloudProvider:
-			az.excludeLoadBalancerNodes.Insert(newNode.ObjectMeta.Name)
-
-		case hasExcludeBalancerLabel:
-			az.excludeLoadBalancerNodes.Insert(newNode.ObjectMeta.Name)
-
-		case !isNodeReady(newNode) && nodemanager.GetCloudTaint(newNode.Spec.Taints) == nil:
-			// If not in ready state and not a newly created node, add to excludeLoadBalancerNodes cache.
-			// New nodes (tainted with "node.cloudprovider.kubernetes.io/uninitialized") should not be
-			// excluded from load balancers regardless of their state, so as to reduce the number of
-			// VMSS API calls and not provoke VMScaleSetActiveModelsCountLimitReached.
-			// (https://github.com/kubernetes-sigs/cloud-provider-azure/issues/851)
-			az.excludeLoadBalancerNodes.Insert(newNode.ObjectMeta.Name)
-
-		default:
-			// Nodes not falling into the three cases above are valid backends and
-			// should not appear in excludeLoadBalancerNodes cache.
-			az.excludeLoadBalancerNodes.Delete(newNode.ObjectMeta.Name)
-		}
+		az.updateExcludeLoadBalancerNodes(newNode)
 
 		// Add to nodePrivateIPs cache
 		for _, address := range getNodePrivateIPAddresses(newNode) {
@@ -1171,6 +1464,40 @@ func (az *Cloud) updateNodeCaches(prevNode, newNode *v1.Node) {
 	}
 }
 
+// updateExcludeLoadBalancerNodes adds the node to or removes it from the excludeLoadBalancerNodes cache. It
+// should be called with nodeCachesLock held.
+func (az *Cloud) updateExcludeLoadBalancerNodes(node *v1.Node) {
+	_, hasExcludeBalancerLabel := node.ObjectMeta.Labels[v1.LabelNodeExcludeBalancers]
+	managed, ok := node.ObjectMeta.Labels[consts.ManagedByAzureLabel]
+	isNodeManagedByCloudProvider := !ok || !strings.EqualFold(managed, consts.NotManagedByAzureLabelValue)
+
+	switch {
+	case !isNodeManagedByCloudProvider:
+		az.excludeLoadBalancerNodes.Insert(node.ObjectMeta.Name)
+
+	case hasExcludeBalancerLabel:
+		az.excludeLoadBalancerNodes.Insert(node.ObjectMeta.Name)
+
+	case !isNodeReady(node) && nodemanager.GetCloudTaint(node.Spec.Taints) == nil:
+		// If not in ready state and not a newly created node, add to excludeLoadBalancerNodes cache.
+		// New nodes (tainted with "node.cloudprovider.kubernetes.io/uninitialized") should not be
+		// excluded from load balancers regardless of their state, so as to reduce the number of
+		// VMSS API calls and not provoke VMScaleSetActiveModelsCountLimitReached.
+		// (https://github.com/kubernetes-sigs/cloud-provider-azure/issues/851)
+		az.excludeLoadBalancerNodes.Insert(node.ObjectMeta.Name)
+
+	case az.isInstanceDegraded(node.ObjectMeta.Name):
+		// The VM is found stopped, deallocated, hibernated or failed by the instance state controller, and it
+		// is removed from the backend pools until it recovers.
+		az.excludeLoadBalancerNodes.Insert(node.ObjectMeta.Name)
+
+	default:
+		// Nodes not falling into the four cases above are valid backends and
+		// should not appear in excludeLoadBalancerNodes cache.
+		az.excludeLoadBalancerNodes.Delete(node.ObjectMeta.Name)
+	}
+}
+
 // GetActiveZones returns all the zones in which k8s nodes are currently running.
 func (az *Cloud) GetActiveZones() (sets.String, error) {
 	if az.nodeInformerSynced == nil {
@@ -0,0 +1,809 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/Azure/go-autorest/autorest/azure"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	servicehelpers "k8s.io/cloud-provider/service/helpers"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+const (
+	applicationGatewayNameSuffix           = "appgw"
+	applicationGatewayPublicIPSuffix       = "pip"
+	applicationGatewayIPConfigName         = "appGatewayIPConfig"
+	applicationGatewayFrontendIPConfigName = "appGatewayFrontendIP"
+	applicationGatewayDefaultCapacity      = 2
+	applicationGatewayRequestTimeout       = 30
+	// applicationGatewayProbeHost is the host header of the health probes sent to the node ports.
+	applicationGatewayProbeHost = "127.0.0.1"
+	// applicationGatewayMaxRulePriority is the maximum priority of a request routing rule.
+	applicationGatewayMaxRulePriority = 20000
+
+	appGwFrontendPorts       = "frontendPorts"
+	appGwFrontendIPConfigs   = "frontendIPConfigurations"
+	appGwHTTPListeners       = "httpListeners"
+	appGwBackendAddressPools = "backendAddressPools"
+	appGwBackendHTTPSettings = "backendHttpSettingsCollection"
+	appGwProbes              = "probes"
+	appGwSslCertificates     = "sslCertificates"
+)
+
+// applicationGatewayChildren are the application gateway resources owned by one service.
+// All of them are named after the rule prefix of the service.
+type applicationGatewayChildren struct {
+	frontendPorts   []network.ApplicationGatewayFrontendPort
+	listeners       []network.ApplicationGatewayHTTPListener
+	backendPools    []network.ApplicationGatewayBackendAddressPool
+	backendSettings []network.ApplicationGatewayBackendHTTPSettings
+	probes          []network.ApplicationGatewayProbe
+	rules           []network.ApplicationGatewayRequestRoutingRule
+	sslCertificates []network.ApplicationGatewaySslCertificate
+}
+
+// getApplicationGatewayName returns the name of the application gateway shared by the services of the cluster.
+func (az *Cloud) getApplicationGatewayName(clusterName string) string {
+	if az.ApplicationGatewayName != "" {
+		return az.ApplicationGatewayName
+	}
+	return fmt.Sprintf("%s-%s", clusterName, applicationGatewayNameSuffix)
+}
+
+func getApplicationGatewayPublicIPName(gwName string) string {
+	return fmt.Sprintf("%s-%s", gwName, applicationGatewayPublicIPSuffix)
+}
+
+// reconcileServiceApplicationGateway programs the application gateway of the service and returns its status.
+func (az *Cloud) reconcileServiceApplicationGateway(clusterName string, service *v1.Service, nodes []*v1.Node, sc *serviceConditions) (*v1.LoadBalancerStatus, error) {
+	serviceName := getServiceName(service)
+	gw, err := az.reconcileApplicationGateway(clusterName, service, nodes, true /* wantGateway */)
+	if err != nil {
+		klog.Errorf("reconcileApplicationGateway(%s) failed: %v", serviceName, err)
+		az.setServiceConditionFailed(sc, consts.ServiceConditionApplicationGatewayReady, err)
+		return nil, err
+	}
+
+	status, err := az.getApplicationGatewayStatus(gw)
+	if err != nil {
+		klog.Errorf("getApplicationGatewayStatus(%s) failed: %v", serviceName, err)
+		az.setServiceConditionFailed(sc, consts.ServiceConditionApplicationGatewayReady, err)
+		return nil, err
+	}
+	az.setServiceConditionReady(sc, consts.ServiceConditionApplicationGatewayReady, pointer.StringDeref(gw.ID, ""))
+	return status, nil
+}
+
+// getServiceApplicationGateway returns the application gateway of the cluster and whether the service has listeners on it.
+func (az *Cloud) getServiceApplicationGateway(clusterName string, service *v1.Service) (*network.ApplicationGateway, bool, error) {
+	gw, exists, err := az.getApplicationGateway(az.getApplicationGatewayName(clusterName))
+	if err != nil || !exists {
+		return nil, false, err
+	}
+
+	if gw.ApplicationGatewayPropertiesFormat != nil && gw.HTTPListeners != nil {
+		for _, listener := range *gw.HTTPListeners {
+			if az.serviceOwnsRule(service, pointer.StringDeref(listener.Name, "")) {
+				return &gw, true, nil
+			}
+		}
+	}
+	return &gw, false, nil
+}
+
+// reconcileApplicationGateway adds the listeners, backend pools and probes of the service to the application gateway
+// when wantGateway is true, or removes them otherwise. The application gateway is created if it does not exist, and
+// it is deleted together with its public IP after the last service is removed if it was created by the cloud provider.
+func (az *Cloud) reconcileApplicationGateway(clusterName string, service *v1.Service, nodes []*v1.Node, wantGateway bool) (*network.ApplicationGateway, error) {
+	serviceName := getServiceName(service)
+	gwName := az.getApplicationGatewayName(clusterName)
+	klog.V(2).Infof("reconcileApplicationGateway for service(%s): gateway(%s) - wantGateway(%t): started", serviceName, gwName, wantGateway)
+
+	gw, exists, err := az.getApplicationGateway(gwName)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if !wantGateway {
+			return nil, nil
+		}
+		if gw, err = az.newApplicationGateway(clusterName, service, gwName); err != nil {
+			return nil, err
+		}
+	}
+	if gw.ApplicationGatewayPropertiesFormat == nil {
+		gw.ApplicationGatewayPropertiesFormat = &network.ApplicationGatewayPropertiesFormat{}
+	}
+
+	expected := &applicationGatewayChildren{}
+	if wantGateway {
+		if expected, err = az.getExpectedApplicationGatewayChildren(service, &gw, nodes); err != nil {
+			return nil, err
+		}
+	}
+
+	changed := az.reconcileApplicationGatewayChildren(&gw, service, expected)
+	if !changed && exists {
+		klog.V(2).Infof("reconcileApplicationGateway for service(%s): gateway(%s) is up to date", serviceName, gwName)
+		return &gw, nil
+	}
+
+	if !wantGateway && isApplicationGatewayEmpty(&gw) && strings.EqualFold(pointer.StringDeref(gw.Tags[consts.ClusterNameKey], ""), clusterName) {
+		klog.V(2).Infof("reconcileApplicationGateway for service(%s): deleting gateway(%s) since it has no rules", serviceName, gwName)
+		if err := az.DeleteApplicationGateway(service, gwName); err != nil {
+			return nil, err
+		}
+		if err := az.DeletePublicIP(service, az.ApplicationGatewayResourceGroup, getApplicationGatewayPublicIPName(gwName)); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	klog.V(2).Infof("reconcileApplicationGateway for service(%s): updating gateway(%s)", serviceName, gwName)
+	if err := az.CreateOrUpdateApplicationGateway(service, gw); err != nil {
+		return nil, err
+	}
+	if az.inLoadBalancerPlan(service) {
+		return &gw, nil
+	}
+
+	updated, exists, err := az.getApplicationGateway(gwName)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("application gateway %s not found after update", gwName)
+	}
+	return &updated, nil
+}
+
+// newApplicationGateway builds an application gateway with a public frontend in the configured subnet.
+// The public IP of the frontend is created if it does not exist.
+func (az *Cloud) newApplicationGateway(clusterName string, service *v1.Service, gwName string) (network.ApplicationGateway, error) {
+	if az.ApplicationGatewaySubnetName == "" {
+		return network.ApplicationGateway{}, fmt.Errorf("application gateway %s not found and applicationGatewaySubnetName is not set to create it", gwName)
+	}
+	subnet, existsSubnet, err := az.getSubnet(az.VnetName, az.ApplicationGatewaySubnetName)
+	if err != nil {
+		return network.ApplicationGateway{}, err
+	}
+	if !existsSubnet {
+		return network.ApplicationGateway{}, fmt.Errorf("failed to get subnet %s/%s of application gateway %s", az.VnetName, az.ApplicationGatewaySubnetName, gwName)
+	}
+
+	pipID, err := az.ensureApplicationGatewayPublicIP(clusterName, service, gwName)
+	if err != nil {
+		return network.ApplicationGateway{}, err
+	}
+
+	sku := network.StandardV2
+	tier := network.ApplicationGatewayTierStandardV2
+	if strings.EqualFold(az.ApplicationGatewaySku, string(network.WAFV2)) {
+		sku = network.WAFV2
+		tier = network.ApplicationGatewayTierWAFV2
+	}
+	capacity := az.ApplicationGatewayCapacity
+	if capacity <= 0 {
+		capacity = applicationGatewayDefaultCapacity
+	}
+
+	gw := network.ApplicationGateway{
+		Name:     pointer.String(gwName),
+		Location: pointer.String(az.Location),
+		Tags: map[string]*string{
+			consts.ClusterNameKey: pointer.String(clusterName),
+		},
+		ApplicationGatewayPropertiesFormat: &network.ApplicationGatewayPropertiesFormat{
+			Sku: &network.ApplicationGatewaySku{
+				Name:     sku,
+				Tier:     tier,
+				Capacity: pointer.Int32(capacity),
+			},
+			GatewayIPConfigurations: &[]network.ApplicationGatewayIPConfiguration{
+				{
+					Name: pointer.String(applicationGatewayIPConfigName),
+					ApplicationGatewayIPConfigurationPropertiesFormat: &network.ApplicationGatewayIPConfigurationPropertiesFormat{
+						Subnet: &network.SubResource{ID: subnet.ID},
+					},
+				},
+			},
+			FrontendIPConfigurations: &[]network.ApplicationGatewayFrontendIPConfiguration{
+				{
+					Name: pointer.String(applicationGatewayFrontendIPConfigName),
+					ApplicationGatewayFrontendIPConfigurationPropertiesFormat: &network.ApplicationGatewayFrontendIPConfigurationPropertiesFormat{
+						PublicIPAddress: &network.SubResource{ID: pointer.String(pipID)},
+					},
+				},
+			},
+		},
+	}
+	if az.ApplicationGatewayFirewallPolicyID != "" {
+		gw.FirewallPolicy = &network.SubResource{ID: pointer.String(az.ApplicationGatewayFirewallPolicyID)}
+	}
+	if az.ApplicationGatewayIdentityID != "" {
+		gw.Identity = &network.ManagedServiceIdentity{
+			Type: network.ResourceIdentityTypeUserAssigned,
+			UserAssignedIdentities: map[string]*network.ManagedServiceIdentityUserAssignedIdentitiesValue{
+				az.ApplicationGatewayIdentityID: {},
+			},
+		}
+	}
+	return gw, nil
+}
+
+// ensureApplicationGatewayPublicIP creates the public IP of the application gateway frontend if it does not exist.
+func (az *Cloud) ensureApplicationGatewayPublicIP(clusterName string, service *v1.Service, gwName string) (string, error) {
+	pipName := getApplicationGatewayPublicIPName(gwName)
+	pip, exists, err := az.getPublicIPAddress(az.ApplicationGatewayResourceGroup, pipName, azcache.CacheReadTypeDefault)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return pointer.StringDeref(pip.ID, ""), nil
+	}
+
+	pip = network.PublicIPAddress{
+		Name:     pointer.String(pipName),
+		Location: pointer.String(az.Location),
+		Sku: &network.PublicIPAddressSku{
+			Name: network.PublicIPAddressSkuNameStandard,
+		},
+		Tags: map[string]*string{
+			consts.ClusterNameKey: pointer.String(clusterName),
+		},
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+			PublicIPAllocationMethod: network.Static,
+		},
+	}
+	klog.V(2).Infof("ensureApplicationGatewayPublicIP for service(%s): creating public IP %s", getServiceName(service), pipName)
+	if err := az.CreateOrUpdatePIP(service, az.ApplicationGatewayResourceGroup, pip); err != nil {
+		return "", err
+	}
+	return az.getPublicIPAddressID(az.ApplicationGatewayResourceGroup, pipName), nil
+}
+
+// getApplicationGatewayStatus returns the address of the public frontend of the application gateway.
+func (az *Cloud) getApplicationGatewayStatus(gw *network.ApplicationGateway) (*v1.LoadBalancerStatus, error) {
+	fip := getApplicationGatewayPublicFrontend(gw)
+	if fip == nil {
+		return nil, fmt.Errorf("application gateway %s has no public frontend IP configuration", pointer.StringDeref(gw.Name, ""))
+	}
+
+	pipID := pointer.StringDeref(fip.PublicIPAddress.ID, "")
+	resource, err := azure.ParseResourceID(pipID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public IP ID %s of application gateway %s: %w", pipID, pointer.StringDeref(gw.Name, ""), err)
+	}
+	pip, exists, err := az.getPublicIPAddress(resource.ResourceGroup, resource.ResourceName, azcache.CacheReadTypeDefault)
+	if err != nil {
+		return nil, err
+	}
+	if !exists || pip.PublicIPAddressPropertiesFormat == nil || pip.IPAddress == nil {
+		klog.V(2).Infof("getApplicationGatewayStatus: public IP %s of application gateway %s has no address yet", pipID, pointer.StringDeref(gw.Name, ""))
+		return &v1.LoadBalancerStatus{}, nil
+	}
+	return &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: *pip.IPAddress}}}, nil
+}
+
+func getApplicationGatewayPublicFrontend(gw *network.ApplicationGateway) *network.ApplicationGatewayFrontendIPConfiguration {
+	if gw.ApplicationGatewayPropertiesFormat == nil || gw.FrontendIPConfigurations == nil {
+		return nil
+	}
+	for i := range *gw.FrontendIPConfigurations {
+		fip := (*gw.FrontendIPConfigurations)[i]
+		if fip.ApplicationGatewayFrontendIPConfigurationPropertiesFormat != nil && fip.PublicIPAddress != nil {
+			return &fip
+		}
+	}
+	return nil
+}
+
+// getExpectedApplicationGatewayChildren builds one listener, backend setting, probe and rule for each port of the service.
+// The backend pool contains the same node IPs as the load balancer backend pool of the nodeIP type and the traffic is
+// sent to the node ports.
+func (az *Cloud) getExpectedApplicationGatewayChildren(service *v1.Service, gw *network.ApplicationGateway, nodes []*v1.Node) (*applicationGatewayChildren, error) {
+	if consts.IsK8sServiceUsingInternalLoadBalancer(service) {
+		return nil, fmt.Errorf("internal services are not supported by application gateway")
+	}
+	fip := getApplicationGatewayPublicFrontend(gw)
+	if fip == nil {
+		return nil, fmt.Errorf("application gateway %s has no public frontend IP configuration", pointer.StringDeref(gw.Name, ""))
+	}
+
+	gwName := pointer.StringDeref(gw.Name, "")
+	prefix := az.getRulePrefix(service)
+	children := &applicationGatewayChildren{}
+
+	backendAddresses, err := az.getApplicationGatewayBackendAddresses(service, nodes)
+	if err != nil {
+		return nil, err
+	}
+	children.backendPools = append(children.backendPools, network.ApplicationGatewayBackendAddressPool{
+		Name: pointer.String(prefix),
+		ApplicationGatewayBackendAddressPoolPropertiesFormat: &network.ApplicationGatewayBackendAddressPoolPropertiesFormat{
+			BackendAddresses: &backendAddresses,
+		},
+	})
+
+	listenerProtocol := network.HTTP
+	var sslCertificate *network.SubResource
+	if secretID := strings.TrimSpace(service.Annotations[consts.ServiceAnnotationApplicationGatewaySSLCertificateSecretID]); secretID != "" {
+		listenerProtocol = network.HTTPS
+		sslCertificate = &network.SubResource{ID: pointer.String(az.getApplicationGatewayChildID(gwName, appGwSslCertificates, prefix))}
+		children.sslCertificates = append(children.sslCertificates, network.ApplicationGatewaySslCertificate{
+			Name: pointer.String(prefix),
+			ApplicationGatewaySslCertificatePropertiesFormat: &network.ApplicationGatewaySslCertificatePropertiesFormat{
+				KeyVaultSecretID: pointer.String(secretID),
+			},
+		})
+	}
+	var firewallPolicy *network.SubResource
+	if policyID := strings.TrimSpace(service.Annotations[consts.ServiceAnnotationApplicationGatewayFirewallPolicyID]); policyID != "" {
+		firewallPolicy = &network.SubResource{ID: pointer.String(policyID)}
+	}
+	cookieBasedAffinity := network.Disabled
+	if service.Spec.SessionAffinity == v1.ServiceAffinityClientIP {
+		cookieBasedAffinity = network.Enabled
+	}
+
+	// The health check node port reports whether the node has local endpoints, so it takes precedence
+	// over the probes of the ports, as it does for the load balancer.
+	var nodeEndpointProbe *network.ApplicationGatewayProbe
+	if servicehelpers.NeedsHealthCheck(service) {
+		podPresencePath, podPresencePort := servicehelpers.GetServiceHealthCheckPathPort(service)
+		probe, err := newApplicationGatewayProbe(az.getLoadBalancerRuleName(service, v1.ProtocolTCP, podPresencePort), &network.Probe{
+			ProbePropertiesFormat: &network.ProbePropertiesFormat{
+				RequestPath:       pointer.String(podPresencePath),
+				Protocol:          network.ProbeProtocolHTTP,
+				Port:              pointer.Int32(podPresencePort),
+				IntervalInSeconds: pointer.Int32(consts.HealthProbeDefaultProbeInterval),
+				NumberOfProbes:    pointer.Int32(consts.HealthProbeDefaultNumOfProbe),
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		nodeEndpointProbe = &probe
+		children.probes = append(children.probes, probe)
+	}
+
+	for _, port := range service.Spec.Ports {
+		if port.Protocol != v1.ProtocolTCP {
+			return nil, fmt.Errorf("application gateway only supports TCP ports, got %s for port %d", port.Protocol, port.Port)
+		}
+		if conflict := findApplicationGatewayFrontendPortConflict(gw, port.Port, func(name string) bool { return az.serviceOwnsRule(service, name) }); conflict != "" {
+			return nil, fmt.Errorf("port %d is already used by the frontend port %s of application gateway %s", port.Port, conflict, gwName)
+		}
+
+		ruleName := az.getLoadBalancerRuleName(service, port.Protocol, port.Port)
+		probeName := ruleName
+		if nodeEndpointProbe != nil {
+			probeName = pointer.StringDeref(nodeEndpointProbe.Name, "")
+		} else {
+			lbProbe, err := az.buildHealthProbeRulesForPort(service, port, ruleName)
+			if err != nil {
+				return nil, err
+			}
+			probe, err := newApplicationGatewayProbe(ruleName, lbProbe)
+			if err != nil {
+				return nil, err
+			}
+			children.probes = append(children.probes, probe)
+		}
+
+		children.frontendPorts = append(children.frontendPorts, network.ApplicationGatewayFrontendPort{
+			Name: pointer.String(ruleName),
+			ApplicationGatewayFrontendPortPropertiesFormat: &network.ApplicationGatewayFrontendPortPropertiesFormat{
+				Port: pointer.Int32(port.Port),
+			},
+		})
+		children.listeners = append(children.listeners, network.ApplicationGatewayHTTPListener{
+			Name: pointer.String(ruleName),
+			ApplicationGatewayHTTPListenerPropertiesFormat: &network.ApplicationGatewayHTTPListenerPropertiesFormat{
+				FrontendIPConfiguration: &network.SubResource{ID: pointer.String(az.getApplicationGatewayChildID(gwName, appGwFrontendIPConfigs, pointer.StringDeref(fip.Name, "")))},
+				FrontendPort:            &network.SubResource{ID: pointer.String(az.getApplicationGatewayChildID(gwName, appGwFrontendPorts, ruleName))},
+				Protocol:                listenerProtocol,
+				SslCertificate:          sslCertificate,
+				FirewallPolicy:          firewallPolicy,
+			},
+		})
+		children.backendSettings = append(children.backendSettings, network.ApplicationGatewayBackendHTTPSettings{
+			Name: pointer.String(ruleName),
+			ApplicationGatewayBackendHTTPSettingsPropertiesFormat: &network.ApplicationGatewayBackendHTTPSettingsPropertiesFormat{
+				Port:                pointer.Int32(port.NodePort),
+				Protocol:            network.HTTP,
+				CookieBasedAffinity: cookieBasedAffinity,
+				RequestTimeout:      pointer.Int32(applicationGatewayRequestTimeout),
+				Probe:               &network.SubResource{ID: pointer.String(az.getApplicationGatewayChildID(gwName, appGwProbes, probeName))},
+			},
+		})
+		children.rules = append(children.rules, network.ApplicationGatewayRequestRoutingRule{
+			Name: pointer.String(ruleName),
+			ApplicationGatewayRequestRoutingRulePropertiesFormat: &network.ApplicationGatewayRequestRoutingRulePropertiesFormat{
+				RuleType:            network.Basic,
+				HTTPListener:        &network.SubResource{ID: pointer.String(az.getApplicationGatewayChildID(gwName, appGwHTTPListeners, ruleName))},
+				BackendAddressPool:  &network.SubResource{ID: pointer.String(az.getApplicationGatewayChildID(gwName, appGwBackendAddressPools, prefix))},
+				BackendHTTPSettings: &network.SubResource{ID: pointer.String(az.getApplicationGatewayChildID(gwName, appGwBackendHTTPSettings, ruleName))},
+			},
+		})
+	}
+
+	if err := assignApplicationGatewayRulePriorities(gw, children.rules); err != nil {
+		return nil, err
+	}
+	return children, nil
+}
+
+// getApplicationGatewayBackendAddresses returns the private IPs of the nodes which would be added to
+// the load balancer backend pool of the nodeIP type.
+func (az *Cloud) getApplicationGatewayBackendAddresses(service *v1.Service, nodes []*v1.Node) ([]network.ApplicationGatewayBackendAddress, error) {
+	ips := sets.NewString()
+	for _, node := range nodes {
+		if isControlPlaneNode(node) {
+			klog.V(4).Infof("getApplicationGatewayBackendAddresses: skipping control plane node %s", node.Name)
+			continue
+		}
+		shouldExclude, err := az.ShouldNodeExcludedFromLoadBalancer(node.Name)
+		if err != nil {
+			return nil, err
+		}
+		if shouldExclude {
+			klog.V(4).Infof("getApplicationGatewayBackendAddresses: skipping excluded node %s", node.Name)
+			continue
+		}
+		if ip := getNodePrivateIPAddress(service, node); ip != "" {
+			ips.Insert(ip)
+		}
+	}
+
+	addresses := make([]network.ApplicationGatewayBackendAddress, 0, ips.Len())
+	for _, ip := range ips.List() {
+		addresses = append(addresses, network.ApplicationGatewayBackendAddress{IPAddress: pointer.String(ip)})
+	}
+	return addresses, nil
+}
+
+// newApplicationGatewayProbe converts a load balancer health probe to an application gateway probe.
+// The application gateway only probes the backends with HTTP or HTTPS requests, so TCP probes are refused.
+func newApplicationGatewayProbe(name string, lbProbe *network.Probe) (network.ApplicationGatewayProbe, error) {
+	var protocol network.ApplicationGatewayProtocol
+	switch {
+	case lbProbe == nil || lbProbe.ProbePropertiesFormat == nil:
+		return network.ApplicationGatewayProbe{}, fmt.Errorf("the health probe %s is required by application gateway", name)
+	case lbProbe.Protocol == network.ProbeProtocolHTTP:
+		protocol = network.HTTP
+	case lbProbe.Protocol == network.ProbeProtocolHTTPS:
+		protocol = network.HTTPS
+	default:
+		return network.ApplicationGatewayProbe{}, fmt.Errorf("the %s health probe %s is not supported by application gateway, set annotation %s to http or https", lbProbe.Protocol, name, consts.ServiceAnnotationLoadBalancerHealthProbeProtocol)
+	}
+	path := consts.HealthProbeDefaultRequestPath
+	if lbProbe.RequestPath != nil {
+		path = *lbProbe.RequestPath
+	}
+	return network.ApplicationGatewayProbe{
+		Name: pointer.String(name),
+		ApplicationGatewayProbePropertiesFormat: &network.ApplicationGatewayProbePropertiesFormat{
+			Protocol:           protocol,
+			Host:               pointer.String(applicationGatewayProbeHost),
+			Path:               pointer.String(path),
+			Port:               lbProbe.Port,
+			Interval:           lbProbe.IntervalInSeconds,
+			Timeout:            lbProbe.IntervalInSeconds,
+			UnhealthyThreshold: lbProbe.NumberOfProbes,
+		},
+	}, nil
+}
+
+// findApplicationGatewayFrontendPortConflict returns the name of the frontend port using the port which is not owned by the service.
+func findApplicationGatewayFrontendPortConflict(gw *network.ApplicationGateway, port int32, owns func(string) bool) string {
+	if gw.FrontendPorts == nil {
+		return ""
+	}
+	for _, frontendPort := range *gw.FrontendPorts {
+		name := pointer.StringDeref(frontendPort.Name, "")
+		if owns(name) || frontendPort.ApplicationGatewayFrontendPortPropertiesFormat == nil {
+			continue
+		}
+		if pointer.Int32Deref(frontendPort.Port, 0) == port {
+			return name
+		}
+	}
+	return ""
+}
+
+func isApplicationGatewayEmpty(gw *network.ApplicationGateway) bool {
+	return gw.RequestRoutingRules == nil || len(*gw.RequestRoutingRules) == 0
+}
+
+// reconcileApplicationGatewayChildren replaces the children owned by the service with the expected ones
+// and returns true if any of them is changed.
+func (az *Cloud) reconcileApplicationGatewayChildren(gw *network.ApplicationGateway, service *v1.Service, expected *applicationGatewayChildren) bool {
+	owns := func(name *string) bool {
+		return az.serviceOwnsRule(service, pointer.StringDeref(name, ""))
+	}
+	var changed bool
+	frontendPorts := make([]network.ApplicationGatewayFrontendPort, 0)
+	var owned []network.ApplicationGatewayFrontendPort
+	if gw.FrontendPorts != nil {
+		for _, existing := range *gw.FrontendPorts {
+			if owns(existing.Name) {
+				owned = append(owned, existing)
+				continue
+			}
+			frontendPorts = append(frontendPorts, existing)
+		}
+	}
+	changed = changed || !equalApplicationGatewayChildren(len(owned), len(expected.frontendPorts), func(i, j int) bool {
+		return equalApplicationGatewayFrontendPort(owned[i], expected.frontendPorts[j])
+	})
+	frontendPorts = append(frontendPorts, expected.frontendPorts...)
+	gw.FrontendPorts = &frontendPorts
+
+	listeners := make([]network.ApplicationGatewayHTTPListener, 0)
+	var ownedListeners []network.ApplicationGatewayHTTPListener
+	if gw.HTTPListeners != nil {
+		for _, existing := range *gw.HTTPListeners {
+			if owns(existing.Name) {
+				ownedListeners = append(ownedListeners, existing)
+				continue
+			}
+			listeners = append(listeners, existing)
+		}
+	}
+	changed = changed || !equalApplicationGatewayChildren(len(ownedListeners), len(expected.listeners), func(i, j int) bool {
+		return equalApplicationGatewayListener(ownedListeners[i], expected.listeners[j])
+	})
+	listeners = append(listeners, expected.listeners...)
+	gw.HTTPListeners = &listeners
+
+	pools := make([]network.ApplicationGatewayBackendAddressPool, 0)
+	var ownedPools []network.ApplicationGatewayBackendAddressPool
+	if gw.BackendAddressPools != nil {
+		for _, existing := range *gw.BackendAddressPools {
+			if owns(existing.Name) {
+				ownedPools = append(ownedPools, existing)
+				continue
+			}
+			pools = append(pools, existing)
+		}
+	}
+	changed = changed || !equalApplicationGatewayChildren(len(ownedPools), len(expected.backendPools), func(i, j int) bool {
+		return equalApplicationGatewayBackendPool(ownedPools[i], expected.backendPools[j])
+	})
+	pools = append(pools, expected.backendPools...)
+	gw.BackendAddressPools = &pools
+
+	settings := make([]network.ApplicationGatewayBackendHTTPSettings, 0)
+	var ownedSettings []network.ApplicationGatewayBackendHTTPSettings
+	if gw.BackendHTTPSettingsCollection != nil {
+		for _, existing := range *gw.BackendHTTPSettingsCollection {
+			if owns(existing.Name) {
+				ownedSettings = append(ownedSettings, existing)
+				continue
+			}
+			settings = append(settings, existing)
+		}
+	}
+	changed = changed || !equalApplicationGatewayChildren(len(ownedSettings), len(expected.backendSettings), func(i, j int) bool {
+		return equalApplicationGatewayBackendSettings(ownedSettings[i], expected.backendSettings[j])
+	})
+	settings = append(settings, expected.backendSettings...)
+	gw.BackendHTTPSettingsCollection = &settings
+
+	probes := make([]network.ApplicationGatewayProbe, 0)
+	var ownedProbes []network.ApplicationGatewayProbe
+	if gw.Probes != nil {
+		for _, existing := range *gw.Probes {
+			if owns(existing.Name) {
+				ownedProbes = append(ownedProbes, existing)
+				continue
+			}
+			probes = append(probes, existing)
+		}
+	}
+	changed = changed || !equalApplicationGatewayChildren(len(ownedProbes), len(expected.probes), func(i, j int) bool {
+		return equalApplicationGatewayProbe(ownedProbes[i], expected.probes[j])
+	})
+	probes = append(probes, expected.probes...)
+	gw.Probes = &probes
+
+	rules := make([]network.ApplicationGatewayRequestRoutingRule, 0)
+	var ownedRules []network.ApplicationGatewayRequestRoutingRule
+	if gw.RequestRoutingRules != nil {
+		for _, existing := range *gw.RequestRoutingRules {
+			if owns(existing.Name) {
+				ownedRules = append(ownedRules, existing)
+				continue
+			}
+			rules = append(rules, existing)
+		}
+	}
+	changed = changed || !equalApplicationGatewayChildren(len(ownedRules), len(expected.rules), func(i, j int) bool {
+		return equalApplicationGatewayRule(ownedRules[i], expected.rules[j])
+	})
+	rules = append(rules, expected.rules...)
+	gw.RequestRoutingRules = &rules
+
+	certificates := make([]network.ApplicationGatewaySslCertificate, 0)
+	var ownedCertificates []network.ApplicationGatewaySslCertificate
+	if gw.SslCertificates != nil {
+		for _, existing := range *gw.SslCertificates {
+			if owns(existing.Name) {
+				ownedCertificates = append(ownedCertificates, existing)
+				continue
+			}
+			certificates = append(certificates, existing)
+		}
+	}
+	changed = changed || !equalApplicationGatewayChildren(len(ownedCertificates), len(expected.sslCertificates), func(i, j int) bool {
+		return equalApplicationGatewaySslCertificate(ownedCertificates[i], expected.sslCertificates[j])
+	})
+	certificates = append(certificates, expected.sslCertificates...)
+	gw.SslCertificates = &certificates
+
+	return changed
+}
+
+// assignApplicationGatewayRulePriorities keeps the priorities of the existing rules and assigns
+// the lowest unused priorities to the new ones, since the priority is required by the v2 SKU.
+// An error is returned if all the priorities are used.
+func assignApplicationGatewayRulePriorities(gw *network.ApplicationGateway, rules []network.ApplicationGatewayRequestRoutingRule) error {
+	existingPriorities := map[string]int32{}
+	used := sets.NewInt()
+	if gw.RequestRoutingRules != nil {
+		for _, rule := range *gw.RequestRoutingRules {
+			if rule.ApplicationGatewayRequestRoutingRulePropertiesFormat == nil || rule.Priority == nil {
+				continue
+			}
+			existingPriorities[strings.ToLower(pointer.StringDeref(rule.Name, ""))] = *rule.Priority
+			used.Insert(int(*rule.Priority))
+		}
+	}
+
+	next := 1
+	for i := range rules {
+		if priority, ok := existingPriorities[strings.ToLower(pointer.StringDeref(rules[i].Name, ""))]; ok {
+			rules[i].Priority = pointer.Int32(priority)
+			continue
+		}
+		for used.Has(next) {
+			next++
+		}
+		if next > applicationGatewayMaxRulePriority {
+			return fmt.Errorf("no free priority is left for rule %s of application gateway %s", pointer.StringDeref(rules[i].Name, ""), pointer.StringDeref(gw.Name, ""))
+		}
+		used.Insert(next)
+		rules[i].Priority = pointer.Int32(int32(next))
+	}
+	return nil
+}
+
+// equalApplicationGatewayChildren returns true if every existing child has an equal expected child and vice versa.
+func equalApplicationGatewayChildren(numOfExisting, numOfExpected int, equal func(i, j int) bool) bool {
+	if numOfExisting != numOfExpected {
+		return false
+	}
+	for j := 0; j < numOfExpected; j++ {
+		found := false
+		for i := 0; i < numOfExisting; i++ {
+			if equal(i, j) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func equalApplicationGatewayFrontendPort(existing, expected network.ApplicationGatewayFrontendPort) bool {
+	if !strings.EqualFold(pointer.StringDeref(existing.Name, ""), pointer.StringDeref(expected.Name, "")) ||
+		existing.ApplicationGatewayFrontendPortPropertiesFormat == nil {
+		return false
+	}
+	return pointer.Int32Deref(existing.Port, 0) == pointer.Int32Deref(expected.Port, 0)
+}
+
+func equalApplicationGatewayListener(existing, expected network.ApplicationGatewayHTTPListener) bool {
+	if !strings.EqualFold(pointer.StringDeref(existing.Name, ""), pointer.StringDeref(expected.Name, "")) ||
+		existing.ApplicationGatewayHTTPListenerPropertiesFormat == nil {
+		return false
+	}
+	return existing.Protocol == expected.Protocol &&
+		equalSubResource(existing.FrontendIPConfiguration, expected.FrontendIPConfiguration) &&
+		equalSubResource(existing.FrontendPort, expected.FrontendPort) &&
+		equalSubResource(existing.SslCertificate, expected.SslCertificate) &&
+		equalSubResource(existing.FirewallPolicy, expected.FirewallPolicy)
+}
+
+func equalApplicationGatewayBackendPool(existing, expected network.ApplicationGatewayBackendAddressPool) bool {
+	if !strings.EqualFold(pointer.StringDeref(existing.Name, ""), pointer.StringDeref(expected.Name, "")) ||
+		existing.ApplicationGatewayBackendAddressPoolPropertiesFormat == nil {
+		return false
+	}
+	getIPs := func(addresses *[]network.ApplicationGatewayBackendAddress) []string {
+		ips := []string{}
+		if addresses != nil {
+			for _, address := range *addresses {
+				ips = append(ips, pointer.StringDeref(address.IPAddress, ""))
+			}
+		}
+		sort.Strings(ips)
+		return ips
+	}
+	return strings.Join(getIPs(existing.BackendAddresses), ",") == strings.Join(getIPs(expected.BackendAddresses), ",")
+}
+
+func equalApplicationGatewayBackendSettings(existing, expected network.ApplicationGatewayBackendHTTPSettings) bool {
+	if !strings.EqualFold(pointer.StringDeref(existing.Name, ""), pointer.StringDeref(expected.Name, "")) ||
+		existing.ApplicationGatewayBackendHTTPSettingsPropertiesFormat == nil {
+		return false
+	}
+	return existing.Protocol == expected.Protocol &&
+		existing.CookieBasedAffinity == expected.CookieBasedAffinity &&
+		pointer.Int32Deref(existing.Port, 0) == pointer.Int32Deref(expected.Port, 0) &&
+		pointer.Int32Deref(existing.RequestTimeout, 0) == pointer.Int32Deref(expected.RequestTimeout, 0) &&
+		equalSubResource(existing.Probe, expected.Probe)
+}
+
+func equalApplicationGatewayProbe(existing, expected network.ApplicationGatewayProbe) bool {
+	if !strings.EqualFold(pointer.StringDeref(existing.Name, ""), pointer.StringDeref(expected.Name, "")) ||
+		existing.ApplicationGatewayProbePropertiesFormat == nil {
+		return false
+	}
+	return existing.Protocol == expected.Protocol &&
+		pointer.StringDeref(existing.Host, "") == pointer.StringDeref(expected.Host, "") &&
+		pointer.StringDeref(existing.Path, "") == pointer.StringDeref(expected.Path, "") &&
+		pointer.Int32Deref(existing.Port, 0) == pointer.Int32Deref(expected.Port, 0) &&
+		pointer.Int32Deref(existing.Interval, 0) == pointer.Int32Deref(expected.Interval, 0) &&
+		pointer.Int32Deref(existing.Timeout, 0) == pointer.Int32Deref(expected.Timeout, 0) &&
+		pointer.Int32Deref(existing.UnhealthyThreshold, 0) == pointer.Int32Deref(expected.UnhealthyThreshold, 0)
+}
+
+func equalApplicationGatewayRule(existing, expected network.ApplicationGatewayRequestRoutingRule) bool {
+	if !strings.EqualFold(pointer.StringDeref(existing.Name, ""), pointer.StringDeref(expected.Name, "")) ||
+		existing.ApplicationGatewayRequestRoutingRulePropertiesFormat == nil {
+		return false
+	}
+	return existing.RuleType == expected.RuleType &&
+		pointer.Int32Deref(existing.Priority, 0) == pointer.Int32Deref(expected.Priority, 0) &&
+		equalSubResource(existing.HTTPListener, expected.HTTPListener) &&
+		equalSubResource(existing.BackendAddressPool, expected.BackendAddressPool) &&
+		equalSubResource(existing.BackendHTTPSettings, expected.BackendHTTPSettings)
+}
+
+func equalApplicationGatewaySslCertificate(existing, expected network.ApplicationGatewaySslCertificate) bool {
+	if !strings.EqualFold(pointer.StringDeref(existing.Name, ""), pointer.StringDeref(expected.Name, "")) ||
+		existing.ApplicationGatewaySslCertificatePropertiesFormat == nil {
+		return false
+	}
+	return strings.EqualFold(pointer.StringDeref(existing.KeyVaultSecretID, ""), pointer.StringDeref(expected.KeyVaultSecretID, ""))
+}
@@ -0,0 +1,354 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/applicationgatewayclient/mockapplicationgatewayclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/securitygroupclient/mocksecuritygroupclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/subnetclient/mocksubnetclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func getTestApplicationGatewayNodes() []*v1.Node {
+	return []*v1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+			Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.5"}}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node2"},
+			Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.4"}}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "master", Labels: map[string]string{consts.ControlPlaneNodeRoleLabel: ""}},
+			Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.6"}}},
+		},
+	}
+}
+
+func getTestApplicationGateway(az *Cloud) network.ApplicationGateway {
+	return network.ApplicationGateway{
+		Name: pointer.String("testCluster-appgw"),
+		ID:   pointer.String(az.getApplicationGatewayID("testCluster-appgw")),
+		Tags: map[string]*string{consts.ClusterNameKey: pointer.String(testClusterName)},
+		ApplicationGatewayPropertiesFormat: &network.ApplicationGatewayPropertiesFormat{
+			FrontendIPConfigurations: &[]network.ApplicationGatewayFrontendIPConfiguration{
+				{
+					Name: pointer.String(applicationGatewayFrontendIPConfigName),
+					ApplicationGatewayFrontendIPConfigurationPropertiesFormat: &network.ApplicationGatewayFrontendIPConfigurationPropertiesFormat{
+						PublicIPAddress: &network.SubResource{ID: pointer.String(az.getPublicIPAddressID("rg", "testCluster-appgw-pip"))},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestGetExpectedApplicationGatewayChildren(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	gw := getTestApplicationGateway(az)
+	nodes := getTestApplicationGatewayNodes()
+
+	svc := getTestService("service1", v1.ProtocolTCP, map[string]string{
+		consts.ServiceAnnotationLoadBalancerType:                         consts.LoadBalancerTypeApplicationGateway,
+		consts.ServiceAnnotationApplicationGatewaySSLCertificateSecretID: "https://vault/secrets/cert",
+		consts.ServiceAnnotationLoadBalancerHealthProbeRequestPath:       "/healthy",
+		consts.ServiceAnnotationLoadBalancerHealthProbeProtocol:          "http",
+	}, false, 80, 443)
+	children, err := az.getExpectedApplicationGatewayChildren(&svc, &gw, nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(children.listeners))
+	assert.Equal(t, 2, len(children.rules))
+	assert.Equal(t, 2, len(children.probes))
+	assert.Equal(t, 1, len(children.sslCertificates))
+	assert.Equal(t, network.HTTPS, children.listeners[0].Protocol)
+	assert.Equal(t, pointer.String(az.getApplicationGatewayChildID("testCluster-appgw", appGwSslCertificates, "aservice1")), children.listeners[0].SslCertificate.ID)
+	assert.Equal(t, []network.ApplicationGatewayBackendAddress{
+		{IPAddress: pointer.String("10.0.0.4")},
+		{IPAddress: pointer.String("10.0.0.5")},
+	}, *children.backendPools[0].BackendAddresses)
+	assert.Equal(t, "/healthy", pointer.StringDeref(children.probes[0].Path, ""))
+	assert.Equal(t, svc.Spec.Ports[0].NodePort, pointer.Int32Deref(children.probes[0].Port, 0))
+	assert.Equal(t, svc.Spec.Ports[1].NodePort, pointer.Int32Deref(children.backendSettings[1].Port, 0))
+
+	svc.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeLocal
+	svc.Spec.HealthCheckNodePort = 32000
+	children, err = az.getExpectedApplicationGatewayChildren(&svc, &gw, nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(children.probes))
+	assert.Equal(t, int32(32000), pointer.Int32Deref(children.probes[0].Port, 0))
+	assert.Equal(t, "/healthz", pointer.StringDeref(children.probes[0].Path, ""))
+	assert.Equal(t, children.backendSettings[0].Probe, children.backendSettings[1].Probe)
+
+	tcpProbeService := getTestService("service2", v1.ProtocolTCP, nil, false, 80)
+	_, err = az.getExpectedApplicationGatewayChildren(&tcpProbeService, &gw, nodes)
+	assert.EqualError(t, err, "the Tcp health probe aservice2-TCP-80 is not supported by application gateway, set annotation service.beta.kubernetes.io/azure-load-balancer-health-probe-protocol to http or https")
+
+	udpService := getTestService("service2", v1.ProtocolUDP, nil, false, 53)
+	_, err = az.getExpectedApplicationGatewayChildren(&udpService, &gw, nodes)
+	assert.EqualError(t, err, "application gateway only supports TCP ports, got UDP for port 53")
+
+	gw.FrontendPorts = &[]network.ApplicationGatewayFrontendPort{
+		{
+			Name: pointer.String("aservice3-TCP-80"),
+			ApplicationGatewayFrontendPortPropertiesFormat: &network.ApplicationGatewayFrontendPortPropertiesFormat{
+				Port: pointer.Int32(80),
+			},
+		},
+	}
+	_, err = az.getExpectedApplicationGatewayChildren(&svc, &gw, nodes)
+	assert.EqualError(t, err, "port 80 is already used by the frontend port aservice3-TCP-80 of application gateway testCluster-appgw")
+}
+
+func TestReconcileApplicationGateway(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	svc := getTestService("service1", v1.ProtocolTCP, map[string]string{
+		consts.ServiceAnnotationLoadBalancerType:                consts.LoadBalancerTypeApplicationGateway,
+		consts.ServiceAnnotationLoadBalancerHealthProbeProtocol: "http",
+	}, false, 80)
+	otherSvc := getTestService("service2", v1.ProtocolTCP, map[string]string{
+		consts.ServiceAnnotationLoadBalancerHealthProbeProtocol: "http",
+	}, false, 8080)
+	notFound := &retry.Error{HTTPStatusCode: http.StatusNotFound}
+
+	t.Run("should create the application gateway and its public IP", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		az.ApplicationGatewaySubnetName = "appgw-subnet"
+		mockGWClient := az.ApplicationGatewayClient.(*mockapplicationgatewayclient.MockInterface)
+		mockSubnetClient := az.SubnetsClient.(*mocksubnetclient.MockInterface)
+		mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+
+		created := getTestApplicationGateway(az)
+		mockGWClient.EXPECT().Get(gomock.Any(), "rg", "testCluster-appgw", "").Return(network.ApplicationGateway{}, notFound)
+		mockSubnetClient.EXPECT().Get(gomock.Any(), "rg", "vnet", "appgw-subnet", "").Return(network.Subnet{ID: pointer.String("subnetID")}, nil)
+		mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return(nil, nil).Times(2)
+		mockPIPClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "testCluster-appgw-pip", gomock.Any(), gomock.Any()).Return(nil)
+		mockGWClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "testCluster-appgw", gomock.Any(), "").DoAndReturn(
+			func(_ interface{}, _, _ string, gw network.ApplicationGateway, _ string) *retry.Error {
+				assert.Equal(t, network.StandardV2, gw.Sku.Name)
+				assert.Equal(t, pointer.String("subnetID"), (*gw.GatewayIPConfigurations)[0].Subnet.ID)
+				assert.Equal(t, 1, len(*gw.HTTPListeners))
+				assert.Equal(t, int32(1), pointer.Int32Deref((*gw.RequestRoutingRules)[0].Priority, 0))
+				created.ApplicationGatewayPropertiesFormat = gw.ApplicationGatewayPropertiesFormat
+				return nil
+			})
+		mockGWClient.EXPECT().Get(gomock.Any(), "rg", "testCluster-appgw", "").Return(created, nil)
+
+		gw, err := az.reconcileApplicationGateway(testClusterName, &svc, getTestApplicationGatewayNodes(), true)
+		assert.NoError(t, err)
+		assert.Equal(t, created.ID, gw.ID)
+	})
+
+	t.Run("should not update the application gateway if it is up to date", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		mockGWClient := az.ApplicationGatewayClient.(*mockapplicationgatewayclient.MockInterface)
+
+		existing := getTestApplicationGateway(az)
+		expected, err := az.getExpectedApplicationGatewayChildren(&svc, &existing, getTestApplicationGatewayNodes())
+		assert.NoError(t, err)
+		az.reconcileApplicationGatewayChildren(&existing, &svc, expected)
+		mockGWClient.EXPECT().Get(gomock.Any(), "rg", "testCluster-appgw", "").Return(existing, nil)
+		mockGWClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+		_, err = az.reconcileApplicationGateway(testClusterName, &svc, getTestApplicationGatewayNodes(), true)
+		assert.NoError(t, err)
+	})
+
+	t.Run("should keep the rules of other services when removing the service", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		mockGWClient := az.ApplicationGatewayClient.(*mockapplicationgatewayclient.MockInterface)
+
+		existing := getTestApplicationGateway(az)
+		for _, s := range []v1.Service{svc, otherSvc} {
+			s := s
+			expected, err := az.getExpectedApplicationGatewayChildren(&s, &existing, getTestApplicationGatewayNodes())
+			assert.NoError(t, err)
+			az.reconcileApplicationGatewayChildren(&existing, &s, expected)
+		}
+		assert.Equal(t, 2, len(*existing.RequestRoutingRules))
+		mockGWClient.EXPECT().Get(gomock.Any(), "rg", "testCluster-appgw", "").Return(existing, nil).Times(2)
+		mockGWClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "testCluster-appgw", gomock.Any(), "").DoAndReturn(
+			func(_ interface{}, _, _ string, gw network.ApplicationGateway, _ string) *retry.Error {
+				assert.Equal(t, 1, len(*gw.RequestRoutingRules))
+				assert.Equal(t, "aservice2-TCP-8080", pointer.StringDeref((*gw.RequestRoutingRules)[0].Name, ""))
+				assert.Equal(t, 1, len(*gw.BackendAddressPools))
+				return nil
+			})
+
+		_, err := az.reconcileApplicationGateway(testClusterName, &svc, nil, false)
+		assert.NoError(t, err)
+	})
+
+	t.Run("should delete the application gateway and its public IP after the last service is removed", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		mockGWClient := az.ApplicationGatewayClient.(*mockapplicationgatewayclient.MockInterface)
+		mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+
+		existing := getTestApplicationGateway(az)
+		expected, err := az.getExpectedApplicationGatewayChildren(&svc, &existing, getTestApplicationGatewayNodes())
+		assert.NoError(t, err)
+		az.reconcileApplicationGatewayChildren(&existing, &svc, expected)
+		mockGWClient.EXPECT().Get(gomock.Any(), "rg", "testCluster-appgw", "").Return(existing, nil)
+		mockGWClient.EXPECT().Delete(gomock.Any(), "rg", "testCluster-appgw").Return(nil)
+		mockPIPClient.EXPECT().Delete(gomock.Any(), "rg", "testCluster-appgw-pip").Return(nil)
+
+		gw, err := az.reconcileApplicationGateway(testClusterName, &svc, nil, false)
+		assert.NoError(t, err)
+		assert.Nil(t, gw)
+	})
+
+	t.Run("should report an error if the application gateway cannot be created", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		mockGWClient := az.ApplicationGatewayClient.(*mockapplicationgatewayclient.MockInterface)
+		mockGWClient.EXPECT().Get(gomock.Any(), "rg", "testCluster-appgw", "").Return(network.ApplicationGateway{}, notFound)
+
+		_, err := az.reconcileApplicationGateway(testClusterName, &svc, nil, true)
+		assert.EqualError(t, err, "application gateway testCluster-appgw not found and applicationGatewaySubnetName is not set to create it")
+	})
+}
+
+func TestGetApplicationGatewayStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	gw := getTestApplicationGateway(az)
+	mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{
+		{
+			Name: pointer.String("testCluster-appgw-pip"),
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+				IPAddress: pointer.String("1.2.3.4"),
+			},
+		},
+	}, nil)
+
+	status, err := az.getApplicationGatewayStatus(&gw)
+	assert.NoError(t, err)
+	assert.Equal(t, &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "1.2.3.4"}}}, status)
+
+	gw.FrontendIPConfigurations = nil
+	_, err = az.getApplicationGatewayStatus(&gw)
+	assert.EqualError(t, err, "application gateway testCluster-appgw has no public frontend IP configuration")
+}
+
+func TestAssignApplicationGatewayRulePriorities(t *testing.T) {
+	gw := network.ApplicationGateway{
+		ApplicationGatewayPropertiesFormat: &network.ApplicationGatewayPropertiesFormat{
+			RequestRoutingRules: &[]network.ApplicationGatewayRequestRoutingRule{
+				{
+					Name: pointer.String("other"),
+					ApplicationGatewayRequestRoutingRulePropertiesFormat: &network.ApplicationGatewayRequestRoutingRulePropertiesFormat{
+						Priority: pointer.Int32(1),
+					},
+				},
+				{
+					Name: pointer.String("rule1"),
+					ApplicationGatewayRequestRoutingRulePropertiesFormat: &network.ApplicationGatewayRequestRoutingRulePropertiesFormat{
+						Priority: pointer.Int32(3),
+					},
+				},
+			},
+		},
+	}
+	rules := []network.ApplicationGatewayRequestRoutingRule{
+		{Name: pointer.String("rule1"), ApplicationGatewayRequestRoutingRulePropertiesFormat: &network.ApplicationGatewayRequestRoutingRulePropertiesFormat{}},
+		{Name: pointer.String("rule2"), ApplicationGatewayRequestRoutingRulePropertiesFormat: &network.ApplicationGatewayRequestRoutingRulePropertiesFormat{}},
+		{Name: pointer.String("rule3"), ApplicationGatewayRequestRoutingRulePropertiesFormat: &network.ApplicationGatewayRequestRoutingRulePropertiesFormat{}},
+	}
+
+	assert.NoError(t, assignApplicationGatewayRulePriorities(&gw, rules))
+	assert.Equal(t, int32(3), pointer.Int32Deref(rules[0].Priority, 0))
+	assert.Equal(t, int32(2), pointer.Int32Deref(rules[1].Priority, 0))
+	assert.Equal(t, int32(4), pointer.Int32Deref(rules[2].Priority, 0))
+
+	// The last priority is never assigned twice.
+	(*gw.RequestRoutingRules)[0].Priority = pointer.Int32(applicationGatewayMaxRulePriority - 1)
+	(*gw.RequestRoutingRules)[1].Priority = pointer.Int32(applicationGatewayMaxRulePriority)
+	fullRules := make([]network.ApplicationGatewayRequestRoutingRule, 0, applicationGatewayMaxRulePriority)
+	for i := 1; i < applicationGatewayMaxRulePriority-1; i++ {
+		fullRules = append(fullRules, network.ApplicationGatewayRequestRoutingRule{
+			Name: pointer.String(fmt.Sprintf("full%d", i)),
+			ApplicationGatewayRequestRoutingRulePropertiesFormat: &network.ApplicationGatewayRequestRoutingRulePropertiesFormat{},
+		})
+	}
+	assert.NoError(t, assignApplicationGatewayRulePriorities(&gw, fullRules))
+	assert.Equal(t, int32(applicationGatewayMaxRulePriority-2), pointer.Int32Deref(fullRules[len(fullRules)-1].Priority, 0))
+	fullRules = append(fullRules, network.ApplicationGatewayRequestRoutingRule{
+		Name: pointer.String("new"),
+		ApplicationGatewayRequestRoutingRulePropertiesFormat: &network.ApplicationGatewayRequestRoutingRulePropertiesFormat{},
+	})
+	assert.EqualError(t, assignApplicationGatewayRulePriorities(&gw, fullRules), "no free priority is left for rule new of application gateway ")
+}
+
+func TestEnsureLoadBalancerDeletedWithApplicationGateway(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	notFound := &retry.Error{HTTPStatusCode: http.StatusNotFound}
+	appGwCondition := metav1.Condition{Type: consts.ServiceConditionApplicationGatewayReady, Status: metav1.ConditionTrue}
+
+	t.Run("should not touch the load balancer if the service never used it", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		svc := getTestService("service1", v1.ProtocolTCP, map[string]string{
+			consts.ServiceAnnotationLoadBalancerType: consts.LoadBalancerTypeApplicationGateway,
+		}, false, 80)
+		mockGWClient := az.ApplicationGatewayClient.(*mockapplicationgatewayclient.MockInterface)
+		mockGWClient.EXPECT().Get(gomock.Any(), "rg", "testCluster-appgw", "").Return(network.ApplicationGateway{}, notFound)
+		mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+		mockLBClient.EXPECT().List(gomock.Any(), gomock.Any()).Times(0)
+
+		assert.NoError(t, az.EnsureLoadBalancerDeleted(context.TODO(), testClusterName, &svc))
+	})
+
+	t.Run("should remove the application gateway listeners of a service switched to the load balancer", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+		svc.Status.Conditions = []metav1.Condition{appGwCondition}
+		mockGWClient := az.ApplicationGatewayClient.(*mockapplicationgatewayclient.MockInterface)
+		mockGWClient.EXPECT().Get(gomock.Any(), "rg", "testCluster-appgw", "").Return(network.ApplicationGateway{}, notFound)
+		mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+		mockLBClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+		mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+		mockPIPClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+		mockSGClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+		mockSGClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(*getTestSecurityGroup(az), nil).AnyTimes()
+
+		assert.NoError(t, az.EnsureLoadBalancerDeleted(context.TODO(), testClusterName, &svc))
+	})
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func getApplicationSecurityGroupName(lbName string) string {
+	return lbName + consts.ApplicationSecurityGroupNameSuffix
+}
+
+func (az *Cloud) getApplicationSecurityGroupID(asgName string) string {
+	return fmt.Sprintf(consts.ApplicationSecurityGroupIDTemplate, az.getNetworkResourceSubscriptionID(), az.SecurityGroupResourceGroup, asgName)
+}
+
+// usesApplicationSecurityGroup returns true if the security rules of the service reference the application
+// security group of its load balancer. Only the rules allowing the traffic to the backend node IPs, which are
+// used when the floating IP is disabled, are changed. The rules allowing the traffic to the frontend IPs keep
+// them as the destinations, otherwise the rules of the services on the same load balancer and port would apply
+// to each other. The shared rules are merged by destination IPs, so they are not changed either.
+func (az *Cloud) usesApplicationSecurityGroup(service *v1.Service) bool {
+	return az.UseApplicationSecurityGroups &&
+		consts.IsK8sServiceDisableLoadBalancerFloatingIP(service) &&
+		!az.isLBBackendPoolTypePodIP() &&
+		!useSharedSecurityRule(service)
+}
+
+// reconcileApplicationSecurityGroup ensures the application security group of the load balancer exists and its
+// members are the nodes in the backend pool of the load balancer. The other nodes of the cluster, e.g. the control
+// plane nodes, the excluded nodes and the nodes of other load balancers, are removed from it. The application
+// security group is kept after the load balancer is deleted, so that the nodes don't need to be updated again
+// when the load balancer is recreated.
+func (az *Cloud) reconcileApplicationSecurityGroup(clusterName string, service *v1.Service, lbName string, nodes []*v1.Node) error {
+	serviceName := getServiceName(service)
+	asgName := getApplicationSecurityGroupName(lbName)
+	klog.V(2).Infof("reconcileApplicationSecurityGroup for service(%s): asg(%s) - started", serviceName, asgName)
+
+	_, exists, err := az.getApplicationSecurityGroup(asgName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		asg := network.ApplicationSecurityGroup{
+			Name:     pointer.String(asgName),
+			Location: pointer.String(az.Location),
+			Tags: map[string]*string{
+				consts.ClusterNameKey: pointer.String(clusterName),
+			},
+		}
+		klog.V(2).Infof("reconcileApplicationSecurityGroup for service(%s): asg(%s) - creating", serviceName, asgName)
+		if err := az.CreateOrUpdateApplicationSecurityGroup(service, asg); err != nil {
+			return err
+		}
+	}
+
+	if az.inLoadBalancerPlan(service) {
+		// The nodes are not added to the application security group in plan mode because it would update the VMs, VMSS or NICs.
+		klog.V(2).Infof("reconcileApplicationSecurityGroup for service(%s): asg(%s) - skip ensuring %d hosts in plan mode", serviceName, asgName, len(nodes))
+		return nil
+	}
+
+	members, err := az.getApplicationSecurityGroupMembers(clusterName, lbName, nodes)
+	if err != nil {
+		return err
+	}
+
+	// The nodes known to the cluster are removed from the application security group if they are not members.
+	nonMembers, err := az.GetNodeNames()
+	if err != nil {
+		return err
+	}
+	if nonMembers == nil {
+		nonMembers = sets.NewString()
+	}
+	for _, node := range nodes {
+		nonMembers.Insert(node.Name)
+	}
+	for _, node := range members {
+		nonMembers.Delete(node.Name)
+	}
+	if len(members) == 0 && nonMembers.Len() == 0 {
+		return nil
+	}
+
+	return az.VMSet.EnsureApplicationSecurityGroupMembers(service, members, nonMembers.List(), az.getApplicationSecurityGroupID(asgName))
+}
+
+// getApplicationSecurityGroupMembers returns the nodes in the backend pool of the load balancer.
+func (az *Cloud) getApplicationSecurityGroupMembers(clusterName, lbName string, nodes []*v1.Node) ([]*v1.Node, error) {
+	// The nodes are in the backend pool of the load balancer of their vmSets unless the single standard load
+	// balancer or the load balancer profiles are used.
+	vmSetName := ""
+	if az.useLoadBalancerProfiles() {
+		nodes = az.filterNodesByLoadBalancer(lbName, nodes)
+	} else if !az.useStandardLoadBalancer() || az.EnableMultipleStandardLoadBalancers {
+		vmSetName = az.mapLoadBalancerNameToVMSet(lbName, clusterName)
+	}
+
+	var members []*v1.Node
+	for _, node := range nodes {
+		if az.useStandardLoadBalancer() && az.excludeMasterNodesFromStandardLB() && isControlPlaneNode(node) {
+			klog.V(4).Infof("Excluding master node %q from the application security group of load balancer %q", node.Name, lbName)
+			continue
+		}
+		shouldExcludeLoadBalancer, err := az.ShouldNodeExcludedFromLoadBalancer(node.Name)
+		if err != nil {
+			klog.Errorf("ShouldNodeExcludedFromLoadBalancer(%s) failed with error: %v", node.Name, err)
+			return nil, err
+		}
+		if shouldExcludeLoadBalancer {
+			klog.V(4).Infof("Excluding unmanaged/external-resource-group node %q", node.Name)
+			continue
+		}
+		if vmSetName != "" {
+			nodeVMSetName, err := az.VMSet.GetNodeVMSetName(node)
+			if err != nil {
+				return nil, err
+			}
+			if !strings.EqualFold(nodeVMSetName, vmSetName) {
+				klog.V(4).Infof("Excluding node %q of vmSet %q from the application security group of load balancer %q", node.Name, nodeVMSetName, lbName)
+				continue
+			}
+		}
+		members = append(members, node)
+	}
+	return members, nil
+}
+
+// useApplicationSecurityGroupDestination replaces the destination addresses of the allow rules to the backend
+// node IPs by the application security group. The allow rules to the frontend IPs and the deny rules are kept.
+func useApplicationSecurityGroupDestination(rules []network.SecurityRule, backendIPAddresses []string, asgID string) {
+	backendIPs := sets.NewString(backendIPAddresses...)
+	for i := range rules {
+		if rules[i].SecurityRulePropertiesFormat == nil || rules[i].Access != network.SecurityRuleAccessAllow ||
+			rules[i].DestinationAddressPrefix != nil || rules[i].DestinationAddressPrefixes == nil ||
+			!sets.NewString(*rules[i].DestinationAddressPrefixes...).Equal(backendIPs) {
+			continue
+		}
+		rules[i].DestinationAddressPrefixes = nil
+		rules[i].DestinationApplicationSecurityGroups = &[]network.ApplicationSecurityGroup{
+			{ID: pointer.String(asgID)},
+		}
+	}
+}
+
+// getDestinationApplicationSecurityGroupIDs returns the lowercase IDs of the destination application security
+// groups of the rule in order.
+func getDestinationApplicationSecurityGroupIDs(rule network.SecurityRule) []string {
+	if rule.SecurityRulePropertiesFormat == nil || rule.DestinationApplicationSecurityGroups == nil {
+		return nil
+	}
+	ids := make([]string, 0, len(*rule.DestinationApplicationSecurityGroups))
+	for _, asg := range *rule.DestinationApplicationSecurityGroups {
+		ids = append(ids, strings.ToLower(pointer.StringDeref(asg.ID, "")))
+	}
+	sort.Strings(ids)
+	return ids
+}
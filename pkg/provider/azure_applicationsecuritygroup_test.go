@@ -0,0 +1,261 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/applicationsecuritygroupclient/mockapplicationsecuritygroupclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/securitygroupclient/mocksecuritygroupclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const testASGID = "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/applicationSecurityGroups/kubernetes-asg"
+
+func TestUsesApplicationSecurityGroup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	service := getTestService("svc1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationDisableLoadBalancerFloatingIP: "true"}, false, 80)
+	floatingIPService := getTestService("svc2", v1.ProtocolTCP, nil, false, 80)
+	sharedService := getTestService("svc3", v1.ProtocolTCP, map[string]string{
+		consts.ServiceAnnotationDisableLoadBalancerFloatingIP: "true",
+		consts.ServiceAnnotationSharedSecurityRule:            "true",
+	}, false, 80)
+
+	az := GetTestCloud(ctrl)
+	assert.False(t, az.usesApplicationSecurityGroup(&service))
+
+	az.UseApplicationSecurityGroups = true
+	assert.True(t, az.usesApplicationSecurityGroup(&service))
+	assert.False(t, az.usesApplicationSecurityGroup(&floatingIPService))
+	assert.False(t, az.usesApplicationSecurityGroup(&sharedService))
+
+	az.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypePODIP
+	assert.False(t, az.usesApplicationSecurityGroup(&service))
+	az.LoadBalancerBackendPoolConfigurationType = ""
+
+	// the services with floating IP disabled are not consolidated.
+	az.EnableSecurityRuleConsolidation = true
+	assert.True(t, az.usesApplicationSecurityGroup(&service))
+}
+
+func TestReconcileApplicationSecurityGroup(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	nodes := []*v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node2"}},
+	}
+
+	testCases := []struct {
+		desc               string
+		exists             bool
+		excludedNodes      []string
+		knownNodes         []string
+		useProfiles        bool
+		expectedCreate     bool
+		expectedNodes      []*v1.Node
+		expectedNonMembers []string
+	}{
+		{
+			desc:               "should create the application security group and add the nodes to it",
+			expectedCreate:     true,
+			expectedNodes:      nodes,
+			expectedNonMembers: []string{},
+		},
+		{
+			desc:               "should add the nodes to the existing application security group",
+			exists:             true,
+			expectedNodes:      nodes,
+			expectedNonMembers: []string{},
+		},
+		{
+			desc:               "should remove the excluded nodes from the application security group",
+			exists:             true,
+			excludedNodes:      []string{"node2"},
+			expectedNodes:      nodes[:1],
+			expectedNonMembers: []string{"node2"},
+		},
+		{
+			desc:               "should remove the nodes not passed in from the application security group",
+			exists:             true,
+			knownNodes:         []string{"node1", "node2", "node3"},
+			expectedNodes:      nodes,
+			expectedNonMembers: []string{"node3"},
+		},
+		{
+			desc:               "should only add the nodes of the load balancer profile to the application security group",
+			exists:             true,
+			useProfiles:        true,
+			expectedNodes:      nodes[:1],
+			expectedNonMembers: []string{"node2"},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			az.UseApplicationSecurityGroups = true
+			az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+			az.excludeLoadBalancerNodes.Insert(test.excludedNodes...)
+			if test.knownNodes != nil {
+				az.nodeInformerSynced = func() bool { return true }
+				az.nodeNames = sets.NewString(test.knownNodes...)
+			}
+			if test.useProfiles {
+				az.EnableMultipleStandardLoadBalancers = true
+				az.LoadBalancerProfiles = []LoadBalancerProfile{
+					{Name: "kubernetes", NodeSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"pool": "a"}}},
+				}
+				nodes[0].Labels = map[string]string{"pool": "a"}
+				defer func() { nodes[0].Labels = nil }()
+			}
+			service := getTestService("svc1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationDisableLoadBalancerFloatingIP: "true"}, false, 80)
+
+			mockASGClient := az.ApplicationSecurityGroupsClient.(*mockapplicationsecuritygroupclient.MockInterface)
+			if test.exists {
+				mockASGClient.EXPECT().Get(gomock.Any(), "rg", "kubernetes-asg", gomock.Any()).Return(network.ApplicationSecurityGroup{ID: pointer.String(testASGID)}, nil)
+			} else {
+				mockASGClient.EXPECT().Get(gomock.Any(), "rg", "kubernetes-asg", gomock.Any()).Return(network.ApplicationSecurityGroup{}, &retry.Error{HTTPStatusCode: http.StatusNotFound})
+			}
+			if test.expectedCreate {
+				mockASGClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "kubernetes-asg", network.ApplicationSecurityGroup{
+					Name:     pointer.String("kubernetes-asg"),
+					Location: pointer.String("westus"),
+					Tags:     map[string]*string{consts.ClusterNameKey: pointer.String(testClusterName)},
+				}, "").Return(nil)
+			}
+			mockVMSet := NewMockVMSet(ctrl)
+			mockVMSet.EXPECT().EnsureApplicationSecurityGroupMembers(&service, test.expectedNodes, test.expectedNonMembers, testASGID).Return(nil)
+			az.VMSet = mockVMSet
+
+			err := az.reconcileApplicationSecurityGroup(testClusterName, &service, "kubernetes", nodes)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestUseApplicationSecurityGroupDestination(t *testing.T) {
+	backendRule := getTestServiceSecurityRule("asvc1-TCP-30080-10.0.0.0_8", "10.0.0.0/8", "", "30080")
+	backendRule.DestinationAddressPrefix = nil
+	backendRule.DestinationAddressPrefixes = &[]string{"10.240.0.5", "10.240.0.4"}
+	frontendRule := getTestServiceSecurityRule("asvc2-TCP-80-10.0.0.0_8", "10.0.0.0/8", "1.1.1.1", "80")
+	otherBackendRule := getTestServiceSecurityRule("asvc3-TCP-30081-10.0.0.0_8", "10.0.0.0/8", "", "30081")
+	otherBackendRule.DestinationAddressPrefix = nil
+	otherBackendRule.DestinationAddressPrefixes = &[]string{"10.240.0.6"}
+	denyRule := getTestServiceSecurityRule("asvc1-TCP-30080-deny_all", "*", "", "30080")
+	denyRule.DestinationAddressPrefix = nil
+	denyRule.DestinationAddressPrefixes = &[]string{"10.240.0.4", "10.240.0.5"}
+	denyRule.Access = network.SecurityRuleAccessDeny
+	rules := []network.SecurityRule{backendRule, frontendRule, otherBackendRule, denyRule}
+
+	useApplicationSecurityGroupDestination(rules, []string{"10.240.0.4", "10.240.0.5"}, testASGID)
+
+	assert.Nil(t, rules[0].DestinationAddressPrefix)
+	assert.Nil(t, rules[0].DestinationAddressPrefixes)
+	assert.Equal(t, &[]network.ApplicationSecurityGroup{{ID: pointer.String(testASGID)}}, rules[0].DestinationApplicationSecurityGroups)
+	assert.Equal(t, pointer.String("1.1.1.1"), rules[1].DestinationAddressPrefix)
+	assert.Nil(t, rules[1].DestinationApplicationSecurityGroups)
+	assert.Equal(t, &[]string{"10.240.0.6"}, rules[2].DestinationAddressPrefixes)
+	assert.Nil(t, rules[2].DestinationApplicationSecurityGroups)
+	assert.Equal(t, &[]string{"10.240.0.4", "10.240.0.5"}, rules[3].DestinationAddressPrefixes)
+	assert.Nil(t, rules[3].DestinationApplicationSecurityGroups)
+}
+
+func TestReconcileSecurityGroupWithApplicationSecurityGroups(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testCases := []struct {
+		desc         string
+		annotations  map[string]string
+		expectedRule network.SecurityRule
+	}{
+		{
+			desc:        "should use the application security group as the destination of the rules to the backend node IPs",
+			annotations: map[string]string{consts.ServiceAnnotationDisableLoadBalancerFloatingIP: "true"},
+			expectedRule: network.SecurityRule{
+				Name: pointer.String("asvc1-TCP-80-Internet"),
+				SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+					Protocol:                             network.SecurityRuleProtocolTCP,
+					SourcePortRange:                      pointer.String("*"),
+					SourceAddressPrefix:                  pointer.String("Internet"),
+					DestinationPortRange:                 pointer.String(strconv.Itoa(int(getBackendPort(80)))),
+					DestinationApplicationSecurityGroups: &[]network.ApplicationSecurityGroup{{ID: pointer.String(testASGID)}},
+					Access:                               network.SecurityRuleAccessAllow,
+					Direction:                            network.SecurityRuleDirectionInbound,
+					Priority:                             pointer.Int32(500),
+				},
+			},
+		},
+		{
+			desc: "should keep the frontend IP as the destination of the rules with floating IP enabled",
+			expectedRule: network.SecurityRule{
+				Name: pointer.String("asvc1-TCP-80-Internet"),
+				SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+					Protocol:                 network.SecurityRuleProtocolTCP,
+					SourcePortRange:          pointer.String("*"),
+					SourceAddressPrefix:      pointer.String("Internet"),
+					DestinationPortRange:     pointer.String("80"),
+					DestinationAddressPrefix: pointer.String("1.1.1.1"),
+					Access:                   network.SecurityRuleAccessAllow,
+					Direction:                network.SecurityRuleDirectionInbound,
+					Priority:                 pointer.Int32(500),
+				},
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			az.UseApplicationSecurityGroups = true
+			service := getTestService("svc1", v1.ProtocolTCP, test.annotations, false, 80)
+
+			existingSg := network.SecurityGroup{
+				Name:                          pointer.String("nsg"),
+				SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{},
+			}
+			mockSGClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+			mockSGClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, "nsg", gomock.Any()).Return(existingSg, nil)
+			mockSGClient.EXPECT().CreateOrUpdate(gomock.Any(), az.ResourceGroup, "nsg", gomock.Any(), gomock.Any()).Return(nil)
+			mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+			mockLBClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, "kubernetes", gomock.Any()).Return(network.LoadBalancer{}, nil).MaxTimes(1)
+			mockLBBackendPool := az.LoadBalancerBackendPool.(*MockBackendPool)
+			mockLBBackendPool.EXPECT().GetBackendPrivateIPs(gomock.Any(), gomock.Any(), gomock.Any()).Return([]string{"10.240.0.4", "10.240.0.5"}, nil).MaxTimes(1)
+
+			sg, err := az.reconcileSecurityGroup(testClusterName, &service, pointer.String("1.1.1.1"), pointer.String("kubernetes"), true)
+			assert.NoError(t, err)
+			assert.Equal(t, []network.SecurityRule{test.expectedRule}, *sg.SecurityRules)
+		})
+	}
+}
@@ -148,7 +148,12 @@ func (az *Cloud) GetIPForMachineWithRetry(name types.NodeName) (string, string,
 }
 
 // CreateOrUpdateSecurityGroup invokes az.SecurityGroupsClient.CreateOrUpdate with exponential backoff retry
-func (az *Cloud) CreateOrUpdateSecurityGroup(sg network.SecurityGroup) error {
+func (az *Cloud) CreateOrUpdateSecurityGroup(service *v1.Service, sg network.SecurityGroup) error {
+	if az.inLoadBalancerPlan(service) {
+		az.planChange(service, planOperationCreateOrUpdate, planResourceSecurityGroup, az.SecurityGroupResourceGroup, pointer.StringDeref(sg.Name, ""), az.planExistingSecurityGroup(), sg)
+		return nil
+	}
+
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
@@ -207,6 +212,11 @@ func cleanupSubnetInFrontendIPConfigurations(lb *network.LoadBalancer) network.L
 
 // CreateOrUpdateLB invokes az.LoadBalancerClient.CreateOrUpdate with exponential backoff retry
 func (az *Cloud) CreateOrUpdateLB(service *v1.Service, lb network.LoadBalancer) error {
+	if az.inLoadBalancerPlan(service) {
+		az.planChange(service, planOperationCreateOrUpdate, planResourceLoadBalancer, az.getLoadBalancerResourceGroup(), pointer.StringDeref(lb.Name, ""), az.planExistingLoadBalancer(pointer.StringDeref(lb.Name, "")), lb)
+		return nil
+	}
+
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
@@ -265,7 +275,12 @@ func (az *Cloud) CreateOrUpdateLB(service *v1.Service, lb network.LoadBalancer)
 	return rerr.Error()
 }
 
-func (az *Cloud) CreateOrUpdateLBBackendPool(lbName string, backendPool network.BackendAddressPool) error {
+func (az *Cloud) CreateOrUpdateLBBackendPool(service *v1.Service, lbName string, backendPool network.BackendAddressPool) error {
+	if az.inLoadBalancerPlan(service) {
+		az.planChange(service, planOperationCreateOrUpdate, planResourceLoadBalancerBackendPool, az.getLoadBalancerResourceGroup(), lbName+"/"+pointer.StringDeref(backendPool.Name, ""), nil, backendPool)
+		return nil
+	}
+
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
@@ -293,7 +308,12 @@ func (az *Cloud) CreateOrUpdateLBBackendPool(lbName string, backendPool network.
 	return rerr.Error()
 }
 
-func (az *Cloud) DeleteLBBackendPool(lbName, backendPoolName string) error {
+func (az *Cloud) DeleteLBBackendPool(service *v1.Service, lbName, backendPoolName string) error {
+	if az.inLoadBalancerPlan(service) {
+		az.planChange(service, planOperationDelete, planResourceLoadBalancerBackendPool, az.getLoadBalancerResourceGroup(), lbName+"/"+backendPoolName, nil, nil)
+		return nil
+	}
+
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
@@ -357,7 +377,8 @@ func (az *Cloud) ListManagedLBs(service *v1.Service, nodes []*v1.Node, clusterNa
 	for _, lb := range allLBs {
 		vmSetNameFromLBName := az.mapLoadBalancerNameToVMSet(pointer.StringDeref(lb.Name, ""), clusterName)
 		if strings.EqualFold(strings.TrimSuffix(pointer.StringDeref(lb.Name, ""), consts.InternalLoadBalancerNameSuffix), clusterName) ||
-			agentPoolVMSetNamesSet.Has(strings.ToLower(vmSetNameFromLBName)) {
+			agentPoolVMSetNamesSet.Has(strings.ToLower(vmSetNameFromLBName)) ||
+			az.getLoadBalancerProfile(pointer.StringDeref(lb.Name, "")) != nil {
 			agentPoolLBs = append(agentPoolLBs, lb)
 			klog.V(4).Infof("ListManagedLBs: found agent pool LB %s", pointer.StringDeref(lb.Name, ""))
 		}
@@ -387,10 +408,25 @@ func (az *Cloud) ListLB(service *v1.Service) ([]network.LoadBalancer, error) {
 
 // CreateOrUpdatePIP invokes az.PublicIPAddressesClient.CreateOrUpdate with exponential backoff retry
 func (az *Cloud) CreateOrUpdatePIP(service *v1.Service, pipResourceGroup string, pip network.PublicIPAddress) error {
+	return az.createOrUpdatePIP(service, pipResourceGroup, pip, "")
+}
+
+// CreateOrUpdateGlobalPIP invokes az.PublicIPAddressesClient.CreateOrUpdate for the public IP of the cross-region
+// load balancer with the etag, which protects the changes of other clusters sharing the public IP.
+func (az *Cloud) CreateOrUpdateGlobalPIP(service *v1.Service, pip network.PublicIPAddress) error {
+	return az.createOrUpdatePIP(service, az.GlobalLoadBalancerResourceGroup, pip, pointer.StringDeref(pip.Etag, ""))
+}
+
+func (az *Cloud) createOrUpdatePIP(service *v1.Service, pipResourceGroup string, pip network.PublicIPAddress, etag string) error {
+	if az.inLoadBalancerPlan(service) {
+		az.planChange(service, planOperationCreateOrUpdate, planResourcePublicIP, pipResourceGroup, pointer.StringDeref(pip.Name, ""), az.planExistingPublicIP(pipResourceGroup, pointer.StringDeref(pip.Name, "")), pip)
+		return nil
+	}
+
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
-	rerr := az.PublicIPAddressesClient.CreateOrUpdate(ctx, pipResourceGroup, pointer.StringDeref(pip.Name, ""), pip)
+	rerr := az.PublicIPAddressesClient.CreateOrUpdate(ctx, pipResourceGroup, pointer.StringDeref(pip.Name, ""), pip, etag)
 	klog.V(10).Infof("PublicIPAddressesClient.CreateOrUpdate(%s, %s): end", pipResourceGroup, pointer.StringDeref(pip.Name, ""))
 	if rerr == nil {
 		// Invalidate the cache right after updating
@@ -400,7 +436,10 @@ func (az *Cloud) CreateOrUpdatePIP(service *v1.Service, pipResourceGroup string,
 
 	pipJSON, _ := json.Marshal(pip)
 	klog.Warningf("PublicIPAddressesClient.CreateOrUpdate(%s, %s) failed: %s, PublicIP request: %s", pipResourceGroup, pointer.StringDeref(pip.Name, ""), rerr.Error().Error(), string(pipJSON))
-	az.Event(service, v1.EventTypeWarning, "CreateOrUpdatePublicIPAddress", rerr.Error().Error())
+	// The service is nil for the public IPs which are not reconciled for a service, e.g. the outbound public IPs.
+	if service != nil {
+		az.Event(service, v1.EventTypeWarning, "CreateOrUpdatePublicIPAddress", rerr.Error().Error())
+	}
 
 	// Invalidate the cache because ETAG precondition mismatch.
 	if rerr.HTTPStatusCode == http.StatusPreconditionFailed {
@@ -436,13 +475,20 @@ func (az *Cloud) CreateOrUpdateInterface(service *v1.Service, nic network.Interf
 
 // DeletePublicIP invokes az.PublicIPAddressesClient.Delete with exponential backoff retry
 func (az *Cloud) DeletePublicIP(service *v1.Service, pipResourceGroup string, pipName string) error {
+	if az.inLoadBalancerPlan(service) {
+		az.planChange(service, planOperationDelete, planResourcePublicIP, pipResourceGroup, pipName, az.planExistingPublicIP(pipResourceGroup, pipName), nil)
+		return nil
+	}
+
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
 	rerr := az.PublicIPAddressesClient.Delete(ctx, pipResourceGroup, pipName)
 	if rerr != nil {
 		klog.Errorf("PublicIPAddressesClient.Delete(%s) failed: %s", pipName, rerr.Error().Error())
-		az.Event(service, v1.EventTypeWarning, "DeletePublicIPAddress", rerr.Error().Error())
+		if service != nil {
+			az.Event(service, v1.EventTypeWarning, "DeletePublicIPAddress", rerr.Error().Error())
+		}
 
 		if strings.Contains(rerr.Error().Error(), consts.CannotDeletePublicIPErrorMessageCode) {
 			klog.Warningf("DeletePublicIP for public IP %s failed with error %v, this is because other resources are referencing the public IP. The deletion of the service will continue.", pipName, rerr.Error())
@@ -458,6 +504,11 @@ func (az *Cloud) DeletePublicIP(service *v1.Service, pipResourceGroup string, pi
 
 // DeleteLB invokes az.LoadBalancerClient.Delete with exponential backoff retry
 func (az *Cloud) DeleteLB(service *v1.Service, lbName string) *retry.Error {
+	if az.inLoadBalancerPlan(service) {
+		az.planChange(service, planOperationDelete, planResourceLoadBalancer, az.getLoadBalancerResourceGroup(), lbName, az.planExistingLoadBalancer(lbName), nil)
+		return nil
+	}
+
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
@@ -474,6 +525,50 @@ func (az *Cloud) DeleteLB(service *v1.Service, lbName string) *retry.Error {
 	return rerr
 }
 
+// CreateOrUpdateGlobalLB invokes az.LoadBalancerClient.CreateOrUpdate for the cross-region load balancer
+func (az *Cloud) CreateOrUpdateGlobalLB(service *v1.Service, lb network.LoadBalancer) error {
+	lbName := pointer.StringDeref(lb.Name, "")
+	if az.inLoadBalancerPlan(service) {
+		az.planChange(service, planOperationCreateOrUpdate, planResourceGlobalLoadBalancer, az.GlobalLoadBalancerResourceGroup, lbName, az.planExistingGlobalLoadBalancer(lbName), lb)
+		return nil
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+
+	// The etag protects the changes of other clusters sharing the global load balancer.
+	rerr := az.LoadBalancerClient.CreateOrUpdate(ctx, az.GlobalLoadBalancerResourceGroup, lbName, lb, pointer.StringDeref(lb.Etag, ""))
+	klog.V(10).Infof("LoadBalancerClient.CreateOrUpdate(%s, %s): end", az.GlobalLoadBalancerResourceGroup, lbName)
+	if rerr == nil {
+		return nil
+	}
+
+	lbJSON, _ := json.Marshal(lb)
+	klog.Warningf("LoadBalancerClient.CreateOrUpdate(%s, %s) failed: %v, LoadBalancer request: %s", az.GlobalLoadBalancerResourceGroup, lbName, rerr.Error(), string(lbJSON))
+	az.Event(service, v1.EventTypeWarning, "CreateOrUpdateGlobalLoadBalancer", rerr.Error().Error())
+	return rerr.Error()
+}
+
+// DeleteGlobalLB invokes az.LoadBalancerClient.Delete for the cross-region load balancer
+func (az *Cloud) DeleteGlobalLB(service *v1.Service, lbName string) error {
+	if az.inLoadBalancerPlan(service) {
+		az.planChange(service, planOperationDelete, planResourceGlobalLoadBalancer, az.GlobalLoadBalancerResourceGroup, lbName, az.planExistingGlobalLoadBalancer(lbName), nil)
+		return nil
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+
+	rerr := az.LoadBalancerClient.Delete(ctx, az.GlobalLoadBalancerResourceGroup, lbName)
+	if rerr != nil {
+		klog.Errorf("LoadBalancerClient.Delete(%s, %s) failed: %s", az.GlobalLoadBalancerResourceGroup, lbName, rerr.Error().Error())
+		az.Event(service, v1.EventTypeWarning, "DeleteGlobalLoadBalancer", rerr.Error().Error())
+		return rerr.Error()
+	}
+
+	return nil
+}
+
 // CreateOrUpdateRouteTable invokes az.RouteTablesClient.CreateOrUpdate with exponential backoff retry
 func (az *Cloud) CreateOrUpdateRouteTable(routeTable network.RouteTable) error {
 	ctx, cancel := getContextWithCancel()
@@ -571,13 +666,23 @@ func (az *Cloud) CreateOrUpdateVMSS(resourceGroupName string, VMScaleSetName str
 }
 
 func (az *Cloud) CreateOrUpdatePLS(service *v1.Service, pls network.PrivateLinkService) error {
+	if pls.PrivateLinkServiceProperties == nil || pls.LoadBalancerFrontendIPConfigurations == nil || len(*pls.LoadBalancerFrontendIPConfigurations) == 0 {
+		return fmt.Errorf("CreateOrUpdatePLS: private link service %s has no load balancer frontend IP configuration", pointer.StringDeref(pls.Name, ""))
+	}
+	fipConfigID := pointer.StringDeref((*pls.LoadBalancerFrontendIPConfigurations)[0].ID, "")
+
+	if az.inLoadBalancerPlan(service) {
+		az.planChange(service, planOperationCreateOrUpdate, planResourcePrivateLinkService, az.PrivateLinkServiceResourceGroup, pointer.StringDeref(pls.Name, ""), az.planExistingPrivateLinkService(fipConfigID), pls)
+		return nil
+	}
+
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
 	rerr := az.PrivateLinkServiceClient.CreateOrUpdate(ctx, az.PrivateLinkServiceResourceGroup, pointer.StringDeref(pls.Name, ""), pls, pointer.StringDeref(pls.Etag, ""))
 	if rerr == nil {
 		// Invalidate the cache right after updating
-		_ = az.plsCache.Delete(pointer.StringDeref((*pls.LoadBalancerFrontendIPConfigurations)[0].ID, ""))
+		_ = az.plsCache.Delete(fipConfigID)
 		return nil
 	}
 
@@ -587,12 +692,12 @@ func (az *Cloud) CreateOrUpdatePLS(service *v1.Service, pls network.PrivateLinkS
 	// Invalidate the cache because etag mismatch.
 	if rerr.HTTPStatusCode == http.StatusPreconditionFailed {
 		klog.V(3).Infof("Private link service cache for %s is cleanup because of http.StatusPreconditionFailed", pointer.StringDeref(pls.Name, ""))
-		_ = az.plsCache.Delete(pointer.StringDeref((*pls.LoadBalancerFrontendIPConfigurations)[0].ID, ""))
+		_ = az.plsCache.Delete(fipConfigID)
 	}
 	// Invalidate the cache because another new operation has canceled the current request.
 	if strings.Contains(strings.ToLower(rerr.Error().Error()), consts.OperationCanceledErrorMessage) {
 		klog.V(3).Infof("Private link service for %s is cleanup because CreateOrUpdatePrivateLinkService is canceled by another operation", pointer.StringDeref(pls.Name, ""))
-		_ = az.plsCache.Delete(pointer.StringDeref((*pls.LoadBalancerFrontendIPConfigurations)[0].ID, ""))
+		_ = az.plsCache.Delete(fipConfigID)
 	}
 	klog.Errorf("PrivateLinkServiceClient.CreateOrUpdate(%s) failed: %v", pointer.StringDeref(pls.Name, ""), rerr.Error())
 	return rerr.Error()
@@ -600,6 +705,11 @@ func (az *Cloud) CreateOrUpdatePLS(service *v1.Service, pls network.PrivateLinkS
 
 // DeletePLS invokes az.PrivateLinkServiceClient.Delete with exponential backoff retry
 func (az *Cloud) DeletePLS(service *v1.Service, plsName string, plsLBFrontendID string) *retry.Error {
+	if az.inLoadBalancerPlan(service) {
+		az.planChange(service, planOperationDelete, planResourcePrivateLinkService, az.PrivateLinkServiceResourceGroup, plsName, az.planExistingPrivateLinkService(plsLBFrontendID), nil)
+		return nil
+	}
+
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
@@ -617,6 +727,11 @@ func (az *Cloud) DeletePLS(service *v1.Service, plsName string, plsLBFrontendID
 
 // DeletePEConn invokes az.PrivateLinkServiceClient.DeletePEConnection with exponential backoff retry
 func (az *Cloud) DeletePEConn(service *v1.Service, plsName string, peConnName string) *retry.Error {
+	if az.inLoadBalancerPlan(service) {
+		az.planChange(service, planOperationDelete, planResourcePrivateEndpointConn, az.PrivateLinkServiceResourceGroup, plsName+"/"+peConnName, nil, nil)
+		return nil
+	}
+
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 
@@ -630,6 +745,109 @@ func (az *Cloud) DeletePEConn(service *v1.Service, plsName string, peConnName st
 	return rerr
 }
 
+// UpdatePEConn invokes az.PrivateLinkServiceClient.UpdatePEConnection with exponential backoff retry
+func (az *Cloud) UpdatePEConn(service *v1.Service, plsName string, plsLBFrontendID string, peConn network.PrivateEndpointConnection) *retry.Error {
+	peConnName := pointer.StringDeref(peConn.Name, "")
+	if az.inLoadBalancerPlan(service) {
+		az.planChange(service, planOperationCreateOrUpdate, planResourcePrivateEndpointConn, az.PrivateLinkServiceResourceGroup, plsName+"/"+peConnName, nil, peConn)
+		return nil
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+
+	rerr := az.PrivateLinkServiceClient.UpdatePEConnection(ctx, az.PrivateLinkServiceResourceGroup, plsName, peConnName, peConn, pointer.StringDeref(peConn.Etag, ""))
+	if rerr == nil {
+		// Invalidate the cache because the connections of the private link service are updated
+		_ = az.plsCache.Delete(plsLBFrontendID)
+		return nil
+	}
+
+	klog.Errorf("PrivateLinkServiceClient.UpdatePEConnection(%s-%s) failed: %s", plsName, peConnName, rerr.Error().Error())
+	az.Event(service, v1.EventTypeWarning, "UpdatePrivateEndpointConnection", rerr.Error().Error())
+	return rerr
+}
+
+// CreateOrUpdateApplicationGateway invokes az.ApplicationGatewayClient.CreateOrUpdate with exponential backoff retry
+func (az *Cloud) CreateOrUpdateApplicationGateway(service *v1.Service, gw network.ApplicationGateway) error {
+	gwName := pointer.StringDeref(gw.Name, "")
+	if az.inLoadBalancerPlan(service) {
+		az.planChange(service, planOperationCreateOrUpdate, planResourceApplicationGateway, az.ApplicationGatewayResourceGroup, gwName, az.planExistingApplicationGateway(gwName), gw)
+		return nil
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+
+	rerr := az.ApplicationGatewayClient.CreateOrUpdate(ctx, az.ApplicationGatewayResourceGroup, gwName, gw, pointer.StringDeref(gw.Etag, ""))
+	klog.V(10).Infof("ApplicationGatewayClient.CreateOrUpdate(%s): end", gwName)
+	if rerr == nil {
+		return nil
+	}
+
+	gwJSON, _ := json.Marshal(gw)
+	klog.Warningf("ApplicationGatewayClient.CreateOrUpdate(%s) failed: %v, ApplicationGateway request: %s", gwName, rerr.Error(), string(gwJSON))
+	az.Event(service, v1.EventTypeWarning, "CreateOrUpdateApplicationGateway", rerr.Error().Error())
+	return rerr.Error()
+}
+
+// DeleteApplicationGateway invokes az.ApplicationGatewayClient.Delete with exponential backoff retry
+func (az *Cloud) DeleteApplicationGateway(service *v1.Service, gwName string) error {
+	if az.inLoadBalancerPlan(service) {
+		az.planChange(service, planOperationDelete, planResourceApplicationGateway, az.ApplicationGatewayResourceGroup, gwName, az.planExistingApplicationGateway(gwName), nil)
+		return nil
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+
+	rerr := az.ApplicationGatewayClient.Delete(ctx, az.ApplicationGatewayResourceGroup, gwName)
+	if rerr != nil {
+		klog.Errorf("ApplicationGatewayClient.Delete(%s) failed: %s", gwName, rerr.Error().Error())
+		az.Event(service, v1.EventTypeWarning, "DeleteApplicationGateway", rerr.Error().Error())
+		return rerr.Error()
+	}
+
+	return nil
+}
+
+// CreateOrUpdateApplicationSecurityGroup invokes az.ApplicationSecurityGroupsClient.CreateOrUpdate with exponential backoff retry
+func (az *Cloud) CreateOrUpdateApplicationSecurityGroup(service *v1.Service, asg network.ApplicationSecurityGroup) error {
+	asgName := pointer.StringDeref(asg.Name, "")
+	if az.inLoadBalancerPlan(service) {
+		az.planChange(service, planOperationCreateOrUpdate, planResourceApplicationSecurityGroup, az.SecurityGroupResourceGroup, asgName, az.planExistingApplicationSecurityGroup(asgName), asg)
+		return nil
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+
+	rerr := az.ApplicationSecurityGroupsClient.CreateOrUpdate(ctx, az.SecurityGroupResourceGroup, asgName, asg, pointer.StringDeref(asg.Etag, ""))
+	klog.V(10).Infof("ApplicationSecurityGroupsClient.CreateOrUpdate(%s): end", asgName)
+	if rerr == nil {
+		return nil
+	}
+
+	klog.Errorf("ApplicationSecurityGroupsClient.CreateOrUpdate(%s) failed: %s", asgName, rerr.Error().Error())
+	az.Event(service, v1.EventTypeWarning, "CreateOrUpdateApplicationSecurityGroup", rerr.Error().Error())
+	return rerr.Error()
+}
+
+// CreateOrUpdateNatGateway invokes az.NatGatewaysClient.CreateOrUpdate with exponential backoff retry
+func (az *Cloud) CreateOrUpdateNatGateway(rgName string, natGateway network.NatGateway) error {
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+
+	natGatewayName := pointer.StringDeref(natGateway.Name, "")
+	rerr := az.NatGatewaysClient.CreateOrUpdate(ctx, rgName, natGatewayName, natGateway, pointer.StringDeref(natGateway.Etag, ""))
+	klog.V(10).Infof("NatGatewaysClient.CreateOrUpdate(%s, %s): end", rgName, natGatewayName)
+	if rerr != nil {
+		klog.Errorf("NatGatewaysClient.CreateOrUpdate(%s, %s) failed: %s", rgName, natGatewayName, rerr.Error().Error())
+		return rerr.Error()
+	}
+	return nil
+}
+
 // CreateOrUpdateSubnet invokes az.SubnetClient.CreateOrUpdate with exponential backoff retry
 func (az *Cloud) CreateOrUpdateSubnet(service *v1.Service, subnet network.Subnet) error {
 	ctx, cancel := getContextWithCancel()
@@ -642,11 +860,19 @@ func (az *Cloud) CreateOrUpdateSubnet(service *v1.Service, subnet network.Subnet
 		rg = az.ResourceGroup
 	}
 
+	if az.inLoadBalancerPlan(service) {
+		az.planChange(service, planOperationCreateOrUpdate, planResourceSubnet, rg, az.VnetName+"/"+pointer.StringDeref(subnet.Name, ""), nil, subnet)
+		return nil
+	}
+
 	rerr := az.SubnetsClient.CreateOrUpdate(ctx, rg, az.VnetName, *subnet.Name, subnet)
 	klog.V(10).Infof("SubnetClient.CreateOrUpdate(%s): end", *subnet.Name)
 	if rerr != nil {
 		klog.Errorf("SubnetClient.CreateOrUpdate(%s) failed: %s", *subnet.Name, rerr.Error().Error())
-		az.Event(service, v1.EventTypeWarning, "CreateOrUpdateSubnet", rerr.Error().Error())
+		// The service is nil for the subnets which are not reconciled for a service, e.g. the outbound NAT gateway.
+		if service != nil {
+			az.Event(service, v1.EventTypeWarning, "CreateOrUpdateSubnet", rerr.Error().Error())
+		}
 		return rerr.Error()
 	}
 
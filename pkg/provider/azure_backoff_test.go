@@ -34,6 +34,7 @@ import (
 
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/interfaceclient/mockinterfaceclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/privatelinkserviceclient/mockprivatelinkserviceclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/routeclient/mockrouteclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/routetableclient/mockroutetableclient"
@@ -231,7 +232,7 @@ func TestCreateOrUpdateSecurityGroupCanceled(t *testing.T) {
 	})
 	mockSGClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, "sg", gomock.Any()).Return(network.SecurityGroup{}, nil)
 
-	err := az.CreateOrUpdateSecurityGroup(network.SecurityGroup{Name: pointer.String("sg")})
+	err := az.CreateOrUpdateSecurityGroup(nil, network.SecurityGroup{Name: pointer.String("sg")})
 	assert.EqualError(t, fmt.Errorf("Retriable: false, RetryAfter: 0s, HTTPStatusCode: 0, RawError: %w", fmt.Errorf("canceledandsupersededduetoanotheroperation")), err.Error())
 
 	// security group should be removed from cache if the operation is canceled
@@ -273,7 +274,7 @@ func TestCreateOrUpdateLB(t *testing.T) {
 		mockLBClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, "lb", gomock.Any()).Return(network.LoadBalancer{}, nil)
 
 		mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
-		mockPIPClient.EXPECT().CreateOrUpdate(gomock.Any(), az.ResourceGroup, "pip", gomock.Any()).Return(nil).MaxTimes(1)
+		mockPIPClient.EXPECT().CreateOrUpdate(gomock.Any(), az.ResourceGroup, "pip", gomock.Any(), gomock.Any()).Return(nil).MaxTimes(1)
 		mockPIPClient.EXPECT().List(gomock.Any(), az.ResourceGroup).Return([]network.PublicIPAddress{{
 			Name: pointer.String("pip"),
 			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
@@ -381,7 +382,7 @@ func TestCreateOrUpdatePIP(t *testing.T) {
 		az := GetTestCloud(ctrl)
 		az.pipCache.Set(az.ResourceGroup, []network.PublicIPAddress{{Name: pointer.String("test")}})
 		mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
-		mockPIPClient.EXPECT().CreateOrUpdate(gomock.Any(), az.ResourceGroup, "nic", gomock.Any()).Return(test.clientErr)
+		mockPIPClient.EXPECT().CreateOrUpdate(gomock.Any(), az.ResourceGroup, "nic", gomock.Any(), gomock.Any()).Return(test.clientErr)
 		if test.cacheExpectedEmpty {
 			mockPIPClient.EXPECT().List(gomock.Any(), az.ResourceGroup).Return([]network.PublicIPAddress{}, nil)
 		}
@@ -631,7 +632,7 @@ func TestCreateOrUpdateLBBackendPool(t *testing.T) {
 		lbClient.EXPECT().CreateOrUpdateBackendPools(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(tc.createOrUpdateErr)
 		az.LoadBalancerClient = lbClient
 
-		err := az.CreateOrUpdateLBBackendPool("kubernetes", network.BackendAddressPool{})
+		err := az.CreateOrUpdateLBBackendPool(nil, "kubernetes", network.BackendAddressPool{})
 		assert.Equal(t, tc.expectedErr, err != nil)
 	}
 }
@@ -662,7 +663,67 @@ func TestDeleteLBBackendPool(t *testing.T) {
 		lbClient.EXPECT().DeleteLBBackendPool(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(tc.deleteErr)
 		az.LoadBalancerClient = lbClient
 
-		err := az.DeleteLBBackendPool("kubernetes", "kubernetes")
+		err := az.DeleteLBBackendPool(nil, "kubernetes", "kubernetes")
 		assert.Equal(t, tc.expectedErr, err != nil)
 	}
 }
+
+func TestCreateOrUpdatePLSWithoutFrontendIPConfig(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerDryRun = true
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	assert.True(t, az.startLoadBalancerPlan(&svc))
+	defer az.finishLoadBalancerPlan(&svc)
+
+	err := az.CreateOrUpdatePLS(&svc, network.PrivateLinkService{Name: pointer.String("pls")})
+	assert.Error(t, err)
+	err = az.CreateOrUpdatePLS(&svc, network.PrivateLinkService{
+		Name: pointer.String("pls"),
+		PrivateLinkServiceProperties: &network.PrivateLinkServiceProperties{
+			LoadBalancerFrontendIPConfigurations: &[]network.FrontendIPConfiguration{},
+		},
+	})
+	assert.Error(t, err)
+}
+
+func TestUpdatePEConn(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fipConfigID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb/frontendIPConfigurations/fip"
+	peConn := network.PrivateEndpointConnection{
+		Name: pointer.String("conn1"),
+		Etag: pointer.String("etag"),
+	}
+
+	t.Run("should update the connection and invalidate the private link service cache", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+		az.plsCache.Set(fipConfigID, &network.PrivateLinkService{Name: pointer.String("pls")})
+		mockPLSClient := az.PrivateLinkServiceClient.(*mockprivatelinkserviceclient.MockInterface)
+		mockPLSClient.EXPECT().UpdatePEConnection(gomock.Any(), "rg", "pls", "conn1", peConn, "etag").Return(nil)
+
+		rerr := az.UpdatePEConn(&svc, "pls", fipConfigID, peConn)
+		assert.Nil(t, rerr)
+		_, exists, err := az.plsCache.Store.GetByKey(fipConfigID)
+		assert.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("should record the update in plan mode", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		az.LoadBalancerDryRun = true
+		svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+		assert.True(t, az.startLoadBalancerPlan(&svc))
+		defer az.finishLoadBalancerPlan(&svc)
+
+		rerr := az.UpdatePEConn(&svc, "pls", fipConfigID, peConn)
+		assert.Nil(t, rerr)
+		plan := az.getLoadBalancerPlan(&svc)
+		assert.Equal(t, 1, len(plan.Changes))
+		assert.Equal(t, planResourcePrivateEndpointConn, plan.Changes[0].ResourceType)
+	})
+}
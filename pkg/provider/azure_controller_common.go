@@ -130,7 +130,7 @@ func (c *controllerCommon) getNodeVMSet(nodeName types.NodeName, crt azcache.Azu
 		return c.cloud.VMSet, nil
 	}
 
-	// 2. vmType is Virtual Machine Scale Set (vmss), convert vmSet to ScaleSet.
+	// 2. vmType is Virtual Machine Scale Set (vmss) or mixed, convert vmSet to ScaleSet.
 	// 2.1 all the nodes in the cluster are vmss uniform nodes.
 	// 2.2 mix node: the nodes in the cluster can be any of avset nodes, vmss uniform nodes and vmssflex nodes.
 	ss, ok := c.cloud.VMSet.(*ScaleSet)
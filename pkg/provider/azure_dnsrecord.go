@@ -0,0 +1,386 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/privatedns/mgmt/2018-09-01/privatedns"
+	"github.com/Azure/go-autorest/autorest/azure"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// getServiceDNSZoneID returns the resource ID of the DNS zone in which the records of the service are maintained.
+func getServiceDNSZoneID(service *v1.Service) (string, bool) {
+	zoneID := strings.TrimSpace(service.Annotations[consts.ServiceAnnotationDNSZoneID])
+	return zoneID, zoneID != ""
+}
+
+// getServiceDNSRecordName returns the relative name of the DNS records of the service in the zone.
+func getServiceDNSRecordName(service *v1.Service) (string, error) {
+	name := strings.ToLower(strings.TrimSpace(service.Annotations[consts.ServiceAnnotationDNSRecordName]))
+	if name == "" {
+		return strings.ToLower(service.Name), nil
+	}
+	if strings.ContainsAny(name, " /") || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".") {
+		return "", fmt.Errorf("invalid value %q of annotation %s", name, consts.ServiceAnnotationDNSRecordName)
+	}
+	return name, nil
+}
+
+// getServiceDNSRecordTTL returns the TTL in seconds of the DNS records of the service.
+func getServiceDNSRecordTTL(service *v1.Service) (int64, error) {
+	value := strings.TrimSpace(service.Annotations[consts.ServiceAnnotationDNSRecordTTL])
+	if value == "" {
+		return consts.DefaultDNSRecordTTL, nil
+	}
+	ttl, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("invalid value %q of annotation %s: the TTL should be a positive integer", value, consts.ServiceAnnotationDNSRecordTTL)
+	}
+	return ttl, nil
+}
+
+// getServiceOwnedDNSRecord returns the zone and the name of the DNS records owned by the service, which are
+// recorded by the cloud provider in the annotation of the service.
+func getServiceOwnedDNSRecord(service *v1.Service) (string, string, bool) {
+	value := strings.TrimSpace(service.Annotations[consts.ServiceAnnotationDNSOwnedRecord])
+	i := strings.LastIndex(value, "/")
+	if i <= 0 || i == len(value)-1 {
+		return "", "", false
+	}
+	return value[:i], value[i+1:], true
+}
+
+// getDNSOwnerRecordName returns the name of the TXT record recording the owner of the DNS records.
+func getDNSOwnerRecordName(recordName string) string {
+	if recordName == "@" {
+		return consts.DNSOwnerRecordPrefix
+	}
+	return fmt.Sprintf("%s.%s", consts.DNSOwnerRecordPrefix, recordName)
+}
+
+// getDNSRecordOwner returns the value of the ownership TXT record, which identifies the service the same way
+// as the service tags of the public IPs.
+func getDNSRecordOwner(clusterName, serviceName string) string {
+	return fmt.Sprintf("%s=%s,%s=%s", consts.ClusterNameKey, clusterName, consts.ServiceTagKey, serviceName)
+}
+
+// isDNSRecordSetOwnedBy returns true if the ownership TXT record set contains the owner.
+func isDNSRecordSetOwnedBy(recordSet *privatedns.RecordSet, owner string) bool {
+	if recordSet.RecordSetProperties == nil || recordSet.TxtRecords == nil {
+		return false
+	}
+	for _, record := range *recordSet.TxtRecords {
+		if record.Value != nil && strings.EqualFold(strings.Join(*record.Value, ""), owner) {
+			return true
+		}
+	}
+	return false
+}
+
+// getDNSRecordSetIPs returns the sorted IP addresses of the A or AAAA record set.
+func getDNSRecordSetIPs(recordSet *privatedns.RecordSet) []string {
+	var ips []string
+	if recordSet.RecordSetProperties == nil {
+		return ips
+	}
+	if recordSet.ARecords != nil {
+		for _, record := range *recordSet.ARecords {
+			ips = append(ips, pointer.StringDeref(record.Ipv4Address, ""))
+		}
+	}
+	if recordSet.AaaaRecords != nil {
+		for _, record := range *recordSet.AaaaRecords {
+			ips = append(ips, pointer.StringDeref(record.Ipv6Address, ""))
+		}
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+// buildDNSRecordSet builds the desired record set of the record type.
+func buildDNSRecordSet(recordType privatedns.RecordType, values []string, ttl int64, owner string) privatedns.RecordSet {
+	properties := &privatedns.RecordSetProperties{
+		TTL: pointer.Int64(ttl),
+		Metadata: map[string]*string{
+			consts.DNSOwnerRecordPrefix: pointer.String(owner),
+		},
+	}
+	switch recordType {
+	case privatedns.A:
+		records := make([]privatedns.ARecord, 0, len(values))
+		for _, ip := range values {
+			records = append(records, privatedns.ARecord{Ipv4Address: pointer.String(ip)})
+		}
+		properties.ARecords = &records
+	case privatedns.AAAA:
+		records := make([]privatedns.AaaaRecord, 0, len(values))
+		for _, ip := range values {
+			records = append(records, privatedns.AaaaRecord{Ipv6Address: pointer.String(ip)})
+		}
+		properties.AaaaRecords = &records
+	case privatedns.TXT:
+		properties.TxtRecords = &[]privatedns.TxtRecord{{Value: &[]string{owner}}}
+	}
+	return privatedns.RecordSet{RecordSetProperties: properties}
+}
+
+// getDNSRecordSet gets the record set in the zone. It returns false if the record set does not exist.
+func (az *Cloud) getDNSRecordSet(zoneID string, recordType privatedns.RecordType, name string) (*privatedns.RecordSet, bool, error) {
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+
+	recordSet, rerr := az.DNSRecordSetsClient.Get(ctx, zoneID, recordType, name)
+	if rerr != nil {
+		if rerr.HTTPStatusCode == http.StatusNotFound {
+			return nil, false, nil
+		}
+		return nil, false, rerr.Error()
+	}
+	return &recordSet, true, nil
+}
+
+// getDNSRecordSetPlanNames returns the resource group and the name of the record set reported in plan mode.
+func getDNSRecordSetPlanNames(zoneID string, recordType privatedns.RecordType, name string) (string, string) {
+	resource, err := azure.ParseResourceID(zoneID)
+	if err != nil {
+		return "", fmt.Sprintf("%s/%s/%s", zoneID, recordType, name)
+	}
+	return resource.ResourceGroup, fmt.Sprintf("%s/%s/%s", resource.ResourceName, recordType, name)
+}
+
+// createOrUpdateDNSRecordSet invokes az.DNSRecordSetsClient.CreateOrUpdate with the etag of the existing record set.
+func (az *Cloud) createOrUpdateDNSRecordSet(service *v1.Service, zoneID string, recordType privatedns.RecordType, name string, existing *privatedns.RecordSet, recordSet privatedns.RecordSet) error {
+	if az.inLoadBalancerPlan(service) {
+		resourceGroup, planName := getDNSRecordSetPlanNames(zoneID, recordType, name)
+		az.planChange(service, planOperationCreateOrUpdate, planResourceDNSRecordSet, resourceGroup, planName, existing, recordSet)
+		return nil
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+
+	var etag string
+	if existing != nil {
+		etag = pointer.StringDeref(existing.Etag, "")
+	}
+	klog.V(2).Infof("createOrUpdateDNSRecordSet: %s record set %s in zone %s", recordType, name, zoneID)
+	if rerr := az.DNSRecordSetsClient.CreateOrUpdate(ctx, zoneID, recordType, name, recordSet, etag); rerr != nil {
+		klog.Errorf("DNSRecordSetsClient.CreateOrUpdate(%s, %s, %s) failed: %s", zoneID, recordType, name, rerr.Error().Error())
+		return rerr.Error()
+	}
+	return nil
+}
+
+// deleteDNSRecordSet invokes az.DNSRecordSetsClient.Delete. The record sets not found are ignored.
+func (az *Cloud) deleteDNSRecordSet(service *v1.Service, zoneID string, recordType privatedns.RecordType, name string) error {
+	if az.inLoadBalancerPlan(service) {
+		resourceGroup, planName := getDNSRecordSetPlanNames(zoneID, recordType, name)
+		az.planChange(service, planOperationDelete, planResourceDNSRecordSet, resourceGroup, planName, nil, nil)
+		return nil
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+
+	klog.V(2).Infof("deleteDNSRecordSet: %s record set %s in zone %s", recordType, name, zoneID)
+	if rerr := az.DNSRecordSetsClient.Delete(ctx, zoneID, recordType, name); rerr != nil && rerr.HTTPStatusCode != http.StatusNotFound {
+		klog.Errorf("DNSRecordSetsClient.Delete(%s, %s, %s) failed: %s", zoneID, recordType, name, rerr.Error().Error())
+		return rerr.Error()
+	}
+	return nil
+}
+
+// reconcileDNSRecords maintains the A and AAAA records of the frontend IPs of the service in the DNS zone of the
+// service. The records are owned by the service through a TXT record next to them, and the records owned by
+// others are never changed. The zone and the name of the owned records are recorded in the service annotation,
+// so that the stale records are deleted when they change or the zone annotation is removed.
+// If wantRecords is false, the records owned by the service are deleted.
+func (az *Cloud) reconcileDNSRecords(clusterName string, service *v1.Service, lbStatus *v1.LoadBalancerStatus, wantRecords bool) error {
+	serviceName := getServiceName(service)
+	owner := getDNSRecordOwner(clusterName, serviceName)
+	ownedZoneID, ownedRecordName, hasOwnedRecords := getServiceOwnedDNSRecord(service)
+	zoneID, found := getServiceDNSZoneID(service)
+	if !found || !wantRecords {
+		if found {
+			if recordName, err := getServiceDNSRecordName(service); err != nil {
+				klog.Warningf("reconcileDNSRecords(%s): skip deleting the records in zone %s: %v", serviceName, zoneID, err)
+			} else {
+				if err := az.deleteOwnedDNSRecords(service, zoneID, recordName, owner); err != nil {
+					return err
+				}
+				hasOwnedRecords = hasOwnedRecords && (!strings.EqualFold(ownedZoneID, zoneID) || ownedRecordName != recordName)
+			}
+		}
+		if hasOwnedRecords {
+			if err := az.deleteOwnedDNSRecords(service, ownedZoneID, ownedRecordName, owner); err != nil {
+				return err
+			}
+		}
+		return az.setServiceOwnedDNSRecord(service, "", "")
+	}
+
+	recordName, err := getServiceDNSRecordName(service)
+	if err != nil {
+		return err
+	}
+	ttl, err := getServiceDNSRecordTTL(service)
+	if err != nil {
+		return err
+	}
+	ownerRecordName := getDNSOwnerRecordName(recordName)
+	klog.V(2).Infof("reconcileDNSRecords(%s): zone(%s) record(%s)", serviceName, zoneID, recordName)
+
+	if hasOwnedRecords && (!strings.EqualFold(ownedZoneID, zoneID) || ownedRecordName != recordName) {
+		klog.V(2).Infof("reconcileDNSRecords(%s): deleting the stale record %s in zone %s", serviceName, ownedRecordName, ownedZoneID)
+		if err := az.deleteOwnedDNSRecords(service, ownedZoneID, ownedRecordName, owner); err != nil {
+			return err
+		}
+	}
+
+	ownerRecordSet, exists, err := az.getDNSRecordSet(zoneID, privatedns.TXT, ownerRecordName)
+	if err != nil {
+		return err
+	}
+	owned := exists && isDNSRecordSetOwnedBy(ownerRecordSet, owner)
+	if exists && !owned {
+		return az.reportDNSRecordConflict(service, zoneID, recordName)
+	}
+
+	var ipv4s, ipv6s []string
+	if lbStatus != nil {
+		for _, ingress := range lbStatus.Ingress {
+			if ingress.IP == "" {
+				continue
+			}
+			if utilnet.IsIPv6String(ingress.IP) {
+				ipv6s = append(ipv6s, ingress.IP)
+			} else {
+				ipv4s = append(ipv4s, ingress.IP)
+			}
+		}
+	}
+	sort.Strings(ipv4s)
+	sort.Strings(ipv6s)
+
+	desiredRecords := []struct {
+		recordType privatedns.RecordType
+		ips        []string
+	}{
+		{recordType: privatedns.A, ips: ipv4s},
+		{recordType: privatedns.AAAA, ips: ipv6s},
+	}
+	existingRecordSets := make(map[privatedns.RecordType]*privatedns.RecordSet)
+	for _, desired := range desiredRecords {
+		recordSet, exists, err := az.getDNSRecordSet(zoneID, desired.recordType, recordName)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		if !owned {
+			return az.reportDNSRecordConflict(service, zoneID, recordName)
+		}
+		existingRecordSets[desired.recordType] = recordSet
+	}
+
+	if !owned {
+		klog.V(2).Infof("reconcileDNSRecords(%s): claiming record %s in zone %s", serviceName, recordName, zoneID)
+		if err := az.createOrUpdateDNSRecordSet(service, zoneID, privatedns.TXT, ownerRecordName, nil, buildDNSRecordSet(privatedns.TXT, nil, ttl, owner)); err != nil {
+			return err
+		}
+	}
+	if err := az.setServiceOwnedDNSRecord(service, zoneID, recordName); err != nil {
+		return err
+	}
+
+	for _, desired := range desiredRecords {
+		existing := existingRecordSets[desired.recordType]
+		if len(desired.ips) == 0 {
+			if existing != nil {
+				if err := az.deleteDNSRecordSet(service, zoneID, desired.recordType, recordName); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if existing != nil && existing.RecordSetProperties != nil &&
+			pointer.Int64Deref(existing.TTL, 0) == ttl &&
+			strings.Join(getDNSRecordSetIPs(existing), ",") == strings.Join(desired.ips, ",") {
+			continue
+		}
+		recordSet := buildDNSRecordSet(desired.recordType, desired.ips, ttl, owner)
+		if err := az.createOrUpdateDNSRecordSet(service, zoneID, desired.recordType, recordName, existing, recordSet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteOwnedDNSRecords deletes the A and AAAA records in the zone if they are owned by the service.
+func (az *Cloud) deleteOwnedDNSRecords(service *v1.Service, zoneID, recordName, owner string) error {
+	ownerRecordName := getDNSOwnerRecordName(recordName)
+	ownerRecordSet, exists, err := az.getDNSRecordSet(zoneID, privatedns.TXT, ownerRecordName)
+	if err != nil {
+		return err
+	}
+	if !exists || !isDNSRecordSetOwnedBy(ownerRecordSet, owner) {
+		klog.V(4).Infof("deleteOwnedDNSRecords(%s): the record %s in zone %s is not owned by the service", getServiceName(service), recordName, zoneID)
+		return nil
+	}
+
+	for _, recordType := range []privatedns.RecordType{privatedns.A, privatedns.AAAA} {
+		if err := az.deleteDNSRecordSet(service, zoneID, recordType, recordName); err != nil {
+			return err
+		}
+	}
+	// The ownership record is deleted at last so that the records could be cleaned up in the next retry.
+	return az.deleteDNSRecordSet(service, zoneID, privatedns.TXT, ownerRecordName)
+}
+
+// setServiceOwnedDNSRecord records the zone and the name of the DNS records owned by the service in its annotation.
+// The annotation is removed if the zone is empty.
+func (az *Cloud) setServiceOwnedDNSRecord(service *v1.Service, zoneID, recordName string) error {
+	var value *string
+	if zoneID != "" {
+		value = pointer.String(fmt.Sprintf("%s/%s", zoneID, recordName))
+	}
+	if pointer.StringDeref(value, "") == service.Annotations[consts.ServiceAnnotationDNSOwnedRecord] || az.inLoadBalancerPlan(service) {
+		return nil
+	}
+	return az.patchServiceAnnotations(service, map[string]*string{consts.ServiceAnnotationDNSOwnedRecord: value})
+}
+
+// reportDNSRecordConflict reports the DNS records not owned by the service.
+func (az *Cloud) reportDNSRecordConflict(service *v1.Service, zoneID, recordName string) error {
+	msg := fmt.Sprintf("the DNS record %s in zone %s is not owned by the service", recordName, zoneID)
+	az.Event(service, v1.EventTypeWarning, "DNSRecordConflict", msg)
+	return fmt.Errorf("reconcileDNSRecords(%s): %s", getServiceName(service), msg)
+}
@@ -0,0 +1,246 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/privatedns/mgmt/2018-09-01/privatedns"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/dnsrecordclient/mockdnsrecordclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const (
+	testDNSZoneID    = "/subscriptions/subscription/resourceGroups/dns-rg/providers/Microsoft.Network/dnszones/contoso.com"
+	testOldDNSZoneID = "/subscriptions/subscription/resourceGroups/dns-rg/providers/Microsoft.Network/privateDnsZones/contoso.internal"
+)
+
+func getTestDNSService(annotations map[string]string) v1.Service {
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[consts.ServiceAnnotationDNSZoneID] = testDNSZoneID
+	return getTestService("svc1", v1.ProtocolTCP, annotations, false, 80)
+}
+
+func TestGetServiceDNSRecordConfig(t *testing.T) {
+	for _, tc := range []struct {
+		desc         string
+		annotations  map[string]string
+		expectedName string
+		expectedTTL  int64
+		expectedErr  bool
+	}{
+		{
+			desc:         "defaults",
+			expectedName: "svc1",
+			expectedTTL:  consts.DefaultDNSRecordTTL,
+		},
+		{
+			desc: "customized record name and TTL",
+			annotations: map[string]string{
+				consts.ServiceAnnotationDNSRecordName: "WWW",
+				consts.ServiceAnnotationDNSRecordTTL:  "60",
+			},
+			expectedName: "www",
+			expectedTTL:  60,
+		},
+		{
+			desc:        "invalid TTL",
+			annotations: map[string]string{consts.ServiceAnnotationDNSRecordTTL: "-1"},
+			expectedErr: true,
+		},
+		{
+			desc:        "invalid record name",
+			annotations: map[string]string{consts.ServiceAnnotationDNSRecordName: "www."},
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			service := getTestDNSService(tc.annotations)
+			name, nameErr := getServiceDNSRecordName(&service)
+			ttl, ttlErr := getServiceDNSRecordTTL(&service)
+			assert.Equal(t, tc.expectedErr, nameErr != nil || ttlErr != nil)
+			if !tc.expectedErr {
+				assert.Equal(t, tc.expectedName, name)
+				assert.Equal(t, tc.expectedTTL, ttl)
+			}
+		})
+	}
+	assert.Equal(t, "k8s-azure-owner", getDNSOwnerRecordName("@"))
+	assert.Equal(t, "k8s-azure-owner.www", getDNSOwnerRecordName("www"))
+}
+
+func TestReconcileDNSRecords(t *testing.T) {
+	owner := getDNSRecordOwner("kubernetes", "default/svc1")
+	notFound := &retry.Error{HTTPStatusCode: http.StatusNotFound}
+	lbStatus := &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "1.2.3.4"}, {IP: "fd00::1"}}}
+
+	t.Run("the records should be created with the ownership record", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		az := GetTestCloud(ctrl)
+		service := getTestDNSService(nil)
+
+		mockClient := az.DNSRecordSetsClient.(*mockdnsrecordclient.MockInterface)
+		mockClient.EXPECT().Get(gomock.Any(), testDNSZoneID, gomock.Any(), gomock.Any()).Return(privatedns.RecordSet{}, notFound).Times(3)
+		mockClient.EXPECT().CreateOrUpdate(gomock.Any(), testDNSZoneID, privatedns.TXT, "k8s-azure-owner.svc1", gomock.Any(), "").DoAndReturn(
+			func(ctx context.Context, zoneID string, recordType privatedns.RecordType, name string, recordSet privatedns.RecordSet, etag string) *retry.Error {
+				assert.True(t, isDNSRecordSetOwnedBy(&recordSet, owner))
+				return nil
+			})
+		mockClient.EXPECT().CreateOrUpdate(gomock.Any(), testDNSZoneID, privatedns.A, "svc1", gomock.Any(), "").DoAndReturn(
+			func(ctx context.Context, zoneID string, recordType privatedns.RecordType, name string, recordSet privatedns.RecordSet, etag string) *retry.Error {
+				assert.Equal(t, []string{"1.2.3.4"}, getDNSRecordSetIPs(&recordSet))
+				assert.Equal(t, int64(consts.DefaultDNSRecordTTL), pointer.Int64Deref(recordSet.TTL, 0))
+				return nil
+			})
+		mockClient.EXPECT().CreateOrUpdate(gomock.Any(), testDNSZoneID, privatedns.AAAA, "svc1", gomock.Any(), "").DoAndReturn(
+			func(ctx context.Context, zoneID string, recordType privatedns.RecordType, name string, recordSet privatedns.RecordSet, etag string) *retry.Error {
+				assert.Equal(t, []string{"fd00::1"}, getDNSRecordSetIPs(&recordSet))
+				return nil
+			})
+
+		assert.NoError(t, az.reconcileDNSRecords("kubernetes", &service, lbStatus, true))
+		assert.Equal(t, testDNSZoneID+"/svc1", service.Annotations[consts.ServiceAnnotationDNSOwnedRecord])
+	})
+
+	t.Run("the stale owned records should be deleted when the zone or the name changes", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		az := GetTestCloud(ctrl)
+		service := getTestDNSService(map[string]string{consts.ServiceAnnotationDNSOwnedRecord: testOldDNSZoneID + "/www"})
+
+		mockClient := az.DNSRecordSetsClient.(*mockdnsrecordclient.MockInterface)
+		mockClient.EXPECT().Get(gomock.Any(), testOldDNSZoneID, privatedns.TXT, "k8s-azure-owner.www").Return(buildDNSRecordSet(privatedns.TXT, nil, 300, owner), nil)
+		mockClient.EXPECT().Delete(gomock.Any(), testOldDNSZoneID, privatedns.A, "www").Return(nil)
+		mockClient.EXPECT().Delete(gomock.Any(), testOldDNSZoneID, privatedns.AAAA, "www").Return(nil)
+		mockClient.EXPECT().Delete(gomock.Any(), testOldDNSZoneID, privatedns.TXT, "k8s-azure-owner.www").Return(nil)
+		mockClient.EXPECT().Get(gomock.Any(), testDNSZoneID, gomock.Any(), gomock.Any()).Return(privatedns.RecordSet{}, notFound).Times(3)
+		mockClient.EXPECT().CreateOrUpdate(gomock.Any(), testDNSZoneID, gomock.Any(), gomock.Any(), gomock.Any(), "").Return(nil).Times(3)
+
+		assert.NoError(t, az.reconcileDNSRecords("kubernetes", &service, lbStatus, true))
+		assert.Equal(t, testDNSZoneID+"/svc1", service.Annotations[consts.ServiceAnnotationDNSOwnedRecord])
+	})
+
+	t.Run("the owned records should be deleted when the zone annotation is removed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		az := GetTestCloud(ctrl)
+		service := getTestService("svc1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationDNSOwnedRecord: testOldDNSZoneID + "/svc1"}, false, 80)
+
+		mockClient := az.DNSRecordSetsClient.(*mockdnsrecordclient.MockInterface)
+		mockClient.EXPECT().Get(gomock.Any(), testOldDNSZoneID, privatedns.TXT, "k8s-azure-owner.svc1").Return(buildDNSRecordSet(privatedns.TXT, nil, 300, owner), nil)
+		mockClient.EXPECT().Delete(gomock.Any(), testOldDNSZoneID, gomock.Any(), gomock.Any()).Return(nil).Times(3)
+
+		assert.NoError(t, az.reconcileDNSRecords("kubernetes", &service, lbStatus, true))
+		assert.NotContains(t, service.Annotations, consts.ServiceAnnotationDNSOwnedRecord)
+	})
+
+	t.Run("the owned records should be updated only if changed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		az := GetTestCloud(ctrl)
+		service := getTestDNSService(nil)
+
+		existingA := buildDNSRecordSet(privatedns.A, []string{"1.2.3.4"}, consts.DefaultDNSRecordTTL, owner)
+		existingAAAA := buildDNSRecordSet(privatedns.AAAA, []string{"fd00::2"}, consts.DefaultDNSRecordTTL, owner)
+		existingAAAA.Etag = pointer.String("etag")
+		mockClient := az.DNSRecordSetsClient.(*mockdnsrecordclient.MockInterface)
+		mockClient.EXPECT().Get(gomock.Any(), testDNSZoneID, privatedns.TXT, "k8s-azure-owner.svc1").Return(buildDNSRecordSet(privatedns.TXT, nil, 300, owner), nil)
+		mockClient.EXPECT().Get(gomock.Any(), testDNSZoneID, privatedns.A, "svc1").Return(existingA, nil)
+		mockClient.EXPECT().Get(gomock.Any(), testDNSZoneID, privatedns.AAAA, "svc1").Return(existingAAAA, nil)
+		mockClient.EXPECT().CreateOrUpdate(gomock.Any(), testDNSZoneID, privatedns.AAAA, "svc1", gomock.Any(), "etag").Return(nil)
+
+		assert.NoError(t, az.reconcileDNSRecords("kubernetes", &service, lbStatus, true))
+	})
+
+	t.Run("the records owned by others should not be changed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		az := GetTestCloud(ctrl)
+		recorder := record.NewFakeRecorder(10)
+		az.eventRecorder = recorder
+		service := getTestDNSService(nil)
+
+		mockClient := az.DNSRecordSetsClient.(*mockdnsrecordclient.MockInterface)
+		mockClient.EXPECT().Get(gomock.Any(), testDNSZoneID, privatedns.TXT, gomock.Any()).Return(privatedns.RecordSet{}, notFound)
+		mockClient.EXPECT().Get(gomock.Any(), testDNSZoneID, privatedns.A, "svc1").Return(buildDNSRecordSet(privatedns.A, []string{"5.6.7.8"}, 300, ""), nil)
+		mockClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+		assert.Error(t, az.reconcileDNSRecords("kubernetes", &service, lbStatus, true))
+		assert.Contains(t, <-recorder.Events, "DNSRecordConflict")
+	})
+
+	t.Run("the owned records should be deleted", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		az := GetTestCloud(ctrl)
+		service := getTestDNSService(map[string]string{consts.ServiceAnnotationDNSRecordName: "@"})
+
+		mockClient := az.DNSRecordSetsClient.(*mockdnsrecordclient.MockInterface)
+		mockClient.EXPECT().Get(gomock.Any(), testDNSZoneID, privatedns.TXT, "k8s-azure-owner").Return(buildDNSRecordSet(privatedns.TXT, nil, 300, owner), nil)
+		mockClient.EXPECT().Delete(gomock.Any(), testDNSZoneID, privatedns.A, "@").Return(nil)
+		mockClient.EXPECT().Delete(gomock.Any(), testDNSZoneID, privatedns.AAAA, "@").Return(notFound)
+		mockClient.EXPECT().Delete(gomock.Any(), testDNSZoneID, privatedns.TXT, "k8s-azure-owner").Return(nil)
+
+		assert.NoError(t, az.reconcileDNSRecords("kubernetes", &service, nil, false))
+	})
+
+	t.Run("the recorded records should be deleted with the service, and the records owned by others should be kept", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		az := GetTestCloud(ctrl)
+		service := getTestDNSService(map[string]string{consts.ServiceAnnotationDNSOwnedRecord: testOldDNSZoneID + "/svc1"})
+
+		mockClient := az.DNSRecordSetsClient.(*mockdnsrecordclient.MockInterface)
+		mockClient.EXPECT().Get(gomock.Any(), testDNSZoneID, privatedns.TXT, "k8s-azure-owner.svc1").Return(buildDNSRecordSet(privatedns.TXT, nil, 300, "other"), nil)
+		mockClient.EXPECT().Get(gomock.Any(), testOldDNSZoneID, privatedns.TXT, "k8s-azure-owner.svc1").Return(buildDNSRecordSet(privatedns.TXT, nil, 300, owner), nil)
+		mockClient.EXPECT().Delete(gomock.Any(), testOldDNSZoneID, gomock.Any(), gomock.Any()).Return(nil).Times(3)
+
+		assert.NoError(t, az.reconcileDNSRecords("kubernetes", &service, nil, false))
+		assert.NotContains(t, service.Annotations, consts.ServiceAnnotationDNSOwnedRecord)
+	})
+
+	t.Run("the records should be planned in plan mode", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		az := GetTestCloud(ctrl)
+		plan := &loadBalancerPlan{Service: "default/svc1"}
+		az.lbPlans.Store(plan.Service, plan)
+		service := getTestDNSService(nil)
+
+		mockClient := az.DNSRecordSetsClient.(*mockdnsrecordclient.MockInterface)
+		mockClient.EXPECT().Get(gomock.Any(), testDNSZoneID, gomock.Any(), gomock.Any()).Return(privatedns.RecordSet{}, notFound).Times(3)
+		mockClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+		assert.NoError(t, az.reconcileDNSRecords("kubernetes", &service, lbStatus, true))
+		assert.Len(t, plan.Changes, 3)
+		assert.Equal(t, "dns-rg", plan.Changes[0].ResourceGroup)
+		assert.Equal(t, "contoso.com/TXT/k8s-azure-owner.svc1", plan.Changes[0].Name)
+	})
+}
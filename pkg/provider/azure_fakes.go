@@ -27,9 +27,13 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/tools/record"
 
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/applicationgatewayclient/mockapplicationgatewayclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/applicationsecuritygroupclient/mockapplicationsecuritygroupclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/diskclient/mockdiskclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/dnsrecordclient/mockdnsrecordclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/interfaceclient/mockinterfaceclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/natgatewayclient/mocknatgatewayclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/privatelinkserviceclient/mockprivatelinkserviceclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/routeclient/mockrouteclient"
@@ -85,6 +89,8 @@ func GetTestCloud(ctrl *gomock.Controller) (az *Cloud) {
 			RouteTableResourceGroup:                  "rg",
 			SecurityGroupResourceGroup:               "rg",
 			PrivateLinkServiceResourceGroup:          "rg",
+			ApplicationGatewayResourceGroup:          "rg",
+			GlobalLoadBalancerResourceGroup:          "rg",
 			Location:                                 "westus",
 			VnetName:                                 "vnet",
 			SubnetName:                               "subnet",
@@ -118,6 +124,10 @@ func GetTestCloud(ctrl *gomock.Controller) (az *Cloud) {
 	az.VirtualMachineScaleSetVMsClient = mockvmssvmclient.NewMockInterface(ctrl)
 	az.VirtualMachinesClient = mockvmclient.NewMockInterface(ctrl)
 	az.PrivateLinkServiceClient = mockprivatelinkserviceclient.NewMockInterface(ctrl)
+	az.ApplicationGatewayClient = mockapplicationgatewayclient.NewMockInterface(ctrl)
+	az.ApplicationSecurityGroupsClient = mockapplicationsecuritygroupclient.NewMockInterface(ctrl)
+	az.NatGatewaysClient = mocknatgatewayclient.NewMockInterface(ctrl)
+	az.DNSRecordSetsClient = mockdnsrecordclient.NewMockInterface(ctrl)
 	az.VMSet, _ = newAvailabilitySet(az)
 	az.vmCache, _ = az.newVMCache()
 	az.lbCache, _ = az.newLBCache()
@@ -0,0 +1,653 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+// getServiceGlobalLoadBalancerName returns the name of the cross-region load balancer of the service.
+func getServiceGlobalLoadBalancerName(service *v1.Service) (string, bool) {
+	lbName := strings.TrimSpace(service.Annotations[consts.ServiceAnnotationGlobalLoadBalancerName])
+	return lbName, lbName != ""
+}
+
+// getGlobalLoadBalancerBackendPoolName returns the backend pool of the global load balancer for the service.
+// The service UID is not used since it is different in each cluster.
+func getGlobalLoadBalancerBackendPoolName(service *v1.Service) string {
+	if poolName := strings.TrimSpace(service.Annotations[consts.ServiceAnnotationGlobalLoadBalancerBackendPoolName]); poolName != "" {
+		return poolName
+	}
+	return fmt.Sprintf("%s-%s", service.Namespace, service.Name)
+}
+
+// getGlobalLoadBalancerClusterID returns the identity of the cluster in the global load balancer and its public IP.
+// The cluster name is not unique among the clusters in different subscriptions or resource groups sharing the global
+// load balancer, so it is suffixed with the hash of the scope of the regional load balancers, which are named after
+// the cluster name in the load balancer resource group. The regional frontend of the service is not used since it
+// may move to another regional load balancer.
+func (az *Cloud) getGlobalLoadBalancerClusterID(clusterName string) string {
+	scope := fmt.Sprintf("%s/%s/%s", az.getNetworkResourceSubscriptionID(), az.getLoadBalancerResourceGroup(), clusterName)
+	sum := sha256.Sum256([]byte(strings.ToLower(scope)))
+	if len(clusterName) > globalLoadBalancerClusterNameMaxLength {
+		clusterName = clusterName[:globalLoadBalancerClusterNameMaxLength]
+	}
+	return fmt.Sprintf("%s-%s", clusterName, hex.EncodeToString(sum[:])[:globalLoadBalancerClusterIDHashLength])
+}
+
+func getGlobalLoadBalancerPublicIPName(lbName, poolName string) string {
+	return fmt.Sprintf("%s-%s", lbName, poolName)
+}
+
+func getGlobalLoadBalancerRuleName(poolName string, protocol v1.Protocol, port int32) string {
+	return fmt.Sprintf("%s-%s-%d", poolName, protocol, port)
+}
+
+// isGlobalPublicIP returns true if the public IP is of the global tier,
+// which can only be used by the cross-region load balancers.
+func isGlobalPublicIP(pip *network.PublicIPAddress) bool {
+	return pip != nil && pip.Sku != nil && strings.EqualFold(string(pip.Sku.Tier), string(network.PublicIPAddressSkuTierGlobal))
+}
+
+func isGlobalLoadBalancer(lb *network.LoadBalancer) bool {
+	return lb != nil && lb.Sku != nil && strings.EqualFold(string(lb.Sku.Tier), string(network.Global))
+}
+
+// globalLoadBalancerUpdateAttempts is the number of attempts to update the global load balancer and its public IP,
+// which are shared with other clusters and may be changed by them between the read and the write.
+const globalLoadBalancerUpdateAttempts = 3
+
+const (
+	// globalLoadBalancerClusterNameMaxLength keeps the cluster IDs short since they are listed in the cluster name tag
+	// of the global public IP, whose value is limited to 256 characters.
+	globalLoadBalancerClusterNameMaxLength = 24
+	globalLoadBalancerClusterIDHashLength  = 16
+)
+
+// globalLoadBalancerRegistration is a backend pool of a global load balancer the cluster registers the service into.
+type globalLoadBalancerRegistration struct {
+	lbName   string
+	poolName string
+	pipName  string
+}
+
+// reconcileGlobalLoadBalancer registers the regional frontend of the service into the backend pool of the
+// cross-region load balancer if wantLb is true and the service has the cross-region annotation. The other
+// registrations of the cluster for the service are removed, e.g. after the annotation is removed or changed.
+// The global load balancer is shared by the clusters exposing the same service in different regions:
+//  1. each cluster owns the backend address named after its cluster ID in the backend pool;
+//  2. the frontend, the rules and the global public IP are shared by the clusters whose IDs are listed in
+//     the cluster name tag of the public IP, and they are deleted together with the backend pool by the last cluster;
+//  3. the global load balancer is deleted when it is empty, only if it has been created by a cluster;
+//  4. the shared resources are read again and written with their etags, and the reconciliation is retried
+//     if they are changed by another cluster in the meantime.
+func (az *Cloud) reconcileGlobalLoadBalancer(clusterName string, service *v1.Service, fipConfig *network.FrontendIPConfiguration, wantLb bool) (*network.LoadBalancer, error) {
+	lbName, annotated := getServiceGlobalLoadBalancerName(service)
+	if !annotated && !hasServiceCondition(service, consts.ServiceConditionGlobalLoadBalancerReady) {
+		return nil, nil
+	}
+	wantLb = wantLb && annotated
+	serviceName := getServiceName(service)
+	poolName := getGlobalLoadBalancerBackendPoolName(service)
+	klog.V(2).Infof("reconcileGlobalLoadBalancer(%s): lb(%s) backend pool(%s) - wantLb(%t)", serviceName, lbName, poolName, wantLb)
+
+	var regionalFIPConfigID string
+	if wantLb {
+		if requiresInternalLoadBalancer(service) {
+			return nil, fmt.Errorf("reconcileGlobalLoadBalancer(%s): the global load balancer %s only supports external services", serviceName, lbName)
+		}
+		if fipConfig == nil || pointer.StringDeref(fipConfig.ID, "") == "" {
+			return nil, fmt.Errorf("reconcileGlobalLoadBalancer(%s): the frontend IP configuration of the service is not found", serviceName)
+		}
+		regionalFIPConfigID = *fipConfig.ID
+	}
+
+	clusterID := az.getGlobalLoadBalancerClusterID(clusterName)
+	registrations, err := az.listGlobalLoadBalancerRegistrations(clusterID, service)
+	if err != nil {
+		return nil, err
+	}
+	pipName := getGlobalLoadBalancerPublicIPName(lbName, poolName)
+	if annotated {
+		registrations = append(registrations, globalLoadBalancerRegistration{
+			lbName:   lbName,
+			poolName: poolName,
+			pipName:  pipName,
+		})
+	}
+	deregistered := make(map[string]bool)
+	for _, registration := range registrations {
+		key := strings.ToLower(registration.pipName)
+		if (wantLb && strings.EqualFold(registration.pipName, pipName)) || deregistered[key] {
+			continue
+		}
+		deregistered[key] = true
+		if err := retryOnGlobalLoadBalancerPreconditionFailed(serviceName, func() error {
+			return az.deregisterGlobalLoadBalancer(clusterID, service, registration)
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if !wantLb {
+		return nil, nil
+	}
+
+	var lb *network.LoadBalancer
+	err = retryOnGlobalLoadBalancerPreconditionFailed(serviceName, func() error {
+		var err error
+		lb, err = az.registerGlobalLoadBalancer(clusterID, service, lbName, poolName, regionalFIPConfigID)
+		return err
+	})
+	return lb, err
+}
+
+// retryOnGlobalLoadBalancerPreconditionFailed runs fn again if the global load balancer or its public IP
+// is changed by another cluster after it is read by fn.
+func retryOnGlobalLoadBalancerPreconditionFailed(serviceName string, fn func() error) error {
+	var err error
+	for i := 0; i < globalLoadBalancerUpdateAttempts; i++ {
+		if err = fn(); !retry.HasStatusPreconditionFailedError(err) {
+			return err
+		}
+		klog.V(2).Infof("reconcileGlobalLoadBalancer(%s): the global load balancer is changed by another cluster, retrying", serviceName)
+	}
+	return err
+}
+
+// listGlobalLoadBalancerRegistrations finds the registrations of the cluster for the service from the global
+// public IPs tagged with the service and the cluster, which is needed to remove them after the annotations
+// of the service are removed or changed.
+func (az *Cloud) listGlobalLoadBalancerRegistrations(clusterID string, service *v1.Service) ([]globalLoadBalancerRegistration, error) {
+	if !hasServiceCondition(service, consts.ServiceConditionGlobalLoadBalancerReady) {
+		return nil, nil
+	}
+	pips, err := az.listPIP(az.GlobalLoadBalancerResourceGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceName := getServiceName(service)
+	var registrations []globalLoadBalancerRegistration
+	for i := range pips {
+		pip := &pips[i]
+		if !isGlobalPublicIP(pip) ||
+			!isSVCNameInPIPTag(getServiceFromPIPServiceTags(pip.Tags), serviceName) ||
+			!isClusterNameInPIPTag(getClusterFromPIPClusterTags(pip.Tags), clusterID) {
+			continue
+		}
+		registration := globalLoadBalancerRegistration{pipName: pointer.StringDeref(pip.Name, "")}
+		// The frontend of the global load balancer is named after the backend pool.
+		if pip.PublicIPAddressPropertiesFormat != nil && pip.IPConfiguration != nil {
+			registration.lbName, registration.poolName = parseGlobalLoadBalancerFrontendID(pointer.StringDeref(pip.IPConfiguration.ID, ""))
+		}
+		registrations = append(registrations, registration)
+	}
+	return registrations, nil
+}
+
+// parseGlobalLoadBalancerFrontendID returns the load balancer name and the frontend name of a frontend IP configuration ID.
+func parseGlobalLoadBalancerFrontendID(fipConfigID string) (string, string) {
+	parts := strings.Split(fipConfigID, "/")
+	for i := 0; i+3 < len(parts); i++ {
+		if strings.EqualFold(parts[i], "loadBalancers") && strings.EqualFold(parts[i+2], "frontendIPConfigurations") {
+			return parts[i+1], parts[i+3]
+		}
+	}
+	return "", ""
+}
+
+// registerGlobalLoadBalancer binds the cluster to the global public IP and adds the regional frontend into
+// the backend pool of the global load balancer.
+func (az *Cloud) registerGlobalLoadBalancer(clusterID string, service *v1.Service, lbName, poolName, regionalFIPConfigID string) (*network.LoadBalancer, error) {
+	serviceName := getServiceName(service)
+	lb, existsLb, err := az.getGlobalLoadBalancer(lbName)
+	if err != nil {
+		return nil, err
+	}
+	if !existsLb {
+		lb = az.newGlobalLoadBalancer(lbName, clusterID)
+	} else if !isGlobalLoadBalancer(&lb) {
+		return nil, fmt.Errorf("reconcileGlobalLoadBalancer(%s): the load balancer %s is not of the global tier", serviceName, lbName)
+	}
+
+	rg := az.GlobalLoadBalancerResourceGroup
+	pipName := getGlobalLoadBalancerPublicIPName(lbName, poolName)
+	pip, existsPip, err := az.getPublicIPAddress(rg, pipName, azcache.CacheReadTypeForceRefresh)
+	if err != nil {
+		return nil, err
+	}
+	if existsPip && !isSVCNameInPIPTag(getServiceFromPIPServiceTags(pip.Tags), serviceName) {
+		return nil, fmt.Errorf("reconcileGlobalLoadBalancer(%s): the public IP %s of the global load balancer is not owned by the service", serviceName, pipName)
+	}
+
+	pipChanged := !existsPip
+	if !existsPip {
+		pip = az.newGlobalPublicIP(pipName, clusterID, serviceName)
+	} else {
+		clusterAdded, err := bindClustersToPIP(&pip, []string{clusterID}, false)
+		if err != nil {
+			return nil, err
+		}
+		pipChanged = clusterAdded
+	}
+	if pipChanged {
+		klog.V(2).Infof("reconcileGlobalLoadBalancer(%s): pip(%s) - binding cluster %s", serviceName, pipName, clusterID)
+		if err := az.CreateOrUpdateGlobalPIP(service, pip); err != nil {
+			return nil, err
+		}
+	}
+
+	if az.ensureGlobalLoadBalancerRegistration(&lb, clusterID, service, regionalFIPConfigID, az.getPublicIPAddressID(rg, pipName)) {
+		klog.V(2).Infof("reconcileGlobalLoadBalancer(%s): lb(%s) - updating", serviceName, lbName)
+		if err := az.CreateOrUpdateGlobalLB(service, lb); err != nil {
+			return nil, err
+		}
+		return az.getUpdatedGlobalLoadBalancer(service, lb)
+	}
+	return &lb, nil
+}
+
+// deregisterGlobalLoadBalancer removes the regional frontend of the cluster from the global load balancer.
+// The cluster is unbound from the public IP before the global load balancer is changed, so that the shared
+// frontend and public IP are only removed by the last cluster with the latest cluster name tag.
+func (az *Cloud) deregisterGlobalLoadBalancer(clusterID string, service *v1.Service, registration globalLoadBalancerRegistration) error {
+	serviceName := getServiceName(service)
+	rg := az.GlobalLoadBalancerResourceGroup
+	lbName, poolName, pipName := registration.lbName, registration.poolName, registration.pipName
+	klog.V(2).Infof("reconcileGlobalLoadBalancer(%s): deregistering cluster %s from lb(%s) backend pool(%s)", serviceName, clusterID, lbName, poolName)
+
+	pip, existsPip, err := az.getPublicIPAddress(rg, pipName, azcache.CacheReadTypeForceRefresh)
+	if err != nil {
+		return err
+	}
+	if existsPip && !isSVCNameInPIPTag(getServiceFromPIPServiceTags(pip.Tags), serviceName) {
+		return fmt.Errorf("reconcileGlobalLoadBalancer(%s): the public IP %s of the global load balancer is not owned by the service", serviceName, pipName)
+	}
+
+	var lastCluster bool
+	if existsPip {
+		clusterBound := isClusterNameInPIPTag(getClusterFromPIPClusterTags(pip.Tags), clusterID)
+		if lastCluster, err = unbindClusterFromPIP(&pip, clusterID); err != nil {
+			return err
+		}
+		if clusterBound {
+			klog.V(2).Infof("reconcileGlobalLoadBalancer(%s): pip(%s) - unbinding cluster %s", serviceName, pipName, clusterID)
+			if err := az.CreateOrUpdateGlobalPIP(service, pip); err != nil {
+				return err
+			}
+		}
+	}
+
+	if lbName != "" {
+		lb, existsLb, err := az.getGlobalLoadBalancer(lbName)
+		if err != nil {
+			return err
+		}
+		if existsLb {
+			lbChanged := removeGlobalLoadBalancerAddress(&lb, poolName, clusterID)
+			if lastCluster {
+				removeGlobalLoadBalancerFrontend(&lb, poolName)
+				lbChanged = true
+			}
+			if lbChanged {
+				if isGlobalLoadBalancerEmpty(&lb) && lb.Tags[consts.ClusterNameKey] != nil {
+					klog.V(2).Infof("reconcileGlobalLoadBalancer(%s): lb(%s) - deleting", serviceName, lbName)
+					if err := az.DeleteGlobalLB(service, lbName); err != nil {
+						return err
+					}
+				} else {
+					klog.V(2).Infof("reconcileGlobalLoadBalancer(%s): lb(%s) - updating", serviceName, lbName)
+					if err := az.CreateOrUpdateGlobalLB(service, lb); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	// The public IP can only be deleted after the frontend referencing it is removed, and it is kept
+	// if another cluster has been bound to it in the meantime.
+	if lastCluster {
+		if !az.inLoadBalancerPlan(service) {
+			pip, existsPip, err = az.getPublicIPAddress(rg, pipName, azcache.CacheReadTypeForceRefresh)
+			if err != nil {
+				return err
+			}
+			if !existsPip || getClusterFromPIPClusterTags(pip.Tags) != "" {
+				return nil
+			}
+		}
+		klog.V(2).Infof("reconcileGlobalLoadBalancer(%s): pip(%s) - deleting", serviceName, pipName)
+		if err := az.DeletePublicIP(service, rg, pipName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getUpdatedGlobalLoadBalancer gets the global load balancer again to report the IDs of the created resources.
+func (az *Cloud) getUpdatedGlobalLoadBalancer(service *v1.Service, lb network.LoadBalancer) (*network.LoadBalancer, error) {
+	if az.inLoadBalancerPlan(service) {
+		return &lb, nil
+	}
+	updated, _, err := az.getGlobalLoadBalancer(pointer.StringDeref(lb.Name, ""))
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (az *Cloud) newGlobalLoadBalancer(lbName, clusterID string) network.LoadBalancer {
+	location := az.GlobalLoadBalancerLocation
+	if location == "" {
+		location = az.Location
+	}
+
+	tags := parseTags(az.Tags, az.TagsMap)
+	// The cluster name tag marks the global load balancer as created by the cloud provider.
+	tags[consts.ClusterNameKey] = pointer.String(clusterID)
+	return network.LoadBalancer{
+		Name:     pointer.String(lbName),
+		Location: pointer.String(location),
+		Sku: &network.LoadBalancerSku{
+			Name: network.LoadBalancerSkuNameStandard,
+			Tier: network.Global,
+		},
+		Tags:                         tags,
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{},
+	}
+}
+
+func (az *Cloud) newGlobalPublicIP(pipName, clusterID, serviceName string) network.PublicIPAddress {
+	location := az.GlobalLoadBalancerLocation
+	if location == "" {
+		location = az.Location
+	}
+
+	tags := parseTags(az.Tags, az.TagsMap)
+	tags[consts.ServiceTagKey] = pointer.String(serviceName)
+	tags[consts.ClusterNameKey] = pointer.String(clusterID)
+	return network.PublicIPAddress{
+		Name:     pointer.String(pipName),
+		Location: pointer.String(location),
+		Sku: &network.PublicIPAddressSku{
+			Name: network.PublicIPAddressSkuNameStandard,
+			Tier: network.PublicIPAddressSkuTierGlobal,
+		},
+		Tags: tags,
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+			PublicIPAllocationMethod: network.Static,
+			PublicIPAddressVersion:   network.IPv4,
+		},
+	}
+}
+
+// ensureGlobalLoadBalancerRegistration ensures the frontend, the backend pool and the rules of the service
+// exist in the global load balancer and the regional frontend of the cluster is in the backend pool.
+// It returns true if the global load balancer is changed.
+func (az *Cloud) ensureGlobalLoadBalancerRegistration(lb *network.LoadBalancer, clusterID string, service *v1.Service, regionalFIPConfigID, pipID string) bool {
+	if lb.LoadBalancerPropertiesFormat == nil {
+		lb.LoadBalancerPropertiesFormat = &network.LoadBalancerPropertiesFormat{}
+	}
+	lbName := pointer.StringDeref(lb.Name, "")
+	rg := az.GlobalLoadBalancerResourceGroup
+	poolName := getGlobalLoadBalancerBackendPoolName(service)
+	fipConfigID := az.getFrontendIPConfigID(lbName, rg, poolName)
+	poolID := az.getBackendPoolID(lbName, rg, poolName)
+	var changed bool
+
+	// frontend
+	var fipConfigs []network.FrontendIPConfiguration
+	if lb.FrontendIPConfigurations != nil {
+		fipConfigs = *lb.FrontendIPConfigurations
+	}
+	foundFIPConfig := false
+	for i := range fipConfigs {
+		if !strings.EqualFold(pointer.StringDeref(fipConfigs[i].Name, ""), poolName) {
+			continue
+		}
+		foundFIPConfig = true
+		props := fipConfigs[i].FrontendIPConfigurationPropertiesFormat
+		if props == nil || props.PublicIPAddress == nil || !strings.EqualFold(pointer.StringDeref(props.PublicIPAddress.ID, ""), pipID) {
+			fipConfigs[i].FrontendIPConfigurationPropertiesFormat = &network.FrontendIPConfigurationPropertiesFormat{
+				PublicIPAddress: &network.PublicIPAddress{ID: pointer.String(pipID)},
+			}
+			changed = true
+		}
+	}
+	if !foundFIPConfig {
+		fipConfigs = append(fipConfigs, network.FrontendIPConfiguration{
+			Name: pointer.String(poolName),
+			ID:   pointer.String(fipConfigID),
+			FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+				PublicIPAddress: &network.PublicIPAddress{ID: pointer.String(pipID)},
+			},
+		})
+		changed = true
+	}
+	lb.FrontendIPConfigurations = &fipConfigs
+
+	// backend pool
+	var pools []network.BackendAddressPool
+	if lb.BackendAddressPools != nil {
+		pools = *lb.BackendAddressPools
+	}
+	poolIndex := -1
+	for i := range pools {
+		if strings.EqualFold(pointer.StringDeref(pools[i].Name, ""), poolName) {
+			poolIndex = i
+			break
+		}
+	}
+	if poolIndex < 0 {
+		pools = append(pools, network.BackendAddressPool{
+			Name: pointer.String(poolName),
+			ID:   pointer.String(poolID),
+		})
+		poolIndex = len(pools) - 1
+		changed = true
+	}
+	if pools[poolIndex].BackendAddressPoolPropertiesFormat == nil {
+		pools[poolIndex].BackendAddressPoolPropertiesFormat = &network.BackendAddressPoolPropertiesFormat{}
+	}
+	var addresses []network.LoadBalancerBackendAddress
+	if pools[poolIndex].LoadBalancerBackendAddresses != nil {
+		addresses = *pools[poolIndex].LoadBalancerBackendAddresses
+	}
+	foundAddress := false
+	for i := range addresses {
+		if !strings.EqualFold(pointer.StringDeref(addresses[i].Name, ""), clusterID) {
+			continue
+		}
+		foundAddress = true
+		props := addresses[i].LoadBalancerBackendAddressPropertiesFormat
+		if props == nil || props.LoadBalancerFrontendIPConfiguration == nil ||
+			!strings.EqualFold(pointer.StringDeref(props.LoadBalancerFrontendIPConfiguration.ID, ""), regionalFIPConfigID) {
+			addresses[i].LoadBalancerBackendAddressPropertiesFormat = &network.LoadBalancerBackendAddressPropertiesFormat{
+				LoadBalancerFrontendIPConfiguration: &network.SubResource{ID: pointer.String(regionalFIPConfigID)},
+			}
+			changed = true
+		}
+	}
+	if !foundAddress {
+		addresses = append(addresses, network.LoadBalancerBackendAddress{
+			Name: pointer.String(clusterID),
+			LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{
+				LoadBalancerFrontendIPConfiguration: &network.SubResource{ID: pointer.String(regionalFIPConfigID)},
+			},
+		})
+		changed = true
+	}
+	pools[poolIndex].LoadBalancerBackendAddresses = &addresses
+	lb.BackendAddressPools = &pools
+
+	// rules
+	expectedRules := getExpectedGlobalLoadBalancerRules(service, poolName, fipConfigID, poolID)
+	var rules []network.LoadBalancingRule
+	if lb.LoadBalancingRules != nil {
+		rules = *lb.LoadBalancingRules
+	}
+	var updatedRules []network.LoadBalancingRule
+	for _, rule := range rules {
+		if isGlobalLoadBalancerRuleOfFrontend(rule, fipConfigID) {
+			if !globalLoadBalancerRulesContain(expectedRules, rule) {
+				changed = true
+			}
+			continue
+		}
+		updatedRules = append(updatedRules, rule)
+	}
+	for _, rule := range expectedRules {
+		if !globalLoadBalancerRulesContain(rules, rule) {
+			changed = true
+		}
+	}
+	updatedRules = append(updatedRules, expectedRules...)
+	lb.LoadBalancingRules = &updatedRules
+
+	return changed
+}
+
+// getExpectedGlobalLoadBalancerRules returns one rule per service port. The backend port is the frontend
+// port of the regional load balancer rule, which is the service port.
+func getExpectedGlobalLoadBalancerRules(service *v1.Service, poolName, fipConfigID, poolID string) []network.LoadBalancingRule {
+	var rules []network.LoadBalancingRule
+	for _, port := range service.Spec.Ports {
+		transportProto, _, _, err := getProtocolsFromKubernetesProtocol(port.Protocol)
+		if err != nil {
+			klog.Warningf("getExpectedGlobalLoadBalancerRules(%s): skipping port %d: %v", getServiceName(service), port.Port, err)
+			continue
+		}
+		rules = append(rules, network.LoadBalancingRule{
+			Name: pointer.String(getGlobalLoadBalancerRuleName(poolName, port.Protocol, port.Port)),
+			LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+				Protocol:                *transportProto,
+				FrontendIPConfiguration: &network.SubResource{ID: pointer.String(fipConfigID)},
+				BackendAddressPool:      &network.SubResource{ID: pointer.String(poolID)},
+				FrontendPort:            pointer.Int32(port.Port),
+				BackendPort:             pointer.Int32(port.Port),
+				EnableFloatingIP:        pointer.Bool(false),
+			},
+		})
+	}
+	return rules
+}
+
+func isGlobalLoadBalancerRuleOfFrontend(rule network.LoadBalancingRule, fipConfigID string) bool {
+	return rule.LoadBalancingRulePropertiesFormat != nil &&
+		rule.FrontendIPConfiguration != nil &&
+		strings.EqualFold(pointer.StringDeref(rule.FrontendIPConfiguration.ID, ""), fipConfigID)
+}
+
+func globalLoadBalancerRulesContain(rules []network.LoadBalancingRule, rule network.LoadBalancingRule) bool {
+	for _, r := range rules {
+		if !strings.EqualFold(pointer.StringDeref(r.Name, ""), pointer.StringDeref(rule.Name, "")) ||
+			r.LoadBalancingRulePropertiesFormat == nil || rule.LoadBalancingRulePropertiesFormat == nil {
+			continue
+		}
+		if strings.EqualFold(string(r.Protocol), string(rule.Protocol)) &&
+			pointer.Int32Deref(r.FrontendPort, 0) == pointer.Int32Deref(rule.FrontendPort, 0) &&
+			pointer.Int32Deref(r.BackendPort, 0) == pointer.Int32Deref(rule.BackendPort, 0) &&
+			r.BackendAddressPool != nil && rule.BackendAddressPool != nil &&
+			strings.EqualFold(pointer.StringDeref(r.BackendAddressPool.ID, ""), pointer.StringDeref(rule.BackendAddressPool.ID, "")) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeGlobalLoadBalancerAddress removes the regional frontend of the cluster from the backend pool.
+func removeGlobalLoadBalancerAddress(lb *network.LoadBalancer, poolName, clusterID string) bool {
+	if lb.LoadBalancerPropertiesFormat == nil || lb.BackendAddressPools == nil {
+		return false
+	}
+	var changed bool
+	for i, pool := range *lb.BackendAddressPools {
+		if !strings.EqualFold(pointer.StringDeref(pool.Name, ""), poolName) ||
+			pool.BackendAddressPoolPropertiesFormat == nil || pool.LoadBalancerBackendAddresses == nil {
+			continue
+		}
+		addresses := *pool.LoadBalancerBackendAddresses
+		for j := len(addresses) - 1; j >= 0; j-- {
+			if strings.EqualFold(pointer.StringDeref(addresses[j].Name, ""), clusterID) {
+				addresses = append(addresses[:j], addresses[j+1:]...)
+				changed = true
+			}
+		}
+		(*lb.BackendAddressPools)[i].LoadBalancerBackendAddresses = &addresses
+	}
+	return changed
+}
+
+// removeGlobalLoadBalancerFrontend removes the frontend, the rules and the backend pool of the service.
+func removeGlobalLoadBalancerFrontend(lb *network.LoadBalancer, poolName string) {
+	if lb.LoadBalancerPropertiesFormat == nil {
+		return
+	}
+	var fipConfigID string
+	if lb.FrontendIPConfigurations != nil {
+		var fipConfigs []network.FrontendIPConfiguration
+		for _, fipConfig := range *lb.FrontendIPConfigurations {
+			if strings.EqualFold(pointer.StringDeref(fipConfig.Name, ""), poolName) {
+				fipConfigID = pointer.StringDeref(fipConfig.ID, "")
+				continue
+			}
+			fipConfigs = append(fipConfigs, fipConfig)
+		}
+		lb.FrontendIPConfigurations = &fipConfigs
+	}
+	if lb.LoadBalancingRules != nil {
+		var rules []network.LoadBalancingRule
+		for _, rule := range *lb.LoadBalancingRules {
+			if fipConfigID != "" && isGlobalLoadBalancerRuleOfFrontend(rule, fipConfigID) {
+				continue
+			}
+			rules = append(rules, rule)
+		}
+		lb.LoadBalancingRules = &rules
+	}
+	if lb.BackendAddressPools != nil {
+		var pools []network.BackendAddressPool
+		for _, pool := range *lb.BackendAddressPools {
+			if strings.EqualFold(pointer.StringDeref(pool.Name, ""), poolName) {
+				continue
+			}
+			pools = append(pools, pool)
+		}
+		lb.BackendAddressPools = &pools
+	}
+}
+
+func isGlobalLoadBalancerEmpty(lb *network.LoadBalancer) bool {
+	return lb.LoadBalancerPropertiesFormat == nil ||
+		((lb.FrontendIPConfigurations == nil || len(*lb.FrontendIPConfigurations) == 0) &&
+			(lb.BackendAddressPools == nil || len(*lb.BackendAddressPools) == 0))
+}
@@ -0,0 +1,406 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func getTestGlobalPublicIP(clusterNames string) network.PublicIPAddress {
+	return network.PublicIPAddress{
+		Name: pointer.String("global-lb-default-service1"),
+		Sku: &network.PublicIPAddressSku{
+			Name: network.PublicIPAddressSkuNameStandard,
+			Tier: network.PublicIPAddressSkuTierGlobal,
+		},
+		Tags: map[string]*string{
+			consts.ServiceTagKey:  pointer.String("default/service1"),
+			consts.ClusterNameKey: pointer.String(clusterNames),
+		},
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+			IPAddress: pointer.String("1.2.3.4"),
+		},
+	}
+}
+
+func TestReconcileGlobalLoadBalancer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	svc := getTestService("service1", v1.ProtocolTCP, map[string]string{
+		consts.ServiceAnnotationGlobalLoadBalancerName: "global-lb",
+	}, false, 80, 443)
+	fipConfig := &network.FrontendIPConfiguration{
+		Name: pointer.String("aservice1"),
+		ID:   pointer.String("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/testCluster/frontendIPConfigurations/aservice1"),
+	}
+	notFound := &retry.Error{HTTPStatusCode: http.StatusNotFound}
+	clusterID := GetTestCloud(ctrl).getGlobalLoadBalancerClusterID(testClusterName)
+
+	t.Run("should create the global load balancer and its public IP", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+		mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+
+		var created network.LoadBalancer
+		mockLBClient.EXPECT().Get(gomock.Any(), "rg", "global-lb", "").Return(network.LoadBalancer{}, notFound)
+		mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return(nil, nil).Times(2)
+		mockPIPClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "global-lb-default-service1", gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ interface{}, _, _ string, pip network.PublicIPAddress, _ string) *retry.Error {
+				assert.True(t, isGlobalPublicIP(&pip))
+				assert.Equal(t, clusterID, pointer.StringDeref(pip.Tags[consts.ClusterNameKey], ""))
+				assert.Equal(t, "default/service1", pointer.StringDeref(pip.Tags[consts.ServiceTagKey], ""))
+				return nil
+			})
+		mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "global-lb", gomock.Any(), "").DoAndReturn(
+			func(_ interface{}, _, _ string, lb network.LoadBalancer, _ string) *retry.Error {
+				assert.True(t, isGlobalLoadBalancer(&lb))
+				assert.Equal(t, 1, len(*lb.FrontendIPConfigurations))
+				assert.Equal(t, 2, len(*lb.LoadBalancingRules))
+				addresses := *(*lb.BackendAddressPools)[0].LoadBalancerBackendAddresses
+				assert.Equal(t, clusterID, pointer.StringDeref(addresses[0].Name, ""))
+				assert.Equal(t, fipConfig.ID, addresses[0].LoadBalancerFrontendIPConfiguration.ID)
+				created = lb
+				created.ID = pointer.String("globalLBID")
+				return nil
+			})
+		mockLBClient.EXPECT().Get(gomock.Any(), "rg", "global-lb", "").DoAndReturn(
+			func(_ interface{}, _, _, _ string) (network.LoadBalancer, *retry.Error) {
+				return created, nil
+			})
+
+		lb, err := az.reconcileGlobalLoadBalancer(testClusterName, &svc, fipConfig, true)
+		assert.NoError(t, err)
+		assert.Equal(t, "globalLBID", pointer.StringDeref(lb.ID, ""))
+	})
+
+	t.Run("should register the frontend of another cluster into the existing backend pool", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+		mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+
+		existing := az.newGlobalLoadBalancer("global-lb", "cluster0")
+		existing.Etag = pointer.String("etag")
+		az.ensureGlobalLoadBalancerRegistration(&existing, "cluster0", &svc, "cluster0FIPConfigID", az.getPublicIPAddressID("rg", "global-lb-default-service1"))
+		mockLBClient.EXPECT().Get(gomock.Any(), "rg", "global-lb", "").Return(existing, nil).Times(2)
+		pip := getTestGlobalPublicIP("cluster0")
+		pip.Etag = pointer.String("pipEtag")
+		mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{pip}, nil)
+		mockPIPClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "global-lb-default-service1", gomock.Any(), "pipEtag").DoAndReturn(
+			func(_ interface{}, _, _ string, pip network.PublicIPAddress, _ string) *retry.Error {
+				assert.Equal(t, "cluster0,"+clusterID, pointer.StringDeref(pip.Tags[consts.ClusterNameKey], ""))
+				return nil
+			})
+		mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "global-lb", gomock.Any(), "etag").DoAndReturn(
+			func(_ interface{}, _, _ string, lb network.LoadBalancer, _ string) *retry.Error {
+				assert.Equal(t, 1, len(*lb.FrontendIPConfigurations))
+				assert.Equal(t, 2, len(*lb.LoadBalancingRules))
+				assert.Equal(t, 2, len(*(*lb.BackendAddressPools)[0].LoadBalancerBackendAddresses))
+				return nil
+			})
+
+		_, err := az.reconcileGlobalLoadBalancer(testClusterName, &svc, fipConfig, true)
+		assert.NoError(t, err)
+	})
+
+	t.Run("should only remove the frontend of the cluster if other clusters are registered", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+		mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+
+		existing := az.newGlobalLoadBalancer("global-lb", "cluster0")
+		pipID := az.getPublicIPAddressID("rg", "global-lb-default-service1")
+		az.ensureGlobalLoadBalancerRegistration(&existing, "cluster0", &svc, "cluster0FIPConfigID", pipID)
+		az.ensureGlobalLoadBalancerRegistration(&existing, clusterID, &svc, *fipConfig.ID, pipID)
+		mockLBClient.EXPECT().Get(gomock.Any(), "rg", "global-lb", "").Return(existing, nil)
+		mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{getTestGlobalPublicIP("cluster0," + clusterID)}, nil)
+		mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "global-lb", gomock.Any(), "").DoAndReturn(
+			func(_ interface{}, _, _ string, lb network.LoadBalancer, _ string) *retry.Error {
+				assert.Equal(t, 1, len(*lb.FrontendIPConfigurations))
+				addresses := *(*lb.BackendAddressPools)[0].LoadBalancerBackendAddresses
+				assert.Equal(t, 1, len(addresses))
+				assert.Equal(t, "cluster0", pointer.StringDeref(addresses[0].Name, ""))
+				return nil
+			})
+		mockPIPClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "global-lb-default-service1", gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ interface{}, _, _ string, pip network.PublicIPAddress, _ string) *retry.Error {
+				assert.Equal(t, "cluster0", pointer.StringDeref(pip.Tags[consts.ClusterNameKey], ""))
+				return nil
+			})
+
+		_, err := az.reconcileGlobalLoadBalancer(testClusterName, &svc, nil, false)
+		assert.NoError(t, err)
+	})
+
+	t.Run("should not take over the registration of another cluster with the same name", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+		mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+
+		other := GetTestCloud(ctrl)
+		other.LoadBalancerResourceGroup = "rg2"
+		otherID := other.getGlobalLoadBalancerClusterID(testClusterName)
+		assert.NotEqual(t, clusterID, otherID)
+
+		existing := az.newGlobalLoadBalancer("global-lb", otherID)
+		pipID := az.getPublicIPAddressID("rg", "global-lb-default-service1")
+		az.ensureGlobalLoadBalancerRegistration(&existing, otherID, &svc, "otherFIPConfigID", pipID)
+		mockLBClient.EXPECT().Get(gomock.Any(), "rg", "global-lb", "").Return(existing, nil).Times(2)
+		mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{getTestGlobalPublicIP(otherID)}, nil)
+		mockPIPClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "global-lb-default-service1", gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ interface{}, _, _ string, pip network.PublicIPAddress, _ string) *retry.Error {
+				assert.Equal(t, otherID+","+clusterID, pointer.StringDeref(pip.Tags[consts.ClusterNameKey], ""))
+				return nil
+			})
+		mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "global-lb", gomock.Any(), "").DoAndReturn(
+			func(_ interface{}, _, _ string, lb network.LoadBalancer, _ string) *retry.Error {
+				addresses := *(*lb.BackendAddressPools)[0].LoadBalancerBackendAddresses
+				assert.Equal(t, 2, len(addresses))
+				assert.Equal(t, "otherFIPConfigID", pointer.StringDeref(addresses[0].LoadBalancerFrontendIPConfiguration.ID, ""))
+				assert.Equal(t, *fipConfig.ID, pointer.StringDeref(addresses[1].LoadBalancerFrontendIPConfiguration.ID, ""))
+				return nil
+			})
+
+		_, err := az.reconcileGlobalLoadBalancer(testClusterName, &svc, fipConfig, true)
+		assert.NoError(t, err)
+	})
+
+	t.Run("should keep the registration of another cluster with the same name when deregistering", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+		mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+
+		other := GetTestCloud(ctrl)
+		other.LoadBalancerResourceGroup = "rg2"
+		otherID := other.getGlobalLoadBalancerClusterID(testClusterName)
+
+		existing := az.newGlobalLoadBalancer("global-lb", otherID)
+		pipID := az.getPublicIPAddressID("rg", "global-lb-default-service1")
+		az.ensureGlobalLoadBalancerRegistration(&existing, otherID, &svc, "otherFIPConfigID", pipID)
+		az.ensureGlobalLoadBalancerRegistration(&existing, clusterID, &svc, *fipConfig.ID, pipID)
+		mockLBClient.EXPECT().Get(gomock.Any(), "rg", "global-lb", "").Return(existing, nil)
+		mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{getTestGlobalPublicIP(otherID + "," + clusterID)}, nil)
+		mockPIPClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "global-lb-default-service1", gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ interface{}, _, _ string, pip network.PublicIPAddress, _ string) *retry.Error {
+				assert.Equal(t, otherID, pointer.StringDeref(pip.Tags[consts.ClusterNameKey], ""))
+				return nil
+			})
+		mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "global-lb", gomock.Any(), "").DoAndReturn(
+			func(_ interface{}, _, _ string, lb network.LoadBalancer, _ string) *retry.Error {
+				assert.Equal(t, 1, len(*lb.FrontendIPConfigurations))
+				addresses := *(*lb.BackendAddressPools)[0].LoadBalancerBackendAddresses
+				assert.Equal(t, 1, len(addresses))
+				assert.Equal(t, otherID, pointer.StringDeref(addresses[0].Name, ""))
+				return nil
+			})
+		mockLBClient.EXPECT().Delete(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+		mockPIPClient.EXPECT().Delete(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+		_, err := az.reconcileGlobalLoadBalancer(testClusterName, &svc, nil, false)
+		assert.NoError(t, err)
+	})
+
+	t.Run("should delete the global load balancer and its public IP after the last cluster is removed", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+		mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+
+		existing := az.newGlobalLoadBalancer("global-lb", clusterID)
+		az.ensureGlobalLoadBalancerRegistration(&existing, clusterID, &svc, *fipConfig.ID, az.getPublicIPAddressID("rg", "global-lb-default-service1"))
+		mockLBClient.EXPECT().Get(gomock.Any(), "rg", "global-lb", "").Return(existing, nil)
+		gomock.InOrder(
+			mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{getTestGlobalPublicIP(clusterID)}, nil),
+			mockPIPClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "global-lb-default-service1", gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ interface{}, _, _ string, pip network.PublicIPAddress, _ string) *retry.Error {
+					assert.Equal(t, "", pointer.StringDeref(pip.Tags[consts.ClusterNameKey], ""))
+					return nil
+				}),
+			mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{getTestGlobalPublicIP("")}, nil),
+		)
+		mockLBClient.EXPECT().Delete(gomock.Any(), "rg", "global-lb").Return(nil)
+		mockPIPClient.EXPECT().Delete(gomock.Any(), "rg", "global-lb-default-service1").Return(nil)
+
+		lb, err := az.reconcileGlobalLoadBalancer(testClusterName, &svc, nil, false)
+		assert.NoError(t, err)
+		assert.Nil(t, lb)
+	})
+
+	t.Run("should keep the public IP if another cluster is bound to it after the last cluster is removed", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+		mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+
+		existing := az.newGlobalLoadBalancer("global-lb", clusterID)
+		az.ensureGlobalLoadBalancerRegistration(&existing, clusterID, &svc, *fipConfig.ID, az.getPublicIPAddressID("rg", "global-lb-default-service1"))
+		mockLBClient.EXPECT().Get(gomock.Any(), "rg", "global-lb", "").Return(existing, nil)
+		gomock.InOrder(
+			mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{getTestGlobalPublicIP(clusterID)}, nil),
+			mockPIPClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "global-lb-default-service1", gomock.Any(), gomock.Any()).Return(nil),
+			mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{getTestGlobalPublicIP("cluster1")}, nil),
+		)
+		mockLBClient.EXPECT().Delete(gomock.Any(), "rg", "global-lb").Return(nil)
+		mockPIPClient.EXPECT().Delete(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+		_, err := az.reconcileGlobalLoadBalancer(testClusterName, &svc, nil, false)
+		assert.NoError(t, err)
+	})
+
+	t.Run("should read the global load balancer again if it is changed by another cluster", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+		mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+
+		stale := az.newGlobalLoadBalancer("global-lb", "cluster0")
+		stale.Etag = pointer.String("stale")
+		pipID := az.getPublicIPAddressID("rg", "global-lb-default-service1")
+		az.ensureGlobalLoadBalancerRegistration(&stale, "cluster0", &svc, "cluster0FIPConfigID", pipID)
+		latest := az.newGlobalLoadBalancer("global-lb", "cluster0")
+		latest.Etag = pointer.String("latest")
+		az.ensureGlobalLoadBalancerRegistration(&latest, "cluster0", &svc, "cluster0FIPConfigID", pipID)
+		az.ensureGlobalLoadBalancerRegistration(&latest, "cluster1", &svc, "cluster1FIPConfigID", pipID)
+		gomock.InOrder(
+			mockLBClient.EXPECT().Get(gomock.Any(), "rg", "global-lb", "").Return(stale, nil),
+			mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "global-lb", gomock.Any(), "stale").Return(&retry.Error{HTTPStatusCode: http.StatusPreconditionFailed}),
+			mockLBClient.EXPECT().Get(gomock.Any(), "rg", "global-lb", "").Return(latest, nil),
+			mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "global-lb", gomock.Any(), "latest").DoAndReturn(
+				func(_ interface{}, _, _ string, lb network.LoadBalancer, _ string) *retry.Error {
+					assert.Equal(t, 3, len(*(*lb.BackendAddressPools)[0].LoadBalancerBackendAddresses))
+					return nil
+				}),
+			mockLBClient.EXPECT().Get(gomock.Any(), "rg", "global-lb", "").Return(latest, nil),
+		)
+		mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{getTestGlobalPublicIP("cluster0,cluster1," + clusterID)}, nil).Times(2)
+
+		_, err := az.reconcileGlobalLoadBalancer(testClusterName, &svc, fipConfig, true)
+		assert.NoError(t, err)
+	})
+
+	t.Run("should deregister the service after the annotation is removed", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+		mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+
+		unannotated := getTestService("service1", v1.ProtocolTCP, nil, false, 80, 443)
+		unannotated.Status.Conditions = []metav1.Condition{{Type: consts.ServiceConditionGlobalLoadBalancerReady, Status: metav1.ConditionTrue}}
+		existing := az.newGlobalLoadBalancer("global-lb", "cluster0")
+		pipID := az.getPublicIPAddressID("rg", "global-lb-default-service1")
+		az.ensureGlobalLoadBalancerRegistration(&existing, "cluster0", &svc, "cluster0FIPConfigID", pipID)
+		az.ensureGlobalLoadBalancerRegistration(&existing, clusterID, &svc, *fipConfig.ID, pipID)
+		pip := getTestGlobalPublicIP("cluster0," + clusterID)
+		pip.IPConfiguration = &network.IPConfiguration{ID: pointer.String(az.getFrontendIPConfigID("global-lb", "rg", "default-service1"))}
+		mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{pip}, nil).Times(2)
+		mockPIPClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "global-lb-default-service1", gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ interface{}, _, _ string, pip network.PublicIPAddress, _ string) *retry.Error {
+				assert.Equal(t, "cluster0", pointer.StringDeref(pip.Tags[consts.ClusterNameKey], ""))
+				return nil
+			})
+		mockLBClient.EXPECT().Get(gomock.Any(), "rg", "global-lb", "").Return(existing, nil)
+		mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "global-lb", gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ interface{}, _, _ string, lb network.LoadBalancer, _ string) *retry.Error {
+				addresses := *(*lb.BackendAddressPools)[0].LoadBalancerBackendAddresses
+				assert.Equal(t, 1, len(addresses))
+				assert.Equal(t, "cluster0", pointer.StringDeref(addresses[0].Name, ""))
+				return nil
+			})
+
+		lb, err := az.reconcileGlobalLoadBalancer(testClusterName, &unannotated, fipConfig, true)
+		assert.NoError(t, err)
+		assert.Nil(t, lb)
+	})
+
+	t.Run("should not register internal services", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		internalSvc := getInternalTestService("service1", 80)
+		internalSvc.Annotations[consts.ServiceAnnotationGlobalLoadBalancerName] = "global-lb"
+
+		_, err := az.reconcileGlobalLoadBalancer(testClusterName, &internalSvc, fipConfig, true)
+		assert.EqualError(t, err, "reconcileGlobalLoadBalancer(default/service1): the global load balancer global-lb only supports external services")
+	})
+
+	t.Run("should not use a public IP owned by another service", func(t *testing.T) {
+		az := GetTestCloud(ctrl)
+		mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+		mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+
+		pip := getTestGlobalPublicIP("cluster0")
+		pip.Tags[consts.ServiceTagKey] = pointer.String("default/service2")
+		mockLBClient.EXPECT().Get(gomock.Any(), "rg", "global-lb", "").Return(network.LoadBalancer{}, notFound)
+		mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{pip}, nil)
+
+		_, err := az.reconcileGlobalLoadBalancer(testClusterName, &svc, fipConfig, true)
+		assert.EqualError(t, err, "reconcileGlobalLoadBalancer(default/service1): the public IP global-lb-default-service1 of the global load balancer is not owned by the service")
+	})
+}
+
+func TestParseGlobalLoadBalancerFrontendID(t *testing.T) {
+	lbName, fipConfigName := parseGlobalLoadBalancerFrontendID("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/global-lb/frontendIPConfigurations/default-service1")
+	assert.Equal(t, "global-lb", lbName)
+	assert.Equal(t, "default-service1", fipConfigName)
+
+	lbName, fipConfigName = parseGlobalLoadBalancerFrontendID("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/nic/ipConfigurations/ipconfig")
+	assert.Empty(t, lbName)
+	assert.Empty(t, fipConfigName)
+}
+
+func TestEnsureGlobalLoadBalancerRegistration(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, map[string]string{
+		consts.ServiceAnnotationGlobalLoadBalancerName:            "global-lb",
+		consts.ServiceAnnotationGlobalLoadBalancerBackendPoolName: "pool",
+	}, false, 80)
+	pipID := az.getPublicIPAddressID("rg", "global-lb-pool")
+
+	lb := az.newGlobalLoadBalancer("global-lb", testClusterName)
+	assert.True(t, az.ensureGlobalLoadBalancerRegistration(&lb, testClusterName, &svc, "fipConfigID", pipID))
+	assert.Equal(t, "pool-TCP-80", pointer.StringDeref((*lb.LoadBalancingRules)[0].Name, ""))
+	assert.Equal(t, "pool", pointer.StringDeref((*lb.BackendAddressPools)[0].Name, ""))
+	assert.False(t, az.ensureGlobalLoadBalancerRegistration(&lb, testClusterName, &svc, "fipConfigID", pipID))
+
+	// the regional frontend is changed
+	assert.True(t, az.ensureGlobalLoadBalancerRegistration(&lb, testClusterName, &svc, "newFIPConfigID", pipID))
+	addresses := *(*lb.BackendAddressPools)[0].LoadBalancerBackendAddresses
+	assert.Equal(t, 1, len(addresses))
+	assert.Equal(t, "newFIPConfigID", pointer.StringDeref(addresses[0].LoadBalancerFrontendIPConfiguration.ID, ""))
+
+	// the ports are changed
+	svc.Spec.Ports = append(svc.Spec.Ports, v1.ServicePort{Protocol: v1.ProtocolUDP, Port: 53})
+	assert.True(t, az.ensureGlobalLoadBalancerRegistration(&lb, testClusterName, &svc, "newFIPConfigID", pipID))
+	assert.Equal(t, 2, len(*lb.LoadBalancingRules))
+	assert.Equal(t, "pool-UDP-53", pointer.StringDeref((*lb.LoadBalancingRules)[1].Name, ""))
+
+	removeGlobalLoadBalancerAddress(&lb, "pool", testClusterName)
+	removeGlobalLoadBalancerFrontend(&lb, "pool")
+	assert.True(t, isGlobalLoadBalancerEmpty(&lb))
+	assert.Equal(t, 0, len(*lb.LoadBalancingRules))
+}
@@ -0,0 +1,330 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-03-01/compute"
+	"golang.org/x/sync/singleflight"
+
+	v1 "k8s.io/api/core/v1"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+const (
+	// defaultInstanceInventoryTTL is the default TTL of the instance inventory.
+	defaultInstanceInventoryTTL = 10 * time.Minute
+	// instanceInventoryMinRefreshInterval limits how often the inventory is refreshed for the provider IDs
+	// missing in it or the invalidated nodes, e.g. when many nodes are added at the same time.
+	instanceInventoryMinRefreshInterval = 30 * time.Second
+)
+
+// instanceInventoryEntry holds the information of a VM answering the InstancesV2 calls. The zone and the power
+// state are nil or empty if they are unknown from the list calls, e.g. the fault domain and power state of the
+// standalone VMs are only in their instance views.
+type instanceInventoryEntry struct {
+	instanceType      string
+	zone              *cloudprovider.Zone
+	powerState        string
+	provisioningState string
+	// addresses are resolved from the NICs of the node on demand, and are kept until the inventory is refreshed.
+	addresses []v1.NodeAddress
+}
+
+// instanceInventory indexes the VMSS VMs, VMSS Flex VMs and availability set VMs by their provider IDs. It is
+// rebuilt from the list calls in the node resource groups when it expires, and the entries of the deleted
+// nodes are invalidated by the node informer.
+type instanceInventory struct {
+	lock    sync.Mutex
+	entries map[string]*instanceInventoryEntry
+	// missing holds the provider IDs not found after a refresh, e.g. the VMs out of the node resource groups.
+	// They don't refresh the inventory again until it expires.
+	missing     map[string]bool
+	refreshedAt time.Time
+	dirty       bool
+	ttl         time.Duration
+	// refreshGroup shares a single refresh among the concurrent lookups. The list calls are made without the lock.
+	refreshGroup singleflight.Group
+
+	list func(ctx context.Context) (map[string]*instanceInventoryEntry, error)
+	now  func() time.Time
+}
+
+func newInstanceInventory(ttl time.Duration, list func(ctx context.Context) (map[string]*instanceInventoryEntry, error)) *instanceInventory {
+	if ttl <= 0 {
+		ttl = defaultInstanceInventoryTTL
+	}
+	return &instanceInventory{
+		ttl:  ttl,
+		list: list,
+		now:  time.Now,
+	}
+}
+
+// get returns a copy of the entry of the provider ID. The inventory is refreshed if it is expired, or if the
+// provider ID is not looked up since the last expiry or an entry is invalidated, and the inventory is not
+// refreshed recently. found is false if the
+// provider ID is still missing or the refresh fails, in which case the caller falls back to the lookups of
+// the node.
+func (inv *instanceInventory) get(ctx context.Context, providerID string) (entry instanceInventoryEntry, found bool) {
+	key := strings.ToLower(providerID)
+
+	inv.lock.Lock()
+	now := inv.now()
+	current, found := inv.entries[key]
+	expired := inv.entries == nil || now.Sub(inv.refreshedAt) >= inv.ttl
+	unknown := !found && !inv.missing[key]
+	if !expired && (!(unknown || inv.dirty) || now.Sub(inv.refreshedAt) < instanceInventoryMinRefreshInterval) {
+		defer inv.lock.Unlock()
+		if !found {
+			return instanceInventoryEntry{}, false
+		}
+		return *current, true
+	}
+	inv.lock.Unlock()
+
+	if _, err, _ := inv.refreshGroup.Do("", func() (interface{}, error) {
+		return nil, inv.refresh(ctx)
+	}); err != nil {
+		klog.Errorf("instanceInventory: failed to refresh the instance inventory: %v", err)
+		return instanceInventoryEntry{}, false
+	}
+
+	inv.lock.Lock()
+	defer inv.lock.Unlock()
+	current, found = inv.entries[key]
+	if !found {
+		inv.missing[key] = true
+		return instanceInventoryEntry{}, false
+	}
+	return *current, true
+}
+
+// refresh rebuilds the inventory from the list calls. The missing provider IDs are forgotten if the inventory
+// is expired.
+func (inv *instanceInventory) refresh(ctx context.Context) error {
+	startedAt := inv.now()
+	entries, err := inv.list(ctx)
+	if err != nil {
+		return err
+	}
+	klog.V(4).Infof("instanceInventory: refreshed the instance inventory with %d instances", len(entries))
+
+	inv.lock.Lock()
+	defer inv.lock.Unlock()
+	if inv.entries == nil || startedAt.Sub(inv.refreshedAt) >= inv.ttl {
+		inv.missing = make(map[string]bool)
+	}
+	inv.entries = entries
+	inv.refreshedAt = startedAt
+	inv.dirty = false
+	return nil
+}
+
+// setAddresses keeps the resolved node addresses in the entry of the provider ID.
+func (inv *instanceInventory) setAddresses(providerID string, addresses []v1.NodeAddress) {
+	inv.lock.Lock()
+	defer inv.lock.Unlock()
+
+	if entry, found := inv.entries[strings.ToLower(providerID)]; found {
+		entry.addresses = addresses
+	}
+}
+
+// invalidate removes the entry of the provider ID, and the inventory is refreshed on the next lookup of it.
+func (inv *instanceInventory) invalidate(providerID string) {
+	inv.lock.Lock()
+	defer inv.lock.Unlock()
+
+	delete(inv.entries, strings.ToLower(providerID))
+	delete(inv.missing, strings.ToLower(providerID))
+	inv.dirty = true
+}
+
+// invalidateInstanceInventory invalidates the inventory entry of the node which is deleted or whose provider ID
+// is changed.
+func (az *Cloud) invalidateInstanceInventory(prevNode, newNode *v1.Node) {
+	if az.instanceInventory == nil || prevNode == nil || prevNode.Spec.ProviderID == "" {
+		return
+	}
+	if newNode != nil && strings.EqualFold(newNode.Spec.ProviderID, prevNode.Spec.ProviderID) {
+		return
+	}
+	klog.V(4).Infof("invalidateInstanceInventory: invalidating the instance %s of node %s", prevNode.Spec.ProviderID, prevNode.Name)
+	az.instanceInventory.invalidate(prevNode.Spec.ProviderID)
+}
+
+// getInstanceInventoryEntry returns the inventory entry of the node. found is false if the inventory is disabled
+// or the node is not found in it.
+func (az *Cloud) getInstanceInventoryEntry(ctx context.Context, node *v1.Node) (entry instanceInventoryEntry, found bool) {
+	if az.instanceInventory == nil || node.Spec.ProviderID == "" || az.IsNodeUnmanagedByProviderID(node.Spec.ProviderID) {
+		return instanceInventoryEntry{}, false
+	}
+	return az.instanceInventory.get(ctx, node.Spec.ProviderID)
+}
+
+// listInstanceInventory lists the VMSS VMs, VMSS Flex VMs and availability set VMs in the node resource groups.
+func (az *Cloud) listInstanceInventory(ctx context.Context) (map[string]*instanceInventoryEntry, error) {
+	resourceGroups, err := az.GetResourceGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]*instanceInventoryEntry)
+	for _, resourceGroup := range resourceGroups.List() {
+		scaleSets, rerr := az.VirtualMachineScaleSetsClient.List(ctx, resourceGroup)
+		if rerr != nil {
+			if rerr.IsNotFound() {
+				klog.Warningf("listInstanceInventory: skipping resource group %s due to error: %v", resourceGroup, rerr.Error())
+				continue
+			}
+			return nil, rerr.Error()
+		}
+
+		var flexScaleSetIDs []string
+		for _, scaleSet := range scaleSets {
+			if scaleSet.Name == nil || scaleSet.ID == nil {
+				continue
+			}
+			if scaleSet.VirtualMachineScaleSetProperties != nil && scaleSet.OrchestrationMode == compute.Flexible {
+				flexScaleSetIDs = append(flexScaleSetIDs, *scaleSet.ID)
+				continue
+			}
+
+			vms, rerr := az.VirtualMachineScaleSetVMsClient.List(ctx, resourceGroup, *scaleSet.Name, string(compute.InstanceViewTypesInstanceView))
+			if rerr != nil {
+				return nil, rerr.Error()
+			}
+			for i := range vms {
+				if vms[i].ID != nil {
+					entries[getInstanceInventoryKey(*vms[i].ID)] = az.getInstanceInventoryEntryFromVMSSVM(&vms[i])
+				}
+			}
+		}
+
+		vms, rerr := az.VirtualMachinesClient.List(ctx, resourceGroup)
+		if rerr != nil {
+			return nil, rerr.Error()
+		}
+		for i := range vms {
+			if vms[i].ID != nil {
+				entries[getInstanceInventoryKey(*vms[i].ID)] = az.getInstanceInventoryEntryFromVM(&vms[i])
+			}
+		}
+
+		// The power states of the VMSS Flex VMs are listed by the scale sets.
+		for _, scaleSetID := range flexScaleSetIDs {
+			vms, rerr := az.VirtualMachinesClient.ListVmssFlexVMsWithOnlyInstanceView(ctx, scaleSetID)
+			if rerr != nil {
+				return nil, rerr.Error()
+			}
+			for i := range vms {
+				if vms[i].ID == nil || vms[i].VirtualMachineProperties == nil || vms[i].InstanceView == nil {
+					continue
+				}
+				if entry, found := entries[getInstanceInventoryKey(*vms[i].ID)]; found {
+					entry.powerState = vmPowerStateStopped
+					if vms[i].InstanceView.Statuses != nil {
+						entry.powerState = getPowerStateFromStatuses(*vms[i].InstanceView.Statuses)
+					}
+				}
+			}
+		}
+	}
+	return entries, nil
+}
+
+func (az *Cloud) getInstanceInventoryEntryFromVMSSVM(vm *compute.VirtualMachineScaleSetVM) *instanceInventoryEntry {
+	entry := &instanceInventoryEntry{}
+	if vm.Sku != nil {
+		entry.instanceType = pointer.StringDeref(vm.Sku.Name, "")
+	}
+	location := pointer.StringDeref(vm.Location, "")
+	if vm.Zones != nil {
+		entry.zone = az.getInstanceInventoryZone(location, *vm.Zones, nil)
+	}
+
+	props := vm.VirtualMachineScaleSetVMProperties
+	if props == nil {
+		return entry
+	}
+	entry.provisioningState = pointer.StringDeref(props.ProvisioningState, "")
+	// The instance view is nil when the VM is being deleted, which is regarded as stopped.
+	entry.powerState = vmPowerStateStopped
+	if props.InstanceView != nil {
+		if props.InstanceView.Statuses != nil {
+			entry.powerState = getPowerStateFromStatuses(*props.InstanceView.Statuses)
+		}
+		if entry.zone == nil {
+			entry.zone = az.getInstanceInventoryZone(location, nil, props.InstanceView.PlatformFaultDomain)
+		}
+	}
+	return entry
+}
+
+func (az *Cloud) getInstanceInventoryEntryFromVM(vm *compute.VirtualMachine) *instanceInventoryEntry {
+	entry := &instanceInventoryEntry{}
+	if vm.Zones != nil {
+		entry.zone = az.getInstanceInventoryZone(pointer.StringDeref(vm.Location, ""), *vm.Zones, nil)
+	}
+
+	props := vm.VirtualMachineProperties
+	if props == nil {
+		return entry
+	}
+	if props.HardwareProfile != nil {
+		entry.instanceType = string(props.HardwareProfile.VMSize)
+	}
+	entry.provisioningState = pointer.StringDeref(props.ProvisioningState, "")
+	return entry
+}
+
+// getInstanceInventoryZone returns the availability zone, or the fault domain if the zone is not used. It
+// returns nil if neither is known.
+func (az *Cloud) getInstanceInventoryZone(location string, zones []string, faultDomain *int32) *cloudprovider.Zone {
+	var failureDomain string
+	if len(zones) > 0 {
+		zoneID, err := strconv.Atoi(zones[0])
+		if err != nil {
+			klog.Warningf("getInstanceInventoryZone: failed to parse zone %q: %v", zones, err)
+			return nil
+		}
+		failureDomain = az.makeZone(location, zoneID)
+	} else if faultDomain != nil {
+		failureDomain = strconv.Itoa(int(*faultDomain))
+	} else {
+		return nil
+	}
+	return &cloudprovider.Zone{
+		FailureDomain: strings.ToLower(failureDomain),
+		Region:        strings.ToLower(location),
+	}
+}
+
+// getInstanceInventoryKey returns the provider ID of the resource ID in lower case.
+func getInstanceInventoryKey(resourceID string) string {
+	return strings.ToLower(consts.CloudProviderName + "://" + resourceID)
+}
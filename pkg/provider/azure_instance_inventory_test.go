@@ -0,0 +1,271 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-03-01/compute"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmclient/mockvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssclient/mockvmssclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssvmclient/mockvmssvmclient"
+)
+
+const (
+	testVMSSVMID   = "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/vmss/virtualMachines/0"
+	testFlexVMSSID = "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/flex"
+	testFlexVMID   = "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/flex_0"
+	testASVMID     = "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm0"
+)
+
+func TestListInstanceInventory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+
+	mockVMSSClient := az.VirtualMachineScaleSetsClient.(*mockvmssclient.MockInterface)
+	mockVMSSClient.EXPECT().List(gomock.Any(), "rg").Return([]compute.VirtualMachineScaleSet{
+		{Name: pointer.String("vmss"), ID: pointer.String("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/vmss")},
+		{
+			Name: pointer.String("flex"),
+			ID:   pointer.String(testFlexVMSSID),
+			VirtualMachineScaleSetProperties: &compute.VirtualMachineScaleSetProperties{
+				OrchestrationMode: compute.Flexible,
+			},
+		},
+	}, nil)
+	mockVMSSVMClient := az.VirtualMachineScaleSetVMsClient.(*mockvmssvmclient.MockInterface)
+	mockVMSSVMClient.EXPECT().List(gomock.Any(), "rg", "vmss", string(compute.InstanceViewTypesInstanceView)).Return([]compute.VirtualMachineScaleSetVM{
+		{
+			ID:       pointer.String(testVMSSVMID),
+			Location: pointer.String("westus"),
+			Zones:    &[]string{"2"},
+			Sku:      &compute.Sku{Name: pointer.String("Standard_D2s_v3")},
+			VirtualMachineScaleSetVMProperties: &compute.VirtualMachineScaleSetVMProperties{
+				ProvisioningState: pointer.String("Succeeded"),
+				InstanceView: &compute.VirtualMachineScaleSetVMInstanceView{
+					Statuses: &[]compute.InstanceViewStatus{{Code: pointer.String("PowerState/running")}},
+				},
+			},
+		},
+	}, nil)
+	mockVMClient := az.VirtualMachinesClient.(*mockvmclient.MockInterface)
+	mockVMClient.EXPECT().List(gomock.Any(), "rg").Return([]compute.VirtualMachine{
+		{
+			ID:       pointer.String(testFlexVMID),
+			Location: pointer.String("westus"),
+			VirtualMachineProperties: &compute.VirtualMachineProperties{
+				HardwareProfile:        &compute.HardwareProfile{VMSize: compute.StandardD4sV3},
+				VirtualMachineScaleSet: &compute.SubResource{ID: pointer.String(testFlexVMSSID)},
+				ProvisioningState:      pointer.String("Succeeded"),
+			},
+		},
+		{
+			ID:       pointer.String(testASVMID),
+			Location: pointer.String("westus"),
+			VirtualMachineProperties: &compute.VirtualMachineProperties{
+				HardwareProfile:   &compute.HardwareProfile{VMSize: compute.StandardA0},
+				ProvisioningState: pointer.String("Succeeded"),
+			},
+		},
+	}, nil)
+	mockVMClient.EXPECT().ListVmssFlexVMsWithOnlyInstanceView(gomock.Any(), testFlexVMSSID).Return([]compute.VirtualMachine{
+		{
+			ID: pointer.String(testFlexVMID),
+			VirtualMachineProperties: &compute.VirtualMachineProperties{
+				InstanceView: &compute.VirtualMachineInstanceView{
+					Statuses: &[]compute.InstanceViewStatus{{Code: pointer.String("PowerState/deallocated")}},
+				},
+			},
+		},
+	}, nil)
+
+	entries, err := az.listInstanceInventory(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]*instanceInventoryEntry{
+		getInstanceInventoryKey(testVMSSVMID): {
+			instanceType:      "Standard_D2s_v3",
+			zone:              &cloudprovider.Zone{FailureDomain: "westus-2", Region: "westus"},
+			powerState:        "running",
+			provisioningState: "Succeeded",
+		},
+		getInstanceInventoryKey(testFlexVMID): {
+			instanceType:      string(compute.StandardD4sV3),
+			powerState:        vmPowerStateDeallocated,
+			provisioningState: "Succeeded",
+		},
+		getInstanceInventoryKey(testASVMID): {
+			instanceType:      string(compute.StandardA0),
+			provisioningState: "Succeeded",
+		},
+	}, entries)
+}
+
+func TestInstanceInventoryGet(t *testing.T) {
+	providerID := "azure://" + testASVMID
+	var listCount int
+	var listErr error
+	inv := newInstanceInventory(0, func(ctx context.Context) (map[string]*instanceInventoryEntry, error) {
+		listCount++
+		if listErr != nil {
+			return nil, listErr
+		}
+		return map[string]*instanceInventoryEntry{getInstanceInventoryKey(testASVMID): {instanceType: "Standard_A0"}}, nil
+	})
+	now := time.Now()
+	inv.now = func() time.Time { return now }
+
+	// The inventory is built on the first lookup and answers the following lookups.
+	entry, found := inv.get(context.TODO(), providerID)
+	assert.True(t, found)
+	assert.Equal(t, "Standard_A0", entry.instanceType)
+	_, found = inv.get(context.TODO(), providerID)
+	assert.True(t, found)
+	assert.Equal(t, 1, listCount)
+
+	// The missing provider ID is not refreshed again in the min refresh interval.
+	_, found = inv.get(context.TODO(), "azure:///missing")
+	assert.False(t, found)
+	assert.Equal(t, 1, listCount)
+	now = now.Add(instanceInventoryMinRefreshInterval)
+	_, found = inv.get(context.TODO(), "azure:///missing")
+	assert.False(t, found)
+	assert.Equal(t, 2, listCount)
+
+	// The provider ID still missing after the refresh is not refreshed again until the inventory expires.
+	now = now.Add(instanceInventoryMinRefreshInterval)
+	_, found = inv.get(context.TODO(), "azure:///missing")
+	assert.False(t, found)
+	assert.Equal(t, 2, listCount)
+
+	// The invalidated provider ID is refreshed on the next lookup.
+	inv.invalidate(providerID)
+	now = now.Add(instanceInventoryMinRefreshInterval)
+	_, found = inv.get(context.TODO(), providerID)
+	assert.True(t, found)
+	assert.Equal(t, 3, listCount)
+
+	// The inventory is not used if it fails to be refreshed after it expires.
+	listErr = errors.New("throttled")
+	now = now.Add(defaultInstanceInventoryTTL)
+	_, found = inv.get(context.TODO(), providerID)
+	assert.False(t, found)
+	assert.Equal(t, 4, listCount)
+}
+
+func TestInstanceInventoryGetSingleFlight(t *testing.T) {
+	var listCount int32
+	listed := make(chan struct{})
+	inv := newInstanceInventory(0, func(ctx context.Context) (map[string]*instanceInventoryEntry, error) {
+		atomic.AddInt32(&listCount, 1)
+		<-listed
+		return map[string]*instanceInventoryEntry{getInstanceInventoryKey(testASVMID): {instanceType: "Standard_A0"}}, nil
+	})
+
+	// The concurrent lookups share a single refresh, and the other lookups are not blocked by it.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entry, found := inv.get(context.TODO(), "azure://"+testASVMID)
+			assert.True(t, found)
+			assert.Equal(t, "Standard_A0", entry.instanceType)
+		}()
+	}
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&listCount) == 1 }, time.Second, time.Millisecond)
+	inv.invalidate("azure:///deleted")
+	close(listed)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&listCount))
+}
+
+func TestInstancesV2WithInstanceInventory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "vmss000000"},
+		Spec:       v1.NodeSpec{ProviderID: "azure://" + testVMSSVMID},
+	}
+	addresses := []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.4"}}
+	az.instanceInventory = newInstanceInventory(0, func(ctx context.Context) (map[string]*instanceInventoryEntry, error) {
+		return map[string]*instanceInventoryEntry{
+			getInstanceInventoryKey(testVMSSVMID): {
+				instanceType:      "Standard_D2s_v3",
+				zone:              &cloudprovider.Zone{FailureDomain: "westus-2", Region: "westus"},
+				powerState:        vmPowerStateDeallocated,
+				provisioningState: "Succeeded",
+				addresses:         addresses,
+			},
+		}, nil
+	})
+
+	// No Azure API is called since the instance is in the inventory.
+	meta, err := az.InstanceMetadata(context.TODO(), node)
+	assert.NoError(t, err)
+	assert.Equal(t, &cloudprovider.InstanceMetadata{
+		ProviderID:    node.Spec.ProviderID,
+		InstanceType:  "Standard_D2s_v3",
+		NodeAddresses: addresses,
+		Zone:          "westus-2",
+		Region:        "westus",
+	}, meta)
+
+	exists, err := az.InstanceExists(context.TODO(), node)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	shutdown, err := az.InstanceShutdown(context.TODO(), node)
+	assert.NoError(t, err)
+	assert.True(t, shutdown)
+}
+
+func TestInvalidateInstanceInventory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	az.instanceInventory = newInstanceInventory(0, nil)
+	providerID := "azure://" + testASVMID
+	az.instanceInventory.entries = map[string]*instanceInventoryEntry{getInstanceInventoryKey(testASVMID): {}}
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "vm0"},
+		Spec:       v1.NodeSpec{ProviderID: providerID},
+	}
+	az.invalidateInstanceInventory(node, node.DeepCopy())
+	assert.Len(t, az.instanceInventory.entries, 1)
+	assert.False(t, az.instanceInventory.dirty)
+
+	az.invalidateInstanceInventory(node, nil)
+	assert.Empty(t, az.instanceInventory.entries)
+	assert.True(t, az.instanceInventory.dirty)
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package provider
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -26,6 +27,7 @@ import (
 
 	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
 	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/nodemanager/metadata"
 )
 
 // NetworkMetadata contains metadata about an instance's network
@@ -74,6 +76,38 @@ type ComputeMetadata struct {
 	VMScaleSetName         string `json:"vmScaleSetName,omitempty"`
 	SubscriptionID         string `json:"subscriptionId,omitempty"`
 	ResourceID             string `json:"resourceId,omitempty"`
+	Priority               string `json:"priority,omitempty"`
+
+	TagsList       []ComputeTag            `json:"tagsList,omitempty"`
+	Host           *ComputeSubResource     `json:"host,omitempty"`
+	HostGroup      *ComputeSubResource     `json:"hostGroup,omitempty"`
+	StorageProfile *StorageProfileMetadata `json:"storageProfile,omitempty"`
+}
+
+// ComputeTag represents a tag of the instance.
+type ComputeTag struct {
+	Name  string `json:"name,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+// ComputeSubResource represents a resource referenced by the instance, e.g. the dedicated host.
+type ComputeSubResource struct {
+	ID string `json:"id,omitempty"`
+}
+
+// StorageProfileMetadata represents the storage profile of the instance.
+type StorageProfileMetadata struct {
+	OSDisk *OSDiskMetadata `json:"osDisk,omitempty"`
+}
+
+// OSDiskMetadata represents the OS disk of the instance.
+type OSDiskMetadata struct {
+	DiffDiskSettings DiffDiskSettingsMetadata `json:"diffDiskSettings,omitempty"`
+}
+
+// DiffDiskSettingsMetadata represents the ephemeral disk settings of the OS disk.
+type DiffDiskSettingsMetadata struct {
+	Option string `json:"option,omitempty"`
 }
 
 // InstanceMetadata represents instance information.
@@ -258,3 +292,75 @@ func (ims *InstanceMetadataService) GetMetadata(crt azcache.AzureCacheReadType)
 
 	return nil, fmt.Errorf("failure of getting instance metadata")
 }
+
+// GetScheduledEvents gets the scheduled events of the VMs in the same availability set, VMSS placement group
+// or the standalone VM from IMDS. The events are not cached since they should be handled in time.
+func (ims *InstanceMetadataService) GetScheduledEvents() (*metadata.ScheduledEvents, error) {
+	req, err := http.NewRequest("GET", ims.imdsServer+consts.ImdsScheduledEventsURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Metadata", "True")
+	req.Header.Add("User-Agent", "golang/kubernetes-cloud-provider")
+
+	q := req.URL.Query()
+	q.Add("api-version", consts.ImdsScheduledEventsAPIVersion)
+	req.URL.RawQuery = q.Encode()
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failure of getting scheduled events with response %q", resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := metadata.ScheduledEvents{}
+	err = json.Unmarshal(data, &obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return &obj, nil
+}
+
+// AcknowledgeScheduledEvent approves the scheduled event, so that it starts before its NotBefore time.
+func (ims *InstanceMetadataService) AcknowledgeScheduledEvent(eventID string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"StartRequests": []map[string]string{{"EventId": eventID}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", ims.imdsServer+consts.ImdsScheduledEventsURI, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Metadata", "True")
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("User-Agent", "golang/kubernetes-cloud-provider")
+
+	q := req.URL.Query()
+	q.Add("api-version", consts.ImdsScheduledEventsAPIVersion)
+	req.URL.RawQuery = q.Encode()
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failure of acknowledging scheduled event %s with response %q", eventID, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-03-01/compute"
+
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func validateFailedInstanceRemediation(config *FailedInstanceRemediation) error {
+	if !strings.EqualFold(config.Action, consts.InstanceRemediationActionReimage) && !strings.EqualFold(config.Action, consts.InstanceRemediationActionRedeploy) {
+		return fmt.Errorf("failedInstanceRemediation.action %q is not supported, supported values are %s and %s", config.Action, consts.InstanceRemediationActionReimage, consts.InstanceRemediationActionRedeploy)
+	}
+	if config.DelayInSeconds < 0 {
+		return fmt.Errorf("failedInstanceRemediation.delayInSeconds %d should not be negative", config.DelayInSeconds)
+	}
+	return nil
+}
+
+func (config *FailedInstanceRemediation) getDelay() time.Duration {
+	if config.DelayInSeconds == 0 {
+		return consts.DefaultFailedInstanceRemediationDelayInSeconds * time.Second
+	}
+	return time.Duration(config.DelayInSeconds) * time.Second
+}
+
+// remediateFailedInstances reimages or redeploys the VMSS instances which have been in the Failed provisioning
+// state for longer than the configured delay.
+func (az *Cloud) remediateFailedInstances(ctx context.Context, now time.Time) {
+	az.nodeCachesLock.RLock()
+	failedInstances := make(map[string]time.Time)
+	for nodeName, instanceState := range az.instanceStates {
+		if instanceState.state == consts.InstanceStateFailed {
+			failedInstances[nodeName] = instanceState.since
+		}
+	}
+	az.nodeCachesLock.RUnlock()
+
+	if az.remediatedInstances == nil {
+		az.remediatedInstances = make(map[string]time.Time)
+	}
+	delay := az.FailedInstanceRemediation.getDelay()
+	for nodeName, failedSince := range failedInstances {
+		if now.Sub(failedSince) < delay {
+			continue
+		}
+		if remediatedAt, found := az.remediatedInstances[nodeName]; found && now.Sub(remediatedAt) < delay {
+			continue
+		}
+		if err := az.remediateFailedInstance(ctx, nodeName); err != nil {
+			klog.Errorf("remediateFailedInstances: failed to remediate node %s: %v", nodeName, err)
+			continue
+		}
+		az.remediatedInstances[nodeName] = now
+	}
+
+	// Forget the instances which have recovered or been deleted.
+	for nodeName := range az.remediatedInstances {
+		if _, found := failedInstances[nodeName]; !found {
+			delete(az.remediatedInstances, nodeName)
+		}
+	}
+}
+
+// remediateFailedInstance reimages or redeploys the VMSS instance of the node once its Failed provisioning state
+// is confirmed. The availability set and VMSS Flex VMs are not remediated.
+func (az *Cloud) remediateFailedInstance(ctx context.Context, nodeName string) error {
+	ss, ok := az.VMSet.(*ScaleSet)
+	if !ok {
+		klog.V(4).Infof("remediateFailedInstance: skipping node %s since the vmType is not vmss", nodeName)
+		return nil
+	}
+	vmManagementType, err := ss.getVMManagementTypeByNodeName(nodeName, azcache.CacheReadTypeUnsafe)
+	if err != nil {
+		return err
+	}
+	if vmManagementType != ManagedByVmssUniform {
+		klog.V(4).Infof("remediateFailedInstance: skipping node %s since it is not a VMSS instance", nodeName)
+		return nil
+	}
+
+	node, err := ss.getNodeIdentityByNodeName(nodeName, azcache.CacheReadTypeDefault)
+	if err != nil {
+		return err
+	}
+	vm, err := ss.getVmssVMByNodeIdentity(node, azcache.CacheReadTypeForceRefresh)
+	if err != nil {
+		return err
+	}
+	if vm.VirtualMachineScaleSetVMProperties == nil || !strings.EqualFold(pointer.StringDeref(vm.VirtualMachineScaleSetVMProperties.ProvisioningState, ""), consts.InstanceStateFailed) {
+		klog.V(2).Infof("remediateFailedInstance: skipping node %s since the instance is no longer failed", nodeName)
+		return nil
+	}
+
+	instanceIDs := compute.VirtualMachineScaleSetVMInstanceRequiredIDs{InstanceIds: &[]string{vm.InstanceID}}
+	klog.Infof("remediateFailedInstance: %s the instance %s of VMSS %s for node %s", az.FailedInstanceRemediation.Action, vm.InstanceID, node.vmssName, nodeName)
+	if strings.EqualFold(az.FailedInstanceRemediation.Action, consts.InstanceRemediationActionReimage) {
+		_, rerr := az.VirtualMachineScaleSetsClient.ReimageInstancesAsync(ctx, node.resourceGroup, node.vmssName, instanceIDs)
+		if rerr != nil {
+			return rerr.Error()
+		}
+	} else {
+		_, rerr := az.VirtualMachineScaleSetsClient.RedeployInstancesAsync(ctx, node.resourceGroup, node.vmssName, instanceIDs)
+		if rerr != nil {
+			return rerr.Error()
+		}
+	}
+	return ss.DeleteCacheForNode(nodeName)
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-03-01/compute"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmclient/mockvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssclient/mockvmssclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssvmclient/mockvmssvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestValidateFailedInstanceRemediation(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		config      FailedInstanceRemediation
+		expectedErr bool
+	}{
+		{
+			desc:   "reimage should be valid",
+			config: FailedInstanceRemediation{Action: consts.InstanceRemediationActionReimage},
+		},
+		{
+			desc:   "redeploy should be valid",
+			config: FailedInstanceRemediation{Action: "Redeploy", DelayInSeconds: 300},
+		},
+		{
+			desc:        "unknown actions should be refused",
+			config:      FailedInstanceRemediation{Action: "delete"},
+			expectedErr: true,
+		},
+		{
+			desc:        "negative delays should be refused",
+			config:      FailedInstanceRemediation{Action: consts.InstanceRemediationActionReimage, DelayInSeconds: -1},
+			expectedErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := validateFailedInstanceRemediation(&tc.config)
+			assert.Equal(t, tc.expectedErr, err != nil)
+		})
+	}
+}
+
+func TestRemediateFailedInstances(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ss, err := NewTestScaleSet(ctrl)
+	assert.NoError(t, err)
+	az := ss.cloud
+	az.VMSet = ss
+	az.FailedInstanceRemediation = &FailedInstanceRemediation{Action: consts.InstanceRemediationActionReimage}
+
+	// Only the first node has been failed for longer than the delay.
+	now := time.Now()
+	az.instanceStates = map[string]instanceState{
+		"vmss-vm-000000": {state: consts.InstanceStateFailed, since: now.Add(-time.Hour)},
+		"vmss-vm-000001": {state: consts.InstanceStateFailed, since: now.Add(-time.Minute)},
+		"vmss-vm-000002": {state: consts.InstanceStateDeallocated, since: now.Add(-time.Hour)},
+	}
+
+	expectedVMSS := buildTestVMSS(testVMSSName, "vmss-vm-")
+	mockVMSSClient := az.VirtualMachineScaleSetsClient.(*mockvmssclient.MockInterface)
+	mockVMSSClient.EXPECT().List(gomock.Any(), ss.ResourceGroup).Return([]compute.VirtualMachineScaleSet{expectedVMSS}, nil).AnyTimes()
+	expectedVMSSVMs, _, _ := buildTestVirtualMachineEnv(az, testVMSSName, "", 0, []string{"vmss-vm-000000", "vmss-vm-000001", "vmss-vm-000002"}, "Failed", false)
+	mockVMSSVMClient := az.VirtualMachineScaleSetVMsClient.(*mockvmssvmclient.MockInterface)
+	mockVMSSVMClient.EXPECT().List(gomock.Any(), ss.ResourceGroup, testVMSSName, gomock.Any()).Return(expectedVMSSVMs, nil).AnyTimes()
+	mockVMClient := az.VirtualMachinesClient.(*mockvmclient.MockInterface)
+	mockVMClient.EXPECT().List(gomock.Any(), gomock.Any()).Return([]compute.VirtualMachine{}, nil).AnyTimes()
+
+	// The failed instance is reimaged once in the delay.
+	mockVMSSClient.EXPECT().ReimageInstancesAsync(gomock.Any(), ss.ResourceGroup, testVMSSName, compute.VirtualMachineScaleSetVMInstanceRequiredIDs{
+		InstanceIds: &[]string{"0"},
+	}).Return(nil, nil).Times(1)
+	az.remediateFailedInstances(context.TODO(), now)
+	assert.Contains(t, az.remediatedInstances, "vmss-vm-000000")
+	az.remediateFailedInstances(context.TODO(), now.Add(time.Minute))
+
+	// The instance is forgotten once it recovers.
+	az.instanceStates["vmss-vm-000000"] = instanceState{state: consts.InstanceStateRunning, since: now.Add(time.Minute)}
+	az.remediateFailedInstances(context.TODO(), now.Add(2*time.Minute))
+	assert.Empty(t, az.remediatedInstances)
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	nodeutil "k8s.io/component-helpers/node/util"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// instanceState is the state of the VM of a node, e.g. Running or Failed, and since when the VM is in it.
+type instanceState struct {
+	state string
+	since time.Time
+}
+
+// IsInstanceStateEnabled returns true if the instance states of the nodes are computed, which is also needed by
+// the failed instance remediation.
+func (az *Cloud) IsInstanceStateEnabled() bool {
+	return az.EnableInstanceState || az.FailedInstanceRemediation != nil
+}
+
+// RunInstanceStateController periodically computes the instance states of the nodes and remediates the failed
+// VMSS instances until the context is done.
+func (az *Cloud) RunInstanceStateController(ctx context.Context) {
+	klog.Infof("Starting instance state controller")
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		az.reconcileInstanceStates(ctx, time.Now())
+		if az.FailedInstanceRemediation != nil {
+			az.remediateFailedInstances(ctx, time.Now())
+		}
+	}, consts.InstanceStateSyncPeriod)
+}
+
+// reconcileInstanceStates computes the state of the VM of each node from its power state and provisioning state.
+// The nodes whose VMs are not running are excluded from the load balancer backend pools until they recover,
+// and the states are reported as the node condition AzureInstanceDegraded.
+func (az *Cloud) reconcileInstanceStates(ctx context.Context, now time.Time) {
+	if az.nodeLister == nil {
+		klog.V(4).Infof("reconcileInstanceStates: node lister is not ready")
+		return
+	}
+	nodes, err := az.nodeLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("reconcileInstanceStates: failed to list nodes: %v", err)
+		return
+	}
+
+	nodeNames := sets.NewString()
+	for _, node := range nodes {
+		nodeNames.Insert(node.Name)
+		state, err := az.getNodeInstanceState(ctx, node)
+		if err != nil {
+			klog.Errorf("reconcileInstanceStates: failed to get the instance state of node %s: %v", node.Name, err)
+			continue
+		}
+		since := az.setInstanceState(node, state, now)
+		if err := az.setInstanceDegradedCondition(node, state, since); err != nil {
+			klog.Errorf("reconcileInstanceStates: %v", err)
+		}
+	}
+
+	// Forget the nodes deleted while their states are computed.
+	az.nodeCachesLock.Lock()
+	defer az.nodeCachesLock.Unlock()
+	for nodeName := range az.instanceStates {
+		if !nodeNames.Has(nodeName) {
+			delete(az.instanceStates, nodeName)
+		}
+	}
+}
+
+// getNodeInstanceState returns the instance state of the node from the instance inventory, or from the VMSet if
+// the node is missing in the inventory or its power state is only in the instance view of the VM.
+func (az *Cloud) getNodeInstanceState(ctx context.Context, node *v1.Node) (string, error) {
+	if entry, found := az.getInstanceInventoryEntry(ctx, node); found && entry.powerState != "" {
+		return getInstanceState(entry.powerState, entry.provisioningState), nil
+	}
+	return az.GetInstanceState(ctx, types.NodeName(node.Name))
+}
+
+// setInstanceState records the instance state of the node, and updates the excludeLoadBalancerNodes cache if it
+// is changed. It returns since when the VM is in the state, which is the transition time of the node condition
+// if the state was reported before the restart.
+func (az *Cloud) setInstanceState(node *v1.Node, state string, now time.Time) time.Time {
+	az.nodeCachesLock.Lock()
+	defer az.nodeCachesLock.Unlock()
+
+	current, found := az.instanceStates[node.Name]
+	if found && current.state == state {
+		return current.since
+	}
+	since := now
+	if _, condition := nodeutil.GetNodeCondition(&node.Status, consts.NodeConditionInstanceDegraded); !found && condition != nil && condition.Reason == state {
+		since = condition.LastTransitionTime.Time
+	}
+	if az.instanceStates == nil {
+		az.instanceStates = make(map[string]instanceState)
+	}
+	klog.V(2).Infof("setInstanceState: the instance of node %s is %s", node.Name, state)
+	az.instanceStates[node.Name] = instanceState{state: state, since: since}
+	az.updateExcludeLoadBalancerNodes(node)
+	return since
+}
+
+// isInstanceDegraded returns true if the VM of the node is not running. It should be called with nodeCachesLock
+// held.
+func (az *Cloud) isInstanceDegraded(nodeName string) bool {
+	current, found := az.instanceStates[nodeName]
+	return found && current.state != consts.InstanceStateRunning
+}
+
+// setInstanceDegradedCondition sets the node condition AzureInstanceDegraded if the state is changed. The
+// condition is True with the state as its reason if the VM is not running.
+func (az *Cloud) setInstanceDegradedCondition(node *v1.Node, state string, since time.Time) error {
+	status := v1.ConditionTrue
+	message := fmt.Sprintf("The instance is %s", state)
+	if state == consts.InstanceStateRunning {
+		status = v1.ConditionFalse
+		message = "The instance is running"
+	}
+	_, condition := nodeutil.GetNodeCondition(&node.Status, consts.NodeConditionInstanceDegraded)
+	if condition != nil && condition.Status == status && condition.Reason == state {
+		return nil
+	}
+
+	klog.V(2).Infof("setInstanceDegradedCondition: setting condition %s=%s of node %s: %s", consts.NodeConditionInstanceDegraded, status, node.Name, message)
+	if err := nodeutil.SetNodeCondition(az.KubeClient, types.NodeName(node.Name), v1.NodeCondition{
+		Type:               consts.NodeConditionInstanceDegraded,
+		Status:             status,
+		Reason:             state,
+		Message:            message,
+		LastHeartbeatTime:  metav1.Now(),
+		LastTransitionTime: metav1.NewTime(since),
+	}); err != nil {
+		return fmt.Errorf("failed to set the instance state condition of node %s: %w", node.Name, err)
+	}
+	return nil
+}
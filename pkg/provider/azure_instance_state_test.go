@@ -0,0 +1,116 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	nodeutil "k8s.io/component-helpers/node/util"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestReconcileInstanceStates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	ctx := context.TODO()
+
+	vm1ID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm1"
+	now := time.Now()
+	failedSince := now.Add(-time.Hour)
+	readyCondition := v1.NodeCondition{Type: v1.NodeReady, Status: v1.ConditionTrue}
+	nodes := []*v1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "vm0"},
+			Spec:       v1.NodeSpec{ProviderID: "azure://" + testASVMID},
+			Status:     v1.NodeStatus{Conditions: []v1.NodeCondition{readyCondition}},
+		},
+		{
+			// The failed state was reported before the restart.
+			ObjectMeta: metav1.ObjectMeta{Name: "vm1"},
+			Spec:       v1.NodeSpec{ProviderID: "azure://" + vm1ID},
+			Status: v1.NodeStatus{Conditions: []v1.NodeCondition{readyCondition, {
+				Type:               consts.NodeConditionInstanceDegraded,
+				Status:             v1.ConditionTrue,
+				Reason:             consts.InstanceStateFailed,
+				LastTransitionTime: metav1.NewTime(failedSince),
+			}}},
+		},
+	}
+	client := fake.NewSimpleClientset(nodes[0], nodes[1])
+	az.KubeClient = client
+	az.nodeNames = sets.NewString()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, node := range nodes {
+		assert.NoError(t, indexer.Add(node))
+		az.updateNodeCaches(nil, node)
+	}
+	az.nodeLister = corelisters.NewNodeLister(indexer)
+	setInventory := func(vm0PowerState string) {
+		az.instanceInventory = newInstanceInventory(0, func(ctx context.Context) (map[string]*instanceInventoryEntry, error) {
+			return map[string]*instanceInventoryEntry{
+				getInstanceInventoryKey(testASVMID): {powerState: vm0PowerState, provisioningState: "Succeeded"},
+				getInstanceInventoryKey(vm1ID):      {powerState: "running", provisioningState: "Failed"},
+			}, nil
+		})
+	}
+	getCondition := func(nodeName string) *v1.NodeCondition {
+		node, err := client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		assert.NoError(t, err)
+		_, condition := nodeutil.GetNodeCondition(&node.Status, consts.NodeConditionInstanceDegraded)
+		return condition
+	}
+
+	// The deallocated and failed nodes are excluded from the load balancers, and the failed state is kept since
+	// it was reported.
+	setInventory("deallocated")
+	az.reconcileInstanceStates(ctx, now)
+	assert.True(t, az.excludeLoadBalancerNodes.HasAll("vm0", "vm1"))
+	assert.Equal(t, consts.InstanceStateDeallocated, az.instanceStates["vm0"].state)
+	assert.True(t, az.instanceStates["vm1"].since.Equal(failedSince))
+	condition := getCondition("vm0")
+	assert.NotNil(t, condition)
+	assert.Equal(t, v1.ConditionTrue, condition.Status)
+	assert.Equal(t, consts.InstanceStateDeallocated, condition.Reason)
+
+	// The node is added back to the load balancers once its instance is running.
+	setInventory("running")
+	az.reconcileInstanceStates(ctx, now.Add(time.Minute))
+	assert.False(t, az.excludeLoadBalancerNodes.Has("vm0"))
+	assert.True(t, az.excludeLoadBalancerNodes.Has("vm1"))
+	condition = getCondition("vm0")
+	assert.NotNil(t, condition)
+	assert.Equal(t, v1.ConditionFalse, condition.Status)
+	assert.Equal(t, consts.InstanceStateRunning, condition.Reason)
+
+	// The states of the deleted nodes are forgotten.
+	assert.NoError(t, indexer.Delete(nodes[1]))
+	az.reconcileInstanceStates(ctx, now.Add(2*time.Minute))
+	assert.NotContains(t, az.instanceStates, "vm1")
+}
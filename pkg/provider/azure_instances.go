@@ -27,6 +27,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-03-01/compute"
 
@@ -39,6 +40,11 @@ const (
 	vmPowerStateStopped      = "stopped"
 	vmPowerStateDeallocated  = "deallocated"
 	vmPowerStateDeallocating = "deallocating"
+	vmPowerStateStopping     = "stopping"
+	// vmPowerStateHibernated is reported for the hibernated VMs, whose power state is deallocated.
+	vmPowerStateHibernated = "hibernated"
+
+	vmHibernationStateHibernated = "HibernationState/Hibernated"
 
 	// nodeNameEnvironmentName is the environment variable name for getting node name.
 	// It is only used for out-of-tree cloud provider.
@@ -227,6 +233,9 @@ func (az *Cloud) InstanceExists(ctx context.Context, node *v1.Node) (bool, error
 	if node == nil {
 		return false, nil
 	}
+	if _, found := az.getInstanceInventoryEntry(ctx, node); found {
+		return true, nil
+	}
 	providerID := node.Spec.ProviderID
 	if providerID == "" {
 		var err error
@@ -286,9 +295,77 @@ func (az *Cloud) InstanceShutdownByProviderID(ctx context.Context, providerID st
 	}
 	klog.V(3).Infof("InstanceShutdownByProviderID gets provisioning state %q for node %q", provisioningState, nodeName)
 
+	return isInstanceShutdown(powerStatus, provisioningState), nil
+}
+
+// isInstanceShutdown returns true if the instance is provisioned and stopped, deallocated or hibernated.
+func isInstanceShutdown(powerStatus, provisioningState string) bool {
 	status := strings.ToLower(powerStatus)
 	provisioningSucceeded := strings.EqualFold(strings.ToLower(provisioningState), strings.ToLower(string(compute.ProvisioningStateSucceeded)))
-	return provisioningSucceeded && (status == vmPowerStateStopped || status == vmPowerStateDeallocated || status == vmPowerStateDeallocating), nil
+	return provisioningSucceeded && (status == vmPowerStateStopped || status == vmPowerStateDeallocated || status == vmPowerStateDeallocating || status == vmPowerStateHibernated)
+}
+
+// getPowerStateFromStatuses returns the power state in the instance view statuses of the VM. The power state
+// of a hibernated VM is deallocated, so it is reported as hibernated by its hibernation state.
+func getPowerStateFromStatuses(statuses []compute.InstanceViewStatus) string {
+	powerState := vmPowerStateStopped
+	for _, status := range statuses {
+		code := pointer.StringDeref(status.Code, "")
+		if strings.EqualFold(code, vmHibernationStateHibernated) {
+			return vmPowerStateHibernated
+		}
+		if strings.HasPrefix(code, vmPowerStatePrefix) {
+			powerState = strings.TrimPrefix(code, vmPowerStatePrefix)
+		}
+	}
+	return powerState
+}
+
+// getInstanceState returns the state of the VM by its power state and provisioning state. The Failed
+// provisioning state takes precedence over the power state.
+func getInstanceState(powerState, provisioningState string) string {
+	if strings.EqualFold(provisioningState, string(compute.ProvisioningStateFailed)) {
+		return consts.InstanceStateFailed
+	}
+	switch strings.ToLower(powerState) {
+	case vmPowerStateHibernated:
+		return consts.InstanceStateHibernated
+	case vmPowerStateDeallocated, vmPowerStateDeallocating:
+		return consts.InstanceStateDeallocated
+	case vmPowerStateStopped, vmPowerStateStopping:
+		return consts.InstanceStateStopped
+	default:
+		return consts.InstanceStateRunning
+	}
+}
+
+// GetInstanceState returns the state of the VM of the node, which is one of Running, Stopped, Deallocated,
+// Hibernated and Failed. The unmanaged nodes are regarded as running.
+func (az *Cloud) GetInstanceState(ctx context.Context, name types.NodeName) (string, error) {
+	nodeName := mapNodeNameToVMName(name)
+	unmanaged, err := az.IsNodeUnmanaged(nodeName)
+	if err != nil {
+		return "", err
+	}
+	if unmanaged {
+		klog.V(4).Infof("GetInstanceState: assuming unmanaged node %q is running", nodeName)
+		return consts.InstanceStateRunning, nil
+	}
+
+	if az.VMSet == nil {
+		// vmSet == nil indicates credentials are not provided.
+		return "", fmt.Errorf("no credentials provided for Azure cloud provider")
+	}
+
+	powerState, err := az.VMSet.GetPowerStatusByNodeName(nodeName)
+	if err != nil {
+		return "", err
+	}
+	provisioningState, err := az.VMSet.GetProvisioningStateByNodeName(nodeName)
+	if err != nil {
+		return "", err
+	}
+	return getInstanceState(powerState, provisioningState), nil
 }
 
 // InstanceShutdown returns true if the instance is shutdown according to the cloud provider.
@@ -297,6 +374,10 @@ func (az *Cloud) InstanceShutdown(ctx context.Context, node *v1.Node) (bool, err
 	if node == nil {
 		return false, nil
 	}
+	if entry, found := az.getInstanceInventoryEntry(ctx, node); found && entry.powerState != "" {
+		klog.V(3).Infof("InstanceShutdown gets power status %q and provisioning state %q for node %q from the instance inventory", entry.powerState, entry.provisioningState, node.Name)
+		return isInstanceShutdown(entry.powerState, entry.provisioningState), nil
+	}
 	providerID := node.Spec.ProviderID
 	if providerID == "" {
 		var err error
@@ -320,7 +401,7 @@ func (az *Cloud) isCurrentInstance(name types.NodeName, metadataVMName string) (
 	nodeName := mapNodeNameToVMName(name)
 
 	// VMSS vmName is not same with hostname, use hostname instead.
-	if az.VMType == consts.VMTypeVMSS {
+	if az.VMType == consts.VMTypeVMSS || az.VMType == consts.VMTypeMixed {
 		metadataVMName, err = os.Hostname()
 		if err != nil {
 			return false, err
@@ -496,6 +577,10 @@ func (az *Cloud) InstanceMetadata(ctx context.Context, node *v1.Node) (*cloudpro
 		return &cloudprovider.InstanceMetadata{}, nil
 	}
 
+	if entry, found := az.getInstanceInventoryEntry(ctx, node); found {
+		return az.getInstanceMetadataFromInventory(ctx, node, &entry)
+	}
+
 	meta := cloudprovider.InstanceMetadata{}
 
 	if node.Spec.ProviderID != "" {
@@ -534,6 +619,50 @@ func (az *Cloud) InstanceMetadata(ctx context.Context, node *v1.Node) (*cloudpro
 	return &meta, nil
 }
 
+// getInstanceMetadataFromInventory returns the instance's metadata from its inventory entry. The node addresses
+// are resolved once and kept in the entry, and the fields unknown in the entry are looked up by the node name.
+func (az *Cloud) getInstanceMetadataFromInventory(ctx context.Context, node *v1.Node, entry *instanceInventoryEntry) (*cloudprovider.InstanceMetadata, error) {
+	meta := cloudprovider.InstanceMetadata{
+		ProviderID:    node.Spec.ProviderID,
+		InstanceType:  entry.instanceType,
+		NodeAddresses: entry.addresses,
+	}
+
+	if meta.InstanceType == "" {
+		instanceType, err := az.InstanceType(ctx, types.NodeName(node.Name))
+		if err != nil {
+			klog.Errorf("InstanceMetadata: failed to get the instance type of %s: %v", node.Name, err)
+			return &cloudprovider.InstanceMetadata{}, err
+		}
+		meta.InstanceType = instanceType
+	}
+
+	if meta.NodeAddresses == nil {
+		nodeAddresses, err := az.NodeAddresses(ctx, types.NodeName(node.Name))
+		if err != nil {
+			klog.Errorf("InstanceMetadata: failed to get the node address of %s: %v", node.Name, err)
+			return &cloudprovider.InstanceMetadata{}, err
+		}
+		meta.NodeAddresses = nodeAddresses
+		az.instanceInventory.setAddresses(node.Spec.ProviderID, nodeAddresses)
+	}
+
+	if entry.zone != nil {
+		meta.Zone = entry.zone.FailureDomain
+		meta.Region = entry.zone.Region
+	} else {
+		zone, err := az.GetZoneByNodeName(ctx, types.NodeName(node.Name))
+		if err != nil {
+			klog.Errorf("InstanceMetadata: failed to get the node zone of %s: %v", node.Name, err)
+			return &cloudprovider.InstanceMetadata{}, err
+		}
+		meta.Zone = zone.FailureDomain
+		meta.Region = zone.Region
+	}
+
+	return &meta, nil
+}
+
 // mapNodeNameToVMName maps a k8s NodeName to an Azure VM Name
 // This is a simple string cast.
 func mapNodeNameToVMName(nodeName types.NodeName) string {
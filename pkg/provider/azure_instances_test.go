@@ -973,3 +973,63 @@ func TestCloud_InstanceExists(t *testing.T) {
 		assert.False(t, exist)
 	})
 }
+
+func TestGetInstanceState(t *testing.T) {
+	testcases := []struct {
+		desc              string
+		statuses          []compute.InstanceViewStatus
+		provisioningState string
+		expected          string
+	}{
+		{
+			desc:              "running VM",
+			statuses:          []compute.InstanceViewStatus{{Code: pointer.String("ProvisioningState/succeeded")}, {Code: pointer.String("PowerState/running")}},
+			provisioningState: "Succeeded",
+			expected:          consts.InstanceStateRunning,
+		},
+		{
+			desc:              "stopped VM",
+			statuses:          []compute.InstanceViewStatus{{Code: pointer.String("PowerState/stopping")}},
+			provisioningState: "Succeeded",
+			expected:          consts.InstanceStateStopped,
+		},
+		{
+			desc:              "deallocated VM",
+			statuses:          []compute.InstanceViewStatus{{Code: pointer.String("PowerState/deallocated")}},
+			provisioningState: "Succeeded",
+			expected:          consts.InstanceStateDeallocated,
+		},
+		{
+			desc:              "hibernated VM",
+			statuses:          []compute.InstanceViewStatus{{Code: pointer.String("HibernationState/Hibernated")}, {Code: pointer.String("PowerState/deallocated")}},
+			provisioningState: "Succeeded",
+			expected:          consts.InstanceStateHibernated,
+		},
+		{
+			desc:              "failed VM regardless of its power state",
+			statuses:          []compute.InstanceViewStatus{{Code: pointer.String("PowerState/running")}},
+			provisioningState: "Failed",
+			expected:          consts.InstanceStateFailed,
+		},
+		{
+			desc:     "VM without power state is regarded as stopped",
+			expected: consts.InstanceStateStopped,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cloud := GetTestCloud(ctrl)
+			mockVMSet := NewMockVMSet(ctrl)
+			mockVMSet.EXPECT().GetPowerStatusByNodeName("vm1").Return(getPowerStateFromStatuses(tc.statuses), nil)
+			mockVMSet.EXPECT().GetProvisioningStateByNodeName("vm1").Return(tc.provisioningState, nil)
+			cloud.VMSet = mockVMSet
+
+			state, err := cloud.GetInstanceState(context.TODO(), "vm1")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, state)
+		})
+	}
+}
@@ -81,6 +81,15 @@ func setServiceLoadBalancerIP(service *v1.Service, ip string) {
 // GetLoadBalancer returns whether the specified load balancer and its components exist, and
 // if so, what its status is.
 func (az *Cloud) GetLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) (status *v1.LoadBalancerStatus, exists bool, err error) {
+	if consts.IsK8sServiceUsingApplicationGateway(service) {
+		gw, existsGateway, err := az.getServiceApplicationGateway(clusterName, service)
+		if err != nil || !existsGateway {
+			return nil, false, err
+		}
+		status, err := az.getApplicationGatewayStatus(gw)
+		return status, true, err
+	}
+
 	// Since public IP is not a part of the load balancer on Azure,
 	// there is a chance that we could orphan public IP resources while we delete the load balancer (kubernetes/kubernetes#80571).
 	// We need to make sure the existence of the load balancer depends on the load balancer resource and public IP resource on Azure.
@@ -133,11 +142,50 @@ func getPublicIPDomainNameLabel(service *v1.Service) (string, bool) {
 }
 
 // reconcileService reconcile the LoadBalancer service. It returns LoadBalancerStatus on success.
+// The result of each Azure resource is reported in the service conditions.
 func (az *Cloud) reconcileService(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
 	serviceName := getServiceName(service)
-	lb, err := az.reconcileLoadBalancer(clusterName, service, nodes, true /* wantLb */)
+	sc := newServiceConditions(service)
+	defer az.updateServiceConditions(sc)
+
+	// The resources of the other mode are removed once the service is switched between the application gateway
+	// and the load balancer. The mode in use before is told from the conditions of the service.
+	if consts.IsK8sServiceUsingApplicationGateway(service) {
+		if hasLoadBalancerServiceConditions(service) {
+			klog.V(2).Infof("reconcileService: removing the load balancer of service %s switched to application gateway", serviceName)
+			if err := az.cleanupServiceLoadBalancer(ctx, clusterName, service); err != nil {
+				klog.Errorf("cleanupServiceLoadBalancer(%s) failed: %v", serviceName, err)
+				az.setServiceConditionFailed(sc, consts.ServiceConditionLoadBalancerReady, err)
+				return nil, err
+			}
+			az.removeServiceConditions(sc, loadBalancerServiceConditionTypes...)
+		}
+		return az.reconcileServiceApplicationGateway(clusterName, service, nodes, sc)
+	}
+	if hasServiceCondition(service, consts.ServiceConditionApplicationGatewayReady) {
+		klog.V(2).Infof("reconcileService: removing the application gateway listeners of service %s switched to load balancer", serviceName)
+		if _, err := az.reconcileApplicationGateway(clusterName, service, nil, false /* wantGateway */); err != nil {
+			klog.Errorf("reconcileApplicationGateway(%s) failed: %v", serviceName, err)
+			az.setServiceConditionFailed(sc, consts.ServiceConditionApplicationGatewayReady, err)
+			return nil, err
+		}
+		az.removeServiceConditions(sc, consts.ServiceConditionApplicationGatewayReady)
+	}
+
+	if az.shouldMigrateLoadBalancerSku() {
+		// The migration progress is written to the annotations of the copy.
+		service = service.DeepCopy()
+		if err := az.migrateLoadBalancerSku(clusterName, service, nodes); err != nil {
+			klog.Errorf("migrateLoadBalancerSku(%s) failed: %v", serviceName, err)
+			az.setServiceConditionFailed(sc, consts.ServiceConditionLoadBalancerReady, err)
+			return nil, err
+		}
+	}
+
+	lb, err := az.reconcileLoadBalancer(ctx, clusterName, service, nodes, true /* wantLb */)
 	if err != nil {
 		klog.Errorf("reconcileLoadBalancer(%s) failed: %v", serviceName, err)
+		az.setServiceConditionFailed(sc, consts.ServiceConditionLoadBalancerReady, err)
 		return nil, err
 	}
 
@@ -146,6 +194,7 @@ func (az *Cloud) reconcileService(ctx context.Context, clusterName string, servi
 	if err != nil {
 		klog.Errorf("getServiceLoadBalancerStatus(%s) failed: %v", serviceName, err)
 		if !errors.Is(err, ErrorNotVmssInstance) {
+			az.setServiceConditionFailed(sc, consts.ServiceConditionLoadBalancerReady, err)
 			return nil, err
 		}
 	}
@@ -155,30 +204,98 @@ func (az *Cloud) reconcileService(ctx context.Context, clusterName string, servi
 		serviceIP = &lbStatus.Ingress[0].IP
 	}
 
+	if az.usesApplicationSecurityGroup(service) {
+		if err := az.reconcileApplicationSecurityGroup(clusterName, service, pointer.StringDeref(lb.Name, ""), nodes); err != nil {
+			klog.Errorf("reconcileApplicationSecurityGroup(%s) failed: %v", serviceName, err)
+			az.setServiceConditionFailed(sc, consts.ServiceConditionSecurityGroupReady, err)
+			return nil, err
+		}
+	}
+
 	klog.V(2).Infof("reconcileService: reconciling security group for service %q with IP %q, wantLb = true", serviceName, logSafe(serviceIP))
-	if _, err := az.reconcileSecurityGroup(clusterName, service, serviceIP, lb.Name, true /* wantLb */); err != nil {
+	sg, err := az.reconcileSecurityGroup(clusterName, service, serviceIP, lb.Name, true /* wantLb */)
+	if err != nil {
 		klog.Errorf("reconcileSecurityGroup(%s) failed: %#v", serviceName, err)
+		az.setServiceConditionFailed(sc, consts.ServiceConditionSecurityGroupReady, err)
 		return nil, err
 	}
+	az.setServiceConditionReady(sc, consts.ServiceConditionSecurityGroupReady, pointer.StringDeref(sg.ID, ""))
 
 	if fipConfig != nil {
 		if err := az.reconcilePrivateLinkService(clusterName, service, fipConfig, true /* wantPLS */); err != nil {
 			klog.Errorf("reconcilePrivateLinkService(%s) failed: %#v", serviceName, err)
+			az.setServiceConditionFailed(sc, consts.ServiceConditionPrivateLinkServiceReady, err)
 			return nil, err
 		}
+		if serviceRequiresPLS(service) {
+			var plsID string
+			if pls, err := az.getPrivateLinkService(fipConfig.ID, azcache.CacheReadTypeDefault); err == nil {
+				plsID = pointer.StringDeref(pls.ID, "")
+			}
+			az.setServiceConditionReady(sc, consts.ServiceConditionPrivateLinkServiceReady, plsID)
+		}
 	}
 
 	updateService := updateServiceLoadBalancerIP(service, pointer.StringDeref(serviceIP, ""))
 	flippedService := flipServiceInternalAnnotation(updateService)
-	if _, err := az.reconcileLoadBalancer(clusterName, flippedService, nil, false /* wantLb */); err != nil {
+	if _, err := az.reconcileLoadBalancer(ctx, clusterName, flippedService, nil, false /* wantLb */); err != nil {
 		klog.Errorf("reconcileLoadBalancer(%s) failed: %#v", serviceName, err)
+		az.setServiceConditionFailed(sc, consts.ServiceConditionLoadBalancerReady, err)
 		return nil, err
 	}
+	var fipConfigID string
+	if fipConfig != nil {
+		fipConfigID = pointer.StringDeref(fipConfig.ID, "")
+	}
+	az.setServiceConditionReady(sc, consts.ServiceConditionLoadBalancerReady, pointer.StringDeref(lb.ID, ""), fipConfigID)
 
 	// lb is not reused here because the ETAG may be changed in above operations, hence reconcilePublicIP() would get lb again from cache.
 	klog.V(2).Infof("reconcileService: reconciling pip")
-	if _, err := az.reconcilePublicIP(clusterName, updateService, pointer.StringDeref(lb.Name, ""), true /* wantLb */); err != nil {
+	pip, err := az.reconcilePublicIP(clusterName, updateService, pointer.StringDeref(lb.Name, ""), true /* wantLb */)
+	if err != nil {
 		klog.Errorf("reconcilePublicIP(%s) failed: %#v", serviceName, err)
+		az.setServiceConditionFailed(sc, consts.ServiceConditionPublicIPReady, err)
+		return nil, err
+	}
+	if pip != nil {
+		az.setServiceConditionReady(sc, consts.ServiceConditionPublicIPReady, pointer.StringDeref(pip.ID, ""))
+	}
+
+	// The service is deregistered from the global load balancer once the annotation is removed.
+	if _, ok := getServiceGlobalLoadBalancerName(service); ok || hasServiceCondition(service, consts.ServiceConditionGlobalLoadBalancerReady) {
+		klog.V(2).Infof("reconcileService: reconciling global load balancer, wantLb = %t", ok)
+		globalLB, err := az.reconcileGlobalLoadBalancer(clusterName, service, fipConfig, ok /* wantLb */)
+		if err != nil {
+			klog.Errorf("reconcileGlobalLoadBalancer(%s) failed: %#v", serviceName, err)
+			az.setServiceConditionFailed(sc, consts.ServiceConditionGlobalLoadBalancerReady, err)
+			return nil, err
+		}
+		if globalLB != nil {
+			az.setServiceConditionReady(sc, consts.ServiceConditionGlobalLoadBalancerReady, pointer.StringDeref(globalLB.ID, ""))
+		}
+		if !ok {
+			az.removeServiceConditions(sc, consts.ServiceConditionGlobalLoadBalancerReady)
+		}
+	}
+
+	// The records are also reconciled after the zone annotation is removed to delete the owned ones.
+	zoneID, hasZone := getServiceDNSZoneID(service)
+	if _, _, hasOwnedRecords := getServiceOwnedDNSRecord(service); hasZone || hasOwnedRecords {
+		klog.V(2).Infof("reconcileService: reconciling DNS records")
+		if err := az.reconcileDNSRecords(clusterName, service, lbStatus, true /* wantRecords */); err != nil {
+			klog.Errorf("reconcileDNSRecords(%s) failed: %#v", serviceName, err)
+			az.setServiceConditionFailed(sc, consts.ServiceConditionDNSRecordReady, err)
+			return nil, err
+		}
+		if hasZone {
+			az.setServiceConditionReady(sc, consts.ServiceConditionDNSRecordReady, zoneID)
+		} else {
+			az.removeServiceConditions(sc, consts.ServiceConditionDNSRecordReady)
+		}
+	}
+
+	if err := az.completeLoadBalancerSkuMigration(service, lb); err != nil {
+		klog.Errorf("completeLoadBalancerSkuMigration(%s) failed: %v", serviceName, err)
 		return nil, err
 	}
 
@@ -206,12 +323,20 @@ func (az *Cloud) EnsureLoadBalancer(ctx context.Context, clusterName string, ser
 		klog.V(5).InfoS("EnsureLoadBalancer Finish", "service", serviceName, "cluster", clusterName, "service_spec", service, "error", err)
 	}()
 
+	if az.startLoadBalancerPlan(service) {
+		defer az.finishLoadBalancerPlan(service)
+	}
+
 	lbStatus, err := az.reconcileService(ctx, clusterName, service, nodes)
 	if err != nil {
 		return nil, err
 	}
 
 	isOperationSucceeded = true
+	// The service status is kept as it is in plan mode since nothing has been changed in Azure.
+	if az.inLoadBalancerPlan(service) {
+		return &service.Status.LoadBalancer, nil
+	}
 	return lbStatus, nil
 }
 
@@ -266,6 +391,10 @@ func (az *Cloud) UpdateLoadBalancer(ctx context.Context, clusterName string, ser
 		return nil
 	}
 
+	if az.startLoadBalancerPlan(service) {
+		defer az.finishLoadBalancerPlan(service)
+	}
+
 	_, err = az.reconcileService(ctx, clusterName, service, nodes)
 	if err != nil {
 		return err
@@ -295,26 +424,62 @@ func (az *Cloud) EnsureLoadBalancerDeleted(ctx context.Context, clusterName stri
 		mc.ObserveOperationWithResult(isOperationSucceeded)
 		klog.V(5).InfoS("EnsureLoadBalancerDeleted Finish", "service", serviceName, "cluster", clusterName, "service_spec", service, "error", err)
 	}()
+	if az.startLoadBalancerPlan(service) {
+		defer az.finishLoadBalancerPlan(service)
+	}
+
+	// The resources of the other mode are also removed since the service may have been switched
+	// between the application gateway and the load balancer.
+	if consts.IsK8sServiceUsingApplicationGateway(service) || hasServiceCondition(service, consts.ServiceConditionApplicationGatewayReady) {
+		if _, err = az.reconcileApplicationGateway(clusterName, service, nil, false /* wantGateway */); err != nil {
+			return err
+		}
+	}
+	if !consts.IsK8sServiceUsingApplicationGateway(service) || hasLoadBalancerServiceConditions(service) {
+		if err = az.cleanupServiceLoadBalancer(ctx, clusterName, service); err != nil {
+			return err
+		}
+	}
+
+	az.cleanupServiceConditions(service)
+	klog.V(2).Infof("Delete service (%s): FINISH", serviceName)
+	isOperationSucceeded = true
+
+	return nil
+}
+
+// cleanupServiceLoadBalancer removes the service from the load balancer and deletes its DNS records, global
+// load balancer registration, security rules and public IP.
+func (az *Cloud) cleanupServiceLoadBalancer(ctx context.Context, clusterName string, service *v1.Service) error {
+	serviceName := getServiceName(service)
+	if err := az.reconcileDNSRecords(clusterName, service, nil, false /* wantRecords */); err != nil {
+		return err
+	}
+
+	// The regional frontend can only be deleted after it is removed from the global load balancer.
+	if _, err := az.reconcileGlobalLoadBalancer(clusterName, service, nil, false /* wantLb */); err != nil {
+		return err
+	}
 
 	serviceIPToCleanup, err := az.findServiceIPAddress(ctx, clusterName, service)
 	if err != nil && !retry.HasStatusForbiddenOrIgnoredError(err) {
 		return err
 	}
 
-	klog.V(2).Infof("EnsureLoadBalancerDeleted: reconciling security group for service %q with IP %q, wantLb = false", serviceName, serviceIPToCleanup)
+	klog.V(2).Infof("cleanupServiceLoadBalancer: reconciling security group for service %q with IP %q, wantLb = false", serviceName, serviceIPToCleanup)
 	_, err = az.reconcileSecurityGroup(clusterName, service, &serviceIPToCleanup, nil, false /* wantLb */)
 	if err != nil {
 		return err
 	}
 
-	_, err = az.reconcileLoadBalancer(clusterName, service, nil, false /* wantLb */)
+	_, err = az.reconcileLoadBalancer(ctx, clusterName, service, nil, false /* wantLb */)
 	if err != nil && !retry.HasStatusForbiddenOrIgnoredError(err) {
 		return err
 	}
 
 	// check flipped service also
 	flippedService := flipServiceInternalAnnotation(service)
-	if _, err := az.reconcileLoadBalancer(clusterName, flippedService, nil, false /* wantLb */); err != nil {
+	if _, err := az.reconcileLoadBalancer(ctx, clusterName, flippedService, nil, false /* wantLb */); err != nil {
 		return err
 	}
 
@@ -323,9 +488,6 @@ func (az *Cloud) EnsureLoadBalancerDeleted(ctx context.Context, clusterName stri
 		return err
 	}
 
-	klog.V(2).Infof("Delete service (%s): FINISH", serviceName)
-	isOperationSucceeded = true
-
 	return nil
 }
 
@@ -346,6 +508,10 @@ func (az *Cloud) getLoadBalancerResourceGroup() string {
 // according to the mode annotation on the service. This could be happened when the LB selection mode of an
 // existing service is changed to another VMSS/VMAS.
 func (az *Cloud) shouldChangeLoadBalancer(service *v1.Service, currLBName, clusterName string) bool {
+	if az.useLoadBalancerProfiles() {
+		return az.shouldMoveServiceByProfile(service, currLBName)
+	}
+
 	hasMode, isAuto, vmSetName := az.getServiceLoadBalancerMode(service)
 
 	// if no mode is given or the mode is `__auto__`, the current LB should be kept
@@ -474,7 +640,7 @@ func (az *Cloud) cleanOrphanedLoadBalancer(lb *network.LoadBalancer, existingLBs
 		klog.V(2).Infof("cleanOrphanedLoadBalancer(%s, %s, %s): deleting the LB since there are no remaining frontendIPConfigurations", lbName, serviceName, clusterName)
 
 		// Remove backend pools from vmSets. This is required for virtual machine scale sets before removing the LB.
-		vmSetName := az.mapLoadBalancerNameToVMSet(lbName, clusterName)
+		vmSetName := az.getLoadBalancerVMSetName(lbName, clusterName)
 		if _, ok := az.VMSet.(*availabilitySet); ok {
 			// do nothing for availability set
 			lb.BackendAddressPools = nil
@@ -505,6 +671,10 @@ func (az *Cloud) cleanOrphanedLoadBalancer(lb *network.LoadBalancer, existingLBs
 			}
 
 			vmssNamesMap := map[string]bool{vmssName: true}
+			if az.inLoadBalancerPlan(service) {
+				az.planVMSetBackendPoolChange(service, planOperationDelete, lbBackendPoolID, vmssName, nil)
+				return nil
+			}
 			err := az.VMSet.EnsureBackendPoolDeletedFromVMSets(vmssNamesMap, lbBackendPoolID)
 			if err != nil {
 				klog.Errorf("cleanOrphanedLoadBalancer(%s, %s, %s): failed to EnsureBackendPoolDeletedFromVMSets: %v", lbName, serviceName, clusterName, err)
@@ -522,11 +692,20 @@ func (az *Cloud) cleanOrphanedLoadBalancer(lb *network.LoadBalancer, existingLBs
 	return nil
 }
 
+// ensureBackendPoolDeletedFromVMSet decouples the nodes of the vmSet from the backend pool, which updates the VMs,
+// VMSS or NICs. The change is only planned in plan mode.
+func (az *Cloud) ensureBackendPoolDeletedFromVMSet(service *v1.Service, backendPoolID, vmSetName string, backendAddressPools *[]network.BackendAddressPool, deleteFromVMSet bool) (bool, error) {
+	if az.inLoadBalancerPlan(service) {
+		az.planVMSetBackendPoolChange(service, planOperationDelete, backendPoolID, vmSetName, nil)
+		return false, nil
+	}
+	return az.VMSet.EnsureBackendPoolDeleted(service, backendPoolID, vmSetName, backendAddressPools, deleteFromVMSet)
+}
+
 // safeDeleteLoadBalancer deletes the load balancer after decoupling it from the vmSet
 func (az *Cloud) safeDeleteLoadBalancer(lb network.LoadBalancer, clusterName, vmSetName string, service *v1.Service) *retry.Error {
 	lbBackendPoolID := az.getBackendPoolID(pointer.StringDeref(lb.Name, ""), az.getLoadBalancerResourceGroup(), getBackendPoolName(clusterName, service))
-	_, err := az.VMSet.EnsureBackendPoolDeleted(service, lbBackendPoolID, vmSetName, lb.BackendAddressPools, true)
-	if err != nil {
+	if _, err := az.ensureBackendPoolDeletedFromVMSet(service, lbBackendPoolID, vmSetName, lb.BackendAddressPools, true); err != nil {
 		return retry.NewError(false, fmt.Errorf("safeDeleteLoadBalancer: failed to EnsureBackendPoolDeleted: %w", err))
 	}
 
@@ -654,7 +833,8 @@ func (az *Cloud) getServiceLoadBalancer(service *v1.Service, clusterName string,
 		existingLBNamePrefix := strings.TrimSuffix(pointer.StringDeref(existingLB.Name, ""), consts.InternalLoadBalancerNameSuffix)
 
 		// for the primary standard load balancer (internal or external), when enabled multiple slbs
-		if strings.EqualFold(existingLBNamePrefix, clusterName) && useMultipleSLBs {
+		// the backend pools of the profiles are reconciled by node instead
+		if strings.EqualFold(existingLBNamePrefix, clusterName) && useMultipleSLBs && !az.useLoadBalancerProfiles() {
 			shouldRemoveVMSetFromSLB := func(vmSetName string) bool {
 				// not removing the vmSet from the primary SLB
 				// if it is supposed to share the primary SLB.
@@ -749,6 +929,10 @@ func (az *Cloud) getServiceLoadBalancer(service *v1.Service, clusterName string,
 // the minimum lb rules. If there are multiple LBs with same number of rules,
 // then selects the first one (sorted based on name).
 func (az *Cloud) selectLoadBalancer(clusterName string, service *v1.Service, existingLBs *[]network.LoadBalancer, nodes []*v1.Node) (selectedLB *network.LoadBalancer, existsLb bool, err error) {
+	if az.useLoadBalancerProfiles() {
+		return az.selectLoadBalancerByProfile(clusterName, service, existingLBs)
+	}
+
 	isInternal := requiresInternalLoadBalancer(service)
 	serviceName := getServiceName(service)
 	klog.V(2).Infof("selectLoadBalancer for service (%s): isInternal(%v) - start", serviceName, isInternal)
@@ -770,26 +954,7 @@ func (az *Cloud) selectLoadBalancer(clusterName string, service *v1.Service, exi
 		if !exists {
 			// select this LB as this is a new LB and will have minimum rules
 			// create tmp lb struct to hold metadata for the new load-balancer
-			var loadBalancerSKU network.LoadBalancerSkuName
-			if az.useStandardLoadBalancer() {
-				loadBalancerSKU = network.LoadBalancerSkuNameStandard
-			} else {
-				loadBalancerSKU = network.LoadBalancerSkuNameBasic
-			}
-			selectedLB = &network.LoadBalancer{
-				Name:                         &currLBName,
-				Location:                     &az.Location,
-				Sku:                          &network.LoadBalancerSku{Name: loadBalancerSKU},
-				LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{},
-			}
-			if az.HasExtendedLocation() {
-				selectedLB.ExtendedLocation = &network.ExtendedLocation{
-					Name: &az.ExtendedLocationName,
-					Type: getExtendedLocationTypeFromString(az.ExtendedLocationType),
-				}
-			}
-
-			return selectedLB, false, nil
+			return az.newLoadBalancer(currLBName), false, nil
 		}
 
 		lbRules := *lb.LoadBalancingRules
@@ -818,6 +983,27 @@ func (az *Cloud) selectLoadBalancer(clusterName string, service *v1.Service, exi
 	return selectedLB, existsLb, nil
 }
 
+// newLoadBalancer returns the metadata of a load balancer to be created.
+func (az *Cloud) newLoadBalancer(lbName string) *network.LoadBalancer {
+	loadBalancerSKU := network.LoadBalancerSkuNameBasic
+	if az.useStandardLoadBalancer() {
+		loadBalancerSKU = network.LoadBalancerSkuNameStandard
+	}
+	lb := &network.LoadBalancer{
+		Name:                         &lbName,
+		Location:                     &az.Location,
+		Sku:                          &network.LoadBalancerSku{Name: loadBalancerSKU},
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{},
+	}
+	if az.HasExtendedLocation() {
+		lb.ExtendedLocation = &network.ExtendedLocation{
+			Name: &az.ExtendedLocationName,
+			Type: getExtendedLocationTypeFromString(az.ExtendedLocationType),
+		}
+	}
+	return lb
+}
+
 // pips: a non-nil pointer to a slice of existing PIPs, if the slice being pointed to is nil, listPIP would be called when needed and the slice would be filled
 func (az *Cloud) getServiceLoadBalancerStatus(service *v1.Service, lb *network.LoadBalancer, pips *[]network.PublicIPAddress) (status *v1.LoadBalancerStatus, fipConfig *network.FrontendIPConfiguration, err error) {
 	if lb == nil {
@@ -877,6 +1063,10 @@ func (az *Cloud) getServiceLoadBalancerStatus(service *v1.Service, lb *network.L
 					})
 				}
 			}
+			// set the private IPs of the zonal frontends, so that the clients could target the IP in their own zone.
+			for _, ip := range az.getZonalFrontendIPs(service, lb) {
+				lbIngress = append(lbIngress, v1.LoadBalancerIngress{IP: ip})
+			}
 
 			return &v1.LoadBalancerStatus{Ingress: lbIngress}, &ipConfiguration, nil
 		}
@@ -895,6 +1085,10 @@ func (az *Cloud) determinePublicIPName(clusterName string, service *v1.Service,
 	}
 
 	pipResourceGroup := az.getPublicIPAddressResourceGroup(service)
+	if az.shouldLeasePublicIPFromPool(service) {
+		name, err := az.getPublicIPNameFromPool(service, pipResourceGroup, pips)
+		return name, true, err
+	}
 	loadBalancerIP := getServiceLoadBalancerIP(service)
 
 	// Assume that the service without loadBalancerIP set is a primary service.
@@ -989,6 +1183,10 @@ func (az *Cloud) findServiceIPAddress(ctx context.Context, clusterName string, s
 }
 
 func (az *Cloud) ensurePublicIPExists(service *v1.Service, pipName string, domainNameLabel, clusterName string, shouldPIPExisted, foundDNSLabelAnnotation bool) (*network.PublicIPAddress, error) {
+	if err := az.validatePublicIPAnnotations(service); err != nil {
+		return nil, err
+	}
+
 	pipResourceGroup := az.getPublicIPAddressResourceGroup(service)
 	pip, existsPip, err := az.getPublicIPAddress(pipResourceGroup, pipName, azcache.CacheReadTypeDefault)
 	if err != nil {
@@ -1007,11 +1205,25 @@ func (az *Cloud) ensurePublicIPExists(service *v1.Service, pipName string, domai
 				return nil, err
 			}
 		}
+		leased, err := az.leasePublicIPFromPool(service, pipResourceGroup, &pip, clusterName)
+		if err != nil {
+			return nil, err
+		}
+		changed = changed || leased
 
 		if pip.Tags == nil {
 			pip.Tags = make(map[string]*string)
 		}
 
+		az.checkPublicIPZones(service, &pip)
+		if pip.PublicIPAddressPropertiesFormat != nil {
+			updatedDdosSettings, err := reconcilePublicIPDdosSettings(&pip, service)
+			if err != nil {
+				return nil, err
+			}
+			changed = changed || updatedDdosSettings
+		}
+
 		// return if pip exist and dns label is the same
 		if strings.EqualFold(getDomainNameLabel(&pip), domainNameLabel) {
 			if existingServiceName := getServiceFromPIPDNSTags(pip.Tags); existingServiceName != "" && strings.EqualFold(existingServiceName, serviceName) {
@@ -1077,6 +1289,13 @@ func (az *Cloud) ensurePublicIPExists(service *v1.Service, pipName string, domai
 			pip.Sku = &network.PublicIPAddressSku{
 				Name: network.PublicIPAddressSkuNameStandard,
 			}
+			tier, err := getPublicIPSkuTier(service)
+			if err != nil {
+				return nil, err
+			}
+			if tier != "" {
+				pip.Sku.Tier = tier
+			}
 			if pipPrefixName, ok := service.Annotations[consts.ServiceAnnotationPIPPrefixID]; ok && pipPrefixName != "" {
 				pip.PublicIPPrefix = &network.SubResource{ID: pointer.String(pipPrefixName)}
 			}
@@ -1084,15 +1303,24 @@ func (az *Cloud) ensurePublicIPExists(service *v1.Service, pipName string, domai
 			// skip adding zone info since edge zones doesn't support multiple availability zones.
 			if !az.HasExtendedLocation() {
 				// only add zone information for the new standard pips
-				zones, err := az.getRegionZonesBackoff(pointer.StringDeref(pip.Location, ""))
+				zones, found, err := getPublicIPZones(service)
 				if err != nil {
 					return nil, err
 				}
+				if !found {
+					zones, err = az.getRegionZonesBackoff(pointer.StringDeref(pip.Location, ""))
+					if err != nil {
+						return nil, err
+					}
+				}
 				if len(zones) > 0 {
 					pip.Zones = &zones
 				}
 			}
 		}
+		if _, err = reconcilePublicIPDdosSettings(&pip, service); err != nil {
+			return nil, err
+		}
 		klog.V(2).Infof("ensurePublicIPExists for service(%s): pip(%s) - creating", serviceName, *pip.Name)
 	}
 	if az.ensurePIPTagged(service, &pip) {
@@ -1128,6 +1356,14 @@ func (az *Cloud) ensurePublicIPExists(service *v1.Service, pipName string, domai
 		klog.V(10).Infof("CreateOrUpdatePIP(%s, %q): end", pipResourceGroup, *pip.Name)
 	}
 
+	// The pip is not written in plan mode, so return the planned one with the ID it would get.
+	if az.inLoadBalancerPlan(service) {
+		if pip.ID == nil {
+			pip.ID = pointer.String(az.getPublicIPAddressID(pipResourceGroup, *pip.Name))
+		}
+		return &pip, nil
+	}
+
 	ctx, cancel := getContextWithCancel()
 	defer cancel()
 	pip, rerr := az.PublicIPAddressesClient.Get(ctx, pipResourceGroup, *pip.Name, "")
@@ -1262,10 +1498,22 @@ type serviceIPTagRequest struct {
 // Get the ip tag Request for the public ip from service annotations.
 func getServiceIPTagRequestForPublicIP(service *v1.Service) serviceIPTagRequest {
 	if service != nil {
-		if ipTagString, found := service.Annotations[consts.ServiceAnnotationIPTagsForPublicIP]; found {
+		ipTagString, foundIPTags := service.Annotations[consts.ServiceAnnotationIPTagsForPublicIP]
+		// The routing preference is an IP tag of the public IP, and invalid values are rejected by ensurePublicIPExists.
+		routingPreference, foundRoutingPreference, err := getPublicIPRoutingPreference(service)
+		foundRoutingPreference = foundRoutingPreference && err == nil
+		if foundIPTags || foundRoutingPreference {
+			ipTagMap := getIPTagMap(ipTagString)
+			if foundRoutingPreference {
+				delete(ipTagMap, consts.IPTagTypeRoutingPreference)
+				// Microsoft network is the default routing preference, which has no IP tag.
+				if routingPreference == consts.RoutingPreferenceInternet {
+					ipTagMap[consts.IPTagTypeRoutingPreference] = routingPreference
+				}
+			}
 			return serviceIPTagRequest{
 				IPTagsRequestedByAnnotation: true,
-				IPTags:                      convertIPTagMapToSlice(getIPTagMap(ipTagString)),
+				IPTags:                      convertIPTagMapToSlice(ipTagMap),
 			}
 		}
 	}
@@ -1527,7 +1775,7 @@ func (az *Cloud) findFrontendIPConfigOfService(
 // This also reconciles the Service's Ports with the LoadBalancer config.
 // This entails adding rules/probes for expected Ports and removing stale rules/ports.
 // nodes only used if wantLb is true
-func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service, nodes []*v1.Node, wantLb bool) (*network.LoadBalancer, error) {
+func (az *Cloud) reconcileLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node, wantLb bool) (*network.LoadBalancer, error) {
 	isBackendPoolPreConfigured := az.isBackendPoolPreConfigured(service)
 	serviceName := getServiceName(service)
 	klog.V(2).Infof("reconcileLoadBalancer for service(%s) - wantLb(%t): started", serviceName, wantLb)
@@ -1546,11 +1794,13 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 
 	lbName := *lb.Name
 	lbResourceGroup := az.getLoadBalancerResourceGroup()
-	lbBackendPoolID := az.getBackendPoolID(lbName, az.getLoadBalancerResourceGroup(), getBackendPoolName(clusterName, service))
+	lbBackendPoolName := az.getServiceBackendPoolName(clusterName, service)
+	lbBackendPoolID := az.getBackendPoolID(lbName, az.getLoadBalancerResourceGroup(), lbBackendPoolName)
 	klog.V(2).Infof("reconcileLoadBalancer for service(%s): lb(%s/%s) wantLb(%t) resolved load balancer name", serviceName, lbResourceGroup, lbName, wantLb)
 	defaultLBFrontendIPConfigName := az.getDefaultFrontendIPConfigName(service)
 	defaultLBFrontendIPConfigID := az.getFrontendIPConfigID(lbName, lbResourceGroup, defaultLBFrontendIPConfigName)
 	dirtyLb := false
+	manifest := az.getLoadBalancerOwnershipManifest(lb)
 
 	// reconcile the load balancer's backend pool configuration.
 	if wantLb {
@@ -1565,7 +1815,16 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 	}
 
 	// reconcile the load balancer's frontend IP configurations.
-	ownedFIPConfig, toDeleteConfigs, changed, err := az.reconcileFrontendIPConfigs(clusterName, service, lb, lbStatus, wantLb, defaultLBFrontendIPConfigName)
+	ownedFIPConfig, toDeleteConfigs, changed, err := az.reconcileFrontendIPConfigs(clusterName, service, lb, lbStatus, wantLb, defaultLBFrontendIPConfigName, manifest)
+	if err != nil {
+		return lb, err
+	}
+	if changed {
+		dirtyLb = true
+	}
+
+	// reconcile the zonal frontend IP configurations and their backend pools.
+	zonalFrontends, changed, err := az.reconcileZonalFrontends(ctx, clusterName, service, lb, nodes, wantLb)
 	if err != nil {
 		return lb, err
 	}
@@ -1587,6 +1846,14 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 		if err != nil {
 			return nil, err
 		}
+
+		changed, err = az.reconcileGatewayLoadBalancerChain(service, lb, defaultLBFrontendIPConfigID)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			dirtyLb = true
+		}
 	}
 
 	var expectedProbes []network.Probe
@@ -1596,17 +1863,24 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 		if err != nil {
 			return nil, err
 		}
+		expectedRules = append(expectedRules, getExpectedZonalLBRules(expectedRules, zonalFrontends)...)
+	}
+
+	if changed := az.reconcileLBProbes(lb, service, serviceName, wantLb, expectedProbes, manifest); changed {
+		dirtyLb = true
 	}
 
-	if changed := az.reconcileLBProbes(lb, service, serviceName, wantLb, expectedProbes); changed {
+	if changed := az.reconcileLBRules(lb, service, serviceName, wantLb, expectedRules, manifest); changed {
 		dirtyLb = true
 	}
 
-	if changed := az.reconcileLBRules(lb, service, serviceName, wantLb, expectedRules); changed {
+	// The podIP backend pool of the service is removed together with its rules.
+	if !wantLb && az.isLBBackendPoolTypePodIP() && removeBackendPool(lb, lbBackendPoolName) {
+		klog.V(2).Infof("reconcileLoadBalancer for service (%s)(%t): lb backendpool(%s) - dropping", serviceName, wantLb, lbBackendPoolName)
 		dirtyLb = true
 	}
 
-	if changed := az.ensureLoadBalancerTagged(lb); changed {
+	if changed := az.ensureLoadBalancerTagged(lb, manifest); changed {
 		dirtyLb = true
 	}
 
@@ -1644,22 +1918,39 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 				return nil, err
 			}
 
-			// Refresh updated lb which will be used later in other places.
-			newLB, exist, err := az.getAzureLoadBalancer(lbName, azcache.CacheReadTypeDefault)
-			if err != nil {
-				klog.Errorf("reconcileLoadBalancer for service(%s): getAzureLoadBalancer(%s) failed: %v", serviceName, lbName, err)
-				return nil, err
-			}
-			if !exist {
-				return nil, fmt.Errorf("load balancer %q not found", lbName)
+			// In plan mode the lb is not written, so the planned one is used later instead of the cached one.
+			if !az.inLoadBalancerPlan(service) {
+				// Refresh updated lb which will be used later in other places.
+				newLB, exist, err := az.getAzureLoadBalancer(lbName, azcache.CacheReadTypeDefault)
+				if err != nil {
+					klog.Errorf("reconcileLoadBalancer for service(%s): getAzureLoadBalancer(%s) failed: %v", serviceName, lbName, err)
+					return nil, err
+				}
+				if !exist {
+					return nil, fmt.Errorf("load balancer %q not found", lbName)
+				}
+				lb = newLB
 			}
-			lb = newLB
 		}
 	}
 
 	if wantLb && nodes != nil && !isBackendPoolPreConfigured {
 		// Add the machines to the backend pool if they're not already
-		vmSetName := az.mapLoadBalancerNameToVMSet(lbName, clusterName)
+		vmSetName := az.getLoadBalancerVMSetName(lbName, clusterName)
+		if az.useLoadBalancerProfiles() {
+			// The nodes are selected by the profile of the load balancer instead of their vmSets.
+			nodes = az.filterNodesByLoadBalancer(lbName, nodes)
+		}
+		if az.inLoadBalancerPlan(service) {
+			// The nodes are not joined to the backend pool in plan mode because it would update the VMs, VMSS or NICs.
+			nodeNames := make([]string, 0, len(nodes))
+			for _, node := range nodes {
+				nodeNames = append(nodeNames, node.Name)
+			}
+			az.planVMSetBackendPoolChange(service, planOperationCreateOrUpdate, lbBackendPoolID, vmSetName, nodeNames)
+			klog.V(2).Infof("reconcileLoadBalancer for service(%s): lb(%s) - finished planning %d hosts in the backend pool", serviceName, lbName, len(nodes))
+			return lb, nil
+		}
 		// Etag would be changed when updating backend pools, so invalidate lbCache after it.
 		defer func() {
 			_ = az.lbCache.Delete(lbName)
@@ -1668,7 +1959,7 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 		if lb.LoadBalancerPropertiesFormat != nil && lb.BackendAddressPools != nil {
 			backendPools := *lb.BackendAddressPools
 			for _, backendPool := range backendPools {
-				if strings.EqualFold(pointer.StringDeref(backendPool.Name, ""), getBackendPoolName(clusterName, service)) {
+				if strings.EqualFold(pointer.StringDeref(backendPool.Name, ""), lbBackendPoolName) {
 					if err := az.LoadBalancerBackendPool.EnsureHostsInPool(service, nodes, lbBackendPoolID, vmSetName, clusterName, lbName, backendPool); err != nil {
 						return nil, err
 					}
@@ -1681,7 +1972,7 @@ func (az *Cloud) reconcileLoadBalancer(clusterName string, service *v1.Service,
 	return lb, nil
 }
 
-func (az *Cloud) reconcileLBProbes(lb *network.LoadBalancer, service *v1.Service, serviceName string, wantLb bool, expectedProbes []network.Probe) bool {
+func (az *Cloud) reconcileLBProbes(lb *network.LoadBalancer, service *v1.Service, serviceName string, wantLb bool, expectedProbes []network.Probe, manifest *ownershipManifest) bool {
 	// remove unwanted probes
 	dirtyProbes := false
 	var updatedProbes []network.Probe
@@ -1690,7 +1981,7 @@ func (az *Cloud) reconcileLBProbes(lb *network.LoadBalancer, service *v1.Service
 	}
 	for i := len(updatedProbes) - 1; i >= 0; i-- {
 		existingProbe := updatedProbes[i]
-		if az.serviceOwnsRule(service, *existingProbe.Name) {
+		if az.serviceOwnsRule(service, *existingProbe.Name) && manifest.ownsOrSkip(ownedKindProbe, *existingProbe.Name) {
 			klog.V(10).Infof("reconcileLoadBalancer for service (%s)(%t): lb probe(%s) - considering evicting", serviceName, wantLb, *existingProbe.Name)
 			keepProbe := false
 			if findProbe(expectedProbes, existingProbe) {
@@ -1699,6 +1990,7 @@ func (az *Cloud) reconcileLBProbes(lb *network.LoadBalancer, service *v1.Service
 			}
 			if !keepProbe {
 				updatedProbes = append(updatedProbes[:i], updatedProbes[i+1:]...)
+				manifest.remove(ownedKindProbe, *existingProbe.Name)
 				klog.V(2).Infof("reconcileLoadBalancer for service (%s)(%t): lb probe(%s) - dropping", serviceName, wantLb, *existingProbe.Name)
 				dirtyProbes = true
 			}
@@ -1711,9 +2003,14 @@ func (az *Cloud) reconcileLBProbes(lb *network.LoadBalancer, service *v1.Service
 			klog.V(10).Infof("reconcileLoadBalancer for service (%s)(%t): lb probe(%s) - already exists", serviceName, wantLb, *expectedProbe.Name)
 			foundProbe = true
 		}
+		if !foundProbe && !manifest.owns(ownedKindProbe, *expectedProbe.Name) && findProbeByName(updatedProbes, *expectedProbe.Name) {
+			az.reportOwnershipConflict(service, ownedKindProbe, *expectedProbe.Name)
+			continue
+		}
 		if !foundProbe {
 			klog.V(10).Infof("reconcileLoadBalancer for service (%s)(%t): lb probe(%s) - adding", serviceName, wantLb, *expectedProbe.Name)
 			updatedProbes = append(updatedProbes, expectedProbe)
+			manifest.add(ownedKindProbe, *expectedProbe.Name)
 			dirtyProbes = true
 		}
 	}
@@ -1725,7 +2022,7 @@ func (az *Cloud) reconcileLBProbes(lb *network.LoadBalancer, service *v1.Service
 	return dirtyProbes
 }
 
-func (az *Cloud) reconcileLBRules(lb *network.LoadBalancer, service *v1.Service, serviceName string, wantLb bool, expectedRules []network.LoadBalancingRule) bool {
+func (az *Cloud) reconcileLBRules(lb *network.LoadBalancer, service *v1.Service, serviceName string, wantLb bool, expectedRules []network.LoadBalancingRule, manifest *ownershipManifest) bool {
 	// update rules
 	dirtyRules := false
 	var updatedRules []network.LoadBalancingRule
@@ -1736,7 +2033,7 @@ func (az *Cloud) reconcileLBRules(lb *network.LoadBalancer, service *v1.Service,
 	// update rules: remove unwanted
 	for i := len(updatedRules) - 1; i >= 0; i-- {
 		existingRule := updatedRules[i]
-		if az.serviceOwnsRule(service, *existingRule.Name) {
+		if az.serviceOwnsRule(service, *existingRule.Name) && manifest.ownsOrSkip(ownedKindLoadBalancingRule, *existingRule.Name) {
 			keepRule := false
 			klog.V(10).Infof("reconcileLoadBalancer for service (%s)(%t): lb rule(%s) - considering evicting", serviceName, wantLb, *existingRule.Name)
 			if findRule(expectedRules, existingRule, wantLb) {
@@ -1746,6 +2043,7 @@ func (az *Cloud) reconcileLBRules(lb *network.LoadBalancer, service *v1.Service,
 			if !keepRule {
 				klog.V(2).Infof("reconcileLoadBalancer for service (%s)(%t): lb rule(%s) - dropping", serviceName, wantLb, *existingRule.Name)
 				updatedRules = append(updatedRules[:i], updatedRules[i+1:]...)
+				manifest.remove(ownedKindLoadBalancingRule, *existingRule.Name)
 				dirtyRules = true
 			}
 		}
@@ -1757,9 +2055,14 @@ func (az *Cloud) reconcileLBRules(lb *network.LoadBalancer, service *v1.Service,
 			klog.V(10).Infof("reconcileLoadBalancer for service (%s)(%t): lb rule(%s) - already exists", serviceName, wantLb, *expectedRule.Name)
 			foundRule = true
 		}
+		if !foundRule && !manifest.owns(ownedKindLoadBalancingRule, *expectedRule.Name) && findLBRuleByName(updatedRules, *expectedRule.Name) {
+			az.reportOwnershipConflict(service, ownedKindLoadBalancingRule, *expectedRule.Name)
+			continue
+		}
 		if !foundRule {
 			klog.V(10).Infof("reconcileLoadBalancer for service (%s)(%t): lb rule(%s) adding", serviceName, wantLb, *expectedRule.Name)
 			updatedRules = append(updatedRules, expectedRule)
+			manifest.add(ownedKindLoadBalancingRule, *expectedRule.Name)
 			dirtyRules = true
 		}
 	}
@@ -1771,7 +2074,7 @@ func (az *Cloud) reconcileLBRules(lb *network.LoadBalancer, service *v1.Service,
 	return dirtyRules
 }
 
-func (az *Cloud) reconcileFrontendIPConfigs(clusterName string, service *v1.Service, lb *network.LoadBalancer, status *v1.LoadBalancerStatus, wantLb bool, defaultLBFrontendIPConfigName string) (*network.FrontendIPConfiguration, []network.FrontendIPConfiguration, bool, error) {
+func (az *Cloud) reconcileFrontendIPConfigs(clusterName string, service *v1.Service, lb *network.LoadBalancer, status *v1.LoadBalancerStatus, wantLb bool, defaultLBFrontendIPConfigName string, manifest *ownershipManifest) (*network.FrontendIPConfiguration, []network.FrontendIPConfiguration, bool, error) {
 	var err error
 	lbName := *lb.Name
 	serviceName := getServiceName(service)
@@ -1793,7 +2096,7 @@ func (az *Cloud) reconcileFrontendIPConfigs(clusterName string, service *v1.Serv
 			if err != nil {
 				return nil, toDeleteConfigs, false, err
 			}
-			if isServiceOwnsFrontendIP {
+			if isServiceOwnsFrontendIP && manifest.ownsOrSkip(ownedKindFrontendIPConfig, pointer.StringDeref(config.Name, "")) {
 				unsafe, err := az.isFrontendIPConfigUnsafeToDelete(lb, service, config.ID)
 				if err != nil {
 					return nil, toDeleteConfigs, false, err
@@ -1816,6 +2119,7 @@ func (az *Cloud) reconcileFrontendIPConfigs(clusterName string, service *v1.Serv
 
 					toDeleteConfigs = append(toDeleteConfigs, newConfigs[i])
 					newConfigs = append(newConfigs[:i], newConfigs[i+1:]...)
+					manifest.remove(ownedKindFrontendIPConfig, configNameToBeDeleted)
 					dirtyConfigs = true
 				}
 			}
@@ -1837,10 +2141,11 @@ func (az *Cloud) reconcileFrontendIPConfigs(clusterName string, service *v1.Serv
 			if err != nil {
 				return nil, toDeleteConfigs, false, err
 			}
-			if isFipChanged {
+			if isFipChanged && manifest.ownsOrSkip(ownedKindFrontendIPConfig, pointer.StringDeref(config.Name, "")) {
 				klog.V(2).Infof("reconcileLoadBalancer for service (%s)(%t): lb frontendconfig(%s) - dropping", serviceName, wantLb, *config.Name)
 				toDeleteConfigs = append(toDeleteConfigs, newConfigs[i])
 				newConfigs = append(newConfigs[:i], newConfigs[i+1:]...)
+				manifest.remove(ownedKindFrontendIPConfig, pointer.StringDeref(config.Name, ""))
 				dirtyConfigs = true
 				previousZone = config.Zones
 			}
@@ -1887,6 +2192,10 @@ func (az *Cloud) reconcileFrontendIPConfigs(clusterName string, service *v1.Serv
 					klog.V(4).Infof("reconcileFrontendIPConfigs for service (%s): keep the original private IP %s", serviceName, status.Ingress[0].IP)
 					configProperties.PrivateIPAllocationMethod = network.Static
 					configProperties.PrivateIPAddress = pointer.String(status.Ingress[0].IP)
+				} else if snapshot := getLoadBalancerSkuMigrationSnapshot(service); snapshot != nil && snapshot.IPAddress != "" && ipInSubnet(snapshot.IPAddress, &subnet) {
+					klog.V(4).Infof("reconcileFrontendIPConfigs for service (%s): keep the private IP %s of the basic load balancer", serviceName, snapshot.IPAddress)
+					configProperties.PrivateIPAllocationMethod = network.Static
+					configProperties.PrivateIPAddress = pointer.String(snapshot.IPAddress)
 				} else {
 					// We'll need to call GetLoadBalancer later to retrieve allocated IP.
 					klog.V(4).Infof("reconcileFrontendIPConfigs for service (%s): dynamically allocate the private IP", serviceName)
@@ -1922,6 +2231,7 @@ func (az *Cloud) reconcileFrontendIPConfigs(clusterName string, service *v1.Serv
 				}
 			}
 			newConfigs = append(newConfigs, newConfig)
+			manifest.add(ownedKindFrontendIPConfig, defaultLBFrontendIPConfigName)
 			klog.V(2).Infof("reconcileLoadBalancer for service (%s)(%t): lb frontendconfig(%s) - adding", serviceName, wantLb, defaultLBFrontendIPConfigName)
 			dirtyConfigs = true
 		}
@@ -2067,9 +2377,22 @@ func lbRuleConflictsWithPort(rule network.LoadBalancingRule, frontendIPConfigID
 // for following protocols: TCP HTTP HTTPS(SLB only)
 func (az *Cloud) buildHealthProbeRulesForPort(serviceManifest *v1.Service, port v1.ServicePort, lbrule string) (*network.Probe, error) {
 	if port.Protocol == v1.ProtocolUDP || port.Protocol == v1.ProtocolSCTP {
-		return nil, nil
+		// The load balancer cannot probe a UDP or SCTP port, so the probe is only created
+		// when it targets another port, e.g. the one of a sidecar serving the health checks.
+		probePort, err := consts.GetHealthProbeConfigOfPortFromK8sSvcAnnotation(serviceManifest.Annotations, port.Port, consts.HealthProbeParamsPort)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse annotation %s: %w", consts.BuildHealthProbeAnnotationKeyForPort(port.Port, consts.HealthProbeParamsPort), err)
+		}
+		if probePort == nil {
+			if protocol, _ := consts.GetHealthProbeConfigOfPortFromK8sSvcAnnotation(serviceManifest.Annotations, port.Port, consts.HealthProbeParamsProtocol); protocol != nil {
+				return nil, fmt.Errorf("annotation %s is required to probe the %s port %d", consts.BuildHealthProbeAnnotationKeyForPort(port.Port, consts.HealthProbeParamsPort), port.Protocol, port.Port)
+			}
+			return nil, nil
+		}
+		if target := findHealthProbeTargetPort(serviceManifest, *probePort); target != nil && (target.Protocol == v1.ProtocolUDP || target.Protocol == v1.ProtocolSCTP) {
+			return nil, fmt.Errorf("the health probe of port %d cannot target the %s port %s", port.Port, target.Protocol, *probePort)
+		}
 	}
-	// protocol should be tcp, because sctp is handled in outer loop
 
 	properties := &network.ProbePropertiesFormat{}
 	var err error
@@ -2127,7 +2450,7 @@ func (az *Cloud) buildHealthProbeRulesForPort(serviceManifest *v1.Service, port
 	}
 
 	// Lookup or Override Health Probe Port
-	properties.Port = &port.NodePort
+	properties.Port = pointer.Int32(az.getServiceBackendPort(serviceManifest, port))
 
 	probePort, err := consts.GetHealthProbeConfigOfPortFromK8sSvcAnnotation(serviceManifest.Annotations, port.Port, consts.HealthProbeParamsPort, func(s *string) error {
 		if s == nil {
@@ -2162,26 +2485,8 @@ func (az *Cloud) buildHealthProbeRulesForPort(serviceManifest *v1.Service, port
 	}
 
 	if probePort != nil {
-		//nolint:gosec
-		port, err := strconv.Atoi(*probePort)
-		if err != nil {
-			//not a integer
-			for _, item := range serviceManifest.Spec.Ports {
-				if strings.EqualFold(item.Name, *probePort) {
-					//found the port
-					properties.Port = pointer.Int32(item.NodePort)
-				}
-			}
-		} else {
-			if port >= 0 || port <= 65535 {
-				for _, item := range serviceManifest.Spec.Ports {
-					//nolint:gosec
-					if item.Port == int32(port) {
-						//found the port
-						properties.Port = pointer.Int32(item.NodePort)
-					}
-				}
-			}
+		if target := findHealthProbeTargetPort(serviceManifest, *probePort); target != nil {
+			properties.Port = pointer.Int32(az.getServiceBackendPort(serviceManifest, *target))
 		}
 	}
 
@@ -2266,6 +2571,78 @@ func (az *Cloud) buildHealthProbeRulesForPort(serviceManifest *v1.Service, port
 	return probe, nil
 }
 
+// findHealthProbeTargetPort finds the service port by name or number. A TCP port is preferred
+// when ports of different protocols share the number.
+func findHealthProbeTargetPort(service *v1.Service, value string) *v1.ServicePort {
+	var target *v1.ServicePort
+	port, err := strconv.Atoi(value)
+	for i := range service.Spec.Ports {
+		item := &service.Spec.Ports[i]
+		//nolint:gosec
+		if (err != nil && strings.EqualFold(item.Name, value)) || (err == nil && item.Port == int32(port)) {
+			if item.Protocol == v1.ProtocolTCP {
+				return item
+			}
+			if target == nil {
+				target = item
+			}
+		}
+	}
+	return target
+}
+
+// getExpectedHealthProbeForPort returns the health probe used by the load balancing rule of the port.
+func (az *Cloud) getExpectedHealthProbeForPort(service *v1.Service, port v1.ServicePort, lbRuleName string, nodeEndpointHealthprobe *network.Probe) (*network.Probe, error) {
+	if nodeEndpointHealthprobe != nil {
+		return nodeEndpointHealthprobe, nil
+	}
+
+	// The pods are probed directly when they are in the backend pool.
+	if consts.IsHealthProbeUsingKubeProxyOnK8sServicePort(service.Annotations, port.Port) && !az.isLBBackendPoolTypePodIP() {
+		return &network.Probe{
+			Name: pointer.String(az.getLoadBalancerRuleName(service, v1.ProtocolTCP, consts.KubeProxyHealthCheckPort)),
+			ProbePropertiesFormat: &network.ProbePropertiesFormat{
+				RequestPath:       pointer.String(consts.KubeProxyHealthCheckRequestPath),
+				Protocol:          network.ProbeProtocolHTTP,
+				Port:              pointer.Int32(consts.KubeProxyHealthCheckPort),
+				IntervalInSeconds: pointer.Int32(consts.HealthProbeDefaultProbeInterval),
+				NumberOfProbes:    pointer.Int32(consts.HealthProbeDefaultNumOfProbe),
+			},
+		}, nil
+	}
+
+	sharedPortName, err := consts.GetHealthProbeConfigOfPortFromK8sSvcAnnotation(service.Annotations, port.Port, consts.HealthProbeParamsShareWith)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse annotation %s: %w", consts.BuildHealthProbeAnnotationKeyForPort(port.Port, consts.HealthProbeParamsShareWith), err)
+	}
+	if sharedPortName == nil {
+		return az.buildHealthProbeRulesForPort(service, port, lbRuleName)
+	}
+
+	sharedPort := findHealthProbeTargetPort(service, *sharedPortName)
+	if sharedPort == nil {
+		return nil, fmt.Errorf("port %s sharing its health probe with port %d not found in service", *sharedPortName, port.Port)
+	}
+	probe, err := az.buildHealthProbeRulesForPort(service, *sharedPort, az.getLoadBalancerRuleName(service, sharedPort.Protocol, sharedPort.Port))
+	if err != nil {
+		return nil, err
+	}
+	if probe == nil {
+		return nil, fmt.Errorf("port %s sharing its health probe with port %d has no health probe", *sharedPortName, port.Port)
+	}
+	return probe, nil
+}
+
+// appendProbe appends the probe unless the one with the same name has been appended.
+func appendProbe(probes []network.Probe, probe network.Probe) []network.Probe {
+	for _, existingProbe := range probes {
+		if strings.EqualFold(pointer.StringDeref(existingProbe.Name, ""), pointer.StringDeref(probe.Name, "")) {
+			return probes
+		}
+	}
+	return append(probes, probe)
+}
+
 // buildLBRules
 // for following sku: basic loadbalancer vs standard load balancer
 // for following scenario: internal vs external
@@ -2282,8 +2659,9 @@ func (az *Cloud) getExpectedLBRules(
 	// take precedence over user defined probe configuration
 	// healthcheck proxy server serves http requests
 	// https://github.com/kubernetes/kubernetes/blob/7c013c3f64db33cf19f38bb2fc8d9182e42b0b7b/pkg/proxy/healthcheck/service_health.go#L236
+	// The pods are probed directly when they are in the backend pool.
 	var nodeEndpointHealthprobe *network.Probe
-	if servicehelpers.NeedsHealthCheck(service) {
+	if servicehelpers.NeedsHealthCheck(service) && !az.isLBBackendPoolTypePodIP() {
 		podPresencePath, podPresencePort := servicehelpers.GetServiceHealthCheckPathPort(service)
 		lbRuleName := az.getLoadBalancerRuleName(service, v1.ProtocolTCP, podPresencePort)
 
@@ -2378,27 +2756,21 @@ func (az *Cloud) getExpectedLBRules(
 					"rule-name", lbRuleName, "port", port.Port)
 			}
 			if !isNoHealthProbeRule {
-				if nodeEndpointHealthprobe == nil {
-					portprobe, err := az.buildHealthProbeRulesForPort(service, port, lbRuleName)
-					if err != nil {
-						klog.V(2).ErrorS(err, "error occurred when buildHealthProbeRulesForPort", "service", service.Name, "namespace", service.Namespace,
-							"rule-name", lbRuleName, "port", port.Port)
-						return expectedProbes, expectedRules, err
-					}
-					if portprobe != nil {
-						props.Probe = &network.SubResource{
-							ID: pointer.String(az.getLoadBalancerProbeID(lbName, az.getLoadBalancerResourceGroup(), *portprobe.Name)),
-						}
-						expectedProbes = append(expectedProbes, *portprobe)
-					}
-				} else {
+				portprobe, err := az.getExpectedHealthProbeForPort(service, port, lbRuleName, nodeEndpointHealthprobe)
+				if err != nil {
+					klog.V(2).ErrorS(err, "error occurred when getExpectedHealthProbeForPort", "service", service.Name, "namespace", service.Namespace,
+						"rule-name", lbRuleName, "port", port.Port)
+					return expectedProbes, expectedRules, err
+				}
+				if portprobe != nil {
 					props.Probe = &network.SubResource{
-						ID: pointer.String(az.getLoadBalancerProbeID(lbName, az.getLoadBalancerResourceGroup(), *nodeEndpointHealthprobe.Name)),
+						ID: pointer.String(az.getLoadBalancerProbeID(lbName, az.getLoadBalancerResourceGroup(), *portprobe.Name)),
 					}
+					expectedProbes = appendProbe(expectedProbes, *portprobe)
 				}
 			}
 			if consts.IsK8sServiceDisableLoadBalancerFloatingIP(service) {
-				props.BackendPort = pointer.Int32(port.NodePort)
+				props.BackendPort = pointer.Int32(az.getServiceBackendPort(service, port))
 				props.EnableFloatingIP = pointer.Bool(false)
 			}
 			expectedRules = append(expectedRules, network.LoadBalancingRule{
@@ -2461,7 +2833,12 @@ func (az *Cloud) getExpectedLoadBalancingRulePropertiesForPort(
 	// Azure ILB does not support secondary IPs as floating IPs on the LB. Therefore, floating IP needs to be turned
 	// off and the rule should point to the nodeIP:nodePort.
 	if consts.IsK8sServiceInternalIPv6(service) {
-		props.BackendPort = pointer.Int32(servicePort.NodePort)
+		props.BackendPort = pointer.Int32(az.getServiceBackendPort(service, servicePort))
+		props.EnableFloatingIP = pointer.Bool(false)
+	}
+	// The pod IPs are not the frontend IPs, so the rule should point to the podIP:targetPort.
+	if az.isLBBackendPoolTypePodIP() {
+		props.BackendPort = pointer.Int32(az.getServiceBackendPort(service, servicePort))
 		props.EnableFloatingIP = pointer.Bool(false)
 	}
 	return props, nil
@@ -2513,7 +2890,7 @@ func (az *Cloud) reconcileSecurityGroup(clusterName string, service *v1.Service,
 	}
 
 	disableFloatingIP := false
-	if consts.IsK8sServiceDisableLoadBalancerFloatingIP(service) {
+	if consts.IsK8sServiceDisableLoadBalancerFloatingIP(service) || az.isLBBackendPoolTypePodIP() {
 		disableFloatingIP = true
 	}
 
@@ -2542,60 +2919,121 @@ func (az *Cloud) reconcileSecurityGroup(clusterName string, service *v1.Service,
 	if destinationIPAddress != "*" {
 		destinationIPAddresses = append(destinationIPAddresses, additionalIPs...)
 	}
+	if wantLb && destinationIPAddress != "*" && consts.IsK8sServiceUsingZonalFrontends(service) {
+		lb, exist, err := az.getAzureLoadBalancer(pointer.StringDeref(lbName, ""), azcache.CacheReadTypeDefault)
+		if err != nil {
+			return nil, err
+		}
+		if exist {
+			destinationIPAddresses = append(destinationIPAddresses, az.getZonalFrontendIPs(service, lb)...)
+		}
+	}
 
-	sourceRanges, err := servicehelpers.GetLoadBalancerSourceRanges(service)
+	sourceRanges, sourceAddressPrefixes, err := getServiceSourceAddressPrefixes(service)
 	if err != nil {
 		return nil, err
 	}
-	serviceTags := getServiceTags(service)
-	if len(serviceTags) != 0 {
-		delete(sourceRanges, consts.DefaultLoadBalancerSourceRanges)
-	}
-
-	var sourceAddressPrefixes []string
-	if (sourceRanges == nil || servicehelpers.IsAllowAll(sourceRanges)) && len(serviceTags) == 0 {
-		if !requiresInternalLoadBalancer(service) || len(service.Spec.LoadBalancerSourceRanges) > 0 {
-			sourceAddressPrefixes = []string{"Internet"}
-		}
-	} else {
-		for _, ip := range sourceRanges {
-			sourceAddressPrefixes = append(sourceAddressPrefixes, ip.String())
-		}
-		sourceAddressPrefixes = append(sourceAddressPrefixes, serviceTags...)
-	}
 
 	expectedSecurityRules, err := az.getExpectedSecurityRules(wantLb, ports, sourceAddressPrefixes, service, destinationIPAddresses, sourceRanges, backendIPAddresses, disableFloatingIP)
 	if err != nil {
 		return nil, err
 	}
+	if wantLb && az.usesApplicationSecurityGroup(service) {
+		useApplicationSecurityGroupDestination(expectedSecurityRules, backendIPAddresses, az.getApplicationSecurityGroupID(getApplicationSecurityGroupName(pointer.StringDeref(lbName, ""))))
+	}
+
+	// the rules of the service are packed together with the rules of the other services in consolidation mode.
+	var consolidatedRules []network.SecurityRule
+	useConsolidation := az.EnableSecurityRuleConsolidation && isSecurityRuleConsolidationCandidate(service)
+	if useConsolidation {
+		consolidatedRules, err = az.getConsolidatedSecurityRules(service, wantLb, expectedSecurityRules)
+		if err != nil {
+			return nil, err
+		}
+		expectedSecurityRules = []network.SecurityRule{}
+	}
 
 	// update security rules
-	dirtySg, updatedRules, err := az.reconcileSecurityRules(sg, service, serviceName, wantLb, expectedSecurityRules, ports, sourceAddressPrefixes, destinationIPAddresses)
+	manifest := az.getSecurityGroupOwnershipManifest(&sg)
+	dirtySg, updatedRules, err := az.reconcileSecurityRules(sg, service, serviceName, wantLb, expectedSecurityRules, ports, sourceAddressPrefixes, destinationIPAddresses, manifest)
 	if err != nil {
 		return nil, err
 	}
 
-	changed := az.ensureSecurityGroupTagged(&sg)
+	var changed bool
+	if useConsolidation {
+		updatedRules, changed, err = reconcileConsolidatedSecurityRules(updatedRules, consolidatedRules)
+		if err != nil {
+			return nil, err
+		}
+	} else if !az.EnableSecurityRuleConsolidation && destinationIPAddress != "*" {
+		updatedRules, changed = removeIPsFromConsolidatedSecurityRules(updatedRules, destinationIPAddresses)
+	}
+	if changed {
+		dirtySg = true
+	}
+
+	changed = az.ensureSecurityGroupTagged(&sg, manifest)
 	if changed {
 		dirtySg = true
 	}
 
+	ruleLimit := az.getSecurityGroupRuleLimit()
+	var existingRuleCount int
+	if sg.SecurityGroupPropertiesFormat != nil && sg.SecurityRules != nil {
+		existingRuleCount = len(*sg.SecurityRules)
+	}
+	if dirtySg && len(updatedRules) > ruleLimit && len(updatedRules) > existingRuleCount {
+		err := fmt.Errorf("reconcileSecurityGroup for service(%s): sg(%s) - refusing to update the security group with %d rules, which exceeds the limit of %d rules", serviceName, pointer.StringDeref(sg.Name, ""), len(updatedRules), ruleLimit)
+		klog.Error(err)
+		az.Event(service, v1.EventTypeWarning, "SecurityGroupRuleLimitExceeded", err.Error())
+		metrics.ObserveSecurityGroupRules(az.SecurityGroupResourceGroup, pointer.StringDeref(sg.Name, ""), existingRuleCount, ruleLimit)
+		return nil, err
+	}
+
 	if dirtySg {
 		sg.SecurityRules = &updatedRules
 		klog.V(2).Infof("reconcileSecurityGroup for service(%s): sg(%s) - updating", serviceName, *sg.Name)
 		klog.V(10).Infof("CreateOrUpdateSecurityGroup(%q): start", *sg.Name)
-		err := az.CreateOrUpdateSecurityGroup(sg)
+		err := az.CreateOrUpdateSecurityGroup(service, sg)
 		if err != nil {
 			klog.V(2).Infof("ensure(%s) abort backoff: sg(%s) - updating", serviceName, *sg.Name)
 			return nil, err
 		}
 		klog.V(10).Infof("CreateOrUpdateSecurityGroup(%q): end", *sg.Name)
 		_ = az.nsgCache.Delete(pointer.StringDeref(sg.Name, ""))
+		existingRuleCount = len(updatedRules)
 	}
+	metrics.ObserveSecurityGroupRules(az.SecurityGroupResourceGroup, pointer.StringDeref(sg.Name, ""), existingRuleCount, ruleLimit)
 	return &sg, nil
 }
 
-func (az *Cloud) reconcileSecurityRules(sg network.SecurityGroup, service *v1.Service, serviceName string, wantLb bool, expectedSecurityRules []network.SecurityRule, ports []v1.ServicePort, sourceAddressPrefixes []string, destinationIPAddresses []string) (bool, []network.SecurityRule, error) {
+// getServiceSourceAddressPrefixes returns the source ranges and the source address prefixes of the security rules of the service.
+func getServiceSourceAddressPrefixes(service *v1.Service) (utilnet.IPNetSet, []string, error) {
+	sourceRanges, err := servicehelpers.GetLoadBalancerSourceRanges(service)
+	if err != nil {
+		return nil, nil, err
+	}
+	serviceTags := getServiceTags(service)
+	if len(serviceTags) != 0 {
+		delete(sourceRanges, consts.DefaultLoadBalancerSourceRanges)
+	}
+
+	var sourceAddressPrefixes []string
+	if (sourceRanges == nil || servicehelpers.IsAllowAll(sourceRanges)) && len(serviceTags) == 0 {
+		if !requiresInternalLoadBalancer(service) || len(service.Spec.LoadBalancerSourceRanges) > 0 {
+			sourceAddressPrefixes = []string{"Internet"}
+		}
+	} else {
+		for _, ip := range sourceRanges {
+			sourceAddressPrefixes = append(sourceAddressPrefixes, ip.String())
+		}
+		sourceAddressPrefixes = append(sourceAddressPrefixes, serviceTags...)
+	}
+	return sourceRanges, sourceAddressPrefixes, nil
+}
+
+func (az *Cloud) reconcileSecurityRules(sg network.SecurityGroup, service *v1.Service, serviceName string, wantLb bool, expectedSecurityRules []network.SecurityRule, ports []v1.ServicePort, sourceAddressPrefixes []string, destinationIPAddresses []string, manifest *ownershipManifest) (bool, []network.SecurityRule, error) {
 	dirtySg := false
 	var updatedRules []network.SecurityRule
 	if sg.SecurityGroupPropertiesFormat != nil && sg.SecurityGroupPropertiesFormat.SecurityRules != nil {
@@ -2610,7 +3048,7 @@ func (az *Cloud) reconcileSecurityRules(sg network.SecurityGroup, service *v1.Se
 	// to this service
 	for i := len(updatedRules) - 1; i >= 0; i-- {
 		existingRule := updatedRules[i]
-		if az.serviceOwnsRule(service, *existingRule.Name) {
+		if az.serviceOwnsRule(service, *existingRule.Name) && manifest.ownsOrSkip(ownedKindSecurityRule, *existingRule.Name) {
 			klog.V(10).Infof("reconcile(%s)(%t): sg rule(%s) - considering evicting", serviceName, wantLb, *existingRule.Name)
 			keepRule := false
 			if findSecurityRule(expectedSecurityRules, existingRule) {
@@ -2620,6 +3058,7 @@ func (az *Cloud) reconcileSecurityRules(sg network.SecurityGroup, service *v1.Se
 			if !keepRule {
 				klog.V(10).Infof("reconcile(%s)(%t): sg rule(%s) - dropping", serviceName, wantLb, *existingRule.Name)
 				updatedRules = append(updatedRules[:i], updatedRules[i+1:]...)
+				manifest.remove(ownedKindSecurityRule, *existingRule.Name)
 				dirtySg = true
 			}
 		}
@@ -2684,6 +3123,12 @@ func (az *Cloud) reconcileSecurityRules(sg network.SecurityGroup, service *v1.Se
 			updatedRules[index] = consolidate(updatedRules[index], expectedRule)
 			dirtySg = true
 		}
+		if !foundRule && !manifest.owns(ownedKindSecurityRule, *expectedRule.Name) && !useSharedSecurityRule(service) {
+			if _, _, found := findSecurityRuleByName(updatedRules, *expectedRule.Name); found {
+				az.reportOwnershipConflict(service, ownedKindSecurityRule, *expectedRule.Name)
+				continue
+			}
+		}
 		if !foundRule {
 			klog.V(10).Infof("reconcile(%s)(%t): sg rule(%s) - adding", serviceName, wantLb, *expectedRule.Name)
 
@@ -2694,6 +3139,9 @@ func (az *Cloud) reconcileSecurityRules(sg network.SecurityGroup, service *v1.Se
 
 			expectedRule.Priority = pointer.Int32(nextAvailablePriority)
 			updatedRules = append(updatedRules, expectedRule)
+			if !useSharedSecurityRule(service) {
+				manifest.add(ownedKindSecurityRule, *expectedRule.Name)
+			}
 			dirtySg = true
 		}
 	}
@@ -2719,7 +3167,7 @@ func (az *Cloud) getExpectedSecurityRules(wantLb bool, ports []v1.ServicePort, s
 			}
 			dstPort := port.Port
 			if disableFloatingIP {
-				dstPort = port.NodePort
+				dstPort = az.getServiceBackendPort(service, port)
 			}
 			for j := range sourceAddressPrefixes {
 				ix := i*len(sourceAddressPrefixes) + j
@@ -2790,6 +3238,14 @@ func (az *Cloud) getExpectedSecurityRules(wantLb bool, ports []v1.ServicePort, s
 }
 
 func (az *Cloud) shouldUpdateLoadBalancer(clusterName string, service *v1.Service, nodes []*v1.Node) (bool, error) {
+	if consts.IsK8sServiceUsingApplicationGateway(service) {
+		_, existsGateway, err := az.getServiceApplicationGateway(clusterName, service)
+		if err != nil {
+			return false, fmt.Errorf("shouldUpdateLoadBalancer: failed to get application gateway: %w", err)
+		}
+		return existsGateway && service.ObjectMeta.DeletionTimestamp == nil && service.Spec.Type == v1.ServiceTypeLoadBalancer, nil
+	}
+
 	existingManagedLBs, err := az.ListManagedLBs(service, nodes, clusterName)
 	if err != nil {
 		return false, fmt.Errorf("shouldUpdateLoadBalancer: failed to list managed load balancers: %w", err)
@@ -3031,6 +3487,9 @@ func (az *Cloud) reconcilePublicIP(clusterName string, service *v1.Service, lbNa
 	)
 
 	pipResourceGroup := az.getPublicIPAddressResourceGroup(service)
+	if err := az.releaseStalePoolPublicIPs(service, pipResourceGroup); err != nil {
+		return nil, err
+	}
 
 	pips, err := az.listPIP(pipResourceGroup)
 	if err != nil {
@@ -3072,9 +3531,11 @@ func (az *Cloud) reconcilePublicIP(clusterName string, service *v1.Service, lbNa
 
 	for _, pip := range pipsToBeDeleted {
 		pipCopy := *pip
+		// A public IP recreated with the same name, e.g. for the changed IP tags, can not be retained.
+		retain := consts.IsK8sServicePIPRetainedOnDelete(service) && !strings.EqualFold(*pip.Name, desiredPipName)
 		deleteFuncs = append(deleteFuncs, func() error {
 			klog.V(2).Infof("reconcilePublicIP for service(%s): pip(%s) - deleting", serviceName, *pip.Name)
-			return az.safeDeletePublicIP(service, pipResourceGroup, &pipCopy, lb)
+			return az.safeDeletePublicIP(service, pipResourceGroup, &pipCopy, lb, retain)
 		})
 	}
 	errs = utilerrors.AggregateGoroutines(deleteFuncs...)
@@ -3117,6 +3578,11 @@ func (az *Cloud) getPublicIPUpdates(
 		pip := pips[i]
 		pipName := *pip.Name
 
+		// The public IPs of the global load balancers are reconciled by reconcileGlobalLoadBalancer.
+		if isGlobalPublicIP(&pip) {
+			continue
+		}
+
 		// If we've been told to use a specific public ip by the client, let's track whether or not it actually existed
 		// when we inspect the set in Azure.
 		discoveredDesiredPublicIP = discoveredDesiredPublicIP || wantLb && !isInternal && pipName == desiredPipName
@@ -3168,7 +3634,8 @@ func (az *Cloud) getPublicIPUpdates(
 }
 
 // safeDeletePublicIP deletes public IP by removing its reference first.
-func (az *Cloud) safeDeletePublicIP(service *v1.Service, pipResourceGroup string, pip *network.PublicIPAddress, lb *network.LoadBalancer) error {
+// If retain is true, the public IP is released from the service instead of being deleted.
+func (az *Cloud) safeDeletePublicIP(service *v1.Service, pipResourceGroup string, pip *network.PublicIPAddress, lb *network.LoadBalancer, retain bool) error {
 	// Remove references if pip.IPConfiguration is not nil.
 	if pip.PublicIPAddressPropertiesFormat != nil &&
 		pip.PublicIPAddressPropertiesFormat.IPConfiguration != nil &&
@@ -3234,6 +3701,13 @@ func (az *Cloud) safeDeletePublicIP(service *v1.Service, pipResourceGroup string
 		}
 	}
 
+	if az.isPublicIPInPool(pipResourceGroup, pip) {
+		return az.releasePublicIPToPool(service, pipResourceGroup, pip)
+	}
+	if retain {
+		return az.retainPublicIP(service, pipResourceGroup, pip)
+	}
+
 	pipName := pointer.StringDeref(pip.Name, "")
 	klog.V(10).Infof("DeletePublicIP(%s, %q): start", pipResourceGroup, pipName)
 	err := az.DeletePublicIP(service, pipResourceGroup, pipName)
@@ -3311,7 +3785,7 @@ func equalSubResource(s *network.SubResource, t *network.SubResource) bool {
 }
 
 // This compares rule's Name, Protocol, SourcePortRange, DestinationPortRange, SourceAddressPrefix, Access, and Direction.
-// Note that it compares rule's DestinationAddressPrefix only when it's not consolidated rule as such rule does not have DestinationAddressPrefix defined.
+// Note that it compares rule's DestinationAddressPrefix and DestinationApplicationSecurityGroups only when it's not consolidated rule as such rule does not have DestinationAddressPrefix defined.
 // We intentionally do not compare DestinationAddressPrefixes in consolidated case because reconcileSecurityRule has to consider the two rules equal,
 // despite different DestinationAddressPrefixes, in order to give it a chance to consolidate the two rules.
 func findSecurityRule(rules []network.SecurityRule, rule network.SecurityRule) bool {
@@ -3338,6 +3812,9 @@ func findSecurityRule(rules []network.SecurityRule, rule network.SecurityRule) b
 			if !slices.Equal(stringSlice(existingRule.DestinationAddressPrefixes), stringSlice(rule.DestinationAddressPrefixes)) {
 				continue
 			}
+			if !slices.Equal(getDestinationApplicationSecurityGroupIDs(existingRule), getDestinationApplicationSecurityGroupIDs(rule)) {
+				continue
+			}
 		}
 		if !strings.EqualFold(string(existingRule.Access), string(rule.Access)) {
 			continue
@@ -3358,6 +3835,9 @@ func (az *Cloud) getPublicIPAddressResourceGroup(service *v1.Service) string {
 		}
 	}
 
+	if az.shouldLeasePublicIPFromPool(service) && az.PublicIPPool.ResourceGroup != "" {
+		return az.PublicIPPool.ResourceGroup
+	}
 	return az.ResourceGroup
 }
 
@@ -3506,7 +3986,9 @@ func serviceOwnsPublicIP(service *v1.Service, pip *network.PublicIPAddress, clus
 			}
 
 			// If cluster name tag is set, then return true if it matches.
-			if clusterTag == clusterName {
+			// The public IPs of the global load balancers are shared by several clusters,
+			// whose names are all kept in the cluster name tag.
+			if isClusterNameInPIPTag(clusterTag, clusterName) {
 				return true, false
 			}
 		} else {
@@ -3531,6 +4013,16 @@ func isSVCNameInPIPTag(tag, svcName string) bool {
 	return false
 }
 
+func isClusterNameInPIPTag(tag, clusterName string) bool {
+	for _, name := range parsePIPServiceTag(&tag) {
+		if strings.EqualFold(name, clusterName) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func parsePIPServiceTag(serviceTag *string) []string {
 	if serviceTag == nil || len(*serviceTag) == 0 {
 		return []string{}
@@ -3562,42 +4054,64 @@ func bindServicesToPIP(pip *network.PublicIPAddress, incomingServiceNames []stri
 		pip.Tags = map[string]*string{consts.ServiceTagKey: pointer.String("")}
 	}
 
-	serviceTagValue := pointer.String(getServiceFromPIPServiceTags(pip.Tags))
-	serviceTagValueSet := make(map[string]struct{})
-	existingServiceNames := parsePIPServiceTag(serviceTagValue)
+	return bindNamesToPIPTag(pip, consts.ServiceTagKey, getServiceFromPIPServiceTags(pip.Tags), incomingServiceNames, replace), nil
+}
+
+// bindClustersToPIP add the incoming cluster names to the PIP's cluster name tag. It is used
+// by the public IPs of the global load balancers, which are shared by several clusters.
+// example:
+// "cluster1" + ["cluster2"] = "cluster1,cluster2"
+func bindClustersToPIP(pip *network.PublicIPAddress, incomingClusterNames []string, replace bool) (bool, error) {
+	if pip == nil {
+		return false, fmt.Errorf("nil public IP")
+	}
+
+	if pip.Tags == nil {
+		pip.Tags = map[string]*string{consts.ClusterNameKey: pointer.String("")}
+	}
+
+	return bindNamesToPIPTag(pip, consts.ClusterNameKey, getClusterFromPIPClusterTags(pip.Tags), incomingClusterNames, replace), nil
+}
+
+// bindNamesToPIPTag adds the incoming names to the comma separated names in the tag.
+// The existing value is passed in because the tag may be read from its legacy key.
+func bindNamesToPIPTag(pip *network.PublicIPAddress, tagKey, existingValue string, incomingNames []string, replace bool) bool {
+	tagValue := pointer.String(existingValue)
+	tagValueSet := make(map[string]struct{})
+	existingNames := parsePIPServiceTag(tagValue)
 	addedNew := false
 
 	// replace is used when unbinding the service from PIP so addedNew remains false all the time
 	if replace {
-		serviceTagValue = pointer.String(strings.Join(incomingServiceNames, ","))
-		pip.Tags[consts.ServiceTagKey] = serviceTagValue
+		tagValue = pointer.String(strings.Join(incomingNames, ","))
+		pip.Tags[tagKey] = tagValue
 
-		return false, nil
+		return false
 	}
 
-	for _, name := range existingServiceNames {
-		if _, ok := serviceTagValueSet[name]; !ok {
-			serviceTagValueSet[name] = struct{}{}
+	for _, name := range existingNames {
+		if _, ok := tagValueSet[name]; !ok {
+			tagValueSet[name] = struct{}{}
 		}
 	}
 
-	for _, serviceName := range incomingServiceNames {
-		if serviceTagValue == nil || *serviceTagValue == "" {
-			serviceTagValue = pointer.String(serviceName)
+	for _, name := range incomingNames {
+		if tagValue == nil || *tagValue == "" {
+			tagValue = pointer.String(name)
 			addedNew = true
 		} else {
 			// detect duplicates
-			if _, ok := serviceTagValueSet[serviceName]; !ok {
-				*serviceTagValue += fmt.Sprintf(",%s", serviceName)
+			if _, ok := tagValueSet[name]; !ok {
+				*tagValue += fmt.Sprintf(",%s", name)
 				addedNew = true
 			} else {
-				klog.V(10).Infof("service %s has been bound to the pip already", serviceName)
+				klog.V(10).Infof("%s has been bound to the pip already", name)
 			}
 		}
 	}
-	pip.Tags[consts.ServiceTagKey] = serviceTagValue
+	pip.Tags[tagKey] = tagValue
 
-	return addedNew, nil
+	return addedNew
 }
 
 func unbindServiceFromPIP(pip *network.PublicIPAddress, service *v1.Service,
@@ -3632,36 +4146,67 @@ func unbindServiceFromPIP(pip *network.PublicIPAddress, service *v1.Service,
 	return err
 }
 
-// ensureLoadBalancerTagged ensures every load balancer in the resource group is tagged as configured
-func (az *Cloud) ensureLoadBalancerTagged(lb *network.LoadBalancer) bool {
+// unbindClusterFromPIP removes the cluster from the cluster name tag of a shared public IP.
+// It returns true if no cluster is using the public IP anymore.
+func unbindClusterFromPIP(pip *network.PublicIPAddress, clusterName string) (bool, error) {
+	if pip == nil || pip.Tags == nil {
+		return false, fmt.Errorf("nil public IP or tags")
+	}
+
+	clusterTagValue := getClusterFromPIPClusterTags(pip.Tags)
+	existingClusterNames := parsePIPServiceTag(&clusterTagValue)
+	for i := len(existingClusterNames) - 1; i >= 0; i-- {
+		if strings.EqualFold(existingClusterNames[i], clusterName) {
+			existingClusterNames = append(existingClusterNames[:i], existingClusterNames[i+1:]...)
+		}
+	}
+
+	_, err := bindClustersToPIP(pip, existingClusterNames, true)
+	return len(existingClusterNames) == 0, err
+}
+
+// ensureLoadBalancerTagged ensures every load balancer in the resource group is tagged as configured,
+// and records the ownership manifest of the load balancer if it is enabled.
+func (az *Cloud) ensureLoadBalancerTagged(lb *network.LoadBalancer, manifest *ownershipManifest) bool {
 	if az.Tags == "" && (az.TagsMap == nil || len(az.TagsMap) == 0) {
-		return false
+		return manifest.save(&lb.Tags)
 	}
 	tags := parseTags(az.Tags, az.TagsMap)
 	if lb.Tags == nil {
 		lb.Tags = make(map[string]*string)
 	}
 
-	tags, changed := az.reconcileTags(lb.Tags, tags)
+	var changed bool
+	if manifest != nil {
+		tags, changed = az.reconcileOwnedTags(lb.Tags, tags, manifest)
+	} else {
+		tags, changed = az.reconcileTags(lb.Tags, tags)
+	}
 	lb.Tags = tags
 
-	return changed
+	return manifest.save(&lb.Tags) || changed
 }
 
-// ensureSecurityGroupTagged ensures the security group is tagged as configured
-func (az *Cloud) ensureSecurityGroupTagged(sg *network.SecurityGroup) bool {
+// ensureSecurityGroupTagged ensures the security group is tagged as configured,
+// and records the ownership manifest of the security group if it is enabled.
+func (az *Cloud) ensureSecurityGroupTagged(sg *network.SecurityGroup, manifest *ownershipManifest) bool {
 	if az.Tags == "" && (az.TagsMap == nil || len(az.TagsMap) == 0) {
-		return false
+		return manifest.save(&sg.Tags)
 	}
 	tags := parseTags(az.Tags, az.TagsMap)
 	if sg.Tags == nil {
 		sg.Tags = make(map[string]*string)
 	}
 
-	tags, changed := az.reconcileTags(sg.Tags, tags)
+	var changed bool
+	if manifest != nil {
+		tags, changed = az.reconcileOwnedTags(sg.Tags, tags, manifest)
+	} else {
+		tags, changed = az.reconcileTags(sg.Tags, tags)
+	}
 	sg.Tags = tags
 
-	return changed
+	return manifest.save(&sg.Tags) || changed
 }
 
 // stringSlice returns a string slice value for the passed string slice pointer. It returns a nil
@@ -26,7 +26,13 @@ import (
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
 
 	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/workqueue"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
 	utilnet "k8s.io/utils/net"
@@ -120,7 +126,7 @@ func (bc *backendPoolTypeNodeIPConfig) CleanupVMSetFromBackendPoolByCondition(sl
 			},
 		}
 		// decouple the backendPool from the node
-		shouldRefreshLB, err := bc.VMSet.EnsureBackendPoolDeleted(service, lbBackendPoolID, vmSetName, backendpoolToBeDeleted, true)
+		shouldRefreshLB, err := bc.ensureBackendPoolDeletedFromVMSet(service, lbBackendPoolID, vmSetName, backendpoolToBeDeleted, true)
 		if err != nil {
 			return nil, err
 		}
@@ -148,7 +154,7 @@ func (bc *backendPoolTypeNodeIPConfig) ReconcileBackendPools(clusterName string,
 	serviceName := getServiceName(service)
 	lbBackendPoolName := getBackendPoolName(clusterName, service)
 	lbBackendPoolID := bc.getBackendPoolID(lbName, bc.getLoadBalancerResourceGroup(), lbBackendPoolName)
-	vmSetName := bc.mapLoadBalancerNameToVMSet(lbName, clusterName)
+	vmSetName := bc.getLoadBalancerVMSetName(lbName, clusterName)
 	isBackendPoolPreConfigured := bc.isBackendPoolPreConfigured(service)
 
 	mc := metrics.NewMetricContext("services", "migrate_to_nic_based_backend_pool", bc.ResourceGroup, bc.getNetworkResourceSubscriptionID(), serviceName)
@@ -173,7 +179,7 @@ func (bc *backendPoolTypeNodeIPConfig) ReconcileBackendPools(clusterName string,
 				if removeNodeIPAddressesFromBackendPool(bp, []string{}, true) {
 					isMigration = true
 					bp.VirtualNetwork = nil
-					if err := bc.CreateOrUpdateLBBackendPool(lbName, bp); err != nil {
+					if err := bc.CreateOrUpdateLBBackendPool(service, lbName, bp); err != nil {
 						klog.Errorf("bc.ReconcileBackendPools for service (%s): failed to cleanup IP based backend pool %s: %s", serviceName, lbBackendPoolName, err.Error())
 						return false, false, fmt.Errorf("bc.ReconcileBackendPools for service (%s): failed to cleanup IP based backend pool %s: %w", serviceName, lbBackendPoolName, err)
 					}
@@ -206,7 +212,7 @@ func (bc *backendPoolTypeNodeIPConfig) ReconcileBackendPools(clusterName string,
 						klog.Errorf("bc.ReconcileBackendPools: ShouldNodeExcludedFromLoadBalancer(%s) failed with error: %v", nodeName, err)
 						return false, false, err
 					}
-					if shouldExcludeLoadBalancer {
+					if shouldExcludeLoadBalancer || !bc.isNodeNameSelectedByLoadBalancer(lbName, nodeName) {
 						klog.V(2).Infof("bc.ReconcileBackendPools for service (%s): lb backendpool - found unwanted node %s, decouple it from the LB %s", serviceName, nodeName, lbName)
 						// construct a backendPool that only contains the IP config of the node to be deleted
 						bipConfigExclude = append(bipConfigExclude, network.InterfaceIPConfiguration{ID: pointer.String(ipConfID)})
@@ -224,7 +230,7 @@ func (bc *backendPoolTypeNodeIPConfig) ReconcileBackendPools(clusterName string,
 					},
 				}
 				// decouple the backendPool from the node
-				updated, err := bc.VMSet.EnsureBackendPoolDeleted(service, lbBackendPoolID, vmSetName, backendpoolToBeDeleted, false)
+				updated, err := bc.ensureBackendPoolDeletedFromVMSet(service, lbBackendPoolID, vmSetName, backendpoolToBeDeleted, false)
 				if err != nil {
 					return false, false, err
 				}
@@ -352,11 +358,7 @@ func newBackendPoolTypeNodeIP(c *Cloud) BackendPool {
 }
 
 func (bi *backendPoolTypeNodeIP) EnsureHostsInPool(service *v1.Service, nodes []*v1.Node, backendPoolID, vmSetName, clusterName, lbName string, backendPool network.BackendAddressPool) error {
-	vnetResourceGroup := bi.ResourceGroup
-	if len(bi.VnetResourceGroup) > 0 {
-		vnetResourceGroup = bi.VnetResourceGroup
-	}
-	vnetID := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/virtualNetworks/%s", bi.SubscriptionID, vnetResourceGroup, bi.VnetName)
+	vnetID := bi.getVirtualNetworkID()
 
 	changed := false
 	numOfAdd := 0
@@ -390,7 +392,7 @@ func (bi *backendPoolTypeNodeIP) EnsureHostsInPool(service *v1.Service, nodes []
 			var err error
 			shouldSkip := false
 			useSingleSLB := strings.EqualFold(bi.LoadBalancerSku, consts.LoadBalancerSkuStandard) && !bi.EnableMultipleStandardLoadBalancers
-			if !useSingleSLB {
+			if !useSingleSLB && !bi.useLoadBalancerProfiles() {
 				vmSetName, err = bi.VMSet.GetNodeVMSetName(node)
 				if err != nil {
 					klog.Errorf("bi.EnsureHostsInPool: failed to get vmSet name by node name: %s", err.Error())
@@ -435,7 +437,7 @@ func (bi *backendPoolTypeNodeIP) EnsureHostsInPool(service *v1.Service, nodes []
 	}
 	if changed {
 		klog.V(2).Infof("bi.EnsureHostsInPool: updating backend pool %s of load balancer %s to add %d nodes", lbBackendPoolName, lbName, numOfAdd)
-		if err := bi.CreateOrUpdateLBBackendPool(lbName, backendPool); err != nil {
+		if err := bi.CreateOrUpdateLBBackendPool(service, lbName, backendPool); err != nil {
 			return fmt.Errorf("bi.EnsureHostsInPool: failed to update backend pool %s: %w", lbBackendPoolName, err)
 		}
 	}
@@ -488,7 +490,7 @@ func (bi *backendPoolTypeNodeIP) CleanupVMSetFromBackendPoolByCondition(slb *net
 
 		for _, backendAddressPool := range *slb.BackendAddressPools {
 			if strings.EqualFold(lbBackendPoolName, pointer.StringDeref(backendAddressPool.Name, "")) {
-				if err := bi.CreateOrUpdateLBBackendPool(pointer.StringDeref(slb.Name, ""), backendAddressPool); err != nil {
+				if err := bi.CreateOrUpdateLBBackendPool(service, pointer.StringDeref(slb.Name, ""), backendAddressPool); err != nil {
 					return nil, fmt.Errorf("bi.CleanupVMSetFromBackendPoolByCondition: failed to create or update backend pool %s: %w", lbBackendPoolName, err)
 				}
 			}
@@ -508,7 +510,7 @@ func (bi *backendPoolTypeNodeIP) ReconcileBackendPools(clusterName string, servi
 	lbName := *lb.Name
 	serviceName := getServiceName(service)
 	lbBackendPoolName := getBackendPoolName(clusterName, service)
-	vmSetName := bi.mapLoadBalancerNameToVMSet(lbName, clusterName)
+	vmSetName := bi.getLoadBalancerVMSetName(lbName, clusterName)
 	lbBackendPoolID := bi.getBackendPoolID(pointer.StringDeref(lb.Name, ""), bi.getLoadBalancerResourceGroup(), getBackendPoolName(clusterName, service))
 	isBackendPoolPreConfigured := bi.isBackendPoolPreConfigured(service)
 
@@ -530,7 +532,7 @@ func (bi *backendPoolTypeNodeIP) ReconcileBackendPools(clusterName string, servi
 			// to nodeIP, we need to decouple the VM NICs from the LB
 			// before attaching nodeIPs/podIPs to the LB backend pool.
 			klog.V(2).Infof("bi.ReconcileBackendPools for service (%s) and vmSet (%s): ensuring the LB is decoupled from the VMSet", serviceName, vmSetName)
-			shouldRefreshLB, err = bi.VMSet.EnsureBackendPoolDeleted(service, lbBackendPoolID, vmSetName, lb.BackendAddressPools, true)
+			shouldRefreshLB, err = bi.ensureBackendPoolDeletedFromVMSet(service, lbBackendPoolID, vmSetName, lb.BackendAddressPools, true)
 			if err != nil {
 				klog.Errorf("bi.ReconcileBackendPools for service (%s): failed to EnsureBackendPoolDeleted: %s", serviceName, err.Error())
 				return false, false, err
@@ -546,6 +548,20 @@ func (bi *backendPoolTypeNodeIP) ReconcileBackendPools(clusterName string, servi
 					nodeIPAddressesToBeDeleted = append(nodeIPAddressesToBeDeleted, ip)
 				}
 			}
+			// the nodes no longer selected by the profile of the LB
+			if bi.getLoadBalancerProfile(lbName) != nil {
+				bi.nodeCachesLock.RLock()
+				for nodeName, ips := range bi.nodePrivateIPs {
+					if bi.isNodeNameSelectedByLoadBalancer(lbName, nodeName) {
+						continue
+					}
+					for ip := range ips {
+						klog.V(2).Infof("bi.ReconcileBackendPools for service (%s): found node private IP %s not selected by the profile, decoupling it from the LB %s", serviceName, ip, lbName)
+						nodeIPAddressesToBeDeleted = append(nodeIPAddressesToBeDeleted, ip)
+					}
+				}
+				bi.nodeCachesLock.RUnlock()
+			}
 			if len(nodeIPAddressesToBeDeleted) > 0 {
 				if removeNodeIPAddressesFromBackendPool(bp, nodeIPAddressesToBeDeleted, false) {
 					updated = true
@@ -579,7 +595,7 @@ func (bi *backendPoolTypeNodeIP) ReconcileBackendPools(clusterName string, servi
 
 			if updated {
 				(*lb.BackendAddressPools)[i] = bp
-				if err := bi.CreateOrUpdateLBBackendPool(lbName, bp); err != nil {
+				if err := bi.CreateOrUpdateLBBackendPool(service, lbName, bp); err != nil {
 					return false, false, fmt.Errorf("bi.ReconcileBackendPools for service (%s): lb backendpool - failed to update backend pool %s for load balancer %s: %w", serviceName, lbBackendPoolName, lbName, err)
 				}
 				shouldRefreshLB = true
@@ -645,6 +661,315 @@ func (bi *backendPoolTypeNodeIP) GetBackendPrivateIPs(clusterName string, servic
 	return backendPrivateIPv4s.List(), backendPrivateIPv6s.List()
 }
 
+// podIPBackendPoolRef is the load balancer of a service whose pod IPs are in a backend pool.
+type podIPBackendPoolRef struct {
+	clusterName string
+	lbName      string
+}
+
+type backendPoolTypePodIP struct {
+	*Cloud
+
+	// serviceLoadBalancers records the load balancer of each service once its pod IPs have been ensured, so that
+	// the backend pool can follow the EndpointSlice changes. It is guarded by serviceReconcileLock.
+	serviceLoadBalancers map[types.NamespacedName]podIPBackendPoolRef
+	queue                workqueue.RateLimitingInterface
+}
+
+func newBackendPoolTypePodIP(c *Cloud) BackendPool {
+	return &backendPoolTypePodIP{
+		Cloud:                c,
+		serviceLoadBalancers: make(map[types.NamespacedName]podIPBackendPoolRef),
+		queue:                workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "podip-backend-pool"),
+	}
+}
+
+func (bp *backendPoolTypePodIP) EnsureHostsInPool(service *v1.Service, nodes []*v1.Node, backendPoolID, vmSetName, clusterName, lbName string, backendPool network.BackendAddressPool) error {
+	bp.serviceLoadBalancers[types.NamespacedName{Namespace: service.Namespace, Name: service.Name}] = podIPBackendPoolRef{
+		clusterName: clusterName,
+		lbName:      lbName,
+	}
+	_, err := bp.ensurePodIPsInPool(service, clusterName, lbName, backendPool)
+	return err
+}
+
+// ensurePodIPsInPool makes the addresses of the backend pool match the ready pod IPs of the service, and reports
+// whether the pool has been updated.
+func (bp *backendPoolTypePodIP) ensurePodIPsInPool(service *v1.Service, clusterName, lbName string, backendPool network.BackendAddressPool) (bool, error) {
+	serviceName := getServiceName(service)
+	lbBackendPoolName := bp.getServiceBackendPoolName(clusterName, service)
+	if !strings.EqualFold(pointer.StringDeref(backendPool.Name, ""), lbBackendPoolName) || backendPool.BackendAddressPoolPropertiesFormat == nil {
+		return false, nil
+	}
+
+	podIPs, err := bp.getServicePodIPs(service)
+	if err != nil {
+		return false, fmt.Errorf("bp.ensurePodIPsInPool for service (%s): %w", serviceName, err)
+	}
+
+	existingIPs := sets.NewString()
+	if backendPool.LoadBalancerBackendAddresses != nil {
+		for _, loadBalancerBackendAddress := range *backendPool.LoadBalancerBackendAddresses {
+			if loadBalancerBackendAddress.LoadBalancerBackendAddressPropertiesFormat != nil &&
+				loadBalancerBackendAddress.IPAddress != nil {
+				existingIPs.Insert(pointer.StringDeref(loadBalancerBackendAddress.IPAddress, ""))
+			}
+		}
+	}
+
+	vnetID := bp.getVirtualNetworkID()
+	wantedIPs := sets.StringKeySet(podIPs)
+	if existingIPs.Equal(wantedIPs) && backendPool.VirtualNetwork != nil &&
+		strings.EqualFold(pointer.StringDeref(backendPool.VirtualNetwork.ID, ""), vnetID) {
+		klog.V(4).Infof("bp.ensurePodIPsInPool for service (%s): the backend pool %s is up to date with %d pod IPs", serviceName, lbBackendPoolName, wantedIPs.Len())
+		return false, nil
+	}
+
+	addresses := make([]network.LoadBalancerBackendAddress, 0, wantedIPs.Len())
+	for _, ip := range wantedIPs.List() {
+		addresses = append(addresses, network.LoadBalancerBackendAddress{
+			Name: pointer.String(podIPs[ip]),
+			LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{
+				IPAddress: pointer.String(ip),
+			},
+		})
+	}
+	backendPool.VirtualNetwork = &network.SubResource{ID: pointer.String(vnetID)}
+	backendPool.LoadBalancerBackendAddresses = &addresses
+
+	klog.V(2).Infof("bp.ensurePodIPsInPool for service (%s): updating backend pool %s of load balancer %s, adding %d and removing %d pod IPs",
+		serviceName, lbBackendPoolName, lbName, wantedIPs.Difference(existingIPs).Len(), existingIPs.Difference(wantedIPs).Len())
+	if err := bp.CreateOrUpdateLBBackendPool(service, lbName, backendPool); err != nil {
+		return false, fmt.Errorf("bp.ensurePodIPsInPool: failed to update backend pool %s: %w", lbBackendPoolName, err)
+	}
+	return true, nil
+}
+
+// getServicePodIPs returns the ready pod IPs of the service in the EndpointSlices of its IP family, mapped to the
+// names of their pods.
+func (bp *backendPoolTypePodIP) getServicePodIPs(service *v1.Service) (map[string]string, error) {
+	if bp.endpointSliceLister == nil {
+		return nil, errors.New("the EndpointSlice informer is not set up")
+	}
+	endpointSlices, err := bp.endpointSliceLister.EndpointSlices(service.Namespace).List(labels.SelectorFromSet(labels.Set{
+		discoveryv1.LabelServiceName: service.Name,
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	addressType := discoveryv1.AddressTypeIPv4
+	if utilnet.IsIPv6String(service.Spec.ClusterIP) {
+		addressType = discoveryv1.AddressTypeIPv6
+	}
+
+	podIPs := make(map[string]string)
+	for _, endpointSlice := range endpointSlices {
+		if endpointSlice.AddressType != addressType {
+			continue
+		}
+		for _, endpoint := range endpointSlice.Endpoints {
+			// A nil ready condition means the endpoint is ready.
+			if !pointer.BoolDeref(endpoint.Conditions.Ready, true) {
+				continue
+			}
+			for _, address := range endpoint.Addresses {
+				name := address
+				if endpoint.TargetRef != nil && strings.EqualFold(endpoint.TargetRef.Kind, "Pod") {
+					name = endpoint.TargetRef.Name
+				}
+				podIPs[address] = name
+			}
+		}
+	}
+	return podIPs, nil
+}
+
+// CleanupVMSetFromBackendPoolByCondition does nothing because the pod IPs do not belong to a VMSet.
+func (bp *backendPoolTypePodIP) CleanupVMSetFromBackendPoolByCondition(slb *network.LoadBalancer, service *v1.Service, nodes []*v1.Node, clusterName string, shouldRemoveVMSetFromSLB func(string) bool) (*network.LoadBalancer, error) {
+	return slb, nil
+}
+
+// ReconcileBackendPools creates the backend pool of the service if it does not exist. The pod IPs are added by
+// EnsureHostsInPool, and the pool is removed together with the rules of the service.
+func (bp *backendPoolTypePodIP) ReconcileBackendPools(clusterName string, service *v1.Service, lb *network.LoadBalancer) (bool, bool, error) {
+	serviceName := getServiceName(service)
+	lbBackendPoolName := bp.getServiceBackendPoolName(clusterName, service)
+	if lb.BackendAddressPools != nil {
+		for _, backendPool := range *lb.BackendAddressPools {
+			if strings.EqualFold(pointer.StringDeref(backendPool.Name, ""), lbBackendPoolName) {
+				klog.V(10).Infof("bp.ReconcileBackendPools for service (%s): found wanted backendpool. not adding anything", serviceName)
+				return false, false, nil
+			}
+		}
+	}
+
+	_ = newBackendPool(lb, false, bp.PreConfiguredBackendPoolLoadBalancerTypes, serviceName, lbBackendPoolName)
+	return false, true, nil
+}
+
+func (bp *backendPoolTypePodIP) GetBackendPrivateIPs(clusterName string, service *v1.Service, lb *network.LoadBalancer) ([]string, []string) {
+	lbBackendPoolName := bp.getServiceBackendPoolName(clusterName, service)
+	if lb.LoadBalancerPropertiesFormat == nil || lb.LoadBalancerPropertiesFormat.BackendAddressPools == nil {
+		return nil, nil
+	}
+
+	backendPrivateIPv4s, backendPrivateIPv6s := sets.NewString(), sets.NewString()
+	for _, backendPool := range *lb.BackendAddressPools {
+		if !strings.EqualFold(pointer.StringDeref(backendPool.Name, ""), lbBackendPoolName) ||
+			backendPool.BackendAddressPoolPropertiesFormat == nil || backendPool.LoadBalancerBackendAddresses == nil {
+			continue
+		}
+		for _, backendAddress := range *backendPool.LoadBalancerBackendAddresses {
+			ipAddress := pointer.StringDeref(backendAddress.IPAddress, "")
+			if ipAddress == "" {
+				continue
+			}
+			if utilnet.IsIPv4String(ipAddress) {
+				backendPrivateIPv4s.Insert(ipAddress)
+			} else {
+				backendPrivateIPv6s.Insert(ipAddress)
+			}
+		}
+	}
+	return backendPrivateIPv4s.List(), backendPrivateIPv6s.List()
+}
+
+// enqueueEndpointSlice queues the service of the EndpointSlice to update its backend pool.
+func (bp *backendPoolTypePodIP) enqueueEndpointSlice(endpointSlice *discoveryv1.EndpointSlice) {
+	serviceName := endpointSlice.Labels[discoveryv1.LabelServiceName]
+	if serviceName == "" {
+		return
+	}
+	bp.queue.Add(types.NamespacedName{Namespace: endpointSlice.Namespace, Name: serviceName})
+}
+
+func (bp *backendPoolTypePodIP) runWorker() {
+	for bp.processNextService() {
+	}
+}
+
+func (bp *backendPoolTypePodIP) processNextService() bool {
+	key, quit := bp.queue.Get()
+	if quit {
+		return false
+	}
+	defer bp.queue.Done(key)
+
+	if err := bp.syncService(key.(types.NamespacedName)); err != nil {
+		klog.Errorf("bp.syncService(%s): failed to update the pod IPs, will retry: %v", key, err)
+		bp.queue.AddRateLimited(key)
+		return true
+	}
+	bp.queue.Forget(key)
+	return true
+}
+
+// syncService updates the backend pool of the service after its EndpointSlices change, and the security rules
+// allowing the traffic to the pod IPs. The services whose pod IPs have not been ensured by the service controller yet
+// are skipped.
+func (bp *backendPoolTypePodIP) syncService(key types.NamespacedName) error {
+	bp.serviceReconcileLock.Lock()
+	defer bp.serviceReconcileLock.Unlock()
+
+	ref, ok := bp.serviceLoadBalancers[key]
+	if !ok {
+		return nil
+	}
+
+	service, err := bp.serviceLister.Services(key.Namespace).Get(key.Name)
+	if apierrors.IsNotFound(err) || (err == nil && service.Spec.Type != v1.ServiceTypeLoadBalancer) {
+		delete(bp.serviceLoadBalancers, key)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	lb, exists, err := bp.getAzureLoadBalancer(ref.lbName, cache.CacheReadTypeDefault)
+	if err != nil {
+		return err
+	}
+	if !exists || lb.BackendAddressPools == nil {
+		delete(bp.serviceLoadBalancers, key)
+		return nil
+	}
+
+	lbBackendPoolName := bp.getServiceBackendPoolName(ref.clusterName, service)
+	for _, backendPool := range *lb.BackendAddressPools {
+		if !strings.EqualFold(pointer.StringDeref(backendPool.Name, ""), lbBackendPoolName) {
+			continue
+		}
+
+		updated, err := bp.ensurePodIPsInPool(service, ref.clusterName, ref.lbName, backendPool)
+		if err != nil || !updated {
+			return err
+		}
+		// Etag would be changed when updating backend pools, so invalidate lbCache after it.
+		_ = bp.lbCache.Delete(ref.lbName)
+
+		if len(service.Status.LoadBalancer.Ingress) == 0 {
+			return nil
+		}
+		serviceIP := service.Status.LoadBalancer.Ingress[0].IP
+		_, err = bp.reconcileSecurityGroup(ref.clusterName, service, &serviceIP, &ref.lbName, true /* wantLb */)
+		return err
+	}
+	return nil
+}
+
+// getServiceBackendPort returns the port the load balancing rule and the health probe of the service port target on
+// the backends. It is the node port unless the pod IPs are in the backend pools, where it is the port of the pods
+// found in the EndpointSlices, which also resolves the named target ports.
+func (az *Cloud) getServiceBackendPort(service *v1.Service, port v1.ServicePort) int32 {
+	if !az.isLBBackendPoolTypePodIP() {
+		return port.NodePort
+	}
+	// The rule of the HA mode load balancer covers all the ports.
+	if port.Port == 0 {
+		return 0
+	}
+
+	if az.endpointSliceLister != nil {
+		endpointSlices, err := az.endpointSliceLister.EndpointSlices(service.Namespace).List(labels.SelectorFromSet(labels.Set{
+			discoveryv1.LabelServiceName: service.Name,
+		}))
+		if err != nil {
+			klog.Warningf("getServiceBackendPort: failed to list the EndpointSlices of service %s: %v", getServiceName(service), err)
+		}
+		for _, endpointSlice := range endpointSlices {
+			for _, endpointPort := range endpointSlice.Ports {
+				if pointer.StringDeref(endpointPort.Name, "") == port.Name && endpointPort.Port != nil &&
+					(endpointPort.Protocol == nil || *endpointPort.Protocol == port.Protocol) {
+					return *endpointPort.Port
+				}
+			}
+		}
+	}
+
+	if port.TargetPort.Type == intstr.Int && port.TargetPort.IntVal > 0 {
+		return port.TargetPort.IntVal
+	}
+	return port.Port
+}
+
+// removeBackendPool removes the backend pool from the load balancer and reports whether it was there.
+func removeBackendPool(lb *network.LoadBalancer, backendPoolName string) bool {
+	if lb.LoadBalancerPropertiesFormat == nil || lb.BackendAddressPools == nil {
+		return false
+	}
+
+	backendPools := *lb.BackendAddressPools
+	for i := len(backendPools) - 1; i >= 0; i-- {
+		if strings.EqualFold(pointer.StringDeref(backendPools[i].Name, ""), backendPoolName) {
+			backendPools = append(backendPools[:i], backendPools[i+1:]...)
+			lb.BackendAddressPools = &backendPools
+			return true
+		}
+	}
+	return false
+}
+
 func newBackendPool(lb *network.LoadBalancer, isBackendPoolPreConfigured bool, preConfiguredBackendPoolLoadBalancerTypes, serviceName, lbBackendPoolName string) bool {
 	if isBackendPoolPreConfigured {
 		klog.V(2).Infof("newBackendPool for service (%s)(true): lb backendpool - PreConfiguredBackendPoolLoadBalancerTypes %s has been set but can not find corresponding backend pool, ignoring it",
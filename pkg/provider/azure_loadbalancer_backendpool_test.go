@@ -27,9 +27,15 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/tools/cache"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/utils/pointer"
 
@@ -681,3 +687,251 @@ func TestGetBackendIPConfigurationsToBeDeleted(t *testing.T) {
 		assert.Equal(t, tc.expected, actual)
 	}
 }
+
+func newTestEndpointSliceLister(t *testing.T, endpointSlices ...*discoveryv1.EndpointSlice) discoverylisters.EndpointSliceLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, endpointSlice := range endpointSlices {
+		assert.NoError(t, indexer.Add(endpointSlice))
+	}
+	return discoverylisters.NewEndpointSliceLister(indexer)
+}
+
+func getTestEndpointSlice(name, serviceName string, addressType discoveryv1.AddressType, port int32, endpoints ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: serviceName},
+		},
+		AddressType: addressType,
+		Endpoints:   endpoints,
+		Ports: []discoveryv1.EndpointPort{
+			{
+				Name:     pointer.String(fmt.Sprintf("port-tcp-%d", 80)),
+				Protocol: (*v1.Protocol)(pointer.String(string(v1.ProtocolTCP))),
+				Port:     pointer.Int32(port),
+			},
+		},
+	}
+}
+
+func getTestPodEndpoint(podName string, ready bool, addresses ...string) discoveryv1.Endpoint {
+	return discoveryv1.Endpoint{
+		Addresses:  addresses,
+		Conditions: discoveryv1.EndpointConditions{Ready: pointer.Bool(ready)},
+		TargetRef:  &v1.ObjectReference{Kind: "Pod", Namespace: "default", Name: podName},
+	}
+}
+
+func TestEnsureHostsInPoolPodIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+	az.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypePODIP
+	az.endpointSliceLister = newTestEndpointSliceLister(t,
+		getTestEndpointSlice("svc-1-abc", "svc-1", discoveryv1.AddressTypeIPv4, 8080,
+			getTestPodEndpoint("pod-1", true, "10.244.0.5"),
+			getTestPodEndpoint("pod-2", false, "10.244.0.6"),
+		),
+		getTestEndpointSlice("svc-1-def", "svc-1", discoveryv1.AddressTypeIPv6, 8080,
+			getTestPodEndpoint("pod-1", true, "fd00::5"),
+		),
+		getTestEndpointSlice("svc-2-abc", "svc-2", discoveryv1.AddressTypeIPv4, 8080,
+			getTestPodEndpoint("pod-3", true, "10.244.0.7"),
+		),
+	)
+	bp := newBackendPoolTypePodIP(az).(*backendPoolTypePodIP)
+
+	backendPool := network.BackendAddressPool{
+		Name: pointer.String("kubernetes-asvc1"),
+		BackendAddressPoolPropertiesFormat: &network.BackendAddressPoolPropertiesFormat{
+			LoadBalancerBackendAddresses: &[]network.LoadBalancerBackendAddress{
+				{
+					Name: pointer.String("pod-0"),
+					LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{
+						IPAddress: pointer.String("10.244.0.4"),
+					},
+				},
+			},
+		},
+	}
+	expectedBackendPool := network.BackendAddressPool{
+		Name: pointer.String("kubernetes-asvc1"),
+		BackendAddressPoolPropertiesFormat: &network.BackendAddressPoolPropertiesFormat{
+			VirtualNetwork: &network.SubResource{ID: pointer.String("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/virtualNetworks/vnet")},
+			LoadBalancerBackendAddresses: &[]network.LoadBalancerBackendAddress{
+				{
+					Name: pointer.String("pod-1"),
+					LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{
+						IPAddress: pointer.String("10.244.0.5"),
+					},
+				},
+			},
+		},
+	}
+
+	lbClient := mockloadbalancerclient.NewMockInterface(ctrl)
+	lbClient.EXPECT().CreateOrUpdateBackendPools(gomock.Any(), "rg", "lb", "kubernetes-asvc1", expectedBackendPool, gomock.Any()).Return(nil)
+	az.LoadBalancerClient = lbClient
+
+	service := getTestService("svc-1", v1.ProtocolTCP, nil, false, 80)
+	err := bp.EnsureHostsInPool(&service, nil, "", "", "kubernetes", "lb", backendPool)
+	assert.NoError(t, err)
+	assert.Equal(t, podIPBackendPoolRef{clusterName: "kubernetes", lbName: "lb"}, bp.serviceLoadBalancers[types.NamespacedName{Namespace: "default", Name: "svc-1"}])
+
+	// The pool is not updated again when it already has the ready pod IPs.
+	err = bp.EnsureHostsInPool(&service, nil, "", "", "kubernetes", "lb", expectedBackendPool)
+	assert.NoError(t, err)
+}
+
+func TestReconcileBackendPoolsPodIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+	az.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypePODIP
+	bp := newBackendPoolTypePodIP(az)
+
+	lb := buildDefaultTestLB(testClusterName, nil)
+	service := getTestService("svc-1", v1.ProtocolTCP, nil, false, 80)
+	preConfigured, changed, err := bp.ReconcileBackendPools("kubernetes", &service, &lb)
+	assert.NoError(t, err)
+	assert.False(t, preConfigured)
+	assert.True(t, changed)
+	assert.Equal(t, 2, len(*lb.BackendAddressPools))
+	assert.Equal(t, "kubernetes-asvc1", pointer.StringDeref((*lb.BackendAddressPools)[1].Name, ""))
+
+	_, changed, err = bp.ReconcileBackendPools("kubernetes", &service, &lb)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	ipv6Service := getTestService("svc-2", v1.ProtocolTCP, nil, true, 80)
+	_, changed, err = bp.ReconcileBackendPools("kubernetes", &ipv6Service, &lb)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "kubernetes-asvc2-IPv6", pointer.StringDeref((*lb.BackendAddressPools)[2].Name, ""))
+
+	assert.True(t, removeBackendPool(&lb, "kubernetes-asvc1"))
+	assert.False(t, removeBackendPool(&lb, "kubernetes-asvc1"))
+	assert.Equal(t, 2, len(*lb.BackendAddressPools))
+}
+
+func TestGetBackendPrivateIPsPodIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypePODIP
+	bp := newBackendPoolTypePodIP(az)
+
+	lb := network.LoadBalancer{
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			BackendAddressPools: &[]network.BackendAddressPool{
+				{
+					Name: pointer.String("kubernetes"),
+					BackendAddressPoolPropertiesFormat: &network.BackendAddressPoolPropertiesFormat{
+						LoadBalancerBackendAddresses: &[]network.LoadBalancerBackendAddress{
+							{LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{IPAddress: pointer.String("10.0.0.4")}},
+						},
+					},
+				},
+				{
+					Name: pointer.String("kubernetes-asvc1"),
+					BackendAddressPoolPropertiesFormat: &network.BackendAddressPoolPropertiesFormat{
+						LoadBalancerBackendAddresses: &[]network.LoadBalancerBackendAddress{
+							{LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{IPAddress: pointer.String("10.244.0.6")}},
+							{LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{IPAddress: pointer.String("10.244.0.5")}},
+						},
+					},
+				},
+			},
+		},
+	}
+	service := getTestService("svc-1", v1.ProtocolTCP, nil, false, 80)
+	ipv4, ipv6 := bp.GetBackendPrivateIPs("kubernetes", &service, &lb)
+	assert.Equal(t, []string{"10.244.0.5", "10.244.0.6"}, ipv4)
+	assert.Empty(t, ipv6)
+}
+
+func TestGetServiceBackendPort(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, tc := range []struct {
+		desc           string
+		podIP          bool
+		endpointSlices []*discoveryv1.EndpointSlice
+		port           v1.ServicePort
+		expectedPort   int32
+	}{
+		{
+			desc:         "node port should be used without podIP backend pools",
+			port:         v1.ServicePort{Name: "port-tcp-80", Protocol: v1.ProtocolTCP, Port: 80, NodePort: 30080, TargetPort: intstr.FromInt(8080)},
+			expectedPort: 30080,
+		},
+		{
+			desc:  "port of the pods should be used with podIP backend pools",
+			podIP: true,
+			endpointSlices: []*discoveryv1.EndpointSlice{
+				getTestEndpointSlice("svc-1-abc", "svc-1", discoveryv1.AddressTypeIPv4, 9090),
+			},
+			port:         v1.ServicePort{Name: "port-tcp-80", Protocol: v1.ProtocolTCP, Port: 80, NodePort: 30080, TargetPort: intstr.FromString("http")},
+			expectedPort: 9090,
+		},
+		{
+			desc:         "numeric target port should be used without EndpointSlices",
+			podIP:        true,
+			port:         v1.ServicePort{Name: "port-tcp-80", Protocol: v1.ProtocolTCP, Port: 80, NodePort: 30080, TargetPort: intstr.FromInt(8080)},
+			expectedPort: 8080,
+		},
+		{
+			desc:         "service port should be used when the named target port cannot be resolved",
+			podIP:        true,
+			port:         v1.ServicePort{Name: "port-tcp-80", Protocol: v1.ProtocolTCP, Port: 80, NodePort: 30080, TargetPort: intstr.FromString("http")},
+			expectedPort: 80,
+		},
+		{
+			desc:  "port of the HA mode rule should not be changed",
+			podIP: true,
+			endpointSlices: []*discoveryv1.EndpointSlice{
+				getTestEndpointSlice("svc-1-abc", "svc-1", discoveryv1.AddressTypeIPv4, 9090),
+			},
+			port:         v1.ServicePort{},
+			expectedPort: 0,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			if tc.podIP {
+				az.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypePODIP
+				az.endpointSliceLister = newTestEndpointSliceLister(t, tc.endpointSlices...)
+			}
+			service := getTestService("svc-1", v1.ProtocolTCP, nil, false, 80)
+			assert.Equal(t, tc.expectedPort, az.getServiceBackendPort(&service, tc.port))
+		})
+	}
+}
+
+func TestSyncServicePodIP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypePODIP
+	az.serviceLister = corelisters.NewServiceLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}))
+	bp := newBackendPoolTypePodIP(az).(*backendPoolTypePodIP)
+
+	key := types.NamespacedName{Namespace: "default", Name: "svc-1"}
+	assert.NoError(t, bp.syncService(key))
+
+	bp.serviceLoadBalancers[key] = podIPBackendPoolRef{clusterName: testClusterName, lbName: "lb"}
+	assert.NoError(t, bp.syncService(key))
+	assert.Empty(t, bp.serviceLoadBalancers)
+
+	bp.enqueueEndpointSlice(getTestEndpointSlice("svc-1-abc", "svc-1", discoveryv1.AddressTypeIPv4, 8080))
+	bp.enqueueEndpointSlice(&discoveryv1.EndpointSlice{})
+	assert.Equal(t, 1, bp.queue.Len())
+}
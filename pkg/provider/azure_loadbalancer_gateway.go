@@ -0,0 +1,183 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/Azure/go-autorest/autorest/azure"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+var gatewayLoadBalancerFrontendIDRE = regexp.MustCompile(`(?i)^/subscriptions/([^/]+)/resourceGroups/([^/]+)/providers/Microsoft.Network/loadBalancers/([^/]+)/frontendIPConfigurations/([^/]+)$`)
+
+// getGatewayLoadBalancerFrontendID returns the gateway load balancer frontend requested by the service. The annotation
+// takes precedence over the cloud config, which only applies to the external services. The internal services can't be
+// chained, so requesting it by the annotation fails the validation.
+func (az *Cloud) getGatewayLoadBalancerFrontendID(service *v1.Service) string {
+	if value, found := service.Annotations[consts.ServiceAnnotationGatewayLoadBalancerFrontendID]; found {
+		return strings.TrimSpace(value)
+	}
+	if requiresInternalLoadBalancer(service) {
+		return ""
+	}
+	return strings.TrimSpace(az.GatewayLoadBalancerFrontendID)
+}
+
+// validateGatewayLoadBalancerFrontend checks if the gateway load balancer frontend can be chained to the service.
+func (az *Cloud) validateGatewayLoadBalancerFrontend(service *v1.Service, frontendID string) error {
+	if requiresInternalLoadBalancer(service) {
+		return fmt.Errorf("the gateway load balancer can only be chained to the frontends of external services")
+	}
+	if !az.useStandardLoadBalancer() {
+		return fmt.Errorf("the gateway load balancer can only be chained to the standard load balancer")
+	}
+
+	matches := gatewayLoadBalancerFrontendIDRE.FindStringSubmatch(frontendID)
+	if len(matches) != 5 {
+		return fmt.Errorf("invalid gateway load balancer frontend ID %q", frontendID)
+	}
+	if !strings.EqualFold(matches[1], az.getNetworkResourceSubscriptionID()) {
+		return fmt.Errorf("the gateway load balancer frontend %q should be in the subscription %s", frontendID, az.getNetworkResourceSubscriptionID())
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	lb, err := az.LoadBalancerClient.Get(ctx, matches[2], matches[3], "")
+	exists, rerr := checkResourceExistsFromError(err)
+	if rerr != nil {
+		return rerr.Error()
+	}
+	if !exists {
+		return fmt.Errorf("the gateway load balancer %s is not found in resource group %s", matches[3], matches[2])
+	}
+	if lb.Sku == nil || lb.Sku.Name != network.LoadBalancerSkuNameGateway {
+		return fmt.Errorf("the load balancer %s is not of the gateway SKU", matches[3])
+	}
+	if lb.LoadBalancerPropertiesFormat != nil && lb.FrontendIPConfigurations != nil {
+		for _, fip := range *lb.FrontendIPConfigurations {
+			if strings.EqualFold(pointer.StringDeref(fip.Name, ""), matches[4]) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("the frontend IP configuration %s is not found in the gateway load balancer %s", matches[4], matches[3])
+}
+
+// reconcileGatewayLoadBalancerChain chains the frontend IP configuration of the service to the gateway load balancer
+// frontend, or unchains it if no gateway load balancer frontend is requested. It returns true if the load balancer is changed.
+// The frontends are unchained along with their deletion, so it is only called when the service wants the load balancer.
+func (az *Cloud) reconcileGatewayLoadBalancerChain(service *v1.Service, lb *network.LoadBalancer, fipConfigID string) (bool, error) {
+	if lb.LoadBalancerPropertiesFormat == nil || lb.FrontendIPConfigurations == nil {
+		return false, nil
+	}
+	serviceName := getServiceName(service)
+
+	fipConfigs := *lb.FrontendIPConfigurations
+	for i := range fipConfigs {
+		if !strings.EqualFold(pointer.StringDeref(fipConfigs[i].ID, ""), fipConfigID) {
+			continue
+		}
+		if fipConfigs[i].FrontendIPConfigurationPropertiesFormat == nil {
+			fipConfigs[i].FrontendIPConfigurationPropertiesFormat = &network.FrontendIPConfigurationPropertiesFormat{}
+		}
+		frontendID, err := az.getSharedGatewayLoadBalancerFrontendID(service, &fipConfigs[i])
+		if err != nil {
+			return false, fmt.Errorf("reconcileGatewayLoadBalancerChain for service(%s): %w", serviceName, err)
+		}
+
+		var existingID string
+		if fipConfigs[i].GatewayLoadBalancer != nil {
+			existingID = pointer.StringDeref(fipConfigs[i].GatewayLoadBalancer.ID, "")
+		}
+		if strings.EqualFold(existingID, frontendID) {
+			return false, nil
+		}
+
+		if frontendID == "" {
+			klog.V(2).Infof("reconcileGatewayLoadBalancerChain for service(%s): lb frontendconfig(%s) - unchaining gateway frontend %s", serviceName, pointer.StringDeref(fipConfigs[i].Name, ""), existingID)
+			fipConfigs[i].GatewayLoadBalancer = nil
+			return true, nil
+		}
+		if err := az.validateGatewayLoadBalancerFrontend(service, frontendID); err != nil {
+			return false, fmt.Errorf("reconcileGatewayLoadBalancerChain for service(%s): %w", serviceName, err)
+		}
+		klog.V(2).Infof("reconcileGatewayLoadBalancerChain for service(%s): lb frontendconfig(%s) - chaining gateway frontend %s", serviceName, pointer.StringDeref(fipConfigs[i].Name, ""), frontendID)
+		fipConfigs[i].GatewayLoadBalancer = &network.SubResource{ID: pointer.String(frontendID)}
+		return true, nil
+	}
+	return false, nil
+}
+
+// getSharedGatewayLoadBalancerFrontendID returns the gateway load balancer frontend requested by all the services
+// sharing the frontend of the service, which are the services bound to its public IP. The chain is a property of the
+// frontend, so it fails if the services request different gateway load balancer frontends instead of letting them
+// chain and unchain the frontend in turn.
+func (az *Cloud) getSharedGatewayLoadBalancerFrontendID(service *v1.Service, fipConfig *network.FrontendIPConfiguration) (string, error) {
+	frontendID := az.getGatewayLoadBalancerFrontendID(service)
+	if az.serviceLister == nil || fipConfig.PublicIPAddress == nil {
+		return frontendID, nil
+	}
+	resource, err := azure.ParseResourceID(pointer.StringDeref(fipConfig.PublicIPAddress.ID, ""))
+	if err != nil {
+		return frontendID, nil
+	}
+	pip, existsPip, err := az.getPublicIPAddress(resource.ResourceGroup, resource.ResourceName, azcache.CacheReadTypeDefault)
+	if err != nil {
+		return "", err
+	}
+	if !existsPip {
+		return frontendID, nil
+	}
+
+	serviceName := getServiceName(service)
+	serviceTag := getServiceFromPIPServiceTags(pip.Tags)
+	for _, name := range parsePIPServiceTag(&serviceTag) {
+		if strings.EqualFold(name, serviceName) {
+			continue
+		}
+		namespace, svcName, err := cache.SplitMetaNamespaceKey(name)
+		if err != nil || svcName == "" {
+			continue
+		}
+		svc, err := az.serviceLister.Services(namespace).Get(svcName)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if svc.DeletionTimestamp != nil || svc.Spec.Type != v1.ServiceTypeLoadBalancer {
+			continue
+		}
+		if sharedFrontendID := az.getGatewayLoadBalancerFrontendID(svc); !strings.EqualFold(sharedFrontendID, frontendID) {
+			return "", fmt.Errorf("the gateway load balancer frontend %q conflicts with %q of service(%s) sharing the frontend", frontendID, sharedFrontendID, name)
+		}
+	}
+	return frontendID, nil
+}
@@ -0,0 +1,247 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const (
+	testGatewayFrontendID = "/subscriptions/subscription/resourceGroups/nva-rg/providers/Microsoft.Network/loadBalancers/gwlb/frontendIPConfigurations/gwfip"
+	testServiceFrontendID = "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lb/frontendIPConfigurations/fip"
+)
+
+func getTestGatewayLoadBalancer(skuName network.LoadBalancerSkuName) network.LoadBalancer {
+	return network.LoadBalancer{
+		Name: pointer.String("gwlb"),
+		Sku:  &network.LoadBalancerSku{Name: skuName},
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{{Name: pointer.String("gwfip")}},
+		},
+	}
+}
+
+func getTestChainedLoadBalancer(gatewayFrontendID string) network.LoadBalancer {
+	fipConfig := network.FrontendIPConfiguration{
+		Name:                                    pointer.String("fip"),
+		ID:                                      pointer.String(testServiceFrontendID),
+		FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{},
+	}
+	if gatewayFrontendID != "" {
+		fipConfig.GatewayLoadBalancer = &network.SubResource{ID: pointer.String(gatewayFrontendID)}
+	}
+	return network.LoadBalancer{
+		Name: pointer.String("lb"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{fipConfig},
+		},
+	}
+}
+
+func TestGetGatewayLoadBalancerFrontendID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	az.GatewayLoadBalancerFrontendID = testGatewayFrontendID
+
+	service := getTestService("svc1", v1.ProtocolTCP, nil, false, 80)
+	assert.Equal(t, testGatewayFrontendID, az.getGatewayLoadBalancerFrontendID(&service))
+
+	service.Annotations[consts.ServiceAnnotationGatewayLoadBalancerFrontendID] = ""
+	assert.Equal(t, "", az.getGatewayLoadBalancerFrontendID(&service))
+
+	internalService := getInternalTestService("svc2", 80)
+	assert.Equal(t, "", az.getGatewayLoadBalancerFrontendID(&internalService))
+}
+
+func TestReconcileGatewayLoadBalancerChain(t *testing.T) {
+	for _, tc := range []struct {
+		desc            string
+		annotation      *string
+		existingID      string
+		gatewayLB       *network.LoadBalancer
+		gatewayLBErr    *retry.Error
+		expectedID      string
+		expectedChanged bool
+		expectedErr     bool
+	}{
+		{
+			desc:            "the frontend should be chained to the gateway frontend",
+			annotation:      pointer.String(testGatewayFrontendID),
+			gatewayLB:       &network.LoadBalancer{},
+			expectedID:      testGatewayFrontendID,
+			expectedChanged: true,
+		},
+		{
+			desc:       "the chained frontend should not be changed",
+			annotation: pointer.String(testGatewayFrontendID),
+			existingID: testGatewayFrontendID,
+			expectedID: testGatewayFrontendID,
+		},
+		{
+			desc:            "the frontend should be unchained without the annotation",
+			existingID:      testGatewayFrontendID,
+			expectedChanged: true,
+		},
+		{
+			desc:         "an error should be reported if the gateway load balancer is not found",
+			annotation:   pointer.String(testGatewayFrontendID),
+			gatewayLBErr: &retry.Error{HTTPStatusCode: http.StatusNotFound},
+			expectedErr:  true,
+		},
+		{
+			desc:        "an error should be reported if the load balancer is not of the gateway SKU",
+			annotation:  pointer.String(testGatewayFrontendID),
+			gatewayLB:   &network.LoadBalancer{Sku: &network.LoadBalancerSku{Name: network.LoadBalancerSkuNameStandard}},
+			expectedErr: true,
+		},
+		{
+			desc:        "an error should be reported if the gateway frontend is not found",
+			annotation:  pointer.String(testGatewayFrontendID + "-notfound"),
+			gatewayLB:   &network.LoadBalancer{},
+			expectedErr: true,
+		},
+		{
+			desc:        "an error should be reported if the gateway frontend is in another subscription",
+			annotation:  pointer.String("/subscriptions/other/resourceGroups/nva-rg/providers/Microsoft.Network/loadBalancers/gwlb/frontendIPConfigurations/gwfip"),
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			az := GetTestCloud(ctrl)
+			az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+
+			annotations := map[string]string{}
+			if tc.annotation != nil {
+				annotations[consts.ServiceAnnotationGatewayLoadBalancerFrontendID] = *tc.annotation
+			}
+			service := getTestService("svc1", v1.ProtocolTCP, annotations, false, 80)
+
+			mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+			if tc.gatewayLB != nil || tc.gatewayLBErr != nil {
+				gatewayLB := getTestGatewayLoadBalancer(network.LoadBalancerSkuNameGateway)
+				if tc.gatewayLB != nil && tc.gatewayLB.Sku != nil {
+					gatewayLB.Sku = tc.gatewayLB.Sku
+				}
+				mockLBClient.EXPECT().Get(gomock.Any(), "nva-rg", "gwlb", "").Return(gatewayLB, tc.gatewayLBErr)
+			}
+
+			lb := getTestChainedLoadBalancer(tc.existingID)
+			changed, err := az.reconcileGatewayLoadBalancerChain(&service, &lb, testServiceFrontendID)
+			assert.Equal(t, tc.expectedErr, err != nil)
+			assert.Equal(t, tc.expectedChanged, changed)
+			if !tc.expectedErr {
+				var chainedID string
+				if gatewayLB := (*lb.FrontendIPConfigurations)[0].GatewayLoadBalancer; gatewayLB != nil {
+					chainedID = pointer.StringDeref(gatewayLB.ID, "")
+				}
+				assert.Equal(t, tc.expectedID, chainedID)
+			}
+		})
+	}
+}
+
+func TestValidateGatewayLoadBalancerFrontendForInternalService(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+
+	service := getInternalTestService("svc1", 80)
+	assert.Error(t, az.validateGatewayLoadBalancerFrontend(&service, testGatewayFrontendID))
+}
+
+func TestReconcileGatewayLoadBalancerChainSharedFrontend(t *testing.T) {
+	const pipID = "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/pip1"
+	for _, tc := range []struct {
+		desc            string
+		sharedFrontend  string
+		existingID      string
+		expectedChanged bool
+		expectedErr     bool
+	}{
+		{
+			desc:            "the frontend should be chained if the sharing service requests the same gateway frontend",
+			sharedFrontend:  testGatewayFrontendID,
+			expectedChanged: true,
+		},
+		{
+			desc:        "an error should be reported if the sharing service does not request the gateway frontend",
+			existingID:  testGatewayFrontendID,
+			expectedErr: true,
+		},
+		{
+			desc:           "an error should be reported if the sharing service requests another gateway frontend",
+			sharedFrontend: testGatewayFrontendID + "2",
+			expectedErr:    true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			az := GetTestCloud(ctrl)
+			az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+
+			service := getTestService("svc1", v1.ProtocolTCP, map[string]string{
+				consts.ServiceAnnotationGatewayLoadBalancerFrontendID: testGatewayFrontendID,
+			}, false, 80)
+			sharedAnnotations := map[string]string{}
+			if tc.sharedFrontend != "" {
+				sharedAnnotations[consts.ServiceAnnotationGatewayLoadBalancerFrontendID] = tc.sharedFrontend
+			}
+			shared := getTestService("svc2", v1.ProtocolTCP, sharedAnnotations, false, 443)
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			assert.NoError(t, indexer.Add(&service))
+			assert.NoError(t, indexer.Add(&shared))
+			az.serviceLister = corelisters.NewServiceLister(indexer)
+
+			mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+			mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{{
+				ID:   pointer.String(pipID),
+				Name: pointer.String("pip1"),
+				Tags: map[string]*string{consts.ServiceTagKey: pointer.String("default/svc1,default/svc2")},
+			}}, nil)
+			if !tc.expectedErr {
+				mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+				mockLBClient.EXPECT().Get(gomock.Any(), "nva-rg", "gwlb", "").Return(getTestGatewayLoadBalancer(network.LoadBalancerSkuNameGateway), nil)
+			}
+
+			lb := getTestChainedLoadBalancer(tc.existingID)
+			(*lb.FrontendIPConfigurations)[0].PublicIPAddress = &network.PublicIPAddress{ID: pointer.String(pipID)}
+			changed, err := az.reconcileGatewayLoadBalancerChain(&service, &lb, testServiceFrontendID)
+			assert.Equal(t, tc.expectedErr, err != nil, err)
+			assert.Equal(t, tc.expectedChanged, changed)
+		})
+	}
+}
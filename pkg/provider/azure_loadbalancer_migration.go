@@ -0,0 +1,342 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/Azure/go-autorest/autorest/azure"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// loadBalancerSkuMigrationSnapshot records the resources of a service on the basic load balancer
+// before they are removed, so that they can be re-created on the standard load balancer.
+type loadBalancerSkuMigrationSnapshot struct {
+	LoadBalancerName            string   `json:"loadBalancerName"`
+	FrontendIPConfigurationName string   `json:"frontendIPConfigurationName"`
+	PublicIPAddressID           string   `json:"publicIPAddressID,omitempty"`
+	IPAddress                   string   `json:"ipAddress,omitempty"`
+	LoadBalancingRules          []string `json:"loadBalancingRules,omitempty"`
+}
+
+// shouldMigrateLoadBalancerSku returns true if the services on the basic load balancers should be migrated.
+func (az *Cloud) shouldMigrateLoadBalancerSku() bool {
+	return az.useStandardLoadBalancer() && az.EnableLoadBalancerSkuMigration
+}
+
+func isBasicLoadBalancer(lb *network.LoadBalancer) bool {
+	// The SKU of a load balancer is basic if it is not specified.
+	return lb.Sku == nil || strings.EqualFold(string(lb.Sku.Name), string(network.LoadBalancerSkuNameBasic))
+}
+
+func getLoadBalancerFrontendIPConfigs(lb *network.LoadBalancer) []network.FrontendIPConfiguration {
+	if lb.LoadBalancerPropertiesFormat == nil || lb.FrontendIPConfigurations == nil {
+		return nil
+	}
+	return *lb.FrontendIPConfigurations
+}
+
+// getLoadBalancerSkuMigrationSnapshot returns the snapshot recorded in the service annotation, or nil if there is none.
+func getLoadBalancerSkuMigrationSnapshot(service *v1.Service) *loadBalancerSkuMigrationSnapshot {
+	value, found := service.Annotations[consts.ServiceAnnotationLoadBalancerSkuMigrationSnapshot]
+	if !found || value == "" {
+		return nil
+	}
+	snapshot := &loadBalancerSkuMigrationSnapshot{}
+	if err := json.Unmarshal([]byte(value), snapshot); err != nil {
+		klog.Warningf("getLoadBalancerSkuMigrationSnapshot(%s): ignoring the invalid snapshot: %v", getServiceName(service), err)
+		return nil
+	}
+	return snapshot
+}
+
+// migrateLoadBalancerSku moves the service out of the basic load balancer before it is reconciled on the standard one.
+// The progress is tracked in the service annotations:
+//  1. Snapshotted: the frontend IP configuration and the rules of the service are recorded, and a dynamic public IP is
+//     made static so that its address is kept.
+//  2. Detached: the service is removed from the basic load balancer. The load balancer is deleted together with its
+//     backend pool membership in the vmSets after its last service is removed.
+//  3. PublicIPUpgraded: the public IP of the service is upgraded to the standard SKU.
+//
+// Since the VMs cannot join the backend pools of the basic and standard load balancers at the same time, the services are
+// not reconciled until all the basic load balancers are drained.
+func (az *Cloud) migrateLoadBalancerSku(clusterName string, service *v1.Service, nodes []*v1.Node) error {
+	if !az.shouldMigrateLoadBalancerSku() || az.inLoadBalancerPlan(service) || nodes == nil {
+		return nil
+	}
+
+	serviceName := getServiceName(service)
+	state := service.Annotations[consts.ServiceAnnotationLoadBalancerSkuMigrationState]
+	if strings.EqualFold(state, consts.LoadBalancerSkuMigrationStateCompleted) || (state == "" && az.isLoadBalancerSkuMigrated) {
+		return nil
+	}
+
+	existingLBs, err := az.ListManagedLBs(service, nodes, clusterName)
+	if err != nil {
+		return fmt.Errorf("migrateLoadBalancerSku(%s): failed to list managed load balancers: %w", serviceName, err)
+	}
+
+	var pips []network.PublicIPAddress
+	basicLBNames := sets.NewString()
+	for i := range existingLBs {
+		lb := &existingLBs[i]
+		if !isBasicLoadBalancer(lb) {
+			continue
+		}
+		lbName := pointer.StringDeref(lb.Name, "")
+
+		fipConfigs := getLoadBalancerFrontendIPConfigs(lb)
+		if len(fipConfigs) == 0 {
+			klog.V(2).Infof("migrateLoadBalancerSku(%s): deleting the basic load balancer %s without frontend IP configurations", serviceName, lbName)
+			if err := az.cleanOrphanedLoadBalancer(lb, existingLBs, service, clusterName); err != nil {
+				return err
+			}
+			continue
+		}
+
+		fip, err := az.findFrontendIPConfigOfService(&fipConfigs, service, &pips)
+		if err != nil {
+			return err
+		}
+		if fip != nil {
+			if state == "" {
+				if err := az.snapshotLoadBalancerSku(service, lb, fip); err != nil {
+					return err
+				}
+				state = consts.LoadBalancerSkuMigrationStateSnapshotted
+			}
+
+			klog.V(2).Infof("migrateLoadBalancerSku(%s): removing the frontend IP configuration %s from the basic load balancer %s", serviceName, pointer.StringDeref(fip.Name, ""), lbName)
+			if err := az.removeFrontendIPConfigurationFromLoadBalancer(lb, existingLBs, fip, clusterName, service); err != nil {
+				return err
+			}
+			az.Event(service, v1.EventTypeNormal, "MigrateLoadBalancerSku", fmt.Sprintf("Removed the service from the basic load balancer %s", lbName))
+		}
+		if len(getLoadBalancerFrontendIPConfigs(lb)) > 0 {
+			basicLBNames.Insert(lbName)
+		}
+	}
+
+	if strings.EqualFold(state, consts.LoadBalancerSkuMigrationStateSnapshotted) {
+		if err := az.patchServiceAnnotations(service, map[string]*string{
+			consts.ServiceAnnotationLoadBalancerSkuMigrationState: pointer.String(consts.LoadBalancerSkuMigrationStateDetached),
+		}); err != nil {
+			return err
+		}
+		state = consts.LoadBalancerSkuMigrationStateDetached
+	}
+
+	if basicLBNames.Len() > 0 {
+		return fmt.Errorf("migrateLoadBalancerSku(%s): waiting for the basic load balancers %s to be drained", serviceName, strings.Join(basicLBNames.List(), ","))
+	}
+	az.isLoadBalancerSkuMigrated = true
+
+	if strings.EqualFold(state, consts.LoadBalancerSkuMigrationStateDetached) {
+		if snapshot := getLoadBalancerSkuMigrationSnapshot(service); snapshot != nil && snapshot.PublicIPAddressID != "" {
+			if err := az.upgradePublicIPSku(service, snapshot.PublicIPAddressID); err != nil {
+				return err
+			}
+			if err := az.patchServiceAnnotations(service, map[string]*string{
+				consts.ServiceAnnotationLoadBalancerSkuMigrationState: pointer.String(consts.LoadBalancerSkuMigrationStatePublicIPUpgraded),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// snapshotLoadBalancerSku records the frontend IP configuration and the rules of the service on the basic load balancer.
+func (az *Cloud) snapshotLoadBalancerSku(service *v1.Service, lb *network.LoadBalancer, fip *network.FrontendIPConfiguration) error {
+	serviceName := getServiceName(service)
+	snapshot := loadBalancerSkuMigrationSnapshot{
+		LoadBalancerName:            pointer.StringDeref(lb.Name, ""),
+		FrontendIPConfigurationName: pointer.StringDeref(fip.Name, ""),
+	}
+	if lb.LoadBalancingRules != nil {
+		for _, rule := range *lb.LoadBalancingRules {
+			if rule.LoadBalancingRulePropertiesFormat == nil || rule.FrontendIPConfiguration == nil ||
+				!strings.EqualFold(pointer.StringDeref(rule.FrontendIPConfiguration.ID, ""), pointer.StringDeref(fip.ID, "")) {
+				continue
+			}
+			snapshot.LoadBalancingRules = append(snapshot.LoadBalancingRules, pointer.StringDeref(rule.Name, ""))
+		}
+		sort.Strings(snapshot.LoadBalancingRules)
+	}
+
+	if fip.FrontendIPConfigurationPropertiesFormat != nil {
+		if fip.PublicIPAddress != nil && fip.PublicIPAddress.ID != nil {
+			snapshot.PublicIPAddressID = *fip.PublicIPAddress.ID
+			ipAddress, err := az.ensurePublicIPStatic(service, snapshot.PublicIPAddressID)
+			if err != nil {
+				return err
+			}
+			snapshot.IPAddress = ipAddress
+		} else {
+			snapshot.IPAddress = pointer.StringDeref(fip.PrivateIPAddress, "")
+		}
+	}
+
+	snapshotBytes, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("snapshotLoadBalancerSku(%s): failed to marshal the snapshot: %w", serviceName, err)
+	}
+	if err := az.patchServiceAnnotations(service, map[string]*string{
+		consts.ServiceAnnotationLoadBalancerSkuMigrationState:    pointer.String(consts.LoadBalancerSkuMigrationStateSnapshotted),
+		consts.ServiceAnnotationLoadBalancerSkuMigrationSnapshot: pointer.String(string(snapshotBytes)),
+	}); err != nil {
+		return err
+	}
+	az.Event(service, v1.EventTypeNormal, "MigrateLoadBalancerSku", fmt.Sprintf("Started migrating the service from the basic load balancer %s", snapshot.LoadBalancerName))
+	return nil
+}
+
+// ensurePublicIPStatic makes the basic public IP static while it is still associated with the load balancer,
+// which keeps its address when it is upgraded to the standard SKU. It returns the IP address.
+func (az *Cloud) ensurePublicIPStatic(service *v1.Service, pipID string) (string, error) {
+	pip, pipResourceGroup, exists, err := az.getPublicIPAddressByID(pipID)
+	if err != nil || !exists {
+		return "", err
+	}
+	if pip.PublicIPAddressPropertiesFormat == nil {
+		return "", nil
+	}
+	if pip.PublicIPAllocationMethod != network.Static {
+		klog.V(2).Infof("ensurePublicIPStatic(%s): changing the allocation method of the public IP %s to static", getServiceName(service), pipID)
+		pip.PublicIPAllocationMethod = network.Static
+		if err := az.CreateOrUpdatePIP(service, pipResourceGroup, pip); err != nil {
+			return "", err
+		}
+	}
+	return pointer.StringDeref(pip.IPAddress, ""), nil
+}
+
+// upgradePublicIPSku upgrades the public IP detached from the basic load balancer to the standard SKU.
+func (az *Cloud) upgradePublicIPSku(service *v1.Service, pipID string) error {
+	pip, pipResourceGroup, exists, err := az.getPublicIPAddressByID(pipID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		az.Event(service, v1.EventTypeWarning, "MigrateLoadBalancerSku", fmt.Sprintf("The public IP %s is not found, a new one would be created", pipID))
+		return nil
+	}
+	if pip.Sku != nil && strings.EqualFold(string(pip.Sku.Name), string(network.PublicIPAddressSkuNameStandard)) {
+		return nil
+	}
+
+	klog.V(2).Infof("upgradePublicIPSku(%s): upgrading the public IP %s to the standard SKU", getServiceName(service), pipID)
+	pip.Sku = &network.PublicIPAddressSku{Name: network.PublicIPAddressSkuNameStandard}
+	if pip.PublicIPAddressPropertiesFormat != nil {
+		pip.PublicIPAllocationMethod = network.Static
+	}
+	return az.CreateOrUpdatePIP(service, pipResourceGroup, pip)
+}
+
+func (az *Cloud) getPublicIPAddressByID(pipID string) (network.PublicIPAddress, string, bool, error) {
+	resource, err := azure.ParseResourceID(pipID)
+	if err != nil {
+		return network.PublicIPAddress{}, "", false, fmt.Errorf("failed to parse public IP ID %s: %w", pipID, err)
+	}
+	pip, exists, err := az.getPublicIPAddress(resource.ResourceGroup, resource.ResourceName, azcache.CacheReadTypeForceRefresh)
+	return pip, resource.ResourceGroup, exists, err
+}
+
+// completeLoadBalancerSkuMigration marks the migration of the service completed after it is reconciled on the
+// standard load balancer. The rules missing from the snapshot are reported since they are derived from the service spec.
+func (az *Cloud) completeLoadBalancerSkuMigration(service *v1.Service, lb *network.LoadBalancer) error {
+	state := service.Annotations[consts.ServiceAnnotationLoadBalancerSkuMigrationState]
+	if state == "" || strings.EqualFold(state, consts.LoadBalancerSkuMigrationStateCompleted) || az.inLoadBalancerPlan(service) {
+		return nil
+	}
+
+	if snapshot := getLoadBalancerSkuMigrationSnapshot(service); snapshot != nil && lb != nil {
+		ruleNames := sets.NewString()
+		if lb.LoadBalancerPropertiesFormat != nil && lb.LoadBalancingRules != nil {
+			for _, rule := range *lb.LoadBalancingRules {
+				ruleNames.Insert(strings.ToLower(pointer.StringDeref(rule.Name, "")))
+			}
+		}
+		var missingRules []string
+		for _, ruleName := range snapshot.LoadBalancingRules {
+			if !ruleNames.Has(strings.ToLower(ruleName)) {
+				missingRules = append(missingRules, ruleName)
+			}
+		}
+		if len(missingRules) > 0 {
+			az.Event(service, v1.EventTypeWarning, "MigrateLoadBalancerSku", fmt.Sprintf("The load balancing rules %s of the basic load balancer are not re-created", strings.Join(missingRules, ",")))
+		}
+	}
+
+	if err := az.patchServiceAnnotations(service, map[string]*string{
+		consts.ServiceAnnotationLoadBalancerSkuMigrationState:    pointer.String(consts.LoadBalancerSkuMigrationStateCompleted),
+		consts.ServiceAnnotationLoadBalancerSkuMigrationSnapshot: nil,
+	}); err != nil {
+		return err
+	}
+	az.Event(service, v1.EventTypeNormal, "MigrateLoadBalancerSku", fmt.Sprintf("Migrated the service to the standard load balancer %s", pointer.StringDeref(lb.Name, "")))
+	return nil
+}
+
+// patchServiceAnnotations sets the annotations of the service, removing those with nil values. The services
+// translated from the Gateways are only updated in memory since they don't exist in the API server.
+func (az *Cloud) patchServiceAnnotations(service *v1.Service, annotations map[string]*string) error {
+	if service.Annotations == nil {
+		service.Annotations = map[string]string{}
+	}
+	for key, value := range annotations {
+		if value == nil {
+			delete(service.Annotations, key)
+		} else {
+			service.Annotations[key] = *value
+		}
+	}
+	if az.KubeClient == nil || consts.IsGatewayService(service) {
+		return nil
+	}
+
+	serviceName := getServiceName(service)
+	patchBytes, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("patchServiceAnnotations(%s): failed to marshal the annotations: %w", serviceName, err)
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	if _, err := az.KubeClient.CoreV1().Services(service.Namespace).Patch(ctx, service.Name, types.StrategicMergePatchType, patchBytes, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("patchServiceAnnotations(%s): failed to patch the service: %w", serviceName, err)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/privatelinkserviceclient/mockprivatelinkserviceclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func getTestMigrationCloud(ctrl *gomock.Controller, service *v1.Service) (*Cloud, *MockVMSet) {
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+	az.EnableLoadBalancerSkuMigration = true
+	az.eventRecorder = record.NewFakeRecorder(10)
+	az.KubeClient = fake.NewSimpleClientset(service)
+
+	mockVMSet := NewMockVMSet(ctrl)
+	mockVMSet.EXPECT().GetAgentPoolVMSetNames(gomock.Any()).Return(&[]string{"vmas"}, nil).AnyTimes()
+	mockVMSet.EXPECT().GetPrimaryVMSetName().Return("vmas").AnyTimes()
+	az.VMSet = mockVMSet
+
+	mockPLSClient := az.PrivateLinkServiceClient.(*mockprivatelinkserviceclient.MockInterface)
+	mockPLSClient.EXPECT().List(gomock.Any(), gomock.Any()).Return([]network.PrivateLinkService{}, nil).AnyTimes()
+	return az, mockVMSet
+}
+
+func getTestBasicLoadBalancer(name string, fipNames ...string) network.LoadBalancer {
+	var (
+		fipConfigs []network.FrontendIPConfiguration
+		rules      []network.LoadBalancingRule
+	)
+	for i, fipName := range fipNames {
+		fipID := fmt.Sprintf("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/%s/frontendIPConfigurations/%s", name, fipName)
+		fipConfigs = append(fipConfigs, network.FrontendIPConfiguration{
+			Name: pointer.String(fipName),
+			ID:   pointer.String(fipID),
+			FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+				PrivateIPAddress: pointer.String(fmt.Sprintf("10.0.0.%d", i+10)),
+			},
+		})
+		rules = append(rules, network.LoadBalancingRule{
+			Name: pointer.String(fipName + "-TCP-80"),
+			LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+				FrontendIPConfiguration: &network.SubResource{ID: pointer.String(fipID)},
+			},
+		})
+	}
+	return network.LoadBalancer{
+		Name: pointer.String(name),
+		Sku:  &network.LoadBalancerSku{Name: network.LoadBalancerSkuNameBasic},
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &fipConfigs,
+			LoadBalancingRules:       &rules,
+		},
+	}
+}
+
+func TestMigrateLoadBalancerSku(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	t.Run("the service should wait for the basic load balancers to be drained after being removed", func(t *testing.T) {
+		service := getInternalTestService("svc1", 80)
+		az, _ := getTestMigrationCloud(ctrl, &service)
+		lb := getTestBasicLoadBalancer("kubernetes-internal", "asvc1", "asvc2")
+		mockLBsClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+		mockLBsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.LoadBalancer{lb}, nil)
+		mockLBsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "kubernetes-internal", gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, rg, name string, lb network.LoadBalancer, etag string) error {
+				assert.Len(t, *lb.FrontendIPConfigurations, 1)
+				assert.Len(t, *lb.LoadBalancingRules, 1)
+				return nil
+			})
+
+		err := az.migrateLoadBalancerSku("kubernetes", &service, []*v1.Node{})
+		assert.EqualError(t, err, "migrateLoadBalancerSku(default/svc1): waiting for the basic load balancers kubernetes-internal to be drained")
+		assert.False(t, az.isLoadBalancerSkuMigrated)
+
+		updated, err := az.KubeClient.CoreV1().Services("default").Get(context.TODO(), "svc1", metav1.GetOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, consts.LoadBalancerSkuMigrationStateDetached, updated.Annotations[consts.ServiceAnnotationLoadBalancerSkuMigrationState])
+		assert.Equal(t, &loadBalancerSkuMigrationSnapshot{
+			LoadBalancerName:            "kubernetes-internal",
+			FrontendIPConfigurationName: "asvc1",
+			IPAddress:                   "10.0.0.10",
+			LoadBalancingRules:          []string{"asvc1-TCP-80"},
+		}, getLoadBalancerSkuMigrationSnapshot(updated))
+	})
+
+	t.Run("the basic load balancer should be deleted with its last service", func(t *testing.T) {
+		service := getInternalTestService("svc1", 80)
+		az, mockVMSet := getTestMigrationCloud(ctrl, &service)
+		lb := getTestBasicLoadBalancer("kubernetes-internal", "asvc1")
+		mockLBsClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+		mockLBsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.LoadBalancer{lb}, nil)
+		mockLBsClient.EXPECT().Delete(gomock.Any(), "rg", "kubernetes-internal").Return(nil)
+		mockVMSet.EXPECT().EnsureBackendPoolDeleted(gomock.Any(), gomock.Any(), "vmas", gomock.Any(), true).Return(false, nil)
+
+		err := az.migrateLoadBalancerSku("kubernetes", &service, []*v1.Node{})
+		assert.NoError(t, err)
+		assert.True(t, az.isLoadBalancerSkuMigrated)
+		assert.Equal(t, consts.LoadBalancerSkuMigrationStateDetached, service.Annotations[consts.ServiceAnnotationLoadBalancerSkuMigrationState])
+	})
+
+	t.Run("the public IP should be upgraded after the service is detached", func(t *testing.T) {
+		pipID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/pip1"
+		service := getTestService("svc1", v1.ProtocolTCP, map[string]string{
+			consts.ServiceAnnotationLoadBalancerSkuMigrationState:    consts.LoadBalancerSkuMigrationStateDetached,
+			consts.ServiceAnnotationLoadBalancerSkuMigrationSnapshot: fmt.Sprintf(`{"loadBalancerName":"kubernetes","frontendIPConfigurationName":"asvc1","publicIPAddressID":"%s","ipAddress":"1.2.3.4"}`, pipID),
+		}, false, 80)
+		az, _ := getTestMigrationCloud(ctrl, &service)
+		mockLBsClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+		mockLBsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.LoadBalancer{}, nil)
+		mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+		mockPIPsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{{
+			Name: pointer.String("pip1"),
+			ID:   pointer.String(pipID),
+			Sku:  &network.PublicIPAddressSku{Name: network.PublicIPAddressSkuNameBasic},
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+				PublicIPAllocationMethod: network.Static,
+				IPAddress:                pointer.String("1.2.3.4"),
+			},
+		}}, nil)
+		mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "pip1", gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, rg, name string, pip network.PublicIPAddress, _ string) error {
+				assert.Equal(t, network.PublicIPAddressSkuNameStandard, pip.Sku.Name)
+				assert.Equal(t, "1.2.3.4", pointer.StringDeref(pip.IPAddress, ""))
+				return nil
+			})
+
+		err := az.migrateLoadBalancerSku("kubernetes", &service, []*v1.Node{})
+		assert.NoError(t, err)
+		assert.Equal(t, consts.LoadBalancerSkuMigrationStatePublicIPUpgraded, service.Annotations[consts.ServiceAnnotationLoadBalancerSkuMigrationState])
+	})
+
+	t.Run("the load balancers should not be listed again after the migration", func(t *testing.T) {
+		service := getTestService("svc1", v1.ProtocolTCP, nil, false, 80)
+		az, _ := getTestMigrationCloud(ctrl, &service)
+		mockLBsClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+		mockLBsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.LoadBalancer{
+			{Name: pointer.String("kubernetes"), Sku: &network.LoadBalancerSku{Name: network.LoadBalancerSkuNameStandard}},
+		}, nil).Times(1)
+
+		assert.NoError(t, az.migrateLoadBalancerSku("kubernetes", &service, []*v1.Node{}))
+		assert.NoError(t, az.migrateLoadBalancerSku("kubernetes", &service, []*v1.Node{}))
+		assert.Empty(t, service.Annotations[consts.ServiceAnnotationLoadBalancerSkuMigrationState])
+	})
+}
+
+func TestCompleteLoadBalancerSkuMigration(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	service := getInternalTestService("svc1", 80, 443)
+	service.Annotations[consts.ServiceAnnotationLoadBalancerSkuMigrationState] = consts.LoadBalancerSkuMigrationStateDetached
+	service.Annotations[consts.ServiceAnnotationLoadBalancerSkuMigrationSnapshot] = `{"loadBalancerName":"kubernetes-internal","frontendIPConfigurationName":"asvc1","loadBalancingRules":["asvc1-TCP-80","asvc1-TCP-8080"]}`
+	az, _ := getTestMigrationCloud(ctrl, &service)
+	recorder := az.eventRecorder.(*record.FakeRecorder)
+	lb := getTestBasicLoadBalancer("kubernetes-internal", "asvc1")
+	lb.Sku = &network.LoadBalancerSku{Name: network.LoadBalancerSkuNameStandard}
+
+	assert.NoError(t, az.completeLoadBalancerSkuMigration(&service, &lb))
+	updated, err := az.KubeClient.CoreV1().Services("default").Get(context.TODO(), "svc1", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, consts.LoadBalancerSkuMigrationStateCompleted, updated.Annotations[consts.ServiceAnnotationLoadBalancerSkuMigrationState])
+	assert.NotContains(t, updated.Annotations, consts.ServiceAnnotationLoadBalancerSkuMigrationSnapshot)
+	assert.Len(t, recorder.Events, 2)
+	assert.Contains(t, <-recorder.Events, "asvc1-TCP-8080")
+
+	// The completed migration should not be touched again.
+	assert.NoError(t, az.completeLoadBalancerSkuMigration(&service, &lb))
+	assert.Len(t, recorder.Events, 1)
+}
+
+func TestSetLBDefaultsWithLoadBalancerSkuMigration(t *testing.T) {
+	az := &Cloud{}
+	config := &Config{
+		LoadBalancerSku:                consts.LoadBalancerSkuBasic,
+		EnableLoadBalancerSkuMigration: true,
+	}
+	assert.EqualError(t, az.setLBDefaults(config), "enableLoadBalancerSkuMigration should only set when loadBalancerSku is standard")
+}
@@ -0,0 +1,253 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+const (
+	planOperationCreateOrUpdate = "CreateOrUpdate"
+	planOperationDelete         = "Delete"
+
+	planResourceLoadBalancer             = "LoadBalancer"
+	planResourceLoadBalancerBackendPool  = "LoadBalancerBackendPool"
+	planResourceSecurityGroup            = "NetworkSecurityGroup"
+	planResourcePublicIP                 = "PublicIPAddress"
+	planResourcePrivateLinkService       = "PrivateLinkService"
+	planResourcePrivateEndpointConn      = "PrivateEndpointConnection"
+	planResourceSubnet                   = "Subnet"
+	planResourceApplicationGateway       = "ApplicationGateway"
+	planResourceGlobalLoadBalancer       = "GlobalLoadBalancer"
+	planResourceApplicationSecurityGroup = "ApplicationSecurityGroup"
+	planResourceDNSRecordSet             = "DNSRecordSet"
+	// planResourceVMSetBackendPool is the backend pool membership of the VMs, VMSS or NICs of the nodes,
+	// which is updated through the VMSet instead of the load balancer.
+	planResourceVMSetBackendPool = "VMSetBackendPool"
+
+	// planEventReason is the reason of the event reporting the planned changes of a service.
+	planEventReason = "LoadBalancerDryRun"
+)
+
+// plannedChange is a mutation that would have been sent to ARM if the service were not reconciled in plan mode.
+type plannedChange struct {
+	Operation     string      `json:"operation"`
+	ResourceType  string      `json:"resourceType"`
+	ResourceGroup string      `json:"resourceGroup,omitempty"`
+	Name          string      `json:"name"`
+	Existing      interface{} `json:"existing,omitempty"`
+	Desired       interface{} `json:"desired,omitempty"`
+}
+
+// loadBalancerPlan holds all planned changes of one service reconciliation.
+type loadBalancerPlan struct {
+	// lock guards Changes since public IPs are updated or deleted concurrently.
+	lock    sync.Mutex
+	Service string          `json:"service"`
+	Changes []plannedChange `json:"changes"`
+}
+
+// isLoadBalancerDryRun returns true if the load balancer of the service should be reconciled in plan mode,
+// either because it is enabled in the cloud config or by the service annotation.
+func (az *Cloud) isLoadBalancerDryRun(service *v1.Service) bool {
+	return az.LoadBalancerDryRun || consts.IsK8sServiceLoadBalancerDryRun(service)
+}
+
+// startLoadBalancerPlan starts collecting the planned changes of the service if plan mode is enabled.
+// The plan is scoped to the service, so the writes of the background controllers and of the other
+// services are still applied to Azure while the service is reconciled in plan mode.
+func (az *Cloud) startLoadBalancerPlan(service *v1.Service) bool {
+	if !az.isLoadBalancerDryRun(service) {
+		return false
+	}
+
+	serviceName := getServiceName(service)
+	az.lbPlans.Store(serviceName, &loadBalancerPlan{
+		Service: serviceName,
+		Changes: []plannedChange{},
+	})
+	return true
+}
+
+// getLoadBalancerPlan returns the plan of the service, or nil if the service is not reconciled in plan mode.
+func (az *Cloud) getLoadBalancerPlan(service *v1.Service) *loadBalancerPlan {
+	if service == nil {
+		return nil
+	}
+	plan, ok := az.lbPlans.Load(getServiceName(service))
+	if !ok {
+		return nil
+	}
+	return plan.(*loadBalancerPlan)
+}
+
+// inLoadBalancerPlan returns true if the service is being reconciled in plan mode.
+func (az *Cloud) inLoadBalancerPlan(service *v1.Service) bool {
+	return az.getLoadBalancerPlan(service) != nil
+}
+
+// planChange records the change in the plan of the service instead of applying it to Azure.
+func (az *Cloud) planChange(service *v1.Service, operation, resourceType, resourceGroup, name string, existing, desired interface{}) {
+	plan := az.getLoadBalancerPlan(service)
+	if plan == nil {
+		return
+	}
+	plan.lock.Lock()
+	defer plan.lock.Unlock()
+
+	klog.V(2).Infof("planChange(%s): %s %s %s/%s", plan.Service, operation, resourceType, resourceGroup, name)
+	change := plannedChange{
+		Operation:     operation,
+		ResourceType:  resourceType,
+		ResourceGroup: resourceGroup,
+		Name:          name,
+		Existing:      existing,
+		Desired:       desired,
+	}
+
+	// The same resource may be reconciled more than once in a service reconciliation
+	// since the planned changes are never written, e.g. the public IP is ensured by both
+	// reconcileLoadBalancer and reconcilePublicIP. Only the latest change is kept.
+	for i := range plan.Changes {
+		c := plan.Changes[i]
+		if strings.EqualFold(c.Operation, operation) &&
+			strings.EqualFold(c.ResourceType, resourceType) &&
+			strings.EqualFold(c.ResourceGroup, resourceGroup) &&
+			strings.EqualFold(c.Name, name) {
+			plan.Changes[i] = change
+			return
+		}
+	}
+	plan.Changes = append(plan.Changes, change)
+}
+
+// finishLoadBalancerPlan stops collecting the planned changes, logs the full plan in JSON
+// and reports a summary of it in an event on the service.
+func (az *Cloud) finishLoadBalancerPlan(service *v1.Service) *loadBalancerPlan {
+	value, ok := az.lbPlans.LoadAndDelete(getServiceName(service))
+	if !ok {
+		return nil
+	}
+	plan := value.(*loadBalancerPlan)
+	plan.lock.Lock()
+	defer plan.lock.Unlock()
+
+	planJSON, err := json.Marshal(plan)
+	if err != nil {
+		klog.Errorf("finishLoadBalancerPlan(%s): failed to marshal the plan: %v", plan.Service, err)
+	} else {
+		klog.Infof("finishLoadBalancerPlan(%s): %s", plan.Service, string(planJSON))
+	}
+
+	az.Event(service, v1.EventTypeNormal, planEventReason, plan.summary())
+	return plan
+}
+
+// planVMSetBackendPoolChange records the change of the backend pool membership of the nodes of the vmSet, which
+// would update the VMs, VMSS or NICs. The desired state is the names of the nodes joining the pool.
+func (az *Cloud) planVMSetBackendPoolChange(service *v1.Service, operation, backendPoolID, vmSetName string, desired interface{}) {
+	name := backendPoolID
+	if i := strings.Index(strings.ToLower(backendPoolID), "/loadbalancers/"); i >= 0 {
+		name = strings.Replace(backendPoolID[i+len("/loadbalancers/"):], "/backendAddressPools/", "/", 1)
+	}
+	if vmSetName != "" {
+		name = fmt.Sprintf("%s/%s", name, vmSetName)
+	}
+	az.planChange(service, operation, planResourceVMSetBackendPool, az.getLoadBalancerResourceGroup(), name, nil, desired)
+}
+
+// summary returns the planned changes without the resource bodies, which keeps the event message short.
+func (plan *loadBalancerPlan) summary() string {
+	if len(plan.Changes) == 0 {
+		return "no changes planned"
+	}
+
+	changes := make([]string, 0, len(plan.Changes))
+	for _, change := range plan.Changes {
+		changes = append(changes, fmt.Sprintf("%s %s %s/%s", change.Operation, change.ResourceType, change.ResourceGroup, change.Name))
+	}
+	return fmt.Sprintf("%d change(s) planned: %s", len(plan.Changes), strings.Join(changes, ", "))
+}
+
+// The helpers below read the current state of the resources from the caches so that the plan can be
+// reviewed as a diff. A lookup failure is not fatal in plan mode, the existing state is omitted instead.
+
+func (az *Cloud) planExistingLoadBalancer(lbName string) interface{} {
+	lb, exists, err := az.getAzureLoadBalancer(lbName, azcache.CacheReadTypeDefault)
+	if err != nil || !exists {
+		return nil
+	}
+	return lb
+}
+
+func (az *Cloud) planExistingSecurityGroup() interface{} {
+	sg, err := az.getSecurityGroup(azcache.CacheReadTypeDefault)
+	if err != nil {
+		return nil
+	}
+	return sg
+}
+
+func (az *Cloud) planExistingPublicIP(pipResourceGroup, pipName string) interface{} {
+	pip, exists, err := az.getPublicIPAddress(pipResourceGroup, pipName, azcache.CacheReadTypeDefault)
+	if err != nil || !exists {
+		return nil
+	}
+	return pip
+}
+
+func (az *Cloud) planExistingPrivateLinkService(fipConfigID string) interface{} {
+	pls, err := az.getPrivateLinkService(&fipConfigID, azcache.CacheReadTypeDefault)
+	if err != nil || strings.EqualFold(pointer.StringDeref(pls.ID, ""), consts.PrivateLinkServiceNotExistID) {
+		return nil
+	}
+	return pls
+}
+
+func (az *Cloud) planExistingApplicationGateway(gwName string) interface{} {
+	gw, exists, err := az.getApplicationGateway(gwName)
+	if err != nil || !exists {
+		return nil
+	}
+	return gw
+}
+
+func (az *Cloud) planExistingApplicationSecurityGroup(asgName string) interface{} {
+	asg, exists, err := az.getApplicationSecurityGroup(asgName)
+	if err != nil || !exists {
+		return nil
+	}
+	return asg
+}
+
+func (az *Cloud) planExistingGlobalLoadBalancer(lbName string) interface{} {
+	lb, exists, err := az.getGlobalLoadBalancer(lbName)
+	if err != nil || !exists {
+		return nil
+	}
+	return lb
+}
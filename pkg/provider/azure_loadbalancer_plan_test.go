@@ -0,0 +1,280 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-03-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/interfaceclient/mockinterfaceclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/privatelinkserviceclient/mockprivatelinkserviceclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/securitygroupclient/mocksecuritygroupclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssclient/mockvmssclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssvmclient/mockvmssvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestIsLoadBalancerDryRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, tc := range []struct {
+		desc         string
+		configDryRun bool
+		annotations  map[string]string
+		expected     bool
+	}{
+		{
+			desc:     "plan mode should be disabled by default",
+			expected: false,
+		},
+		{
+			desc:         "plan mode should be enabled by the config",
+			configDryRun: true,
+			expected:     true,
+		},
+		{
+			desc:        "plan mode should be enabled by the service annotation",
+			annotations: map[string]string{consts.ServiceAnnotationLoadBalancerDryRun: consts.TrueAnnotationValue},
+			expected:    true,
+		},
+		{
+			desc:        "plan mode should be disabled if the annotation is not true",
+			annotations: map[string]string{consts.ServiceAnnotationLoadBalancerDryRun: "false"},
+			expected:    false,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			az.LoadBalancerDryRun = tc.configDryRun
+			svc := getTestService("service1", v1.ProtocolTCP, tc.annotations, false, 80)
+			assert.Equal(t, tc.expected, az.isLoadBalancerDryRun(&svc))
+		})
+	}
+}
+
+func TestPlanChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	recorder := record.NewFakeRecorder(1)
+	az.eventRecorder = recorder
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+
+	otherSvc := getTestService("service2", v1.ProtocolTCP, nil, false, 80)
+
+	assert.False(t, az.startLoadBalancerPlan(&svc))
+	assert.False(t, az.inLoadBalancerPlan(&svc))
+
+	az.LoadBalancerDryRun = true
+	assert.True(t, az.startLoadBalancerPlan(&svc))
+	assert.True(t, az.inLoadBalancerPlan(&svc))
+	az.planChange(&svc, planOperationDelete, planResourcePublicIP, "rg", "pip", nil, nil)
+	az.planChange(&svc, planOperationDelete, planResourcePublicIP, "rg", "pip", nil, nil)
+
+	// The writes of the other services and of the background controllers are not planned.
+	assert.False(t, az.inLoadBalancerPlan(&otherSvc))
+	assert.False(t, az.inLoadBalancerPlan(nil))
+	az.planChange(&otherSvc, planOperationDelete, planResourcePublicIP, "rg", "pip2", nil, nil)
+	az.planChange(nil, planOperationDelete, planResourcePublicIP, "rg", "pip3", nil, nil)
+
+	plan := az.finishLoadBalancerPlan(&svc)
+	assert.False(t, az.inLoadBalancerPlan(&svc))
+	assert.Equal(t, []plannedChange{
+		{
+			Operation:     planOperationDelete,
+			ResourceType:  planResourcePublicIP,
+			ResourceGroup: "rg",
+			Name:          "pip",
+		},
+	}, plan.Changes)
+	assert.Equal(t, "Normal LoadBalancerDryRun 1 change(s) planned: Delete PublicIPAddress rg/pip", <-recorder.Events)
+}
+
+func TestEnsureLoadBalancerDryRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	recorder := record.NewFakeRecorder(1)
+	az.eventRecorder = recorder
+	clusterResources, expectedInterfaces, expectedVirtualMachines := getClusterResources(az, 1, 1)
+	setMockEnv(az, ctrl, expectedInterfaces, expectedVirtualMachines, 1)
+
+	svc := getTestService("service1", v1.ProtocolTCP, map[string]string{
+		consts.ServiceAnnotationLoadBalancerDryRun: consts.TrueAnnotationValue,
+	}, false, 80)
+	svc.Status.LoadBalancer = v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "1.2.3.4"}}}
+
+	notFound := &retry.Error{HTTPStatusCode: http.StatusNotFound, RawError: cloudprovider.InstanceNotFound}
+	mockLBsClient := mockloadbalancerclient.NewMockInterface(ctrl)
+	az.LoadBalancerClient = mockLBsClient
+	mockLBsClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	mockLBsClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(network.LoadBalancer{}, notFound).AnyTimes()
+	mockLBsClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	mockPIPsClient := mockpublicipclient.NewMockInterface(ctrl)
+	az.PublicIPAddressesClient = mockPIPsClient
+	mockPIPsClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	mockSGsClient := mocksecuritygroupclient.NewMockInterface(ctrl)
+	az.SecurityGroupsClient = mockSGsClient
+	mockSGsClient.EXPECT().Get(gomock.Any(), az.SecurityGroupResourceGroup, az.SecurityGroupName, gomock.Any()).Return(*getTestSecurityGroup(az), nil).AnyTimes()
+	mockSGsClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	mockLBBackendPool := az.LoadBalancerBackendPool.(*MockBackendPool)
+	mockLBBackendPool.EXPECT().ReconcileBackendPools(gomock.Any(), gomock.Any(), gomock.Any()).Return(false, false, nil).AnyTimes()
+	mockLBBackendPool.EXPECT().EnsureHostsInPool(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	lbStatus, err := az.EnsureLoadBalancer(context.TODO(), testClusterName, &svc, clusterResources.nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, &svc.Status.LoadBalancer, lbStatus)
+	assert.False(t, az.inLoadBalancerPlan(&svc))
+
+	event := <-recorder.Events
+	assert.True(t, strings.HasPrefix(event, "Normal LoadBalancerDryRun 4 change(s) planned"), event)
+	assert.Contains(t, event, "CreateOrUpdate PublicIPAddress rg/testCluster-aservice1")
+	assert.Contains(t, event, "CreateOrUpdate LoadBalancer rg/testCluster")
+	assert.Contains(t, event, "CreateOrUpdate VMSetBackendPool rg/testCluster/testCluster/as")
+	assert.Contains(t, event, "CreateOrUpdate NetworkSecurityGroup rg/nsg")
+}
+
+func TestEnsurePublicIPExistsDryRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	plan := &loadBalancerPlan{Service: "default/service1"}
+	az.lbPlans.Store(plan.Service, plan)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+
+	mockPIPsClient := mockpublicipclient.NewMockInterface(ctrl)
+	az.PublicIPAddressesClient = mockPIPsClient
+	mockPIPsClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	mockPIPsClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	pip, err := az.ensurePublicIPExists(&svc, "pip1", "", "", false, false)
+	assert.NoError(t, err)
+	assert.Equal(t, pointer.String(az.getPublicIPAddressID("rg", "pip1")), pip.ID)
+	assert.Equal(t, 1, len(plan.Changes))
+	assert.Nil(t, plan.Changes[0].Existing)
+}
+
+func TestCleanOrphanedLoadBalancerDryRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	ss, err := newScaleSet(context.Background(), az)
+	assert.NoError(t, err)
+	az.VMSet = ss
+	az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+	plan := &loadBalancerPlan{Service: "default/test"}
+	az.lbPlans.Store(plan.Service, plan)
+
+	expectedVMSS := buildTestVMSSWithLB(testVMSSName, "vmss-vm-", []string{testLBBackendpoolID0}, false)
+	mockVMSSClient := az.VirtualMachineScaleSetsClient.(*mockvmssclient.MockInterface)
+	mockVMSSClient.EXPECT().List(gomock.Any(), gomock.Any()).Return([]compute.VirtualMachineScaleSet{expectedVMSS}, nil).AnyTimes()
+	mockVMSSClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	mockVMSSClient.EXPECT().CreateOrUpdateAsync(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	mockVMSSVMClient := az.VirtualMachineScaleSetVMsClient.(*mockvmssvmclient.MockInterface)
+	mockVMSSVMClient.EXPECT().List(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	mockVMSSVMClient.EXPECT().UpdateVMs(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	mockNICClient := mockinterfaceclient.NewMockInterface(ctrl)
+	az.InterfacesClient = mockNICClient
+	mockNICClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(network.LoadBalancer{}, nil).AnyTimes()
+	mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	mockLBClient.EXPECT().Delete(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	service := getTestService("test", v1.ProtocolTCP, nil, false, 80)
+	lb := getTestLoadBalancer(pointer.String("test"), pointer.String("rg"), pointer.String("test"), pointer.String("test"), service, consts.LoadBalancerSkuStandard)
+	(*lb.BackendAddressPools)[0].ID = pointer.String(testLBBackendpoolID0)
+
+	err = az.cleanOrphanedLoadBalancer(&lb, []network.LoadBalancer{{Name: pointer.String("test")}}, &service, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(plan.Changes))
+	assert.Equal(t, planResourceVMSetBackendPool, plan.Changes[0].ResourceType)
+	assert.Equal(t, planOperationDelete, plan.Changes[0].Operation)
+	assert.Equal(t, planResourceLoadBalancer, plan.Changes[1].ResourceType)
+	assert.Equal(t, planOperationDelete, plan.Changes[1].Operation)
+}
+
+func TestEnsureLoadBalancerDeletedDryRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	recorder := record.NewFakeRecorder(1)
+	az.eventRecorder = recorder
+	_, expectedInterfaces, expectedVirtualMachines := getClusterResources(az, 1, 1)
+	setMockEnv(az, ctrl, expectedInterfaces, expectedVirtualMachines, 1)
+
+	svc := getTestService("service1", v1.ProtocolTCP, map[string]string{
+		consts.ServiceAnnotationLoadBalancerDryRun: consts.TrueAnnotationValue,
+	}, false, 80)
+	lb := getTestLoadBalancer(pointer.String(testClusterName), pointer.String("rg"), pointer.String(testClusterName), pointer.String("aservice1"), svc, consts.LoadBalancerSkuStandard)
+
+	mockLBsClient := mockloadbalancerclient.NewMockInterface(ctrl)
+	az.LoadBalancerClient = mockLBsClient
+	mockLBsClient.EXPECT().List(gomock.Any(), gomock.Any()).Return([]network.LoadBalancer{lb}, nil).AnyTimes()
+	mockLBsClient.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(lb, nil).AnyTimes()
+	mockLBsClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	mockLBsClient.EXPECT().Delete(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPsClient.EXPECT().Delete(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	mockSGsClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	mockSGsClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	mockPLSClient := az.PrivateLinkServiceClient.(*mockprivatelinkserviceclient.MockInterface)
+	mockPLSClient.EXPECT().List(gomock.Any(), gomock.Any()).Return([]network.PrivateLinkService{}, nil).AnyTimes()
+
+	mockVMSet := NewMockVMSet(ctrl)
+	mockVMSet.EXPECT().GetPrimaryVMSetName().Return("as").AnyTimes()
+	mockVMSet.EXPECT().EnsureBackendPoolDeleted(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	mockVMSet.EXPECT().EnsureBackendPoolDeletedFromVMSets(gomock.Any(), gomock.Any()).Times(0)
+	az.VMSet = mockVMSet
+	mockLBBackendPool := az.LoadBalancerBackendPool.(*MockBackendPool)
+	mockLBBackendPool.EXPECT().ReconcileBackendPools(gomock.Any(), gomock.Any(), gomock.Any()).Return(false, false, nil).AnyTimes()
+
+	err := az.EnsureLoadBalancerDeleted(context.TODO(), testClusterName, &svc)
+	assert.NoError(t, err)
+	assert.False(t, az.inLoadBalancerPlan(&svc))
+
+	event := <-recorder.Events
+	assert.True(t, strings.HasPrefix(event, "Normal LoadBalancerDryRun"), event)
+	assert.Contains(t, event, "LoadBalancer rg/testCluster")
+}
@@ -0,0 +1,287 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func validateLoadBalancerProfiles(config *Config) error {
+	if !config.EnableMultipleStandardLoadBalancers {
+		return errors.New("loadBalancerProfiles should only set when enableMultipleStandardLoadBalancers is true")
+	}
+
+	names := sets.NewString()
+	for _, profile := range config.LoadBalancerProfiles {
+		if profile.Name == "" {
+			return errors.New("loadBalancerProfiles: the name of the profile should not be empty")
+		}
+		if strings.HasSuffix(strings.ToLower(profile.Name), consts.InternalLoadBalancerNameSuffix) {
+			return fmt.Errorf("loadBalancerProfiles: the name of the profile %s should not end with %s", profile.Name, consts.InternalLoadBalancerNameSuffix)
+		}
+		if names.Has(strings.ToLower(profile.Name)) {
+			return fmt.Errorf("loadBalancerProfiles: the name of the profile %s is duplicated", profile.Name)
+		}
+		names.Insert(strings.ToLower(profile.Name))
+
+		for _, selector := range []*metav1.LabelSelector{profile.NodeSelector, profile.ServiceNamespaceSelector, profile.ServiceLabelSelector} {
+			if _, err := metav1.LabelSelectorAsSelector(selector); err != nil {
+				return fmt.Errorf("loadBalancerProfiles: invalid label selector of the profile %s: %w", profile.Name, err)
+			}
+		}
+		if profile.MaximumLoadBalancerRuleCount < 0 {
+			return fmt.Errorf("loadBalancerProfiles: maximumLoadBalancerRuleCount of the profile %s should not be negative", profile.Name)
+		}
+	}
+	return nil
+}
+
+// useLoadBalancerProfiles returns true if the multiple standard load balancers are described by the profiles
+// instead of being one per VMAS or VMSS.
+func (az *Cloud) useLoadBalancerProfiles() bool {
+	return az.useStandardLoadBalancer() && az.EnableMultipleStandardLoadBalancers && len(az.LoadBalancerProfiles) > 0
+}
+
+// getLoadBalancerVMSetName returns the vmSet of the load balancer, which is empty if the nodes
+// of the load balancer are selected by the profiles instead of their vmSets.
+func (az *Cloud) getLoadBalancerVMSetName(lbName, clusterName string) string {
+	if az.useLoadBalancerProfiles() {
+		return ""
+	}
+	return az.mapLoadBalancerNameToVMSet(lbName, clusterName)
+}
+
+// getLoadBalancerProfile returns the profile of the internal or external load balancer, or nil if there is none.
+func (az *Cloud) getLoadBalancerProfile(lbName string) *LoadBalancerProfile {
+	if !az.useLoadBalancerProfiles() {
+		return nil
+	}
+
+	name := strings.TrimSuffix(strings.ToLower(lbName), consts.InternalLoadBalancerNameSuffix)
+	for i := range az.LoadBalancerProfiles {
+		if strings.EqualFold(az.LoadBalancerProfiles[i].Name, name) {
+			return &az.LoadBalancerProfiles[i]
+		}
+	}
+	return nil
+}
+
+// getLoadBalancerProfileRuleLimit returns the maximum number of rules of the load balancer of the profile.
+func (az *Cloud) getLoadBalancerProfileRuleLimit(profile *LoadBalancerProfile) int {
+	if profile.MaximumLoadBalancerRuleCount > 0 {
+		return profile.MaximumLoadBalancerRuleCount
+	}
+	return az.MaximumLoadBalancerRuleCount
+}
+
+// isNodeSelectedByLoadBalancer returns true if the node should be in the backend pool of the load balancer.
+// The nodes are always selected if the load balancer has no profile.
+func (az *Cloud) isNodeSelectedByLoadBalancer(lbName string, node *v1.Node) bool {
+	profile := az.getLoadBalancerProfile(lbName)
+	if profile == nil || profile.NodeSelector == nil {
+		return true
+	}
+
+	// The selectors have been validated with the config.
+	selector, _ := metav1.LabelSelectorAsSelector(profile.NodeSelector)
+	return selector.Matches(labels.Set(node.Labels))
+}
+
+// isNodeNameSelectedByLoadBalancer is isNodeSelectedByLoadBalancer for the nodes found in the backend pools.
+// The unknown nodes are kept as they are.
+func (az *Cloud) isNodeNameSelectedByLoadBalancer(lbName, nodeName string) bool {
+	profile := az.getLoadBalancerProfile(lbName)
+	if profile == nil || profile.NodeSelector == nil || az.nodeLister == nil || nodeName == "" {
+		return true
+	}
+
+	node, err := az.nodeLister.Get(nodeName)
+	if err != nil {
+		klog.V(4).Infof("isNodeNameSelectedByLoadBalancer: failed to get node %s, keeping it in the load balancer %s: %v", nodeName, lbName, err)
+		return true
+	}
+	return az.isNodeSelectedByLoadBalancer(lbName, node)
+}
+
+// filterNodesByLoadBalancer returns the nodes that should be in the backend pool of the load balancer.
+func (az *Cloud) filterNodesByLoadBalancer(lbName string, nodes []*v1.Node) []*v1.Node {
+	if az.getLoadBalancerProfile(lbName) == nil {
+		return nodes
+	}
+
+	selectedNodes := make([]*v1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if az.isNodeSelectedByLoadBalancer(lbName, node) {
+			selectedNodes = append(selectedNodes, node)
+		}
+	}
+	return selectedNodes
+}
+
+// getServiceLoadBalancerProfiles returns the profiles on which the service can be placed, in the order of the
+// config. The services pinned by the annotation can only be placed on the given profiles, the other ones on the
+// profiles allowing the service placement. Both need to match the service selectors of the profiles.
+func (az *Cloud) getServiceLoadBalancerProfiles(service *v1.Service) ([]*LoadBalancerProfile, error) {
+	pinnedProfiles := sets.NewString()
+	if value, found := service.Annotations[consts.ServiceAnnotationLoadBalancerProfiles]; found {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if az.getLoadBalancerProfile(name) == nil {
+				return nil, fmt.Errorf("load balancer profile %q of annotation %s is not found", name, consts.ServiceAnnotationLoadBalancerProfiles)
+			}
+			pinnedProfiles.Insert(strings.ToLower(name))
+		}
+	}
+
+	var namespaceLabels labels.Set
+	var profiles []*LoadBalancerProfile
+	for i := range az.LoadBalancerProfiles {
+		profile := &az.LoadBalancerProfiles[i]
+		if pinnedProfiles.Len() > 0 {
+			if !pinnedProfiles.Has(strings.ToLower(profile.Name)) {
+				continue
+			}
+		} else if !pointer.BoolDeref(profile.AllowServicePlacement, true) {
+			continue
+		}
+
+		if profile.ServiceLabelSelector != nil {
+			selector, _ := metav1.LabelSelectorAsSelector(profile.ServiceLabelSelector)
+			if !selector.Matches(labels.Set(service.Labels)) {
+				continue
+			}
+		}
+		if profile.ServiceNamespaceSelector != nil {
+			if namespaceLabels == nil {
+				if az.namespaceLister == nil {
+					return nil, errors.New("the namespace informer is not set up")
+				}
+				namespace, err := az.namespaceLister.Get(service.Namespace)
+				if err != nil {
+					return nil, fmt.Errorf("failed to get namespace %s: %w", service.Namespace, err)
+				}
+				namespaceLabels = labels.Set(namespace.Labels)
+			}
+			selector, _ := metav1.LabelSelectorAsSelector(profile.ServiceNamespaceSelector)
+			if !selector.Matches(namespaceLabels) {
+				continue
+			}
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, nil
+}
+
+// selectLoadBalancerByProfile selects the load balancer of the service among its profiles. The one with the fewest
+// rules below its limit is selected, and the load balancers not created yet have no rules.
+func (az *Cloud) selectLoadBalancerByProfile(clusterName string, service *v1.Service, existingLBs *[]network.LoadBalancer) (*network.LoadBalancer, bool, error) {
+	isInternal := requiresInternalLoadBalancer(service)
+	serviceName := getServiceName(service)
+	profiles, err := az.getServiceLoadBalancerProfiles(service)
+	if err != nil {
+		return nil, false, fmt.Errorf("selectLoadBalancerByProfile: cluster(%s) service(%s): %w", clusterName, serviceName, err)
+	}
+	if len(profiles) == 0 {
+		return nil, false, fmt.Errorf("selectLoadBalancerByProfile: cluster(%s) service(%s) isInternal(%t) - no load balancer profile can place the service", clusterName, serviceName, isInternal)
+	}
+
+	mapExistingLBs := map[string]network.LoadBalancer{}
+	for _, lb := range *existingLBs {
+		mapExistingLBs[strings.ToLower(pointer.StringDeref(lb.Name, ""))] = lb
+	}
+
+	var selectedLB *network.LoadBalancer
+	var existsLB bool
+	selectedLBRuleCount := math.MaxInt32
+	for _, profile := range profiles {
+		lbName := profile.Name
+		if isInternal {
+			lbName = fmt.Sprintf("%s%s", lbName, consts.InternalLoadBalancerNameSuffix)
+		}
+
+		lb, exists := mapExistingLBs[strings.ToLower(lbName)]
+		ruleCount := 0
+		if exists && lb.LoadBalancerPropertiesFormat != nil && lb.LoadBalancingRules != nil {
+			ruleCount = len(*lb.LoadBalancingRules)
+		}
+		if ruleCount >= az.getLoadBalancerProfileRuleLimit(profile) {
+			klog.V(4).Infof("selectLoadBalancerByProfile: cluster(%s) service(%s) - the load balancer %s has reached its rule limit", clusterName, serviceName, lbName)
+			continue
+		}
+		if ruleCount >= selectedLBRuleCount {
+			continue
+		}
+
+		selectedLBRuleCount = ruleCount
+		existsLB = exists
+		if exists {
+			selectedLB = &lb
+		} else {
+			selectedLB = az.newLoadBalancer(lbName)
+		}
+	}
+
+	if selectedLB == nil {
+		return nil, false, fmt.Errorf("selectLoadBalancerByProfile: cluster(%s) service(%s) isInternal(%t) - all the load balancers of its profiles have reached their rule limits", clusterName, serviceName, isInternal)
+	}
+	klog.V(2).Infof("selectLoadBalancerByProfile: cluster(%s) service(%s) isInternal(%t) - selected load balancer %s", clusterName, serviceName, isInternal, pointer.StringDeref(selectedLB.Name, ""))
+	return selectedLB, existsLB, nil
+}
+
+// shouldMoveServiceByProfile returns true if the service should be moved away from its current load balancer
+// because the profile of the load balancer no longer accepts it. The services whose IP would change are not moved:
+// the public IPs are kept and attached to the new load balancer, but the dynamic private IPs are released.
+func (az *Cloud) shouldMoveServiceByProfile(service *v1.Service, currLBName string) bool {
+	currProfile := az.getLoadBalancerProfile(currLBName)
+	profiles, err := az.getServiceLoadBalancerProfiles(service)
+	if err != nil {
+		klog.Warningf("shouldMoveServiceByProfile(%s, %s): keeping the service on its load balancer: %v", getServiceName(service), currLBName, err)
+		return false
+	}
+	for _, profile := range profiles {
+		if profile == currProfile {
+			return false
+		}
+	}
+
+	if requiresInternalLoadBalancer(service) && getServiceLoadBalancerIP(service) == "" {
+		message := fmt.Sprintf("The service should be moved away from the load balancer %s, but its dynamic private IP would change. Set its load balancer IP to move it.", currLBName)
+		klog.Warningf("shouldMoveServiceByProfile(%s, %s): %s", getServiceName(service), currLBName, message)
+		az.Event(service, v1.EventTypeWarning, "MoveLoadBalancer", message)
+		return false
+	}
+
+	klog.V(2).Infof("shouldMoveServiceByProfile(%s, %s): moving the service to another load balancer", getServiceName(service), currLBName)
+	return true
+}
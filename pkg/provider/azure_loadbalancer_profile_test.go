@@ -0,0 +1,409 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-03-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssclient/mockvmssclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/vmssvmclient/mockvmssvmclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func getTestProfileCloud(ctrl *gomock.Controller, profiles ...LoadBalancerProfile) *Cloud {
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+	az.EnableMultipleStandardLoadBalancers = true
+	az.MaximumLoadBalancerRuleCount = 250
+	az.LoadBalancerProfiles = profiles
+	return az
+}
+
+func getTestLoadBalancerWithRules(name string, ruleCount int) network.LoadBalancer {
+	rules := make([]network.LoadBalancingRule, ruleCount)
+	return network.LoadBalancer{
+		Name: pointer.String(name),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			LoadBalancingRules: &rules,
+		},
+	}
+}
+
+func TestValidateLoadBalancerProfiles(t *testing.T) {
+	for _, tc := range []struct {
+		desc        string
+		config      Config
+		expectedErr bool
+	}{
+		{
+			desc: "valid profiles should be accepted",
+			config: Config{
+				EnableMultipleStandardLoadBalancers: true,
+				LoadBalancerProfiles: []LoadBalancerProfile{
+					{Name: "kubernetes"},
+					{Name: "lb-1", NodeSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"pool": "1"}}},
+				},
+			},
+		},
+		{
+			desc:        "multiple standard load balancers should be enabled",
+			config:      Config{LoadBalancerProfiles: []LoadBalancerProfile{{Name: "lb-1"}}},
+			expectedErr: true,
+		},
+		{
+			desc: "the names should not be empty",
+			config: Config{
+				EnableMultipleStandardLoadBalancers: true,
+				LoadBalancerProfiles:                []LoadBalancerProfile{{}},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "the names should not be duplicated",
+			config: Config{
+				EnableMultipleStandardLoadBalancers: true,
+				LoadBalancerProfiles:                []LoadBalancerProfile{{Name: "lb-1"}, {Name: "LB-1"}},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "the names should not have the internal suffix",
+			config: Config{
+				EnableMultipleStandardLoadBalancers: true,
+				LoadBalancerProfiles:                []LoadBalancerProfile{{Name: "lb-internal"}},
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "the selectors should be valid",
+			config: Config{
+				EnableMultipleStandardLoadBalancers: true,
+				LoadBalancerProfiles: []LoadBalancerProfile{{
+					Name: "lb-1",
+					ServiceLabelSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+						{Key: "app", Operator: "invalid"},
+					}},
+				}},
+			},
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := validateLoadBalancerProfiles(&tc.config)
+			assert.Equal(t, tc.expectedErr, err != nil, err)
+		})
+	}
+
+	az := &Cloud{}
+	config := &Config{
+		LoadBalancerSku:      consts.LoadBalancerSkuBasic,
+		LoadBalancerProfiles: []LoadBalancerProfile{{Name: "lb-1"}},
+	}
+	assert.Error(t, az.setLBDefaults(config))
+}
+
+func TestGetServiceLoadBalancerProfiles(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	profiles := []LoadBalancerProfile{
+		{Name: "kubernetes"},
+		{
+			Name:                  "lb-team",
+			AllowServicePlacement: pointer.Bool(false),
+		},
+		{
+			Name:                 "lb-web",
+			ServiceLabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "web"}},
+		},
+		{
+			Name:                     "lb-prod",
+			ServiceNamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+		},
+	}
+	for _, tc := range []struct {
+		desc             string
+		annotation       string
+		labels           map[string]string
+		namespaceLabels  map[string]string
+		expectedProfiles []string
+		expectedErr      bool
+	}{
+		{
+			desc:             "the profiles allowing the placement should be selected",
+			expectedProfiles: []string{"kubernetes"},
+		},
+		{
+			desc:             "the service labels and the namespace labels should be matched",
+			labels:           map[string]string{"tier": "web"},
+			namespaceLabels:  map[string]string{"env": "prod"},
+			expectedProfiles: []string{"kubernetes", "lb-web", "lb-prod"},
+		},
+		{
+			desc:             "the pinned profiles should be selected even if they do not allow the placement",
+			annotation:       "lb-team, lb-web",
+			expectedProfiles: []string{"lb-team"},
+		},
+		{
+			desc:        "unknown pinned profiles should be reported",
+			annotation:  "lb-unknown",
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			az := getTestProfileCloud(ctrl, profiles...)
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			assert.NoError(t, indexer.Add(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default", Labels: tc.namespaceLabels}}))
+			az.namespaceLister = corelisters.NewNamespaceLister(indexer)
+
+			service := getTestService("svc-1", v1.ProtocolTCP, nil, false, 80)
+			service.Labels = tc.labels
+			if tc.annotation != "" {
+				service.Annotations[consts.ServiceAnnotationLoadBalancerProfiles] = tc.annotation
+			}
+			selected, err := az.getServiceLoadBalancerProfiles(&service)
+			assert.Equal(t, tc.expectedErr, err != nil, err)
+			var names []string
+			for _, profile := range selected {
+				names = append(names, profile.Name)
+			}
+			assert.Equal(t, tc.expectedProfiles, names)
+		})
+	}
+}
+
+func TestSelectLoadBalancerByProfile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, tc := range []struct {
+		desc           string
+		profiles       []LoadBalancerProfile
+		existingLBs    []network.LoadBalancer
+		internal       bool
+		expectedLBName string
+		expectedExists bool
+		expectedErr    bool
+	}{
+		{
+			desc:           "the load balancer with the fewest rules should be selected",
+			profiles:       []LoadBalancerProfile{{Name: "kubernetes"}, {Name: "lb-1"}},
+			existingLBs:    []network.LoadBalancer{getTestLoadBalancerWithRules("kubernetes", 5), getTestLoadBalancerWithRules("lb-1", 2)},
+			expectedLBName: "lb-1",
+			expectedExists: true,
+		},
+		{
+			desc:           "a load balancer to be created should be selected",
+			profiles:       []LoadBalancerProfile{{Name: "kubernetes"}, {Name: "lb-1"}},
+			existingLBs:    []network.LoadBalancer{getTestLoadBalancerWithRules("kubernetes", 5)},
+			expectedLBName: "lb-1",
+		},
+		{
+			desc:           "the internal load balancer should be selected for internal services",
+			profiles:       []LoadBalancerProfile{{Name: "kubernetes"}, {Name: "lb-1"}},
+			existingLBs:    []network.LoadBalancer{getTestLoadBalancerWithRules("kubernetes-internal", 0), getTestLoadBalancerWithRules("lb-1", 0)},
+			internal:       true,
+			expectedLBName: "kubernetes-internal",
+			expectedExists: true,
+		},
+		{
+			desc:           "the load balancers reaching the rule limit of their profiles should be skipped",
+			profiles:       []LoadBalancerProfile{{Name: "kubernetes"}, {Name: "lb-1", MaximumLoadBalancerRuleCount: 2}},
+			existingLBs:    []network.LoadBalancer{getTestLoadBalancerWithRules("kubernetes", 5), getTestLoadBalancerWithRules("lb-1", 2)},
+			expectedLBName: "kubernetes",
+			expectedExists: true,
+		},
+		{
+			desc:        "an error should be reported if all the load balancers are full",
+			profiles:    []LoadBalancerProfile{{Name: "kubernetes", MaximumLoadBalancerRuleCount: 5}},
+			existingLBs: []network.LoadBalancer{getTestLoadBalancerWithRules("kubernetes", 5)},
+			expectedErr: true,
+		},
+		{
+			desc:        "an error should be reported if no profile can place the service",
+			profiles:    []LoadBalancerProfile{{Name: "kubernetes", AllowServicePlacement: pointer.Bool(false)}},
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			az := getTestProfileCloud(ctrl, tc.profiles...)
+			service := getTestService("svc-1", v1.ProtocolTCP, nil, false, 80)
+			if tc.internal {
+				service = getInternalTestService("svc-1", 80)
+			}
+			lb, exists, err := az.selectLoadBalancer(testClusterName, &service, &tc.existingLBs, nil)
+			assert.Equal(t, tc.expectedErr, err != nil, err)
+			if !tc.expectedErr {
+				assert.Equal(t, tc.expectedLBName, pointer.StringDeref(lb.Name, ""))
+				assert.Equal(t, tc.expectedExists, exists)
+			}
+		})
+	}
+}
+
+func TestShouldMoveServiceByProfile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	profiles := []LoadBalancerProfile{
+		{Name: "kubernetes"},
+		{Name: "lb-1", AllowServicePlacement: pointer.Bool(false)},
+	}
+	az := getTestProfileCloud(ctrl, profiles...)
+	recorder := record.NewFakeRecorder(10)
+	az.eventRecorder = recorder
+
+	service := getTestService("svc-1", v1.ProtocolTCP, nil, false, 80)
+	assert.False(t, az.shouldChangeLoadBalancer(&service, "kubernetes", testClusterName))
+	assert.True(t, az.shouldChangeLoadBalancer(&service, "lb-1", testClusterName))
+	assert.True(t, az.shouldChangeLoadBalancer(&service, "vmss-1", testClusterName))
+
+	service.Annotations[consts.ServiceAnnotationLoadBalancerProfiles] = "lb-1"
+	assert.False(t, az.shouldChangeLoadBalancer(&service, "lb-1", testClusterName))
+	assert.True(t, az.shouldChangeLoadBalancer(&service, "kubernetes", testClusterName))
+
+	// The dynamic private IP of an internal service would change.
+	internalService := getInternalTestService("svc-2", 80)
+	assert.False(t, az.shouldChangeLoadBalancer(&internalService, "lb-1-internal", testClusterName))
+	assert.Len(t, recorder.Events, 1)
+
+	internalService.Spec.LoadBalancerIP = "10.240.0.10"
+	assert.True(t, az.shouldChangeLoadBalancer(&internalService, "lb-1-internal", testClusterName))
+}
+
+func TestFilterNodesByLoadBalancer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := getTestProfileCloud(ctrl,
+		LoadBalancerProfile{Name: "kubernetes"},
+		LoadBalancerProfile{Name: "lb-1", NodeSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"pool": "1"}}},
+	)
+	nodes := []*v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-0"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{"pool": "1"}}},
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, node := range nodes {
+		assert.NoError(t, indexer.Add(node))
+	}
+	az.nodeLister = corelisters.NewNodeLister(indexer)
+
+	assert.Equal(t, nodes, az.filterNodesByLoadBalancer("kubernetes", nodes))
+	assert.Equal(t, nodes[1:], az.filterNodesByLoadBalancer("lb-1-internal", nodes))
+	assert.True(t, az.isNodeNameSelectedByLoadBalancer("lb-1", "node-1"))
+	assert.False(t, az.isNodeNameSelectedByLoadBalancer("lb-1", "node-0"))
+	assert.True(t, az.isNodeNameSelectedByLoadBalancer("lb-1", "unknown"))
+}
+
+func TestReconcileLoadBalancerByProfileWithVMSS(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := getTestProfileCloud(ctrl, LoadBalancerProfile{Name: testClusterName})
+	ss, err := newScaleSet(context.Background(), az)
+	assert.NoError(t, err)
+	az.VMSet = ss
+	az.LoadBalancerBackendPool = newBackendPoolTypeNodeIPConfig(az)
+	setMockEnv(az, ctrl, nil, nil, 1)
+
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	expectedLBs := make([]network.LoadBalancer, 0)
+	setMockLBs(az, ctrl, &expectedLBs, "service", 1, 1, false)
+	backendPoolID := az.getBackendPoolID(testClusterName, az.getLoadBalancerResourceGroup(), testClusterName)
+
+	// the VMSS of the nodes is walked instead of the VMSS named after the profile
+	expectedVMSS := buildTestVMSSWithLB(testVMSSName, "vmss-vm-", []string{}, false)
+	mockVMSSClient := az.VirtualMachineScaleSetsClient.(*mockvmssclient.MockInterface)
+	mockVMSSClient.EXPECT().List(gomock.Any(), az.ResourceGroup).Return([]compute.VirtualMachineScaleSet{expectedVMSS}, nil).AnyTimes()
+	mockVMSSClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, testVMSSName).Return(expectedVMSS, nil).MaxTimes(1)
+	mockVMSSClient.EXPECT().CreateOrUpdate(gomock.Any(), az.ResourceGroup, testVMSSName, gomock.Any()).DoAndReturn(
+		func(_ interface{}, _, _ string, vmss compute.VirtualMachineScaleSet) *retry.Error {
+			ipConfig := (*(*vmss.VirtualMachineProfile.NetworkProfile.NetworkInterfaceConfigurations)[0].IPConfigurations)[0]
+			assert.Equal(t, &[]compute.SubResource{{ID: pointer.String(backendPoolID)}}, ipConfig.LoadBalancerBackendAddressPools)
+			return nil
+		}).Times(1)
+
+	expectedVMSSVMs, _, _ := buildTestVirtualMachineEnv(az, testVMSSName, "", 0, []string{"vmss-vm-000000"}, "", false)
+	ipConfigs := *(*expectedVMSSVMs[0].NetworkProfileConfiguration.NetworkInterfaceConfigurations)[0].IPConfigurations
+	ipConfigs[0].LoadBalancerBackendAddressPools = nil
+	mockVMSSVMClient := az.VirtualMachineScaleSetVMsClient.(*mockvmssvmclient.MockInterface)
+	mockVMSSVMClient.EXPECT().List(gomock.Any(), az.ResourceGroup, testVMSSName, gomock.Any()).Return(expectedVMSSVMs, nil).AnyTimes()
+	mockVMSSVMClient.EXPECT().UpdateVMs(gomock.Any(), az.ResourceGroup, testVMSSName, gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+	nodes := []*v1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "vmss-vm-000000"},
+			Spec: v1.NodeSpec{
+				ProviderID: "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/vmss/virtualMachines/0",
+			},
+		},
+	}
+	lb, err := az.reconcileLoadBalancer(context.TODO(), testClusterName, &svc, nodes, true /* wantLb */)
+	assert.NoError(t, err)
+	assert.Equal(t, testClusterName, pointer.StringDeref(lb.Name, ""))
+}
+
+func TestCleanOrphanedLoadBalancerByProfileWithVMSS(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := getTestProfileCloud(ctrl, LoadBalancerProfile{Name: "lb-1"})
+	ss, err := newScaleSet(context.Background(), az)
+	assert.NoError(t, err)
+	az.VMSet = ss
+
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().Delete(gomock.Any(), "rg", "lb-1").Return(nil)
+
+	// the VMSS of the nodes is decoupled from the load balancer instead of the VMSS named after the profile
+	backendPoolID := az.getBackendPoolID("lb-1", az.getLoadBalancerResourceGroup(), "test")
+	expectedVMSS := buildTestVMSSWithLB(testVMSSName, "vmss-vm-", []string{backendPoolID}, false)
+	mockVMSSClient := az.VirtualMachineScaleSetsClient.(*mockvmssclient.MockInterface)
+	mockVMSSClient.EXPECT().List(gomock.Any(), "rg").Return([]compute.VirtualMachineScaleSet{expectedVMSS}, nil)
+	mockVMSSClient.EXPECT().Get(gomock.Any(), "rg", testVMSSName).Return(expectedVMSS, nil)
+	mockVMSSClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", testVMSSName, gomock.Any()).DoAndReturn(
+		func(_ interface{}, _, _ string, vmss compute.VirtualMachineScaleSet) *retry.Error {
+			ipConfig := (*(*vmss.VirtualMachineProfile.NetworkProfile.NetworkInterfaceConfigurations)[0].IPConfigurations)[0]
+			assert.Empty(t, *ipConfig.LoadBalancerBackendAddressPools)
+			return nil
+		})
+
+	service := getTestService("test", v1.ProtocolTCP, nil, false, 80)
+	lb := getTestLoadBalancer(pointer.String("lb-1"), pointer.String("rg"), pointer.String("test"), pointer.String("test"), service, consts.LoadBalancerSkuStandard)
+	(*lb.BackendAddressPools)[0].ID = pointer.String(backendPoolID)
+	(*lb.BackendAddressPools)[0].BackendAddressPoolPropertiesFormat = &network.BackendAddressPoolPropertiesFormat{}
+	existingLBs := []network.LoadBalancer{{Name: pointer.String("lb-1")}}
+
+	err = az.cleanOrphanedLoadBalancer(&lb, existingLBs, &service, "test")
+	assert.NoError(t, err)
+}
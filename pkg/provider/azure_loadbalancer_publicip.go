@@ -0,0 +1,224 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// getPublicIPZones returns the availability zones of the public IP set by the service annotation.
+// The second return value is false if the annotation is not set. An empty annotation means no zones.
+func getPublicIPZones(service *v1.Service) ([]string, bool, error) {
+	value, found := service.Annotations[consts.ServiceAnnotationPIPZones]
+	if !found {
+		return nil, false, nil
+	}
+
+	zones := []string{}
+	for _, zone := range strings.Split(value, ",") {
+		zone = strings.TrimSpace(zone)
+		if zone == "" {
+			continue
+		}
+		if _, err := strconv.Atoi(zone); err != nil {
+			return nil, true, fmt.Errorf("invalid zone %q in annotation %s", zone, consts.ServiceAnnotationPIPZones)
+		}
+		zones = append(zones, zone)
+	}
+	return sets.NewString(zones...).List(), true, nil
+}
+
+// getPublicIPSkuTier returns the sku tier of the public IP set by the service annotation.
+func getPublicIPSkuTier(service *v1.Service) (network.PublicIPAddressSkuTier, error) {
+	value := strings.TrimSpace(service.Annotations[consts.ServiceAnnotationPIPTier])
+	switch {
+	case value == "":
+		return "", nil
+	case strings.EqualFold(value, string(network.PublicIPAddressSkuTierRegional)):
+		return network.PublicIPAddressSkuTierRegional, nil
+	case strings.EqualFold(value, string(network.PublicIPAddressSkuTierGlobal)):
+		return "", fmt.Errorf("the %s tier of annotation %s is not supported, please use annotation %s instead",
+			value, consts.ServiceAnnotationPIPTier, consts.ServiceAnnotationGlobalLoadBalancerName)
+	default:
+		return "", fmt.Errorf("invalid value %q of annotation %s", value, consts.ServiceAnnotationPIPTier)
+	}
+}
+
+// getPublicIPRoutingPreference returns the routing preference of the public IP set by the service annotation.
+// The second return value is false if the annotation is not set.
+func getPublicIPRoutingPreference(service *v1.Service) (string, bool, error) {
+	value, found := service.Annotations[consts.ServiceAnnotationPIPRoutingPreference]
+	if !found {
+		return "", false, nil
+	}
+
+	value = strings.TrimSpace(value)
+	for _, preference := range []string{consts.RoutingPreferenceInternet, consts.RoutingPreferenceMicrosoftNetwork} {
+		if strings.EqualFold(value, preference) {
+			return preference, true, nil
+		}
+	}
+	return "", true, fmt.Errorf("invalid value %q of annotation %s", value, consts.ServiceAnnotationPIPRoutingPreference)
+}
+
+// getPublicIPDdosSettings returns the DDoS settings of the public IP set by the service annotations.
+// It returns nil if neither the DDoS protection plan nor the protection mode is set.
+func getPublicIPDdosSettings(service *v1.Service) (*network.DdosSettings, error) {
+	planID := strings.TrimSpace(service.Annotations[consts.ServiceAnnotationPIPDdosProtectionPlanID])
+	modeValue := strings.TrimSpace(service.Annotations[consts.ServiceAnnotationPIPDdosProtectionMode])
+	if planID == "" && modeValue == "" {
+		return nil, nil
+	}
+
+	settings := &network.DdosSettings{
+		ProtectionMode: network.DdosSettingsProtectionModeEnabled,
+	}
+	if modeValue != "" {
+		var found bool
+		for _, mode := range network.PossibleDdosSettingsProtectionModeValues() {
+			if strings.EqualFold(modeValue, string(mode)) {
+				settings.ProtectionMode = mode
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid value %q of annotation %s", modeValue, consts.ServiceAnnotationPIPDdosProtectionMode)
+		}
+	}
+
+	if planID != "" {
+		if settings.ProtectionMode != network.DdosSettingsProtectionModeEnabled {
+			return nil, fmt.Errorf("the DDoS protection plan can only be attached when the protection mode is %s, got %s",
+				network.DdosSettingsProtectionModeEnabled, settings.ProtectionMode)
+		}
+		settings.DdosProtectionPlan = &network.SubResource{ID: pointer.String(planID)}
+	}
+	return settings, nil
+}
+
+// validatePublicIPAnnotations checks the public IP annotations of the service before the public IP is created or updated.
+func (az *Cloud) validatePublicIPAnnotations(service *v1.Service) error {
+	if _, _, err := getPublicIPRoutingPreference(service); err != nil {
+		return err
+	}
+	if _, err := getPublicIPSkuTier(service); err != nil {
+		return err
+	}
+	zones, _, err := getPublicIPZones(service)
+	if err != nil {
+		return err
+	}
+	ddosSettings, err := getPublicIPDdosSettings(service)
+	if err != nil {
+		return err
+	}
+
+	if !az.useStandardLoadBalancer() {
+		if len(zones) > 0 || ddosSettings != nil {
+			return fmt.Errorf("the zones and the DDoS protection of the public IP are only supported by the standard load balancer")
+		}
+	}
+	if az.HasExtendedLocation() && len(zones) > 0 {
+		return fmt.Errorf("the zones of the public IP are not supported in the edge zone %s", az.ExtendedLocationName)
+	}
+	return nil
+}
+
+// reconcilePublicIPDdosSettings applies the DDoS settings of the service to the public IP.
+// The settings are left untouched if the service does not set them.
+func reconcilePublicIPDdosSettings(pip *network.PublicIPAddress, service *v1.Service) (bool, error) {
+	desired, err := getPublicIPDdosSettings(service)
+	if err != nil || desired == nil {
+		return false, err
+	}
+
+	existing := pip.PublicIPAddressPropertiesFormat.DdosSettings
+	if existing != nil &&
+		strings.EqualFold(string(existing.ProtectionMode), string(desired.ProtectionMode)) &&
+		strings.EqualFold(getDdosProtectionPlanID(existing), getDdosProtectionPlanID(desired)) {
+		return false, nil
+	}
+
+	klog.V(2).Infof("reconcilePublicIPDdosSettings for service(%s): pip(%s) - setting the DDoS protection mode to %s",
+		getServiceName(service), pointer.StringDeref(pip.Name, ""), desired.ProtectionMode)
+	pip.PublicIPAddressPropertiesFormat.DdosSettings = desired
+	return true, nil
+}
+
+func getDdosProtectionPlanID(settings *network.DdosSettings) string {
+	if settings.DdosProtectionPlan == nil {
+		return ""
+	}
+	return pointer.StringDeref(settings.DdosProtectionPlan.ID, "")
+}
+
+// checkPublicIPZones reports the zones requested by the service that differ from the existing public IP,
+// since the zones cannot be changed after the public IP is created.
+func (az *Cloud) checkPublicIPZones(service *v1.Service, pip *network.PublicIPAddress) {
+	zones, found, _ := getPublicIPZones(service)
+	if !found {
+		return
+	}
+
+	var existingZones []string
+	if pip.Zones != nil {
+		existingZones = *pip.Zones
+	}
+	if !sets.NewString(zones...).Equal(sets.NewString(existingZones...)) {
+		msg := fmt.Sprintf("the zones %v of the public IP %s cannot be changed to %v, please recreate the public IP",
+			existingZones, pointer.StringDeref(pip.Name, ""), zones)
+		klog.Warningf("checkPublicIPZones for service(%s): %s", getServiceName(service), msg)
+		az.Event(service, v1.EventTypeWarning, "PublicIPZonesImmutable", msg)
+	}
+}
+
+// retainPublicIP releases the public IP from the service without deleting it. The service tags are
+// removed so that the IP can be reused by another service, and the name of the service is kept in a
+// separate tag for reference.
+func (az *Cloud) retainPublicIP(service *v1.Service, pipResourceGroup string, pip *network.PublicIPAddress) error {
+	serviceName := getServiceName(service)
+	if pip.Tags == nil {
+		pip.Tags = make(map[string]*string)
+	}
+
+	if serviceTag := getServiceFromPIPServiceTags(pip.Tags); serviceTag != "" {
+		for _, name := range parsePIPServiceTag(&serviceTag) {
+			if strings.EqualFold(name, serviceName) {
+				if err := unbindServiceFromPIP(pip, service, serviceName, "", false); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	pip.Tags[consts.RetainedServiceTagKey] = pointer.String(serviceName)
+
+	klog.V(2).Infof("retainPublicIP for service(%s): pip(%s) - keeping the public IP", serviceName, pointer.StringDeref(pip.Name, ""))
+	return az.CreateOrUpdatePIP(service, pipResourceGroup, *pip)
+}
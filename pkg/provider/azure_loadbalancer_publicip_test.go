@@ -0,0 +1,281 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestGetPublicIPZones(t *testing.T) {
+	for _, tc := range []struct {
+		desc          string
+		annotations   map[string]string
+		expectedZones []string
+		expectedFound bool
+		expectedErr   bool
+	}{
+		{
+			desc: "no annotation",
+		},
+		{
+			desc:          "empty annotation means no zones",
+			annotations:   map[string]string{consts.ServiceAnnotationPIPZones: ""},
+			expectedZones: []string{},
+			expectedFound: true,
+		},
+		{
+			desc:          "zones should be sorted and deduplicated",
+			annotations:   map[string]string{consts.ServiceAnnotationPIPZones: "3, 1,1"},
+			expectedZones: []string{"1", "3"},
+			expectedFound: true,
+		},
+		{
+			desc:          "invalid zone",
+			annotations:   map[string]string{consts.ServiceAnnotationPIPZones: "1,westus-1"},
+			expectedFound: true,
+			expectedErr:   true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			service := getTestService("svc1", v1.ProtocolTCP, tc.annotations, false, 80)
+			zones, found, err := getPublicIPZones(&service)
+			assert.Equal(t, tc.expectedErr, err != nil)
+			assert.Equal(t, tc.expectedFound, found)
+			if !tc.expectedErr {
+				assert.Equal(t, tc.expectedZones, zones)
+			}
+		})
+	}
+}
+
+func TestGetPublicIPSkuTier(t *testing.T) {
+	for _, tc := range []struct {
+		value        string
+		expectedTier network.PublicIPAddressSkuTier
+		expectedErr  bool
+	}{
+		{value: ""},
+		{value: "regional", expectedTier: network.PublicIPAddressSkuTierRegional},
+		{value: "Global", expectedErr: true},
+		{value: "Local", expectedErr: true},
+	} {
+		service := getTestService("svc1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationPIPTier: tc.value}, false, 80)
+		tier, err := getPublicIPSkuTier(&service)
+		assert.Equal(t, tc.expectedErr, err != nil, tc.value)
+		assert.Equal(t, tc.expectedTier, tier, tc.value)
+	}
+}
+
+func TestGetPublicIPDdosSettings(t *testing.T) {
+	planID := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/ddosProtectionPlans/plan"
+	for _, tc := range []struct {
+		desc             string
+		annotations      map[string]string
+		expectedSettings *network.DdosSettings
+		expectedErr      bool
+	}{
+		{
+			desc: "no annotations",
+		},
+		{
+			desc:        "the protection plan should enable the protection",
+			annotations: map[string]string{consts.ServiceAnnotationPIPDdosProtectionPlanID: planID},
+			expectedSettings: &network.DdosSettings{
+				ProtectionMode:     network.DdosSettingsProtectionModeEnabled,
+				DdosProtectionPlan: &network.SubResource{ID: pointer.String(planID)},
+			},
+		},
+		{
+			desc:        "the protection mode only",
+			annotations: map[string]string{consts.ServiceAnnotationPIPDdosProtectionMode: "virtualNetworkInherited"},
+			expectedSettings: &network.DdosSettings{
+				ProtectionMode: network.DdosSettingsProtectionModeVirtualNetworkInherited,
+			},
+		},
+		{
+			desc: "the protection plan cannot be attached when the protection is disabled",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPIPDdosProtectionPlanID: planID,
+				consts.ServiceAnnotationPIPDdosProtectionMode:   "Disabled",
+			},
+			expectedErr: true,
+		},
+		{
+			desc:        "invalid protection mode",
+			annotations: map[string]string{consts.ServiceAnnotationPIPDdosProtectionMode: "On"},
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			service := getTestService("svc1", v1.ProtocolTCP, tc.annotations, false, 80)
+			settings, err := getPublicIPDdosSettings(&service)
+			assert.Equal(t, tc.expectedErr, err != nil)
+			assert.Equal(t, tc.expectedSettings, settings)
+		})
+	}
+}
+
+func TestReconcilePublicIPDdosSettings(t *testing.T) {
+	service := getTestService("svc1", v1.ProtocolTCP, map[string]string{
+		consts.ServiceAnnotationPIPDdosProtectionMode: "Enabled",
+	}, false, 80)
+	pip := network.PublicIPAddress{
+		Name:                            pointer.String("pip"),
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{},
+	}
+
+	changed, err := reconcilePublicIPDdosSettings(&pip, &service)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, network.DdosSettingsProtectionModeEnabled, pip.DdosSettings.ProtectionMode)
+
+	changed, err = reconcilePublicIPDdosSettings(&pip, &service)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// The existing settings are kept if the service does not set them.
+	delete(service.Annotations, consts.ServiceAnnotationPIPDdosProtectionMode)
+	changed, err = reconcilePublicIPDdosSettings(&pip, &service)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.NotNil(t, pip.DdosSettings)
+}
+
+func TestGetServiceIPTagRequestForPublicIPWithRoutingPreference(t *testing.T) {
+	for _, tc := range []struct {
+		desc            string
+		annotations     map[string]string
+		expectedRequest serviceIPTagRequest
+	}{
+		{
+			desc: "internet routing preference",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPIPRoutingPreference: "internet",
+			},
+			expectedRequest: serviceIPTagRequest{
+				IPTagsRequestedByAnnotation: true,
+				IPTags: &[]network.IPTag{
+					{IPTagType: pointer.String(consts.IPTagTypeRoutingPreference), Tag: pointer.String(consts.RoutingPreferenceInternet)},
+				},
+			},
+		},
+		{
+			desc: "microsoft network routing preference should remove the routing preference tag",
+			annotations: map[string]string{
+				consts.ServiceAnnotationIPTagsForPublicIP:    "RoutingPreference=Internet",
+				consts.ServiceAnnotationPIPRoutingPreference: "MicrosoftNetwork",
+			},
+			expectedRequest: serviceIPTagRequest{
+				IPTagsRequestedByAnnotation: true,
+				IPTags:                      &[]network.IPTag{},
+			},
+		},
+		{
+			desc: "invalid routing preference should be ignored",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPIPRoutingPreference: "ISP",
+			},
+			expectedRequest: serviceIPTagRequest{},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			service := getTestService("svc1", v1.ProtocolTCP, tc.annotations, false, 80)
+			assert.Equal(t, tc.expectedRequest, getServiceIPTagRequestForPublicIP(&service))
+		})
+	}
+}
+
+func TestEnsurePublicIPExistsWithPublicIPAnnotations(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	planID := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/ddosProtectionPlans/plan"
+	service := getTestService("svc1", v1.ProtocolTCP, map[string]string{
+		consts.ServiceAnnotationPIPZones:                "2",
+		consts.ServiceAnnotationPIPTier:                 "Regional",
+		consts.ServiceAnnotationPIPRoutingPreference:    "Internet",
+		consts.ServiceAnnotationPIPDdosProtectionPlanID: planID,
+	}, false, 80)
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+	mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{}, nil).AnyTimes()
+	mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "pip1", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, rg, name string, pip network.PublicIPAddress, _ string) error {
+			assert.Equal(t, &[]string{"2"}, pip.Zones)
+			assert.Equal(t, network.PublicIPAddressSkuTierRegional, pip.Sku.Tier)
+			assert.Equal(t, &[]network.IPTag{
+				{IPTagType: pointer.String(consts.IPTagTypeRoutingPreference), Tag: pointer.String(consts.RoutingPreferenceInternet)},
+			}, pip.IPTags)
+			assert.Equal(t, planID, pointer.StringDeref(pip.DdosSettings.DdosProtectionPlan.ID, ""))
+			return nil
+		})
+	mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", "pip1", gomock.Any()).Return(network.PublicIPAddress{Name: pointer.String("pip1")}, nil)
+
+	_, err := az.ensurePublicIPExists(&service, "pip1", "", "", false, false)
+	assert.NoError(t, err)
+
+	t.Run("the global tier should be rejected", func(t *testing.T) {
+		service.Annotations[consts.ServiceAnnotationPIPTier] = "Global"
+		_, err := az.ensurePublicIPExists(&service, "pip1", "", "", false, false)
+		assert.Error(t, err)
+	})
+}
+
+func TestSafeDeletePublicIPRetainOnDelete(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	service := getTestService("svc1", v1.ProtocolTCP, map[string]string{
+		consts.ServiceAnnotationPIPRetainOnDelete: "true",
+	}, false, 80)
+	az := GetTestCloud(ctrl)
+	az.eventRecorder = record.NewFakeRecorder(10)
+	pip := network.PublicIPAddress{
+		Name: pointer.String("pip1"),
+		Tags: map[string]*string{
+			consts.ServiceTagKey:  pointer.String("default/svc1,default/svc2"),
+			consts.ClusterNameKey: pointer.String("kubernetes"),
+		},
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+			IPAddress: pointer.String("1.2.3.4"),
+		},
+	}
+	mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPsClient.EXPECT().Delete(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "pip1", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, rg, name string, pip network.PublicIPAddress, _ string) error {
+			assert.Equal(t, "default/svc2", pointer.StringDeref(pip.Tags[consts.ServiceTagKey], ""))
+			assert.Equal(t, "default/svc1", pointer.StringDeref(pip.Tags[consts.RetainedServiceTagKey], ""))
+			assert.Equal(t, "1.2.3.4", pointer.StringDeref(pip.IPAddress, ""))
+			return nil
+		})
+
+	assert.NoError(t, az.safeDeletePublicIP(&service, "rg", &pip, nil, consts.IsK8sServicePIPRetainedOnDelete(&service)))
+}
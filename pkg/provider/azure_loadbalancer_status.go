@@ -0,0 +1,201 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+// serviceConditions collects the conditions of the Azure resources owned by a service during one reconciliation.
+// Conditions of the resources that are not reached in the reconciliation are left unchanged on the service.
+type serviceConditions struct {
+	service    *v1.Service
+	conditions []metav1.Condition
+	// removed are the types of the conditions to remove from the service, e.g. those of the
+	// load balancer after the service is switched to the application gateway.
+	removed []string
+}
+
+// loadBalancerServiceConditionTypes are the conditions of the resources owned by a service in the load balancer mode.
+var loadBalancerServiceConditionTypes = []string{
+	consts.ServiceConditionLoadBalancerReady,
+	consts.ServiceConditionPublicIPReady,
+	consts.ServiceConditionSecurityGroupReady,
+	consts.ServiceConditionPrivateLinkServiceReady,
+	consts.ServiceConditionGlobalLoadBalancerReady,
+	consts.ServiceConditionDNSRecordReady,
+}
+
+func newServiceConditions(service *v1.Service) *serviceConditions {
+	return &serviceConditions{service: service}
+}
+
+// setServiceConditionReady marks the condition as true with the IDs of the Azure resources owned by the service.
+func (az *Cloud) setServiceConditionReady(sc *serviceConditions, conditionType string, resourceIDs ...string) {
+	now := metav1.Now()
+	az.lastSuccessfulServiceReconcile.Store(getServiceConditionKey(sc.service, conditionType), now)
+
+	ids := make([]string, 0, len(resourceIDs))
+	for _, id := range resourceIDs {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	message := fmt.Sprintf("last successful reconcile at %s", now.UTC().Format(time.RFC3339))
+	if len(ids) > 0 {
+		message = fmt.Sprintf("%s, resources: %s", message, strings.Join(ids, ","))
+	}
+
+	az.setServiceCondition(sc, metav1.Condition{
+		Type:    conditionType,
+		Status:  metav1.ConditionTrue,
+		Reason:  consts.ServiceConditionReasonReconciled,
+		Message: message,
+	})
+}
+
+// setServiceConditionFailed marks the condition as false. The reason is the Azure error code if there is one.
+func (az *Cloud) setServiceConditionFailed(sc *serviceConditions, conditionType string, err error) {
+	reason := retry.GetServiceErrorCode(err)
+	if reason == "" {
+		reason = consts.ServiceConditionReasonReconcileFailed
+	}
+
+	message := err.Error()
+	if lastSuccess, ok := az.lastSuccessfulServiceReconcile.Load(getServiceConditionKey(sc.service, conditionType)); ok {
+		message = fmt.Sprintf("%s, last successful reconcile at %s", message, lastSuccess.(metav1.Time).UTC().Format(time.RFC3339))
+	}
+
+	az.setServiceCondition(sc, metav1.Condition{
+		Type:    conditionType,
+		Status:  metav1.ConditionFalse,
+		Reason:  reason,
+		Message: message,
+	})
+}
+
+// setServiceCondition adds the condition and reports an event if the resource is broken or has just been fixed.
+// Nothing is changed in Azure in plan mode, so the conditions are not touched.
+func (az *Cloud) setServiceCondition(sc *serviceConditions, condition metav1.Condition) {
+	if az.inLoadBalancerPlan(sc.service) {
+		return
+	}
+
+	condition.ObservedGeneration = sc.service.Generation
+	condition.LastTransitionTime = metav1.Now()
+	existing := meta.FindStatusCondition(sc.service.Status.Conditions, condition.Type)
+	if existing != nil && existing.Status == condition.Status {
+		condition.LastTransitionTime = existing.LastTransitionTime
+	}
+
+	switch {
+	case condition.Status == metav1.ConditionFalse:
+		az.Event(sc.service, v1.EventTypeWarning, condition.Type, fmt.Sprintf("%s: %s", condition.Reason, condition.Message))
+	case existing == nil || existing.Status != metav1.ConditionTrue:
+		az.Event(sc.service, v1.EventTypeNormal, condition.Type, condition.Message)
+	}
+
+	meta.SetStatusCondition(&sc.conditions, condition)
+}
+
+// removeServiceConditions removes the conditions from the service if it has them.
+func (az *Cloud) removeServiceConditions(sc *serviceConditions, conditionTypes ...string) {
+	if az.inLoadBalancerPlan(sc.service) {
+		return
+	}
+	for _, conditionType := range conditionTypes {
+		if hasServiceCondition(sc.service, conditionType) {
+			sc.removed = append(sc.removed, conditionType)
+		}
+	}
+}
+
+// hasServiceCondition returns true if the condition is on the service, which means the resource has been
+// reconciled for the service.
+func hasServiceCondition(service *v1.Service, conditionType string) bool {
+	return meta.FindStatusCondition(service.Status.Conditions, conditionType) != nil
+}
+
+// hasLoadBalancerServiceConditions returns true if the service has been reconciled in the load balancer mode.
+func hasLoadBalancerServiceConditions(service *v1.Service) bool {
+	for _, conditionType := range loadBalancerServiceConditionTypes {
+		if hasServiceCondition(service, conditionType) {
+			return true
+		}
+	}
+	return false
+}
+
+// updateServiceConditions patches the collected conditions to the service status.
+// Other conditions on the service are kept since the conditions are merged by type.
+func (az *Cloud) updateServiceConditions(sc *serviceConditions) {
+	if az.KubeClient == nil || consts.IsGatewayService(sc.service) || len(sc.conditions)+len(sc.removed) == 0 {
+		return
+	}
+
+	serviceName := getServiceName(sc.service)
+	conditions := make([]interface{}, 0, len(sc.conditions)+len(sc.removed))
+	for _, condition := range sc.conditions {
+		conditions = append(conditions, condition)
+	}
+	for _, conditionType := range sc.removed {
+		conditions = append(conditions, map[string]string{
+			"type":   conditionType,
+			"$patch": "delete",
+		})
+	}
+	patchBytes, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": conditions,
+		},
+	})
+	if err != nil {
+		klog.Errorf("updateServiceConditions(%s): failed to marshal the conditions: %v", serviceName, err)
+		return
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	if _, err := az.KubeClient.CoreV1().Services(sc.service.Namespace).Patch(ctx, sc.service.Name, types.StrategicMergePatchType, patchBytes, metav1.PatchOptions{}, "status"); err != nil {
+		klog.Warningf("updateServiceConditions(%s): failed to patch the service status: %v", serviceName, err)
+		return
+	}
+	klog.V(4).Infof("updateServiceConditions(%s): updated %d conditions and removed %d conditions", serviceName, len(sc.conditions), len(sc.removed))
+}
+
+// cleanupServiceConditions forgets the last successful reconcile time of a deleted service.
+func (az *Cloud) cleanupServiceConditions(service *v1.Service) {
+	for _, conditionType := range append(loadBalancerServiceConditionTypes, consts.ServiceConditionApplicationGatewayReady) {
+		az.lastSuccessfulServiceReconcile.Delete(getServiceConditionKey(service, conditionType))
+	}
+}
+
+func getServiceConditionKey(service *v1.Service, conditionType string) string {
+	return fmt.Sprintf("%s/%s", getServiceName(service), conditionType)
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestSetServiceConditions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	recorder := record.NewFakeRecorder(10)
+	az.eventRecorder = recorder
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+
+	sc := newServiceConditions(&svc)
+	az.setServiceConditionReady(sc, consts.ServiceConditionLoadBalancerReady, "lbID", "", "fipID")
+	condition := meta.FindStatusCondition(sc.conditions, consts.ServiceConditionLoadBalancerReady)
+	assert.NotNil(t, condition)
+	assert.Equal(t, metav1.ConditionTrue, condition.Status)
+	assert.Equal(t, consts.ServiceConditionReasonReconciled, condition.Reason)
+	assert.Contains(t, condition.Message, "resources: lbID,fipID")
+	assert.Contains(t, <-recorder.Events, "Normal AzureLoadBalancerReady last successful reconcile at")
+
+	// the event is not repeated if the condition is already ready
+	svc.Status.Conditions = sc.conditions
+	sc = newServiceConditions(&svc)
+	az.setServiceConditionReady(sc, consts.ServiceConditionLoadBalancerReady, "lbID")
+	assert.Equal(t, 0, len(recorder.Events))
+
+	rerr := &retry.Error{
+		HTTPStatusCode: http.StatusBadRequest,
+		RawError:       fmt.Errorf("%s", "{\"error\":{\"code\": \"ReferencedResourceNotProvisioned\",\"message\": \"Some error message\"}}"),
+	}
+	az.setServiceConditionFailed(sc, consts.ServiceConditionLoadBalancerReady, fmt.Errorf("failed to update lb: %w", rerr.Error()))
+	condition = meta.FindStatusCondition(sc.conditions, consts.ServiceConditionLoadBalancerReady)
+	assert.Equal(t, metav1.ConditionFalse, condition.Status)
+	assert.Equal(t, "ReferencedResourceNotProvisioned", condition.Reason)
+	assert.Contains(t, condition.Message, "last successful reconcile at")
+	assert.Contains(t, <-recorder.Events, "Warning AzureLoadBalancerReady ReferencedResourceNotProvisioned: failed to update lb")
+
+	az.setServiceConditionFailed(sc, consts.ServiceConditionPublicIPReady, fmt.Errorf("some error"))
+	condition = meta.FindStatusCondition(sc.conditions, consts.ServiceConditionPublicIPReady)
+	assert.Equal(t, consts.ServiceConditionReasonReconcileFailed, condition.Reason)
+	assert.Equal(t, "some error", condition.Message)
+
+	az.cleanupServiceConditions(&svc)
+	_, found := az.lastSuccessfulServiceReconcile.Load(getServiceConditionKey(&svc, consts.ServiceConditionLoadBalancerReady))
+	assert.False(t, found)
+}
+
+func TestSetServiceConditionsDryRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.lbPlans.Store("default/service1", &loadBalancerPlan{Service: "default/service1"})
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+
+	sc := newServiceConditions(&svc)
+	az.setServiceConditionReady(sc, consts.ServiceConditionLoadBalancerReady, "lbID")
+	az.setServiceConditionFailed(sc, consts.ServiceConditionPublicIPReady, fmt.Errorf("some error"))
+	assert.Empty(t, sc.conditions)
+}
+
+func TestUpdateServiceConditions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	svc.Status.Conditions = []metav1.Condition{
+		{
+			Type:   "Other",
+			Status: metav1.ConditionTrue,
+			Reason: "Other",
+		},
+	}
+	az.KubeClient = fake.NewSimpleClientset(&svc)
+
+	sc := newServiceConditions(&svc)
+	az.setServiceConditionReady(sc, consts.ServiceConditionSecurityGroupReady, "nsgID")
+	az.setServiceConditionFailed(sc, consts.ServiceConditionPublicIPReady, fmt.Errorf("some error"))
+	az.updateServiceConditions(sc)
+
+	updated, err := az.KubeClient.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(updated.Status.Conditions))
+	assert.True(t, meta.IsStatusConditionTrue(updated.Status.Conditions, "Other"))
+	assert.True(t, meta.IsStatusConditionTrue(updated.Status.Conditions, consts.ServiceConditionSecurityGroupReady))
+	assert.True(t, meta.IsStatusConditionFalse(updated.Status.Conditions, consts.ServiceConditionPublicIPReady))
+}
+
+func TestSkipPatchingGatewayService(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	client := fake.NewSimpleClientset()
+	az.KubeClient = client
+	svc := getTestService(consts.GatewayServiceNamePrefix+"gw", v1.ProtocolTCP, nil, false, 80)
+
+	sc := newServiceConditions(&svc)
+	az.setServiceConditionReady(sc, consts.ServiceConditionSecurityGroupReady, "nsgID")
+	az.updateServiceConditions(sc)
+	assert.NoError(t, az.patchServiceAnnotations(&svc, map[string]*string{"key": pointer.String("value")}))
+	assert.Equal(t, "value", svc.Annotations["key"])
+	az.updatePrivateEndpointConnectionStates(&svc, "Approved=1")
+	assert.Empty(t, client.Actions())
+}
+
+func TestRemoveServiceConditions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+	svc.Status.Conditions = []metav1.Condition{
+		{Type: consts.ServiceConditionLoadBalancerReady, Status: metav1.ConditionTrue, Reason: consts.ServiceConditionReasonReconciled},
+		{Type: consts.ServiceConditionPublicIPReady, Status: metav1.ConditionTrue, Reason: consts.ServiceConditionReasonReconciled},
+	}
+	assert.True(t, hasLoadBalancerServiceConditions(&svc))
+	az.KubeClient = fake.NewSimpleClientset(&svc)
+
+	sc := newServiceConditions(&svc)
+	az.removeServiceConditions(sc, loadBalancerServiceConditionTypes...)
+	assert.Equal(t, []string{consts.ServiceConditionLoadBalancerReady, consts.ServiceConditionPublicIPReady}, sc.removed)
+	az.setServiceConditionReady(sc, consts.ServiceConditionApplicationGatewayReady, "gwID")
+	az.updateServiceConditions(sc)
+
+	updated, err := az.KubeClient.CoreV1().Services(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(updated.Status.Conditions))
+	assert.True(t, hasServiceCondition(updated, consts.ServiceConditionApplicationGatewayReady))
+	assert.False(t, hasLoadBalancerServiceConditions(updated))
+}
@@ -37,6 +37,7 @@ import (
 
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/utils/pointer"
 
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
@@ -879,6 +880,21 @@ func TestServiceOwnsPublicIP(t *testing.T) {
 			serviceName:  "nginx",
 			expectedOwns: true,
 		},
+		{
+			desc: "true should be returned when the cluster name is among the clusters sharing the pip",
+			pip: &network.PublicIPAddress{
+				Tags: map[string]*string{
+					consts.ServiceTagKey:  pointer.String("default/nginx"),
+					consts.ClusterNameKey: pointer.String("k8s,kubernetes"),
+				},
+				PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+					IPAddress: pointer.String("1.2.3.4"),
+				},
+			},
+			clusterName:  "kubernetes",
+			serviceName:  "nginx",
+			expectedOwns: true,
+		},
 		{
 			desc: "false should be returned when the tag is empty and load balancer IP does not match",
 			pip: &network.PublicIPAddress{
@@ -2023,9 +2039,9 @@ func TestIsFrontendIPChanged(t *testing.T) {
 			}
 
 			mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
-			mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+			mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 			for _, existingPIP := range test.existingPIPs {
-				err := az.PublicIPAddressesClient.CreateOrUpdate(context.TODO(), "rg", *existingPIP.Name, existingPIP)
+				err := az.PublicIPAddressesClient.CreateOrUpdate(context.TODO(), "rg", *existingPIP.Name, existingPIP, "")
 				if err != nil {
 					t.Fatal(err)
 				}
@@ -2149,10 +2165,10 @@ func TestDeterminePublicIPName(t *testing.T) {
 
 			mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
 			mockPIPsClient.EXPECT().List(gomock.Any(), "rg").Return(test.existingPIPs, nil).MaxTimes(1)
-			mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+			mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 			for _, existingPIP := range test.existingPIPs {
 				mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", *existingPIP.Name, gomock.Any()).Return(existingPIP, nil).AnyTimes()
-				err := az.PublicIPAddressesClient.CreateOrUpdate(context.TODO(), "rg", *existingPIP.Name, existingPIP)
+				err := az.PublicIPAddressesClient.CreateOrUpdate(context.TODO(), "rg", *existingPIP.Name, existingPIP, "")
 				assert.NoError(t, err.Error())
 			}
 			var pips []network.PublicIPAddress
@@ -2635,6 +2651,127 @@ func TestReconcileLoadBalancerRule(t *testing.T) {
 	}
 }
 
+func TestGetExpectedLBRulesWithPodIPBackendPool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+	az.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypePODIP
+
+	// The health check node port of kube-proxy is not used since the pods are probed directly.
+	svc := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
+	svc.Spec.Ports[0].TargetPort = intstr.FromInt(8080)
+	svc.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeLocal
+	svc.Spec.HealthCheckNodePort = 34567
+
+	expectedRule := getTestRule(true, 80)
+	expectedRule.BackendPort = pointer.Int32(8080)
+	expectedRule.EnableFloatingIP = pointer.Bool(false)
+	probes, rules, err := az.getExpectedLBRules(&svc, "frontendIPConfigID", "backendPoolID", "lbname")
+	assert.NoError(t, err)
+	assert.Equal(t, getTestProbes("Tcp", "", pointer.Int32(5), pointer.Int32(80), pointer.Int32(8080), pointer.Int32(2)), probes)
+	assert.Equal(t, []network.LoadBalancingRule{expectedRule}, rules)
+}
+
+func TestGetExpectedLBRulesWithCustomizedProbes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	getUDPService := func(annotations map[string]string) v1.Service {
+		svc := getTestService("test1", v1.ProtocolTCP, annotations, false, 8080)
+		svc.Spec.Ports = append(svc.Spec.Ports, v1.ServicePort{
+			Name:     "dns",
+			Protocol: v1.ProtocolUDP,
+			Port:     53,
+			NodePort: getBackendPort(53),
+		})
+		return svc
+	}
+	udpRule := getTestRule(false, 53)
+	udpRule.Name = pointer.String("atest1-UDP-53")
+	udpRule.Protocol = network.TransportProtocolUDP
+	udpRule.Probe.ID = pointer.String("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lbname/probes/atest1-UDP-53")
+	udpProbe := getTestProbe("Http", "/healthz", pointer.Int32(5), pointer.Int32(53), pointer.Int32(getBackendPort(8080)), pointer.Int32(2))
+	udpProbe.Name = pointer.String("atest1-UDP-53")
+
+	sharedRule := getTestRule(false, 443)
+	sharedRule.Probe.ID = pointer.String("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lbname/probes/atest1-TCP-80")
+
+	kubeProxyRule := getTestRule(false, 80)
+	kubeProxyRule.Probe.ID = pointer.String("/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/loadBalancers/lbname/probes/atest1-TCP-10256")
+	kubeProxyProbe := getTestProbe("Http", "/healthz", pointer.Int32(5), pointer.Int32(10256), pointer.Int32(10256), pointer.Int32(2))
+
+	for _, tc := range []struct {
+		desc           string
+		service        v1.Service
+		expectedProbes []network.Probe
+		expectedRules  []network.LoadBalancingRule
+		expectedErr    string
+	}{
+		{
+			desc: "the UDP port should be probed by the sidecar port",
+			service: getUDPService(map[string]string{
+				"service.beta.kubernetes.io/port_8080_no_lb_rule":              "true",
+				"service.beta.kubernetes.io/port_53_health-probe_port":         "8080",
+				"service.beta.kubernetes.io/port_53_health-probe_protocol":     "http",
+				"service.beta.kubernetes.io/port_53_health-probe_request-path": "/healthz",
+			}),
+			expectedProbes: []network.Probe{udpProbe},
+			expectedRules:  []network.LoadBalancingRule{udpRule},
+		},
+		{
+			desc: "the UDP port should not be probed by itself",
+			service: getUDPService(map[string]string{
+				"service.beta.kubernetes.io/port_53_health-probe_protocol": "http",
+			}),
+			expectedErr: "annotation service.beta.kubernetes.io/port_53_health-probe_port is required to probe the UDP port 53",
+		},
+		{
+			desc: "the UDP port should not be probed by another UDP port",
+			service: getUDPService(map[string]string{
+				"service.beta.kubernetes.io/port_53_health-probe_port": "dns",
+			}),
+			expectedErr: "the health probe of port 53 cannot target the UDP port dns",
+		},
+		{
+			desc: "the probe should be shared across ports",
+			service: getTestService("test1", v1.ProtocolTCP, map[string]string{
+				"service.beta.kubernetes.io/port_443_health-probe_share-with": "port-tcp-80",
+			}, false, 80, 443),
+			expectedProbes: getTestProbes("Tcp", "", pointer.Int32(5), pointer.Int32(80), pointer.Int32(10080), pointer.Int32(2)),
+			expectedRules:  []network.LoadBalancingRule{getTestRule(false, 80), sharedRule},
+		},
+		{
+			desc: "the shared port should exist",
+			service: getTestService("test1", v1.ProtocolTCP, map[string]string{
+				"service.beta.kubernetes.io/port_443_health-probe_share-with": "8080",
+			}, false, 80, 443),
+			expectedErr: "port 8080 sharing its health probe with port 443 not found in service",
+		},
+		{
+			desc: "the healthz port of kube-proxy should be probed for the cluster services",
+			service: getTestService("test1", v1.ProtocolTCP, map[string]string{
+				"service.beta.kubernetes.io/port_80_health-probe_use-kube-proxy": "true",
+			}, false, 80),
+			expectedProbes: []network.Probe{kubeProxyProbe},
+			expectedRules:  []network.LoadBalancingRule{kubeProxyRule},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			probes, rules, err := az.getExpectedLBRules(&tc.service, "frontendIPConfigID", "backendPoolID", "lbname")
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedProbes, probes)
+			assert.Equal(t, tc.expectedRules, rules)
+		})
+	}
+}
+
 func getTestProbes(protocol, path string, interval, servicePort, probePort, numOfProbe *int32) []network.Probe {
 	return []network.Probe{
 		getTestProbe(protocol, path, interval, servicePort, probePort, numOfProbe),
@@ -3228,7 +3365,7 @@ func TestReconcileLoadBalancer(t *testing.T) {
 				PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
 					IPAddress: pointer.String("1.2.3.4"),
 				},
-			})
+			}, "")
 			assert.NoError(t, err.Error())
 
 			mockLBsClient := mockloadbalancerclient.NewMockInterface(ctrl)
@@ -3248,7 +3385,7 @@ func TestReconcileLoadBalancer(t *testing.T) {
 			mockLBBackendPool.EXPECT().ReconcileBackendPools(gomock.Any(), gomock.Any(), gomock.Any()).Return(false, false, nil).AnyTimes()
 			mockLBBackendPool.EXPECT().EnsureHostsInPool(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 
-			lb, rerr := az.reconcileLoadBalancer("testCluster", &test.service, clusterResources.nodes, test.wantLb)
+			lb, rerr := az.reconcileLoadBalancer(context.TODO(), "testCluster", &test.service, clusterResources.nodes, test.wantLb)
 			assert.Equal(t, test.expectedError, rerr)
 
 			if test.expectedError == nil {
@@ -3823,7 +3960,7 @@ func TestSafeDeletePublicIP(t *testing.T) {
 		t.Run(test.desc, func(t *testing.T) {
 			az := GetTestCloud(ctrl)
 			mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
-			mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "pip1", gomock.Any()).Return(nil).AnyTimes()
+			mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "pip1", gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 			mockPIPsClient.EXPECT().Delete(gomock.Any(), "rg", "pip1").Return(nil).AnyTimes()
 			err := az.PublicIPAddressesClient.CreateOrUpdate(context.TODO(), "rg", "pip1", network.PublicIPAddress{
 				Name: pointer.String("pip1"),
@@ -3832,13 +3969,13 @@ func TestSafeDeletePublicIP(t *testing.T) {
 						ID: pointer.String("id1"),
 					},
 				},
-			})
+			}, "")
 			assert.NoError(t, err.Error())
 			service := getTestService("test1", v1.ProtocolTCP, nil, false, 80)
 			mockLBsClient := mockloadbalancerclient.NewMockInterface(ctrl)
 			mockLBsClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 			az.LoadBalancerClient = mockLBsClient
-			rerr := az.safeDeletePublicIP(&service, "rg", test.pip, test.lb)
+			rerr := az.safeDeletePublicIP(&service, "rg", test.pip, test.lb, false)
 			assert.Equal(t, 0, len(*test.lb.FrontendIPConfigurations))
 			assert.Equal(t, 0, len(*test.lb.LoadBalancingRules))
 			assert.Equal(t, test.expectedError, rerr != nil)
@@ -4148,8 +4285,8 @@ func TestReconcilePublicIP(t *testing.T) {
 			var m sync.Mutex
 			az := GetTestCloud(ctrl)
 			mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
-			creator := mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", gomock.Any(), gomock.Any()).AnyTimes()
-			creator.DoAndReturn(func(ctx context.Context, resourceGroupName string, publicIPAddressName string, parameters network.PublicIPAddress) *retry.Error {
+			creator := mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+			creator.DoAndReturn(func(ctx context.Context, resourceGroupName string, publicIPAddressName string, parameters network.PublicIPAddress, etag string) *retry.Error {
 				m.Lock()
 				deletedPips[publicIPAddressName] = false
 				savedPips[publicIPAddressName] = parameters
@@ -4187,7 +4324,7 @@ func TestReconcilePublicIP(t *testing.T) {
 					return nil
 				})
 
-				err := az.PublicIPAddressesClient.CreateOrUpdate(context.TODO(), "rg", pointer.StringDeref(pip.Name, ""), pip)
+				err := az.PublicIPAddressesClient.CreateOrUpdate(context.TODO(), "rg", pointer.StringDeref(pip.Name, ""), pip, "")
 				assert.NoError(t, err.Error())
 
 				// Clear create or update count to prepare for main execution
@@ -4558,7 +4695,7 @@ func TestEnsurePublicIPExists(t *testing.T) {
 			service.ObjectMeta.Annotations = test.additionalAnnotations
 			mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
 			if test.shouldPutPIP {
-				mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, resourceGroupName string, publicIPAddressName string, parameters network.PublicIPAddress) *retry.Error {
+				mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, resourceGroupName string, publicIPAddressName string, parameters network.PublicIPAddress, etag string) *retry.Error {
 					if len(test.existingPIPs) != 0 {
 						test.existingPIPs[0] = parameters
 					} else {
@@ -4637,8 +4774,8 @@ func TestEnsurePublicIPExistsWithExtendedLocation(t *testing.T) {
 	first := mockPIPsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{}, nil).Times(2)
 	mockPIPsClient.EXPECT().Get(gomock.Any(), "rg", "pip1", gomock.Any()).Return(*expectedPIP, nil).After(first)
 
-	mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "pip1", gomock.Any()).
-		DoAndReturn(func(ctx context.Context, resourceGroupName string, publicIPAddressName string, publicIPAddressParameters network.PublicIPAddress) *retry.Error {
+	mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "pip1", gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, resourceGroupName string, publicIPAddressName string, publicIPAddressParameters network.PublicIPAddress, etag string) *retry.Error {
 			assert.NotNil(t, publicIPAddressParameters)
 			assert.NotNil(t, publicIPAddressParameters.ExtendedLocation)
 			assert.Equal(t, *publicIPAddressParameters.ExtendedLocation.Name, exLocName)
@@ -4885,6 +5022,45 @@ func TestBindServicesToPIP(t *testing.T) {
 	}
 }
 
+func TestBindClustersToPIP(t *testing.T) {
+	pips := []*network.PublicIPAddress{
+		{Tags: nil},
+		{Tags: map[string]*string{consts.ClusterNameKey: pointer.String("cluster1")}},
+		{Tags: map[string]*string{consts.LegacyClusterNameKey: pointer.String("cluster1")}},
+		{Tags: map[string]*string{consts.ClusterNameKey: pointer.String("cluster1,cluster2")}},
+	}
+	expectedTags := []map[string]*string{
+		{consts.ClusterNameKey: pointer.String("cluster2")},
+		{consts.ClusterNameKey: pointer.String("cluster1,cluster2")},
+		{consts.LegacyClusterNameKey: pointer.String("cluster1"), consts.ClusterNameKey: pointer.String("cluster1,cluster2")},
+		{consts.ClusterNameKey: pointer.String("cluster1,cluster2")},
+	}
+	flags := []bool{true, true, true, false}
+
+	for i, pip := range pips {
+		addedNew, _ := bindClustersToPIP(pip, []string{"cluster2"}, false)
+		assert.Equal(t, expectedTags[i], pip.Tags)
+		assert.Equal(t, flags[i], addedNew)
+	}
+}
+
+func TestUnbindClusterFromPIP(t *testing.T) {
+	pip := &network.PublicIPAddress{Tags: map[string]*string{consts.ClusterNameKey: pointer.String("cluster1,cluster2")}}
+
+	last, err := unbindClusterFromPIP(pip, "cluster2")
+	assert.NoError(t, err)
+	assert.False(t, last)
+	assert.Equal(t, "cluster1", pointer.StringDeref(pip.Tags[consts.ClusterNameKey], ""))
+
+	last, err = unbindClusterFromPIP(pip, "cluster1")
+	assert.NoError(t, err)
+	assert.True(t, last)
+	assert.Equal(t, "", pointer.StringDeref(pip.Tags[consts.ClusterNameKey], ""))
+
+	_, err = unbindClusterFromPIP(&network.PublicIPAddress{}, "cluster1")
+	assert.EqualError(t, err, "nil public IP or tags")
+}
+
 func TestUnbindServiceFromPIP(t *testing.T) {
 	pips := []*network.PublicIPAddress{
 		{Tags: nil},
@@ -5306,7 +5482,7 @@ func TestEnsureLoadBalancerTagged(t *testing.T) {
 			cloud.SystemTags = tc.systemTags
 			lb := &network.LoadBalancer{Tags: tc.existedTags}
 
-			changed := cloud.ensureLoadBalancerTagged(lb)
+			changed := cloud.ensureLoadBalancerTagged(lb, nil)
 			assert.Equal(t, tc.expectedChanged, changed)
 			assert.Equal(t, tc.expectedTags, lb.Tags)
 		})
@@ -5575,7 +5751,7 @@ func TestReconcileZonesForFrontendIPConfigs(t *testing.T) {
 			mockPIPClient := cloud.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
 			first := mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{}, nil).MaxTimes(2)
 			mockPIPClient.EXPECT().Get(gomock.Any(), "rg", gomock.Any(), gomock.Any()).Return(tc.existingPIP, nil).MaxTimes(1).After(first)
-			mockPIPClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", gomock.Any(), gomock.Any()).Return(nil).MaxTimes(1)
+			mockPIPClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).MaxTimes(1)
 
 			subnetClient := cloud.SubnetsClient.(*mocksubnetclient.MockInterface)
 			subnetClient.EXPECT().Get(gomock.Any(), "rg", "vnet", "subnet", gomock.Any()).Return(
@@ -5586,7 +5762,7 @@ func TestReconcileZonesForFrontendIPConfigs(t *testing.T) {
 			cloud.ZoneClient = zoneClient
 
 			defaultLBFrontendIPConfigName := cloud.getDefaultFrontendIPConfigName(&tc.service)
-			_, _, dirty, err := cloud.reconcileFrontendIPConfigs("testCluster", &tc.service, &lb, tc.status, true, defaultLBFrontendIPConfigName)
+			_, _, dirty, err := cloud.reconcileFrontendIPConfigs("testCluster", &tc.service, &lb, tc.status, true, defaultLBFrontendIPConfigName, nil)
 			if tc.expectedErr == nil {
 				assert.NoError(t, err)
 			} else {
@@ -0,0 +1,394 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+const zonalFrontendNamePrefix = "zone"
+
+// zonalFrontend is the frontend IP configuration and the backend pool of a service in one availability zone.
+type zonalFrontend struct {
+	zone          string
+	fipConfigID   string
+	backendPoolID string
+}
+
+// getZonalFrontendName returns the name of both the zonal frontend IP configuration and the zonal backend pool.
+// It does not start with the rule prefix of the service, so the zonal frontends are never taken as the
+// frontend IP configuration of the service by serviceOwnsFrontendIP.
+func (az *Cloud) getZonalFrontendName(service *v1.Service, zone string) string {
+	name := fmt.Sprintf("%s%s-%s", zonalFrontendNamePrefix, zone, az.getDefaultFrontendIPConfigName(service))
+	if len(name) > consts.FrontendIPConfigNameMaxLength {
+		name = name[:consts.FrontendIPConfigNameMaxLength]
+		// Azure requires the name to end with a letter, a number or '_'.
+		if last := rune(name[len(name)-1]); !unicode.IsLetter(last) && !unicode.IsDigit(last) && last != '_' {
+			name = name[:len(name)-1] + "_"
+		}
+	}
+	return name
+}
+
+// getZoneOfZonalFrontend returns the zone of the zonal frontend IP configuration or backend pool if it belongs to the service.
+func (az *Cloud) getZoneOfZonalFrontend(service *v1.Service, name string) (string, bool) {
+	if !strings.HasPrefix(name, zonalFrontendNamePrefix) {
+		return "", false
+	}
+	zone := strings.SplitN(strings.TrimPrefix(name, zonalFrontendNamePrefix), "-", 2)[0]
+	if zone == "" || !strings.EqualFold(name, az.getZonalFrontendName(service, zone)) {
+		return "", false
+	}
+	return zone, true
+}
+
+func getZonalLoadBalancerRuleName(ruleName, zone string) string {
+	suffix := fmt.Sprintf("-%s%s", zonalFrontendNamePrefix, zone)
+	if len(ruleName)+len(suffix) > consts.LoadBalancerRuleNameMaxLength {
+		ruleName = ruleName[:consts.LoadBalancerRuleNameMaxLength-len(suffix)]
+	}
+	return ruleName + suffix
+}
+
+// validateZonalFrontends checks if the zonal frontends can be created for the service.
+func (az *Cloud) validateZonalFrontends(service *v1.Service) error {
+	if !requiresInternalLoadBalancer(service) {
+		return fmt.Errorf("zonal frontends are only supported by internal services")
+	}
+	if !az.useStandardLoadBalancer() || az.EnableMultipleStandardLoadBalancers {
+		return fmt.Errorf("zonal frontends are only supported by the single standard load balancer")
+	}
+	if az.HasExtendedLocation() {
+		return fmt.Errorf("zonal frontends are not supported in edge zones")
+	}
+	// The zonal backend pools contain the node IPs of one zone, which can not be expressed with the node IP configurations
+	// since all VMs of a VMSS share the same backend pools.
+	if !strings.EqualFold(az.LoadBalancerBackendPoolConfigurationType, consts.LoadBalancerBackendPoolConfigurationTypeNodeIP) {
+		return fmt.Errorf("zonal frontends are only supported with the %s backend pool type", consts.LoadBalancerBackendPoolConfigurationTypeNodeIP)
+	}
+	return nil
+}
+
+// reconcileZonalFrontends ensures the service has one frontend IP configuration and one backend pool per
+// availability zone of the region if it requests zonal frontends, otherwise it removes them.
+// The backend pool of a zone contains the nodes in the zone. If nodes is nil, the existing backend pools are kept as they are.
+func (az *Cloud) reconcileZonalFrontends(ctx context.Context, clusterName string, service *v1.Service, lb *network.LoadBalancer, nodes []*v1.Node, wantLb bool) ([]zonalFrontend, bool, error) {
+	serviceName := getServiceName(service)
+	wantZonal := wantLb && consts.IsK8sServiceUsingZonalFrontends(service)
+	var zones []string
+	if wantZonal {
+		if err := az.validateZonalFrontends(service); err != nil {
+			return nil, false, err
+		}
+		regionZones, err := az.getRegionZonesBackoff(az.Location)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(regionZones) == 0 {
+			return nil, false, fmt.Errorf("zonal frontends are not supported in the region %s without availability zones", az.Location)
+		}
+		zones = append(zones, regionZones...)
+		sort.Strings(zones)
+	}
+	wantedZones := sets.NewString(zones...)
+
+	var fipConfigs []network.FrontendIPConfiguration
+	var pools []network.BackendAddressPool
+	if lb.LoadBalancerPropertiesFormat != nil {
+		if lb.FrontendIPConfigurations != nil {
+			fipConfigs = *lb.FrontendIPConfigurations
+		}
+		if lb.BackendAddressPools != nil {
+			pools = *lb.BackendAddressPools
+		}
+	}
+
+	// remove the zonal frontends which are not wanted anymore
+	var changed bool
+	for i := len(fipConfigs) - 1; i >= 0; i-- {
+		if zone, ok := az.getZoneOfZonalFrontend(service, pointer.StringDeref(fipConfigs[i].Name, "")); ok && !wantedZones.Has(zone) {
+			klog.V(2).Infof("reconcileZonalFrontends for service(%s): lb frontendconfig(%s) - dropping", serviceName, pointer.StringDeref(fipConfigs[i].Name, ""))
+			fipConfigs = append(fipConfigs[:i], fipConfigs[i+1:]...)
+			changed = true
+		}
+	}
+	for i := len(pools) - 1; i >= 0; i-- {
+		if zone, ok := az.getZoneOfZonalFrontend(service, pointer.StringDeref(pools[i].Name, "")); ok && !wantedZones.Has(zone) {
+			klog.V(2).Infof("reconcileZonalFrontends for service(%s): lb backendpool(%s) - dropping", serviceName, pointer.StringDeref(pools[i].Name, ""))
+			pools = append(pools[:i], pools[i+1:]...)
+			changed = true
+		}
+	}
+
+	var zonalFrontends []zonalFrontend
+	if wantZonal {
+		var zoneIPs map[string][]string
+		if nodes != nil {
+			var err error
+			if zoneIPs, err = az.getZonalBackendIPs(ctx, service, nodes); err != nil {
+				return nil, false, err
+			}
+		}
+
+		lbName := pointer.StringDeref(lb.Name, "")
+		rg := az.getLoadBalancerResourceGroup()
+		var subnet *network.Subnet
+		for _, zone := range zones {
+			name := az.getZonalFrontendName(service, zone)
+			zf := zonalFrontend{
+				zone:          zone,
+				fipConfigID:   az.getFrontendIPConfigID(lbName, rg, name),
+				backendPoolID: az.getBackendPoolID(lbName, rg, name),
+			}
+			zonalFrontends = append(zonalFrontends, zf)
+
+			if !zonalFrontendIPConfigExists(fipConfigs, name) {
+				if subnet == nil {
+					existingSubnet, err := az.getServiceSubnet(service)
+					if err != nil {
+						return nil, false, err
+					}
+					subnet = &existingSubnet
+				}
+				props := &network.FrontendIPConfigurationPropertiesFormat{
+					Subnet:                    subnet,
+					PrivateIPAllocationMethod: network.Dynamic,
+				}
+				if utilnet.IsIPv6String(service.Spec.ClusterIP) {
+					props.PrivateIPAddressVersion = network.IPv6
+				}
+				klog.V(2).Infof("reconcileZonalFrontends for service(%s): lb frontendconfig(%s) - adding", serviceName, name)
+				fipConfigs = append(fipConfigs, network.FrontendIPConfiguration{
+					Name:                                    pointer.String(name),
+					ID:                                      pointer.String(zf.fipConfigID),
+					Zones:                                   &[]string{zone},
+					FrontendIPConfigurationPropertiesFormat: props,
+				})
+				changed = true
+			}
+
+			if az.ensureZonalBackendPool(&pools, name, zoneIPs[zone], nodes != nil) {
+				klog.V(2).Infof("reconcileZonalFrontends for service(%s): lb backendpool(%s) - updating with %d nodes", serviceName, name, len(zoneIPs[zone]))
+				changed = true
+			}
+		}
+	}
+
+	if changed {
+		if lb.LoadBalancerPropertiesFormat == nil {
+			lb.LoadBalancerPropertiesFormat = &network.LoadBalancerPropertiesFormat{}
+		}
+		lb.FrontendIPConfigurations = &fipConfigs
+		lb.BackendAddressPools = &pools
+	}
+	return zonalFrontends, changed, nil
+}
+
+func (az *Cloud) getServiceSubnet(service *v1.Service) (network.Subnet, error) {
+	subnetName := subnet(service)
+	if subnetName == nil {
+		subnetName = &az.SubnetName
+	}
+	existingSubnet, exists, err := az.getSubnet(az.VnetName, *subnetName)
+	if err != nil {
+		return existingSubnet, err
+	}
+	if !exists {
+		return existingSubnet, fmt.Errorf("failed to get subnet: %s/%s", az.VnetName, *subnetName)
+	}
+	return existingSubnet, nil
+}
+
+func zonalFrontendIPConfigExists(fipConfigs []network.FrontendIPConfiguration, name string) bool {
+	for _, fipConfig := range fipConfigs {
+		if strings.EqualFold(pointer.StringDeref(fipConfig.Name, ""), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureZonalBackendPool ensures the zonal backend pool exists and contains exactly the given IPs if updateIPs is true.
+// It returns true if the backend pools are changed.
+func (az *Cloud) ensureZonalBackendPool(pools *[]network.BackendAddressPool, name string, ips []string, updateIPs bool) bool {
+	vnetResourceGroup := az.ResourceGroup
+	if len(az.VnetResourceGroup) > 0 {
+		vnetResourceGroup = az.VnetResourceGroup
+	}
+	// The virtual network is in the same subscription as the load balancer.
+	vnetID := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/virtualNetworks/%s", az.getNetworkResourceSubscriptionID(), vnetResourceGroup, az.VnetName)
+
+	index := -1
+	for i := range *pools {
+		if strings.EqualFold(pointer.StringDeref((*pools)[i].Name, ""), name) {
+			index = i
+			break
+		}
+	}
+	var changed bool
+	if index < 0 {
+		*pools = append(*pools, network.BackendAddressPool{
+			Name: pointer.String(name),
+			BackendAddressPoolPropertiesFormat: &network.BackendAddressPoolPropertiesFormat{
+				VirtualNetwork: &network.SubResource{ID: pointer.String(vnetID)},
+			},
+		})
+		index = len(*pools) - 1
+		changed = true
+	}
+	if !updateIPs {
+		return changed
+	}
+
+	pool := &(*pools)[index]
+	if pool.BackendAddressPoolPropertiesFormat == nil {
+		pool.BackendAddressPoolPropertiesFormat = &network.BackendAddressPoolPropertiesFormat{
+			VirtualNetwork: &network.SubResource{ID: pointer.String(vnetID)},
+		}
+	}
+	existingIPs := sets.NewString()
+	if pool.LoadBalancerBackendAddresses != nil {
+		for _, address := range *pool.LoadBalancerBackendAddresses {
+			if address.LoadBalancerBackendAddressPropertiesFormat != nil && address.IPAddress != nil {
+				existingIPs.Insert(*address.IPAddress)
+			}
+		}
+	}
+	if existingIPs.Equal(sets.NewString(ips...)) {
+		return changed
+	}
+
+	addresses := make([]network.LoadBalancerBackendAddress, 0, len(ips))
+	for _, ip := range ips {
+		addresses = append(addresses, network.LoadBalancerBackendAddress{
+			Name: pointer.String(ip),
+			LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{
+				IPAddress: pointer.String(ip),
+			},
+		})
+	}
+	pool.LoadBalancerBackendAddresses = &addresses
+	return true
+}
+
+// getZonalBackendIPs returns the private IPs of the nodes grouped by the availability zone of the nodes.
+// The nodes which are not in an availability zone are skipped.
+func (az *Cloud) getZonalBackendIPs(ctx context.Context, service *v1.Service, nodes []*v1.Node) (map[string][]string, error) {
+	zoneIPs := make(map[string]sets.String)
+	for _, node := range nodes {
+		if isControlPlaneNode(node) {
+			klog.V(4).Infof("getZonalBackendIPs: skipping control plane node %s", node.Name)
+			continue
+		}
+		shouldExclude, err := az.ShouldNodeExcludedFromLoadBalancer(node.Name)
+		if err != nil {
+			return nil, err
+		}
+		if shouldExclude {
+			klog.V(4).Infof("getZonalBackendIPs: skipping excluded node %s", node.Name)
+			continue
+		}
+
+		zone, err := az.GetZoneByNodeName(ctx, types.NodeName(node.Name))
+		if err != nil {
+			return nil, fmt.Errorf("getZonalBackendIPs: failed to get the zone of node %s: %w", node.Name, err)
+		}
+		zoneID := az.GetZoneID(zone.FailureDomain)
+		if zoneID == "" {
+			klog.V(4).Infof("getZonalBackendIPs: skipping node %s which is not in an availability zone", node.Name)
+			continue
+		}
+		ip := getNodePrivateIPAddress(service, node)
+		if ip == "" {
+			continue
+		}
+		if zoneIPs[zoneID] == nil {
+			zoneIPs[zoneID] = sets.NewString()
+		}
+		zoneIPs[zoneID].Insert(ip)
+	}
+
+	result := make(map[string][]string, len(zoneIPs))
+	for zone, ips := range zoneIPs {
+		result[zone] = ips.List()
+	}
+	return result, nil
+}
+
+// getExpectedZonalLBRules copies the rules of the zone-redundant frontend to each zonal frontend.
+// The zonal rules share the health probes with the zone-redundant rules.
+func getExpectedZonalLBRules(rules []network.LoadBalancingRule, zonalFrontends []zonalFrontend) []network.LoadBalancingRule {
+	var zonalRules []network.LoadBalancingRule
+	for _, zf := range zonalFrontends {
+		for _, rule := range rules {
+			if rule.LoadBalancingRulePropertiesFormat == nil {
+				continue
+			}
+			props := *rule.LoadBalancingRulePropertiesFormat
+			props.FrontendIPConfiguration = &network.SubResource{ID: pointer.String(zf.fipConfigID)}
+			props.BackendAddressPool = &network.SubResource{ID: pointer.String(zf.backendPoolID)}
+			zonalRules = append(zonalRules, network.LoadBalancingRule{
+				Name:                              pointer.String(getZonalLoadBalancerRuleName(pointer.StringDeref(rule.Name, ""), zf.zone)),
+				LoadBalancingRulePropertiesFormat: &props,
+			})
+		}
+	}
+	return zonalRules
+}
+
+// getZonalFrontendIPs returns the private IPs of the zonal frontends of the service sorted by zone.
+func (az *Cloud) getZonalFrontendIPs(service *v1.Service, lb *network.LoadBalancer) []string {
+	if !consts.IsK8sServiceUsingZonalFrontends(service) || lb == nil ||
+		lb.LoadBalancerPropertiesFormat == nil || lb.FrontendIPConfigurations == nil {
+		return nil
+	}
+
+	ipsByZone := make(map[string]string)
+	for _, fipConfig := range *lb.FrontendIPConfigurations {
+		zone, ok := az.getZoneOfZonalFrontend(service, pointer.StringDeref(fipConfig.Name, ""))
+		if !ok || fipConfig.FrontendIPConfigurationPropertiesFormat == nil || pointer.StringDeref(fipConfig.PrivateIPAddress, "") == "" {
+			continue
+		}
+		ipsByZone[zone] = *fipConfig.PrivateIPAddress
+	}
+
+	zones := make([]string, 0, len(ipsByZone))
+	for zone := range ipsByZone {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+	ips := make([]string, 0, len(zones))
+	for _, zone := range zones {
+		ips = append(ips, ipsByZone[zone])
+	}
+	return ips
+}
@@ -0,0 +1,346 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/subnetclient/mocksubnetclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func getTestZonalCloud(ctrl *gomock.Controller) *Cloud {
+	az := GetTestCloud(ctrl)
+	az.LoadBalancerSku = consts.LoadBalancerSkuStandard
+	az.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypeNodeIP
+	az.regionZonesMap = map[string][]string{az.Location: {"1", "2", "3"}}
+	return az
+}
+
+func getTestZonalNode(name, ip string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: v1.NodeStatus{
+			Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: ip}},
+		},
+	}
+}
+
+func getZonalBackendPoolIPs(t *testing.T, lb *network.LoadBalancer, name string) []string {
+	for _, pool := range *lb.BackendAddressPools {
+		if pointer.StringDeref(pool.Name, "") != name {
+			continue
+		}
+		var ips []string
+		if pool.LoadBalancerBackendAddresses != nil {
+			for _, address := range *pool.LoadBalancerBackendAddresses {
+				ips = append(ips, pointer.StringDeref(address.IPAddress, ""))
+			}
+		}
+		return ips
+	}
+	t.Fatalf("backend pool %s not found", name)
+	return nil
+}
+
+func TestReconcileZonalFrontends(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := getTestZonalCloud(ctrl)
+	svc := getInternalTestService("service1", 80)
+	svc.Annotations[consts.ServiceAnnotationLoadBalancerZonalFrontends] = consts.TrueAnnotationValue
+	defaultFIPName := az.getDefaultFrontendIPConfigName(&svc)
+	lb := &network.LoadBalancer{
+		Name: pointer.String("testCluster-internal"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{{Name: pointer.String(defaultFIPName)}},
+			BackendAddressPools:      &[]network.BackendAddressPool{{Name: pointer.String("testCluster")}},
+		},
+	}
+
+	nodes := []*v1.Node{
+		getTestZonalNode("node1", "10.0.0.1"),
+		getTestZonalNode("node2", "10.0.0.2"),
+		getTestZonalNode("node3", "10.0.0.3"),
+		getTestZonalNode("node4", "10.0.0.4"),
+	}
+	mockVMSet := NewMockVMSet(ctrl)
+	mockVMSet.EXPECT().GetZoneByNodeName("node1").Return(cloudprovider.Zone{FailureDomain: "westus-1"}, nil).AnyTimes()
+	mockVMSet.EXPECT().GetZoneByNodeName("node2").Return(cloudprovider.Zone{FailureDomain: "westus-2"}, nil).AnyTimes()
+	mockVMSet.EXPECT().GetZoneByNodeName("node3").Return(cloudprovider.Zone{FailureDomain: "westus-1"}, nil).AnyTimes()
+	mockVMSet.EXPECT().GetZoneByNodeName("node4").Return(cloudprovider.Zone{FailureDomain: "0"}, nil).AnyTimes()
+	az.VMSet = mockVMSet
+
+	mockSubnetsClient := az.SubnetsClient.(*mocksubnetclient.MockInterface)
+	mockSubnetsClient.EXPECT().Get(gomock.Any(), "rg", "vnet", "subnet", "").Return(network.Subnet{
+		ID:   pointer.String("subnet-id"),
+		Name: pointer.String("subnet"),
+	}, nil).Times(1)
+
+	zonalFrontends, changed, err := az.reconcileZonalFrontends(context.TODO(), testClusterName, &svc, lb, nodes, true)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Len(t, zonalFrontends, 3)
+	assert.Len(t, *lb.FrontendIPConfigurations, 4)
+	assert.Len(t, *lb.BackendAddressPools, 4)
+	for i, zone := range []string{"1", "2", "3"} {
+		name := fmt.Sprintf("zone%s-%s", zone, defaultFIPName)
+		assert.Equal(t, zone, zonalFrontends[i].zone)
+		assert.Equal(t, az.getFrontendIPConfigID("testCluster-internal", "rg", name), zonalFrontends[i].fipConfigID)
+		assert.Equal(t, az.getBackendPoolID("testCluster-internal", "rg", name), zonalFrontends[i].backendPoolID)
+		fip := (*lb.FrontendIPConfigurations)[i+1]
+		assert.Equal(t, name, pointer.StringDeref(fip.Name, ""))
+		assert.Equal(t, []string{zone}, *fip.Zones)
+		assert.Equal(t, "subnet-id", pointer.StringDeref(fip.Subnet.ID, ""))
+	}
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.3"}, getZonalBackendPoolIPs(t, lb, "zone1-"+defaultFIPName))
+	assert.Equal(t, []string{"10.0.0.2"}, getZonalBackendPoolIPs(t, lb, "zone2-"+defaultFIPName))
+	assert.Empty(t, getZonalBackendPoolIPs(t, lb, "zone3-"+defaultFIPName))
+
+	// nothing changes when reconciling again
+	_, changed, err = az.reconcileZonalFrontends(context.TODO(), testClusterName, &svc, lb, nodes, true)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// the existing backend addresses are kept if the nodes are unknown
+	_, changed, err = az.reconcileZonalFrontends(context.TODO(), testClusterName, &svc, lb, nil, true)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, []string{"10.0.0.2"}, getZonalBackendPoolIPs(t, lb, "zone2-"+defaultFIPName))
+
+	// the backend pool is updated when a node leaves the zone
+	_, changed, err = az.reconcileZonalFrontends(context.TODO(), testClusterName, &svc, lb, nodes[1:], true)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, []string{"10.0.0.3"}, getZonalBackendPoolIPs(t, lb, "zone1-"+defaultFIPName))
+
+	// the zonal frontends of other services are not touched
+	svc2 := getInternalTestService("service2", 80)
+	_, changed, err = az.reconcileZonalFrontends(context.TODO(), testClusterName, &svc2, lb, nodes, false)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// all zonal frontends are removed when the service is deleted
+	zonalFrontends, changed, err = az.reconcileZonalFrontends(context.TODO(), testClusterName, &svc, lb, nodes, false)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Empty(t, zonalFrontends)
+	assert.Equal(t, []network.FrontendIPConfiguration{{Name: pointer.String(defaultFIPName)}}, *lb.FrontendIPConfigurations)
+	assert.Equal(t, []network.BackendAddressPool{{Name: pointer.String("testCluster")}}, *lb.BackendAddressPools)
+}
+
+func TestEnsureZonalBackendPoolInNetworkResourceSubscription(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := getTestZonalCloud(ctrl)
+	az.NetworkResourceSubscriptionID = "network-subscription"
+
+	var pools []network.BackendAddressPool
+	assert.True(t, az.ensureZonalBackendPool(&pools, "zone1-pool", []string{"10.0.0.1"}, true))
+	assert.Equal(t, "/subscriptions/network-subscription/resourceGroups/rg/providers/Microsoft.Network/virtualNetworks/vnet", pointer.StringDeref(pools[0].VirtualNetwork.ID, ""))
+}
+
+func TestReconcileZonalFrontendsErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, tc := range []struct {
+		desc          string
+		internal      bool
+		setup         func(az *Cloud)
+		expectedError string
+	}{
+		{
+			desc:          "should report an error for external services",
+			expectedError: "zonal frontends are only supported by internal services",
+		},
+		{
+			desc:          "should report an error for basic load balancers",
+			internal:      true,
+			setup:         func(az *Cloud) { az.LoadBalancerSku = consts.LoadBalancerSkuBasic },
+			expectedError: "zonal frontends are only supported by the single standard load balancer",
+		},
+		{
+			desc:          "should report an error for multiple standard load balancers",
+			internal:      true,
+			setup:         func(az *Cloud) { az.EnableMultipleStandardLoadBalancers = true },
+			expectedError: "zonal frontends are only supported by the single standard load balancer",
+		},
+		{
+			desc:     "should report an error for the node IP configuration backend pool type",
+			internal: true,
+			setup: func(az *Cloud) {
+				az.LoadBalancerBackendPoolConfigurationType = consts.LoadBalancerBackendPoolConfigurationTypeNodeIPConfiguration
+			},
+			expectedError: "zonal frontends are only supported with the nodeIP backend pool type",
+		},
+		{
+			desc:          "should report an error for regions without availability zones",
+			internal:      true,
+			setup:         func(az *Cloud) { az.regionZonesMap = map[string][]string{az.Location: {}} },
+			expectedError: "zonal frontends are not supported in the region westus without availability zones",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			az := getTestZonalCloud(ctrl)
+			if tc.setup != nil {
+				tc.setup(az)
+			}
+			svc := getTestService("service1", v1.ProtocolTCP, nil, false, 80)
+			if tc.internal {
+				svc = getInternalTestService("service1", 80)
+			}
+			svc.Annotations[consts.ServiceAnnotationLoadBalancerZonalFrontends] = consts.TrueAnnotationValue
+			lb := &network.LoadBalancer{Name: pointer.String("testCluster-internal")}
+
+			_, changed, err := az.reconcileZonalFrontends(context.TODO(), testClusterName, &svc, lb, nil, true)
+			assert.EqualError(t, err, tc.expectedError)
+			assert.False(t, changed)
+		})
+	}
+}
+
+func TestGetZoneOfZonalFrontend(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := getTestZonalCloud(ctrl)
+	svc := getInternalTestService("service1", 80)
+	defaultFIPName := az.getDefaultFrontendIPConfigName(&svc)
+
+	for _, tc := range []struct {
+		name         string
+		expectedZone string
+		expectedOK   bool
+	}{
+		{name: "zone1-" + defaultFIPName, expectedZone: "1", expectedOK: true},
+		{name: "zone3-" + defaultFIPName, expectedZone: "3", expectedOK: true},
+		{name: defaultFIPName},
+		{name: "zone1-" + defaultFIPName + "x"},
+		{name: "zone-" + defaultFIPName},
+		{name: "zone1-aservice2"},
+	} {
+		zone, ok := az.getZoneOfZonalFrontend(&svc, tc.name)
+		assert.Equal(t, tc.expectedZone, zone, tc.name)
+		assert.Equal(t, tc.expectedOK, ok, tc.name)
+	}
+
+	svc.Annotations[consts.ServiceAnnotationLoadBalancerInternalSubnet] = strings.Repeat("s", 80)
+	name := az.getZonalFrontendName(&svc, "2")
+	assert.Len(t, name, consts.FrontendIPConfigNameMaxLength)
+	zone, ok := az.getZoneOfZonalFrontend(&svc, name)
+	assert.Equal(t, "2", zone)
+	assert.True(t, ok)
+}
+
+func TestGetExpectedZonalLBRules(t *testing.T) {
+	rules := []network.LoadBalancingRule{
+		{
+			Name: pointer.String("aservice1-TCP-80"),
+			LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+				FrontendIPConfiguration: &network.SubResource{ID: pointer.String("fip")},
+				BackendAddressPool:      &network.SubResource{ID: pointer.String("pool")},
+				Probe:                   &network.SubResource{ID: pointer.String("probe")},
+				FrontendPort:            pointer.Int32(80),
+			},
+		},
+		{
+			Name: pointer.String(strings.Repeat("r", 80)),
+			LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+				FrontendIPConfiguration: &network.SubResource{ID: pointer.String("fip")},
+				BackendAddressPool:      &network.SubResource{ID: pointer.String("pool")},
+				FrontendPort:            pointer.Int32(443),
+			},
+		},
+	}
+	zonalFrontends := []zonalFrontend{
+		{zone: "1", fipConfigID: "fip1", backendPoolID: "pool1"},
+		{zone: "2", fipConfigID: "fip2", backendPoolID: "pool2"},
+	}
+
+	zonalRules := getExpectedZonalLBRules(rules, zonalFrontends)
+	assert.Len(t, zonalRules, 4)
+	assert.Equal(t, "aservice1-TCP-80-zone1", *zonalRules[0].Name)
+	assert.Equal(t, "fip1", *zonalRules[0].FrontendIPConfiguration.ID)
+	assert.Equal(t, "pool1", *zonalRules[0].BackendAddressPool.ID)
+	assert.Equal(t, "probe", *zonalRules[0].Probe.ID)
+	assert.Equal(t, strings.Repeat("r", 74)+"-zone1", *zonalRules[1].Name)
+	assert.Equal(t, "aservice1-TCP-80-zone2", *zonalRules[2].Name)
+	assert.Equal(t, "fip2", *zonalRules[2].FrontendIPConfiguration.ID)
+	assert.Equal(t, "pool2", *zonalRules[3].BackendAddressPool.ID)
+	// the original rules should not be changed
+	assert.Equal(t, "fip", *rules[0].FrontendIPConfiguration.ID)
+	assert.Equal(t, "pool", *rules[1].BackendAddressPool.ID)
+}
+
+func TestGetServiceLoadBalancerStatusWithZonalFrontends(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := getTestZonalCloud(ctrl)
+	svc := getInternalTestService("service1", 80)
+	svc.Annotations[consts.ServiceAnnotationLoadBalancerZonalFrontends] = consts.TrueAnnotationValue
+	defaultFIPName := az.getDefaultFrontendIPConfigName(&svc)
+	lb := &network.LoadBalancer{
+		Name: pointer.String("testCluster-internal"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+				{
+					Name: pointer.String("zone2-" + defaultFIPName),
+					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+						PrivateIPAddress: pointer.String("10.0.0.12"),
+					},
+				},
+				{
+					Name: pointer.String(defaultFIPName),
+					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+						PrivateIPAddress: pointer.String("10.0.0.10"),
+					},
+				},
+				{
+					Name: pointer.String("zone1-" + defaultFIPName),
+					FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+						PrivateIPAddress: pointer.String("10.0.0.11"),
+					},
+				},
+			},
+		},
+	}
+
+	status, fipConfig, err := az.getServiceLoadBalancerStatus(&svc, lb, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, defaultFIPName, pointer.StringDeref(fipConfig.Name, ""))
+	assert.Equal(t, []v1.LoadBalancerIngress{{IP: "10.0.0.10"}, {IP: "10.0.0.11"}, {IP: "10.0.0.12"}}, status.Ingress)
+
+	delete(svc.Annotations, consts.ServiceAnnotationLoadBalancerZonalFrontends)
+	status, _, err = az.getServiceLoadBalancerStatus(&svc, lb, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []v1.LoadBalancerIngress{{IP: "10.0.0.10"}}, status.Ingress)
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"strings"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// vmManagementTypeRegistry records the VM management type of each node with the mixed vmType, so that the
+// node pools of every type are dispatched to the VMSet of their type without listing the VMs. The type is
+// taken from the provider ID of the VMSS Uniform nodes, or from the node label kubernetes.azure.com/vmset-type
+// of the VMSS Flex and availability set nodes. The other nodes are left to the non-VMSS-uniform nodes cache
+// of the scale set.
+type vmManagementTypeRegistry struct {
+	lock         sync.RWMutex
+	byNodeName   map[string]VMManagementType
+	byProviderID map[string]VMManagementType
+}
+
+func newVMManagementTypeRegistry() *vmManagementTypeRegistry {
+	return &vmManagementTypeRegistry{
+		byNodeName:   make(map[string]VMManagementType),
+		byProviderID: make(map[string]VMManagementType),
+	}
+}
+
+// update replaces the type of the previous node with the type of the new node.
+func (r *vmManagementTypeRegistry) update(prevNode, newNode *v1.Node) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if prevNode != nil {
+		delete(r.byNodeName, strings.ToLower(prevNode.Name))
+		delete(r.byProviderID, strings.ToLower(prevNode.Spec.ProviderID))
+	}
+	if newNode == nil {
+		return
+	}
+	vmManagementType, found := getVMManagementTypeOfNode(newNode)
+	if !found {
+		return
+	}
+	r.byNodeName[strings.ToLower(newNode.Name)] = vmManagementType
+	if newNode.Spec.ProviderID != "" {
+		r.byProviderID[strings.ToLower(newNode.Spec.ProviderID)] = vmManagementType
+	}
+}
+
+func (r *vmManagementTypeRegistry) getByNodeName(nodeName string) (VMManagementType, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	vmManagementType, found := r.byNodeName[strings.ToLower(nodeName)]
+	return vmManagementType, found
+}
+
+func (r *vmManagementTypeRegistry) getByProviderID(providerID string) (VMManagementType, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	vmManagementType, found := r.byProviderID[strings.ToLower(providerID)]
+	return vmManagementType, found
+}
+
+// getVMManagementTypeOfNode returns the VM management type of the node. The VMSS Uniform VMs are told by their
+// provider IDs, and the vmset-type label only tells the VMSS Flex VMs from the availability set VMs, whose provider
+// IDs are in the same format, because the label is not protected from the kubelet by the NodeRestriction admission.
+// found is false if the type cannot be told from the node.
+func getVMManagementTypeOfNode(node *v1.Node) (vmManagementType VMManagementType, found bool) {
+	if node.Spec.ProviderID != "" {
+		if _, err := extractScaleSetNameByProviderID(node.Spec.ProviderID); err == nil {
+			return ManagedByVmssUniform, true
+		}
+	}
+
+	if vmSetType, ok := node.Labels[consts.LabelVMSetType]; ok {
+		switch strings.ToLower(vmSetType) {
+		case consts.VMTypeVmssFlex:
+			return ManagedByVmssFlex, true
+		case consts.VMTypeStandard:
+			return ManagedByAvSet, true
+		default:
+			klog.Warningf("getVMManagementTypeOfNode: ignoring the label %s=%s of node %s with provider ID %q", consts.LabelVMSetType, vmSetType, node.Name, node.Spec.ProviderID)
+		}
+	}
+	return ManagedByUnknownVMSet, false
+}
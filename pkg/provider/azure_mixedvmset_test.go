@@ -0,0 +1,163 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+const (
+	testMixedVMSSProviderID = "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/vmss/virtualMachines/0"
+	testMixedVMProviderID   = "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm0"
+)
+
+func TestGetVMManagementTypeOfNode(t *testing.T) {
+	testCases := []struct {
+		desc             string
+		labels           map[string]string
+		providerID       string
+		expectedType     VMManagementType
+		expectedNotFound bool
+	}{
+		{
+			desc:         "VMSS Uniform nodes should be told from their provider IDs",
+			providerID:   testMixedVMSSProviderID,
+			expectedType: ManagedByVmssUniform,
+		},
+		{
+			desc:             "VM nodes without the label should be unknown",
+			providerID:       testMixedVMProviderID,
+			expectedType:     ManagedByUnknownVMSet,
+			expectedNotFound: true,
+		},
+		{
+			desc:         "VMSS Flex nodes should be told from the label",
+			labels:       map[string]string{consts.LabelVMSetType: "VMSSFlex"},
+			providerID:   testMixedVMProviderID,
+			expectedType: ManagedByVmssFlex,
+		},
+		{
+			desc:         "the provider ID of VMSS Uniform nodes should take precedence over the label",
+			labels:       map[string]string{consts.LabelVMSetType: consts.VMTypeStandard},
+			providerID:   testMixedVMSSProviderID,
+			expectedType: ManagedByVmssUniform,
+		},
+		{
+			desc:             "the vmss label should be ignored if the provider ID is not of a VMSS Uniform VM",
+			labels:           map[string]string{consts.LabelVMSetType: consts.VMTypeVMSS},
+			providerID:       testMixedVMProviderID,
+			expectedType:     ManagedByUnknownVMSet,
+			expectedNotFound: true,
+		},
+		{
+			desc:         "availability set nodes should be told from the label",
+			labels:       map[string]string{consts.LabelVMSetType: consts.VMTypeStandard},
+			expectedType: ManagedByAvSet,
+		},
+		{
+			desc:             "invalid labels should be ignored",
+			labels:           map[string]string{consts.LabelVMSetType: "vmas"},
+			expectedType:     ManagedByUnknownVMSet,
+			expectedNotFound: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			node := &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "node", Labels: tc.labels},
+				Spec:       v1.NodeSpec{ProviderID: tc.providerID},
+			}
+			vmManagementType, found := getVMManagementTypeOfNode(node)
+			assert.Equal(t, tc.expectedType, vmManagementType)
+			assert.Equal(t, !tc.expectedNotFound, found)
+		})
+	}
+}
+
+func TestVMManagementTypeRegistry(t *testing.T) {
+	r := newVMManagementTypeRegistry()
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "Node0", Labels: map[string]string{consts.LabelVMSetType: consts.VMTypeStandard}},
+		Spec:       v1.NodeSpec{ProviderID: testMixedVMProviderID},
+	}
+	r.update(nil, node)
+	vmManagementType, found := r.getByNodeName("node0")
+	assert.True(t, found)
+	assert.Equal(t, ManagedByAvSet, vmManagementType)
+	vmManagementType, found = r.getByProviderID(testMixedVMProviderID)
+	assert.True(t, found)
+	assert.Equal(t, ManagedByAvSet, vmManagementType)
+
+	// The type is removed with the label.
+	unlabeled := node.DeepCopy()
+	unlabeled.Labels = nil
+	r.update(node, unlabeled)
+	_, found = r.getByNodeName("node0")
+	assert.False(t, found)
+	_, found = r.getByProviderID(testMixedVMProviderID)
+	assert.False(t, found)
+
+	r.update(unlabeled, nil)
+	assert.Empty(t, r.byNodeName)
+	assert.Empty(t, r.byProviderID)
+}
+
+func TestScaleSetWithMixedVMType(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ss, err := NewTestScaleSet(ctrl)
+	assert.NoError(t, err)
+	ss.Config.VMType = consts.VMTypeMixed
+	ss.Config.EnableVmssFlexNodes = true
+	ss.Config.PrimaryScaleSetName = ""
+	ss.Config.PrimaryAvailabilitySetName = "as"
+	ss.vmManagementTypes = newVMManagementTypeRegistry()
+	ss.vmManagementTypes.update(nil, &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "vmss000000"},
+		Spec:       v1.NodeSpec{ProviderID: testMixedVMSSProviderID},
+	})
+	ss.vmManagementTypes.update(nil, &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "vm0", Labels: map[string]string{consts.LabelVMSetType: consts.VMTypeVmssFlex}},
+		Spec:       v1.NodeSpec{ProviderID: testMixedVMProviderID},
+	})
+
+	// The registered nodes are dispatched without listing the VMs.
+	vmManagementType, err := ss.getVMManagementTypeByNodeName("vmss000000", azcache.CacheReadTypeDefault)
+	assert.NoError(t, err)
+	assert.Equal(t, ManagedByVmssUniform, vmManagementType)
+	vmManagementType, err = ss.getVMManagementTypeByNodeName("vm0", azcache.CacheReadTypeDefault)
+	assert.NoError(t, err)
+	assert.Equal(t, ManagedByVmssFlex, vmManagementType)
+	vmManagementType, err = ss.getVMManagementTypeByProviderID(testMixedVMProviderID, azcache.CacheReadTypeDefault)
+	assert.NoError(t, err)
+	assert.Equal(t, ManagedByVmssFlex, vmManagementType)
+
+	// The primary availability set is used without the primary scale set.
+	assert.Equal(t, "as", ss.GetPrimaryVMSetName())
+	ss.Config.PrimaryScaleSetName = "vmss"
+	assert.Equal(t, "vmss", ss.GetPrimaryVMSetName())
+}
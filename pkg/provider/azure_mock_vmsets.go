@@ -29,6 +29,7 @@ import (
 	cloud_provider "k8s.io/cloud-provider"
 
 	cache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	metadata "sigs.k8s.io/cloud-provider-azure/pkg/nodemanager/metadata"
 )
 
 // MockVMSet is a mock of VMSet interface.
@@ -97,6 +98,20 @@ func (mr *MockVMSetMockRecorder) DetachDisk(ctx, nodeName, diskMap interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DetachDisk", reflect.TypeOf((*MockVMSet)(nil).DetachDisk), ctx, nodeName, diskMap)
 }
 
+// EnsureApplicationSecurityGroupMembers mocks base method.
+func (m *MockVMSet) EnsureApplicationSecurityGroupMembers(service *v1.Service, members []*v1.Node, nonMembers []string, asgID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnsureApplicationSecurityGroupMembers", service, members, nonMembers, asgID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnsureApplicationSecurityGroupMembers indicates an expected call of EnsureApplicationSecurityGroupMembers.
+func (mr *MockVMSetMockRecorder) EnsureApplicationSecurityGroupMembers(service, members, nonMembers, asgID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnsureApplicationSecurityGroupMembers", reflect.TypeOf((*MockVMSet)(nil).EnsureApplicationSecurityGroupMembers), service, members, nonMembers, asgID)
+}
+
 // EnsureBackendPoolDeleted mocks base method.
 func (m *MockVMSet) EnsureBackendPoolDeleted(service *v1.Service, backendPoolID, vmSetName string, backendAddressPools *[]network.BackendAddressPool, deleteFromVMSet bool) (bool, error) {
 	m.ctrl.T.Helper()
@@ -251,6 +266,21 @@ func (mr *MockVMSetMockRecorder) GetNodeCIDRMasksByProviderID(providerID interfa
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNodeCIDRMasksByProviderID", reflect.TypeOf((*MockVMSet)(nil).GetNodeCIDRMasksByProviderID), providerID)
 }
 
+// GetNodeMetadataByNodeName mocks base method.
+func (m *MockVMSet) GetNodeMetadataByNodeName(name string) (*metadata.NodeMetadata, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetNodeMetadataByNodeName", name)
+	ret0, _ := ret[0].(*metadata.NodeMetadata)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetNodeMetadataByNodeName indicates an expected call of GetNodeMetadataByNodeName.
+func (mr *MockVMSetMockRecorder) GetNodeMetadataByNodeName(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNodeMetadataByNodeName", reflect.TypeOf((*MockVMSet)(nil).GetNodeMetadataByNodeName), name)
+}
+
 // GetNodeNameByIPConfigurationID mocks base method.
 func (m *MockVMSet) GetNodeNameByIPConfigurationID(ipConfigurationID string) (string, string, error) {
 	m.ctrl.T.Helper()
@@ -0,0 +1,235 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-03-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/nodemanager/metadata"
+)
+
+// dedicatedHostRE matches the IDs of the dedicated host groups and the dedicated hosts.
+var dedicatedHostRE = regexp.MustCompile(`(?i)/hostGroups/([^/]+)(?:/hosts/([^/]+))?$`)
+
+// GetNodeMetadata returns the Azure metadata of the node synced into the node labels and taints by the
+// cloud node manager. The metadata is read from IMDS if UseInstanceMetadata is set, in which case the
+// proximity placement group and accelerated networking are unknown.
+func (az *Cloud) GetNodeMetadata(ctx context.Context, nodeName types.NodeName) (*metadata.NodeMetadata, error) {
+	if az.UseInstanceMetadata {
+		instanceMetadata, err := az.Metadata.GetMetadata(azcache.CacheReadTypeUnsafe)
+		if err != nil {
+			return nil, err
+		}
+		if instanceMetadata.Compute == nil {
+			_ = az.Metadata.imsCache.Delete(consts.MetadataCacheKey)
+			return nil, errors.New("failure of getting compute information from instance metadata")
+		}
+		return getNodeMetadataFromComputeMetadata(instanceMetadata.Compute), nil
+	}
+
+	// Returns empty metadata for unmanaged nodes because azure cloud provider couldn't fetch information for them.
+	unmanaged, err := az.IsNodeUnmanaged(string(nodeName))
+	if err != nil {
+		return nil, err
+	}
+	if unmanaged {
+		klog.V(2).Infof("GetNodeMetadata: omitting unmanaged node %q", nodeName)
+		return &metadata.NodeMetadata{}, nil
+	}
+	return az.VMSet.GetNodeMetadataByNodeName(string(nodeName))
+}
+
+// GetScheduledEvents returns the scheduled events impacting the current VM from IMDS. The cloud node manager
+// runs on the node, so the current VM is the node.
+func (az *Cloud) GetScheduledEvents() ([]metadata.ScheduledEvent, error) {
+	instanceMetadata, err := az.Metadata.GetMetadata(azcache.CacheReadTypeUnsafe)
+	if err != nil {
+		return nil, err
+	}
+	if instanceMetadata.Compute == nil {
+		_ = az.Metadata.imsCache.Delete(consts.MetadataCacheKey)
+		return nil, errors.New("failure of getting compute information from instance metadata")
+	}
+
+	scheduledEvents, err := az.Metadata.GetScheduledEvents()
+	if err != nil {
+		return nil, err
+	}
+	var events []metadata.ScheduledEvent
+	for _, event := range scheduledEvents.Events {
+		for _, resource := range event.Resources {
+			if strings.EqualFold(resource, instanceMetadata.Compute.Name) {
+				events = append(events, event)
+				break
+			}
+		}
+	}
+	return events, nil
+}
+
+// AcknowledgeScheduledEvent approves the scheduled event of the current VM, so that it starts immediately.
+func (az *Cloud) AcknowledgeScheduledEvent(eventID string) error {
+	return az.Metadata.AcknowledgeScheduledEvent(eventID)
+}
+
+func getNodeMetadataFromComputeMetadata(computeMetadata *ComputeMetadata) *metadata.NodeMetadata {
+	nodeMetadata := &metadata.NodeMetadata{
+		Tags:     make(map[string]string),
+		Priority: computeMetadata.Priority,
+	}
+	for _, tag := range computeMetadata.TagsList {
+		nodeMetadata.Tags[tag.Name] = tag.Value
+	}
+	if computeMetadata.HostGroup != nil {
+		setNodeDedicatedHost(nodeMetadata, computeMetadata.HostGroup.ID)
+	}
+	if computeMetadata.Host != nil {
+		setNodeDedicatedHost(nodeMetadata, computeMetadata.Host.ID)
+	}
+	if computeMetadata.StorageProfile != nil && computeMetadata.StorageProfile.OSDisk != nil {
+		nodeMetadata.EphemeralOSDisk = pointer.Bool(strings.EqualFold(computeMetadata.StorageProfile.OSDisk.DiffDiskSettings.Option, string(compute.Local)))
+	}
+	return nodeMetadata
+}
+
+// getNodeMetadataFromVM returns the metadata of the standalone VM or the VM of a VMSS flex. The accelerated
+// networking is not included since it is set on the NIC.
+func getNodeMetadataFromVM(vm *compute.VirtualMachine, vmssFlex *compute.VirtualMachineScaleSet) *metadata.NodeMetadata {
+	nodeMetadata := &metadata.NodeMetadata{Tags: make(map[string]string)}
+	if vmssFlex != nil {
+		mergeNodeTags(nodeMetadata, vmssFlex.Tags)
+	}
+	mergeNodeTags(nodeMetadata, vm.Tags)
+
+	props := vm.VirtualMachineProperties
+	if props == nil {
+		return nodeMetadata
+	}
+	nodeMetadata.Priority = string(props.Priority)
+	if props.ProximityPlacementGroup != nil {
+		nodeMetadata.ProximityPlacementGroup = getResourceNameFromID(props.ProximityPlacementGroup.ID)
+	}
+	if props.HostGroup != nil {
+		setNodeDedicatedHost(nodeMetadata, pointer.StringDeref(props.HostGroup.ID, ""))
+	}
+	if props.Host != nil {
+		setNodeDedicatedHost(nodeMetadata, pointer.StringDeref(props.Host.ID, ""))
+	}
+	if props.InstanceView != nil && props.InstanceView.AssignedHost != nil {
+		setNodeDedicatedHost(nodeMetadata, *props.InstanceView.AssignedHost)
+	}
+	if props.StorageProfile != nil {
+		nodeMetadata.EphemeralOSDisk = isEphemeralOSDisk(props.StorageProfile.OsDisk)
+	}
+	return nodeMetadata
+}
+
+// getNodeMetadataFromVMSSVM returns the metadata of the VMSS VM. The priority, proximity placement group and
+// host group are set on the VMSS.
+func getNodeMetadataFromVMSSVM(vmss *compute.VirtualMachineScaleSet, vm *compute.VirtualMachineScaleSetVM) *metadata.NodeMetadata {
+	nodeMetadata := &metadata.NodeMetadata{Tags: make(map[string]string)}
+	mergeNodeTags(nodeMetadata, vmss.Tags)
+	mergeNodeTags(nodeMetadata, vm.Tags)
+
+	if props := vmss.VirtualMachineScaleSetProperties; props != nil {
+		if props.VirtualMachineProfile != nil {
+			nodeMetadata.Priority = string(props.VirtualMachineProfile.Priority)
+		}
+		if props.ProximityPlacementGroup != nil {
+			nodeMetadata.ProximityPlacementGroup = getResourceNameFromID(props.ProximityPlacementGroup.ID)
+		}
+		if props.HostGroup != nil {
+			setNodeDedicatedHost(nodeMetadata, pointer.StringDeref(props.HostGroup.ID, ""))
+		}
+	}
+
+	props := vm.VirtualMachineScaleSetVMProperties
+	if props == nil {
+		return nodeMetadata
+	}
+	if props.InstanceView != nil && props.InstanceView.AssignedHost != nil {
+		setNodeDedicatedHost(nodeMetadata, *props.InstanceView.AssignedHost)
+	}
+	if props.StorageProfile != nil {
+		nodeMetadata.EphemeralOSDisk = isEphemeralOSDisk(props.StorageProfile.OsDisk)
+	}
+	if props.NetworkProfileConfiguration != nil && props.NetworkProfileConfiguration.NetworkInterfaceConfigurations != nil {
+		nicConfigs := *props.NetworkProfileConfiguration.NetworkInterfaceConfigurations
+		for _, nicConfig := range nicConfigs {
+			if nicConfig.VirtualMachineScaleSetNetworkConfigurationProperties == nil {
+				continue
+			}
+			if len(nicConfigs) == 1 || pointer.BoolDeref(nicConfig.Primary, false) {
+				nodeMetadata.AcceleratedNetworking = pointer.Bool(pointer.BoolDeref(nicConfig.EnableAcceleratedNetworking, false))
+				break
+			}
+		}
+	}
+	return nodeMetadata
+}
+
+// setNodeAcceleratedNetworking sets whether the accelerated networking is enabled on the primary NIC of the node.
+func setNodeAcceleratedNetworking(nodeMetadata *metadata.NodeMetadata, nic network.Interface) {
+	if nic.InterfacePropertiesFormat != nil {
+		nodeMetadata.AcceleratedNetworking = pointer.Bool(pointer.BoolDeref(nic.EnableAcceleratedNetworking, false))
+	}
+}
+
+// setNodeDedicatedHost sets the dedicated host group and the dedicated host by the ID of either of them.
+func setNodeDedicatedHost(nodeMetadata *metadata.NodeMetadata, id string) {
+	matches := dedicatedHostRE.FindStringSubmatch(id)
+	if len(matches) != 3 {
+		return
+	}
+	nodeMetadata.HostGroup = matches[1]
+	if matches[2] != "" {
+		nodeMetadata.DedicatedHost = matches[2]
+	}
+}
+
+func mergeNodeTags(nodeMetadata *metadata.NodeMetadata, tags map[string]*string) {
+	for k, v := range tags {
+		nodeMetadata.Tags[k] = pointer.StringDeref(v, "")
+	}
+}
+
+func isEphemeralOSDisk(osDisk *compute.OSDisk) *bool {
+	if osDisk == nil {
+		return nil
+	}
+	return pointer.Bool(osDisk.DiffDiskSettings != nil && strings.EqualFold(string(osDisk.DiffDiskSettings.Option), string(compute.Local)))
+}
+
+func getResourceNameFromID(id *string) string {
+	name, err := getLastSegment(pointer.StringDeref(id, ""), "/")
+	if err != nil {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2022-03-01/compute"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/nodemanager/metadata"
+)
+
+const (
+	testHostGroupID = "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Compute/hostGroups/hostgroup"
+	testPPGID       = "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Compute/proximityPlacementGroups/ppg"
+)
+
+func TestGetNodeMetadataFromVM(t *testing.T) {
+	vm := &compute.VirtualMachine{
+		Tags: map[string]*string{"team": pointer.String("infra"), "env": pointer.String("vm")},
+		VirtualMachineProperties: &compute.VirtualMachineProperties{
+			Priority:                compute.Spot,
+			ProximityPlacementGroup: &compute.SubResource{ID: pointer.String(testPPGID)},
+			HostGroup:               &compute.SubResource{ID: pointer.String(testHostGroupID)},
+			InstanceView:            &compute.VirtualMachineInstanceView{AssignedHost: pointer.String(testHostGroupID + "/hosts/host")},
+			StorageProfile: &compute.StorageProfile{
+				OsDisk: &compute.OSDisk{DiffDiskSettings: &compute.DiffDiskSettings{Option: compute.Local}},
+			},
+		},
+	}
+	vmssFlex := &compute.VirtualMachineScaleSet{
+		Tags: map[string]*string{"env": pointer.String("vmss"), "owner": pointer.String("me")},
+	}
+
+	assert.Equal(t, &metadata.NodeMetadata{
+		Tags:                    map[string]string{"team": "infra", "env": "vm", "owner": "me"},
+		Priority:                "Spot",
+		HostGroup:               "hostgroup",
+		DedicatedHost:           "host",
+		ProximityPlacementGroup: "ppg",
+		EphemeralOSDisk:         pointer.Bool(true),
+	}, getNodeMetadataFromVM(vm, vmssFlex))
+}
+
+func TestGetNodeMetadataFromVMSSVM(t *testing.T) {
+	vmss := &compute.VirtualMachineScaleSet{
+		Tags: map[string]*string{"team": pointer.String("infra")},
+		VirtualMachineScaleSetProperties: &compute.VirtualMachineScaleSetProperties{
+			VirtualMachineProfile:   &compute.VirtualMachineScaleSetVMProfile{Priority: compute.Regular},
+			ProximityPlacementGroup: &compute.SubResource{ID: pointer.String(testPPGID)},
+		},
+	}
+	vm := &compute.VirtualMachineScaleSetVM{
+		VirtualMachineScaleSetVMProperties: &compute.VirtualMachineScaleSetVMProperties{
+			StorageProfile: &compute.StorageProfile{OsDisk: &compute.OSDisk{}},
+			NetworkProfileConfiguration: &compute.VirtualMachineScaleSetVMNetworkProfileConfiguration{
+				NetworkInterfaceConfigurations: &[]compute.VirtualMachineScaleSetNetworkConfiguration{
+					{
+						VirtualMachineScaleSetNetworkConfigurationProperties: &compute.VirtualMachineScaleSetNetworkConfigurationProperties{
+							EnableAcceleratedNetworking: pointer.Bool(true),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, &metadata.NodeMetadata{
+		Tags:                    map[string]string{"team": "infra"},
+		Priority:                "Regular",
+		ProximityPlacementGroup: "ppg",
+		AcceleratedNetworking:   pointer.Bool(true),
+		EphemeralOSDisk:         pointer.Bool(false),
+	}, getNodeMetadataFromVMSSVM(vmss, vm))
+}
+
+func TestGetNodeMetadataFromIMDS(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	az.UseInstanceMetadata = true
+
+	mockMetadata := &InstanceMetadata{
+		Compute: &ComputeMetadata{
+			Priority: "Spot",
+			TagsList: []ComputeTag{{Name: "team", Value: "infra"}},
+			Host:     &ComputeSubResource{ID: testHostGroupID + "/hosts/host"},
+			StorageProfile: &StorageProfileMetadata{
+				OSDisk: &OSDiskMetadata{DiffDiskSettings: DiffDiskSettingsMetadata{Option: "Local"}},
+			},
+		},
+	}
+	var err error
+	az.Metadata, err = NewInstanceMetadataService("http://169.254.169.254/")
+	assert.NoError(t, err)
+	az.Metadata.imsCache, err = azcache.NewTimedcache(consts.MetadataCacheTTL, func(key string) (interface{}, error) {
+		return mockMetadata, nil
+	})
+	assert.NoError(t, err)
+
+	nodeMetadata, err := az.GetNodeMetadata(context.TODO(), "vm1")
+	assert.NoError(t, err)
+	assert.Equal(t, &metadata.NodeMetadata{
+		Tags:            map[string]string{"team": "infra"},
+		Priority:        "Spot",
+		HostGroup:       "hostgroup",
+		DedicatedHost:   "host",
+		EphemeralOSDisk: pointer.Bool(true),
+	}, nodeMetadata)
+}
+
+func TestGetScheduledEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var acknowledged string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, consts.ImdsScheduledEventsURI, r.URL.Path)
+		assert.Equal(t, consts.ImdsScheduledEventsAPIVersion, r.URL.Query().Get("api-version"))
+		assert.Equal(t, "True", r.Header.Get("Metadata"))
+		switch r.Method {
+		case http.MethodGet:
+			_, _ = w.Write([]byte(`{"DocumentIncarnation":2,"Events":[
+				{"EventId":"event1","EventType":"Preempt","ResourceType":"VirtualMachine","Resources":["vm1"],"EventStatus":"Scheduled","NotBefore":"Mon, 19 Sep 2022 18:29:47 GMT","EventSource":"Platform","DurationInSeconds":-1},
+				{"EventId":"event2","EventType":"Reboot","ResourceType":"VirtualMachine","Resources":["vm2"],"EventStatus":"Scheduled"}]}`))
+		case http.MethodPost:
+			body, err := ioutil.ReadAll(r.Body)
+			assert.NoError(t, err)
+			var request struct {
+				StartRequests []struct {
+					EventID string `json:"EventId"`
+				}
+			}
+			assert.NoError(t, json.Unmarshal(body, &request))
+			assert.Len(t, request.StartRequests, 1)
+			acknowledged = request.StartRequests[0].EventID
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer server.Close()
+
+	az := GetTestCloud(ctrl)
+	var err error
+	az.Metadata, err = NewInstanceMetadataService(server.URL)
+	assert.NoError(t, err)
+	az.Metadata.imsCache, err = azcache.NewTimedcache(consts.MetadataCacheTTL, func(key string) (interface{}, error) {
+		return &InstanceMetadata{Compute: &ComputeMetadata{Name: "VM1"}}, nil
+	})
+	assert.NoError(t, err)
+
+	events, err := az.GetScheduledEvents()
+	assert.NoError(t, err)
+	assert.Equal(t, []metadata.ScheduledEvent{
+		{
+			EventID:           "event1",
+			EventType:         "Preempt",
+			ResourceType:      "VirtualMachine",
+			Resources:         []string{"vm1"},
+			EventStatus:       "Scheduled",
+			NotBefore:         "Mon, 19 Sep 2022 18:29:47 GMT",
+			EventSource:       "Platform",
+			DurationInSeconds: -1,
+		},
+	}, events)
+
+	assert.NoError(t, az.AcknowledgeScheduledEvent("event1"))
+	assert.Equal(t, "event1", acknowledged)
+}
+
+func TestGetScheduledEventsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	ims, err := NewInstanceMetadataService(server.URL)
+	assert.NoError(t, err)
+	_, err = ims.GetScheduledEvents()
+	assert.Error(t, err)
+	assert.Error(t, ims.AcknowledgeScheduledEvent("event1"))
+}
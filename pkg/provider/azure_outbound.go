@@ -0,0 +1,386 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func validateOutboundConfig(config *OutboundConfig) error {
+	if !strings.EqualFold(config.Type, consts.OutboundTypeLoadBalancer) && !strings.EqualFold(config.Type, consts.OutboundTypeNatGateway) {
+		return fmt.Errorf("outboundConfig.type %q is not supported, supported values are %s and %s", config.Type, consts.OutboundTypeLoadBalancer, consts.OutboundTypeNatGateway)
+	}
+	if config.AllocatedOutboundPorts < 0 || config.AllocatedOutboundPorts > consts.LoadBalancerOutboundPortsPerIP || config.AllocatedOutboundPorts%8 != 0 {
+		return fmt.Errorf("outboundConfig.allocatedOutboundPorts %d should be a multiple of 8 between 0 and %d", config.AllocatedOutboundPorts, consts.LoadBalancerOutboundPortsPerIP)
+	}
+	if config.OutboundIPCount < 0 || config.OutboundIPCount > consts.MaxOutboundIPCount {
+		return fmt.Errorf("outboundConfig.outboundIPCount %d should be between 0 and %d", config.OutboundIPCount, consts.MaxOutboundIPCount)
+	}
+	if config.IdleTimeoutInMinutes != 0 && (config.IdleTimeoutInMinutes < 4 || config.IdleTimeoutInMinutes > 120) {
+		return fmt.Errorf("outboundConfig.idleTimeoutInMinutes %d should be between 4 and 120", config.IdleTimeoutInMinutes)
+	}
+	return nil
+}
+
+// getOutboundAllocation returns the number of outbound IPs and the SNAT ports allocated to each node. The
+// allocation is planned for 10% more nodes than the current ones, at least one more, so that the nodes added
+// before the next sync still get their ports.
+func (config *OutboundConfig) getOutboundAllocation(nodeCount int, portsPerIP int32) (int32, int32) {
+	plannedNodeCount := int32(nodeCount + (nodeCount+9)/10)
+	if plannedNodeCount < 1 {
+		plannedNodeCount = 1
+	}
+
+	ipCount := config.OutboundIPCount
+	if ipCount == 0 {
+		ipCount = 1
+		if config.AllocatedOutboundPorts > 0 {
+			ipCount = int32((int64(config.AllocatedOutboundPorts)*int64(plannedNodeCount) + int64(portsPerIP) - 1) / int64(portsPerIP))
+		}
+		if ipCount < 1 {
+			ipCount = 1
+		}
+		if ipCount > consts.MaxOutboundIPCount {
+			ipCount = consts.MaxOutboundIPCount
+		}
+	}
+
+	ports := config.AllocatedOutboundPorts
+	if ports == 0 {
+		ports = int32(int64(ipCount) * int64(portsPerIP) / int64(plannedNodeCount) / 8 * 8)
+		if ports > consts.LoadBalancerOutboundPortsPerIP {
+			ports = consts.LoadBalancerOutboundPortsPerIP
+		}
+	}
+	return ipCount, ports
+}
+
+func (config *OutboundConfig) getIdleTimeoutInMinutes() int32 {
+	if config.IdleTimeoutInMinutes == 0 {
+		return consts.DefaultOutboundIdleTimeoutInMinutes
+	}
+	return config.IdleTimeoutInMinutes
+}
+
+// RunOutboundController periodically reconciles the outbound rule or the NAT gateway with the node count until
+// the context is done.
+func (az *Cloud) RunOutboundController(ctx context.Context, clusterName string) {
+	klog.Infof("Starting outbound controller for cluster %q with outbound type %s", clusterName, az.OutboundConfig.Type)
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := az.reconcileOutbound(clusterName); err != nil {
+			klog.Errorf("reconcileOutbound: %v", err)
+		}
+	}, consts.OutboundSyncPeriod)
+}
+
+func (az *Cloud) reconcileOutbound(clusterName string) error {
+	if az.OutboundConfig == nil {
+		return nil
+	}
+	nodeNames, err := az.GetNodeNames()
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(az.OutboundConfig.Type, consts.OutboundTypeNatGateway) {
+		return az.reconcileOutboundNatGateway(clusterName, nodeNames.Len())
+	}
+	return az.reconcileOutboundLoadBalancer(clusterName, nodeNames.Len())
+}
+
+// reconcileOutboundLoadBalancer reconciles the outbound rule of the primary standard load balancer, with one
+// frontend IP configuration per outbound public IP. The outbound rule uses the cluster backend pool, so it is
+// only added once the load balancer has been created for the services.
+func (az *Cloud) reconcileOutboundLoadBalancer(clusterName string, nodeCount int) error {
+	lbName := az.getAzureLoadBalancerName(clusterName, az.VMSet.GetPrimaryVMSetName(), false)
+	lb, exists, err := az.getAzureLoadBalancer(lbName, azcache.CacheReadTypeDefault)
+	if err != nil {
+		return err
+	}
+	lbResourceGroup := az.getLoadBalancerResourceGroup()
+	backendPoolName := clusterName
+	if !exists || lb.LoadBalancerPropertiesFormat == nil || lb.BackendAddressPools == nil || !hasBackendPool(*lb.BackendAddressPools, backendPoolName) {
+		klog.V(2).Infof("reconcileOutboundLoadBalancer: load balancer %s or its backend pool %s does not exist yet", lbName, backendPoolName)
+		return nil
+	}
+
+	ipCount, ports := az.OutboundConfig.getOutboundAllocation(nodeCount, consts.LoadBalancerOutboundPortsPerIP)
+	pipIDs, err := az.ensureOutboundPublicIPs(clusterName, ipCount)
+	if err != nil {
+		return err
+	}
+
+	outboundName := clusterName + consts.OutboundResourceNameSuffix
+	dirtyLB := false
+	var fipConfigs []network.FrontendIPConfiguration
+	if lb.FrontendIPConfigurations != nil {
+		fipConfigs = *lb.FrontendIPConfigurations
+	}
+	var outboundFIPConfigIDs []network.SubResource
+	for i, pipID := range pipIDs {
+		fipConfigName := getOutboundResourceName(outboundName, i)
+		outboundFIPConfigIDs = append(outboundFIPConfigIDs, network.SubResource{ID: pointer.String(az.getFrontendIPConfigID(lbName, lbResourceGroup, fipConfigName))})
+		found := false
+		for _, fipConfig := range fipConfigs {
+			if strings.EqualFold(pointer.StringDeref(fipConfig.Name, ""), fipConfigName) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			klog.V(2).Infof("reconcileOutboundLoadBalancer: adding frontend IP configuration %s to load balancer %s", fipConfigName, lbName)
+			fipConfigs = append(fipConfigs, network.FrontendIPConfiguration{
+				Name: pointer.String(fipConfigName),
+				FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+					PublicIPAddress: &network.PublicIPAddress{ID: pointer.String(pipID)},
+				},
+			})
+			dirtyLB = true
+		}
+	}
+	for i := len(fipConfigs) - 1; i >= 0; i-- {
+		if isStaleOutboundResource(pointer.StringDeref(fipConfigs[i].Name, ""), outboundName, ipCount) {
+			klog.V(2).Infof("reconcileOutboundLoadBalancer: removing frontend IP configuration %s from load balancer %s", pointer.StringDeref(fipConfigs[i].Name, ""), lbName)
+			fipConfigs = append(fipConfigs[:i], fipConfigs[i+1:]...)
+			dirtyLB = true
+		}
+	}
+
+	expectedRule := network.OutboundRule{
+		Name: pointer.String(outboundName),
+		OutboundRulePropertiesFormat: &network.OutboundRulePropertiesFormat{
+			AllocatedOutboundPorts:   pointer.Int32(ports),
+			FrontendIPConfigurations: &outboundFIPConfigIDs,
+			BackendAddressPool:       &network.SubResource{ID: pointer.String(az.getBackendPoolID(lbName, lbResourceGroup, backendPoolName))},
+			Protocol:                 network.LoadBalancerOutboundRuleProtocolAll,
+			EnableTCPReset:           pointer.Bool(true),
+			IdleTimeoutInMinutes:     pointer.Int32(az.OutboundConfig.getIdleTimeoutInMinutes()),
+		},
+	}
+	var outboundRules []network.OutboundRule
+	if lb.OutboundRules != nil {
+		outboundRules = *lb.OutboundRules
+	}
+	foundRule := false
+	for i := range outboundRules {
+		if !strings.EqualFold(pointer.StringDeref(outboundRules[i].Name, ""), outboundName) {
+			continue
+		}
+		foundRule = true
+		if !equalOutboundRules(outboundRules[i], expectedRule) {
+			klog.V(2).Infof("reconcileOutboundLoadBalancer: updating outbound rule %s of load balancer %s with %d IPs and %d ports per node", outboundName, lbName, ipCount, ports)
+			outboundRules[i] = expectedRule
+			dirtyLB = true
+		}
+	}
+	if !foundRule {
+		klog.V(2).Infof("reconcileOutboundLoadBalancer: adding outbound rule %s to load balancer %s with %d IPs and %d ports per node", outboundName, lbName, ipCount, ports)
+		outboundRules = append(outboundRules, expectedRule)
+		dirtyLB = true
+	}
+
+	if dirtyLB {
+		lb.FrontendIPConfigurations = &fipConfigs
+		lb.OutboundRules = &outboundRules
+		if err := az.CreateOrUpdateLB(nil, *lb); err != nil {
+			return err
+		}
+	}
+	return az.deleteStaleOutboundPublicIPs(clusterName, ipCount)
+}
+
+// reconcileOutboundNatGateway reconciles the NAT gateway with the outbound public IPs and attaches it to the
+// node subnet. The NAT gateway allocates the SNAT ports on demand, so only the IP count depends on the nodes.
+func (az *Cloud) reconcileOutboundNatGateway(clusterName string, nodeCount int) error {
+	natGatewayName := az.OutboundConfig.NatGatewayName
+	if natGatewayName == "" {
+		natGatewayName = clusterName + consts.NatGatewayNameSuffix
+	}
+	ipCount, _ := az.OutboundConfig.getOutboundAllocation(nodeCount, consts.NatGatewayOutboundPortsPerIP)
+	pipIDs, err := az.ensureOutboundPublicIPs(clusterName, ipCount)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	natGateway, rerr := az.NatGatewaysClient.Get(ctx, az.ResourceGroup, natGatewayName, "")
+	if rerr != nil && rerr.HTTPStatusCode != http.StatusNotFound {
+		return rerr.Error()
+	}
+	expectedPIPs := make([]network.SubResource, 0, len(pipIDs))
+	for _, pipID := range pipIDs {
+		expectedPIPs = append(expectedPIPs, network.SubResource{ID: pointer.String(pipID)})
+	}
+	idleTimeout := az.OutboundConfig.getIdleTimeoutInMinutes()
+	if rerr != nil || natGateway.NatGatewayPropertiesFormat == nil ||
+		pointer.Int32Deref(natGateway.IdleTimeoutInMinutes, 0) != idleTimeout ||
+		!equalSubResourceIDs(natGateway.PublicIPAddresses, &expectedPIPs) {
+		if rerr != nil {
+			natGateway = network.NatGateway{
+				Name:     pointer.String(natGatewayName),
+				Location: pointer.String(az.Location),
+				Sku:      &network.NatGatewaySku{Name: network.NatGatewaySkuNameStandard},
+				Tags:     map[string]*string{consts.ClusterNameKey: pointer.String(clusterName)},
+			}
+		}
+		if natGateway.NatGatewayPropertiesFormat == nil {
+			natGateway.NatGatewayPropertiesFormat = &network.NatGatewayPropertiesFormat{}
+		}
+		natGateway.IdleTimeoutInMinutes = pointer.Int32(idleTimeout)
+		natGateway.PublicIPAddresses = &expectedPIPs
+		klog.V(2).Infof("reconcileOutboundNatGateway: updating NAT gateway %s with %d IPs", natGatewayName, ipCount)
+		if err := az.CreateOrUpdateNatGateway(az.ResourceGroup, natGateway); err != nil {
+			return err
+		}
+	}
+
+	natGatewayID := az.getNatGatewayID(az.ResourceGroup, natGatewayName)
+	subnet, exists, err := az.getSubnet(az.VnetName, az.SubnetName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("node subnet %s not found in virtual network %s", az.SubnetName, az.VnetName)
+	}
+	if subnet.SubnetPropertiesFormat == nil {
+		subnet.SubnetPropertiesFormat = &network.SubnetPropertiesFormat{}
+	}
+	if subnet.NatGateway == nil || !strings.EqualFold(pointer.StringDeref(subnet.NatGateway.ID, ""), natGatewayID) {
+		klog.V(2).Infof("reconcileOutboundNatGateway: attaching NAT gateway %s to subnet %s", natGatewayName, az.SubnetName)
+		subnet.NatGateway = &network.SubResource{ID: pointer.String(natGatewayID)}
+		if err := az.CreateOrUpdateSubnet(nil, subnet); err != nil {
+			return err
+		}
+	}
+	return az.deleteStaleOutboundPublicIPs(clusterName, ipCount)
+}
+
+// ensureOutboundPublicIPs ensures the outbound public IPs "<clusterName>-outbound-<index>" exist in the cluster
+// resource group and returns their IDs.
+func (az *Cloud) ensureOutboundPublicIPs(clusterName string, ipCount int32) ([]string, error) {
+	outboundName := clusterName + consts.OutboundResourceNameSuffix
+	pipIDs := make([]string, 0, ipCount)
+	for i := 0; i < int(ipCount); i++ {
+		pipName := getOutboundResourceName(outboundName, i)
+		_, exists, err := az.getPublicIPAddress(az.ResourceGroup, pipName, azcache.CacheReadTypeDefault)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			klog.V(2).Infof("ensureOutboundPublicIPs: creating public IP %s", pipName)
+			pip := network.PublicIPAddress{
+				Name:     pointer.String(pipName),
+				Location: pointer.String(az.Location),
+				Sku:      &network.PublicIPAddressSku{Name: network.PublicIPAddressSkuNameStandard},
+				PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+					PublicIPAllocationMethod: network.Static,
+					PublicIPAddressVersion:   network.IPv4,
+				},
+				Tags: map[string]*string{consts.ClusterNameKey: pointer.String(clusterName)},
+			}
+			if err := az.CreateOrUpdatePIP(nil, az.ResourceGroup, pip); err != nil {
+				return nil, err
+			}
+		}
+		pipIDs = append(pipIDs, az.getPublicIPAddressID(az.ResourceGroup, pipName))
+	}
+	return pipIDs, nil
+}
+
+// deleteStaleOutboundPublicIPs deletes the outbound public IPs beyond the IP count after they are released.
+func (az *Cloud) deleteStaleOutboundPublicIPs(clusterName string, ipCount int32) error {
+	outboundName := clusterName + consts.OutboundResourceNameSuffix
+	for i := int(ipCount); i < consts.MaxOutboundIPCount; i++ {
+		pipName := getOutboundResourceName(outboundName, i)
+		_, exists, err := az.getPublicIPAddress(az.ResourceGroup, pipName, azcache.CacheReadTypeDefault)
+		if err != nil {
+			return err
+		}
+		if exists {
+			klog.V(2).Infof("deleteStaleOutboundPublicIPs: deleting public IP %s", pipName)
+			if err := az.DeletePublicIP(nil, az.ResourceGroup, pipName); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func getOutboundResourceName(outboundName string, index int) string {
+	return fmt.Sprintf("%s-%d", outboundName, index)
+}
+
+// isStaleOutboundResource returns true if the name is an indexed outbound resource beyond the IP count.
+func isStaleOutboundResource(name, outboundName string, ipCount int32) bool {
+	for i := int(ipCount); i < consts.MaxOutboundIPCount; i++ {
+		if strings.EqualFold(name, getOutboundResourceName(outboundName, i)) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasBackendPool(backendPools []network.BackendAddressPool, name string) bool {
+	for _, backendPool := range backendPools {
+		if strings.EqualFold(pointer.StringDeref(backendPool.Name, ""), name) {
+			return true
+		}
+	}
+	return false
+}
+
+func equalOutboundRules(existing, expected network.OutboundRule) bool {
+	if existing.OutboundRulePropertiesFormat == nil {
+		return false
+	}
+	return pointer.Int32Deref(existing.AllocatedOutboundPorts, 0) == pointer.Int32Deref(expected.AllocatedOutboundPorts, 0) &&
+		pointer.Int32Deref(existing.IdleTimeoutInMinutes, 0) == pointer.Int32Deref(expected.IdleTimeoutInMinutes, 0) &&
+		existing.BackendAddressPool != nil &&
+		strings.EqualFold(pointer.StringDeref(existing.BackendAddressPool.ID, ""), pointer.StringDeref(expected.BackendAddressPool.ID, "")) &&
+		equalSubResourceIDs(existing.FrontendIPConfigurations, expected.FrontendIPConfigurations)
+}
+
+// equalSubResourceIDs compares the IDs of the sub resources case-insensitively regardless of their order.
+func equalSubResourceIDs(existing, expected *[]network.SubResource) bool {
+	getIDs := func(subResources *[]network.SubResource) []string {
+		ids := []string{}
+		if subResources == nil {
+			return ids
+		}
+		for _, subResource := range *subResources {
+			ids = append(ids, strings.ToLower(pointer.StringDeref(subResource.ID, "")))
+		}
+		sort.Strings(ids)
+		return ids
+	}
+	return reflect.DeepEqual(getIDs(existing), getIDs(expected))
+}
@@ -0,0 +1,281 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/loadbalancerclient/mockloadbalancerclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/natgatewayclient/mocknatgatewayclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/subnetclient/mocksubnetclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func TestValidateOutboundConfig(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		config      OutboundConfig
+		expectedErr bool
+	}{
+		{
+			desc:   "load balancer outbound type should be valid",
+			config: OutboundConfig{Type: consts.OutboundTypeLoadBalancer, AllocatedOutboundPorts: 1024, OutboundIPCount: 2, IdleTimeoutInMinutes: 30},
+		},
+		{
+			desc:   "NAT gateway outbound type should be valid",
+			config: OutboundConfig{Type: consts.OutboundTypeNatGateway},
+		},
+		{
+			desc:        "unknown outbound types should be refused",
+			config:      OutboundConfig{Type: "userDefinedRouting"},
+			expectedErr: true,
+		},
+		{
+			desc:        "ports which are not a multiple of 8 should be refused",
+			config:      OutboundConfig{Type: consts.OutboundTypeLoadBalancer, AllocatedOutboundPorts: 1001},
+			expectedErr: true,
+		},
+		{
+			desc:        "too many outbound IPs should be refused",
+			config:      OutboundConfig{Type: consts.OutboundTypeLoadBalancer, OutboundIPCount: 17},
+			expectedErr: true,
+		},
+		{
+			desc:        "idle timeouts out of range should be refused",
+			config:      OutboundConfig{Type: consts.OutboundTypeNatGateway, IdleTimeoutInMinutes: 2},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			err := validateOutboundConfig(&test.config)
+			assert.Equal(t, test.expectedErr, err != nil, err)
+		})
+	}
+}
+
+func TestSetLBDefaultsWithOutboundConfig(t *testing.T) {
+	az := &Cloud{}
+	config := &Config{
+		LoadBalancerSku: consts.LoadBalancerSkuStandard,
+		OutboundConfig:  &OutboundConfig{Type: consts.OutboundTypeLoadBalancer},
+	}
+	assert.NoError(t, az.setLBDefaults(config))
+	assert.True(t, *config.DisableOutboundSNAT)
+
+	config.DisableOutboundSNAT = pointer.Bool(false)
+	assert.Error(t, az.setLBDefaults(config))
+
+	config = &Config{
+		LoadBalancerSku: consts.LoadBalancerSkuBasic,
+		OutboundConfig:  &OutboundConfig{Type: consts.OutboundTypeNatGateway},
+	}
+	assert.Error(t, az.setLBDefaults(config))
+}
+
+func TestGetOutboundAllocation(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		config          OutboundConfig
+		nodeCount       int
+		expectedIPCount int32
+		expectedPorts   int32
+	}{
+		{
+			desc:            "the ports of one IP should be divided among the nodes with headroom",
+			nodeCount:       10,
+			expectedIPCount: 1,
+			expectedPorts:   5816,
+		},
+		{
+			desc:            "the IP count should be computed from the allocated ports",
+			config:          OutboundConfig{AllocatedOutboundPorts: 1024},
+			nodeCount:       100,
+			expectedIPCount: 2,
+			expectedPorts:   1024,
+		},
+		{
+			desc:            "the computed IP count should be limited",
+			config:          OutboundConfig{AllocatedOutboundPorts: 64000},
+			nodeCount:       100,
+			expectedIPCount: consts.MaxOutboundIPCount,
+			expectedPorts:   64000,
+		},
+		{
+			desc:            "the computed ports should be limited",
+			config:          OutboundConfig{OutboundIPCount: 2},
+			expectedIPCount: 2,
+			expectedPorts:   64000,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			ipCount, ports := test.config.getOutboundAllocation(test.nodeCount, consts.LoadBalancerOutboundPortsPerIP)
+			assert.Equal(t, test.expectedIPCount, ipCount)
+			assert.Equal(t, test.expectedPorts, ports)
+		})
+	}
+}
+
+func TestReconcileOutboundLoadBalancer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.OutboundConfig = &OutboundConfig{Type: consts.OutboundTypeLoadBalancer, OutboundIPCount: 1, IdleTimeoutInMinutes: 30}
+	az.nodeInformerSynced = func() bool { return true }
+	az.nodeNames = sets.NewString("node1", "node2")
+
+	lbName := testClusterName
+	lb := network.LoadBalancer{
+		Name: pointer.String(lbName),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			FrontendIPConfigurations: &[]network.FrontendIPConfiguration{
+				{Name: pointer.String("service-fip")},
+				{Name: pointer.String(testClusterName + "-outbound-1")},
+			},
+			BackendAddressPools: &[]network.BackendAddressPool{{Name: pointer.String(testClusterName)}},
+		},
+	}
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().Get(gomock.Any(), "rg", lbName, "").Return(lb, nil)
+	mockLBClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", lbName, gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, resourceGroupName, loadBalancerName string, parameters network.LoadBalancer, etag string) *retry.Error {
+			assert.Equal(t, 2, len(*parameters.FrontendIPConfigurations))
+			assert.Equal(t, testClusterName+"-outbound-0", *(*parameters.FrontendIPConfigurations)[1].Name)
+			assert.Equal(t, 1, len(*parameters.OutboundRules))
+			rule := (*parameters.OutboundRules)[0]
+			assert.Equal(t, testClusterName+"-outbound", *rule.Name)
+			// 64000 ports are divided among 3 nodes, including the headroom.
+			assert.Equal(t, int32(21328), *rule.AllocatedOutboundPorts)
+			assert.Equal(t, int32(30), *rule.IdleTimeoutInMinutes)
+			assert.Equal(t, az.getBackendPoolID(lbName, "rg", testClusterName), *rule.BackendAddressPool.ID)
+			return nil
+		})
+
+	mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{
+		{Name: pointer.String(testClusterName + "-outbound-1")},
+	}, nil).AnyTimes()
+	mockPIPClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", testClusterName+"-outbound-0", gomock.Any(), gomock.Any()).Return(nil)
+	mockPIPClient.EXPECT().Delete(gomock.Any(), "rg", testClusterName+"-outbound-1").Return(nil)
+
+	assert.NoError(t, az.reconcileOutbound(testClusterName))
+}
+
+func TestReconcileOutboundLoadBalancerWithoutBackendPool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.OutboundConfig = &OutboundConfig{Type: consts.OutboundTypeLoadBalancer}
+	az.nodeInformerSynced = func() bool { return true }
+
+	mockLBClient := az.LoadBalancerClient.(*mockloadbalancerclient.MockInterface)
+	mockLBClient.EXPECT().Get(gomock.Any(), "rg", testClusterName, "").Return(network.LoadBalancer{}, &retry.Error{HTTPStatusCode: http.StatusNotFound})
+
+	assert.NoError(t, az.reconcileOutbound(testClusterName))
+}
+
+func TestReconcileOutboundNatGateway(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.OutboundConfig = &OutboundConfig{Type: consts.OutboundTypeNatGateway, AllocatedOutboundPorts: 32000}
+	az.nodeInformerSynced = func() bool { return true }
+	az.nodeNames = sets.NewString("node1", "node2", "node3")
+
+	natGatewayName := testClusterName + "-natgw"
+	mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{
+		{Name: pointer.String(testClusterName + "-outbound-0")},
+		{Name: pointer.String(testClusterName + "-outbound-1")},
+	}, nil).AnyTimes()
+
+	mockNatGatewayClient := az.NatGatewaysClient.(*mocknatgatewayclient.MockInterface)
+	mockNatGatewayClient.EXPECT().Get(gomock.Any(), "rg", natGatewayName, "").Return(network.NatGateway{}, &retry.Error{HTTPStatusCode: http.StatusNotFound})
+	mockNatGatewayClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", natGatewayName, gomock.Any(), "").DoAndReturn(
+		func(ctx context.Context, resourceGroupName, natGatewayName string, parameters network.NatGateway, etag string) *retry.Error {
+			// 32000 ports for 4 nodes, including the headroom, need 2 IPs.
+			assert.Equal(t, []network.SubResource{
+				{ID: pointer.String(az.getPublicIPAddressID("rg", testClusterName+"-outbound-0"))},
+				{ID: pointer.String(az.getPublicIPAddressID("rg", testClusterName+"-outbound-1"))},
+			}, *parameters.PublicIPAddresses)
+			assert.Equal(t, int32(consts.DefaultOutboundIdleTimeoutInMinutes), *parameters.IdleTimeoutInMinutes)
+			assert.Equal(t, network.NatGatewaySkuNameStandard, parameters.Sku.Name)
+			return nil
+		})
+
+	mockSubnetClient := az.SubnetsClient.(*mocksubnetclient.MockInterface)
+	mockSubnetClient.EXPECT().Get(gomock.Any(), "rg", "vnet", "subnet", "").Return(network.Subnet{
+		Name:                   pointer.String("subnet"),
+		SubnetPropertiesFormat: &network.SubnetPropertiesFormat{},
+	}, nil)
+	mockSubnetClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "vnet", "subnet", gomock.Any()).DoAndReturn(
+		func(ctx context.Context, resourceGroupName, virtualNetworkName, subnetName string, subnet network.Subnet) *retry.Error {
+			assert.Equal(t, az.getNatGatewayID("rg", natGatewayName), *subnet.NatGateway.ID)
+			return nil
+		})
+
+	assert.NoError(t, az.reconcileOutbound(testClusterName))
+}
+
+func TestReconcileOutboundNatGatewaySubnetFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	recorder := record.NewFakeRecorder(10)
+	az.eventRecorder = recorder
+	az.OutboundConfig = &OutboundConfig{Type: consts.OutboundTypeNatGateway, OutboundIPCount: 1}
+	az.nodeInformerSynced = func() bool { return true }
+	az.nodeNames = sets.NewString("node1")
+
+	natGatewayName := testClusterName + "-natgw"
+	mockPIPClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{
+		{Name: pointer.String(testClusterName + "-outbound-0")},
+	}, nil).AnyTimes()
+	mockNatGatewayClient := az.NatGatewaysClient.(*mocknatgatewayclient.MockInterface)
+	mockNatGatewayClient.EXPECT().Get(gomock.Any(), "rg", natGatewayName, "").Return(network.NatGateway{}, &retry.Error{HTTPStatusCode: http.StatusNotFound})
+	mockNatGatewayClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", natGatewayName, gomock.Any(), "").Return(nil)
+	mockSubnetClient := az.SubnetsClient.(*mocksubnetclient.MockInterface)
+	mockSubnetClient.EXPECT().Get(gomock.Any(), "rg", "vnet", "subnet", "").Return(network.Subnet{
+		Name:                   pointer.String("subnet"),
+		SubnetPropertiesFormat: &network.SubnetPropertiesFormat{},
+	}, nil)
+	mockSubnetClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "vnet", "subnet", gomock.Any()).Return(&retry.Error{HTTPStatusCode: http.StatusInternalServerError})
+
+	// the outbound resources are not reconciled for a service, so no event is reported.
+	assert.Error(t, az.reconcileOutbound(testClusterName))
+	assert.Empty(t, recorder.Events)
+}
@@ -0,0 +1,307 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+)
+
+const (
+	ownedKindFrontendIPConfig  = "frontend"
+	ownedKindProbe             = "probe"
+	ownedKindLoadBalancingRule = "rule"
+	ownedKindSecurityRule      = "securityrule"
+	ownedKindTag               = "tag"
+
+	ownedResourceTypeLoadBalancer  = "load_balancer"
+	ownedResourceTypeSecurityGroup = "security_group"
+
+	// ownershipManifestEntryLength is the length of the hash of one owned subresource in the manifest.
+	ownershipManifestEntryLength = 8
+	// ownershipManifestTagValueMaxLength is the maximum length of a tag value in Azure.
+	ownershipManifestTagValueMaxLength = 256
+	// resourceTagsMaxCount is the maximum number of tags of a resource in Azure.
+	resourceTagsMaxCount = 50
+)
+
+// ownedSubresourceNameRE matches the names of the rules, probes and frontend IP configurations generated by the
+// cloud provider, which start with the default load balancer name of the service, "a" and the service UID.
+var ownedSubresourceNameRE = regexp.MustCompile(`(?i)^a[0-9a-f]{31}`)
+
+// ownershipManifest is the set of the subresources created by the cloud provider in a load balancer or a security
+// group. The subresources are recorded by the hashes of their kinds and names to fit in the tags.
+// A nil manifest owns everything, which is the behavior when EnableOwnershipManifest is not set.
+type ownershipManifest struct {
+	resourceType string
+	entries      sets.String
+	dirty        bool
+}
+
+func getOwnershipManifestEntry(kind, name string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(fmt.Sprintf("%s/%s", kind, name))))
+	return hex.EncodeToString(sum[:])[:ownershipManifestEntryLength]
+}
+
+func isOwnershipManifestTag(key string) bool {
+	return strings.HasPrefix(strings.ToLower(key), consts.OwnershipManifestTagKeyPrefix)
+}
+
+// parseOwnershipManifest reads the manifest from the tags. It returns false if the resource has no manifest.
+func parseOwnershipManifest(resourceType string, tags map[string]*string) (*ownershipManifest, bool) {
+	manifest := &ownershipManifest{resourceType: resourceType, entries: sets.NewString()}
+	var found bool
+	for key, value := range tags {
+		if !isOwnershipManifestTag(key) {
+			continue
+		}
+		found = true
+		for _, entry := range strings.Split(pointer.StringDeref(value, ""), consts.TagsDelimiter) {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				manifest.entries.Insert(entry)
+			}
+		}
+	}
+	return manifest, found
+}
+
+// owns returns true if the subresource is recorded in the manifest.
+func (m *ownershipManifest) owns(kind, name string) bool {
+	if m == nil {
+		return true
+	}
+	return m.entries.Has(getOwnershipManifestEntry(kind, name))
+}
+
+// ownsOrSkip returns true if the subresource is recorded in the manifest. Otherwise, the subresource is
+// counted as a foreign one skipped by the reconciliation.
+func (m *ownershipManifest) ownsOrSkip(kind, name string) bool {
+	if m.owns(kind, name) {
+		return true
+	}
+	klog.V(2).Infof("ownershipManifest: skipping the %s %s not created by the cloud provider", kind, name)
+	metrics.CountForeignResourceSkipped(m.resourceType, kind)
+	return false
+}
+
+func (m *ownershipManifest) add(kind, name string) {
+	if m == nil {
+		return
+	}
+	if entry := getOwnershipManifestEntry(kind, name); !m.entries.Has(entry) {
+		m.entries.Insert(entry)
+		m.dirty = true
+	}
+}
+
+func (m *ownershipManifest) remove(kind, name string) {
+	if m == nil {
+		return
+	}
+	if entry := getOwnershipManifestEntry(kind, name); m.entries.Has(entry) {
+		m.entries.Delete(entry)
+		m.dirty = true
+	}
+}
+
+// save writes the manifest into the tags if it is changed. It returns true if the tags are changed.
+// If the manifest doesn't fit in the tags left by the other tags of the resource, the manifest tags are removed,
+// so the ownership falls back to the naming convention, and the manifest is adopted again on the next reconcile.
+func (m *ownershipManifest) save(tags *map[string]*string) bool {
+	if m == nil || !m.dirty {
+		return false
+	}
+	if *tags == nil {
+		*tags = make(map[string]*string)
+	}
+	var removed bool
+	for key := range *tags {
+		if isOwnershipManifestTag(key) {
+			delete(*tags, key)
+			removed = true
+		}
+	}
+	m.dirty = false
+
+	// An empty manifest is still written, so that the subresources are not adopted again.
+	entriesPerTag := (ownershipManifestTagValueMaxLength + 1) / (ownershipManifestEntryLength + 1)
+	entries := m.entries.List()
+	tagCount := (len(entries) + entriesPerTag - 1) / entriesPerTag
+	if tagCount == 0 {
+		tagCount = 1
+	}
+	if availableTagCount := resourceTagsMaxCount - len(*tags); tagCount > availableTagCount {
+		klog.Warningf("ownershipManifest: %d tags are needed to record %d owned subresources of the %s, but only %d are available, falling back to the naming convention",
+			tagCount, len(entries), m.resourceType, availableTagCount)
+		metrics.CountOwnershipManifestOverflow(m.resourceType)
+		return removed
+	}
+	for i := 0; i < tagCount; i++ {
+		end := (i + 1) * entriesPerTag
+		if end > len(entries) {
+			end = len(entries)
+		}
+		(*tags)[fmt.Sprintf("%s%d", consts.OwnershipManifestTagKeyPrefix, i)] = pointer.String(strings.Join(entries[i*entriesPerTag:end], consts.TagsDelimiter))
+	}
+	return true
+}
+
+// getLoadBalancerOwnershipManifest returns the ownership manifest of the load balancer, or nil if the manifest is
+// disabled. If the load balancer has no manifest, the subresources following the naming convention are adopted.
+func (az *Cloud) getLoadBalancerOwnershipManifest(lb *network.LoadBalancer) *ownershipManifest {
+	if !az.EnableOwnershipManifest || lb == nil {
+		return nil
+	}
+	manifest, found := parseOwnershipManifest(ownedResourceTypeLoadBalancer, lb.Tags)
+	if found {
+		return manifest
+	}
+
+	klog.V(2).Infof("getLoadBalancerOwnershipManifest: creating the ownership manifest of lb(%s)", pointer.StringDeref(lb.Name, ""))
+	manifest.dirty = true
+	if lb.LoadBalancerPropertiesFormat == nil {
+		return manifest
+	}
+	if lb.FrontendIPConfigurations != nil {
+		for _, fip := range *lb.FrontendIPConfigurations {
+			manifest.adopt(ownedKindFrontendIPConfig, pointer.StringDeref(fip.Name, ""))
+		}
+	}
+	if lb.Probes != nil {
+		for _, probe := range *lb.Probes {
+			manifest.adopt(ownedKindProbe, pointer.StringDeref(probe.Name, ""))
+		}
+	}
+	if lb.LoadBalancingRules != nil {
+		for _, rule := range *lb.LoadBalancingRules {
+			manifest.adopt(ownedKindLoadBalancingRule, pointer.StringDeref(rule.Name, ""))
+		}
+	}
+	return manifest
+}
+
+// getSecurityGroupOwnershipManifest returns the ownership manifest of the security group, or nil if the manifest
+// is disabled. If the security group has no manifest, the rules following the naming convention are adopted.
+func (az *Cloud) getSecurityGroupOwnershipManifest(sg *network.SecurityGroup) *ownershipManifest {
+	if !az.EnableOwnershipManifest || sg == nil {
+		return nil
+	}
+	manifest, found := parseOwnershipManifest(ownedResourceTypeSecurityGroup, sg.Tags)
+	if found {
+		return manifest
+	}
+
+	klog.V(2).Infof("getSecurityGroupOwnershipManifest: creating the ownership manifest of sg(%s)", pointer.StringDeref(sg.Name, ""))
+	manifest.dirty = true
+	if sg.SecurityGroupPropertiesFormat != nil && sg.SecurityRules != nil {
+		for _, rule := range *sg.SecurityRules {
+			manifest.adopt(ownedKindSecurityRule, pointer.StringDeref(rule.Name, ""))
+		}
+	}
+	return manifest
+}
+
+// adopt records the subresource if its name follows the naming convention of the cloud provider.
+func (m *ownershipManifest) adopt(kind, name string) {
+	if ownedSubresourceNameRE.MatchString(name) {
+		m.add(kind, name)
+	}
+}
+
+// reconcileOwnedTags sets the configured tags on the resource like reconcileTags, but the existing tags with
+// different values are only updated if they were set by the cloud provider, and only the tags set by the cloud
+// provider are deleted when systemTags is set.
+func (az *Cloud) reconcileOwnedTags(currentTagsOnResource, newTags map[string]*string, manifest *ownershipManifest) (map[string]*string, bool) {
+	var changed bool
+	for k, v := range newTags {
+		found, key := findKeyInMapCaseInsensitive(currentTagsOnResource, k)
+		switch {
+		case !found:
+			currentTagsOnResource[k] = v
+			changed = true
+		case strings.EqualFold(pointer.StringDeref(v, ""), pointer.StringDeref(currentTagsOnResource[key], "")):
+			// The tag with the same value is adopted.
+		case manifest.ownsOrSkip(ownedKindTag, key):
+			currentTagsOnResource[key] = v
+			changed = true
+		default:
+			continue
+		}
+		manifest.add(ownedKindTag, k)
+	}
+
+	if az.SystemTags == "" {
+		return currentTagsOnResource, changed
+	}
+	systemTagsMap := make(map[string]*string)
+	for _, systemTag := range strings.Split(az.SystemTags, consts.TagsDelimiter) {
+		systemTagsMap[strings.TrimSpace(systemTag)] = pointer.String("")
+	}
+	for k := range currentTagsOnResource {
+		if found, _ := findKeyInMapCaseInsensitive(newTags, k); found || isOwnershipManifestTag(k) {
+			continue
+		}
+		if found, _ := findKeyInMapCaseInsensitive(systemTagsMap, k); found {
+			continue
+		}
+		if manifest.ownsOrSkip(ownedKindTag, k) {
+			delete(currentTagsOnResource, k)
+			manifest.remove(ownedKindTag, k)
+			changed = true
+		}
+	}
+	return currentTagsOnResource, changed
+}
+
+// reportOwnershipConflict reports the subresource of the service which can not be created since a foreign
+// subresource with the same name exists.
+func (az *Cloud) reportOwnershipConflict(service *v1.Service, kind, name string) {
+	msg := fmt.Sprintf("the %s %s is not created by the cloud provider, it is kept as it is", kind, name)
+	klog.Warningf("reportOwnershipConflict for service(%s): %s", getServiceName(service), msg)
+	az.Event(service, v1.EventTypeWarning, "ForeignResourceConflict", msg)
+}
+
+func findProbeByName(probes []network.Probe, name string) bool {
+	for _, probe := range probes {
+		if strings.EqualFold(pointer.StringDeref(probe.Name, ""), name) {
+			return true
+		}
+	}
+	return false
+}
+
+func findLBRuleByName(rules []network.LoadBalancingRule, name string) bool {
+	for _, rule := range rules {
+		if strings.EqualFold(pointer.StringDeref(rule.Name, ""), name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func TestOwnershipManifestSaveAndParse(t *testing.T) {
+	manifest, found := parseOwnershipManifest(ownedResourceTypeLoadBalancer, nil)
+	assert.False(t, found)
+	for i := 0; i < 40; i++ {
+		manifest.add(ownedKindLoadBalancingRule, fmt.Sprintf("rule%d", i))
+	}
+
+	tags := map[string]*string{"foo": pointer.String("bar")}
+	assert.True(t, manifest.save(&tags))
+	assert.False(t, manifest.save(&tags))
+	assert.Len(t, tags, 3)
+	for key, value := range tags {
+		assert.LessOrEqual(t, len(pointer.StringDeref(value, "")), ownershipManifestTagValueMaxLength, key)
+	}
+
+	parsed, found := parseOwnershipManifest(ownedResourceTypeLoadBalancer, tags)
+	assert.True(t, found)
+	assert.True(t, parsed.owns(ownedKindLoadBalancingRule, "RULE39"))
+	assert.False(t, parsed.owns(ownedKindProbe, "rule39"))
+
+	parsed.remove(ownedKindLoadBalancingRule, "rule39")
+	assert.True(t, parsed.save(&tags))
+	parsed, _ = parseOwnershipManifest(ownedResourceTypeLoadBalancer, tags)
+	assert.False(t, parsed.owns(ownedKindLoadBalancingRule, "rule39"))
+
+	var nilManifest *ownershipManifest
+	assert.True(t, nilManifest.owns(ownedKindProbe, "foreign"))
+	assert.False(t, nilManifest.save(&tags))
+}
+
+func TestOwnershipManifestSaveOverflow(t *testing.T) {
+	manifest, _ := parseOwnershipManifest(ownedResourceTypeLoadBalancer, nil)
+	for i := 0; i < 1500; i++ {
+		manifest.add(ownedKindLoadBalancingRule, fmt.Sprintf("rule%d", i))
+	}
+
+	// 1500 entries need 54 tags, which is more than the 50 tags allowed on a resource.
+	tags := map[string]*string{"foo": pointer.String("bar")}
+	assert.False(t, manifest.save(&tags))
+	assert.Len(t, tags, 1)
+	_, found := parseOwnershipManifest(ownedResourceTypeLoadBalancer, tags)
+	assert.False(t, found)
+
+	// The existing manifest is removed, so the ownership falls back to the naming convention.
+	tags[consts.OwnershipManifestTagKeyPrefix+"0"] = pointer.String("")
+	manifest.dirty = true
+	assert.True(t, manifest.save(&tags))
+	assert.Len(t, tags, 1)
+
+	// The other tags of the resource are counted.
+	manifest, _ = parseOwnershipManifest(ownedResourceTypeLoadBalancer, nil)
+	for i := 0; i < 28*40; i++ {
+		manifest.add(ownedKindLoadBalancingRule, fmt.Sprintf("rule%d", i))
+	}
+	tags = map[string]*string{}
+	for i := 0; i < 10; i++ {
+		tags[fmt.Sprintf("tag%d", i)] = pointer.String("value")
+	}
+	assert.True(t, manifest.save(&tags))
+	assert.Len(t, tags, 50)
+	manifest.add(ownedKindProbe, "probe")
+	assert.True(t, manifest.save(&tags))
+	assert.Len(t, tags, 10)
+}
+
+func TestGetLoadBalancerOwnershipManifest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+
+	ownedName := "a0123456789abcdef0123456789abcde-TCP-80"
+	lb := &network.LoadBalancer{
+		Name: pointer.String("lb"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			LoadBalancingRules: &[]network.LoadBalancingRule{
+				{Name: pointer.String(ownedName)},
+				{Name: pointer.String("custom-rule")},
+			},
+		},
+	}
+	assert.Nil(t, az.getLoadBalancerOwnershipManifest(lb))
+
+	az.EnableOwnershipManifest = true
+	manifest := az.getLoadBalancerOwnershipManifest(lb)
+	assert.True(t, manifest.owns(ownedKindLoadBalancingRule, ownedName))
+	assert.False(t, manifest.owns(ownedKindLoadBalancingRule, "custom-rule"))
+	assert.True(t, manifest.save(&lb.Tags))
+
+	// The rules are not adopted again after the manifest is created.
+	(*lb.LoadBalancingRules)[1].Name = pointer.String("a0123456789abcdef0123456789abcdf-TCP-80")
+	manifest = az.getLoadBalancerOwnershipManifest(lb)
+	assert.False(t, manifest.owns(ownedKindLoadBalancingRule, "a0123456789abcdef0123456789abcdf-TCP-80"))
+}
+
+func TestReconcileLBRulesWithOwnershipManifest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	az.EnableOwnershipManifest = true
+	recorder := record.NewFakeRecorder(10)
+	az.eventRecorder = recorder
+
+	service := getTestService("svc1", v1.ProtocolTCP, nil, false, 80)
+	rulePrefix := az.getRulePrefix(&service)
+	ownedRule := network.LoadBalancingRule{Name: pointer.String(rulePrefix + "-TCP-81")}
+	foreignRule := network.LoadBalancingRule{Name: pointer.String(rulePrefix + "-custom")}
+	conflictingRule := network.LoadBalancingRule{Name: pointer.String(rulePrefix + "-TCP-80")}
+	lb := &network.LoadBalancer{
+		Name: pointer.String("lb"),
+		LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+			LoadBalancingRules: &[]network.LoadBalancingRule{ownedRule, foreignRule, conflictingRule},
+		},
+	}
+	manifest, _ := parseOwnershipManifest(ownedResourceTypeLoadBalancer, nil)
+	manifest.add(ownedKindLoadBalancingRule, *ownedRule.Name)
+
+	expectedRule := network.LoadBalancingRule{
+		Name: pointer.String(rulePrefix + "-TCP-80"),
+		LoadBalancingRulePropertiesFormat: &network.LoadBalancingRulePropertiesFormat{
+			FrontendPort: pointer.Int32(80),
+		},
+	}
+	assert.True(t, az.reconcileLBRules(lb, &service, "default/svc1", true, []network.LoadBalancingRule{expectedRule}, manifest))
+	assert.Equal(t, []network.LoadBalancingRule{foreignRule, conflictingRule}, *lb.LoadBalancingRules)
+	assert.False(t, manifest.owns(ownedKindLoadBalancingRule, *ownedRule.Name))
+	assert.Contains(t, <-recorder.Events, "ForeignResourceConflict")
+}
+
+func TestReconcileOwnedTags(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	az.SystemTags = "system"
+
+	manifest, _ := parseOwnershipManifest(ownedResourceTypeLoadBalancer, nil)
+	manifest.add(ownedKindTag, "owned")
+	manifest.add(ownedKindTag, "stale")
+	currentTags := map[string]*string{
+		"owned":  pointer.String("old"),
+		"manual": pointer.String("user"),
+		"stale":  pointer.String("value"),
+		"system": pointer.String("value"),
+		"extra":  pointer.String("value"),
+	}
+	newTags := map[string]*string{
+		"owned":  pointer.String("new"),
+		"manual": pointer.String("ccm"),
+		"added":  pointer.String("value"),
+	}
+
+	tags, changed := az.reconcileOwnedTags(currentTags, newTags, manifest)
+	assert.True(t, changed)
+	assert.Equal(t, map[string]*string{
+		"owned":  pointer.String("new"),
+		"manual": pointer.String("user"),
+		"added":  pointer.String("value"),
+		"system": pointer.String("value"),
+		"extra":  pointer.String("value"),
+	}, tags)
+	assert.True(t, manifest.owns(ownedKindTag, "added"))
+	assert.False(t, manifest.owns(ownedKindTag, "manual"))
+	assert.False(t, manifest.owns(ownedKindTag, "stale"))
+}
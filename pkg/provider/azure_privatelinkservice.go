@@ -19,11 +19,16 @@ package provider
 import (
 	"fmt"
 	"net"
+	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
 
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 	"k8s.io/utils/pointer"
 
@@ -83,6 +88,18 @@ func (az *Cloud) reconcilePrivateLinkService(
 			}
 			// If there is an existing private link service, only owner service can update its properties
 			ownerService := getPrivateLinkServiceOwner(&existingPLS)
+			if !strings.EqualFold(ownerService, serviceName) && serviceCreatesPLS(service) && !az.isPrivateLinkServiceOwnerActive(ownerService) {
+				// The owner tag is dropped from a copy of the tags, so that reconcilePLSTags tags the service as the new owner.
+				klog.V(2).Infof("reconcilePrivateLinkService for service(%s): taking over private link service(%s) from inactive owner service(%s)", serviceName, pointer.StringDeref(existingPLS.Name, ""), ownerService)
+				tags := make(map[string]*string, len(existingPLS.Tags))
+				for k, v := range existingPLS.Tags {
+					if !strings.EqualFold(k, consts.OwnerServiceTagKey) {
+						tags[k] = v
+					}
+				}
+				existingPLS.Tags = tags
+				ownerService = serviceName
+			}
 			if !strings.EqualFold(ownerService, serviceName) {
 				if serviceHasAdditionalConfigs(service) {
 					return fmt.Errorf(
@@ -99,8 +116,12 @@ func (az *Cloud) reconcilePrivateLinkService(
 					pointer.StringDeref(existingPLS.Name, ""),
 					ownerService,
 				)
-				return nil
+				return az.validateSharedPrivateLinkServicePorts(service, fipConfig)
 			}
+		} else if !serviceCreatesPLS(service) {
+			klog.V(2).Infof("reconcilePrivateLinkService for service(%s): no private link service to share on LB frontend(%s) yet", serviceName, pointer.StringDeref(fipConfig.Name, ""))
+			isOperationSucceeded = true
+			return nil
 		} else {
 			existingPLS.ID = nil
 			existingPLS.Location = &az.Location
@@ -161,28 +182,25 @@ func (az *Cloud) reconcilePrivateLinkService(
 
 func (az *Cloud) disablePLSNetworkPolicy(service *v1.Service) error {
 	serviceName := getServiceName(service)
-	subnetName := getPLSSubnetName(service)
-	if subnetName == nil {
-		subnetName = &az.SubnetName
-	}
-
-	subnet, existsSubnet, err := az.getSubnet(az.VnetName, *subnetName)
-	if err != nil {
-		return err
-	}
-	if !existsSubnet {
-		return fmt.Errorf("disablePLSNetworkPolicy: failed to get private link service subnet(%s) for service(%s)", *subnetName, serviceName)
-	}
+	for _, subnetName := range az.getPLSSpreadSubnetNames(service) {
+		subnet, existsSubnet, err := az.getSubnet(az.VnetName, subnetName)
+		if err != nil {
+			return err
+		}
+		if !existsSubnet {
+			return fmt.Errorf("disablePLSNetworkPolicy: failed to get private link service subnet(%s) for service(%s)", subnetName, serviceName)
+		}
 
-	// Policy already disabled
-	if subnet.PrivateLinkServiceNetworkPolicies == network.VirtualNetworkPrivateLinkServiceNetworkPoliciesDisabled {
-		return nil
-	}
+		// Policy already disabled
+		if subnet.PrivateLinkServiceNetworkPolicies == network.VirtualNetworkPrivateLinkServiceNetworkPoliciesDisabled {
+			continue
+		}
 
-	subnet.PrivateLinkServiceNetworkPolicies = network.VirtualNetworkPrivateLinkServiceNetworkPoliciesDisabled
-	err = az.CreateOrUpdateSubnet(service, subnet)
-	if err != nil {
-		return err
+		subnet.PrivateLinkServiceNetworkPolicies = network.VirtualNetworkPrivateLinkServiceNetworkPoliciesDisabled
+		err = az.CreateOrUpdateSubnet(service, subnet)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -315,22 +333,29 @@ func (az *Cloud) reconcilePLSIpConfigs(
 	changed := false
 	serviceName := getServiceName(service)
 
-	subnetName := getPLSSubnetName(service)
-	if subnetName == nil {
-		subnetName = &az.SubnetName
-	}
-	subnet, existsSubnet, err := az.getSubnet(az.VnetName, *subnetName)
-	if err != nil {
-		return false, err
-	}
-	if !existsSubnet {
-		return false, fmt.Errorf("checkAndUpdatePLSIPConfigs: failed to get private link service subnet(%s) for service(%s)", *subnetName, serviceName)
+	subnetNames := az.getPLSSpreadSubnetNames(service)
+	subnets := make([]network.Subnet, 0, len(subnetNames))
+	for _, subnetName := range subnetNames {
+		subnet, existsSubnet, err := az.getSubnet(az.VnetName, subnetName)
+		if err != nil {
+			return false, err
+		}
+		if !existsSubnet {
+			return false, fmt.Errorf("checkAndUpdatePLSIPConfigs: failed to get private link service subnet(%s) for service(%s)", subnetName, serviceName)
+		}
+		subnets = append(subnets, subnet)
 	}
 
 	ipConfigCount, err := getPLSIPConfigCount(service)
 	if err != nil {
 		return false, err
 	}
+	if _, found := service.Annotations[consts.ServiceAnnotationPLSIpConfigurationIPAddressCount]; !found && int32(len(subnets)) > ipConfigCount {
+		ipConfigCount = int32(len(subnets))
+	}
+	if int(ipConfigCount) < len(subnets) {
+		return false, fmt.Errorf("checkAndUpdatePLSIPConfigs: ipConfigCount(%d) must be no smaller than number of subnets specified(%d)", ipConfigCount, len(subnets))
+	}
 
 	staticIps, primaryIP, err := getPLSStaticIPs(service)
 	if err != nil {
@@ -341,6 +366,12 @@ func (az *Cloud) reconcilePLSIpConfigs(
 		return false, fmt.Errorf("checkAndUpdatePLSIPConfigs: ipConfigCount(%d) must be no smaller than number of static IPs specified(%d)", ipConfigCount, len(staticIps))
 	}
 
+	staticIPsBySubnet, err := getPLSStaticIPsBySubnet(subnets, staticIps)
+	if err != nil {
+		return false, err
+	}
+	dynamicCounts := getPLSDynamicIPConfigCounts(subnets, staticIPsBySubnet, int(ipConfigCount)-len(staticIps))
+
 	if existingPLS.IPConfigurations == nil {
 		existingPLS.IPConfigurations = &[]network.PrivateLinkServiceIPConfiguration{}
 		changed = true
@@ -350,11 +381,18 @@ func (az *Cloud) reconcilePLSIpConfigs(
 		changed = true
 	}
 
+	expectedCounts := make(map[string]int)
+	for i, subnet := range subnets {
+		expectedCounts[strings.ToLower(pointer.StringDeref(subnet.ID, ""))] += len(staticIPsBySubnet[i]) + dynamicCounts[i]
+	}
+	existingCounts := make(map[string]int)
 	existingStaticIps := make([]string, 0)
 	for _, ipConfig := range *existingPLS.IPConfigurations {
-		if !strings.EqualFold(pointer.StringDeref(subnet.ID, ""), pointer.StringDeref(ipConfig.Subnet.ID, "")) {
-			changed = true
+		subnetID := ""
+		if ipConfig.Subnet != nil {
+			subnetID = pointer.StringDeref(ipConfig.Subnet.ID, "")
 		}
+		existingCounts[strings.ToLower(subnetID)]++
 		if strings.EqualFold(string(ipConfig.PrivateIPAllocationMethod), string(network.Static)) {
 			klog.V(10).Infof("Found static IP: %s", pointer.StringDeref(ipConfig.PrivateIPAddress, ""))
 			if _, found := staticIps[pointer.StringDeref(ipConfig.PrivateIPAddress, "")]; !found {
@@ -378,50 +416,182 @@ func (az *Cloud) reconcilePLSIpConfigs(
 	if len(existingStaticIps) != len(staticIps) {
 		changed = true
 	}
+	// The IP configurations are expected to be spread across the subnets as computed above.
+	if !reflect.DeepEqual(existingCounts, expectedCounts) {
+		changed = true
+	}
 
 	if changed {
 		ipConfigs := []network.PrivateLinkServiceIPConfiguration{}
-		for k := range staticIps {
-			ip := k
-			isPrimary := strings.EqualFold(ip, primaryIP)
-			configName := fmt.Sprintf("%s-%s-static-%s", pointer.StringDeref(subnet.Name, ""), pointer.StringDeref(existingPLS.Name, ""), ip)
-			ipConfigs = append(ipConfigs, network.PrivateLinkServiceIPConfiguration{
-				Name: &configName,
-				PrivateLinkServiceIPConfigurationProperties: &network.PrivateLinkServiceIPConfigurationProperties{
-					PrivateIPAddress:          &ip,
-					PrivateIPAllocationMethod: network.Static,
-					Subnet: &network.Subnet{
-						ID: subnet.ID,
+		for i := range subnets {
+			subnet := subnets[i]
+			for _, k := range staticIPsBySubnet[i] {
+				ip := k
+				isPrimary := strings.EqualFold(ip, primaryIP)
+				configName := fmt.Sprintf("%s-%s-static-%s", pointer.StringDeref(subnet.Name, ""), pointer.StringDeref(existingPLS.Name, ""), ip)
+				ipConfigs = append(ipConfigs, network.PrivateLinkServiceIPConfiguration{
+					Name: &configName,
+					PrivateLinkServiceIPConfigurationProperties: &network.PrivateLinkServiceIPConfigurationProperties{
+						PrivateIPAddress:          &ip,
+						PrivateIPAllocationMethod: network.Static,
+						Subnet: &network.Subnet{
+							ID: subnet.ID,
+						},
+						Primary:                 &isPrimary,
+						PrivateIPAddressVersion: network.IPv4,
 					},
-					Primary:                 &isPrimary,
-					PrivateIPAddressVersion: network.IPv4,
-				},
-			})
-		}
-		for i := 0; i < int(ipConfigCount)-len(staticIps); i++ {
-			isPrimary := primaryIP == "" && i == 0
-			configName := fmt.Sprintf("%s-%s-dynamic-%d", pointer.StringDeref(subnet.Name, ""), pointer.StringDeref(existingPLS.Name, ""), i)
-			ipConfigs = append(ipConfigs, network.PrivateLinkServiceIPConfiguration{
-				Name: &configName,
-				PrivateLinkServiceIPConfigurationProperties: &network.PrivateLinkServiceIPConfigurationProperties{
-					PrivateIPAllocationMethod: network.Dynamic,
-					Subnet: &network.Subnet{
-						ID: subnet.ID,
+				})
+			}
+		}
+		for i := range subnets {
+			subnet := subnets[i]
+			for j := 0; j < dynamicCounts[i]; j++ {
+				isPrimary := primaryIP == "" && i == 0 && j == 0
+				configName := fmt.Sprintf("%s-%s-dynamic-%d", pointer.StringDeref(subnet.Name, ""), pointer.StringDeref(existingPLS.Name, ""), j)
+				ipConfigs = append(ipConfigs, network.PrivateLinkServiceIPConfiguration{
+					Name: &configName,
+					PrivateLinkServiceIPConfigurationProperties: &network.PrivateLinkServiceIPConfigurationProperties{
+						PrivateIPAllocationMethod: network.Dynamic,
+						Subnet: &network.Subnet{
+							ID: subnet.ID,
+						},
+						Primary:                 &isPrimary,
+						PrivateIPAddressVersion: network.IPv4,
 					},
-					Primary:                 &isPrimary,
-					PrivateIPAddressVersion: network.IPv4,
-				},
-			})
+				})
+			}
 		}
 		existingPLS.IPConfigurations = &ipConfigs
 	}
 	return changed, nil
 }
 
+// getPLSStaticIPsBySubnet returns the static IPs in each subnet. With a single subnet, all the static IPs are
+// placed in it and Azure validates the IPs, otherwise each IP is placed in the subnet whose prefixes contain it.
+func getPLSStaticIPsBySubnet(subnets []network.Subnet, staticIps map[string]bool) ([][]string, error) {
+	result := make([][]string, len(subnets))
+	for ip := range staticIps {
+		found := len(subnets) == 1
+		if found {
+			result[0] = append(result[0], ip)
+		}
+		for i := 0; !found && i < len(subnets); i++ {
+			if subnetContainsIP(subnets[i], ip) {
+				result[i] = append(result[i], ip)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("getPLSStaticIPsBySubnet: static IP %s is not in any of the private link service subnets", ip)
+		}
+	}
+	for i := range result {
+		sort.Strings(result[i])
+	}
+	return result, nil
+}
+
+func subnetContainsIP(subnet network.Subnet, ip string) bool {
+	if subnet.SubnetPropertiesFormat == nil {
+		return false
+	}
+	parsedIP := net.ParseIP(ip)
+	prefixes := stringSlice(subnet.AddressPrefixes)
+	if subnet.AddressPrefix != nil {
+		prefixes = append(prefixes, *subnet.AddressPrefix)
+	}
+	for _, prefix := range prefixes {
+		if _, cidr, err := net.ParseCIDR(prefix); err == nil && cidr.Contains(parsedIP) {
+			return true
+		}
+	}
+	return false
+}
+
+// getPLSDynamicIPConfigCounts spreads the dynamic IP configurations across the subnets, so that each subnet gets
+// as many IP configurations as possible in total. Ties are broken by the order of the subnets.
+func getPLSDynamicIPConfigCounts(subnets []network.Subnet, staticIPsBySubnet [][]string, dynamicCount int) []int {
+	counts := make([]int, len(subnets))
+	for n := 0; n < dynamicCount; n++ {
+		target := 0
+		for i := range subnets {
+			if len(staticIPsBySubnet[i])+counts[i] < len(staticIPsBySubnet[target])+counts[target] {
+				target = i
+			}
+		}
+		counts[target]++
+	}
+	return counts
+}
+
+// serviceRequiresPLS returns true if the service creates or shares a private link service.
 func serviceRequiresPLS(service *v1.Service) bool {
+	return serviceCreatesPLS(service) || getBoolValueFromServiceAnnotations(service, consts.ServiceAnnotationPLSShared)
+}
+
+func serviceCreatesPLS(service *v1.Service) bool {
 	return getBoolValueFromServiceAnnotations(service, consts.ServiceAnnotationPLSCreation)
 }
 
+// isPrivateLinkServiceOwnerActive returns false if the owner service of a private link service is deleted or does
+// not create a private link service anymore. The owner is taken as active if it cannot be checked.
+func (az *Cloud) isPrivateLinkServiceOwnerActive(owner string) bool {
+	if az.serviceLister == nil {
+		return true
+	}
+	namespace, name, err := cache.SplitMetaNamespaceKey(owner)
+	if err != nil || name == "" {
+		return false
+	}
+	service, err := az.serviceLister.Services(namespace).Get(name)
+	if err != nil {
+		return !apierrors.IsNotFound(err)
+	}
+	return service.DeletionTimestamp == nil && service.Spec.Type == v1.ServiceTypeLoadBalancer && serviceCreatesPLS(service)
+}
+
+// validateSharedPrivateLinkServicePorts makes sure the ports of the service are not used by the other services sharing
+// the private link service, since the private endpoints of a private link service reach all the services by port.
+func (az *Cloud) validateSharedPrivateLinkServicePorts(service *v1.Service, fipConfig *network.FrontendIPConfiguration) error {
+	if az.serviceLister == nil || fipConfig.FrontendIPConfigurationPropertiesFormat == nil {
+		return nil
+	}
+	frontendIP := pointer.StringDeref(fipConfig.PrivateIPAddress, "")
+	if frontendIP == "" {
+		return nil
+	}
+
+	ports := make(map[string]bool)
+	for _, port := range service.Spec.Ports {
+		ports[fmt.Sprintf("%s/%d", port.Protocol, port.Port)] = true
+	}
+
+	services, err := az.serviceLister.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("validateSharedPrivateLinkServicePorts: failed to list services: %w", err)
+	}
+	for _, svc := range services {
+		if svc.UID == service.UID || svc.DeletionTimestamp != nil || !serviceRequiresPLS(svc) || !serviceUsesIngressIP(svc, frontendIP) {
+			continue
+		}
+		for _, port := range svc.Spec.Ports {
+			if key := fmt.Sprintf("%s/%d", port.Protocol, port.Port); ports[key] {
+				return fmt.Errorf("validateSharedPrivateLinkServicePorts: port %s of service(%s) is also used by service(%s) sharing the private link service", key, getServiceName(service), getServiceName(svc))
+			}
+		}
+	}
+	return nil
+}
+
+func serviceUsesIngressIP(service *v1.Service, ip string) bool {
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		if ingress.IP == ip {
+			return true
+		}
+	}
+	return false
+}
+
 func reconcilePLSEnableProxyProtocol(
 	existingPLS *network.PrivateLinkService,
 	service *v1.Service,
@@ -526,6 +696,19 @@ func (az *Cloud) reconcilePLSTags(
 	return changed
 }
 
+// getPLSSpreadSubnetNames returns the subnets the private link service IP configurations are spread across, in order.
+// Subnets are regional, so the spread only splits the NAT IPs between the address ranges of the subnets and
+// doesn't tie them to availability zones.
+func (az *Cloud) getPLSSpreadSubnetNames(service *v1.Service) []string {
+	if subnetNames := strings.Fields(service.Annotations[consts.ServiceAnnotationPLSIpConfigurationSubnets]); len(subnetNames) > 0 {
+		return subnetNames
+	}
+	if subnetName := getPLSSubnetName(service); subnetName != nil {
+		return []string{*subnetName}
+	}
+	return []string{az.SubnetName}
+}
+
 func getPLSSubnetName(service *v1.Service) *string {
 	if l, found := service.Annotations[consts.ServiceAnnotationPLSIpConfigurationSubnet]; found && strings.TrimSpace(l) != "" {
 		return &l
@@ -667,6 +850,7 @@ func serviceHasAdditionalConfigs(service *v1.Service) bool {
 	tagKeyList := []string{
 		consts.ServiceAnnotationPLSName,
 		consts.ServiceAnnotationPLSIpConfigurationSubnet,
+		consts.ServiceAnnotationPLSIpConfigurationSubnets,
 		consts.ServiceAnnotationPLSIpConfigurationIPAddressCount,
 		consts.ServiceAnnotationPLSIpConfigurationIPAddress,
 		consts.ServiceAnnotationPLSFqdns,
@@ -0,0 +1,263 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/Azure/go-autorest/autorest/azure"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+)
+
+var subscriptionIDRE = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// privateEndpointMatcher matches the private endpoints by their subscription IDs or resource IDs.
+type privateEndpointMatcher struct {
+	subscriptionIDs map[string]bool
+	patterns        []*regexp.Regexp
+}
+
+// newPrivateEndpointMatcher parses a space separated list of subscription IDs and resource ID regular expressions.
+// The regular expressions are case-insensitive and must match the whole private endpoint resource ID.
+func newPrivateEndpointMatcher(value string) (*privateEndpointMatcher, error) {
+	m := &privateEndpointMatcher{subscriptionIDs: make(map[string]bool)}
+	for _, entry := range strings.Fields(value) {
+		if subscriptionIDRE.MatchString(entry) {
+			m.subscriptionIDs[strings.ToLower(entry)] = true
+			continue
+		}
+		re, err := regexp.Compile("(?i)^(?:" + entry + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid private endpoint pattern %q: %w", entry, err)
+		}
+		m.patterns = append(m.patterns, re)
+	}
+	return m, nil
+}
+
+func (m *privateEndpointMatcher) match(privateEndpointID string) bool {
+	if privateEndpointID == "" {
+		return false
+	}
+	if resource, err := azure.ParseResourceID(privateEndpointID); err == nil && m.subscriptionIDs[strings.ToLower(resource.SubscriptionID)] {
+		return true
+	}
+	for _, re := range m.patterns {
+		if re.MatchString(privateEndpointID) {
+			return true
+		}
+	}
+	return false
+}
+
+// RunPrivateEndpointConnectionController periodically approves or rejects the pending private endpoint connections
+// of the private link services managed by the cluster until the context is done.
+func (az *Cloud) RunPrivateEndpointConnectionController(ctx context.Context, clusterName string) {
+	klog.Infof("Starting private endpoint connection controller for cluster %q", clusterName)
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		az.syncPrivateEndpointConnections(ctx, clusterName)
+	}, consts.PrivateEndpointConnectionSyncPeriod)
+}
+
+func (az *Cloud) syncPrivateEndpointConnections(ctx context.Context, clusterName string) {
+	if az.serviceLister == nil {
+		klog.V(4).Infof("syncPrivateEndpointConnections: service lister is not ready")
+		return
+	}
+
+	plsList, rerr := az.PrivateLinkServiceClient.List(ctx, az.PrivateLinkServiceResourceGroup)
+	if rerr != nil {
+		klog.Errorf("syncPrivateEndpointConnections: failed to list private link services in resource group %s: %v", az.PrivateLinkServiceResourceGroup, rerr.Error())
+		return
+	}
+
+	for i := range plsList {
+		pls := plsList[i]
+		if !isManagedPrivateLinkSerivce(&pls, clusterName) {
+			continue
+		}
+		owner := getPrivateLinkServiceOwner(&pls)
+		namespace, name, err := cache.SplitMetaNamespaceKey(owner)
+		if err != nil || name == "" {
+			klog.V(4).Infof("syncPrivateEndpointConnections: skipping private link service %s with owner %q", pointer.StringDeref(pls.Name, ""), owner)
+			continue
+		}
+		service, err := az.serviceLister.Services(namespace).Get(name)
+		if err != nil {
+			klog.V(4).Infof("syncPrivateEndpointConnections: skipping private link service %s: failed to get service %s: %v", pointer.StringDeref(pls.Name, ""), owner, err)
+			continue
+		}
+		az.reconcilePrivateEndpointConnections(service, &pls)
+	}
+}
+
+// reconcilePrivateEndpointConnections approves or rejects the pending connections of the private link service
+// according to the allow and deny annotations of the service, then reports the connection states.
+func (az *Cloud) reconcilePrivateEndpointConnections(service *v1.Service, pls *network.PrivateLinkService) {
+	serviceName := getServiceName(service)
+	plsName := pointer.StringDeref(pls.Name, "")
+
+	allow, err := newPrivateEndpointMatcher(service.Annotations[consts.ServiceAnnotationPLSConnectionAllow])
+	if err == nil {
+		var deny *privateEndpointMatcher
+		deny, err = newPrivateEndpointMatcher(service.Annotations[consts.ServiceAnnotationPLSConnectionDeny])
+		if err == nil {
+			if az.isLoadBalancerDryRun(service) {
+				// The connections are only updated when the load balancer of the service is applied to Azure.
+				klog.V(2).Infof("reconcilePrivateEndpointConnections for service(%s): pls(%s) - skip updating the connections in plan mode", serviceName, plsName)
+			} else {
+				az.approvePrivateEndpointConnections(service, pls, allow, deny)
+			}
+		}
+	}
+	if err != nil {
+		klog.Errorf("reconcilePrivateEndpointConnections for service(%s): pls(%s) - %v", serviceName, plsName, err)
+		az.Event(service, v1.EventTypeWarning, "InvalidPrivateEndpointConnectionRules", err.Error())
+	}
+
+	states := map[string]int{
+		consts.PrivateEndpointConnectionStatusPending:      0,
+		consts.PrivateEndpointConnectionStatusApproved:     0,
+		consts.PrivateEndpointConnectionStatusRejected:     0,
+		consts.PrivateEndpointConnectionStatusDisconnected: 0,
+	}
+	for _, peConn := range getPrivateEndpointConnections(pls) {
+		states[getPrivateEndpointConnectionStatus(peConn)]++
+	}
+	metrics.ObservePrivateEndpointConnections(az.PrivateLinkServiceResourceGroup, plsName, states)
+	az.updatePrivateEndpointConnectionStates(service, formatPrivateEndpointConnectionStates(states))
+}
+
+// approvePrivateEndpointConnections updates the status of the matched pending connections in place, so that the
+// reported states reflect the decisions. The deny list takes precedence over the allow list.
+func (az *Cloud) approvePrivateEndpointConnections(service *v1.Service, pls *network.PrivateLinkService, allow, deny *privateEndpointMatcher) {
+	plsName := pointer.StringDeref(pls.Name, "")
+	plsLBFrontendID := ""
+	if pls.PrivateLinkServiceProperties != nil && pls.LoadBalancerFrontendIPConfigurations != nil && len(*pls.LoadBalancerFrontendIPConfigurations) > 0 {
+		plsLBFrontendID = pointer.StringDeref((*pls.LoadBalancerFrontendIPConfigurations)[0].ID, "")
+	}
+	for _, peConn := range getPrivateEndpointConnections(pls) {
+		if getPrivateEndpointConnectionStatus(peConn) != consts.PrivateEndpointConnectionStatusPending {
+			continue
+		}
+		privateEndpointID := ""
+		if peConn.PrivateEndpoint != nil {
+			privateEndpointID = pointer.StringDeref(peConn.PrivateEndpoint.ID, "")
+		}
+
+		var status, annotation, reason string
+		switch {
+		case deny.match(privateEndpointID):
+			status, annotation, reason = consts.PrivateEndpointConnectionStatusRejected, consts.ServiceAnnotationPLSConnectionDeny, "PrivateEndpointConnectionRejected"
+		case allow.match(privateEndpointID):
+			status, annotation, reason = consts.PrivateEndpointConnectionStatusApproved, consts.ServiceAnnotationPLSConnectionAllow, "PrivateEndpointConnectionApproved"
+		default:
+			continue
+		}
+
+		klog.V(2).Infof("approvePrivateEndpointConnections for service(%s): pls(%s) - updating connection %s of private endpoint %s to %s", getServiceName(service), plsName, pointer.StringDeref(peConn.Name, ""), privateEndpointID, status)
+		peConn.PrivateLinkServiceConnectionState = &network.PrivateLinkServiceConnectionState{
+			Status:      pointer.String(status),
+			Description: pointer.String(fmt.Sprintf("%s by the cloud provider according to %s", status, annotation)),
+		}
+		if rerr := az.UpdatePEConn(service, plsName, plsLBFrontendID, *peConn); rerr != nil {
+			// The connection is still pending and will be retried in the next sync.
+			peConn.PrivateLinkServiceConnectionState.Status = pointer.String(consts.PrivateEndpointConnectionStatusPending)
+			continue
+		}
+		az.Event(service, v1.EventTypeNormal, reason, fmt.Sprintf("%s private endpoint %s", status, privateEndpointID))
+	}
+}
+
+// getPrivateEndpointConnections returns pointers to the private endpoint connections of the private link service.
+func getPrivateEndpointConnections(pls *network.PrivateLinkService) []*network.PrivateEndpointConnection {
+	if pls.PrivateLinkServiceProperties == nil || pls.PrivateEndpointConnections == nil {
+		return nil
+	}
+	peConns := make([]*network.PrivateEndpointConnection, 0, len(*pls.PrivateEndpointConnections))
+	for i := range *pls.PrivateEndpointConnections {
+		peConn := &(*pls.PrivateEndpointConnections)[i]
+		if peConn.PrivateEndpointConnectionProperties == nil {
+			continue
+		}
+		peConns = append(peConns, peConn)
+	}
+	return peConns
+}
+
+func getPrivateEndpointConnectionStatus(peConn *network.PrivateEndpointConnection) string {
+	if peConn.PrivateLinkServiceConnectionState == nil {
+		return consts.PrivateEndpointConnectionStatusPending
+	}
+	return pointer.StringDeref(peConn.PrivateLinkServiceConnectionState.Status, consts.PrivateEndpointConnectionStatusPending)
+}
+
+// formatPrivateEndpointConnectionStates formats the non-zero states sorted by status, e.g. "Approved=2,Pending=1".
+func formatPrivateEndpointConnectionStates(states map[string]int) string {
+	var result []string
+	for status, count := range states {
+		if count > 0 {
+			result = append(result, fmt.Sprintf("%s=%d", status, count))
+		}
+	}
+	sort.Strings(result)
+	return strings.Join(result, ",")
+}
+
+// updatePrivateEndpointConnectionStates patches the connection states annotation of the service if it has changed.
+func (az *Cloud) updatePrivateEndpointConnectionStates(service *v1.Service, states string) {
+	if az.KubeClient == nil || consts.IsGatewayService(service) || service.Annotations[consts.ServiceAnnotationPLSConnectionStates] == states {
+		return
+	}
+
+	serviceName := getServiceName(service)
+	patchBytes, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				consts.ServiceAnnotationPLSConnectionStates: states,
+			},
+		},
+	})
+	if err != nil {
+		klog.Errorf("updatePrivateEndpointConnectionStates(%s): failed to marshal the annotations: %v", serviceName, err)
+		return
+	}
+
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	if _, err := az.KubeClient.CoreV1().Services(service.Namespace).Patch(ctx, service.Name, types.StrategicMergePatchType, patchBytes, metav1.PatchOptions{}); err != nil {
+		klog.Warningf("updatePrivateEndpointConnectionStates(%s): failed to patch the service: %v", serviceName, err)
+		return
+	}
+	klog.V(4).Infof("updatePrivateEndpointConnectionStates(%s): updated the connection states to %q", serviceName, states)
+}
@@ -0,0 +1,265 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/privatelinkserviceclient/mockprivatelinkserviceclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+const (
+	testConsumerSubscriptionID = "00000000-0000-0000-0000-000000000001"
+	testPrivateEndpointID1     = "/subscriptions/00000000-0000-0000-0000-000000000001/resourceGroups/consumer/providers/Microsoft.Network/privateEndpoints/pe1"
+	testPrivateEndpointID2     = "/subscriptions/00000000-0000-0000-0000-000000000002/resourceGroups/partner/providers/Microsoft.Network/privateEndpoints/pe2"
+)
+
+func getTestPrivateEndpointConnection(name, privateEndpointID, status string) network.PrivateEndpointConnection {
+	return network.PrivateEndpointConnection{
+		Name: pointer.String(name),
+		Etag: pointer.String("etag"),
+		PrivateEndpointConnectionProperties: &network.PrivateEndpointConnectionProperties{
+			PrivateEndpoint: &network.PrivateEndpoint{ID: pointer.String(privateEndpointID)},
+			PrivateLinkServiceConnectionState: &network.PrivateLinkServiceConnectionState{
+				Status: pointer.String(status),
+			},
+		},
+	}
+}
+
+func TestPrivateEndpointMatcher(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		value         string
+		expectedErr   bool
+		expectedMatch map[string]bool
+	}{
+		{
+			desc:  "empty value should match nothing",
+			value: "",
+			expectedMatch: map[string]bool{
+				testPrivateEndpointID1: false,
+				"":                     false,
+			},
+		},
+		{
+			desc:  "subscription IDs should match the subscription of the private endpoints",
+			value: "00000000-0000-0000-0000-000000000001",
+			expectedMatch: map[string]bool{
+				testPrivateEndpointID1: true,
+				testPrivateEndpointID2: false,
+			},
+		},
+		{
+			desc:  "regular expressions should match the whole resource IDs case-insensitively",
+			value: "00000000-0000-0000-0000-00000000000f /subscriptions/.*/resourcegroups/partner/.*",
+			expectedMatch: map[string]bool{
+				testPrivateEndpointID1:            false,
+				testPrivateEndpointID2:            true,
+				"prefix" + testPrivateEndpointID2: false,
+			},
+		},
+		{
+			desc:        "invalid regular expressions should be reported",
+			value:       "/subscriptions/(",
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			m, err := newPrivateEndpointMatcher(test.value)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			for id, expected := range test.expectedMatch {
+				assert.Equal(t, expected, m.match(id), id)
+			}
+		})
+	}
+}
+
+func TestFormatPrivateEndpointConnectionStates(t *testing.T) {
+	assert.Equal(t, "", formatPrivateEndpointConnectionStates(map[string]int{consts.PrivateEndpointConnectionStatusPending: 0}))
+	assert.Equal(t, "Approved=2,Pending=1", formatPrivateEndpointConnectionStates(map[string]int{
+		consts.PrivateEndpointConnectionStatusPending:  1,
+		consts.PrivateEndpointConnectionStatusApproved: 2,
+		consts.PrivateEndpointConnectionStatusRejected: 0,
+	}))
+}
+
+func TestReconcilePrivateEndpointConnections(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testCases := []struct {
+		desc               string
+		annotations        map[string]string
+		updateErr          *retry.Error
+		expectedUpdates    map[string]string
+		expectedStates     string
+		expectedEventCount int
+	}{
+		{
+			desc:           "should keep the pending connections without rules",
+			expectedStates: "Approved=1,Pending=2",
+		},
+		{
+			desc: "should approve the allowed connections",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSConnectionAllow: testConsumerSubscriptionID,
+			},
+			expectedUpdates:    map[string]string{"conn1": consts.PrivateEndpointConnectionStatusApproved},
+			expectedStates:     "Approved=2,Pending=1",
+			expectedEventCount: 1,
+		},
+		{
+			desc: "should reject the denied connections even if they are allowed",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSConnectionAllow: ".*",
+				consts.ServiceAnnotationPLSConnectionDeny:  ".*/resourceGroups/partner/.*",
+			},
+			expectedUpdates: map[string]string{
+				"conn1": consts.PrivateEndpointConnectionStatusApproved,
+				"conn2": consts.PrivateEndpointConnectionStatusRejected,
+			},
+			expectedStates:     "Approved=2,Rejected=1",
+			expectedEventCount: 2,
+		},
+		{
+			desc: "should keep the connections pending if the update fails",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSConnectionAllow: testConsumerSubscriptionID,
+			},
+			updateErr:          &retry.Error{HTTPStatusCode: http.StatusInternalServerError},
+			expectedUpdates:    map[string]string{"conn1": consts.PrivateEndpointConnectionStatusApproved},
+			expectedStates:     "Approved=1,Pending=2",
+			expectedEventCount: 1,
+		},
+		{
+			desc: "should not update any connection in plan mode",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSConnectionAllow: ".*",
+				consts.ServiceAnnotationLoadBalancerDryRun: "true",
+			},
+			expectedStates: "Approved=1,Pending=2",
+		},
+		{
+			desc: "should not update any connection with invalid rules",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSConnectionAllow: ".*",
+				consts.ServiceAnnotationPLSConnectionDeny:  "(",
+			},
+			expectedStates:     "Approved=1,Pending=2",
+			expectedEventCount: 1,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			recorder := record.NewFakeRecorder(10)
+			az.eventRecorder = recorder
+			service := getTestService("svc1", v1.ProtocolTCP, test.annotations, false, 80)
+			az.KubeClient = fake.NewSimpleClientset(&service)
+
+			pls := network.PrivateLinkService{
+				Name: pointer.String("pls"),
+				PrivateLinkServiceProperties: &network.PrivateLinkServiceProperties{
+					PrivateEndpointConnections: &[]network.PrivateEndpointConnection{
+						getTestPrivateEndpointConnection("conn1", testPrivateEndpointID1, consts.PrivateEndpointConnectionStatusPending),
+						getTestPrivateEndpointConnection("conn2", testPrivateEndpointID2, consts.PrivateEndpointConnectionStatusPending),
+						getTestPrivateEndpointConnection("conn3", testPrivateEndpointID1, consts.PrivateEndpointConnectionStatusApproved),
+					},
+				},
+			}
+
+			mockPLSClient := az.PrivateLinkServiceClient.(*mockprivatelinkserviceclient.MockInterface)
+			for name, status := range test.expectedUpdates {
+				name, status := name, status
+				mockPLSClient.EXPECT().UpdatePEConnection(gomock.Any(), "rg", "pls", name, gomock.Any(), "etag").DoAndReturn(
+					func(ctx context.Context, resourceGroupName, plsName, peConnName string, peConn network.PrivateEndpointConnection, etag string) *retry.Error {
+						assert.Equal(t, status, *peConn.PrivateLinkServiceConnectionState.Status)
+						return test.updateErr
+					})
+			}
+
+			az.reconcilePrivateEndpointConnections(&service, &pls)
+
+			updated, err := az.KubeClient.CoreV1().Services(service.Namespace).Get(context.TODO(), service.Name, metav1.GetOptions{})
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedStates, updated.Annotations[consts.ServiceAnnotationPLSConnectionStates])
+			assert.Equal(t, test.expectedEventCount, len(recorder.Events))
+		})
+	}
+}
+
+func TestSyncPrivateEndpointConnections(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.eventRecorder = record.NewFakeRecorder(10)
+	service := getTestService("svc1", v1.ProtocolTCP, map[string]string{
+		consts.ServiceAnnotationPLSConnectionAllow: testConsumerSubscriptionID,
+	}, false, 80)
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	assert.NoError(t, indexer.Add(&service))
+	az.serviceLister = corelisters.NewServiceLister(indexer)
+
+	getPLS := func(name, clusterName, owner string) network.PrivateLinkService {
+		return network.PrivateLinkService{
+			Name: pointer.String(name),
+			Tags: map[string]*string{
+				consts.ClusterNameTagKey:  pointer.String(clusterName),
+				consts.OwnerServiceTagKey: pointer.String(owner),
+			},
+			PrivateLinkServiceProperties: &network.PrivateLinkServiceProperties{
+				PrivateEndpointConnections: &[]network.PrivateEndpointConnection{
+					getTestPrivateEndpointConnection("conn1", testPrivateEndpointID1, consts.PrivateEndpointConnectionStatusPending),
+				},
+			},
+		}
+	}
+	mockPLSClient := az.PrivateLinkServiceClient.(*mockprivatelinkserviceclient.MockInterface)
+	mockPLSClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PrivateLinkService{
+		getPLS("pls1", testClusterName, "default/svc1"),
+		getPLS("pls2", "other-cluster", "default/svc1"),
+		getPLS("pls3", testClusterName, "default/missing"),
+	}, nil)
+	mockPLSClient.EXPECT().UpdatePEConnection(gomock.Any(), "rg", "pls1", "conn1", gomock.Any(), "etag").Return(nil)
+
+	az.syncPrivateEndpointConnections(context.TODO(), testClusterName)
+}
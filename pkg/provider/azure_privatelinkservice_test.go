@@ -17,6 +17,8 @@ limitations under the License.
 package provider
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"testing"
 
@@ -26,6 +28,8 @@ import (
 
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/utils/pointer"
 
 	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/privatelinkserviceclient/mockprivatelinkserviceclient"
@@ -281,6 +285,16 @@ func TestReconcilePrivateLinkService(t *testing.T) {
 			expectedPLSCreate: true,
 			expectedPLS:       &network.PrivateLinkService{Name: pointer.String("testpls")},
 		},
+		{
+			desc: "reconcilePrivateLinkService should not create a PLS for service sharing the PLS of the LB frontend",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSShared:            "true",
+				consts.ServiceAnnotationLoadBalancerInternal: "true",
+			},
+			wantPLS:         true,
+			expectedPLSList: true,
+			existingPLSList: []network.PrivateLinkService{},
+		},
 		{
 			desc: "reconcilePrivateLinkService should not do anything if no existing PLS attached to the LB frontend when deleting",
 			annotations: map[string]string{
@@ -917,6 +931,13 @@ func TestServiceRequiresPLS(t *testing.T) {
 			},
 			expected: true,
 		},
+		{
+			desc: "Service with true pls shared annotation should return true",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSShared: "true",
+			},
+			expected: true,
+		},
 	}
 	for i, test := range tests {
 		s := &v1.Service{}
@@ -1779,6 +1800,11 @@ func TestServiceHasAdditionalConfigs(t *testing.T) {
 			annotations: map[string]string{consts.ServiceAnnotationPLSIpConfigurationSubnet: "test"},
 			expected:    true,
 		},
+		{
+			desc:        "Service with pls-ip-configuration-subnets annotation should return true",
+			annotations: map[string]string{consts.ServiceAnnotationPLSIpConfigurationSubnets: "test"},
+			expected:    true,
+		},
 		{
 			desc:        "Service with pls-ip-address-count annotation should return true",
 			annotations: map[string]string{consts.ServiceAnnotationPLSIpConfigurationIPAddressCount: "test"},
@@ -1817,3 +1843,260 @@ func TestServiceHasAdditionalConfigs(t *testing.T) {
 		assert.Equal(t, actual, c.expected, "TestCase[%d]: %s", i, c.desc)
 	}
 }
+
+func TestReconcilePLSIpConfigsWithMultipleSubnets(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	getIPConfig := func(name, subnetID, staticIP string, primary bool) network.PrivateLinkServiceIPConfiguration {
+		ipConfig := network.PrivateLinkServiceIPConfiguration{
+			Name: pointer.String(name),
+			PrivateLinkServiceIPConfigurationProperties: &network.PrivateLinkServiceIPConfigurationProperties{
+				PrivateIPAllocationMethod: network.Dynamic,
+				Subnet:                    &network.Subnet{ID: pointer.String(subnetID)},
+				Primary:                   pointer.Bool(primary),
+				PrivateIPAddressVersion:   network.IPv4,
+			},
+		}
+		if staticIP != "" {
+			ipConfig.PrivateIPAddress = pointer.String(staticIP)
+			ipConfig.PrivateIPAllocationMethod = network.Static
+		}
+		return ipConfig
+	}
+
+	testCases := []struct {
+		desc              string
+		annotations       map[string]string
+		existingIPConfigs *[]network.PrivateLinkServiceIPConfiguration
+		expectedIPConfigs []network.PrivateLinkServiceIPConfiguration
+		expectedChanged   bool
+		expectedErr       bool
+	}{
+		{
+			desc: "should create one ip configuration per subnet by default",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSIpConfigurationSubnets: "subnet1 subnet2 subnet3",
+			},
+			expectedIPConfigs: []network.PrivateLinkServiceIPConfiguration{
+				getIPConfig("subnet1-testpls-dynamic-0", "subnet1ID", "", true),
+				getIPConfig("subnet2-testpls-dynamic-0", "subnet2ID", "", false),
+				getIPConfig("subnet3-testpls-dynamic-0", "subnet3ID", "", false),
+			},
+			expectedChanged: true,
+		},
+		{
+			desc: "should spread the dynamic ip configurations around the static ones",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSIpConfigurationSubnets:        "subnet1 subnet2 subnet3",
+				consts.ServiceAnnotationPLSIpConfigurationIPAddressCount: "5",
+				consts.ServiceAnnotationPLSIpConfigurationIPAddress:      "10.0.1.4 10.0.1.5",
+			},
+			expectedIPConfigs: []network.PrivateLinkServiceIPConfiguration{
+				getIPConfig("subnet1-testpls-static-10.0.1.4", "subnet1ID", "10.0.1.4", true),
+				getIPConfig("subnet1-testpls-static-10.0.1.5", "subnet1ID", "10.0.1.5", false),
+				getIPConfig("subnet2-testpls-dynamic-0", "subnet2ID", "", false),
+				getIPConfig("subnet2-testpls-dynamic-1", "subnet2ID", "", false),
+				getIPConfig("subnet3-testpls-dynamic-0", "subnet3ID", "", false),
+			},
+			expectedChanged: true,
+		},
+		{
+			desc: "should not change the ip configurations already spread across the subnets",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSIpConfigurationSubnets: "subnet1 subnet2",
+			},
+			existingIPConfigs: &[]network.PrivateLinkServiceIPConfiguration{
+				getIPConfig("subnet1-testpls-dynamic-0", "subnet1ID", "", true),
+				getIPConfig("subnet2-testpls-dynamic-0", "subnet2ID", "", false),
+			},
+			expectedIPConfigs: []network.PrivateLinkServiceIPConfiguration{
+				getIPConfig("subnet1-testpls-dynamic-0", "subnet1ID", "", true),
+				getIPConfig("subnet2-testpls-dynamic-0", "subnet2ID", "", false),
+			},
+		},
+		{
+			desc: "should respread the ip configurations when a subnet is added",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSIpConfigurationSubnets:        "subnet1 subnet2",
+				consts.ServiceAnnotationPLSIpConfigurationIPAddressCount: "2",
+			},
+			existingIPConfigs: &[]network.PrivateLinkServiceIPConfiguration{
+				getIPConfig("subnet1-testpls-dynamic-0", "subnet1ID", "", true),
+				getIPConfig("subnet1-testpls-dynamic-1", "subnet1ID", "", false),
+			},
+			expectedIPConfigs: []network.PrivateLinkServiceIPConfiguration{
+				getIPConfig("subnet1-testpls-dynamic-0", "subnet1ID", "", true),
+				getIPConfig("subnet2-testpls-dynamic-0", "subnet2ID", "", false),
+			},
+			expectedChanged: true,
+		},
+		{
+			desc: "should report error when the ip count is fewer than the number of subnets",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSIpConfigurationSubnets:        "subnet1 subnet2",
+				consts.ServiceAnnotationPLSIpConfigurationIPAddressCount: "1",
+			},
+			expectedErr: true,
+		},
+		{
+			desc: "should report error when a static ip is not in any subnet",
+			annotations: map[string]string{
+				consts.ServiceAnnotationPLSIpConfigurationSubnets:   "subnet1 subnet2",
+				consts.ServiceAnnotationPLSIpConfigurationIPAddress: "10.0.9.4",
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			service := getTestServiceWithAnnotation("test", test.annotations, 80)
+			pls := &network.PrivateLinkService{
+				Name: pointer.String("testpls"),
+				PrivateLinkServiceProperties: &network.PrivateLinkServiceProperties{
+					IPConfigurations: test.existingIPConfigs,
+				},
+			}
+			mockSubnetsClient := az.SubnetsClient.(*mocksubnetclient.MockInterface)
+			for i, name := range []string{"subnet1", "subnet2", "subnet3"} {
+				mockSubnetsClient.EXPECT().Get(gomock.Any(), "rg", "vnet", name, gomock.Any()).Return(network.Subnet{
+					ID:   pointer.String(name + "ID"),
+					Name: pointer.String(name),
+					SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
+						AddressPrefix: pointer.String(fmt.Sprintf("10.0.%d.0/24", i+1)),
+					},
+				}, nil).MaxTimes(1)
+			}
+
+			changed, err := az.reconcilePLSIpConfigs(pls, &service)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedChanged, changed)
+			testSamePLSIpConfigs(t, *pls.IPConfigurations, test.expectedIPConfigs)
+		})
+	}
+}
+
+func TestReconcilePrivateLinkServiceOwnerTakeOver(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	testCases := []struct {
+		desc              string
+		ownerAnnotations  map[string]string
+		ownerExists       bool
+		expectedPLSCreate bool
+	}{
+		{
+			desc:              "should take over the PLS if the owner service is deleted",
+			expectedPLSCreate: true,
+		},
+		{
+			desc:              "should take over the PLS if the owner service does not create PLS anymore",
+			ownerExists:       true,
+			expectedPLSCreate: true,
+		},
+		{
+			desc:             "should share the PLS if the owner service is active",
+			ownerAnnotations: map[string]string{consts.ServiceAnnotationPLSCreation: "true"},
+			ownerExists:      true,
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			az := GetTestCloud(ctrl)
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if test.ownerExists {
+				owner := getTestServiceWithAnnotation("owner", test.ownerAnnotations, 80)
+				owner.Spec.Type = v1.ServiceTypeLoadBalancer
+				assert.NoError(t, indexer.Add(&owner))
+			}
+			az.serviceLister = corelisters.NewServiceLister(indexer)
+
+			service := getTestServiceWithAnnotation("test", map[string]string{
+				consts.ServiceAnnotationPLSCreation:          "true",
+				consts.ServiceAnnotationLoadBalancerInternal: "true",
+			}, 81)
+			fipConfig := &network.FrontendIPConfiguration{
+				Name: pointer.String("fipConfig"),
+				ID:   pointer.String("fipConfigID"),
+			}
+			existingPLS := network.PrivateLinkService{
+				Name: pointer.String("testpls"),
+				ID:   pointer.String("testplsID"),
+				Tags: map[string]*string{
+					consts.ClusterNameTagKey:  pointer.String(testClusterName),
+					consts.OwnerServiceTagKey: pointer.String("default/owner"),
+				},
+				PrivateLinkServiceProperties: &network.PrivateLinkServiceProperties{
+					LoadBalancerFrontendIPConfigurations: &[]network.FrontendIPConfiguration{{ID: pointer.String("fipConfigID")}},
+					IPConfigurations: &[]network.PrivateLinkServiceIPConfiguration{
+						{
+							Name: pointer.String("subnet-testpls-dynamic-0"),
+							PrivateLinkServiceIPConfigurationProperties: &network.PrivateLinkServiceIPConfigurationProperties{
+								PrivateIPAllocationMethod: network.Dynamic,
+								Subnet:                    &network.Subnet{ID: pointer.String("subnetID")},
+								Primary:                   pointer.Bool(true),
+								PrivateIPAddressVersion:   network.IPv4,
+							},
+						},
+					},
+				},
+			}
+
+			mockSubnetsClient := az.SubnetsClient.(*mocksubnetclient.MockInterface)
+			mockSubnetsClient.EXPECT().Get(gomock.Any(), "rg", "vnet", "subnet", "").Return(network.Subnet{
+				Name: pointer.String("subnet"),
+				ID:   pointer.String("subnetID"),
+				SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
+					PrivateLinkServiceNetworkPolicies: network.VirtualNetworkPrivateLinkServiceNetworkPoliciesDisabled,
+				},
+			}, nil).AnyTimes()
+			mockPLSsClient := az.PrivateLinkServiceClient.(*mockprivatelinkserviceclient.MockInterface)
+			mockPLSsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PrivateLinkService{existingPLS}, nil).MaxTimes(1)
+			if test.expectedPLSCreate {
+				mockPLSsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "testpls", gomock.Any(), gomock.Any()).DoAndReturn(
+					func(ctx context.Context, resourceGroupName, plsName string, pls network.PrivateLinkService, etag string) *retry.Error {
+						assert.Equal(t, "default/test", pointer.StringDeref(pls.Tags[consts.OwnerServiceTagKey], ""))
+						return nil
+					})
+			}
+
+			err := az.reconcilePrivateLinkService(testClusterName, &service, fipConfig, true)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestValidateSharedPrivateLinkServicePorts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	owner := getTestServiceWithAnnotation("owner", map[string]string{consts.ServiceAnnotationPLSCreation: "true"}, 80)
+	owner.UID = "owner"
+	owner.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: "10.0.0.4"}}
+	assert.NoError(t, indexer.Add(&owner))
+	az.serviceLister = corelisters.NewServiceLister(indexer)
+	fipConfig := &network.FrontendIPConfiguration{
+		Name: pointer.String("fipConfig"),
+		FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+			PrivateIPAddress: pointer.String("10.0.0.4"),
+		},
+	}
+
+	service := getTestServiceWithAnnotation("test", map[string]string{consts.ServiceAnnotationPLSShared: "true"}, 81)
+	service.UID = "test"
+	assert.NoError(t, az.validateSharedPrivateLinkServicePorts(&service, fipConfig))
+
+	conflicting := getTestServiceWithAnnotation("test", map[string]string{consts.ServiceAnnotationPLSShared: "true"}, 80)
+	conflicting.UID = "test"
+	assert.Error(t, az.validateSharedPrivateLinkServicePorts(&conflicting, fipConfig))
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+
+	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+// publicIPPoolLeaseAttempts is the number of attempts to lease a public IP, which may be changed by another
+// cluster sharing the pool between the read and the write.
+const publicIPPoolLeaseAttempts = 3
+
+func validatePublicIPPool(config *Config) error {
+	pool := config.PublicIPPool
+	if len(pool.Tags) == 0 && (pool.ResourceGroup == "" || strings.EqualFold(pool.ResourceGroup, config.ResourceGroup)) {
+		return fmt.Errorf("publicIPPool.tags is required when publicIPPool.resourceGroup is not set or is the cluster resource group")
+	}
+	for key := range pool.Tags {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("publicIPPool.tags should not have an empty key")
+		}
+	}
+	return nil
+}
+
+// shouldLeasePublicIPFromPool returns true if the service leases its public IP from the pool. The services
+// requesting a specific public IP or IP tags create or use their own public IPs instead.
+func (az *Cloud) shouldLeasePublicIPFromPool(service *v1.Service) bool {
+	if az.PublicIPPool == nil || requiresInternalLoadBalancer(service) {
+		return false
+	}
+	for _, key := range []string{
+		consts.ServiceAnnotationPIPName,
+		consts.ServiceAnnotationPIPPrefixID,
+		consts.ServiceAnnotationIPTagsForPublicIP,
+		consts.ServiceAnnotationPIPRoutingPreference,
+	} {
+		if service.Annotations[key] != "" {
+			return false
+		}
+	}
+	return getServiceLoadBalancerIP(service) == ""
+}
+
+// isPublicIPInPool returns true if the public IP in the resource group is selected by the public IP pool.
+func (az *Cloud) isPublicIPInPool(pipResourceGroup string, pip *network.PublicIPAddress) bool {
+	if az.PublicIPPool == nil || pip == nil || isGlobalPublicIP(pip) {
+		return false
+	}
+	if az.PublicIPPool.ResourceGroup != "" && !strings.EqualFold(az.PublicIPPool.ResourceGroup, pipResourceGroup) {
+		return false
+	}
+
+	for key, value := range az.PublicIPPool.Tags {
+		var found bool
+		for pipKey, pipValue := range pip.Tags {
+			if strings.EqualFold(pipKey, key) && strings.EqualFold(pointer.StringDeref(pipValue, ""), value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// isPublicIPLeasable returns true if the public IP is neither leased to a service nor associated with other resources.
+func isPublicIPLeasable(pip *network.PublicIPAddress) bool {
+	return getServiceFromPIPServiceTags(pip.Tags) == "" &&
+		pip.PublicIPAddressPropertiesFormat != nil &&
+		pip.IPConfiguration == nil
+}
+
+// getPublicIPNameFromPool returns the public IP leased to the service, or the first leasable public IP in the pool
+// which is bound to the service by ensurePublicIPExists. An error is reported if the pool is exhausted.
+func (az *Cloud) getPublicIPNameFromPool(service *v1.Service, pipResourceGroup string, pips *[]network.PublicIPAddress) (string, error) {
+	if *pips == nil {
+		pipList, err := az.listPIP(pipResourceGroup)
+		if err != nil {
+			return "", err
+		}
+		*pips = pipList
+	}
+
+	serviceName := getServiceName(service)
+	var leased, available []string
+	for i := range *pips {
+		pip := (*pips)[i]
+		if !az.isPublicIPInPool(pipResourceGroup, &pip) {
+			continue
+		}
+		if serviceTag := getServiceFromPIPServiceTags(pip.Tags); isSVCNameInPIPTag(serviceTag, serviceName) {
+			return pointer.StringDeref(pip.Name, ""), nil
+		}
+		if isPublicIPLeasable(&pip) {
+			available = append(available, pointer.StringDeref(pip.Name, ""))
+		} else {
+			leased = append(leased, pointer.StringDeref(pip.Name, ""))
+		}
+	}
+	metrics.ObservePublicIPPool(pipResourceGroup, len(leased), len(available))
+
+	if len(available) == 0 {
+		metrics.CountPublicIPPoolExhausted(pipResourceGroup)
+		msg := fmt.Sprintf("no public IP is available in the public IP pool of resource group %s, %d leased", pipResourceGroup, len(leased))
+		az.Event(service, v1.EventTypeWarning, "PublicIPPoolExhausted", msg)
+		return "", fmt.Errorf("getPublicIPNameFromPool for service(%s): %s", serviceName, msg)
+	}
+	sort.Strings(available)
+	return available[0], nil
+}
+
+// leasePublicIPFromPool binds the service to the leasable public IP in the pool. The pool may be shared by several
+// clusters, so the public IP is read again and the lease is written with its etag, which fails if another service
+// leases the public IP in the meantime. It returns true if the public IP is changed but not written yet, which only
+// happens in plan mode.
+func (az *Cloud) leasePublicIPFromPool(service *v1.Service, pipResourceGroup string, pip *network.PublicIPAddress, clusterName string) (bool, error) {
+	if !az.shouldLeasePublicIPFromPool(service) || !az.isPublicIPInPool(pipResourceGroup, pip) || !isPublicIPLeasable(pip) {
+		return false, nil
+	}
+
+	serviceName := getServiceName(service)
+	pipName := pointer.StringDeref(pip.Name, "")
+	if az.inLoadBalancerPlan(service) {
+		bindPublicIPLease(pip, serviceName, clusterName)
+		return true, nil
+	}
+
+	var err error
+	for i := 0; i < publicIPPoolLeaseAttempts; i++ {
+		latest, existsPip, getErr := az.getPublicIPAddress(pipResourceGroup, pipName, azcache.CacheReadTypeForceRefresh)
+		if getErr != nil {
+			return false, getErr
+		}
+		if !existsPip || !isPublicIPLeasable(&latest) {
+			return false, fmt.Errorf("leasePublicIPFromPool for service(%s): pip(%s) is no longer available in the public IP pool", serviceName, pipName)
+		}
+
+		klog.V(2).Infof("leasePublicIPFromPool for service(%s): leasing pip(%s)", serviceName, pipName)
+		bindPublicIPLease(&latest, serviceName, clusterName)
+		if err = az.createOrUpdatePIP(service, pipResourceGroup, latest, pointer.StringDeref(latest.Etag, "")); err == nil {
+			*pip = latest
+			return false, nil
+		}
+		if !retry.HasStatusPreconditionFailedError(err) {
+			return false, err
+		}
+		klog.V(2).Infof("leasePublicIPFromPool for service(%s): pip(%s) is changed by another client, retrying", serviceName, pipName)
+	}
+	return false, err
+}
+
+func bindPublicIPLease(pip *network.PublicIPAddress, serviceName, clusterName string) {
+	if pip.Tags == nil {
+		pip.Tags = make(map[string]*string)
+	}
+	pip.Tags[consts.ServiceTagKey] = pointer.String(serviceName)
+	pip.Tags[consts.ClusterNameKey] = pointer.String(clusterName)
+}
+
+// releaseStalePoolPublicIPs releases the public IPs leased to the service in the resource group of the pool after the
+// service stops leasing from the pool, e.g. after a public IP name is annotated, since the public IPs of the service
+// are then reconciled in another resource group. The released public IPs can only be leased again after the frontend
+// of the service stops referencing them.
+func (az *Cloud) releaseStalePoolPublicIPs(service *v1.Service, pipResourceGroup string) error {
+	if az.PublicIPPool == nil || az.PublicIPPool.ResourceGroup == "" || strings.EqualFold(az.PublicIPPool.ResourceGroup, pipResourceGroup) {
+		return nil
+	}
+
+	poolResourceGroup := az.PublicIPPool.ResourceGroup
+	pips, err := az.listPIP(poolResourceGroup)
+	if err != nil {
+		return err
+	}
+	serviceName := getServiceName(service)
+	for i := range pips {
+		pip := pips[i]
+		if !az.isPublicIPInPool(poolResourceGroup, &pip) || !isSVCNameInPIPTag(getServiceFromPIPServiceTags(pip.Tags), serviceName) {
+			continue
+		}
+		if err := az.releasePublicIPToPool(service, poolResourceGroup, &pip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releasePublicIPToPool returns the public IP to the pool after the service stops using it.
+func (az *Cloud) releasePublicIPToPool(service *v1.Service, pipResourceGroup string, pip *network.PublicIPAddress) error {
+	serviceName := getServiceName(service)
+	if pip.Tags == nil {
+		pip.Tags = make(map[string]*string)
+	}
+	if isSVCNameInPIPTag(getServiceFromPIPServiceTags(pip.Tags), serviceName) {
+		if err := unbindServiceFromPIP(pip, service, serviceName, "", false); err != nil {
+			return err
+		}
+	}
+	if getServiceFromPIPServiceTags(pip.Tags) == "" {
+		delete(pip.Tags, consts.ClusterNameKey)
+		delete(pip.Tags, consts.LegacyClusterNameKey)
+	}
+
+	klog.V(2).Infof("releasePublicIPToPool for service(%s): releasing pip(%s)", serviceName, pointer.StringDeref(pip.Name, ""))
+	return az.CreateOrUpdatePIP(service, pipResourceGroup, *pip)
+}
@@ -0,0 +1,232 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/publicipclient/mockpublicipclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+	"sigs.k8s.io/cloud-provider-azure/pkg/retry"
+)
+
+func getTestPoolPublicIP(name, serviceTag string) network.PublicIPAddress {
+	pip := network.PublicIPAddress{
+		Name: pointer.String(name),
+		Tags: map[string]*string{"pool": pointer.String("allow-listed")},
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+			IPAddress: pointer.String("1.2.3.4"),
+		},
+	}
+	if serviceTag != "" {
+		pip.Tags[consts.ServiceTagKey] = pointer.String(serviceTag)
+		pip.Tags[consts.ClusterNameKey] = pointer.String("kubernetes")
+	}
+	return pip
+}
+
+func TestValidatePublicIPPool(t *testing.T) {
+	for _, tc := range []struct {
+		desc        string
+		pool        PublicIPPool
+		expectedErr bool
+	}{
+		{
+			desc: "tags in the cluster resource group",
+			pool: PublicIPPool{Tags: map[string]string{"pool": "allow-listed"}},
+		},
+		{
+			desc: "a dedicated resource group",
+			pool: PublicIPPool{ResourceGroup: "pool-rg"},
+		},
+		{
+			desc:        "the cluster resource group without tags",
+			pool:        PublicIPPool{ResourceGroup: "RG"},
+			expectedErr: true,
+		},
+		{
+			desc:        "empty tag key",
+			pool:        PublicIPPool{Tags: map[string]string{" ": "allow-listed"}},
+			expectedErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			config := &Config{ResourceGroup: "rg", PublicIPPool: &tc.pool}
+			assert.Equal(t, tc.expectedErr, validatePublicIPPool(config) != nil)
+		})
+	}
+}
+
+func TestShouldLeasePublicIPFromPool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+
+	service := getTestService("svc1", v1.ProtocolTCP, nil, false, 80)
+	assert.False(t, az.shouldLeasePublicIPFromPool(&service))
+
+	az.PublicIPPool = &PublicIPPool{ResourceGroup: "pool-rg"}
+	assert.True(t, az.shouldLeasePublicIPFromPool(&service))
+	assert.Equal(t, "pool-rg", az.getPublicIPAddressResourceGroup(&service))
+
+	internalService := getInternalTestService("svc2", 80)
+	assert.False(t, az.shouldLeasePublicIPFromPool(&internalService))
+
+	namedService := getTestService("svc3", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationPIPName: "pip"}, false, 80)
+	assert.False(t, az.shouldLeasePublicIPFromPool(&namedService))
+	assert.Equal(t, "rg", az.getPublicIPAddressResourceGroup(&namedService))
+
+	ipService := getTestService("svc4", v1.ProtocolTCP, nil, false, 80)
+	ipService.Spec.LoadBalancerIP = "1.2.3.4"
+	assert.False(t, az.shouldLeasePublicIPFromPool(&ipService))
+}
+
+func TestGetPublicIPNameFromPool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	az.PublicIPPool = &PublicIPPool{Tags: map[string]string{"pool": "allow-listed"}}
+	recorder := record.NewFakeRecorder(10)
+	az.eventRecorder = recorder
+	service := getTestService("svc1", v1.ProtocolTCP, nil, false, 80)
+
+	notInPool := getTestPoolPublicIP("pip0", "")
+	notInPool.Tags = nil
+	attached := getTestPoolPublicIP("pip1", "")
+	attached.IPConfiguration = &network.IPConfiguration{ID: pointer.String("ipconfig")}
+	pips := []network.PublicIPAddress{
+		notInPool,
+		attached,
+		getTestPoolPublicIP("pip4", ""),
+		getTestPoolPublicIP("pip3", ""),
+		getTestPoolPublicIP("pip2", "default/svc2"),
+	}
+
+	name, shouldPIPExisted, err := az.determinePublicIPName("kubernetes", &service, &pips)
+	assert.NoError(t, err)
+	assert.True(t, shouldPIPExisted)
+	assert.Equal(t, "pip3", name)
+
+	t.Run("the leased public IP should be returned", func(t *testing.T) {
+		leased := append(pips, getTestPoolPublicIP("pip5", "default/svc1"))
+		name, err := az.getPublicIPNameFromPool(&service, "rg", &leased)
+		assert.NoError(t, err)
+		assert.Equal(t, "pip5", name)
+	})
+
+	t.Run("an event should be reported if the pool is exhausted", func(t *testing.T) {
+		exhausted := pips[:2]
+		_, err := az.getPublicIPNameFromPool(&service, "rg", &exhausted)
+		assert.Error(t, err)
+		assert.Contains(t, <-recorder.Events, "PublicIPPoolExhausted")
+	})
+}
+
+func TestLeaseAndReleasePublicIPFromPool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	az.PublicIPPool = &PublicIPPool{Tags: map[string]string{"pool": "allow-listed"}}
+	service := getTestService("svc1", v1.ProtocolTCP, nil, false, 80)
+
+	pip := getTestPoolPublicIP("pip1", "")
+	pip.Etag = pointer.String("etag1")
+	latest := getTestPoolPublicIP("pip1", "")
+	latest.Etag = pointer.String("etag2")
+	mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	gomock.InOrder(
+		mockPIPsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{pip}, nil),
+		mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "pip1", gomock.Any(), "etag1").Return(&retry.Error{HTTPStatusCode: http.StatusPreconditionFailed}),
+		mockPIPsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{latest}, nil),
+		mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "pip1", gomock.Any(), "etag2").DoAndReturn(
+			func(ctx context.Context, rg, name string, pip network.PublicIPAddress, _ string) *retry.Error {
+				assert.Equal(t, "default/svc1", pointer.StringDeref(pip.Tags[consts.ServiceTagKey], ""))
+				assert.Equal(t, "kubernetes", pointer.StringDeref(pip.Tags[consts.ClusterNameKey], ""))
+				return nil
+			}),
+	)
+	leased, err := az.leasePublicIPFromPool(&service, "rg", &pip, "kubernetes")
+	assert.NoError(t, err)
+	assert.False(t, leased)
+	assert.Equal(t, "default/svc1", pointer.StringDeref(pip.Tags[consts.ServiceTagKey], ""))
+	assert.Equal(t, "kubernetes", pointer.StringDeref(pip.Tags[consts.ClusterNameKey], ""))
+
+	leased, err = az.leasePublicIPFromPool(&service, "rg", &pip, "kubernetes")
+	assert.NoError(t, err)
+	assert.False(t, leased)
+
+	mockPIPsClient.EXPECT().Delete(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "rg", "pip1", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, rg, name string, pip network.PublicIPAddress, _ string) error {
+			assert.Equal(t, "", pointer.StringDeref(pip.Tags[consts.ServiceTagKey], ""))
+			assert.NotContains(t, pip.Tags, consts.ClusterNameKey)
+			assert.Equal(t, "allow-listed", pointer.StringDeref(pip.Tags["pool"], ""))
+			return nil
+		})
+	assert.NoError(t, az.safeDeletePublicIP(&service, "rg", &pip, nil, false))
+}
+
+func TestLeasePublicIPFromPoolLeasedByAnotherService(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	az.PublicIPPool = &PublicIPPool{Tags: map[string]string{"pool": "allow-listed"}}
+	service := getTestService("svc1", v1.ProtocolTCP, nil, false, 80)
+
+	pip := getTestPoolPublicIP("pip1", "")
+	mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPsClient.EXPECT().List(gomock.Any(), "rg").Return([]network.PublicIPAddress{getTestPoolPublicIP("pip1", "default/svc2")}, nil)
+	mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	_, err := az.leasePublicIPFromPool(&service, "rg", &pip, "kubernetes")
+	assert.EqualError(t, err, "leasePublicIPFromPool for service(default/svc1): pip(pip1) is no longer available in the public IP pool")
+}
+
+func TestReleaseStalePoolPublicIPs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	az := GetTestCloud(ctrl)
+	az.PublicIPPool = &PublicIPPool{ResourceGroup: "pool-rg"}
+	service := getTestService("svc1", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationPIPName: "my-pip"}, false, 80)
+	assert.Equal(t, "rg", az.getPublicIPAddressResourceGroup(&service))
+
+	mockPIPsClient := az.PublicIPAddressesClient.(*mockpublicipclient.MockInterface)
+	mockPIPsClient.EXPECT().List(gomock.Any(), "pool-rg").Return([]network.PublicIPAddress{
+		getTestPoolPublicIP("pip1", "default/svc1"),
+		getTestPoolPublicIP("pip2", "default/svc2"),
+	}, nil)
+	mockPIPsClient.EXPECT().CreateOrUpdate(gomock.Any(), "pool-rg", "pip1", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, rg, name string, pip network.PublicIPAddress, _ string) *retry.Error {
+			assert.Equal(t, "", pointer.StringDeref(pip.Tags[consts.ServiceTagKey], ""))
+			assert.NotContains(t, pip.Tags, consts.ClusterNameKey)
+			return nil
+		})
+	assert.NoError(t, az.releaseStalePoolPublicIPs(&service, "rg"))
+
+	// The public IPs are kept while the service leases from the pool.
+	assert.NoError(t, az.releaseStalePoolPublicIPs(&service, "pool-rg"))
+}
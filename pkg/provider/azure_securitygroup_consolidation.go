@@ -0,0 +1,290 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	utilnet "k8s.io/utils/net"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+// isSecurityRuleConsolidationCandidate returns true if the security rules of the service can be consolidated
+// with the rules of the other services. The shared security rules are consolidated by the services themselves,
+// and the rules of the services with disabled floating IP target the backend IPs instead of the frontend IPs.
+func isSecurityRuleConsolidationCandidate(service *v1.Service) bool {
+	return service.Spec.Type == v1.ServiceTypeLoadBalancer &&
+		!consts.IsK8sServiceUsingApplicationGateway(service) &&
+		!useSharedSecurityRule(service) &&
+		!consts.IsK8sServiceDisableLoadBalancerFloatingIP(service)
+}
+
+func isConsolidatedSecurityRule(rule network.SecurityRule) bool {
+	return strings.HasPrefix(pointer.StringDeref(rule.Name, ""), consts.ConsolidatedSecurityRulePrefix)
+}
+
+// getConsolidatedSecurityRules returns the security rules of all the load balancer services in the cluster packed
+// by destination IP and port ranges. The expected rules of the other services are computed from their ingress IPs.
+func (az *Cloud) getConsolidatedSecurityRules(service *v1.Service, wantLb bool, expectedSecurityRules []network.SecurityRule) ([]network.SecurityRule, error) {
+	var rules []network.SecurityRule
+	if wantLb {
+		rules = append(rules, expectedSecurityRules...)
+	}
+
+	services, err := az.serviceLister.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("getConsolidatedSecurityRules: failed to list services: %w", err)
+	}
+	for _, svc := range services {
+		if svc.UID == service.UID || svc.DeletionTimestamp != nil || !isSecurityRuleConsolidationCandidate(svc) {
+			continue
+		}
+		var destinationIPAddresses []string
+		for _, ingress := range svc.Status.LoadBalancer.Ingress {
+			if ingress.IP != "" {
+				destinationIPAddresses = append(destinationIPAddresses, ingress.IP)
+			}
+		}
+		if len(destinationIPAddresses) == 0 {
+			continue
+		}
+
+		sourceRanges, sourceAddressPrefixes, err := getServiceSourceAddressPrefixes(svc)
+		if err != nil {
+			klog.Warningf("getConsolidatedSecurityRules: skipping service %s: %v", getServiceName(svc), err)
+			continue
+		}
+		serviceRules, err := az.getExpectedSecurityRules(true, svc.Spec.Ports, sourceAddressPrefixes, svc, destinationIPAddresses, sourceRanges, nil, false)
+		if err != nil {
+			klog.Warningf("getConsolidatedSecurityRules: skipping service %s: %v", getServiceName(svc), err)
+			continue
+		}
+		rules = append(rules, serviceRules...)
+	}
+
+	return packSecurityRules(rules), nil
+}
+
+// packSecurityRules packs the rules in two steps: the destination ports of each destination IP are merged first,
+// then the destination IPs with the same destination ports are merged into one rule.
+func packSecurityRules(rules []network.SecurityRule) []network.SecurityRule {
+	type ipKey struct {
+		access, direction, protocol, source, ip string
+	}
+	portsByIP := make(map[ipKey]sets.Int)
+	for _, rule := range rules {
+		if rule.SecurityRulePropertiesFormat == nil {
+			continue
+		}
+		port, err := strconv.Atoi(pointer.StringDeref(rule.DestinationPortRange, ""))
+		if err != nil {
+			klog.Warningf("packSecurityRules: skipping rule %s with destination port range %q", pointer.StringDeref(rule.Name, ""), pointer.StringDeref(rule.DestinationPortRange, ""))
+			continue
+		}
+		for _, ip := range *collectionOrSingle(rule.DestinationAddressPrefixes, rule.DestinationAddressPrefix) {
+			key := ipKey{
+				access:    string(rule.Access),
+				direction: string(rule.Direction),
+				protocol:  string(rule.Protocol),
+				source:    pointer.StringDeref(rule.SourceAddressPrefix, ""),
+				ip:        ip,
+			}
+			if portsByIP[key] == nil {
+				portsByIP[key] = sets.NewInt()
+			}
+			portsByIP[key].Insert(port)
+		}
+	}
+
+	type ruleKey struct {
+		access, direction, protocol, source, ipFamily, portRanges string
+	}
+	ipsByRule := make(map[ruleKey]sets.String)
+	for key, ports := range portsByIP {
+		ipFamily := string(v1.IPv4Protocol)
+		if utilnet.IsIPv6String(key.ip) {
+			ipFamily = string(v1.IPv6Protocol)
+		}
+		rk := ruleKey{
+			access:     key.access,
+			direction:  key.direction,
+			protocol:   key.protocol,
+			source:     key.source,
+			ipFamily:   ipFamily,
+			portRanges: strings.Join(getPortRanges(ports.List()), ","),
+		}
+		if ipsByRule[rk] == nil {
+			ipsByRule[rk] = sets.NewString()
+		}
+		ipsByRule[rk].Insert(key.ip)
+	}
+
+	packedRules := make([]network.SecurityRule, 0, len(ipsByRule))
+	for key, ips := range ipsByRule {
+		hash := MakeCRC32(strings.ToLower(strings.Join([]string{key.access, key.direction, key.protocol, key.source, key.ipFamily, key.portRanges}, "/")))
+		portRanges := strings.Split(key.portRanges, ",")
+		destinationIPAddresses := ips.List()
+		packedRules = append(packedRules, network.SecurityRule{
+			Name: pointer.String(consts.ConsolidatedSecurityRulePrefix + hash),
+			SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+				Protocol:                   network.SecurityRuleProtocol(key.protocol),
+				SourcePortRange:            pointer.String("*"),
+				SourceAddressPrefix:        pointer.String(key.source),
+				DestinationPortRanges:      &portRanges,
+				DestinationAddressPrefixes: &destinationIPAddresses,
+				Access:                     network.SecurityRuleAccess(key.access),
+				Direction:                  network.SecurityRuleDirection(key.direction),
+			},
+		})
+	}
+	sort.Slice(packedRules, func(i, j int) bool {
+		return *packedRules[i].Name < *packedRules[j].Name
+	})
+	return packedRules
+}
+
+// getPortRanges merges the sorted ports into port ranges, e.g. [80, 81, 82, 443] to ["80-82", "443"].
+func getPortRanges(ports []int) []string {
+	var portRanges []string
+	for i := 0; i < len(ports); {
+		j := i
+		for j+1 < len(ports) && ports[j+1] == ports[j]+1 {
+			j++
+		}
+		if i == j {
+			portRanges = append(portRanges, strconv.Itoa(ports[i]))
+		} else {
+			portRanges = append(portRanges, fmt.Sprintf("%d-%d", ports[i], ports[j]))
+		}
+		i = j + 1
+	}
+	return portRanges
+}
+
+// reconcileConsolidatedSecurityRules replaces the consolidated rules in the security group by the packed rules.
+// The priorities of the existing rules are kept. The new allow rules take the lowest available priorities and the
+// new deny rules take the highest ones, so that the deny rules are evaluated after all the allow rules.
+func reconcileConsolidatedSecurityRules(rules []network.SecurityRule, packedRules []network.SecurityRule) ([]network.SecurityRule, bool, error) {
+	expected := make(map[string]network.SecurityRule, len(packedRules))
+	for _, rule := range packedRules {
+		expected[strings.ToLower(*rule.Name)] = rule
+	}
+
+	var changed bool
+	existing := sets.NewString()
+	for i := len(rules) - 1; i >= 0; i-- {
+		if !isConsolidatedSecurityRule(rules[i]) {
+			continue
+		}
+		name := strings.ToLower(pointer.StringDeref(rules[i].Name, ""))
+		packedRule, found := expected[name]
+		if !found {
+			klog.V(2).Infof("reconcileConsolidatedSecurityRules: sg rule(%s) - dropping", pointer.StringDeref(rules[i].Name, ""))
+			rules = append(rules[:i], rules[i+1:]...)
+			changed = true
+			continue
+		}
+		existing.Insert(name)
+		if !sets.NewString(stringSlice(rules[i].DestinationAddressPrefixes)...).Equal(sets.NewString(stringSlice(packedRule.DestinationAddressPrefixes)...)) {
+			klog.V(2).Infof("reconcileConsolidatedSecurityRules: sg rule(%s) - updating with %d destination IPs", *packedRule.Name, len(stringSlice(packedRule.DestinationAddressPrefixes)))
+			packedRule.Priority = rules[i].Priority
+			rules[i] = packedRule
+			changed = true
+		}
+	}
+
+	for _, packedRule := range packedRules {
+		if existing.Has(strings.ToLower(*packedRule.Name)) {
+			continue
+		}
+		var priority int32
+		var err error
+		if packedRule.Access == network.SecurityRuleAccessDeny {
+			priority, err = getLastAvailablePriority(rules)
+		} else {
+			priority, err = getNextAvailablePriority(rules)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		klog.V(2).Infof("reconcileConsolidatedSecurityRules: sg rule(%s) - adding with priority %d", *packedRule.Name, priority)
+		packedRule.Priority = pointer.Int32(priority)
+		rules = append(rules, packedRule)
+		changed = true
+	}
+	return rules, changed, nil
+}
+
+// removeIPsFromConsolidatedSecurityRules removes the destination IPs of the service from the consolidated rules
+// after the consolidation is disabled, since the service has got its own rules again.
+func removeIPsFromConsolidatedSecurityRules(rules []network.SecurityRule, destinationIPAddresses []string) ([]network.SecurityRule, bool) {
+	ips := sets.NewString(destinationIPAddresses...)
+	var changed bool
+	for i := len(rules) - 1; i >= 0; i-- {
+		if !isConsolidatedSecurityRule(rules[i]) || rules[i].DestinationAddressPrefixes == nil {
+			continue
+		}
+		var remaining []string
+		for _, ip := range *rules[i].DestinationAddressPrefixes {
+			if !ips.Has(ip) {
+				remaining = append(remaining, ip)
+			}
+		}
+		if len(remaining) == len(*rules[i].DestinationAddressPrefixes) {
+			continue
+		}
+		changed = true
+		if len(remaining) == 0 {
+			klog.V(2).Infof("removeIPsFromConsolidatedSecurityRules: sg rule(%s) - dropping", pointer.StringDeref(rules[i].Name, ""))
+			rules = append(rules[:i], rules[i+1:]...)
+			continue
+		}
+		rule := rules[i]
+		props := *rule.SecurityRulePropertiesFormat
+		props.DestinationAddressPrefixes = &remaining
+		rule.SecurityRulePropertiesFormat = &props
+		rules[i] = rule
+	}
+	return rules, changed
+}
+
+// getLastAvailablePriority returns the highest priority number which is not used by the rules.
+func getLastAvailablePriority(rules []network.SecurityRule) (int32, error) {
+	used := sets.NewInt32()
+	for _, rule := range rules {
+		if rule.SecurityRulePropertiesFormat != nil && rule.Priority != nil {
+			used.Insert(*rule.Priority)
+		}
+	}
+	for priority := int32(consts.LoadBalancerMaximumPriority - 1); priority >= consts.LoadBalancerMinimumPriority; priority-- {
+		if !used.Has(priority) {
+			return priority, nil
+		}
+	}
+	return -1, fmt.Errorf("securityGroup priorities are exhausted")
+}
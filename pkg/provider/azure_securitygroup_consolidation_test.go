@@ -0,0 +1,223 @@
+/*
+Copyright 2022 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2022-07-01/network"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	v1 "k8s.io/api/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/cloud-provider-azure/pkg/azureclients/securitygroupclient/mocksecuritygroupclient"
+	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
+)
+
+func getTestConsolidatedRuleName(key string) string {
+	return consts.ConsolidatedSecurityRulePrefix + MakeCRC32(key)
+}
+
+func getTestConsolidatedRule(key, source string, access network.SecurityRuleAccess, ports, ips []string, priority int32) network.SecurityRule {
+	return network.SecurityRule{
+		Name: pointer.String(getTestConsolidatedRuleName(key)),
+		SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+			Protocol:                   network.SecurityRuleProtocolTCP,
+			SourcePortRange:            pointer.String("*"),
+			SourceAddressPrefix:        pointer.String(source),
+			DestinationPortRanges:      &ports,
+			DestinationAddressPrefixes: &ips,
+			Access:                     access,
+			Direction:                  network.SecurityRuleDirectionInbound,
+			Priority:                   pointer.Int32(priority),
+		},
+	}
+}
+
+func getTestServiceSecurityRule(name, source, ip, port string) network.SecurityRule {
+	return network.SecurityRule{
+		Name: pointer.String(name),
+		SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+			Protocol:                 network.SecurityRuleProtocolTCP,
+			SourcePortRange:          pointer.String("*"),
+			SourceAddressPrefix:      pointer.String(source),
+			DestinationPortRange:     pointer.String(port),
+			DestinationAddressPrefix: pointer.String(ip),
+			Access:                   network.SecurityRuleAccessAllow,
+			Direction:                network.SecurityRuleDirectionInbound,
+		},
+	}
+}
+
+func TestPackSecurityRules(t *testing.T) {
+	rules := []network.SecurityRule{
+		getTestServiceSecurityRule("asvc1-TCP-80-Internet", "Internet", "1.1.1.1", "80"),
+		getTestServiceSecurityRule("asvc1-TCP-443-Internet", "Internet", "1.1.1.1", "443"),
+		getTestServiceSecurityRule("asvc2-TCP-80-Internet", "Internet", "2.2.2.2", "80"),
+		getTestServiceSecurityRule("asvc2-TCP-443-Internet", "Internet", "2.2.2.2", "443"),
+		getTestServiceSecurityRule("asvc3-TCP-8080-Internet", "Internet", "fd00::1", "8080"),
+		getTestServiceSecurityRule("asvc3-TCP-8081-Internet", "Internet", "fd00::1", "8081"),
+		getTestServiceSecurityRule("asvc4-TCP-80-10.0.0.0_8", "10.0.0.0/8", "3.3.3.3", "80"),
+	}
+	rules[1].DestinationAddressPrefix = nil
+	rules[1].DestinationAddressPrefixes = &[]string{"1.1.1.1", "4.4.4.4"}
+	denyRule := getTestServiceSecurityRule("asvc4-TCP-80-deny_all", "*", "3.3.3.3", "80")
+	denyRule.Access = network.SecurityRuleAccessDeny
+	rules = append(rules, denyRule)
+
+	packedRules := packSecurityRules(rules)
+	for i := range packedRules {
+		packedRules[i].Priority = pointer.Int32(0)
+	}
+	assert.ElementsMatch(t, []network.SecurityRule{
+		getTestConsolidatedRule("allow/inbound/tcp/internet/ipv4/80,443", "Internet", network.SecurityRuleAccessAllow, []string{"80", "443"}, []string{"1.1.1.1", "2.2.2.2"}, 0),
+		getTestConsolidatedRule("allow/inbound/tcp/internet/ipv4/443", "Internet", network.SecurityRuleAccessAllow, []string{"443"}, []string{"4.4.4.4"}, 0),
+		getTestConsolidatedRule("allow/inbound/tcp/internet/ipv6/8080-8081", "Internet", network.SecurityRuleAccessAllow, []string{"8080-8081"}, []string{"fd00::1"}, 0),
+		getTestConsolidatedRule("allow/inbound/tcp/10.0.0.0/8/ipv4/80", "10.0.0.0/8", network.SecurityRuleAccessAllow, []string{"80"}, []string{"3.3.3.3"}, 0),
+		getTestConsolidatedRule("deny/inbound/tcp/*/ipv4/80", "*", network.SecurityRuleAccessDeny, []string{"80"}, []string{"3.3.3.3"}, 0),
+	}, packedRules)
+}
+
+func TestGetPortRanges(t *testing.T) {
+	assert.Nil(t, getPortRanges(nil))
+	assert.Equal(t, []string{"80"}, getPortRanges([]int{80}))
+	assert.Equal(t, []string{"80-82", "443", "8080-8081"}, getPortRanges([]int{80, 81, 82, 443, 8080, 8081}))
+}
+
+func TestReconcileConsolidatedSecurityRules(t *testing.T) {
+	serviceRule := getTestServiceSecurityRule("asvc5-TCP-22-Internet", "Internet", "5.5.5.5", "22")
+	serviceRule.Priority = pointer.Int32(500)
+	existingRules := []network.SecurityRule{
+		serviceRule,
+		getTestConsolidatedRule("stale", "Internet", network.SecurityRuleAccessAllow, []string{"8080"}, []string{"1.1.1.1"}, 501),
+		getTestConsolidatedRule("updated", "Internet", network.SecurityRuleAccessAllow, []string{"80"}, []string{"1.1.1.1"}, 502),
+		getTestConsolidatedRule("unchanged", "Internet", network.SecurityRuleAccessAllow, []string{"443"}, []string{"1.1.1.1"}, 503),
+	}
+	packedRules := []network.SecurityRule{
+		getTestConsolidatedRule("updated", "Internet", network.SecurityRuleAccessAllow, []string{"80"}, []string{"1.1.1.1", "2.2.2.2"}, 0),
+		getTestConsolidatedRule("unchanged", "Internet", network.SecurityRuleAccessAllow, []string{"443"}, []string{"1.1.1.1"}, 0),
+		getTestConsolidatedRule("new", "Internet", network.SecurityRuleAccessAllow, []string{"81"}, []string{"3.3.3.3"}, 0),
+		getTestConsolidatedRule("deny", "*", network.SecurityRuleAccessDeny, []string{"81"}, []string{"3.3.3.3"}, 0),
+	}
+	for i := range packedRules {
+		packedRules[i].Priority = nil
+	}
+
+	rules, changed, err := reconcileConsolidatedSecurityRules(existingRules, packedRules)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, []network.SecurityRule{
+		serviceRule,
+		getTestConsolidatedRule("updated", "Internet", network.SecurityRuleAccessAllow, []string{"80"}, []string{"1.1.1.1", "2.2.2.2"}, 502),
+		getTestConsolidatedRule("unchanged", "Internet", network.SecurityRuleAccessAllow, []string{"443"}, []string{"1.1.1.1"}, 503),
+		getTestConsolidatedRule("new", "Internet", network.SecurityRuleAccessAllow, []string{"81"}, []string{"3.3.3.3"}, 501),
+		getTestConsolidatedRule("deny", "*", network.SecurityRuleAccessDeny, []string{"81"}, []string{"3.3.3.3"}, 4095),
+	}, rules)
+
+	_, changed, err = reconcileConsolidatedSecurityRules(rules, packedRules)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
+
+func TestRemoveIPsFromConsolidatedSecurityRules(t *testing.T) {
+	serviceRule := getTestServiceSecurityRule("asvc1-TCP-80-Internet", "Internet", "1.1.1.1", "80")
+	rules := []network.SecurityRule{
+		serviceRule,
+		getTestConsolidatedRule("shared", "Internet", network.SecurityRuleAccessAllow, []string{"80"}, []string{"1.1.1.1", "2.2.2.2"}, 501),
+		getTestConsolidatedRule("owned", "Internet", network.SecurityRuleAccessAllow, []string{"443"}, []string{"1.1.1.1"}, 502),
+		getTestConsolidatedRule("other", "Internet", network.SecurityRuleAccessAllow, []string{"22"}, []string{"3.3.3.3"}, 503),
+	}
+
+	rules, changed := removeIPsFromConsolidatedSecurityRules(rules, []string{"1.1.1.1"})
+	assert.True(t, changed)
+	assert.Equal(t, []network.SecurityRule{
+		serviceRule,
+		getTestConsolidatedRule("shared", "Internet", network.SecurityRuleAccessAllow, []string{"80"}, []string{"2.2.2.2"}, 501),
+		getTestConsolidatedRule("other", "Internet", network.SecurityRuleAccessAllow, []string{"22"}, []string{"3.3.3.3"}, 503),
+	}, rules)
+
+	_, changed = removeIPsFromConsolidatedSecurityRules(rules, []string{"1.1.1.1"})
+	assert.False(t, changed)
+}
+
+func TestReconcileSecurityGroupWithConsolidation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.EnableSecurityRuleConsolidation = true
+	service := getTestService("svc1", v1.ProtocolTCP, nil, false, 80)
+	otherService := getTestService("svc2", v1.ProtocolTCP, nil, false, 80, 443)
+	otherService.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: "2.2.2.2"}}
+	sharedService := getTestService("svc3", v1.ProtocolTCP, map[string]string{consts.ServiceAnnotationSharedSecurityRule: "true"}, false, 80)
+	sharedService.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{IP: "3.3.3.3"}}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, svc := range []v1.Service{service, otherService, sharedService} {
+		svc := svc
+		assert.NoError(t, indexer.Add(&svc))
+	}
+	az.serviceLister = corelisters.NewServiceLister(indexer)
+
+	oldRule := getTestServiceSecurityRule("asvc1-TCP-80-Internet", "Internet", "1.1.1.1", "80")
+	oldRule.Priority = pointer.Int32(500)
+	existingSg := network.SecurityGroup{
+		Name: pointer.String("nsg"),
+		SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+			SecurityRules: &[]network.SecurityRule{oldRule},
+		},
+	}
+	mockSGClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	mockSGClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, "nsg", gomock.Any()).Return(existingSg, nil)
+	mockSGClient.EXPECT().CreateOrUpdate(gomock.Any(), az.ResourceGroup, "nsg", gomock.Any(), gomock.Any()).Return(nil)
+
+	sg, err := az.reconcileSecurityGroup(testClusterName, &service, pointer.String("1.1.1.1"), nil, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []network.SecurityRule{
+		getTestConsolidatedRule("allow/inbound/tcp/internet/ipv4/80,443", "Internet", network.SecurityRuleAccessAllow, []string{"80", "443"}, []string{"2.2.2.2"}, 500),
+		getTestConsolidatedRule("allow/inbound/tcp/internet/ipv4/80", "Internet", network.SecurityRuleAccessAllow, []string{"80"}, []string{"1.1.1.1"}, 501),
+	}, *sg.SecurityRules)
+}
+
+func TestReconcileSecurityGroupRuleLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	az := GetTestCloud(ctrl)
+	az.SecurityGroupRuleLimit = 2
+	recorder := record.NewFakeRecorder(10)
+	az.eventRecorder = recorder
+	service := getTestService("svc1", v1.ProtocolTCP, nil, false, 80, 443, 8080)
+	existingSg := network.SecurityGroup{
+		Name: pointer.String("nsg"),
+		SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+			SecurityRules: &[]network.SecurityRule{},
+		},
+	}
+	mockSGClient := az.SecurityGroupsClient.(*mocksecuritygroupclient.MockInterface)
+	mockSGClient.EXPECT().Get(gomock.Any(), az.ResourceGroup, "nsg", gomock.Any()).Return(existingSg, nil)
+	mockSGClient.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	_, err := az.reconcileSecurityGroup(testClusterName, &service, pointer.String("1.1.1.1"), nil, true)
+	assert.EqualError(t, err, "reconcileSecurityGroup for service(default/svc1): sg(nsg) - refusing to update the security group with 3 rules, which exceeds the limit of 2 rules")
+	assert.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Warning SecurityGroupRuleLimitExceeded")
+}
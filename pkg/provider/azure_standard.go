@@ -44,6 +44,7 @@ import (
 
 	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
 	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+	"sigs.k8s.io/cloud-provider-azure/pkg/nodemanager/metadata"
 )
 
 var (
@@ -85,6 +86,15 @@ func (az *Cloud) getBackendPoolID(lbName, rgName, backendPoolName string) string
 		backendPoolName)
 }
 
+// returns the full identifier of the virtual network of the cluster.
+func (az *Cloud) getVirtualNetworkID() string {
+	vnetResourceGroup := az.ResourceGroup
+	if len(az.VnetResourceGroup) > 0 {
+		vnetResourceGroup = az.VnetResourceGroup
+	}
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/virtualNetworks/%s", az.SubscriptionID, vnetResourceGroup, az.VnetName)
+}
+
 // returns the full identifier of a loadbalancer probe.
 func (az *Cloud) getLoadBalancerProbeID(lbName, rgName, lbRuleName string) string {
 	return fmt.Sprintf(
@@ -95,6 +105,44 @@ func (az *Cloud) getLoadBalancerProbeID(lbName, rgName, lbRuleName string) strin
 		lbRuleName)
 }
 
+// returns the full identifier of a public IP address.
+func (az *Cloud) getPublicIPAddressID(rgName, pipName string) string {
+	return fmt.Sprintf(
+		consts.PublicIPAddressIDTemplate,
+		az.getNetworkResourceSubscriptionID(),
+		rgName,
+		pipName)
+}
+
+// returns the full identifier of an application gateway.
+func (az *Cloud) getApplicationGatewayID(gwName string) string {
+	return fmt.Sprintf(
+		consts.ApplicationGatewayIDTemplate,
+		az.getNetworkResourceSubscriptionID(),
+		az.ApplicationGatewayResourceGroup,
+		gwName)
+}
+
+// returns the full identifier of a NAT gateway.
+func (az *Cloud) getNatGatewayID(rgName, natGatewayName string) string {
+	return fmt.Sprintf(
+		consts.NatGatewayIDTemplate,
+		az.getNetworkResourceSubscriptionID(),
+		rgName,
+		natGatewayName)
+}
+
+// returns the full identifier of a child resource of an application gateway, e.g. a listener or a probe.
+func (az *Cloud) getApplicationGatewayChildID(gwName, childType, childName string) string {
+	return fmt.Sprintf(
+		consts.ApplicationGatewayChildIDTemplate,
+		az.getNetworkResourceSubscriptionID(),
+		az.ApplicationGatewayResourceGroup,
+		gwName,
+		childType,
+		childName)
+}
+
 // getNetworkResourceSubscriptionID returns the subscription id which hosts network resources
 func (az *Cloud) getNetworkResourceSubscriptionID() string {
 	if az.Config.UsesNetworkResourceInDifferentSubscription() {
@@ -270,6 +318,21 @@ func getBackendPoolName(clusterName string, service *v1.Service) string {
 	return clusterName
 }
 
+// getServiceBackendPoolName returns the name of the backend pool the rules of the service point to. The podIP
+// backend pools are dedicated to each service since they contain its pods, and are named <clusterName>-<rulePrefix>
+// with the same -IPv6 suffix as the shared ones.
+func (az *Cloud) getServiceBackendPoolName(clusterName string, service *v1.Service) string {
+	if !az.isLBBackendPoolTypePodIP() {
+		return getBackendPoolName(clusterName, service)
+	}
+
+	name := fmt.Sprintf("%s-%s", clusterName, az.getRulePrefix(service))
+	if utilnet.IsIPv6String(service.Spec.ClusterIP) {
+		return fmt.Sprintf("%v-IPv6", name)
+	}
+	return name
+}
+
 func (az *Cloud) getLoadBalancerRuleName(service *v1.Service, protocol v1.Protocol, port int32) string {
 	prefix := az.getRulePrefix(service)
 	ruleName := fmt.Sprintf("%s-%s-%d", prefix, protocol, port)
@@ -541,13 +604,7 @@ func (as *availabilitySet) GetPowerStatusByNodeName(name string) (powerState str
 	}
 
 	if vm.InstanceView != nil && vm.InstanceView.Statuses != nil {
-		statuses := *vm.InstanceView.Statuses
-		for _, status := range statuses {
-			state := pointer.StringDeref(status.Code, "")
-			if strings.HasPrefix(state, vmPowerStatePrefix) {
-				return strings.TrimPrefix(state, vmPowerStatePrefix), nil
-			}
-		}
+		return getPowerStateFromStatuses(*vm.InstanceView.Statuses), nil
 	}
 
 	// vm.InstanceView or vm.InstanceView.Statuses are nil when the VM is under deleting.
@@ -594,6 +651,23 @@ func (as *availabilitySet) GetInstanceTypeByNodeName(name string) (string, error
 	return string(machine.HardwareProfile.VMSize), nil
 }
 
+// GetNodeMetadataByNodeName gets the Azure metadata synced into the node labels and taints by node name.
+func (as *availabilitySet) GetNodeMetadataByNodeName(name string) (*metadata.NodeMetadata, error) {
+	vm, err := as.getVirtualMachine(types.NodeName(name), azcache.CacheReadTypeUnsafe)
+	if err != nil {
+		klog.Errorf("as.GetNodeMetadataByNodeName(%s) failed: as.getVirtualMachine(%s) err=%v", name, name, err)
+		return nil, err
+	}
+
+	nic, err := as.GetPrimaryInterface(name)
+	if err != nil {
+		return nil, err
+	}
+	nodeMetadata := getNodeMetadataFromVM(&vm, nil)
+	setNodeAcceleratedNetworking(nodeMetadata, nic)
+	return nodeMetadata, nil
+}
+
 // GetZoneByNodeName gets availability zone for the specified node. If the node is not running
 // with availability zone, then it returns fault domain.
 // for details, refer to https://kubernetes-sigs.github.io/cloud-provider-azure/topics/availability-zones/#node-labels
@@ -1038,6 +1112,143 @@ func (as *availabilitySet) EnsureHostsInPool(service *v1.Service, nodes []*v1.No
 	return nil
 }
 
+// EnsureApplicationSecurityGroupMembers ensures the primary IP configurations of the given members are in the
+// specified application security group, and the IP configurations of the given non-member nodes are not.
+func (as *availabilitySet) EnsureApplicationSecurityGroupMembers(service *v1.Service, members []*v1.Node, nonMembers []string, asgID string) error {
+	mc := metrics.NewMetricContext("services", "vmas_ensure_application_security_group_members", as.ResourceGroup, as.SubscriptionID, getServiceName(service))
+	isOperationSucceeded := false
+	defer func() {
+		mc.ObserveOperationWithResult(isOperationSucceeded)
+	}()
+
+	errs := utilerrors.AggregateGoroutines(getInterfaceApplicationSecurityGroupUpdates(as.Cloud, as.GetPrimaryInterface, service, members, nonMembers, asgID)...)
+	if errs != nil {
+		return utilerrors.Flatten(errs)
+	}
+
+	isOperationSucceeded = true
+	return nil
+}
+
+// getInterfaceApplicationSecurityGroupUpdates returns the functions updating the primary NICs of the nodes, which
+// add the members to the application security group and remove the non-member nodes from it.
+func getInterfaceApplicationSecurityGroupUpdates(az *Cloud, getPrimaryInterface func(nodeName string) (network.Interface, error), service *v1.Service, members []*v1.Node, nonMembers []string, asgID string) []func() error {
+	nodeNames := make(map[string]bool, len(members)+len(nonMembers))
+	for _, node := range members {
+		nodeNames[node.Name] = true
+	}
+	for _, nodeName := range nonMembers {
+		nodeNames[nodeName] = false
+	}
+
+	hostUpdates := make([]func() error, 0, len(nodeNames))
+	for nodeName, wantMember := range nodeNames {
+		localNodeName, localWantMember := nodeName, wantMember
+		f := func() error {
+			nic, err := getPrimaryInterface(localNodeName)
+			if err != nil {
+				if errors.Is(err, cloudprovider.InstanceNotFound) {
+					klog.Infof("EnsureApplicationSecurityGroupMembers: skipping node %s because it is not found", localNodeName)
+					return nil
+				}
+				return fmt.Errorf("ensure(%s): asg(%s) - failed to get the primary interface of node %s: %w", getServiceName(service), asgID, localNodeName, err)
+			}
+			return az.ensureInterfaceInApplicationSecurityGroup(service, nic, asgID, localWantMember)
+		}
+		hostUpdates = append(hostUpdates, f)
+	}
+	return hostUpdates
+}
+
+// ensureInterfaceInApplicationSecurityGroup adds the IP configuration of the NIC matching the IP family of the
+// service to the application security group if wantMember is true, otherwise it removes all the IP configurations
+// of the NIC from the application security group. The NIC is only updated if it is changed.
+func (az *Cloud) ensureInterfaceInApplicationSecurityGroup(service *v1.Service, nic network.Interface, asgID string, wantMember bool) error {
+	nicName := pointer.StringDeref(nic.Name, "")
+	if nic.ProvisioningState == consts.NicFailedState {
+		klog.Warningf("ensureInterfaceInApplicationSecurityGroup skips nic %s because it is in Failed state", nicName)
+		return nil
+	}
+
+	if !wantMember {
+		if nic.InterfacePropertiesFormat == nil || nic.IPConfigurations == nil {
+			return nil
+		}
+		var removed bool
+		for i := range *nic.IPConfigurations {
+			if asgs, ok := removeApplicationSecurityGroup((*nic.IPConfigurations)[i].ApplicationSecurityGroups, asgID); ok {
+				(*nic.IPConfigurations)[i].ApplicationSecurityGroups = asgs
+				removed = true
+			}
+		}
+		if !removed {
+			return nil
+		}
+		klog.V(3).Infof("nicupdate(%s): nic(%s) - removing from asg(%s)", getServiceName(service), nicName, asgID)
+		return az.CreateOrUpdateInterface(service, nic)
+	}
+
+	var ipConfig *network.InterfaceIPConfiguration
+	var err error
+	ipv6 := utilnet.IsIPv6String(service.Spec.ClusterIP)
+	if !az.ipv6DualStackEnabled && !ipv6 {
+		ipConfig, err = getPrimaryIPConfig(nic)
+	} else {
+		ipConfig, err = getIPConfigByIPFamily(nic, ipv6)
+	}
+	if err != nil {
+		return err
+	}
+
+	asgs, added := addApplicationSecurityGroup(ipConfig.ApplicationSecurityGroups, asgID)
+	if !added {
+		return nil
+	}
+	// the IP configuration may be a copy, so it is looked up by name before being updated.
+	for i := range *nic.IPConfigurations {
+		if strings.EqualFold(pointer.StringDeref((*nic.IPConfigurations)[i].Name, ""), pointer.StringDeref(ipConfig.Name, "")) {
+			(*nic.IPConfigurations)[i].ApplicationSecurityGroups = asgs
+		}
+	}
+
+	klog.V(3).Infof("nicupdate(%s): nic(%s) - adding to asg(%s)", getServiceName(service), nicName, asgID)
+	return az.CreateOrUpdateInterface(service, nic)
+}
+
+// addApplicationSecurityGroup appends the application security group to the given ones,
+// and returns false if it has already been there.
+func addApplicationSecurityGroup(asgs *[]network.ApplicationSecurityGroup, asgID string) (*[]network.ApplicationSecurityGroup, bool) {
+	newASGs := []network.ApplicationSecurityGroup{}
+	if asgs != nil {
+		newASGs = *asgs
+	}
+	for _, asg := range newASGs {
+		if strings.EqualFold(pointer.StringDeref(asg.ID, ""), asgID) {
+			return asgs, false
+		}
+	}
+	newASGs = append(newASGs, network.ApplicationSecurityGroup{ID: pointer.String(asgID)})
+	return &newASGs, true
+}
+
+// removeApplicationSecurityGroup removes the application security group from the given ones,
+// and returns false if it is not there.
+func removeApplicationSecurityGroup(asgs *[]network.ApplicationSecurityGroup, asgID string) (*[]network.ApplicationSecurityGroup, bool) {
+	if asgs == nil {
+		return asgs, false
+	}
+	newASGs := make([]network.ApplicationSecurityGroup, 0, len(*asgs))
+	for _, asg := range *asgs {
+		if !strings.EqualFold(pointer.StringDeref(asg.ID, ""), asgID) {
+			newASGs = append(newASGs, asg)
+		}
+	}
+	if len(newASGs) == len(*asgs) {
+		return asgs, false
+	}
+	return &newASGs, true
+}
+
 // EnsureBackendPoolDeleted ensures the loadBalancer backendAddressPools deleted from the specified nodes.
 func (as *availabilitySet) EnsureBackendPoolDeleted(service *v1.Service, backendPoolID, vmSetName string, backendAddressPools *[]network.BackendAddressPool, deleteFromVMSet bool) (bool, error) {
 	// Returns nil if backend address pools already deleted.
@@ -1096,7 +1307,8 @@ func (as *availabilitySet) EnsureBackendPoolDeleted(service *v1.Service, backend
 			return false, fmt.Errorf("EnsureBackendPoolDeleted: failed to parse the VMAS ID %s: %w", vmasID, err)
 		}
 		// Only remove nodes belonging to specified vmSet to basic LB backends.
-		if !strings.EqualFold(vmasName, vmSetName) {
+		// An empty vmSet means the nodes are selected by the load balancer profiles.
+		if vmSetName != "" && !strings.EqualFold(vmasName, vmSetName) {
 			klog.V(2).Infof("EnsureBackendPoolDeleted: skipping the node %s belonging to another vm set %s", nodeName, vmasName)
 			continue
 		}
@@ -1625,6 +1625,78 @@ func TestStandardEnsureHostsInPool(t *testing.T) {
 	}
 }
 
+func TestStandardEnsureApplicationSecurityGroupMembers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	asgID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/applicationSecurityGroups/kubernetes-asg"
+	nicID := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/nic1"
+	nodes := []*v1.Node{{ObjectMeta: meta.ObjectMeta{Name: "vm1"}}}
+
+	testCases := []struct {
+		desc              string
+		nonMember         bool
+		existingASGs      []network.ApplicationSecurityGroup
+		expectedASGs      *[]network.ApplicationSecurityGroup
+		expectedNICUpdate bool
+	}{
+		{
+			desc:              "should add the primary IP configuration to the application security group",
+			expectedASGs:      &[]network.ApplicationSecurityGroup{{ID: pointer.String(asgID)}},
+			expectedNICUpdate: true,
+		},
+		{
+			desc:         "should not update the nic if it is already a member of the application security group",
+			existingASGs: []network.ApplicationSecurityGroup{{ID: pointer.String(asgID)}},
+		},
+		{
+			desc:              "should remove the IP configuration of the non-member from the application security group",
+			nonMember:         true,
+			existingASGs:      []network.ApplicationSecurityGroup{{ID: pointer.String("other-asg")}, {ID: pointer.String(asgID)}},
+			expectedASGs:      &[]network.ApplicationSecurityGroup{{ID: pointer.String("other-asg")}},
+			expectedNICUpdate: true,
+		},
+		{
+			desc:         "should not update the nic of the non-member if it is not in the application security group",
+			nonMember:    true,
+			existingASGs: []network.ApplicationSecurityGroup{{ID: pointer.String("other-asg")}},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.desc, func(t *testing.T) {
+			cloud := GetTestCloud(ctrl)
+			testVM := buildDefaultTestVirtualMachine(asID, []string{nicID})
+			testNIC := buildDefaultTestInterface(true, nil)
+			testNIC.Name = pointer.String("nic1")
+			testNIC.ID = pointer.String(nicID)
+			if test.existingASGs != nil {
+				(*testNIC.IPConfigurations)[0].ApplicationSecurityGroups = &test.existingASGs
+			}
+
+			mockVMClient := cloud.VirtualMachinesClient.(*mockvmclient.MockInterface)
+			mockVMClient.EXPECT().Get(gomock.Any(), cloud.ResourceGroup, "vm1", gomock.Any()).Return(testVM, nil)
+			mockInterfaceClient := cloud.InterfacesClient.(*mockinterfaceclient.MockInterface)
+			mockInterfaceClient.EXPECT().Get(gomock.Any(), cloud.ResourceGroup, "nic1", gomock.Any()).Return(testNIC, nil)
+			if test.expectedNICUpdate {
+				mockInterfaceClient.EXPECT().CreateOrUpdate(gomock.Any(), cloud.ResourceGroup, "nic1", gomock.Any()).DoAndReturn(
+					func(_ interface{}, _, _ string, nic network.Interface) *retry.Error {
+						assert.Equal(t, test.expectedASGs, (*nic.IPConfigurations)[0].ApplicationSecurityGroups)
+						return nil
+					})
+			}
+
+			var err error
+			if test.nonMember {
+				err = cloud.VMSet.EnsureApplicationSecurityGroupMembers(&v1.Service{}, nil, []string{"vm1"}, asgID)
+			} else {
+				err = cloud.VMSet.EnsureApplicationSecurityGroupMembers(&v1.Service{}, nodes, nil, asgID)
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
 func TestServiceOwnsFrontendIP(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -28,6 +28,7 @@ import (
 	cloudprovider "k8s.io/cloud-provider"
 
 	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
+	"sigs.k8s.io/cloud-provider-azure/pkg/nodemanager/metadata"
 )
 
 //go:generate sh -c "mockgen -destination=$GOPATH/src/sigs.k8s.io/cloud-provider-azure/pkg/provider/azure_mock_vmsets.go -source=$GOPATH/src/sigs.k8s.io/cloud-provider-azure/pkg/provider/azure_vmsets.go -package=provider VMSet"
@@ -53,6 +54,9 @@ type VMSet interface {
 	// GetZoneByNodeName gets cloudprovider.Zone by node name.
 	GetZoneByNodeName(name string) (cloudprovider.Zone, error)
 
+	// GetNodeMetadataByNodeName gets the Azure metadata synced into the node labels and taints by node name.
+	GetNodeMetadataByNodeName(name string) (*metadata.NodeMetadata, error)
+
 	// GetPrimaryVMSetName returns the VM set name depending on the configured vmType.
 	// It returns config.PrimaryScaleSetName for vmss and config.PrimaryAvailabilitySetName for standard vmType.
 	GetPrimaryVMSetName() string
@@ -70,6 +74,9 @@ type VMSet interface {
 	// EnsureHostInPool ensures the given VM's Primary NIC's Primary IP Configuration is
 	// participating in the specified LoadBalancer Backend Pool.
 	EnsureHostInPool(service *v1.Service, nodeName types.NodeName, backendPoolID string, vmSetName string) (string, string, string, *compute.VirtualMachineScaleSetVM, error)
+	// EnsureApplicationSecurityGroupMembers ensures the primary IP configurations of the given members are in the
+	// specified application security group, and the IP configurations of the given non-member nodes are not.
+	EnsureApplicationSecurityGroupMembers(service *v1.Service, members []*v1.Node, nonMembers []string, asgID string) error
 	// EnsureBackendPoolDeleted ensures the loadBalancer backendAddressPools deleted from the specified nodes.
 	EnsureBackendPoolDeleted(service *v1.Service, backendPoolID, vmSetName string, backendAddressPools *[]network.BackendAddressPool, deleteFromVMSet bool) (bool, error)
 	//EnsureBackendPoolDeletedFromVMSets ensures the loadBalancer backendAddressPools deleted from the specified VMSS/VMAS
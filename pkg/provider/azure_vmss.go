@@ -39,6 +39,7 @@ import (
 	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
 	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
 	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+	"sigs.k8s.io/cloud-provider-azure/pkg/nodemanager/metadata"
 	"sigs.k8s.io/cloud-provider-azure/pkg/provider/virtualmachine"
 )
 
@@ -282,13 +283,7 @@ func (ss *ScaleSet) GetPowerStatusByNodeName(name string) (powerState string, er
 	if vm.IsVirtualMachineScaleSetVM() {
 		v := vm.AsVirtualMachineScaleSetVM()
 		if v.InstanceView != nil && v.InstanceView.Statuses != nil {
-			statuses := *v.InstanceView.Statuses
-			for _, status := range statuses {
-				state := pointer.StringDeref(status.Code, "")
-				if strings.HasPrefix(state, vmPowerStatePrefix) {
-					return strings.TrimPrefix(state, vmPowerStatePrefix), nil
-				}
-			}
+			return getPowerStateFromStatuses(*v.InstanceView.Statuses), nil
 		}
 	}
 
@@ -512,6 +507,38 @@ func (ss *ScaleSet) GetInstanceTypeByNodeName(name string) (string, error) {
 	return "", nil
 }
 
+// GetNodeMetadataByNodeName gets the Azure metadata synced into the node labels and taints by node name.
+// The tags of the VMSS are inherited by its VMs.
+func (ss *ScaleSet) GetNodeMetadataByNodeName(name string) (*metadata.NodeMetadata, error) {
+	vmManagementType, err := ss.getVMManagementTypeByNodeName(name, azcache.CacheReadTypeUnsafe)
+	if err != nil {
+		klog.Errorf("Failed to check VM management type: %v", err)
+		return nil, err
+	}
+
+	if vmManagementType == ManagedByAvSet {
+		// vm is managed by availability set.
+		return ss.availabilitySet.GetNodeMetadataByNodeName(name)
+	}
+	if vmManagementType == ManagedByVmssFlex {
+		// vm is managed by vmss flex.
+		return ss.flexScaleSet.GetNodeMetadataByNodeName(name)
+	}
+
+	vm, err := ss.getVmssVM(name, azcache.CacheReadTypeUnsafe)
+	if err != nil {
+		return nil, err
+	}
+	if !vm.IsVirtualMachineScaleSetVM() {
+		return nil, fmt.Errorf("the node %s is not a VMSS VM", name)
+	}
+	vmss, err := ss.getVMSS(vm.VMSSName, azcache.CacheReadTypeUnsafe)
+	if err != nil {
+		return nil, err
+	}
+	return getNodeMetadataFromVMSSVM(vmss, vm.AsVirtualMachineScaleSetVM()), nil
+}
+
 // GetZoneByNodeName gets availability zone for the specified node. If the node is not running
 // with availability zone, then it returns fault domain.
 func (ss *ScaleSet) GetZoneByNodeName(name string) (cloudprovider.Zone, error) {
@@ -565,7 +592,11 @@ func (ss *ScaleSet) GetZoneByNodeName(name string) (cloudprovider.Zone, error) {
 
 // GetPrimaryVMSetName returns the VM set name depending on the configured vmType.
 // It returns config.PrimaryScaleSetName for vmss and config.PrimaryAvailabilitySetName for standard vmType.
+// With the mixed vmType, the primary availability set is used if the primary scale set is not set.
 func (ss *ScaleSet) GetPrimaryVMSetName() string {
+	if ss.Config.PrimaryScaleSetName == "" && strings.EqualFold(ss.Config.VMType, consts.VMTypeMixed) {
+		return ss.Config.PrimaryAvailabilitySetName
+	}
 	return ss.Config.PrimaryScaleSetName
 }
 
@@ -902,8 +933,8 @@ func (ss *ScaleSet) GetVMSetNames(service *v1.Service, nodes []*v1.Node) (*[]str
 	useSingleSLB := ss.useStandardLoadBalancer() && !ss.EnableMultipleStandardLoadBalancers
 	if !hasMode || useSingleSLB {
 		// no mode specified in service annotation or use single SLB mode
-		// default to PrimaryScaleSetName
-		scaleSetNames := &[]string{ss.Config.PrimaryScaleSetName}
+		// default to the primary VMSet name
+		scaleSetNames := &[]string{ss.GetPrimaryVMSetName()}
 		return scaleSetNames, nil
 	}
 
@@ -1246,8 +1277,9 @@ func (ss *ScaleSet) ensureVMSSInPool(service *v1.Service, nodes []*v1.Node, back
 	vmssNamesMap := make(map[string]bool)
 
 	// the single standard load balancer supports multiple vmss in its backend while
-	// multiple standard load balancers and the basic load balancer doesn't
-	if ss.useStandardLoadBalancer() && !ss.EnableMultipleStandardLoadBalancers {
+	// multiple standard load balancers and the basic load balancer doesn't, unless the
+	// nodes are selected by the load balancer profiles, where vmSetNameOfLB is empty.
+	if ss.useStandardLoadBalancer() && (!ss.EnableMultipleStandardLoadBalancers || vmSetNameOfLB == "") {
 		for _, node := range nodes {
 			if ss.excludeMasterNodesFromStandardLB() && isControlPlaneNode(node) {
 				continue
@@ -1581,6 +1613,349 @@ func (ss *ScaleSet) EnsureHostsInPool(service *v1.Service, nodes []*v1.Node, bac
 	return allErrors
 }
 
+// EnsureApplicationSecurityGroupMembers ensures the primary IP configurations of the given members are in the
+// specified application security group, and the IP configurations of the given non-member nodes are not.
+func (ss *ScaleSet) EnsureApplicationSecurityGroupMembers(service *v1.Service, members []*v1.Node, nonMembers []string, asgID string) error {
+	if ss.DisableAvailabilitySetNodes && !ss.EnableVmssFlexNodes {
+		return ss.ensureVMSSVMsInApplicationSecurityGroup(service, members, nonMembers, asgID)
+	}
+	vmssUniformNodes := make([]*v1.Node, 0)
+	vmssFlexNodes := make([]*v1.Node, 0)
+	vmasNodes := make([]*v1.Node, 0)
+	errs := make([]error, 0)
+	for _, node := range members {
+		vmManagementType, err := ss.getVMManagementTypeByNodeName(node.Name, azcache.CacheReadTypeDefault)
+		if err != nil {
+			klog.Errorf("Failed to check vmManagementType(%s): %v", node.Name, err)
+			errs = append(errs, err)
+			continue
+		}
+
+		switch vmManagementType {
+		case ManagedByAvSet:
+			vmasNodes = append(vmasNodes, node)
+		case ManagedByVmssFlex:
+			vmssFlexNodes = append(vmssFlexNodes, node)
+		default:
+			vmssUniformNodes = append(vmssUniformNodes, node)
+		}
+	}
+
+	vmssUniformNonMembers := make([]string, 0)
+	vmssFlexNonMembers := make([]string, 0)
+	vmasNonMembers := make([]string, 0)
+	for _, nodeName := range nonMembers {
+		vmManagementType, err := ss.getVMManagementTypeByNodeName(nodeName, azcache.CacheReadTypeDefault)
+		if err != nil {
+			if errors.Is(err, cloudprovider.InstanceNotFound) {
+				klog.V(4).Infof("EnsureApplicationSecurityGroupMembers: skipping node %s because it is not found", nodeName)
+				continue
+			}
+			klog.Errorf("Failed to check vmManagementType(%s): %v", nodeName, err)
+			errs = append(errs, err)
+			continue
+		}
+
+		switch vmManagementType {
+		case ManagedByAvSet:
+			vmasNonMembers = append(vmasNonMembers, nodeName)
+		case ManagedByVmssFlex:
+			vmssFlexNonMembers = append(vmssFlexNonMembers, nodeName)
+		default:
+			vmssUniformNonMembers = append(vmssUniformNonMembers, nodeName)
+		}
+	}
+
+	if len(vmssFlexNodes) > 0 || len(vmssFlexNonMembers) > 0 {
+		errs = append(errs, ss.flexScaleSet.EnsureApplicationSecurityGroupMembers(service, vmssFlexNodes, vmssFlexNonMembers, asgID))
+	}
+
+	if len(vmasNodes) > 0 || len(vmasNonMembers) > 0 {
+		errs = append(errs, ss.availabilitySet.EnsureApplicationSecurityGroupMembers(service, vmasNodes, vmasNonMembers, asgID))
+	}
+
+	if len(vmssUniformNodes) > 0 || len(vmssUniformNonMembers) > 0 {
+		errs = append(errs, ss.ensureVMSSVMsInApplicationSecurityGroup(service, vmssUniformNodes, vmssUniformNonMembers, asgID))
+	}
+
+	return utilerrors.Flatten(utilerrors.NewAggregate(errs))
+}
+
+// ensureVMSSVMsInApplicationSecurityGroup adds the primary IP configurations of the member VMSS VMs to the
+// application security group and removes the non-member VMSS VMs from it. The VMs are updated in batches per
+// VMSS, after which the VMSS models are updated so that the scaled out instances get the same membership.
+func (ss *ScaleSet) ensureVMSSVMsInApplicationSecurityGroup(service *v1.Service, members []*v1.Node, nonMembers []string, asgID string) error {
+	mc := metrics.NewMetricContext("services", "vmss_ensure_application_security_group_members", ss.ResourceGroup, ss.SubscriptionID, getServiceName(service))
+	isOperationSucceeded := false
+	defer func() {
+		mc.ObserveOperationWithResult(isOperationSucceeded)
+	}()
+
+	nodeNames := make(map[string]bool, len(members)+len(nonMembers))
+	for _, node := range members {
+		nodeNames[node.Name] = true
+	}
+	for _, nodeName := range nonMembers {
+		nodeNames[nodeName] = false
+	}
+
+	// vmssHasMembers records whether each VMSS of the given nodes has any member of the application security group.
+	vmssHasMembers := make(map[vmssMetaInfo]bool)
+	nodeUpdates := make(map[vmssMetaInfo]map[string]compute.VirtualMachineScaleSetVM)
+	errors := make([]error, 0)
+	for nodeName, wantMember := range nodeNames {
+		localNodeName := nodeName
+		nodeResourceGroup, nodeVMSS, nodeInstanceID, nodeVMSSVM, err := ss.ensureVMSSVMInApplicationSecurityGroup(service, localNodeName, asgID, wantMember)
+		if err != nil {
+			klog.Errorf("ensureVMSSVMInApplicationSecurityGroup(%s): asg(%s) - failed to ensure the membership of host %s: %v", getServiceName(service), asgID, localNodeName, err)
+			errors = append(errors, err)
+			continue
+		}
+		if nodeVMSS == "" {
+			continue
+		}
+
+		nodeVMSSMetaInfo := vmssMetaInfo{vmssName: nodeVMSS, resourceGroup: nodeResourceGroup}
+		vmssHasMembers[nodeVMSSMetaInfo] = vmssHasMembers[nodeVMSSMetaInfo] || wantMember
+
+		// No need to update if nodeVMSSVM is nil.
+		if nodeVMSSVM == nil {
+			continue
+		}
+
+		if v, ok := nodeUpdates[nodeVMSSMetaInfo]; ok {
+			v[nodeInstanceID] = *nodeVMSSVM
+		} else {
+			nodeUpdates[nodeVMSSMetaInfo] = map[string]compute.VirtualMachineScaleSetVM{
+				nodeInstanceID: *nodeVMSSVM,
+			}
+		}
+
+		// Invalidate the cache since the VMSS VM would be updated.
+		defer func() {
+			_ = ss.DeleteCacheForNode(localNodeName)
+		}()
+	}
+
+	hostUpdates := make([]func() error, 0, len(nodeUpdates))
+	for meta, update := range nodeUpdates {
+		meta := meta
+		update := update
+		hostUpdates = append(hostUpdates, func() error {
+			ctx, cancel := getContextWithCancel()
+			defer cancel()
+
+			logFields := []interface{}{
+				"operation", "EnsureApplicationSecurityGroupMembers UpdateVMSSVMs",
+				"vmssName", meta.vmssName,
+				"resourceGroup", meta.resourceGroup,
+				"asgID", asgID,
+			}
+
+			batchSize, err := ss.VMSSBatchSize(meta.vmssName)
+			if err != nil {
+				klog.ErrorS(err, "Failed to get vmss batch size", logFields...)
+				return err
+			}
+
+			klog.V(2).InfoS("Begin to update VMs for VMSS with the application security group membership", logFields...)
+			rerr := ss.VirtualMachineScaleSetVMsClient.UpdateVMs(ctx, meta.resourceGroup, meta.vmssName, update, "network_update", batchSize)
+			if rerr != nil {
+				klog.ErrorS(rerr.Error(), "Failed to update VMs for VMSS", logFields...)
+				return rerr.Error()
+			}
+
+			return nil
+		})
+	}
+	errs := utilerrors.AggregateGoroutines(hostUpdates...)
+	if errs != nil {
+		return utilerrors.Flatten(errs)
+	}
+
+	for meta, hasMembers := range vmssHasMembers {
+		// only vmsses in the resource group same as it's in azure config are updated
+		if !strings.EqualFold(meta.resourceGroup, ss.ResourceGroup) {
+			continue
+		}
+		if err := ss.ensureVMSSInApplicationSecurityGroup(service, meta.vmssName, asgID, hasMembers); err != nil {
+			errors = append(errors, err)
+		}
+	}
+
+	// Fail if there are other errors.
+	if len(errors) > 0 {
+		return utilerrors.Flatten(utilerrors.NewAggregate(errors))
+	}
+
+	isOperationSucceeded = true
+	return nil
+}
+
+// ensureVMSSVMInApplicationSecurityGroup composes the VMSS VM whose primary IP configuration is added to the
+// application security group if wantMember is true, or whose IP configurations are removed from the application
+// security group otherwise, which returns (resourceGroup, vmssName, instanceID, vmssVM, error). The returned
+// vmssVM is nil if the VM does not need to be updated, and the returned vmssName is empty if the VM is not found.
+func (ss *ScaleSet) ensureVMSSVMInApplicationSecurityGroup(service *v1.Service, nodeName, asgID string, wantMember bool) (string, string, string, *compute.VirtualMachineScaleSetVM, error) {
+	vmName := mapNodeNameToVMName(types.NodeName(nodeName))
+	vm, err := ss.getVmssVM(vmName, azcache.CacheReadTypeDefault)
+	if err != nil {
+		if errors.Is(err, cloudprovider.InstanceNotFound) {
+			klog.Infof("ensureVMSSVMInApplicationSecurityGroup: skipping node %s because it is not found", vmName)
+			return "", "", "", nil, nil
+		}
+		return "", "", "", nil, err
+	}
+
+	nodeResourceGroup, err := ss.GetNodeResourceGroup(vmName)
+	if err != nil {
+		return "", "", "", nil, err
+	}
+
+	if vm.VirtualMachineScaleSetVMProperties == nil ||
+		vm.VirtualMachineScaleSetVMProperties.NetworkProfileConfiguration == nil ||
+		vm.VirtualMachineScaleSetVMProperties.NetworkProfileConfiguration.NetworkInterfaceConfigurations == nil {
+		klog.V(4).Infof("ensureVMSSVMInApplicationSecurityGroup: cannot obtain the primary network interface configuration, of vm %s, "+
+			"probably because the vm's being deleted", vmName)
+		return nodeResourceGroup, vm.VMSSName, vm.InstanceID, nil, nil
+	}
+
+	networkInterfaceConfigurations := *vm.VirtualMachineScaleSetVMProperties.NetworkProfileConfiguration.NetworkInterfaceConfigurations
+	primaryNetworkInterfaceConfiguration, err := ss.getPrimaryNetworkInterfaceConfiguration(networkInterfaceConfigurations, vmName)
+	if err != nil {
+		return "", "", "", nil, err
+	}
+
+	changed, err := ss.ensureScaleSetNetworkConfigurationInApplicationSecurityGroup(service, primaryNetworkInterfaceConfiguration, vmName, asgID, wantMember)
+	if err != nil {
+		return "", "", "", nil, err
+	}
+	if !changed {
+		return nodeResourceGroup, vm.VMSSName, vm.InstanceID, nil, nil
+	}
+
+	newVM := &compute.VirtualMachineScaleSetVM{
+		Location: &vm.Location,
+		VirtualMachineScaleSetVMProperties: &compute.VirtualMachineScaleSetVMProperties{
+			HardwareProfile: vm.VirtualMachineScaleSetVMProperties.HardwareProfile,
+			NetworkProfileConfiguration: &compute.VirtualMachineScaleSetVMNetworkProfileConfiguration{
+				NetworkInterfaceConfigurations: &networkInterfaceConfigurations,
+			},
+		},
+	}
+
+	return nodeResourceGroup, vm.VMSSName, vm.InstanceID, newVM, nil
+}
+
+// ensureVMSSInApplicationSecurityGroup updates the model of the VMSS, so that the primary IP configuration of
+// its network profile is in the application security group if wantMember is true, or not in it otherwise.
+func (ss *ScaleSet) ensureVMSSInApplicationSecurityGroup(service *v1.Service, vmssName, asgID string, wantMember bool) error {
+	vmss, err := ss.getVMSS(vmssName, azcache.CacheReadTypeDefault)
+	if err != nil {
+		return err
+	}
+
+	// When vmss is being deleted, CreateOrUpdate API would report "the vmss is being deleted" error.
+	// Since it is being deleted, we shouldn't send more CreateOrUpdate requests for it.
+	if vmss.ProvisioningState != nil && strings.EqualFold(*vmss.ProvisioningState, consts.VirtualMachineScaleSetsDeallocating) {
+		klog.V(3).Infof("ensureVMSSInApplicationSecurityGroup: found vmss %s being deleted, skipping", vmssName)
+		return nil
+	}
+
+	if vmss.VirtualMachineProfile == nil || vmss.VirtualMachineProfile.NetworkProfile == nil ||
+		vmss.VirtualMachineProfile.NetworkProfile.NetworkInterfaceConfigurations == nil {
+		klog.V(4).Infof("ensureVMSSInApplicationSecurityGroup: cannot obtain the primary network interface configuration of vmss %s", vmssName)
+		return nil
+	}
+	vmssNIC := *vmss.VirtualMachineProfile.NetworkProfile.NetworkInterfaceConfigurations
+	primaryNIC, err := getPrimaryNetworkInterfaceConfigurationForScaleSet(vmssNIC, vmssName)
+	if err != nil {
+		return err
+	}
+
+	changed, err := ss.ensureScaleSetNetworkConfigurationInApplicationSecurityGroup(service, primaryNIC, "", asgID, wantMember)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return nil
+	}
+
+	newVMSS := compute.VirtualMachineScaleSet{
+		Location: vmss.Location,
+		VirtualMachineScaleSetProperties: &compute.VirtualMachineScaleSetProperties{
+			VirtualMachineProfile: &compute.VirtualMachineScaleSetVMProfile{
+				NetworkProfile: &compute.VirtualMachineScaleSetNetworkProfile{
+					NetworkInterfaceConfigurations: &vmssNIC,
+				},
+			},
+		},
+	}
+
+	klog.V(2).Infof("ensureVMSSInApplicationSecurityGroup begins to update vmss(%s) with the membership of asg(%s): %t", vmssName, asgID, wantMember)
+	rerr := ss.CreateOrUpdateVMSS(ss.ResourceGroup, vmssName, newVMSS)
+	if rerr != nil {
+		klog.Errorf("ensureVMSSInApplicationSecurityGroup CreateOrUpdateVMSS(%s) with the membership of asg(%s), err: %v", vmssName, asgID, rerr)
+		return rerr.Error()
+	}
+	return nil
+}
+
+// ensureScaleSetNetworkConfigurationInApplicationSecurityGroup adds the IP configuration of the VMSS network
+// configuration matching the IP family of the service to the application security group if wantMember is true,
+// otherwise it removes all the IP configurations from the application security group. It returns whether the
+// network configuration is changed.
+func (ss *ScaleSet) ensureScaleSetNetworkConfigurationInApplicationSecurityGroup(service *v1.Service, nic *compute.VirtualMachineScaleSetNetworkConfiguration, vmName, asgID string, wantMember bool) (bool, error) {
+	if !wantMember {
+		if nic.VirtualMachineScaleSetNetworkConfigurationProperties == nil || nic.IPConfigurations == nil {
+			return false, nil
+		}
+		var removed bool
+		for i := range *nic.IPConfigurations {
+			ipConfig := &(*nic.IPConfigurations)[i]
+			if ipConfig.VirtualMachineScaleSetIPConfigurationProperties == nil || ipConfig.ApplicationSecurityGroups == nil {
+				continue
+			}
+			newASGs := make([]compute.SubResource, 0, len(*ipConfig.ApplicationSecurityGroups))
+			for _, asg := range *ipConfig.ApplicationSecurityGroups {
+				if !strings.EqualFold(pointer.StringDeref(asg.ID, ""), asgID) {
+					newASGs = append(newASGs, asg)
+				}
+			}
+			if len(newASGs) != len(*ipConfig.ApplicationSecurityGroups) {
+				ipConfig.ApplicationSecurityGroups = &newASGs
+				removed = true
+			}
+		}
+		return removed, nil
+	}
+
+	var primaryIPConfiguration *compute.VirtualMachineScaleSetIPConfiguration
+	var err error
+	ipv6 := utilnet.IsIPv6String(service.Spec.ClusterIP)
+	if !ss.Cloud.ipv6DualStackEnabled && !ipv6 {
+		primaryIPConfiguration, err = getPrimaryIPConfigFromVMSSNetworkConfig(nic)
+	} else {
+		primaryIPConfiguration, err = getConfigForScaleSetByIPFamily(nic, vmName, ipv6)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	newASGs := []compute.SubResource{}
+	if primaryIPConfiguration.ApplicationSecurityGroups != nil {
+		newASGs = *primaryIPConfiguration.ApplicationSecurityGroups
+	}
+	for _, asg := range newASGs {
+		if strings.EqualFold(pointer.StringDeref(asg.ID, ""), asgID) {
+			return false, nil
+		}
+	}
+	newASGs = append(newASGs, compute.SubResource{ID: pointer.String(asgID)})
+	primaryIPConfiguration.ApplicationSecurityGroups = &newASGs
+	return true, nil
+}
+
 // ensureBackendPoolDeletedFromNode ensures the loadBalancer backendAddressPools deleted
 // from the specified node, which returns (resourceGroup, vmasName, instanceID, vmssVM, error).
 func (ss *ScaleSet) ensureBackendPoolDeletedFromNode(nodeName, backendPoolID string) (string, string, string, *compute.VirtualMachineScaleSetVM, error) {
@@ -1766,8 +2141,9 @@ func (ss *ScaleSet) ensureBackendPoolDeletedFromVmssUniform(backendPoolID, vmSet
 	klog.V(2).Infof("ensureBackendPoolDeletedFromVmssUniform: vmSetName (%s), backendPoolID (%s)", vmSetName, backendPoolID)
 
 	vmssNamesMap := make(map[string]bool)
-	// the standard load balancer supports multiple vmss in its backend while the basic sku doesn't
-	if ss.useStandardLoadBalancer() && !ss.EnableMultipleStandardLoadBalancers {
+	// the standard load balancer supports multiple vmss in its backend while the basic sku doesn't,
+	// and so does any standard load balancer whose nodes are selected by the load balancer profiles.
+	if ss.useStandardLoadBalancer() && (!ss.EnableMultipleStandardLoadBalancers || vmSetName == "") {
 		cachedUniform, err := ss.vmssCache.Get(consts.VMSSKey, azcache.CacheReadTypeDefault)
 		if err != nil {
 			klog.Errorf("ensureBackendPoolDeletedFromVMSS: failed to get vmss uniform from cache: %v", err)
@@ -375,6 +375,11 @@ func (ss *ScaleSet) getVMManagementTypeByNodeName(nodeName string, crt azcache.A
 	if ss.DisableAvailabilitySetNodes && !ss.EnableVmssFlexNodes {
 		return ManagedByVmssUniform, nil
 	}
+	if ss.vmManagementTypes != nil {
+		if vmManagementType, found := ss.vmManagementTypes.getByNodeName(nodeName); found {
+			return vmManagementType, nil
+		}
+	}
 	ss.lockMap.LockEntry(consts.VMManagementTypeLockKey)
 	defer ss.lockMap.UnlockEntry(consts.VMManagementTypeLockKey)
 	cached, err := ss.nonVmssUniformNodesCache.Get(consts.NonVmssUniformNodesKey, crt)
@@ -425,6 +430,11 @@ func (ss *ScaleSet) getVMManagementTypeByProviderID(providerID string, crt azcac
 	if err == nil {
 		return ManagedByVmssUniform, nil
 	}
+	if ss.vmManagementTypes != nil {
+		if vmManagementType, found := ss.vmManagementTypes.getByProviderID(providerID); found {
+			return vmManagementType, nil
+		}
+	}
 
 	ss.lockMap.LockEntry(consts.VMManagementTypeLockKey)
 	defer ss.lockMap.UnlockEntry(consts.VMManagementTypeLockKey)
@@ -2343,6 +2343,86 @@ func TestEnsureHostsInPool(t *testing.T) {
 	}
 }
 
+func TestEnsureApplicationSecurityGroupMembers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	asgID := "/subscriptions/subscription/resourceGroups/rg/providers/Microsoft.Network/applicationSecurityGroups/kubernetes-asg"
+	testCases := []struct {
+		description       string
+		members           []string
+		nonMembers        []string
+		expectedVMUpdates int
+		expectedVMSSASGs  *[]compute.SubResource
+	}{
+		{
+			description:       "should add the members and remove the non-members, and add the VMSS model to the application security group",
+			members:           []string{"vmss-vm-000000"},
+			nonMembers:        []string{"vmss-vm-000001", "vmss-vm-000002"},
+			expectedVMUpdates: 2,
+			expectedVMSSASGs:  &[]compute.SubResource{{ID: pointer.String(asgID)}},
+		},
+		{
+			description:       "should remove the VMSS model from the application security group if the VMSS has no members",
+			nonMembers:        []string{"vmss-vm-000000", "vmss-vm-000001"},
+			expectedVMUpdates: 1,
+			expectedVMSSASGs:  &[]compute.SubResource{},
+		},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.description, func(t *testing.T) {
+			ss, err := NewTestScaleSet(ctrl)
+			assert.NoError(t, err)
+
+			expectedVMSS := buildTestVMSSWithLB(testVMSSName, "vmss-vm-", []string{testLBBackendpoolID0}, false)
+			if len(test.members) == 0 {
+				vmssIPConfigs := *(*expectedVMSS.VirtualMachineProfile.NetworkProfile.NetworkInterfaceConfigurations)[0].IPConfigurations
+				vmssIPConfigs[0].ApplicationSecurityGroups = &[]compute.SubResource{{ID: pointer.String(asgID)}}
+			}
+			mockVMSSClient := ss.cloud.VirtualMachineScaleSetsClient.(*mockvmssclient.MockInterface)
+			mockVMSSClient.EXPECT().List(gomock.Any(), ss.ResourceGroup).Return([]compute.VirtualMachineScaleSet{expectedVMSS}, nil).AnyTimes()
+			mockVMSSClient.EXPECT().Get(gomock.Any(), ss.ResourceGroup, testVMSSName).Return(expectedVMSS, nil).MaxTimes(1)
+			mockVMSSClient.EXPECT().CreateOrUpdate(gomock.Any(), ss.ResourceGroup, testVMSSName, gomock.Any()).DoAndReturn(
+				func(_ interface{}, _, _ string, vmss compute.VirtualMachineScaleSet) *retry.Error {
+					ipConfig := (*(*vmss.VirtualMachineProfile.NetworkProfile.NetworkInterfaceConfigurations)[0].IPConfigurations)[0]
+					assert.Equal(t, test.expectedVMSSASGs, ipConfig.ApplicationSecurityGroups)
+					return nil
+				}).Times(1)
+
+			expectedVMSSVMs, _, _ := buildTestVirtualMachineEnv(ss.cloud, testVMSSName, "", 0, []string{"vmss-vm-000000", "vmss-vm-000001"}, "", false)
+			ipConfigs := (*(*expectedVMSSVMs[1].NetworkProfileConfiguration.NetworkInterfaceConfigurations)[0].IPConfigurations)
+			ipConfigs[0].ApplicationSecurityGroups = &[]compute.SubResource{{ID: pointer.String(asgID)}}
+			mockVMSSVMClient := ss.cloud.VirtualMachineScaleSetVMsClient.(*mockvmssvmclient.MockInterface)
+			mockVMSSVMClient.EXPECT().List(gomock.Any(), ss.ResourceGroup, testVMSSName, gomock.Any()).Return(expectedVMSSVMs, nil).AnyTimes()
+			mockVMSSVMClient.EXPECT().UpdateVMs(gomock.Any(), ss.ResourceGroup, testVMSSName, gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ interface{}, _, _ string, instances map[string]compute.VirtualMachineScaleSetVM, _ string, _ int) *retry.Error {
+					// the members are added and the non-members which are in the application security group are removed.
+					assert.Len(t, instances, test.expectedVMUpdates)
+					for instanceID, vm := range instances {
+						ipConfig := (*(*vm.NetworkProfileConfiguration.NetworkInterfaceConfigurations)[0].IPConfigurations)[0]
+						if instanceID == "0" {
+							assert.Equal(t, &[]compute.SubResource{{ID: pointer.String(asgID)}}, ipConfig.ApplicationSecurityGroups)
+						} else {
+							assert.Equal(t, &[]compute.SubResource{}, ipConfig.ApplicationSecurityGroups)
+						}
+					}
+					return nil
+				}).MaxTimes(1)
+
+			mockVMClient := ss.cloud.VirtualMachinesClient.(*mockvmclient.MockInterface)
+			mockVMClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+
+			members := make([]*v1.Node, 0, len(test.members))
+			for _, name := range test.members {
+				members = append(members, &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}})
+			}
+			err = ss.EnsureApplicationSecurityGroupMembers(&v1.Service{}, members, test.nonMembers, asgID)
+			assert.NoError(t, err)
+		})
+	}
+}
+
 func TestEnsureBackendPoolDeletedFromNode(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -37,6 +37,7 @@ import (
 	azcache "sigs.k8s.io/cloud-provider-azure/pkg/cache"
 	"sigs.k8s.io/cloud-provider-azure/pkg/consts"
 	"sigs.k8s.io/cloud-provider-azure/pkg/metrics"
+	"sigs.k8s.io/cloud-provider-azure/pkg/nodemanager/metadata"
 )
 
 var (
@@ -212,6 +213,29 @@ func (fs *FlexScaleSet) GetInstanceTypeByNodeName(name string) (string, error) {
 	return string(machine.HardwareProfile.VMSize), nil
 }
 
+// GetNodeMetadataByNodeName gets the Azure metadata synced into the node labels and taints by node name.
+// The tags of the VMSS flex are inherited by its VMs.
+func (fs *FlexScaleSet) GetNodeMetadataByNodeName(name string) (*metadata.NodeMetadata, error) {
+	vm, err := fs.getVmssFlexVM(name, azcache.CacheReadTypeUnsafe)
+	if err != nil {
+		klog.Errorf("fs.GetNodeMetadataByNodeName(%s) failed: fs.getVmssFlexVM(%s) err=%v", name, name, err)
+		return nil, err
+	}
+	vmssFlex, err := fs.getVmssFlexByNodeName(name, azcache.CacheReadTypeUnsafe)
+	if err != nil {
+		klog.Errorf("fs.GetNodeMetadataByNodeName(%s) failed: fs.getVmssFlexByNodeName(%s) err=%v", name, name, err)
+		return nil, err
+	}
+
+	nic, err := fs.GetPrimaryInterface(name)
+	if err != nil {
+		return nil, err
+	}
+	nodeMetadata := getNodeMetadataFromVM(&vm, vmssFlex)
+	setNodeAcceleratedNetworking(nodeMetadata, nic)
+	return nodeMetadata, nil
+}
+
 // GetZoneByNodeName gets availability zone for the specified node. If the node is not running
 // with availability zone, then it returns fault domain.
 // for details, refer to https://kubernetes-sigs.github.io/cloud-provider-azure/topics/availability-zones/#node-labels
@@ -270,13 +294,7 @@ func (fs *FlexScaleSet) GetPowerStatusByNodeName(name string) (powerState string
 	}
 
 	if vm.InstanceView != nil && vm.InstanceView.Statuses != nil {
-		statuses := *vm.InstanceView.Statuses
-		for _, status := range statuses {
-			state := pointer.StringDeref(status.Code, "")
-			if strings.HasPrefix(state, vmPowerStatePrefix) {
-				return strings.TrimPrefix(state, vmPowerStatePrefix), nil
-			}
-		}
+		return getPowerStateFromStatuses(*vm.InstanceView.Statuses), nil
 	}
 
 	// vm.InstanceView or vm.InstanceView.Statuses are nil when the VM is under deleting.
@@ -594,8 +612,9 @@ func (fs *FlexScaleSet) ensureVMSSFlexInPool(service *v1.Service, nodes []*v1.No
 	}
 
 	// the single standard load balancer supports multiple vmss in its backend while
-	// multiple standard load balancers doesn't
-	if fs.useStandardLoadBalancer() && !fs.EnableMultipleStandardLoadBalancers {
+	// multiple standard load balancers doesn't, unless the nodes are selected by the
+	// load balancer profiles, where vmSetNameOfLB is empty.
+	if fs.useStandardLoadBalancer() && (!fs.EnableMultipleStandardLoadBalancers || vmSetNameOfLB == "") {
 		for _, node := range nodes {
 			if fs.excludeMasterNodesFromStandardLB() && isControlPlaneNode(node) {
 				continue
@@ -797,9 +816,28 @@ func (fs *FlexScaleSet) EnsureHostsInPool(service *v1.Service, nodes []*v1.Node,
 	return nil
 }
 
+// EnsureApplicationSecurityGroupMembers ensures the primary IP configurations of the given members are in the
+// specified application security group, and the IP configurations of the given non-member nodes are not.
+func (fs *FlexScaleSet) EnsureApplicationSecurityGroupMembers(service *v1.Service, members []*v1.Node, nonMembers []string, asgID string) error {
+	mc := metrics.NewMetricContext("services", "vmssflex_ensure_application_security_group_members", fs.ResourceGroup, fs.SubscriptionID, getServiceName(service))
+	isOperationSucceeded := false
+	defer func() {
+		mc.ObserveOperationWithResult(isOperationSucceeded)
+	}()
+
+	errs := utilerrors.AggregateGoroutines(getInterfaceApplicationSecurityGroupUpdates(fs.Cloud, fs.GetPrimaryInterface, service, members, nonMembers, asgID)...)
+	if errs != nil {
+		return utilerrors.Flatten(errs)
+	}
+
+	isOperationSucceeded = true
+	return nil
+}
+
 func (fs *FlexScaleSet) ensureBackendPoolDeletedFromVmssFlex(backendPoolID string, vmSetName string) error {
 	vmssNamesMap := make(map[string]bool)
-	if fs.useStandardLoadBalancer() && !fs.EnableMultipleStandardLoadBalancers {
+	// an empty vmSetName means the nodes are selected by the load balancer profiles
+	if fs.useStandardLoadBalancer() && (!fs.EnableMultipleStandardLoadBalancers || vmSetName == "") {
 		cached, err := fs.vmssFlexCache.Get(consts.VmssFlexKey, azcache.CacheReadTypeDefault)
 		if err != nil {
 			klog.Errorf("ensureBackendPoolDeletedFromVmssFlex: failed to get vmss flex from cache: %v", err)
@@ -957,7 +995,7 @@ func (fs *FlexScaleSet) EnsureBackendPoolDeleted(service *v1.Service, backendPoo
 		}
 		// only vmsses in the resource group same as it's in azure config are included
 		if strings.EqualFold(resourceGroupName, fs.ResourceGroup) {
-			if fs.useStandardLoadBalancer() && !fs.EnableMultipleStandardLoadBalancers {
+			if fs.useStandardLoadBalancer() && (!fs.EnableMultipleStandardLoadBalancers || vmSetName == "") {
 				vmssFlexVMNameMap[nodeName] = nicName
 			} else {
 				if strings.EqualFold(vmssFlexName, vmSetName) {
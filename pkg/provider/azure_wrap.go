@@ -164,6 +164,59 @@ func (az *Cloud) getSubnet(virtualNetworkName string, subnetName string) (networ
 	return subnet, exists, nil
 }
 
+func (az *Cloud) getApplicationGateway(gwName string) (network.ApplicationGateway, bool, error) {
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	gw, err := az.ApplicationGatewayClient.Get(ctx, az.ApplicationGatewayResourceGroup, gwName, "")
+	exists, rerr := checkResourceExistsFromError(err)
+	if rerr != nil {
+		return gw, false, rerr.Error()
+	}
+
+	if !exists {
+		klog.V(2).Infof("Application gateway %q not found", gwName)
+		return gw, false, nil
+	}
+
+	return gw, exists, nil
+}
+
+func (az *Cloud) getApplicationSecurityGroup(asgName string) (network.ApplicationSecurityGroup, bool, error) {
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	asg, err := az.ApplicationSecurityGroupsClient.Get(ctx, az.SecurityGroupResourceGroup, asgName, "")
+	exists, rerr := checkResourceExistsFromError(err)
+	if rerr != nil {
+		return asg, false, rerr.Error()
+	}
+
+	if !exists {
+		klog.V(2).Infof("Application security group %q not found", asgName)
+		return asg, false, nil
+	}
+
+	return asg, exists, nil
+}
+
+// getGlobalLoadBalancer gets the cross-region load balancer. The global load balancers are shared by
+// several clusters, so they are not cached.
+func (az *Cloud) getGlobalLoadBalancer(lbName string) (network.LoadBalancer, bool, error) {
+	ctx, cancel := getContextWithCancel()
+	defer cancel()
+	lb, err := az.LoadBalancerClient.Get(ctx, az.GlobalLoadBalancerResourceGroup, lbName, "")
+	exists, rerr := checkResourceExistsFromError(err)
+	if rerr != nil {
+		return lb, false, rerr.Error()
+	}
+
+	if !exists {
+		klog.V(2).Infof("Global load balancer %q not found", lbName)
+		return lb, false, nil
+	}
+
+	return lb, exists, nil
+}
+
 func (az *Cloud) getAzureLoadBalancer(name string, crt azcache.AzureCacheReadType) (lb *network.LoadBalancer, exists bool, err error) {
 	cachedLB, err := az.lbCache.GetWithDeepCopy(name, crt)
 	if err != nil {
@@ -109,5 +109,9 @@ func TestInitializeCloudProviderRateLimitConfig(t *testing.T) {
 	assert.Equal(t, config.StorageAccountRateLimit, &testDefaultRateLimitConfig)
 	assert.Equal(t, config.DiskRateLimit, &testDefaultRateLimitConfig)
 	assert.Equal(t, config.SnapshotRateLimit, &testDefaultRateLimitConfig)
+	assert.Equal(t, config.ApplicationGatewayRateLimit, &testDefaultRateLimitConfig)
+	assert.Equal(t, config.ApplicationSecurityGroupRateLimit, &testDefaultRateLimitConfig)
+	assert.Equal(t, config.NatGatewayRateLimit, &testDefaultRateLimitConfig)
+	assert.Equal(t, config.DNSRecordSetRateLimit, &testDefaultRateLimitConfig)
 	assert.Equal(t, config.AttachDetachDiskRateLimit, &testAttachDetachDiskDefaultRateLimitConfig)
 }
@@ -19,6 +19,7 @@ package retry
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -343,6 +344,16 @@ func HasStatusForbiddenOrIgnoredError(err error) bool {
 	return false
 }
 
+// HasStatusPreconditionFailedError return true if the etag of the request does not match the resource,
+// which means the resource has been changed by others since it was read.
+func HasStatusPreconditionFailedError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	return strings.Contains(err.Error(), fmt.Sprintf("HTTPStatusCode: %d", http.StatusPreconditionFailed))
+}
+
 // GetVMSSMetadataByRawError gets the vmss name by parsing the error message
 func GetVMSSMetadataByRawError(err *Error) (string, string, error) {
 	if err == nil || !isErrorLoadBalancerInUseByVirtualMachineScaleSet(err.RawError.Error()) {
@@ -438,3 +449,14 @@ func NewPartialUpdateError(msg string) *PartialUpdateError {
 func (e *PartialUpdateError) Error() string {
 	return e.message
 }
+
+// GetServiceErrorCode returns the code of the autorest.ServiceError wrapped in err.
+// It is used to get the error code after the Error has been converted by Error().
+func GetServiceErrorCode(err error) string {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if code := (&Error{RawError: err}).ServiceErrorCode(); code != "" {
+			return code
+		}
+	}
+	return ""
+}
@@ -380,6 +380,12 @@ func TestHasErrorCode(t *testing.T) {
 	assert.True(t, result)
 }
 
+func TestHasStatusPreconditionFailedError(t *testing.T) {
+	assert.False(t, HasStatusPreconditionFailedError(nil))
+	assert.False(t, HasStatusPreconditionFailedError(fmt.Errorf("HTTPStatusCode: %d", http.StatusConflict)))
+	assert.True(t, HasStatusPreconditionFailedError(fmt.Errorf("HTTPStatusCode: %d", http.StatusPreconditionFailed)))
+}
+
 func TestGetVMSSNameByRawError(t *testing.T) {
 	rgName, vmssName, err := GetVMSSMetadataByRawError(&Error{RawError: fmt.Errorf(LBInUseRawError)})
 	assert.NoError(t, err)
@@ -478,3 +484,33 @@ func TestServiceErrorCode(t *testing.T) {
 		assert.Equal(t, test.expected, test.err.ServiceErrorCode())
 	}
 }
+
+func TestGetServiceErrorCode(t *testing.T) {
+	rawError := fmt.Errorf("%s", "{\"error\":{\"code\": \"ReferencedResourceNotProvisioned\",\"message\": \"Some error message\"}}")
+
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{
+			err:      nil,
+			expected: "",
+		},
+		{
+			err:      fmt.Errorf("some error"),
+			expected: "",
+		},
+		{
+			err:      (&Error{RawError: rawError}).Error(),
+			expected: "ReferencedResourceNotProvisioned",
+		},
+		{
+			err:      fmt.Errorf("reconcile failed: %w", (&Error{RawError: rawError}).Error()),
+			expected: "ReferencedResourceNotProvisioned",
+		},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, GetServiceErrorCode(test.err))
+	}
+}